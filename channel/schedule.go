@@ -0,0 +1,252 @@
+// Package channel plays scheduled sequence of media files as a continuous
+// simulated live stream, e.g. a 24/7 linear channel built from library.
+package channel
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// default number of segments in live playlist
+const DefaultWindow = 6
+
+// titles are written to single playlist line
+var titleEscaper = strings.NewReplacer("\r", " ", "\n", " ")
+
+var (
+	ErrNotStarted = errors.New("channel has not started yet")
+	ErrNoItems    = errors.New("channel has no items")
+)
+
+type Segment struct {
+	Name     string  // file name of segment served by item
+	Duration float64 // in seconds
+}
+
+// Item is a single media file of schedule.
+type Item struct {
+	Title    string
+	Path     string
+	Segments []Segment
+}
+
+// Programme is airing of item, as listed in schedule.
+type Programme struct {
+	Item  int       `json:"item"`
+	Title string    `json:"title"`
+	Path  string    `json:"path"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Schedule airs items one after another from its start. Every segment of
+// item becomes available in live playlist once it has been fully aired.
+type Schedule struct {
+	start time.Time
+	loop  bool
+	items []Item
+
+	segments []scheduled // segments of all items in airing order
+	offsets  []float64   // start of every item within pass, in seconds
+	duration float64     // of all items, in seconds
+	target   int         // target duration of playlist
+}
+
+type scheduled struct {
+	item    int
+	segment Segment
+	start   float64 // within pass, in seconds
+}
+
+func New(start time.Time, loop bool, items []Item) (*Schedule, error) {
+	if len(items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	s := &Schedule{
+		start: start,
+		loop:  loop,
+		items: items,
+	}
+
+	for i, item := range items {
+		if len(item.Segments) == 0 {
+			return nil, fmt.Errorf("item %q has no segments", item.Path)
+		}
+
+		s.offsets = append(s.offsets, s.duration)
+		for _, segment := range item.Segments {
+			if segment.Duration <= 0 {
+				return nil, fmt.Errorf("item %q has segment %q without duration", item.Path, segment.Name)
+			}
+
+			s.segments = append(s.segments, scheduled{
+				item:    i,
+				segment: segment,
+				start:   s.duration,
+			})
+
+			s.duration += segment.Duration
+			if target := int(math.Ceil(segment.Duration)); target > s.target {
+				s.target = target
+			}
+		}
+	}
+
+	return s, nil
+}
+
+// Duration returns time, that it takes to air all items once.
+func (s *Schedule) Duration() time.Duration {
+	return seconds(s.duration)
+}
+
+// Items returns scheduled items.
+func (s *Schedule) Items() []Item {
+	return s.items
+}
+
+// Guide returns programmes airing between from and to.
+func (s *Schedule) Guide(from, to time.Time) []Programme {
+	programmes := []Programme{}
+
+	pass := 0
+	if from.After(s.start) && s.loop {
+		pass = int(from.Sub(s.start).Seconds() / s.duration)
+	}
+
+	for ; s.loop || pass == 0; pass++ {
+		passStart := s.start.Add(seconds(float64(pass) * s.duration))
+		if !passStart.Before(to) {
+			break
+		}
+
+		for i, item := range s.items {
+			programme := s.programme(passStart, i)
+			if !programme.End.After(from) {
+				continue
+			}
+
+			if !programme.Start.Before(to) {
+				break
+			}
+
+			programme.Title, programme.Path = item.Title, item.Path
+			programmes = append(programmes, programme)
+		}
+	}
+
+	return programmes
+}
+
+// At returns programme airing at time, ok is false, if channel has not
+// started yet or it has already ended.
+func (s *Schedule) At(t time.Time) (programme Programme, ok bool) {
+	programmes := s.Guide(t, t.Add(time.Nanosecond))
+	if len(programmes) == 0 {
+		return Programme{}, false
+	}
+
+	return programmes[0], true
+}
+
+// returns airing of item in pass starting at passStart
+func (s *Schedule) programme(passStart time.Time, item int) Programme {
+	end := s.duration
+	if item+1 < len(s.offsets) {
+		end = s.offsets[item+1]
+	}
+
+	return Programme{
+		Item:  item,
+		Start: passStart.Add(seconds(s.offsets[item])),
+		End:   passStart.Add(seconds(end)),
+	}
+}
+
+// Playlist returns live media playlist at time now with up to window most
+// recently aired segments. Segments are addressed as [item]/[segment name]
+// relative to playlist, query is appended to them. Every item starts with
+// discontinuity, channel that does not loop ends with the last item.
+func (s *Schedule) Playlist(now time.Time, window int, query string) (string, error) {
+	if now.Before(s.start) {
+		return "", ErrNotStarted
+	}
+
+	if window <= 0 {
+		window = DefaultWindow
+	}
+
+	// number of segments aired since start
+	elapsed := now.Sub(s.start).Seconds()
+	pass := int(elapsed / s.duration)
+	aired := pass * len(s.segments)
+	for _, segment := range s.segments {
+		if segment.start+segment.segment.Duration > elapsed-float64(pass)*s.duration {
+			break
+		}
+		aired++
+	}
+
+	ended := false
+	if !s.loop && aired >= len(s.segments) {
+		aired, ended = len(s.segments), true
+	}
+
+	first := aired - window
+	if first < 0 {
+		first = 0
+	}
+
+	if query != "" {
+		query = "?" + query
+	}
+
+	lines := []string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		fmt.Sprintf("#EXT-X-TARGETDURATION:%d", s.target),
+		fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d", first),
+		fmt.Sprintf("#EXT-X-DISCONTINUITY-SEQUENCE:%d", s.discontinuity(first)),
+	}
+
+	for sequence := first; sequence < aired; sequence++ {
+		segment := s.segments[sequence%len(s.segments)]
+
+		// player resets decoder and timestamps between items
+		itemStart := segment.start == s.offsets[segment.item]
+		if itemStart && sequence > first {
+			lines = append(lines, "#EXT-X-DISCONTINUITY")
+		}
+
+		if itemStart || sequence == first {
+			aired := s.start.Add(seconds(float64(sequence/len(s.segments))*s.duration + segment.start))
+			lines = append(lines, "#EXT-X-PROGRAM-DATE-TIME:"+aired.UTC().Format("2006-01-02T15:04:05.000Z07:00"))
+		}
+
+		lines = append(lines,
+			fmt.Sprintf("#EXTINF:%.3f, %s", segment.segment.Duration, titleEscaper.Replace(s.items[segment.item].Title)),
+			fmt.Sprintf("%d/%s%s", segment.item, segment.segment.Name, query),
+		)
+	}
+
+	if ended {
+		lines = append(lines, "#EXT-X-ENDLIST")
+	}
+
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// returns discontinuity sequence of segment, that is number of items
+// started before item of segment
+func (s *Schedule) discontinuity(sequence int) int {
+	pass := sequence / len(s.segments)
+	return pass*len(s.items) + s.segments[sequence%len(s.segments)].item
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
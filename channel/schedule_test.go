@@ -0,0 +1,136 @@
+package channel
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func testSchedule(t *testing.T, loop bool) (*Schedule, time.Time) {
+	t.Helper()
+
+	start := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	schedule, err := New(start, loop, []Item{
+		{Title: "News", Path: "news.mp4", Segments: []Segment{{"v-00000.ts", 4}, {"v-00001.ts", 4}}},
+		{Title: "Movie", Path: "movie.mp4", Segments: []Segment{{"v-00000.ts", 6}, {"v-00001.ts", 2}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return schedule, start
+}
+
+func TestScheduleGuide(t *testing.T) {
+	schedule, start := testSchedule(t, true)
+
+	if schedule.Duration() != 16*time.Second {
+		t.Errorf("duration = %v", schedule.Duration())
+	}
+
+	programmes := schedule.Guide(start.Add(10*time.Second), start.Add(30*time.Second))
+	want := []Programme{
+		{Item: 1, Title: "Movie", Path: "movie.mp4", Start: start.Add(8 * time.Second), End: start.Add(16 * time.Second)},
+		{Item: 0, Title: "News", Path: "news.mp4", Start: start.Add(16 * time.Second), End: start.Add(24 * time.Second)},
+		{Item: 1, Title: "Movie", Path: "movie.mp4", Start: start.Add(24 * time.Second), End: start.Add(32 * time.Second)},
+	}
+
+	if len(programmes) != len(want) {
+		t.Fatalf("guide = %+v", programmes)
+	}
+
+	for i := range want {
+		if programmes[i] != want[i] {
+			t.Errorf("programme %d = %+v, want %+v", i, programmes[i], want[i])
+		}
+	}
+
+	if programme, ok := schedule.At(start.Add(100 * time.Second)); !ok || programme.Item != 0 {
+		t.Errorf("airing %+v, %v", programme, ok)
+	}
+
+	if _, ok := schedule.At(start.Add(-time.Second)); ok {
+		t.Error("programme airs before start")
+	}
+
+	// channel without loop ends after the last item
+	schedule, start = testSchedule(t, false)
+	if programmes := schedule.Guide(start, start.Add(time.Hour)); len(programmes) != 2 {
+		t.Errorf("guide of single pass = %+v", programmes)
+	}
+}
+
+func TestSchedulePlaylist(t *testing.T) {
+	schedule, start := testSchedule(t, true)
+
+	if _, err := schedule.Playlist(start.Add(-time.Second), 3, ""); err != ErrNotStarted {
+		t.Errorf("playlist before start returned %v", err)
+	}
+
+	// the second segment of movie has not been fully aired yet
+	playlist, err := schedule.Playlist(start.Add(15*time.Second), 3, "token=abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		"#EXT-X-TARGETDURATION:6",
+		"#EXT-X-MEDIA-SEQUENCE:0",
+		"#EXT-X-DISCONTINUITY-SEQUENCE:0",
+		"#EXT-X-PROGRAM-DATE-TIME:2024-01-01T12:00:00.000Z",
+		"#EXTINF:4.000, News",
+		"0/v-00000.ts?token=abc",
+		"#EXTINF:4.000, News",
+		"0/v-00001.ts?token=abc",
+		"#EXT-X-DISCONTINUITY",
+		"#EXT-X-PROGRAM-DATE-TIME:2024-01-01T12:00:08.000Z",
+		"#EXTINF:6.000, Movie",
+		"1/v-00000.ts?token=abc",
+	}, "\n") + "\n"
+
+	if playlist != want {
+		t.Errorf("playlist =\n%s\nwant\n%s", playlist, want)
+	}
+
+	// the second pass continues sequences
+	playlist, _ = schedule.Playlist(start.Add(20*time.Second), 3, "")
+	for _, line := range []string{
+		"#EXT-X-MEDIA-SEQUENCE:2",
+		"#EXT-X-DISCONTINUITY-SEQUENCE:1",
+		"#EXT-X-PROGRAM-DATE-TIME:2024-01-01T12:00:16.000Z",
+		"0/v-00000.ts\n",
+	} {
+		if !strings.Contains(playlist, line) {
+			t.Errorf("playlist of the second pass does not contain %q:\n%s", line, playlist)
+		}
+	}
+
+	if strings.Count(playlist, "#EXT-X-DISCONTINUITY\n") != 1 || strings.Contains(playlist, "#EXT-X-ENDLIST") {
+		t.Errorf("playlist of the second pass:\n%s", playlist)
+	}
+}
+
+func TestSchedulePlaylistEnd(t *testing.T) {
+	schedule, start := testSchedule(t, false)
+
+	playlist, err := schedule.Playlist(start.Add(time.Hour), 2, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(playlist, "#EXT-X-MEDIA-SEQUENCE:2\n") || !strings.HasSuffix(playlist, "1/v-00001.ts\n#EXT-X-ENDLIST\n") {
+		t.Errorf("playlist of ended channel:\n%s", playlist)
+	}
+}
+
+func TestScheduleInvalid(t *testing.T) {
+	if _, err := New(time.Now(), true, nil); err != ErrNoItems {
+		t.Errorf("schedule without items returned %v", err)
+	}
+
+	if _, err := New(time.Now(), true, []Item{{Path: "empty.mp4"}}); err == nil {
+		t.Error("item without segments is scheduled")
+	}
+}
@@ -0,0 +1,19 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/m1k1o/go-transcode/internal"
+)
+
+func init() {
+	command := &cobra.Command{
+		Use:   "ffmpeg-install",
+		Short: "install pinned ffmpeg build",
+		Long:  `download and verify pinned static ffmpeg build of this platform into ffmpeg-builds dir and print paths of its binaries`,
+		Args:  cobra.NoArgs,
+		Run:   transcode.Service.FFmpegInstallCommand,
+	}
+
+	root.AddCommand(command)
+}
@@ -0,0 +1,21 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+
+	"github.com/m1k1o/go-transcode/internal"
+)
+
+func init() {
+	command := &cobra.Command{
+		Use:   "plan [media-path]",
+		Short: "print segment plan of vod media",
+		Long:  `probe vod media relative to media-dir and print its segments as JSON, without transcoding`,
+		Args:  cobra.ExactArgs(1),
+		Run:   transcode.Service.PlanCommand,
+	}
+
+	command.Flags().StringP("output", "o", "", "write plan to file instead of stdout")
+
+	root.AddCommand(command)
+}
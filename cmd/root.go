@@ -12,6 +12,7 @@ import (
 	"github.com/spf13/viper"
 
 	transcode "github.com/m1k1o/go-transcode/internal"
+	"github.com/m1k1o/go-transcode/internal/utils"
 )
 
 func Execute() error {
@@ -30,7 +31,9 @@ func init() {
 		// logs
 		//////
 		zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
-		log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+		logFilter := utils.NewLogFilter(zerolog.ConsoleWriter{Out: os.Stdout})
+		log.Logger = log.Output(logFilter)
+		transcode.Service.LogFilter = logFilter
 
 		//////
 		// configs
@@ -68,10 +71,8 @@ func init() {
 		config := transcode.Service.RootConfig
 		config.Set()
 
-		if config.Debug {
-			zerolog.SetGlobalLevel(zerolog.DebugLevel)
-		} else {
-			zerolog.SetGlobalLevel(zerolog.InfoLevel)
+		if err := logFilter.Set(config.Log); err != nil {
+			log.Err(err).Msg("invalid log config")
 		}
 
 		file := viper.ConfigFileUsed()
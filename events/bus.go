@@ -0,0 +1,95 @@
+package events
+
+import "sync"
+
+type subscriber struct {
+	ch    chan Event
+	fn    func(Event)
+	types map[Type]struct{}
+}
+
+// Bus delivers published events to all subscribers. Publishing never blocks,
+// events are dropped for subscribers that do not keep up.
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers map[int]*subscriber
+	nextID      int
+}
+
+func New() *Bus {
+	return &Bus{
+		subscribers: map[int]*subscriber{},
+	}
+}
+
+// Publish sends event to all matching subscribers, it is safe to call on nil bus.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, sub := range b.subscribers {
+		if len(sub.types) > 0 {
+			if _, ok := sub.types[event.Type()]; !ok {
+				continue
+			}
+		}
+
+		if sub.fn != nil {
+			sub.fn(event)
+			continue
+		}
+
+		select {
+		case sub.ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns channel delivering events of given types (all events if
+// no type is specified) and function that cancels subscription.
+func (b *Bus) Subscribe(buffer int, types ...Type) (<-chan Event, func()) {
+	sub := &subscriber{
+		ch: make(chan Event, buffer),
+	}
+
+	return sub.ch, b.subscribe(sub, types, func() {
+		close(sub.ch)
+	})
+}
+
+// SubscribeFunc calls handler for every published event of given types (all
+// events if no type is specified), events are never dropped. Handler is called
+// synchronously by publisher, so it must be fast and must not publish events.
+// It returns function that cancels subscription.
+func (b *Bus) SubscribeFunc(handler func(Event), types ...Type) func() {
+	return b.subscribe(&subscriber{fn: handler}, types, func() {})
+}
+
+func (b *Bus) subscribe(sub *subscriber, types []Type, cancel func()) func() {
+	sub.types = map[Type]struct{}{}
+	for _, t := range types {
+		sub.types[t] = struct{}{}
+	}
+
+	b.mu.Lock()
+	id := b.nextID
+	b.nextID++
+	b.subscribers[id] = sub
+	b.mu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, id)
+			b.mu.Unlock()
+
+			cancel()
+		})
+	}
+}
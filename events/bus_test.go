@@ -0,0 +1,77 @@
+package events
+
+import "testing"
+
+func TestBusSubscribe(t *testing.T) {
+	bus := New()
+
+	all, unsubscribeAll := bus.Subscribe(10)
+	defer unsubscribeAll()
+
+	segments, unsubscribeSegments := bus.Subscribe(10, SegmentReadyType)
+
+	bus.Publish(SessionStarted{Session: "foo"})
+	bus.Publish(SegmentReady{Session: "foo", Index: 1})
+
+	if got := len(all); got != 2 {
+		t.Errorf("subscriber for all events received %d events, want 2", got)
+	}
+
+	if got := len(segments); got != 1 {
+		t.Fatalf("subscriber for segment events received %d events, want 1", got)
+	}
+
+	if event, ok := (<-segments).(SegmentReady); !ok || event.Index != 1 {
+		t.Errorf("subscriber for segment events received %v, want SegmentReady", event)
+	}
+
+	// unsubscribed channel must be closed and must not receive anything
+	unsubscribeSegments()
+	bus.Publish(SegmentReady{Session: "foo", Index: 2})
+
+	if _, ok := <-segments; ok {
+		t.Errorf("unsubscribed channel received event")
+	}
+}
+
+func TestBusPublishNonBlocking(t *testing.T) {
+	bus := New()
+
+	_, unsubscribe := bus.Subscribe(1)
+	defer unsubscribe()
+
+	// must not block even if subscriber does not read
+	for i := 0; i < 10; i++ {
+		bus.Publish(SegmentReady{Index: i})
+	}
+
+	// must not panic on nil bus
+	var nilBus *Bus
+	nilBus.Publish(SegmentReady{})
+}
+
+func TestBusSubscribeFunc(t *testing.T) {
+	bus := New()
+
+	var stopped []string
+	unsubscribe := bus.SubscribeFunc(func(event Event) {
+		stopped = append(stopped, event.(SessionStopped).Session)
+	}, SessionStoppedType)
+
+	// handler must receive every event, even in a burst
+	for i := 0; i < 1000; i++ {
+		bus.Publish(SessionStopped{Session: "foo"})
+		bus.Publish(SegmentReady{Session: "foo", Index: i})
+	}
+
+	if got := len(stopped); got != 1000 {
+		t.Errorf("handler received %d events, want 1000", got)
+	}
+
+	unsubscribe()
+	bus.Publish(SessionStopped{Session: "bar"})
+
+	if got := len(stopped); got != 1000 {
+		t.Errorf("unsubscribed handler received event")
+	}
+}
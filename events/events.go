@@ -0,0 +1,131 @@
+package events
+
+import "time"
+
+type Type string
+
+const (
+	SessionStartedType  Type = "session-started"
+	SessionStoppedType  Type = "session-stopped"
+	SegmentReadyType    Type = "segment-ready"
+	TranscodeFailedType Type = "transcode-failed"
+	CacheEvictedType    Type = "cache-evicted"
+	CmdLogType          Type = "cmd-log"
+	PublishFailedType   Type = "publish-failed"
+	InputAlertType      Type = "input-alert"
+	ProfileDegradedType Type = "profile-degraded"
+	SourceChangedType   Type = "source-changed"
+	ViewerJoinedType    Type = "viewer-joined"
+	ViewerLeftType      Type = "viewer-left"
+)
+
+type Event interface {
+	Type() Type
+}
+
+type SessionStarted struct {
+	Session string
+	Time    time.Time
+}
+
+func (SessionStarted) Type() Type { return SessionStartedType }
+
+type SessionStopped struct {
+	Session string
+	Time    time.Time
+	Err     error
+}
+
+func (SessionStopped) Type() Type { return SessionStoppedType }
+
+type SegmentReady struct {
+	Session string
+	Index   int
+	Name    string
+}
+
+func (SegmentReady) Type() Type { return SegmentReadyType }
+
+type TranscodeFailed struct {
+	Session string
+	Err     error
+	Class   string // well-known failure class, e.g. invalid-data, empty if unknown
+	Message string // log message that caused failure class
+}
+
+func (TranscodeFailed) Type() Type { return TranscodeFailedType }
+
+type CacheEvicted struct {
+	Session string
+	Key     string
+}
+
+func (CacheEvicted) Type() Type { return CacheEvictedType }
+
+type CmdLog struct {
+	Session string
+	Message string
+}
+
+func (CmdLog) Type() Type { return CmdLogType }
+
+type PublishFailed struct {
+	Session string
+	Name    string // segment or playlist, that was not published
+	Err     error
+}
+
+func (PublishFailed) Type() Type { return PublishFailedType }
+
+// InputAlert is published, when live input goes silent or black for
+// configured period, and again when it recovers.
+type InputAlert struct {
+	Session  string
+	Time     time.Time
+	Kind     string        // silence or black
+	Active   bool          // true when alert starts, false when input recovers
+	Duration time.Duration // how long has input been silent or black
+}
+
+func (InputAlert) Type() Type { return InputAlertType }
+
+// ProfileDegraded is published, when live session is restarted with faster
+// profile settings, because encoding was slower than real-time.
+type ProfileDegraded struct {
+	Session string
+	Time    time.Time
+	Level   int     // degradation level requested from profile
+	Speed   float64 // measured real-time factor
+}
+
+func (ProfileDegraded) Type() Type { return ProfileDegradedType }
+
+// SourceChanged is published, when source media of VOD session is replaced
+// or truncated, while session is running.
+type SourceChanged struct {
+	Session string
+	Time    time.Time
+	Path    string
+}
+
+func (SourceChanged) Type() Type { return SourceChangedType }
+
+// ViewerJoined is published, when new viewer starts requesting live stream.
+type ViewerJoined struct {
+	Stream  string
+	Viewer  string // hashed identity of viewer
+	Time    time.Time
+	Viewers int // concurrent viewers of stream including this one
+}
+
+func (ViewerJoined) Type() Type { return ViewerJoinedType }
+
+// ViewerLeft is published, when viewer stopped requesting live stream.
+type ViewerLeft struct {
+	Stream  string
+	Viewer  string // hashed identity of viewer
+	Time    time.Time
+	Viewers int // concurrent viewers of stream remaining
+}
+
+func (ViewerLeft) Type() Type { return ViewerLeftType }
@@ -0,0 +1,88 @@
+package hls
+
+import (
+	"time"
+)
+
+// DegradeEnv is environment variable passed to profile, when encoding was
+// slower than real-time. Level 1 asks for faster preset, level 2 also for
+// half resolution.
+const DegradeEnv = "DEGRADE"
+
+// maximum degradation level requested from profile
+const degradeMaxLevel = 2
+
+// period, over which is encode speed measured, if not specified
+const adaptiveWindow = 30 * time.Second
+
+type speedSample struct {
+	at    time.Time
+	media float64 // total duration of segments produced until this time
+}
+
+// speedMeter measures real-time factor of live encoding from durations of
+// segments listed in playlists and wall clock time of their arrival
+type speedMeter struct {
+	window  time.Duration
+	seen    map[string]bool
+	media   float64
+	samples []speedSample
+}
+
+func newSpeedMeter(window time.Duration) *speedMeter {
+	if window <= 0 {
+		window = adaptiveWindow
+	}
+
+	return &speedMeter{
+		window: window,
+		seen:   map[string]bool{},
+	}
+}
+
+// playlist records segments of media playlist, that were not seen before
+func (s *speedMeter) playlist(playlist string, now time.Time) {
+	_, segments := parseMediaPlaylist(playlist)
+
+	// segments removed from playlist never return, only listed are kept
+	seen := map[string]bool{}
+	added := false
+	for _, segment := range segments {
+		seen[segment.name] = true
+		if s.seen[segment.name] {
+			continue
+		}
+
+		s.media += segment.duration
+		added = true
+	}
+	s.seen = seen
+
+	// the first playlist lists segments produced since start
+	if !added && len(s.samples) > 0 {
+		return
+	}
+
+	s.samples = append(s.samples, speedSample{at: now, media: s.media})
+
+	// keep the latest sample before window as its base
+	for len(s.samples) > 2 && now.Sub(s.samples[1].at) >= s.window {
+		s.samples = s.samples[1:]
+	}
+}
+
+// speed returns real-time factor over window, false is returned until
+// encoding has been measured for the whole window
+func (s *speedMeter) speed() (float64, bool) {
+	if len(s.samples) < 2 {
+		return 0, false
+	}
+
+	base, last := s.samples[0], s.samples[len(s.samples)-1]
+	elapsed := last.at.Sub(base.at)
+	if elapsed < s.window {
+		return 0, false
+	}
+
+	return (last.media - base.media) / elapsed.Seconds(), true
+}
@@ -0,0 +1,57 @@
+package hls
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// returns live playlist with 2 second segments from first to last
+func speedPlaylist(first, last int) string {
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:2\n")
+	for i := first; i <= last; i++ {
+		sb.WriteString(fmt.Sprintf("#EXTINF:2.000000,\nlive_%03d.ts\n", i))
+	}
+	return sb.String()
+}
+
+func TestSpeedMeter(t *testing.T) {
+	start := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+	s := newSpeedMeter(10 * time.Second)
+
+	// segment of 2 seconds is produced every 4 seconds
+	for i := 0; i < 3; i++ {
+		s.playlist(speedPlaylist(0, i), start.Add(time.Duration(i)*4*time.Second))
+	}
+
+	if _, ok := s.speed(); ok {
+		t.Error("speed is reported before window was measured")
+	}
+
+	// playlist without new segment does not change speed
+	for i := 3; i < 8; i++ {
+		s.playlist(speedPlaylist(i-3, i), start.Add(time.Duration(i)*4*time.Second))
+		s.playlist(speedPlaylist(i-3, i), start.Add(time.Duration(i)*4*time.Second+time.Second))
+	}
+
+	speed, ok := s.speed()
+	if !ok {
+		t.Fatal("speed is not reported after window")
+	}
+	if speed != 0.5 {
+		t.Errorf("speed = %v, want 0.5", speed)
+	}
+
+	// encoding catches up, segment is produced every 2 seconds
+	now := start.Add(7 * 4 * time.Second)
+	for i := 8; i < 16; i++ {
+		now = now.Add(2 * time.Second)
+		s.playlist(speedPlaylist(i-3, i), now)
+	}
+
+	if speed, _ := s.speed(); speed != 1 {
+		t.Errorf("speed = %v, want 1", speed)
+	}
+}
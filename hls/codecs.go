@@ -0,0 +1,293 @@
+package hls
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// init segment of fMP4 variant playlist
+var hlsMapRegex = regexp.MustCompile(`#EXT-X-MAP:.*URI="([^"]+)"`)
+
+// codecs, that are not supported by many HLS clients (native players of
+// older Apple devices, smart TVs), with explanation
+var hlsCodecsWarnings = map[string]string{
+	"vp09": "VP9 in HLS is supported only by recent Apple devices and MSE players (e.g. hls.js) in browsers with VP9 support, prefer DASH or provide H.264 fallback",
+	"opus": "Opus in HLS is supported only by recent Apple devices and MSE players (e.g. hls.js) in browsers with Opus support, prefer DASH or provide AAC fallback",
+}
+
+type mp4Box struct {
+	typ  string
+	data []byte // payload without header
+}
+
+// splits payload into boxes
+func mp4Boxes(data []byte) ([]mp4Box, error) {
+	boxes := []mp4Box{}
+
+	for len(data) > 0 {
+		if len(data) < 8 {
+			return nil, errors.New("truncated box header")
+		}
+
+		size := uint64(binary.BigEndian.Uint32(data))
+		typ := string(data[4:8])
+		header := uint64(8)
+
+		switch size {
+		case 0: // box extends to the end
+			size = uint64(len(data))
+		case 1: // 64-bit size follows type
+			if len(data) < 16 {
+				return nil, errors.New("truncated box header")
+			}
+			size = binary.BigEndian.Uint64(data[8:])
+			header = 16
+		}
+
+		if size < header || size > uint64(len(data)) {
+			return nil, fmt.Errorf("invalid size of box %q", typ)
+		}
+
+		boxes = append(boxes, mp4Box{typ: typ, data: data[header:size]})
+		data = data[size:]
+	}
+
+	return boxes, nil
+}
+
+// returns payloads of all boxes found at given path
+func mp4Find(data []byte, boxPath ...string) [][]byte {
+	boxes, err := mp4Boxes(data)
+	if err != nil {
+		return nil
+	}
+
+	found := [][]byte{}
+	for _, box := range boxes {
+		if box.typ != boxPath[0] {
+			continue
+		}
+
+		if len(boxPath) == 1 {
+			found = append(found, box.data)
+		} else {
+			found = append(found, mp4Find(box.data, boxPath[1:]...)...)
+		}
+	}
+
+	return found
+}
+
+// InitSegmentCodecs returns RFC 6381 codecs of all tracks in fMP4 init segment.
+func InitSegmentCodecs(data []byte) ([]string, error) {
+	codecs := []string{}
+
+	for _, stsd := range mp4Find(data, "moov", "trak", "mdia", "minf", "stbl", "stsd") {
+		// full box header and entry count
+		if len(stsd) < 8 {
+			return nil, errors.New("truncated stsd box")
+		}
+
+		entries, err := mp4Boxes(stsd[8:])
+		if err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			codec, err := sampleEntryCodec(entry)
+			if err != nil {
+				return nil, err
+			}
+
+			codecs = append(codecs, codec)
+		}
+	}
+
+	if len(codecs) == 0 {
+		return nil, errors.New("no tracks found")
+	}
+
+	return codecs, nil
+}
+
+// returns codec of sample entry, child boxes follow fixed fields of
+// visual (78 bytes) or audio (28 bytes) sample entry
+func sampleEntryCodec(entry mp4Box) (string, error) {
+	child := func(offset int, typ string) []byte {
+		if len(entry.data) < offset {
+			return nil
+		}
+
+		boxes, err := mp4Boxes(entry.data[offset:])
+		if err != nil {
+			return nil
+		}
+
+		for _, box := range boxes {
+			if box.typ == typ {
+				return box.data
+			}
+		}
+
+		return nil
+	}
+
+	switch entry.typ {
+	case "avc1", "avc3":
+		avcC := child(78, "avcC")
+		if len(avcC) < 4 {
+			return "", errors.New("missing avcC box")
+		}
+
+		return fmt.Sprintf("%s.%02x%02x%02x", entry.typ, avcC[1], avcC[2], avcC[3]), nil
+	case "vp09":
+		// full box header, profile, level, bit depth in upper 4 bits
+		vpcC := child(78, "vpcC")
+		if len(vpcC) < 7 {
+			return "", errors.New("missing vpcC box")
+		}
+
+		return fmt.Sprintf("vp09.%02d.%02d.%02d", vpcC[4], vpcC[5], vpcC[6]>>4), nil
+	case "mp4a":
+		return esdsCodec(child(28, "esds")), nil
+	case "Opus":
+		return "opus", nil
+	case "fLaC":
+		return "fLaC", nil
+	}
+
+	return "", fmt.Errorf("unsupported sample entry %q", entry.typ)
+}
+
+// returns codec of MPEG-4 audio from elementary stream descriptor, AAC-LC
+// is assumed, if it cannot be parsed
+func esdsCodec(esds []byte) string {
+	const fallback = "mp4a.40.2"
+
+	// reads descriptor tag and variable length size
+	descriptor := func(data []byte) (byte, []byte, bool) {
+		if len(data) < 2 {
+			return 0, nil, false
+		}
+
+		tag, size, i := data[0], 0, 1
+		for ; i < len(data) && i <= 4; i++ {
+			size = size<<7 | int(data[i]&0x7f)
+			if data[i]&0x80 == 0 {
+				i++
+				break
+			}
+		}
+
+		if i+size > len(data) {
+			size = len(data) - i
+		}
+
+		return tag, data[i : i+size], true
+	}
+
+	// full box header
+	if len(esds) < 4 {
+		return fallback
+	}
+
+	tag, es, ok := descriptor(esds[4:])
+	if !ok || tag != 0x03 || len(es) < 3 {
+		return fallback
+	}
+
+	// ES_ID and flags, optional fields are skipped
+	flags, offset := es[2], 3
+	if flags&0x80 != 0 {
+		offset += 2
+	}
+	if flags&0x40 != 0 && offset < len(es) {
+		offset += 1 + int(es[offset])
+	}
+	if flags&0x20 != 0 {
+		offset += 2
+	}
+	if offset >= len(es) {
+		return fallback
+	}
+
+	tag, config, ok := descriptor(es[offset:])
+	if !ok || tag != 0x04 || len(config) < 13 {
+		return fallback
+	}
+
+	objectType := config[0]
+	tag, specific, ok := descriptor(config[13:])
+	if !ok || tag != 0x05 || len(specific) < 1 {
+		return fmt.Sprintf("mp4a.%02x", objectType)
+	}
+
+	return fmt.Sprintf("mp4a.%02x.%d", objectType, specific[0]>>3)
+}
+
+// returns codecs of variant playlist from its init segment
+func variantCodecs(dir, variant string) ([]string, error) {
+	playlist, err := os.ReadFile(filepath.Join(dir, path.Base(variant)))
+	if err != nil {
+		return nil, err
+	}
+
+	match := hlsMapRegex.FindStringSubmatch(string(playlist))
+	if match == nil {
+		return nil, errors.New("variant has no init segment")
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, path.Base(match[1])))
+	if err != nil {
+		return nil, err
+	}
+
+	return InitSegmentCodecs(data)
+}
+
+// adds CODECS attribute to fMP4 variants of master playlist, that do not
+// have it, returns master playlist and all codecs of its variants
+func masterCodecs(master, dir string) (string, []string) {
+	lines := strings.Split(master, "\n")
+	all := []string{}
+
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#EXT-X-STREAM-INF:") || i+1 >= len(lines) {
+			continue
+		}
+
+		codecs, err := variantCodecs(dir, strings.TrimSpace(lines[i+1]))
+		if err != nil {
+			continue
+		}
+
+		all = append(all, codecs...)
+		if !strings.Contains(line, "CODECS=") {
+			lines[i] = strings.TrimRight(line, "\r") + fmt.Sprintf(`,CODECS="%s"`, strings.Join(codecs, ","))
+		}
+	}
+
+	return strings.Join(lines, "\n"), all
+}
+
+// returns warnings about codecs, that are not widely supported by HLS clients
+func hlsCodecsCompatibility(codecs []string) []string {
+	warnings := []string{}
+	seen := map[string]bool{}
+
+	for _, codec := range codecs {
+		family := strings.SplitN(codec, ".", 2)[0]
+		if warning, ok := hlsCodecsWarnings[family]; ok && !seen[family] {
+			seen[family] = true
+			warnings = append(warnings, warning)
+		}
+	}
+
+	return warnings
+}
@@ -0,0 +1,113 @@
+package hls
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testBox(typ string, payload ...[]byte) []byte {
+	size := 8
+	for _, p := range payload {
+		size += len(p)
+	}
+
+	box := make([]byte, 8, size)
+	binary.BigEndian.PutUint32(box, uint32(size))
+	copy(box[4:], typ)
+
+	for _, p := range payload {
+		box = append(box, p...)
+	}
+
+	return box
+}
+
+// returns init segment with single track of given sample entry
+func testInitSegment(entries ...[]byte) []byte {
+	traks := [][]byte{}
+	for _, entry := range entries {
+		stsd := testBox("stsd", []byte{0, 0, 0, 0, 0, 0, 0, 1}, entry)
+		traks = append(traks, testBox("trak", testBox("mdia", testBox("minf", testBox("stbl", stsd)))))
+	}
+
+	return append(testBox("ftyp", []byte("iso6")), testBox("moov", traks...)...)
+}
+
+func TestInitSegmentCodecs(t *testing.T) {
+	visual := make([]byte, 78)
+	audio := make([]byte, 28)
+
+	vp9 := testBox("vp09", visual, testBox("vpcC", []byte{1, 0, 0, 0, 0, 31, 0x80, 0}))
+	avc := testBox("avc1", visual, testBox("avcC", []byte{1, 0x64, 0x00, 0x1f}))
+	opus := testBox("Opus", audio, testBox("dOps", []byte{0}))
+
+	// ES descriptor with decoder config of AAC-LC
+	esds := testBox("esds", []byte{0, 0, 0, 0,
+		0x03, 0x16, 0x00, 0x01, 0x00,
+		0x04, 0x11, 0x40, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		0x05, 0x02, 0x12, 0x10,
+	})
+	aac := testBox("mp4a", audio, esds)
+
+	codecs, err := InitSegmentCodecs(testInitSegment(vp9, opus))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"vp09.00.31.08", "opus"}; !reflect.DeepEqual(codecs, want) {
+		t.Errorf("InitSegmentCodecs() = %v, want %v", codecs, want)
+	}
+
+	codecs, err = InitSegmentCodecs(testInitSegment(avc, aac))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []string{"avc1.64001f", "mp4a.40.2"}; !reflect.DeepEqual(codecs, want) {
+		t.Errorf("InitSegmentCodecs() = %v, want %v", codecs, want)
+	}
+
+	if _, err := InitSegmentCodecs([]byte{0, 0, 0, 42, 'm', 'o', 'o', 'v'}); err == nil {
+		t.Errorf("truncated init segment was parsed")
+	}
+}
+
+func TestMasterCodecs(t *testing.T) {
+	dir := t.TempDir()
+
+	visual := make([]byte, 78)
+	audio := make([]byte, 28)
+	init := testInitSegment(
+		testBox("vp09", visual, testBox("vpcC", []byte{1, 0, 0, 0, 0, 31, 0x80, 0})),
+		testBox("Opus", audio, testBox("dOps", []byte{0})),
+	)
+
+	if err := os.WriteFile(filepath.Join(dir, "init.mp4"), init, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	variant := "#EXTM3U\n#EXT-X-MAP:URI=\"init.mp4\"\n#EXTINF:2.0,\nlive_001.m4s\n"
+	if err := os.WriteFile(filepath.Join(dir, "stream.m3u8"), []byte(variant), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1928000,RESOLUTION=1280x720\nstream.m3u8\n"
+	got, codecs := masterCodecs(master, dir)
+
+	if !strings.Contains(got, `RESOLUTION=1280x720,CODECS="vp09.00.31.08,opus"`+"\nstream.m3u8") {
+		t.Errorf("masterCodecs() = %q", got)
+	}
+
+	if warnings := hlsCodecsCompatibility(codecs); len(warnings) != 2 {
+		t.Errorf("got %d compatibility warnings, want 2", len(warnings))
+	}
+
+	// H.264 and AAC are supported by all clients
+	if warnings := hlsCodecsCompatibility([]string{"avc1.64001f", "mp4a.40.2"}); len(warnings) != 0 {
+		t.Errorf("got compatibility warnings for H.264 and AAC: %v", warnings)
+	}
+}
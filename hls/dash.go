@@ -0,0 +1,150 @@
+package hls
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// name of LL-DASH manifest, that profile writes to working directory
+const dashManifestName = "manifest.mpd"
+
+// suffix of chunk, that is still being written, ffmpeg renames it when chunk is complete
+const dashTempSuffix = ".tmp"
+
+// how long to wait for chunk, that was not started yet, players request
+// chunks ahead of their completion by availabilityTimeOffset
+const dashChunkWait = 4 * time.Second
+
+// how often is in-progress chunk checked for new data
+const dashChunkPoll = 50 * time.Millisecond
+
+// how long can in-progress chunk stay without new data, before it is abandoned
+const dashChunkIdle = 10 * time.Second
+
+// returns manifest written to working directory, when it lists any representation
+func (m *ManagerCtx) readManifest() (string, bool) {
+	data, err := os.ReadFile(filepath.Join(m.tempdir, dashManifestName))
+	if err != nil || !strings.Contains(string(data), "<Representation") {
+		return "", false
+	}
+
+	return string(data), true
+}
+
+func (m *ManagerCtx) ServeManifest(w http.ResponseWriter, r *http.Request) {
+	manifest, ok := m.waitPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	// dynamic manifest is rewritten by profile, serve the latest one
+	if latest, ok := m.readManifest(); ok {
+		manifest = latest
+	}
+
+	w.Header().Set("Content-Type", "application/dash+xml")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, _ = w.Write([]byte(manifest))
+}
+
+// opens complete chunk or chunk, that is still being written, waits until
+// it is started, returns true if chunk is complete
+func openChunk(ctx context.Context, filePath string) (*os.File, bool, error) {
+	deadline := time.Now().Add(dashChunkWait)
+
+	for {
+		if file, err := os.Open(filePath); err == nil {
+			return file, true, nil
+		}
+
+		if file, err := os.Open(filePath + dashTempSuffix); err == nil {
+			return file, false, nil
+		}
+
+		if time.Now().After(deadline) {
+			return nil, false, os.ErrNotExist
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		case <-time.After(dashChunkPoll):
+		}
+	}
+}
+
+// serves CMAF chunk with chunked transfer, so that player receives its
+// fragments as soon as they are encoded
+func (m *ManagerCtx) serveChunk(w http.ResponseWriter, r *http.Request, filePath string) {
+	file, complete, err := openChunk(r.Context(), filePath)
+	if err != nil {
+		m.logger.Warn().Str("path", filePath).Msg("chunk not found")
+		m.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "media not found")
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", utils.MediaContentType(filePath))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if complete {
+		if fi, err := file.Stat(); err == nil {
+			http.ServeContent(w, r, filePath, fi.ModTime(), file)
+			return
+		}
+	}
+
+	flusher, _ := w.(http.Flusher)
+	buf := make([]byte, 32*1024)
+	lastData := time.Now()
+
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+
+			if flusher != nil {
+				flusher.Flush()
+			}
+
+			lastData = time.Now()
+			continue
+		}
+
+		if err != nil && err != io.EOF {
+			m.logger.Err(err).Str("path", filePath).Msg("unable to read chunk")
+			return
+		}
+
+		// renamed chunk is complete, remaining data is read from the same file
+		if complete {
+			return
+		}
+
+		if _, err := os.Stat(filePath); err == nil {
+			complete = true
+			continue
+		}
+
+		if time.Since(lastData) > dashChunkIdle {
+			m.logger.Warn().Str("path", filePath).Msg("chunk is not growing, abandoning it")
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(dashChunkPoll):
+		}
+	}
+}
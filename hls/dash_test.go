@@ -0,0 +1,90 @@
+package hls
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeChunkInProgress(t *testing.T) {
+	dir := t.TempDir()
+	m := New(nil, "dash/test", nil, Config{Dash: true})
+	m.tempdir = dir
+
+	chunkPath := filepath.Join(dir, "chunk-stream0-00001.m4s")
+	if err := os.WriteFile(chunkPath+dashTempSuffix, []byte("moof1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// encoder appends fragment and completes chunk
+	go func() {
+		time.Sleep(2 * dashChunkPoll)
+
+		f, err := os.OpenFile(chunkPath+dashTempSuffix, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		_, _ = f.Write([]byte("moof2"))
+		f.Close()
+
+		time.Sleep(2 * dashChunkPoll)
+		if err := os.Rename(chunkPath+dashTempSuffix, chunkPath); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	m.ServeMedia(w, httptest.NewRequest("GET", "/dash/test/chunk-stream0-00001.m4s", nil))
+
+	if got := w.Body.String(); got != "moof1moof2" {
+		t.Errorf("got body %q, want complete chunk", got)
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "video/mp4" {
+		t.Errorf("got content type %q, want video/mp4", got)
+	}
+}
+
+func TestServeChunkNotStarted(t *testing.T) {
+	dir := t.TempDir()
+	m := New(nil, "dash/test", nil, Config{Dash: true})
+	m.tempdir = dir
+
+	chunkPath := filepath.Join(dir, "chunk-stream0-00002.m4s")
+
+	// chunk is requested ahead of encoder
+	go func() {
+		time.Sleep(2 * dashChunkPoll)
+		if err := os.WriteFile(chunkPath, []byte("moof"), 0644); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	w := httptest.NewRecorder()
+	m.ServeMedia(w, httptest.NewRequest("GET", "/dash/test/chunk-stream0-00002.m4s", nil))
+
+	if w.Code != 200 || w.Body.String() != "moof" {
+		t.Errorf("got %d %q, want complete chunk", w.Code, w.Body.String())
+	}
+}
+
+func TestReadManifest(t *testing.T) {
+	m := New(nil, "dash/test", nil, Config{Dash: true})
+	m.tempdir = t.TempDir()
+
+	if _, ok := m.readManifest(); ok {
+		t.Fatal("missing manifest is not ready")
+	}
+
+	manifest := `<MPD><Period><AdaptationSet><Representation id="0"/></AdaptationSet></Period></MPD>`
+	if err := os.WriteFile(filepath.Join(m.tempdir, dashManifestName), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, ok := m.readManifest(); !ok || got != manifest {
+		t.Errorf("got %q, %v, want manifest", got, ok)
+	}
+}
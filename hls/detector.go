@@ -0,0 +1,262 @@
+package hls
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// kinds of input alerts
+const (
+	AlertSilence = "silence"
+	AlertBlack   = "black"
+)
+
+// gap between black frames, that is considered as picture recovery
+const detectBlackGap = time.Second
+
+// analyzed video frames per second, black detection does not need all of them
+const detectBlackFps = 2
+
+// delay before detector is restarted, when it exits while session is running
+const detectRestartDelay = 5 * time.Second
+
+type DetectConfig struct {
+	FFmpegBinary string
+	Input        string        // Live input, that is analyzed alongside session, empty means disabled.
+	InputArgs    []string      // Options placed before input, e.g. headers of protected upstream.
+	Silence      time.Duration // Alert, when audio is silent for this period, 0 means disabled.
+	SilenceNoise string        // Noise tolerance of silence, e.g. -50dB.
+	Black        time.Duration // Alert, when video is black for this period, 0 means disabled.
+	BlackAmount  int           // Percentage of pixels, that must be black.
+}
+
+func (c DetectConfig) enabled() bool {
+	return c.Input != "" && (c.Silence > 0 || c.Black > 0)
+}
+
+func (c DetectConfig) args() []string {
+	args := []string{
+		"-hide_banner",
+		"-nostats",
+		"-loglevel", "info",
+	}
+
+	args = append(args, c.InputArgs...)
+	args = append(args, "-i", c.Input)
+
+	if c.Black > 0 {
+		args = append(args, "-vf", fmt.Sprintf("fps=%d,blackframe=amount=%d", detectBlackFps, c.BlackAmount))
+	} else {
+		args = append(args, "-vn")
+	}
+
+	if c.Silence > 0 {
+		args = append(args, "-af", fmt.Sprintf("silencedetect=noise=%s:d=%.3f", c.SilenceNoise, c.Silence.Seconds()))
+	} else {
+		args = append(args, "-an")
+	}
+
+	return append(args, "-f", "null", "-")
+}
+
+var (
+	silenceStartRegex = regexp.MustCompile(`silence_start: (-?[0-9.]+)`)
+	silenceEndRegex   = regexp.MustCompile(`silence_duration: ([0-9.]+)`)
+	blackFrameRegex   = regexp.MustCompile(`blackframe.* t:([0-9.]+)`)
+)
+
+// detectorState tracks silence and black periods reported in ffmpeg log
+type detectorState struct {
+	config DetectConfig
+
+	silenceActive bool
+
+	blackActive bool
+	blackStart  float64 // stream time of first black frame, negative if none
+	blackLast   float64 // stream time of last black frame
+	blackSeen   time.Time
+}
+
+func newDetectorState(config DetectConfig) *detectorState {
+	return &detectorState{
+		config:     config,
+		blackStart: -1,
+	}
+}
+
+// parses log line and returns alerts, that changed their state
+func (s *detectorState) line(line string, now time.Time) []events.InputAlert {
+	if match := silenceStartRegex.FindStringSubmatch(line); match != nil {
+		// silence is reported only after it lasted for configured period
+		if s.silenceActive {
+			return nil
+		}
+
+		s.silenceActive = true
+		return []events.InputAlert{{Kind: AlertSilence, Active: true, Duration: s.config.Silence}}
+	}
+
+	if match := silenceEndRegex.FindStringSubmatch(line); match != nil {
+		if !s.silenceActive {
+			return nil
+		}
+
+		s.silenceActive = false
+		return []events.InputAlert{{Kind: AlertSilence, Active: false, Duration: parseSeconds(match[1])}}
+	}
+
+	if match := blackFrameRegex.FindStringSubmatch(line); match != nil {
+		t, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return nil
+		}
+
+		var alerts []events.InputAlert
+
+		// frames in between were not black
+		if s.blackStart >= 0 && t-s.blackLast > detectBlackGap.Seconds() {
+			alerts = s.blackEnd()
+		}
+
+		if s.blackStart < 0 {
+			s.blackStart = t
+		}
+		s.blackLast = t
+		s.blackSeen = now
+
+		duration := time.Duration((t - s.blackStart) * float64(time.Second))
+		if !s.blackActive && duration >= s.config.Black {
+			s.blackActive = true
+			alerts = append(alerts, events.InputAlert{Kind: AlertBlack, Active: true, Duration: duration})
+		}
+
+		return alerts
+	}
+
+	return nil
+}
+
+// returns black recovery, when no black frames were reported recently
+func (s *detectorState) tick(now time.Time) []events.InputAlert {
+	if s.blackStart >= 0 && now.Sub(s.blackSeen) > 2*detectBlackGap {
+		return s.blackEnd()
+	}
+
+	return nil
+}
+
+func (s *detectorState) blackEnd() []events.InputAlert {
+	var alerts []events.InputAlert
+	if s.blackActive {
+		duration := time.Duration((s.blackLast - s.blackStart) * float64(time.Second))
+		alerts = append(alerts, events.InputAlert{Kind: AlertBlack, Active: false, Duration: duration})
+	}
+
+	s.blackActive = false
+	s.blackStart = -1
+	return alerts
+}
+
+// returns recovery of all active alerts
+func (s *detectorState) end() []events.InputAlert {
+	alerts := s.blackEnd()
+	if s.silenceActive {
+		s.silenceActive = false
+		alerts = append(alerts, events.InputAlert{Kind: AlertSilence, Active: false})
+	}
+
+	return alerts
+}
+
+func parseSeconds(value string) time.Duration {
+	seconds, _ := strconv.ParseFloat(value, 64)
+	return time.Duration(seconds * float64(time.Second))
+}
+
+// runDetector analyzes live input until context is canceled, it is
+// restarted, when it exits
+func runDetector(ctx context.Context, config DetectConfig, session string, bus *events.Bus, logger zerolog.Logger) {
+	logger = logger.With().Str("submodule", "detector").Logger()
+
+	for {
+		err := detect(ctx, config, session, bus, logger)
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Warn().Err(err).Msg("detector exited, restarting")
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(detectRestartDelay):
+		}
+	}
+}
+
+func detect(ctx context.Context, config DetectConfig, session string, bus *events.Bus, logger zerolog.Logger) error {
+	cmd := exec.Command(config.FFmpegBinary, config.args()...)
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := utils.ProcessGroupStart(ctx, cmd); err != nil {
+		return err
+	}
+
+	state := newDetectorState(config)
+	publish := func(alerts []events.InputAlert) {
+		for _, alert := range alerts {
+			alert.Session = session
+			alert.Time = time.Now()
+
+			logger.Warn().
+				Str("kind", alert.Kind).
+				Bool("active", alert.Active).
+				Dur("duration", alert.Duration).
+				Msg("input alert")
+
+			bus.Publish(alert)
+		}
+	}
+
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	ticker := time.NewTicker(detectBlackGap)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok {
+				// recover active alerts, detector no longer knows input state
+				publish(state.end())
+				return utils.ProcessGroupWait(cmd)
+			}
+
+			publish(state.line(line, time.Now()))
+		case now := <-ticker.C:
+			publish(state.tick(now))
+		}
+	}
+}
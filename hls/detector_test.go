@@ -0,0 +1,63 @@
+package hls
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestDetectorSilence(t *testing.T) {
+	s := newDetectorState(DetectConfig{Silence: 5 * time.Second})
+	now := time.Now()
+
+	alerts := s.line("[silencedetect @ 0x55d0c4a0e7c0] silence_start: 12.504", now)
+	if len(alerts) != 1 || alerts[0].Kind != AlertSilence || !alerts[0].Active || alerts[0].Duration != 5*time.Second {
+		t.Fatalf("got %+v, want active silence alert", alerts)
+	}
+
+	alerts = s.line("[silencedetect @ 0x55d0c4a0e7c0] silence_end: 20.004 | silence_duration: 7.5", now)
+	if len(alerts) != 1 || alerts[0].Active || alerts[0].Duration != 7500*time.Millisecond {
+		t.Fatalf("got %+v, want silence recovery after 7.5s", alerts)
+	}
+}
+
+func TestDetectorBlack(t *testing.T) {
+	s := newDetectorState(DetectConfig{Black: 2 * time.Second})
+	now := time.Now()
+
+	blackFrame := func(t float64) string {
+		return "[Parsed_blackframe_1 @ 0x5581] frame:1 pblack:100 pts:1 t:" + strconv.FormatFloat(t, 'f', 3, 64) + " type:P last_keyframe:0"
+	}
+
+	for _, ts := range []float64{10, 10.5, 11, 11.5} {
+		if alerts := s.line(blackFrame(ts), now); len(alerts) != 0 {
+			t.Fatalf("got %+v at %v, want no alert before 2s", alerts, ts)
+		}
+	}
+
+	alerts := s.line(blackFrame(12), now)
+	if len(alerts) != 1 || alerts[0].Kind != AlertBlack || !alerts[0].Active {
+		t.Fatalf("got %+v, want active black alert", alerts)
+	}
+
+	// gap between black frames means, that picture recovered in between
+	alerts = s.line(blackFrame(20), now)
+	if len(alerts) != 1 || alerts[0].Active || alerts[0].Duration != 2*time.Second {
+		t.Fatalf("got %+v, want black recovery after 2s", alerts)
+	}
+
+	for _, ts := range []float64{20.5, 21, 21.5, 22} {
+		s.line(blackFrame(ts), now)
+	}
+
+	// black frames are still recent
+	if alerts := s.tick(now.Add(time.Second)); len(alerts) != 0 {
+		t.Fatalf("got %+v, want no recovery yet", alerts)
+	}
+
+	// no black frames reported for a while
+	alerts = s.tick(now.Add(3 * time.Second))
+	if len(alerts) != 1 || alerts[0].Active || alerts[0].Duration != 2*time.Second {
+		t.Fatalf("got %+v, want black recovery after 2s", alerts)
+	}
+}
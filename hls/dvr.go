@@ -0,0 +1,333 @@
+package hls
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// name of directory in working directory, where are segments of window kept
+const dvrDirName = "dvr"
+
+// query parameter of time-shifted playlist
+const dvrStartParam = "start"
+
+type dvrSegment struct {
+	name          string
+	duration      float64
+	time          time.Time // wall clock time of segment start
+	discontinuity bool
+	sequence      int
+}
+
+// dvr keeps segments of media playlists on disk for configured window, so
+// that playback can start from any point in the window
+type dvr struct {
+	logger zerolog.Logger
+	window time.Duration
+	dir    string // working directory of session
+	store  string // directory with kept segments
+
+	mu       sync.Mutex
+	headers  map[string][]string     // header tags of media playlists
+	segments map[string][]dvrSegment // segments of media playlists in window
+	sequence map[string]int          // next sequence of media playlists
+	ended    map[string]bool
+}
+
+func newDVR(window time.Duration, dir string, logger zerolog.Logger) *dvr {
+	return &dvr{
+		logger: logger.With().Str("submodule", "dvr").Logger(),
+		window: window,
+		dir:    dir,
+		store:  filepath.Join(dir, dvrDirName),
+
+		headers:  map[string][]string{},
+		segments: map[string][]dvrSegment{},
+		sequence: map[string]int{},
+		ended:    map[string]bool{},
+	}
+}
+
+// playlist adds new segments of media playlist to window and removes
+// segments, that fell out of it
+func (d *dvr) playlist(name, content string) {
+	if !strings.Contains(content, "#EXTINF") {
+		return
+	}
+
+	headers, segments := parseMediaPlaylist(content)
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.headers[name] = headers
+	d.ended[name] = strings.Contains(content, hlsEndList)
+
+	known := map[string]bool{}
+	for _, segment := range d.segments[name] {
+		known[segment.name] = true
+	}
+
+	added := []dvrSegment{}
+	for _, segment := range segments {
+		if known[segment.name] {
+			continue
+		}
+
+		// segment is listed, when it is finished
+		if err := d.keep(segment.name); err != nil {
+			d.logger.Warn().Err(err).Str("segment", segment.name).Msg("unable to keep segment")
+			continue
+		}
+
+		added = append(added, segment)
+	}
+
+	// the last added segment has just ended
+	start := now
+	for _, segment := range added {
+		start = start.Add(-time.Duration(segment.duration * float64(time.Second)))
+	}
+
+	// continuous stream follows the last segment in window
+	if kept := d.segments[name]; len(kept) > 0 && len(added) > 0 && !added[0].discontinuity {
+		last := kept[len(kept)-1]
+		start = last.time.Add(time.Duration(last.duration * float64(time.Second)))
+	}
+
+	for _, segment := range added {
+		segment.time = start
+		segment.sequence = d.sequence[name]
+		d.sequence[name]++
+
+		start = start.Add(time.Duration(segment.duration * float64(time.Second)))
+		d.segments[name] = append(d.segments[name], segment)
+	}
+
+	d.prune(name, now)
+}
+
+// sync adds segments of variant playlists written to working directory
+func (d *dvr) sync() {
+	data, err := os.ReadFile(filepath.Join(d.dir, masterPlaylistName))
+	if err != nil {
+		return
+	}
+
+	for _, variant := range playlistEntries(string(data)) {
+		data, err := os.ReadFile(filepath.Join(d.dir, variant))
+		if err != nil {
+			continue
+		}
+
+		d.playlist(variant, string(data))
+	}
+}
+
+// links segment to store, so that it outlives deletion by program
+func (d *dvr) keep(name string) error {
+	if err := os.MkdirAll(d.store, 0755); err != nil {
+		return err
+	}
+
+	src, dst := filepath.Join(d.dir, name), filepath.Join(d.store, name)
+	if err := os.Link(src, dst); err == nil || os.IsExist(err) {
+		return nil
+	}
+
+	// file system does not support hard links
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+
+	return out.Close()
+}
+
+// removes segments, that ended before window
+func (d *dvr) prune(name string, now time.Time) {
+	segments := d.segments[name]
+
+	i := 0
+	for ; i < len(segments)-1; i++ {
+		end := segments[i].time.Add(time.Duration(segments[i].duration * float64(time.Second)))
+		if now.Sub(end) <= d.window {
+			break
+		}
+
+		if err := os.Remove(filepath.Join(d.store, segments[i].name)); err != nil && !os.IsNotExist(err) {
+			d.logger.Warn().Err(err).Str("segment", segments[i].name).Msg("unable to remove segment")
+		}
+	}
+
+	d.segments[name] = segments[i:]
+}
+
+// path returns path of kept segment, if it is in window
+func (d *dvr) path(name string) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, segments := range d.segments {
+		for _, segment := range segments {
+			if segment.name == name {
+				return filepath.Join(d.store, name), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// media returns media playlist with all segments in window, that starts
+// playback at given time
+func (d *dvr) media(name string, start time.Time) (string, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	segments, ok := d.segments[name]
+	if !ok || len(segments) == 0 {
+		return "", false
+	}
+
+	var sb strings.Builder
+	sb.WriteString("#EXTM3U\n")
+	for _, header := range d.headers[name] {
+		sb.WriteString(header + "\n")
+	}
+	sb.WriteString(fmt.Sprintf("#EXT-X-MEDIA-SEQUENCE:%d\n", segments[0].sequence))
+
+	// start is in window, otherwise playback starts at the live edge
+	offset := 0.0
+	for _, segment := range segments {
+		end := segment.time.Add(time.Duration(segment.duration * float64(time.Second)))
+		if end.After(start) {
+			sb.WriteString(fmt.Sprintf("#EXT-X-START:TIME-OFFSET=%.3f,PRECISE=YES\n", offset))
+			break
+		}
+
+		offset += segment.duration
+	}
+
+	for _, segment := range segments {
+		if segment.discontinuity {
+			sb.WriteString("#EXT-X-DISCONTINUITY\n")
+		}
+
+		sb.WriteString("#EXT-X-PROGRAM-DATE-TIME:" + segment.time.UTC().Format("2006-01-02T15:04:05.000Z07:00") + "\n")
+		sb.WriteString(fmt.Sprintf("#EXTINF:%.6f,\n", segment.duration))
+		sb.WriteString(segment.name + "\n")
+	}
+
+	if d.ended[name] {
+		sb.WriteString(hlsEndList + "\n")
+	}
+
+	return sb.String(), true
+}
+
+// returns header tags and segments of media playlist, tags depending on
+// segments in playlist are left out
+func parseMediaPlaylist(playlist string) ([]string, []dvrSegment) {
+	headers := []string{}
+	segments := []dvrSegment{}
+
+	var segment *dvrSegment
+	discontinuity := false
+
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "", line == "#EXTM3U", line == hlsEndList:
+		case strings.HasPrefix(line, "#EXTINF:"):
+			duration := strings.SplitN(strings.TrimPrefix(line, "#EXTINF:"), ",", 2)[0]
+			value, err := strconv.ParseFloat(duration, 64)
+			if err != nil {
+				continue
+			}
+
+			segment = &dvrSegment{duration: value, discontinuity: discontinuity}
+			discontinuity = false
+		case line == "#EXT-X-DISCONTINUITY":
+			discontinuity = true
+		case strings.HasPrefix(line, "#EXT-X-MEDIA-SEQUENCE"),
+			strings.HasPrefix(line, "#EXT-X-DISCONTINUITY-SEQUENCE"),
+			strings.HasPrefix(line, "#EXT-X-PLAYLIST-TYPE"),
+			strings.HasPrefix(line, "#EXT-X-PROGRAM-DATE-TIME"),
+			strings.HasPrefix(line, "#EXT-X-START"):
+		case strings.HasPrefix(line, "#"):
+			// tags before first segment apply to whole playlist
+			if len(segments) == 0 && segment == nil {
+				headers = append(headers, line)
+			}
+		default:
+			if segment != nil {
+				segment.name = path.Base(line)
+				segments = append(segments, *segment)
+				segment = nil
+			}
+		}
+	}
+
+	return headers, segments
+}
+
+// ParseDVRStart returns start of time-shifted playback, value is either
+// number of seconds before now or RFC 3339 time.
+func ParseDVRStart(value string, now time.Time) (time.Time, error) {
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+		if seconds < 0 {
+			return time.Time{}, fmt.Errorf("start must not be negative")
+		}
+
+		return now.Add(-time.Duration(seconds * float64(time.Second))), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// adds absolute start to variant playlists of master playlist, so that all
+// variants start at the same time
+func dvrMaster(master string, start time.Time) string {
+	query := dvrStartParam + "=" + url.QueryEscape(start.UTC().Format(time.RFC3339Nano))
+
+	lines := strings.Split(master, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		separator := "?"
+		if strings.Contains(trimmed, "?") {
+			separator = "&"
+		}
+
+		lines[i] = trimmed + separator + query
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,93 @@
+package hls
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestDVR(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"live_001.ts", "live_002.ts", "live_003.ts"} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	d := newDVR(5*time.Second, dir, zerolog.Nop())
+	d.playlist(masterPlaylistName, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:7\n#EXTINF:2.0,\nlive_001.ts\n#EXTINF:2.0,\nlive_002.ts\n")
+
+	// program deletes segment, that is no longer in its playlist
+	if err := os.Remove(filepath.Join(dir, "live_001.ts")); err != nil {
+		t.Fatal(err)
+	}
+	d.playlist(masterPlaylistName, "#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:8\n#EXTINF:2.0,\nlive_002.ts\n#EXTINF:2.0,\nlive_003.ts\n")
+
+	kept, ok := d.path("live_001.ts")
+	if !ok {
+		t.Fatal("segment deleted by program is not kept")
+	}
+	if data, err := os.ReadFile(kept); err != nil || string(data) != "live_001.ts" {
+		t.Fatalf("kept segment = %q, %v", data, err)
+	}
+
+	// start in the second segment
+	start := d.segments[masterPlaylistName][1].time.Add(500 * time.Millisecond)
+	playlist, ok := d.media(masterPlaylistName, start)
+	if !ok {
+		t.Fatal("media playlist not available")
+	}
+
+	for _, want := range []string{
+		"#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-START:TIME-OFFSET=2.000,PRECISE=YES\n",
+		"live_001.ts\n", "live_002.ts\n", "live_003.ts\n",
+	} {
+		if !strings.Contains(playlist, want) {
+			t.Errorf("media playlist %q does not contain %q", playlist, want)
+		}
+	}
+
+	// segments are removed, when they fall out of window
+	d.prune(masterPlaylistName, time.Now().Add(9*time.Second))
+	if _, ok := d.path("live_002.ts"); ok {
+		t.Error("segment out of window is kept")
+	}
+	if _, err := os.Stat(kept); !os.IsNotExist(err) {
+		t.Error("file of segment out of window was not removed")
+	}
+	if _, ok := d.path("live_003.ts"); !ok {
+		t.Error("the last segment was removed")
+	}
+}
+
+func TestParseDVRStart(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	if start, err := ParseDVRStart("90", now); err != nil || !start.Equal(now.Add(-90*time.Second)) {
+		t.Errorf("ParseDVRStart(90) = %v, %v", start, err)
+	}
+
+	if start, err := ParseDVRStart("2022-01-01T11:00:00Z", now); err != nil || !start.Equal(now.Add(-time.Hour)) {
+		t.Errorf("ParseDVRStart(RFC 3339) = %v, %v", start, err)
+	}
+
+	for _, value := range []string{"-10", "yesterday"} {
+		if _, err := ParseDVRStart(value, now); err == nil {
+			t.Errorf("ParseDVRStart(%q) expected error", value)
+		}
+	}
+}
+
+func TestDVRMaster(t *testing.T) {
+	start := time.Date(2022, 1, 1, 11, 0, 0, 0, time.UTC)
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nstream_0.m3u8\n"
+
+	want := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nstream_0.m3u8?start=2022-01-01T11%3A00%3A00Z\n"
+	if got := dvrMaster(master, start); got != want {
+		t.Errorf("dvrMaster() = %q, want %q", got, want)
+	}
+}
@@ -1,12 +1,16 @@
 package hls
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
@@ -14,6 +18,8 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/httperror"
 	"github.com/m1k1o/go-transcode/internal/utils"
 )
 
@@ -26,40 +32,69 @@ const playlistTimeout = 60 * time.Second
 // minimum segments available to consider stream as active
 const hlsMinimumSegments = 2
 
+// how often should be master playlist file checked, when profile writes playlists to files
+const playlistPollPeriod = 500 * time.Millisecond
+
+// name of master playlist file, when profile writes playlists to files
+const masterPlaylistName = "index.m3u8"
+
 // how long must be active stream idle to be considered as dead
 const activeIdleTimeout = 12 * time.Second
 
 // how long must be iactive stream idle to be considered as dead
 const inactiveIdleTimeout = 24 * time.Second
 
+// how long can graceful stop take, before session is killed
+const stopTimeout = 10 * time.Second
+
+// how long is ended playlist served after graceful stop, so that players
+// can fetch the last segments
+const stopLinger = 30 * time.Second
+
+// tag ending playlist, no more segments will be added
+const hlsEndList = "#EXT-X-ENDLIST"
+
 type ManagerCtx struct {
 	logger     zerolog.Logger
 	mu         sync.Mutex
 	cmdFactory func() *exec.Cmd
 	active     bool
-	events     struct {
-		onStart  func()
-		onCmdLog func(message string)
-		onStop   func(err error)
-	}
+	session    string
+	events     *events.Bus
+	config     Config
 
 	cmd         *exec.Cmd
 	tempdir     string
 	lastRequest time.Time
-
-	sequence int
-	playlist string
-
-	playlistLoad chan string
+	lastData    time.Time // last time, when source produced new data
+	stopErr     error     // reason for stopping the session
+	restarts    int       // consecutive restarts after source was idle
+	graceful    bool      // stop was requested gracefully
+	degrade     int       // degradation level requested from profile, kept across restarts
+	lingering   bool      // program exited, ended playlist is still served
+	lingerStop  chan struct{}
+
+	sequence  int
+	playlist  string
+	publisher *publisher // nil, if publishing is disabled
+	dvr       *dvr       // nil, if time-shift is disabled
+
+	playlistLoad chan struct{} // closed, when stream becomes active
+	playlistOnce *sync.Once
 	shutdown     chan interface{}
 }
 
-func New(cmdFactory func() *exec.Cmd) *ManagerCtx {
+// session identifies manager in published events, bus can be nil
+func New(cmdFactory func() *exec.Cmd, session string, bus *events.Bus, config Config) *ManagerCtx {
 	return &ManagerCtx{
 		logger:     log.With().Str("module", "hls").Str("submodule", "manager").Logger(),
 		cmdFactory: cmdFactory,
+		session:    session,
+		events:     bus,
+		config:     config,
 
-		playlistLoad: make(chan string),
+		playlistLoad: make(chan struct{}),
+		playlistOnce: &sync.Once{},
 		shutdown:     make(chan interface{}),
 	}
 }
@@ -68,6 +103,11 @@ func (m *ManagerCtx) Start() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	return m.start()
+}
+
+// starts program, mutex must be held
+func (m *ManagerCtx) start() error {
 	if m.cmd != nil {
 		return errors.New("has already started")
 	}
@@ -83,46 +123,107 @@ func (m *ManagerCtx) Start() error {
 	m.cmd = m.cmdFactory()
 	m.cmd.Dir = m.tempdir
 
-	if m.events.onCmdLog != nil {
-		m.cmd.Stderr = utils.LogEvent(m.events.onCmdLog)
-	} else {
-		m.cmd.Stderr = utils.LogWriter(m.logger)
+	// encoding was too slow, profile should use faster settings
+	if m.degrade > 0 {
+		env := m.cmd.Env
+		if env == nil {
+			env = os.Environ()
+		}
+		m.cmd.Env = append(env, fmt.Sprintf("%s=%d", DegradeEnv, m.degrade))
 	}
 
+	ffmpegLog := utils.FFmpegLog(m.logger)
+	m.cmd.Stderr = io.MultiWriter(
+		ffmpegLog,
+		utils.LogEvent(func(message string) {
+			m.events.Publish(events.CmdLog{Session: m.session, Message: message})
+		}),
+	)
+
 	read, write := io.Pipe()
 	m.cmd.Stdout = write
 
 	// create a new process group
-	m.cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	utils.ProcessGroupPrepare(m.cmd)
 
 	m.active = false
 	m.lastRequest = time.Now()
+	m.lastData = time.Now()
+	m.stopErr = nil
+	m.graceful = false
+	m.lingering = false
+	m.lingerStop = make(chan struct{})
+	lingerStop := m.lingerStop
 
 	m.sequence = 0
 	m.playlist = ""
 
-	m.playlistLoad = make(chan string)
+	m.playlistLoad = make(chan struct{})
+	m.playlistOnce = &sync.Once{}
 	m.shutdown = make(chan interface{})
+	playlistLoad, playlistOnce, shutdown := m.playlistLoad, m.playlistOnce, m.shutdown
+
+	m.publisher = nil
+	if m.config.Publish.Uploader != nil {
+		m.publisher = newPublisher(m.config.Publish, m.session, m.events, m.tempdir, m.logger)
+		m.publisher.start()
+	}
+	publisher := m.publisher
+
+	m.dvr = nil
+	if m.config.DVRWindow > 0 && !m.config.Dash {
+		m.dvr = newDVR(m.config.DVRWindow, m.tempdir, m.logger)
+	}
+	dvr := m.dvr
+
+	// measure encode speed, unless profile is already degraded the most
+	var meter *speedMeter
+	if m.config.AdaptiveSpeed > 0 && m.degrade < degradeMaxLevel {
+		meter = newSpeedMeter(m.config.AdaptiveWindow)
+	}
 
 	// read playlist on stdout
+	readDone := make(chan struct{})
 	go func() {
+		defer close(readDone)
 		buf := make([]byte, 1024)
+		sequence := 0
 
 		for {
 			n, err := read.Read(buf)
 			if n != 0 {
-				m.playlist = string(buf[:n])
-				m.sequence = m.sequence + 1
+				playlist := string(buf[:n])
+				sequence = sequence + 1
+
+				m.mu.Lock()
+				m.playlist = playlist
+				m.sequence = sequence
+				m.lastData = time.Now()
+				m.mu.Unlock()
 
 				m.logger.Info().
-					Int("sequence", m.sequence).
-					Str("playlist", m.playlist).
+					Int("sequence", sequence).
+					Str("playlist", playlist).
 					Msg("received playlist")
 
-				if m.sequence == hlsMinimumSegments {
-					m.active = true
-					m.playlistLoad <- m.playlist
-					close(m.playlistLoad)
+				if publisher != nil {
+					publisher.playlist(masterPlaylistName, playlist)
+				}
+
+				if dvr != nil {
+					dvr.playlist(masterPlaylistName, playlist)
+				}
+
+				if meter != nil {
+					meter.playlist(playlist, time.Now())
+					if speed, ok := meter.speed(); ok && speed < m.config.AdaptiveSpeed {
+						m.degradeProfile(speed)
+						meter = nil
+					}
+				}
+
+				if sequence == hlsMinimumSegments {
+					m.playlistReady(playlist, playlistLoad, playlistOnce)
 				}
 			}
 
@@ -134,6 +235,82 @@ func (m *ManagerCtx) Start() error {
 		}
 	}()
 
+	// read master playlist or manifest from file, if profile writes them to working directory
+	go func() {
+		ticker := time.NewTicker(playlistPollPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-shutdown:
+				return
+			case <-playlistLoad:
+				return
+			case <-ticker.C:
+
+				readPlaylist := m.readMasterPlaylist
+				if m.config.Dash {
+					readPlaylist = m.readManifest
+				}
+
+				playlist, ok := readPlaylist()
+				if ok {
+					m.logger.Info().
+						Str("playlist", playlist).
+						Msg("received master playlist")
+
+					m.playlistReady(playlist, playlistLoad, playlistOnce)
+					return
+				}
+			}
+		}
+	}()
+
+	// analyze live input alongside session
+	if m.config.Detect.enabled() {
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-shutdown
+			cancel()
+		}()
+
+		go runDetector(ctx, m.config.Detect, m.session, m.events, m.logger)
+	}
+
+	// publish playlists written to working directory
+	if publisher != nil {
+		go func() {
+			ticker := time.NewTicker(playlistPollPeriod)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-shutdown:
+					return
+				case <-ticker.C:
+					publisher.sync()
+				}
+			}
+		}()
+	}
+
+	// keep segments of playlists written to working directory
+	if dvr != nil {
+		go func() {
+			ticker := time.NewTicker(playlistPollPeriod)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-shutdown:
+					return
+				case <-ticker.C:
+					dvr.sync()
+				}
+			}
+		}()
+	}
+
 	// periodic cleanup
 	go func() {
 		ticker := time.NewTicker(cleanupPeriod)
@@ -141,7 +318,7 @@ func (m *ManagerCtx) Start() error {
 
 		for {
 			select {
-			case <-m.shutdown:
+			case <-shutdown:
 				write.Close()
 				return
 			case <-ticker.C:
@@ -150,16 +327,21 @@ func (m *ManagerCtx) Start() error {
 		}
 	}()
 
-	if m.events.onStart != nil {
-		m.events.onStart()
-	}
+	m.events.Publish(events.SessionStarted{Session: m.session, Time: time.Now()})
 
 	// start program
 	err = m.cmd.Start()
+	started := err == nil
+	if started {
+		if err := utils.ProcessGroupStarted(m.cmd); err != nil {
+			m.logger.Err(err).Msg("unable to assign process group")
+		}
+	}
 
 	// wait for program to exit
 	go func() {
 		err = m.cmd.Wait()
+		ffmpegLog.Flush()
 		if err != nil {
 			if exiterr, ok := err.(*exec.ExitError); ok {
 				// The program has exited with an exit code != 0
@@ -178,10 +360,64 @@ func (m *ManagerCtx) Start() error {
 			m.logger.Info().Msg("the program has successfully exited")
 		}
 
-		close(m.shutdown)
+		// process, that failed to start, has no group
+		if started {
+			utils.ProcessGroupRelease(m.cmd)
+		}
+		close(shutdown)
+
+		// session was stopped intentionally with a reason
+		m.mu.Lock()
+		if m.stopErr != nil {
+			err = m.stopErr
+		}
+		m.mu.Unlock()
+
+		if err != nil && !errors.Is(err, ErrSourceIdle) && !errors.Is(err, ErrEncodeSlow) {
+			ffmpegErr := ffmpegLog.Wrap(err)
+			if ffmpegErr.Class != "" {
+				m.logger.Warn().Str("class", ffmpegErr.Class).Str("message", ffmpegErr.Message).Msg("transcode failed")
+			}
+
+			m.events.Publish(events.TranscodeFailed{Session: m.session, Err: ffmpegErr, Class: ffmpegErr.Class, Message: ffmpegErr.Message})
+		}
+		m.events.Publish(events.SessionStopped{Session: m.session, Time: time.Now(), Err: err})
+		sourceIdle := errors.Is(err, ErrSourceIdle)
+		encodeSlow := errors.Is(err, ErrEncodeSlow)
+
+		// serve ended playlist for a while, so that players end at the true end
+		m.mu.Lock()
+		graceful := m.graceful
+		m.lingering = graceful
+		m.mu.Unlock()
+
+		if graceful {
+			<-readDone
+			playlist := m.endPlaylists()
+
+			if publisher != nil {
+				publisher.playlist(masterPlaylistName, playlist)
+				publisher.sync()
+			}
+
+			if dvr != nil {
+				dvr.playlist(masterPlaylistName, playlist)
+				dvr.sync()
+			}
+
+			m.logger.Info().Msg("serving ended playlist before teardown")
+			select {
+			case <-lingerStop:
+			case <-time.After(m.stopLinger()):
+			}
+
+			m.mu.Lock()
+			m.lingering = false
+			m.mu.Unlock()
+		}
 
-		if m.events.onStop != nil {
-			m.events.onStop(err)
+		if publisher != nil {
+			publisher.stop()
 		}
 
 		err := os.RemoveAll(m.tempdir)
@@ -189,41 +425,272 @@ func (m *ManagerCtx) Start() error {
 
 		m.mu.Lock()
 		m.cmd = nil
+		requested := time.Since(m.lastRequest) < activeIdleTimeout
+		restart := sourceIdle && m.restarts < m.config.SourceIdleRestarts && requested
+		if restart {
+			m.restarts++
+		}
+		restarts := m.restarts
+		degrade := m.degrade
 		m.mu.Unlock()
+
+		// restart session, if it is still requested
+		if restart {
+			m.logger.Info().Int("restarts", restarts).Msg("restarting session after source was idle")
+			if err := m.Start(); err != nil {
+				m.logger.Err(err).Msg("unable to restart session")
+			}
+		} else if encodeSlow && requested {
+			m.logger.Info().Int("level", degrade).Msg("restarting session with faster profile settings")
+			if err := m.Start(); err != nil {
+				m.logger.Err(err).Msg("unable to restart session")
+			}
+		}
 	}()
 
 	return err
 }
 
+// marks stream as active and releases waiting requests, it is called by
+// both stdout reader and master playlist poll, only the first call counts
+func (m *ManagerCtx) playlistReady(playlist string, playlistLoad chan struct{}, once *sync.Once) {
+	once.Do(func() {
+		m.mu.Lock()
+		// session could have been restarted meanwhile
+		if m.playlistLoad == playlistLoad {
+			m.playlist = playlist
+			m.active = true
+			m.restarts = 0
+		}
+		m.mu.Unlock()
+
+		close(playlistLoad)
+	})
+}
+
+// returns master playlist written to working directory, when all its variant
+// playlists contain enough segments
+func (m *ManagerCtx) readMasterPlaylist() (string, bool) {
+	data, err := os.ReadFile(filepath.Join(m.tempdir, masterPlaylistName))
+	if err != nil {
+		return "", false
+	}
+
+	playlist := string(data)
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		variant, err := os.ReadFile(filepath.Join(m.tempdir, path.Base(line)))
+		if err != nil || strings.Count(string(variant), "#EXTINF") < hlsMinimumSegments {
+			return "", false
+		}
+	}
+
+	// fMP4 variants written by ffmpeg lack codecs of other than H.264 and AAC
+	playlist, codecs := masterCodecs(playlist, m.tempdir)
+	for _, warning := range hlsCodecsCompatibility(codecs) {
+		m.logger.Warn().Strs("codecs", codecs).Msg(warning)
+	}
+
+	return playlist, true
+}
+
 func (m *ManagerCtx) Stop() {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	m.stop()
+}
+
+// stops session with a reason, that is reported in stopped session
+func (m *ManagerCtx) stopWithError(err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stopErr = err
+	m.stop()
+}
+
+func (m *ManagerCtx) stop() {
+	// program has already exited, only ended playlist is served
+	if m.lingering {
+		m.lingering = false
+		close(m.lingerStop)
+		return
+	}
+
 	if m.cmd != nil && m.cmd.Process != nil {
 		m.logger.Debug().Msg("performing stop")
 
-		pgid, err := syscall.Getpgid(m.cmd.Process.Pid)
-		if err == nil {
-			err := syscall.Kill(-pgid, syscall.SIGKILL)
-			m.logger.Err(err).Msg("killing process group")
-		} else {
-			m.logger.Err(err).Msg("could not get process group id")
-			err := m.cmd.Process.Kill()
-			m.logger.Err(err).Msg("killing process")
+		err := utils.ProcessGroupKill(m.cmd)
+		m.logger.Err(err).Msg("killing process group")
+	}
+}
+
+// restarts session with faster settings requested from profile, because
+// encoding is slower than real-time
+func (m *ManagerCtx) degradeProfile(speed float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.degrade >= degradeMaxLevel || m.graceful {
+		return
+	}
+
+	m.degrade++
+	m.logger.Warn().
+		Float64("speed", speed).
+		Int("level", m.degrade).
+		Msg("encoding is slower than real-time, degrading profile")
+
+	m.events.Publish(events.ProfileDegraded{Session: m.session, Time: time.Now(), Level: m.degrade, Speed: speed})
+
+	m.stopErr = ErrEncodeSlow
+	m.stop()
+}
+
+// StopGraceful lets program finish segment in progress and end playlist, that
+// is served for a while before session is torn down. If program does not exit
+// in time, session is killed.
+func (m *ManagerCtx) StopGraceful() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cmd == nil || m.cmd.Process == nil || m.graceful {
+		return
+	}
+
+	m.logger.Debug().Msg("performing graceful stop")
+	m.graceful = true
+
+	if err := utils.ProcessGroupInterrupt(m.cmd); err != nil {
+		m.logger.Warn().Err(err).Msg("unable to interrupt process group, killing session")
+		m.graceful = false
+		m.stop()
+		return
+	}
+
+	cmd, shutdown := m.cmd, m.shutdown
+	go func() {
+		select {
+		case <-shutdown:
+		case <-time.After(m.stopTimeout()):
+			m.logger.Warn().Msg("graceful stop timeouted, killing session")
+
+			m.mu.Lock()
+			if m.cmd == cmd {
+				m.stop()
+			}
+			m.mu.Unlock()
+		}
+	}()
+}
+
+func (m *ManagerCtx) stopTimeout() time.Duration {
+	if m.config.StopTimeout > 0 {
+		return m.config.StopTimeout
+	}
+
+	return stopTimeout
+}
+
+func (m *ManagerCtx) stopLinger() time.Duration {
+	if m.config.StopLinger > 0 {
+		return m.config.StopLinger
+	}
+
+	return stopLinger
+}
+
+// appends end tag to playlists with segments, that program did not end itself,
+// returns ended playlist
+func (m *ManagerCtx) endPlaylists() string {
+	m.mu.Lock()
+	m.playlist = endPlaylist(m.playlist)
+	playlist := m.playlist
+	m.mu.Unlock()
+
+	entries, err := os.ReadDir(m.tempdir)
+	if err != nil {
+		return playlist
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".m3u8" {
+			continue
+		}
+
+		filePath := filepath.Join(m.tempdir, entry.Name())
+		data, err := os.ReadFile(filePath)
+		if err != nil {
+			continue
+		}
+
+		if ended := endPlaylist(string(data)); ended != string(data) {
+			if err := os.WriteFile(filePath, []byte(ended), 0644); err != nil {
+				m.logger.Err(err).Str("path", filePath).Msg("unable to end playlist")
+			}
+		}
+	}
+
+	return playlist
+}
+
+// returns media playlist with end tag, other playlists are returned unchanged
+func endPlaylist(playlist string) string {
+	if !strings.Contains(playlist, "#EXTINF") || strings.Contains(playlist, hlsEndList) {
+		return playlist
+	}
+
+	return strings.TrimRight(playlist, "\n") + "\n" + hlsEndList + "\n"
+}
+
+// returns last time, when source produced new data, either playlist
+// on stdout or files written to working directory
+func (m *ManagerCtx) sourceLastData() time.Time {
+	m.mu.Lock()
+	lastData := m.lastData
+	tempdir := m.tempdir
+	m.mu.Unlock()
+
+	entries, err := os.ReadDir(tempdir)
+	if err != nil {
+		return lastData
+	}
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err == nil && info.ModTime().After(lastData) {
+			lastData = info.ModTime()
 		}
 	}
+
+	return lastData
 }
 
 func (m *ManagerCtx) Cleanup() {
 	m.mu.Lock()
-	diff := time.Since(m.lastRequest)
-	stop := m.active && diff > activeIdleTimeout || !m.active && diff > inactiveIdleTimeout
+	lastRequest, active := m.lastRequest, m.active
+	diff := time.Since(lastRequest)
+	stop := active && diff > activeIdleTimeout || !active && diff > inactiveIdleTimeout
 	m.mu.Unlock()
 
+	// stop session, when source produces no new data
+	if !stop && active && m.config.SourceIdleTimeout > 0 {
+		if idle := time.Since(m.sourceLastData()); idle > m.config.SourceIdleTimeout {
+			m.logger.Warn().Dur("idle", idle).Msg("source is idle, stopping session")
+			m.stopWithError(ErrSourceIdle)
+			return
+		}
+	}
+
 	m.logger.Debug().
-		Time("last_request", m.lastRequest).
+		Time("last_request", lastRequest).
 		Dur("diff", diff).
-		Bool("active", m.active).
+		Bool("active", active).
 		Bool("stop", stop).
 		Msg("performing cleanup")
 
@@ -232,35 +699,86 @@ func (m *ManagerCtx) Cleanup() {
 	}
 }
 
-func (m *ManagerCtx) ServePlaylist(w http.ResponseWriter, r *http.Request) {
+// keeps session alive without requesting any playlist or media
+func (m *ManagerCtx) Heartbeat() {
 	m.mu.Lock()
 	m.lastRequest = time.Now()
 	m.mu.Unlock()
+}
 
-	playlist := m.playlist
+// starts session, if it is not running, and waits for its first playlist
+// writes error using error responder, plain text by default
+func (m *ManagerCtx) httpError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	httperror.New(r, status, code, message).Write(w, r, m.config.ErrorResponder)
+}
+
+func (m *ManagerCtx) waitPlaylist(w http.ResponseWriter, r *http.Request) (string, bool) {
+	m.mu.Lock()
+	m.lastRequest = time.Now()
 
 	if m.cmd == nil {
-		err := m.Start()
+		err := m.start()
 		if err != nil {
+			m.mu.Unlock()
 			m.logger.Warn().Err(err).Msg("transcode could not be started")
-			http.Error(w, "500 not available", http.StatusInternalServerError)
-			return
+			m.httpError(w, r, http.StatusInternalServerError, httperror.CodeUnavailable, "not available")
+			return "", false
 		}
 	}
 
-	if !m.active {
+	playlist, active := m.playlist, m.active
+	playlistLoad, shutdown := m.playlistLoad, m.shutdown
+	m.mu.Unlock()
+
+	if !active {
 		select {
-		case playlist = <-m.playlistLoad:
+		case <-playlistLoad:
+			m.mu.Lock()
+			playlist = m.playlist
+			m.mu.Unlock()
 		// when command exits before providing any playlist
-		case <-m.shutdown:
+		case <-shutdown:
 			m.logger.Warn().Msg("playlist load failed because of shutdown")
-			http.Error(w, "500 playlist not available", http.StatusInternalServerError)
-			return
+			m.httpError(w, r, http.StatusInternalServerError, httperror.CodeUnavailable, "playlist not available")
+			return "", false
 		case <-time.After(playlistTimeout):
 			m.logger.Warn().Msg("playlist load channel timeouted")
-			http.Error(w, "504 playlist timeout", http.StatusGatewayTimeout)
+			m.httpError(w, r, http.StatusGatewayTimeout, httperror.CodeTimeout, "playlist timeout")
+			return "", false
+		}
+	}
+
+	return playlist, true
+}
+
+func (m *ManagerCtx) ServePlaylist(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := m.waitPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	// time-shifted playback
+	if value := r.URL.Query().Get(dvrStartParam); value != "" {
+		start, err := ParseDVRStart(value, time.Now())
+		if err != nil {
+			m.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid start")
 			return
 		}
+
+		m.mu.Lock()
+		dvr := m.dvr
+		m.mu.Unlock()
+
+		if dvr == nil {
+			m.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "time-shift is not enabled")
+			return
+		}
+
+		if strings.Contains(playlist, "#EXT-X-STREAM-INF") {
+			playlist = dvrMaster(playlist, start)
+		} else if media, ok := dvr.media(masterPlaylistName, start); ok {
+			playlist = media
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
@@ -269,32 +787,58 @@ func (m *ManagerCtx) ServePlaylist(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *ManagerCtx) ServeMedia(w http.ResponseWriter, r *http.Request) {
-	fileName := path.Base(r.URL.RequestURI())
-	path := path.Join(m.tempdir, fileName)
+	fileName := path.Base(r.URL.Path)
 
-	if _, err := os.Stat(path); os.IsNotExist(err) {
-		m.logger.Warn().Str("path", path).Msg("media file not found")
-		http.Error(w, "404 media not found", http.StatusNotFound)
+	m.mu.Lock()
+	path := filepath.Join(m.tempdir, fileName)
+	m.mu.Unlock()
+
+	// chunks are requested before they are complete
+	if m.config.Dash {
+		m.Heartbeat()
+		m.serveChunk(w, r, path)
 		return
 	}
 
 	m.mu.Lock()
 	m.lastRequest = time.Now()
+	dvr := m.dvr
 	m.mu.Unlock()
 
-	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-	w.Header().Set("Cache-Control", "no-cache")
-	http.ServeFile(w, r, path)
-}
+	if dvr != nil && filepath.Ext(fileName) == ".m3u8" {
+		if value := r.URL.Query().Get(dvrStartParam); value != "" {
+			start, err := ParseDVRStart(value, time.Now())
+			if err != nil {
+				m.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid start")
+				return
+			}
 
-func (m *ManagerCtx) OnStart(event func()) {
-	m.events.onStart = event
-}
+			if media, ok := dvr.media(fileName, start); ok {
+				w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+				w.Header().Set("Cache-Control", "no-cache")
+				_, _ = w.Write([]byte(media))
+				return
+			}
+		}
+	}
 
-func (m *ManagerCtx) OnCmdLog(event func(message string)) {
-	m.events.onCmdLog = event
-}
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		// segment was deleted by program, but is still in time-shift window
+		kept, ok := "", false
+		if dvr != nil {
+			kept, ok = dvr.path(fileName)
+		}
 
-func (m *ManagerCtx) OnStop(event func(err error)) {
-	m.events.onStop = event
+		if !ok {
+			m.logger.Warn().Str("path", path).Msg("media file not found")
+			m.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "media not found")
+			return
+		}
+
+		path = kept
+	}
+
+	w.Header().Set("Content-Type", utils.MediaContentType(fileName))
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeFile(w, r, path)
 }
@@ -0,0 +1,100 @@
+package hls
+
+import (
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEndPlaylist(t *testing.T) {
+	media := "#EXTM3U\n#EXTINF:2.0,\nlive_001.ts\n"
+	if got, want := endPlaylist(media), media+"#EXT-X-ENDLIST\n"; got != want {
+		t.Errorf("endPlaylist() = %q, want %q", got, want)
+	}
+
+	ended := media + "#EXT-X-ENDLIST\n"
+	if got := endPlaylist(ended); got != ended {
+		t.Errorf("endPlaylist() = %q, want unchanged", got)
+	}
+
+	master := "#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=1000\nstream_0.m3u8\n"
+	if got := endPlaylist(master); got != master {
+		t.Errorf("endPlaylist() = %q, want unchanged master playlist", got)
+	}
+}
+
+func TestStopGraceful(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires POSIX shell and signals")
+	}
+
+	// program writes playlist twice and finishes last segment when interrupted
+	script := `
+trap 'echo data > live_002.ts; exit 0' INT
+printf '#EXTM3U\n#EXTINF:2.0,\nlive_001.ts\n'
+sleep 0.1
+printf '#EXTM3U\n#EXTINF:2.0,\nlive_001.ts\n#EXTINF:2.0,\nlive_002.ts\n'
+while :; do sleep 0.05; done
+`
+
+	m := New(func() *exec.Cmd {
+		return exec.Command("sh", "-c", script)
+	}, "test", nil, Config{StopLinger: time.Minute})
+
+	w := httptest.NewRecorder()
+	m.ServePlaylist(w, httptest.NewRequest("GET", "/test/index.m3u8", nil))
+	if w.Code != 200 {
+		t.Fatalf("playlist status %d", w.Code)
+	}
+
+	m.StopGraceful()
+
+	// wait until program exits and ended playlist is served
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		m.mu.Lock()
+		lingering := m.lingering
+		m.mu.Unlock()
+
+		if lingering {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("session did not end gracefully")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	w = httptest.NewRecorder()
+	m.ServePlaylist(w, httptest.NewRequest("GET", "/test/index.m3u8", nil))
+	if body := w.Body.String(); !strings.Contains(body, "live_002.ts") || !strings.HasSuffix(body, "#EXT-X-ENDLIST\n") {
+		t.Errorf("playlist is not ended: %q", body)
+	}
+
+	w = httptest.NewRecorder()
+	m.ServeMedia(w, httptest.NewRequest("GET", "/test/live_002.ts", nil))
+	if w.Code != 200 {
+		t.Errorf("last segment status %d", w.Code)
+	}
+
+	// stop ends serving ended playlist
+	tempdir := m.tempdir
+	m.Stop()
+
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(tempdir); os.IsNotExist(err) {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			t.Fatal("session was not torn down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,352 @@
+package hls
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/m1k1o/go-transcode/events"
+)
+
+type PublishConfig struct {
+	Uploader   Uploader      // Origin, where are segments and playlists pushed, nil means disabled.
+	Prefix     string        // Path of session at origin.
+	Workers    int           // Parallel segment uploads.
+	QueueSize  int           // Segments waiting for upload, when full, the oldest one is dropped.
+	Retries    int           // Attempts of failed upload.
+	RetryDelay time.Duration // Delay before first retry, it doubles with every attempt.
+}
+
+// state of segment known to publisher
+type publishState int
+
+const (
+	publishQueued publishState = iota
+	publishDone                // uploaded, dropped or failed
+)
+
+// publisher pushes finished segments and playlist updates to external origin,
+// playlist is pushed only after all segments it references are finished
+type publisher struct {
+	logger  zerolog.Logger
+	config  PublishConfig
+	session string
+	events  *events.Bus
+	dir     string
+
+	segments chan string
+	signal   chan struct{}
+
+	mu        sync.Mutex
+	states    map[string]publishState
+	playlists map[string]string // playlists waiting for upload
+	published map[string]string // last uploaded playlists
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newPublisher(config PublishConfig, session string, bus *events.Bus, dir string, logger zerolog.Logger) *publisher {
+	if config.Workers <= 0 {
+		config.Workers = 2
+	}
+
+	if config.QueueSize <= 0 {
+		config.QueueSize = 16
+	}
+
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = time.Second
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &publisher{
+		logger:  logger.With().Str("submodule", "publisher").Logger(),
+		config:  config,
+		session: session,
+		events:  bus,
+		dir:     dir,
+
+		segments: make(chan string, config.QueueSize),
+		signal:   make(chan struct{}, 1),
+
+		states:    map[string]publishState{},
+		playlists: map[string]string{},
+		published: map[string]string{},
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+func (p *publisher) start() {
+	for i := 0; i < p.config.Workers; i++ {
+		p.wg.Add(1)
+		go func() {
+			defer p.wg.Done()
+
+			for {
+				select {
+				case <-p.ctx.Done():
+					return
+				case name := <-p.segments:
+					p.uploadFile(name)
+					p.finish(name)
+				}
+			}
+		}()
+	}
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+
+		for {
+			select {
+			case <-p.ctx.Done():
+				return
+			case <-p.signal:
+				p.uploadPlaylists()
+			}
+		}
+	}()
+}
+
+// stop cancels pending uploads and waits for workers to exit
+func (p *publisher) stop() {
+	p.cancel()
+	p.wg.Wait()
+}
+
+// pending returns number of segments waiting for upload
+func (p *publisher) pending() int {
+	return len(p.segments)
+}
+
+// playlist queues new segments referenced by playlist and playlist itself
+func (p *publisher) playlist(name, content string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.published[name] == content {
+		return
+	}
+
+	for _, segment := range playlistEntries(content) {
+		// variant playlists are published on their own
+		if strings.HasSuffix(segment, ".m3u8") {
+			continue
+		}
+
+		if _, ok := p.states[segment]; ok {
+			continue
+		}
+
+		p.states[segment] = publishQueued
+		p.enqueue(segment)
+	}
+
+	p.playlists[name] = content
+	p.notify()
+}
+
+// sync publishes master playlist and its variant playlists written to working directory
+func (p *publisher) sync() {
+	data, err := os.ReadFile(filepath.Join(p.dir, masterPlaylistName))
+	if err != nil {
+		return
+	}
+
+	master := string(data)
+	for _, variant := range playlistEntries(master) {
+		data, err := os.ReadFile(filepath.Join(p.dir, variant))
+		if err != nil {
+			return
+		}
+
+		p.playlist(variant, string(data))
+	}
+
+	p.playlist(masterPlaylistName, master)
+}
+
+// adds segment to queue, when it is full, the oldest segment is dropped,
+// so that origin that cannot keep up stays close to the live edge
+func (p *publisher) enqueue(segment string) {
+	for {
+		select {
+		case p.segments <- segment:
+			return
+		default:
+		}
+
+		select {
+		case dropped := <-p.segments:
+			p.logger.Warn().Str("segment", dropped).Msg("origin cannot keep up, dropping segment")
+			p.states[dropped] = publishDone
+			p.events.Publish(events.PublishFailed{Session: p.session, Name: dropped, Err: ErrPublishQueueFull})
+		default:
+		}
+	}
+}
+
+func (p *publisher) finish(segment string) {
+	p.mu.Lock()
+	if _, ok := p.states[segment]; ok {
+		p.states[segment] = publishDone
+	}
+	p.mu.Unlock()
+
+	p.notify()
+}
+
+func (p *publisher) notify() {
+	select {
+	case p.signal <- struct{}{}:
+	default:
+	}
+}
+
+// uploads playlists, whose segments are finished, variants before master
+func (p *publisher) uploadPlaylists() {
+	p.mu.Lock()
+	ready := map[string]string{}
+	for name, content := range p.playlists {
+		if p.playlistReady(content) {
+			ready[name] = content
+		}
+	}
+	p.mu.Unlock()
+
+	names := make([]string, 0, len(ready))
+	for name := range ready {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		if names[i] == masterPlaylistName || names[j] == masterPlaylistName {
+			return names[j] == masterPlaylistName && names[i] != masterPlaylistName
+		}
+
+		return names[i] < names[j]
+	})
+
+	for _, name := range names {
+		content := ready[name]
+		if err := p.upload(name, []byte(content)); err != nil {
+			continue
+		}
+
+		p.mu.Lock()
+		p.published[name] = content
+		if p.playlists[name] == content {
+			delete(p.playlists, name)
+		}
+		p.prune()
+		p.mu.Unlock()
+	}
+}
+
+// returns true, if all segments of playlist are finished
+func (p *publisher) playlistReady(content string) bool {
+	for _, segment := range playlistEntries(content) {
+		if state, ok := p.states[segment]; ok && state == publishQueued {
+			return false
+		}
+	}
+
+	return true
+}
+
+// forgets finished segments, that are no longer referenced by any playlist
+func (p *publisher) prune() {
+	referenced := map[string]bool{}
+	for _, playlists := range []map[string]string{p.playlists, p.published} {
+		for _, content := range playlists {
+			for _, segment := range playlistEntries(content) {
+				referenced[segment] = true
+			}
+		}
+	}
+
+	for segment, state := range p.states {
+		if state == publishDone && !referenced[segment] {
+			delete(p.states, segment)
+		}
+	}
+}
+
+func (p *publisher) uploadFile(name string) {
+	data, err := os.ReadFile(filepath.Join(p.dir, name))
+	if err != nil {
+		p.logger.Warn().Err(err).Str("name", name).Msg("unable to read file for upload")
+		p.events.Publish(events.PublishFailed{Session: p.session, Name: name, Err: err})
+		return
+	}
+
+	_ = p.upload(name, data)
+}
+
+// uploads file to origin, failed attempts are retried with increasing delay
+func (p *publisher) upload(name string, data []byte) error {
+	contentType := "application/octet-stream"
+	switch path.Ext(name) {
+	case ".m3u8":
+		contentType = "application/vnd.apple.mpegurl"
+	case ".ts":
+		contentType = "video/mp2t"
+	}
+
+	delay := p.config.RetryDelay
+	remote := path.Join(p.config.Prefix, name)
+
+	var err error
+	for attempt := 0; attempt <= p.config.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-p.ctx.Done():
+				return p.ctx.Err()
+			case <-time.After(delay):
+			}
+			delay *= 2
+		}
+
+		err = p.config.Uploader.Upload(p.ctx, remote, contentType, data)
+		if err == nil {
+			p.logger.Debug().Str("name", remote).Int("pending", p.pending()).Msg("uploaded")
+			return nil
+		}
+
+		if p.ctx.Err() != nil {
+			return err
+		}
+
+		p.logger.Warn().Err(err).Str("name", remote).Int("attempt", attempt+1).Msg("upload failed")
+	}
+
+	p.events.Publish(events.PublishFailed{Session: p.session, Name: name, Err: err})
+	return err
+}
+
+// returns media or variant playlist file names referenced by playlist
+func playlistEntries(playlist string) []string {
+	var entries []string
+	for _, line := range strings.Split(playlist, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries = append(entries, path.Base(line))
+	}
+
+	return entries
+}
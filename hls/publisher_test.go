@@ -0,0 +1,175 @@
+package hls
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/m1k1o/go-transcode/events"
+)
+
+// records uploads, first failures of every file are returned as error
+type testUploader struct {
+	mu       sync.Mutex
+	failures int
+	attempts map[string]int
+	uploads  []string
+	release  chan struct{} // if set, uploads wait for it
+}
+
+func (u *testUploader) Upload(ctx context.Context, name, contentType string, data []byte) error {
+	if u.release != nil {
+		select {
+		case <-u.release:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.attempts[name]++
+	if u.attempts[name] <= u.failures {
+		return errors.New("origin unavailable")
+	}
+
+	u.uploads = append(u.uploads, name)
+	return nil
+}
+
+func (u *testUploader) uploaded() []string {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return append([]string{}, u.uploads...)
+}
+
+func testPublisherDir(t *testing.T, files ...string) string {
+	dir := t.TempDir()
+	for _, file := range files {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(file), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return dir
+}
+
+func waitUploads(t *testing.T, u *testUploader, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if uploads := u.uploaded(); len(uploads) >= n {
+			return uploads
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("uploaded %v, want %d files", u.uploaded(), n)
+	return nil
+}
+
+func TestPublisherPlaylistAfterSegments(t *testing.T) {
+	u := &testUploader{failures: 1, attempts: map[string]int{}}
+	dir := testPublisherDir(t, "0.ts", "1.ts")
+
+	p := newPublisher(PublishConfig{
+		Uploader:   u,
+		Prefix:     "profile/input",
+		Retries:    2,
+		RetryDelay: time.Millisecond,
+	}, "profile/input", nil, dir, zerolog.Nop())
+	p.start()
+	defer p.stop()
+
+	p.playlist(masterPlaylistName, "#EXTM3U\n#EXTINF:4,\n0.ts\n#EXTINF:4,\n1.ts\n")
+
+	uploads := waitUploads(t, u, 3)
+	if last := uploads[2]; last != "profile/input/index.m3u8" {
+		t.Errorf("last upload is %q, want playlist after all its segments: %v", last, uploads)
+	}
+
+	// the same playlist is not uploaded again
+	p.playlist(masterPlaylistName, "#EXTM3U\n#EXTINF:4,\n0.ts\n#EXTINF:4,\n1.ts\n")
+	time.Sleep(50 * time.Millisecond)
+
+	if uploads := u.uploaded(); len(uploads) != 3 {
+		t.Errorf("uploaded %v, want no new uploads", uploads)
+	}
+}
+
+func TestPublisherDropsOldestSegment(t *testing.T) {
+	u := &testUploader{attempts: map[string]int{}, release: make(chan struct{})}
+	dir := testPublisherDir(t, "0.ts", "1.ts", "2.ts")
+
+	bus := events.New()
+	failed, unsubscribe := bus.Subscribe(10, events.PublishFailedType)
+	defer unsubscribe()
+
+	// workers are not started, so that queue is not consumed
+	p := newPublisher(PublishConfig{
+		Uploader:  u,
+		QueueSize: 2,
+	}, "session", bus, dir, zerolog.Nop())
+
+	p.playlist(masterPlaylistName, "#EXTM3U\n0.ts\n1.ts\n2.ts\n")
+
+	select {
+	case event := <-failed:
+		if e := event.(events.PublishFailed); e.Name != "0.ts" || !errors.Is(e.Err, ErrPublishQueueFull) {
+			t.Errorf("dropped %q with %v, want oldest segment 0.ts", e.Name, e.Err)
+		}
+	default:
+		t.Fatal("no segment was dropped")
+	}
+
+	if pending := p.pending(); pending != 2 {
+		t.Errorf("pending %d segments, want 2", pending)
+	}
+
+	close(u.release)
+	p.start()
+	defer p.stop()
+
+	uploads := waitUploads(t, u, 3)
+	if last := uploads[2]; last != masterPlaylistName {
+		t.Errorf("last upload is %q, want playlist: %v", last, uploads)
+	}
+}
+
+func TestHTTPUploader(t *testing.T) {
+	var method, path, contentType, auth, body string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		method, path, body = r.Method, r.URL.Path, string(data)
+		contentType, auth = r.Header.Get("Content-Type"), r.Header.Get("Authorization")
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer server.Close()
+
+	u := &HTTPUploader{
+		URL:    server.URL + "/live/",
+		Header: http.Header{"Authorization": []string{"Bearer secret"}},
+	}
+
+	if err := u.Upload(context.Background(), "profile/input/0.ts", "video/mp2t", []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	if method != http.MethodPut || path != "/live/profile/input/0.ts" || body != "data" {
+		t.Errorf("received %s %s with %q, want PUT /live/profile/input/0.ts with data", method, path, body)
+	}
+
+	if contentType != "video/mp2t" || auth != "Bearer secret" {
+		t.Errorf("received content type %q and authorization %q", contentType, auth)
+	}
+}
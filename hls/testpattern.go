@@ -0,0 +1,83 @@
+package hls
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os/exec"
+	"strconv"
+)
+
+// scheme of stream url, that is generated test pattern instead of real source
+const TestPatternScheme = "testsrc"
+
+// TestPattern generates continuous live channel with moving test picture,
+// running timecode and sine tone, e.g. for validating players and load
+// testing without real camera.
+type TestPattern struct {
+	Width     int
+	Height    int
+	Framerate int
+	Frequency int // Frequency of sine tone in Hz.
+}
+
+// ParseTestPattern parses stream url in form of
+// testsrc://?size=1280x720&rate=30&frequency=1000, all parameters are optional.
+func ParseTestPattern(rawURL string) (TestPattern, bool, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != TestPatternScheme {
+		return TestPattern{}, false, nil
+	}
+
+	p := TestPattern{
+		Width:     1280,
+		Height:    720,
+		Framerate: 30,
+		Frequency: 1000,
+	}
+
+	query := u.Query()
+	if value := query.Get("size"); value != "" {
+		if _, err := fmt.Sscanf(value, "%dx%d", &p.Width, &p.Height); err != nil || p.Width <= 0 || p.Height <= 0 {
+			return p, true, fmt.Errorf("invalid test pattern size %q", value)
+		}
+	}
+
+	if value := query.Get("rate"); value != "" {
+		if p.Framerate, err = strconv.Atoi(value); err != nil || p.Framerate <= 0 {
+			return p, true, fmt.Errorf("invalid test pattern rate %q", value)
+		}
+	}
+
+	if value := query.Get("frequency"); value != "" {
+		if p.Frequency, err = strconv.Atoi(value); err != nil || p.Frequency <= 0 {
+			return p, true, fmt.Errorf("invalid test pattern frequency %q", value)
+		}
+	}
+
+	return p, true, nil
+}
+
+func (p TestPattern) args() []string {
+	return []string{
+		"-hide_banner",
+		"-loglevel", "warning",
+		"-re",
+		"-f", "lavfi", "-i", fmt.Sprintf("testsrc2=size=%dx%d:rate=%d", p.Width, p.Height, p.Framerate),
+		"-f", "lavfi", "-i", fmt.Sprintf("sine=frequency=%d:sample_rate=48000", p.Frequency),
+		"-c:v", "libx264",
+		"-preset", "ultrafast",
+		"-tune", "zerolatency",
+		"-pix_fmt", "yuv420p",
+		"-g", strconv.Itoa(p.Framerate * 2),
+		"-c:a", "aac",
+		"-b:a", "128k",
+		"-f", "mpegts",
+		"-",
+	}
+}
+
+// Cmd returns command writing MPEG-TS of test pattern to stdout, until context is canceled.
+func (p TestPattern) Cmd(ctx context.Context, ffmpegBinary string) *exec.Cmd {
+	return exec.CommandContext(ctx, ffmpegBinary, p.args()...)
+}
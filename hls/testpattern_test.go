@@ -0,0 +1,47 @@
+package hls
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseTestPattern(t *testing.T) {
+	p, ok, err := ParseTestPattern("testsrc://?size=640x360&rate=25&frequency=440")
+	if !ok || err != nil {
+		t.Fatalf("got ok=%v err=%v, want test pattern", ok, err)
+	}
+
+	if p.Width != 640 || p.Height != 360 || p.Framerate != 25 || p.Frequency != 440 {
+		t.Errorf("got %+v, want 640x360@25 with 440Hz", p)
+	}
+
+	args := strings.Join(p.args(), " ")
+	for _, want := range []string{"testsrc2=size=640x360:rate=25", "sine=frequency=440", "-g 50", "-f mpegts"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q do not contain %q", args, want)
+		}
+	}
+}
+
+func TestParseTestPatternDefaults(t *testing.T) {
+	p, ok, err := ParseTestPattern("testsrc://")
+	if !ok || err != nil {
+		t.Fatalf("got ok=%v err=%v, want test pattern", ok, err)
+	}
+
+	if p.Width != 1280 || p.Height != 720 || p.Framerate != 30 || p.Frequency != 1000 {
+		t.Errorf("got %+v, want defaults", p)
+	}
+}
+
+func TestParseTestPatternInvalid(t *testing.T) {
+	if _, ok, _ := ParseTestPattern("rtmp://localhost/live/cam"); ok {
+		t.Error("rtmp stream is not test pattern")
+	}
+
+	for _, url := range []string{"testsrc://?size=big", "testsrc://?rate=0", "testsrc://?frequency=x"} {
+		if _, ok, err := ParseTestPattern(url); !ok || err == nil {
+			t.Errorf("%s: got ok=%v err=%v, want error", url, ok, err)
+		}
+	}
+}
@@ -1,16 +1,58 @@
 package hls
 
-import "net/http"
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/m1k1o/go-transcode/httperror"
+)
+
+// ErrSourceIdle is reported in stopped session, when source produced no new data.
+var ErrSourceIdle = errors.New("source is idle")
+
+// ErrEncodeSlow is reported in stopped session, when it was restarted with
+// faster profile settings, because encoding was slower than real-time.
+var ErrEncodeSlow = errors.New("encode is slower than real-time")
+
+// ErrPublishQueueFull is reported for segments dropped, when origin cannot keep up.
+var ErrPublishQueueFull = errors.New("publish queue is full")
+
+type Config struct {
+	SourceIdleTimeout  time.Duration // Stop session, if source produces no new data for this period, 0 means disabled.
+	SourceIdleRestarts int           // How many times can be session restarted after source was idle, if it is still requested.
+
+	StopTimeout time.Duration // How long can graceful stop take, before session is killed, 0 means default.
+	StopLinger  time.Duration // How long is ended playlist served after graceful stop, 0 means default.
+
+	// Restart session with faster settings requested from profile (see
+	// DegradeEnv), when encoding of playlist written to stdout is slower
+	// than this real-time factor, 0 means disabled.
+	AdaptiveSpeed  float64
+	AdaptiveWindow time.Duration // Period, over which is speed measured, 0 means default.
+
+	// Keep segments for this window, so that playback can start from any
+	// point in it (time-shift), 0 means disabled. Not supported with Dash.
+	DVRWindow time.Duration
+
+	// Profile writes LL-DASH manifest (manifest.mpd) and CMAF chunks to working
+	// directory, chunks are served with chunked transfer while being written.
+	Dash bool
+
+	Publish PublishConfig // Push segments and playlists to external origin.
+	Detect  DetectConfig  // Alert on silent or black live input.
+
+	ErrorResponder httperror.Responder // Writes error responses, if nil, plain text is used.
+}
 
 type Manager interface {
 	Start() error
 	Stop()
+	StopGraceful()
 	Cleanup()
+	Heartbeat()
 
 	ServePlaylist(w http.ResponseWriter, r *http.Request)
+	ServeManifest(w http.ResponseWriter, r *http.Request)
 	ServeMedia(w http.ResponseWriter, r *http.Request)
-
-	OnStart(event func())
-	OnCmdLog(event func(message string))
-	OnStop(event func(err error))
 }
@@ -0,0 +1,138 @@
+package hls
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Uploader stores files at external origin.
+type Uploader interface {
+	Upload(ctx context.Context, name, contentType string, data []byte) error
+}
+
+// HTTPUploader stores files using HTTP PUT requests, that are supported
+// by WebDAV servers and most of the CDN origins.
+type HTTPUploader struct {
+	URL    string      // base URL, file name is appended to it
+	Header http.Header // additional headers, e.g. Authorization
+	Client *http.Client
+}
+
+func (u *HTTPUploader) Upload(ctx context.Context, name, contentType string, data []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(u.URL, "/")+"/"+name, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	for key, values := range u.Header {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	return doUpload(u.Client, req)
+}
+
+// S3Uploader stores files in S3 compatible bucket using path-style
+// requests signed by AWS Signature Version 4.
+type S3Uploader struct {
+	Endpoint  string // e.g. https://s3.eu-central-1.amazonaws.com
+	Bucket    string
+	Region    string
+	AccessKey string
+	SecretKey string
+	Client    *http.Client
+}
+
+func (u *S3Uploader) Upload(ctx context.Context, name, contentType string, data []byte) error {
+	parts := strings.Split(u.Bucket+"/"+name, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, strings.TrimSuffix(u.Endpoint, "/")+"/"+strings.Join(parts, "/"), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	u.sign(req, data, time.Now().UTC())
+
+	return doUpload(u.Client, req)
+}
+
+// signs request using AWS Signature Version 4
+func (u *S3Uploader) sign(req *http.Request, data []byte, now time.Time) {
+	date := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(data)
+	payload := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("X-Amz-Date", date)
+	req.Header.Set("X-Amz-Content-Sha256", payload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		"host:" + req.URL.Host,
+		"x-amz-content-sha256:" + payload,
+		"x-amz-date:" + date,
+		"",
+		signedHeaders,
+		payload,
+	}, "\n")
+
+	scope := day + "/" + u.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		date,
+		scope,
+		hex.EncodeToString(canonicalHash[:]),
+	}, "\n")
+
+	key := []byte("AWS4" + u.SecretKey)
+	for _, part := range []string{day, u.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		u.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func doUpload(client *http.Client, req *http.Request) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("upload of %s failed with status %s", req.URL.Path, res.Status)
+	}
+
+	return nil
+}
@@ -0,0 +1,134 @@
+package hls
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/m1k1o/go-transcode/events"
+)
+
+// default time, after which viewer not requesting stream has left
+const viewerTimeout = 30 * time.Second
+
+// ViewerTracker counts concurrent viewers of live streams. Viewer joins with
+// its first request of stream and leaves, when it does not request stream
+// for timeout. Join and leave events are published to bus.
+type ViewerTracker struct {
+	bus     *events.Bus
+	timeout time.Duration
+
+	mu      sync.Mutex
+	streams map[string]map[string]time.Time // map of streams, their viewers and last requests
+}
+
+func NewViewerTracker(bus *events.Bus, timeout time.Duration) *ViewerTracker {
+	if timeout <= 0 {
+		timeout = viewerTimeout
+	}
+
+	return &ViewerTracker{
+		bus:     bus,
+		timeout: timeout,
+		streams: map[string]map[string]time.Time{},
+	}
+}
+
+// ViewerID returns hashed identity of viewer requesting stream. Viewer is
+// identified by viewer token in query, by playback session of player or, as
+// fallback, by its address and user agent.
+func ViewerID(r *http.Request) string {
+	key := r.URL.Query().Get("viewer")
+	if key != "" {
+		key = "token:" + key
+	} else if session := r.Header.Get("X-Playback-Session-Id"); session != "" {
+		key = "session:" + session
+	} else {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		key = "client:" + ip + "\x00" + r.UserAgent()
+	}
+
+	hash := sha1.Sum([]byte(key))
+	return hex.EncodeToString(hash[:8])
+}
+
+// Seen records request of viewer.
+func (t *ViewerTracker) Seen(stream, viewer string) {
+	t.seen(stream, viewer, time.Now())
+}
+
+func (t *ViewerTracker) seen(stream, viewer string, now time.Time) {
+	t.mu.Lock()
+	viewers, ok := t.streams[stream]
+	if !ok {
+		viewers = map[string]time.Time{}
+		t.streams[stream] = viewers
+	}
+
+	_, joined := viewers[viewer]
+	viewers[viewer] = now
+	count := len(viewers)
+	t.mu.Unlock()
+
+	if !joined {
+		t.bus.Publish(events.ViewerJoined{Stream: stream, Viewer: viewer, Time: now, Viewers: count})
+	}
+}
+
+// Count returns concurrent viewers of stream.
+func (t *ViewerTracker) Count(stream string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.streams[stream])
+}
+
+// Counts returns concurrent viewers of all watched streams.
+func (t *ViewerTracker) Counts() map[string]int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	counts := make(map[string]int, len(t.streams))
+	for stream, viewers := range t.streams {
+		counts[stream] = len(viewers)
+	}
+
+	return counts
+}
+
+// Expire removes viewers, that did not request their stream for timeout.
+func (t *ViewerTracker) Expire() {
+	t.expire(time.Now())
+}
+
+func (t *ViewerTracker) expire(now time.Time) {
+	left := []events.ViewerLeft{}
+
+	t.mu.Lock()
+	for stream, viewers := range t.streams {
+		for viewer, last := range viewers {
+			if now.Sub(last) < t.timeout {
+				continue
+			}
+
+			delete(viewers, viewer)
+			left = append(left, events.ViewerLeft{Stream: stream, Viewer: viewer, Time: now, Viewers: len(viewers)})
+		}
+
+		if len(viewers) == 0 {
+			delete(t.streams, stream)
+		}
+	}
+	t.mu.Unlock()
+
+	for _, event := range left {
+		t.bus.Publish(event)
+	}
+}
@@ -0,0 +1,93 @@
+package hls
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m1k1o/go-transcode/events"
+)
+
+func TestViewerTracker(t *testing.T) {
+	bus := events.New()
+	joined, unsubscribeJoined := bus.Subscribe(8, events.ViewerJoinedType)
+	defer unsubscribeJoined()
+	left, unsubscribeLeft := bus.Subscribe(8, events.ViewerLeftType)
+	defer unsubscribeLeft()
+
+	tracker := NewViewerTracker(bus, 10*time.Second)
+	now := time.Now()
+
+	tracker.seen("cam", "a", now)
+	tracker.seen("cam", "a", now.Add(2*time.Second))
+	tracker.seen("cam", "b", now.Add(4*time.Second))
+	tracker.seen("news", "a", now.Add(4*time.Second))
+
+	if count := tracker.Count("cam"); count != 2 {
+		t.Errorf("cam has %d viewers, want 2", count)
+	}
+
+	if counts := tracker.Counts(); counts["cam"] != 2 || counts["news"] != 1 {
+		t.Errorf("counts = %v", counts)
+	}
+
+	for _, want := range []events.ViewerJoined{
+		{Stream: "cam", Viewer: "a", Time: now, Viewers: 1},
+		{Stream: "cam", Viewer: "b", Time: now.Add(4 * time.Second), Viewers: 2},
+		{Stream: "news", Viewer: "a", Time: now.Add(4 * time.Second), Viewers: 1},
+	} {
+		if event := <-joined; event != want {
+			t.Errorf("joined %+v, want %+v", event, want)
+		}
+	}
+
+	// a did not request cam for timeout
+	tracker.expire(now.Add(12 * time.Second))
+
+	if event := <-left; event != (events.ViewerLeft{Stream: "cam", Viewer: "a", Time: now.Add(12 * time.Second), Viewers: 1}) {
+		t.Errorf("left %+v", event)
+	}
+
+	if count := tracker.Count("cam"); count != 1 {
+		t.Errorf("cam has %d viewers after expiry, want 1", count)
+	}
+
+	// streams without viewers are forgotten
+	tracker.expire(now.Add(time.Minute))
+
+	if counts := tracker.Counts(); len(counts) != 0 {
+		t.Errorf("counts after all viewers left = %v", counts)
+	}
+}
+
+func TestViewerID(t *testing.T) {
+	r := httptest.NewRequest("GET", "/hls/cam/index.m3u8", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("User-Agent", "player")
+
+	client := ViewerID(r)
+
+	// another connection of the same client
+	r.RemoteAddr = "10.0.0.1:5678"
+	if ViewerID(r) != client {
+		t.Error("client is identified by port")
+	}
+
+	r.Header.Set("User-Agent", "other player")
+	if ViewerID(r) == client {
+		t.Error("clients behind the same address are not told apart")
+	}
+
+	// playback session identifies viewer regardless of address
+	r.Header.Set("X-Playback-Session-Id", "session")
+	session := ViewerID(r)
+	r.RemoteAddr = "10.0.0.2:1234"
+	if ViewerID(r) != session {
+		t.Error("playback session is identified by address")
+	}
+
+	tokenRequest := httptest.NewRequest("GET", "/hls/cam/index.m3u8?viewer=abc", nil)
+	if ViewerID(tokenRequest) == session || len(ViewerID(tokenRequest)) != 16 {
+		t.Errorf("viewer token is identified as %q", ViewerID(tokenRequest))
+	}
+}
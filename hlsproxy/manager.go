@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"io"
 	"net/http"
+	neturl "net/url"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/m1k1o/go-transcode/httperror"
 	"github.com/m1k1o/go-transcode/internal/utils"
 
 	"github.com/rs/zerolog"
@@ -20,6 +22,9 @@ const cacheCleanupPeriod = 4 * time.Second
 // how long should be segment kept in memory
 const segmentExpiration = 60 * time.Second
 
+// how long should be init segment kept in memory
+const initExpiration = 10 * time.Minute
+
 // how long should be playlist kept in memory
 const playlistExpiration = 1 * time.Second
 
@@ -27,6 +32,7 @@ type ManagerCtx struct {
 	logger  zerolog.Logger
 	baseUrl string
 	prefix  string
+	config  Config
 
 	cache   map[string]*utils.Cache
 	cacheMu sync.RWMutex
@@ -36,7 +42,7 @@ type ManagerCtx struct {
 	shutdown  chan struct{}
 }
 
-func New(baseUrl string, prefix string) *ManagerCtx {
+func New(baseUrl string, prefix string, config Config) *ManagerCtx {
 	// ensure it ends with slash
 	baseUrl = strings.TrimSuffix(baseUrl, "/")
 	baseUrl += "/"
@@ -45,6 +51,7 @@ func New(baseUrl string, prefix string) *ManagerCtx {
 		logger:  log.With().Str("module", "hlsproxy").Str("submodule", "manager").Logger(),
 		baseUrl: baseUrl,
 		prefix:  prefix,
+		config:  config,
 		cache:   map[string]*utils.Cache{},
 	}
 }
@@ -53,15 +60,28 @@ func (m *ManagerCtx) Shutdown() {
 	m.cleanupStop()
 }
 
+// writes error using error responder, plain text by default
+func (m *ManagerCtx) httpError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	httperror.New(r, status, code, message).Write(w, r, m.config.ErrorResponder)
+}
+
+func (m *ManagerCtx) client() *http.Client {
+	if m.config.Client != nil {
+		return m.config.Client
+	}
+
+	return http.DefaultClient
+}
+
 func (m *ManagerCtx) ServePlaylist(w http.ResponseWriter, r *http.Request) {
 	url := m.baseUrl + strings.TrimPrefix(r.URL.String(), m.prefix)
 
 	cache, ok := m.getFromCache(url)
 	if !ok {
-		resp, err := http.Get(url)
+		resp, err := m.client().Get(url)
 		if err != nil {
 			m.logger.Err(err).Msg("unable to get HTTP")
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			m.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to get upstream")
 			return
 		}
 
@@ -71,12 +91,16 @@ func (m *ManagerCtx) ServePlaylist(w http.ResponseWriter, r *http.Request) {
 			resp.Body.Close()
 
 			m.logger.Err(err).Int("code", resp.StatusCode).Msg("invalid HTTP response")
-			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			m.httpError(w, r, http.StatusBadGateway, httperror.CodeBadGateway, "invalid upstream response")
 			return
 		}
 
 		// replace all urls in playlist with relative ones
 		text := PlaylistUrlWalk(resp.Body, func(u string) string {
+			if variant, ok := m.variantUrl(url, u); ok {
+				return variant
+			}
+
 			return RelativePath(m.baseUrl, m.prefix, u)
 		})
 
@@ -90,14 +114,26 @@ func (m *ManagerCtx) ServePlaylist(w http.ResponseWriter, r *http.Request) {
 }
 
 func (m *ManagerCtx) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	m.serveUpstream(w, r, segmentExpiration)
+}
+
+// ServeInit serves fMP4 init segment, it is shared by all segments of
+// variant, so that it is cached longer than them.
+func (m *ManagerCtx) ServeInit(w http.ResponseWriter, r *http.Request) {
+	m.serveUpstream(w, r, initExpiration)
+}
+
+// serves upstream media cached for expiration, content type is given by
+// container of requested file
+func (m *ManagerCtx) serveUpstream(w http.ResponseWriter, r *http.Request, expiration time.Duration) {
 	url := m.baseUrl + strings.TrimPrefix(r.URL.String(), m.prefix)
 
 	cache, ok := m.getFromCache(url)
 	if !ok {
-		resp, err := http.Get(url)
+		resp, err := m.client().Get(url)
 		if err != nil {
 			m.logger.Err(err).Msg("unable to get HTTP")
-			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			m.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to get upstream")
 			return
 		}
 
@@ -107,19 +143,49 @@ func (m *ManagerCtx) ServeMedia(w http.ResponseWriter, r *http.Request) {
 			resp.Body.Close()
 
 			m.logger.Err(err).Int("code", resp.StatusCode).Msg("invalid HTTP response")
-			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+			m.httpError(w, r, http.StatusBadGateway, httperror.CodeBadGateway, "invalid upstream response")
 			return
 		}
 
-		cache = m.saveToCache(url, resp.Body, time.Now().Add(segmentExpiration))
+		cache = m.saveToCache(url, resp.Body, time.Now().Add(expiration))
 	}
 
-	w.Header().Set("Content-Type", "video/MP2T")
+	w.Header().Set("Content-Type", utils.MediaContentType(r.URL.Path))
 	w.WriteHeader(200)
 
 	cache.ServeHTTP(w)
 }
 
+// returns url replacing upstream variant playlist referenced in playlist
+func (m *ManagerCtx) variantUrl(playlistUrl, u string) (string, bool) {
+	if len(m.config.Variants) == 0 {
+		return "", false
+	}
+
+	base, err := neturl.Parse(playlistUrl)
+	if err != nil {
+		return "", false
+	}
+
+	ref, err := neturl.Parse(u)
+	if err != nil {
+		return "", false
+	}
+
+	// variants are matched without query
+	abs := base.ResolveReference(ref)
+	abs.RawQuery = ""
+	abs.Fragment = ""
+
+	path := abs.String()
+	if !strings.HasPrefix(path, m.baseUrl) {
+		return "", false
+	}
+
+	variant, ok := m.config.Variants[strings.TrimPrefix(path, m.baseUrl)]
+	return variant, ok
+}
+
 // resolve path: remove ../ and ./ from path
 func resolvePath(path string) string {
 	parts := strings.Split(path, "/")
@@ -3,6 +3,8 @@ package hlsproxy
 import (
 	"bytes"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
 	"regexp"
 	"strings"
@@ -231,3 +233,119 @@ func TestRelativePath(t *testing.T) {
 		})
 	}
 }
+
+func TestVariantUrl(t *testing.T) {
+	m := New("http://example.com/live", "/hlsproxy/foo/", Config{
+		Variants: map[string]string{
+			"hd/720p.m3u8": "/hlsproxy/foo/_transcode/h264_360p/index.m3u8",
+		},
+	})
+
+	tests := []struct {
+		name string
+		u    string
+		want string
+		ok   bool
+	}{
+		{
+			name: "relative URL",
+			u:    "hd/720p.m3u8",
+			want: "/hlsproxy/foo/_transcode/h264_360p/index.m3u8",
+			ok:   true,
+		},
+		{
+			name: "absolute URL with query",
+			u:    "http://example.com/live/hd/720p.m3u8?token=123",
+			want: "/hlsproxy/foo/_transcode/h264_360p/index.m3u8",
+			ok:   true,
+		},
+		{
+			name: "absolute path",
+			u:    "/live/hd/../hd/720p.m3u8",
+			want: "/hlsproxy/foo/_transcode/h264_360p/index.m3u8",
+			ok:   true,
+		},
+		{
+			name: "other variant",
+			u:    "sd/360p.m3u8",
+		},
+		{
+			name: "other host",
+			u:    "http://example.org/live/hd/720p.m3u8",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := m.variantUrl("http://example.com/live/index.m3u8", tt.u)
+			if got != tt.want || ok != tt.ok {
+				t.Errorf("variantUrl() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+type roundTripFunc func(r *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+func TestClient(t *testing.T) {
+	var fetched []string
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		fetched = append(fetched, r.URL.String())
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("#EXTM3U\n#EXTINF:4,\nsegment.ts\n")),
+			Header:     http.Header{},
+		}, nil
+	})}
+
+	manager := New("http://upstream.example.com/live", "/proxy/", Config{Client: client})
+	defer manager.Shutdown()
+
+	w := httptest.NewRecorder()
+	manager.ServePlaylist(w, httptest.NewRequest(http.MethodGet, "/proxy/index.m3u8", nil))
+
+	if want := []string{"http://upstream.example.com/live/index.m3u8"}; !reflect.DeepEqual(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+
+	if !strings.Contains(w.Body.String(), "segment.ts") {
+		t.Errorf("unexpected playlist %q", w.Body.String())
+	}
+}
+
+func TestMediaContentType(t *testing.T) {
+	client := &http.Client{Transport: roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       io.NopCloser(strings.NewReader("media")),
+			Header:     http.Header{},
+		}, nil
+	})}
+
+	manager := New("http://upstream.example.com/live", "/proxy/", Config{Client: client})
+	defer manager.Shutdown()
+
+	tests := []struct {
+		path  string
+		serve func(w http.ResponseWriter, r *http.Request)
+		want  string
+	}{
+		{"/proxy/segment.ts?token=abc", manager.ServeMedia, "video/mp2t"},
+		{"/proxy/segment.m4s", manager.ServeMedia, "video/mp4"},
+		{"/proxy/audio.m4a", manager.ServeMedia, "audio/mp4"},
+		{"/proxy/subtitles.vtt", manager.ServeMedia, "text/vtt"},
+		{"/proxy/init.mp4", manager.ServeInit, "video/mp4"},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		test.serve(w, httptest.NewRequest(http.MethodGet, test.path, nil))
+
+		if got := w.Header().Get("Content-Type"); got != test.want {
+			t.Errorf("%s: content type = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
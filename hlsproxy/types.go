@@ -1,10 +1,24 @@
 package hlsproxy
 
-import "net/http"
+import (
+	"net/http"
+
+	"github.com/m1k1o/go-transcode/httperror"
+)
+
+type Config struct {
+	// Variant playlists (paths relative to base url) served from other urls
+	// instead of upstream, e.g. from live transcode of that variant.
+	Variants map[string]string
+
+	ErrorResponder httperror.Responder // Writes error responses, if nil, plain text is used.
+	Client         *http.Client        // Fetches upstream, if nil, default client is used.
+}
 
 type Manager interface {
 	Shutdown()
 
 	ServePlaylist(w http.ResponseWriter, r *http.Request)
 	ServeMedia(w http.ResponseWriter, r *http.Request)
+	ServeInit(w http.ResponseWriter, r *http.Request)
 }
@@ -0,0 +1,78 @@
+package hlsvod
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+var ErrSegmentDecrypt = errors.New("unable to decrypt segment file")
+
+func (m *ManagerCtx) sealedSegments() bool {
+	return len(m.config.SegmentKey) > 0
+}
+
+// returns cipher used for segment files on disk, key of any length is
+// accepted and hashed to AES-256 key
+func (m *ManagerCtx) segmentCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256(m.config.SegmentKey)
+
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypts segment file in place, if enabled, so that it is not watchable
+// from storage. Segment must not be served, until it is sealed.
+func (m *ManagerCtx) sealSegment(segmentPath string) error {
+	if !m.sealedSegments() {
+		return nil
+	}
+
+	aead, err := m.segmentCipher()
+	if err != nil {
+		return err
+	}
+
+	data, err := m.fs.ReadFile(segmentPath)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	return m.fs.WriteFile(segmentPath, aead.Seal(nonce, nonce, data, nil), 0644)
+}
+
+// returns decrypted segment file
+func (m *ManagerCtx) openSegment(segmentPath string) ([]byte, error) {
+	aead, err := m.segmentCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := m.fs.ReadFile(segmentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, ErrSegmentDecrypt
+	}
+
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrSegmentDecrypt
+	}
+
+	return plain, nil
+}
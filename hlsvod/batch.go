@@ -0,0 +1,351 @@
+package hlsvod
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// BatchTranscoder transcodes renditions of the same segments, that are
+// requested within batch window, by single ffmpeg run, so that source is
+// decoded once and scaled for every rendition. Requests, that cannot be
+// batched (e.g. passthrough, VAAPI or burned subtitles), are transcoded
+// by ffmpeg transcoder as usual.
+type BatchTranscoder struct {
+	*FFmpegTranscoder
+
+	// How long is the first request waiting for other renditions.
+	Window time.Duration
+
+	mu      sync.Mutex
+	pending map[string][]*batchRequest
+}
+
+type batchRequest struct {
+	ctx      context.Context
+	config   TranscodeConfig
+	segments chan string
+}
+
+func NewBatchTranscoder(transcoder *FFmpegTranscoder, window time.Duration) *BatchTranscoder {
+	return &BatchTranscoder{
+		FFmpegTranscoder: transcoder,
+		Window:           window,
+		pending:          map[string][]*batchRequest{},
+	}
+}
+
+// returns key of requests, that can be transcoded together, false if
+// request must be transcoded on its own
+func batchKey(config TranscodeConfig) (string, bool) {
+	profile := config.VideoProfile
+	if profile == nil || profile.Preview || profile.Codec == CodecHEVC || config.Passthrough || config.Fallback || config.BurnSubtitles || config.Overlay != nil || config.AudioOffset != 0 {
+		return "", false
+	}
+
+	// hardware frames cannot be split
+	if config.Encoder == EncoderVAAPI || (config.Encoder == EncoderAuto && os.Getenv("VAAPI") == "1") {
+		return "", false
+	}
+
+	if ImageSequence(config.InputFilePath) || ImageAnimation(config.InputFilePath) {
+		return "", false
+	}
+
+	audioBitrate := 0
+	if config.AudioProfile != nil {
+		audioBitrate = config.AudioProfile.Bitrate
+	}
+
+	return fmt.Sprintf("%s\x00%d\x00%d\x00%d\x00%t\x00%v", config.InputFilePath,
+		config.SegmentOffset, config.AudioStream, audioBitrate, config.IONice, config.SegmentTimes), true
+}
+
+func (t *BatchTranscoder) TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error) {
+	key, ok := batchKey(config)
+	if !ok || t.Window <= 0 {
+		return t.FFmpegTranscoder.TranscodeSegments(ctx, config)
+	}
+
+	if len(config.SegmentTimes) < 2 {
+		return nil, fmt.Errorf("minimum 2 segment times needed")
+	}
+
+	request := &batchRequest{
+		ctx:      ctx,
+		config:   config,
+		segments: make(chan string, 1),
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the first request waits for others
+	if len(t.pending[key]) == 0 {
+		time.AfterFunc(t.Window, func() {
+			t.mu.Lock()
+			requests := t.pending[key]
+			delete(t.pending, key)
+			t.mu.Unlock()
+
+			t.run(requests)
+		})
+	}
+
+	t.pending[key] = append(t.pending[key], request)
+	return request.segments, nil
+}
+
+// transcodes batched requests, single request is transcoded as usual
+func (t *BatchTranscoder) run(requests []*batchRequest) {
+	if len(requests) > 1 {
+		err := t.transcodeBatch(requests)
+		if err == nil {
+			return
+		}
+
+		log.Warn().Str("module", "hlsvod").Str("submodule", "batch").Err(err).
+			Msg("unable to transcode renditions together, transcoding separately")
+	}
+
+	for _, request := range requests {
+		go func(request *batchRequest) {
+			segments, err := t.FFmpegTranscoder.TranscodeSegments(request.ctx, request.config)
+			if err != nil {
+				if request.config.OnError != nil {
+					request.config.OnError(err)
+				}
+				close(request.segments)
+				return
+			}
+
+			for segment := range segments {
+				request.segments <- segment
+			}
+			close(request.segments)
+		}(request)
+	}
+}
+
+// returns ffmpeg args decoding input once and encoding every rendition
+// to its own segment muxer, completed segments of rendition i are listed
+// to file descriptor 3+i
+func batchArgs(version FFmpegVersion, configs []TranscodeConfig) []string {
+	config := configs[0]
+	totalSegments := len(config.SegmentTimes)
+	startAt := config.SegmentTimes[0]
+	endAt := config.SegmentTimes[totalSegments-1]
+
+	fmtSegTimes := []string{}
+	for _, segmentTime := range config.SegmentTimes[1:] {
+		fmtSegTimes = append(fmtSegTimes, fmt.Sprintf("%.6f", segmentTime))
+	}
+	commaSeparatedSegTimes := strings.Join(fmtSegTimes, ",")
+
+	args := []string{
+		"-loglevel", version.logLevel("warning"),
+	}
+
+	// first breakpoint is not fed to -ss, see transcodeSegments
+	if startAt > 0 {
+		args = append(args, "-ss", fmt.Sprintf("%.6f", startAt))
+	}
+
+	args = append(args,
+		"-autorotate", "0", // consistent behavior
+		"-i", config.InputFilePath,
+		"-copyts", // So the "-to" refers to the original TS
+	)
+
+	// decoded video is split and scaled for every rendition
+	split := fmt.Sprintf("[0:v:0]split=%d", len(configs))
+	filters := []string{}
+	for i, c := range configs {
+		split += fmt.Sprintf("[v%d]", i)
+		filter := scaleFilter(c.VideoProfile)
+		if convertPixelFormat(c.PixelFormat) {
+			filter += ",format=yuv420p"
+		}
+		filters = append(filters, fmt.Sprintf("[v%d]%s[out%d]", i, filter, i))
+	}
+	args = append(args, "-filter_complex", strings.Join(append([]string{split}, filters...), ";"))
+
+	for i, c := range configs {
+		CV := "libx264"
+		if c.Encoder == EncoderNVENC {
+			CV = "h264_nvenc"
+		}
+
+		args = append(args,
+			"-map", fmt.Sprintf("[out%d]", i),
+			"-map", fmt.Sprintf("0:a:%d?", c.AudioStream),
+			"-to", fmt.Sprintf("%.6f", endAt),
+			"-force_key_frames", commaSeparatedSegTimes,
+			"-sn", // No subtitles
+			"-c:v", CV,
+			"-profile:v", "high",
+			"-b:v", fmt.Sprintf("%dk", c.VideoProfile.Bitrate),
+		)
+
+		if CV == "libx264" {
+			args = append(args,
+				"-preset", profilePreset(c.VideoProfile),
+				"-level:v", formatLevel(c.Level),
+			)
+		}
+
+		if c.AudioProfile != nil {
+			args = append(args,
+				"-c:a", "aac",
+				"-b:a", fmt.Sprintf("%dk", c.AudioProfile.Bitrate),
+			)
+		}
+
+		args = append(args, segmentArgs(c, commaSeparatedSegTimes, fmt.Sprintf("pipe:%d", 3+i))...)
+	}
+
+	return args
+}
+
+// starts single ffmpeg process for all requests, it runs until all of
+// them are cancelled or it finishes
+func (t *BatchTranscoder) transcodeBatch(requests []*batchRequest) error {
+	configs := []TranscodeConfig{}
+	for _, request := range requests {
+		configs = append(configs, request.config)
+	}
+
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "batch").Int("renditions", len(requests)).Logger()
+
+	cmd := exec.Command(t.FFmpegBinary, batchArgs(t.FFmpegVersion, configs)...)
+	logger.Info().Str("args", strings.Join(cmd.Args[:], " ")).Msg("starting FFmpeg process")
+
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+
+	// every rendition lists its segments to its own pipe
+	readers := []*os.File{}
+	for range requests {
+		reader, writer, err := os.Pipe()
+		if err != nil {
+			for _, file := range append(readers, cmd.ExtraFiles...) {
+				file.Close()
+			}
+			return err
+		}
+
+		readers = append(readers, reader)
+		cmd.ExtraFiles = append(cmd.ExtraFiles, writer)
+	}
+
+	// process is cancelled, when all requests are cancelled
+	ctx, cancel := context.WithCancel(context.Background())
+
+	err = utils.ProcessGroupStart(ctx, cmd)
+
+	// write ends are used only by ffmpeg
+	for _, writer := range cmd.ExtraFiles {
+		writer.Close()
+	}
+
+	if err != nil {
+		cancel()
+		for _, reader := range readers {
+			reader.Close()
+		}
+		return err
+	}
+
+	if requests[0].config.IONice {
+		if err := utils.SetIOPriorityIdle(cmd.Process.Pid); err != nil {
+			logger.Err(err).Msg("unable to set idle I/O priority")
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		for _, request := range requests {
+			select {
+			case <-request.ctx.Done():
+			case <-done:
+				return
+			}
+		}
+		cancel()
+	}()
+
+	wg := sync.WaitGroup{}
+	wg.Add(2)
+
+	// handle stderr
+	ffmpegLog := utils.FFmpegLog(logger)
+	go func() {
+		defer wg.Done()
+
+		scanner := bufio.NewScanner(stderr)
+		for scanner.Scan() {
+			ffmpegLog.Line(scanner.Text())
+
+			for _, request := range requests {
+				if request.config.OnLog != nil {
+					request.config.OnLog(scanner.Text())
+				}
+			}
+		}
+	}()
+
+	// wait until execution finishes, errors are reported before segments channels close
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		defer cancel()
+
+		err := utils.ProcessGroupWait(cmd)
+		if err != nil {
+			err = ffmpegLog.Wrap(err)
+			logger.Err(err).Msg("FFmpeg process exited with error")
+
+			for _, request := range requests {
+				if request.config.OnError != nil && request.ctx.Err() == nil {
+					request.config.OnError(err)
+				}
+			}
+		} else {
+			logger.Info().Msg("FFmpeg process successfully finished")
+		}
+	}()
+
+	// handle segment lists
+	for i, request := range requests {
+		go func(reader *os.File, request *batchRequest) {
+			defer func() {
+				reader.Close()
+				wg.Wait()
+
+				close(request.segments)
+			}()
+
+			scanner := bufio.NewScanner(reader)
+			for scanner.Scan() {
+				// cancelled request does not block others
+				select {
+				case request.segments <- scanner.Text():
+				case <-request.ctx.Done():
+				}
+			}
+		}(readers[i], request)
+	}
+
+	return nil
+}
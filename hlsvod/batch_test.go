@@ -0,0 +1,121 @@
+package hlsvod
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchKey(t *testing.T) {
+	config := TranscodeConfig{
+		InputFilePath: "/media/video.mp4",
+		SegmentTimes:  []float64{0, 4, 8},
+		VideoProfile:  &VideoProfile{Width: 1280, Height: 720, Bitrate: 2000},
+		AudioProfile:  &AudioProfile{Bitrate: 128},
+	}
+
+	key, ok := batchKey(config)
+	if !ok {
+		t.Fatal("rendition should be batched")
+	}
+
+	// other rendition of the same segments
+	other := config
+	other.VideoProfile = &VideoProfile{Width: 640, Height: 360, Bitrate: 800}
+	if otherKey, _ := batchKey(other); otherKey != key {
+		t.Error("renditions of the same segments have different keys")
+	}
+
+	other.SegmentTimes = []float64{4, 8}
+	if otherKey, _ := batchKey(other); otherKey == key {
+		t.Error("renditions of other segments have the same key")
+	}
+
+	for name, config := range map[string]TranscodeConfig{
+		"passthrough": {InputFilePath: "/media/video.mp4", VideoProfile: config.VideoProfile, Passthrough: true},
+		"audio-only":  {InputFilePath: "/media/video.mp4"},
+		"vaapi":       {InputFilePath: "/media/video.mp4", VideoProfile: config.VideoProfile, Encoder: EncoderVAAPI},
+		"subtitles":   {InputFilePath: "/media/video.mp4", VideoProfile: config.VideoProfile, BurnSubtitles: true},
+	} {
+		if _, ok := batchKey(config); ok {
+			t.Errorf("%s rendition should not be batched", name)
+		}
+	}
+}
+
+func TestBatchArgs(t *testing.T) {
+	configs := []TranscodeConfig{
+		{OutputDirPath: "/out/a", SegmentPrefix: "720p", VideoProfile: &VideoProfile{Width: 1280, Height: 720, Bitrate: 2000}},
+		{OutputDirPath: "/out/b", SegmentPrefix: "360p", VideoProfile: &VideoProfile{Width: 640, Height: 360, Bitrate: 800}, Encoder: EncoderNVENC},
+	}
+	for i := range configs {
+		configs[i].InputFilePath = "/media/video.mp4"
+		configs[i].SegmentTimes = []float64{4, 8, 12}
+	}
+
+	args := strings.Join(batchArgs(FFmpegVersion{}, configs), " ")
+
+	for _, expected := range []string{
+		"-ss 4.000000 -autorotate 0 -i /media/video.mp4",
+		"-filter_complex [0:v:0]split=2[v0][v1];[v0]scale=-2:720[out0];[v1]scale=-2:360[out1]",
+		"-map [out0] -map 0:a:0? -to 12.000000 -force_key_frames 8.000000,12.000000 -sn -c:v libx264",
+		"-segment_list pipe:3 /out/a/720p-%05d.ts",
+		"-map [out1] -map 0:a:0? -to 12.000000 -force_key_frames 8.000000,12.000000 -sn -c:v h264_nvenc",
+		"-segment_list pipe:4 /out/b/360p-%05d.ts",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("args do not contain %q:\n%s", expected, args)
+		}
+	}
+
+	if strings.Count(args, "-i ") != 1 {
+		t.Errorf("input should be decoded once:\n%s", args)
+	}
+}
+
+func TestBatchTranscoder(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires POSIX shell")
+	}
+
+	// fake ffmpeg lists segments of every rendition to its pipe
+	script := filepath.Join(t.TempDir(), "ffmpeg")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho 720p-00000.ts >&3\necho 360p-00000.ts >&4\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transcoder := NewBatchTranscoder(NewFFmpegTranscoder(script, ""), 50*time.Millisecond)
+
+	transcode := func(prefix string, height int) chan string {
+		segments, err := transcoder.TranscodeSegments(context.Background(), TranscodeConfig{
+			InputFilePath: "/media/video.mp4",
+			OutputDirPath: t.TempDir(),
+			SegmentPrefix: prefix,
+			SegmentTimes:  []float64{0, 4},
+			VideoProfile:  &VideoProfile{Width: height * 16 / 9, Height: height, Bitrate: 1000},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return segments
+	}
+
+	segments720p := transcode("720p", 720)
+	segments360p := transcode("360p", 360)
+
+	for expected, segments := range map[string]chan string{"720p-00000.ts": segments720p, "360p-00000.ts": segments360p} {
+		received := []string{}
+		for segment := range segments {
+			received = append(received, segment)
+		}
+
+		if len(received) != 1 || received[0] != expected {
+			t.Errorf("received segments %v, want [%s]", received, expected)
+		}
+	}
+}
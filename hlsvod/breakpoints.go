@@ -0,0 +1,186 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strconv"
+)
+
+// scene score, that is considered as scene change, if not specified
+const sceneThreshold = 0.4
+
+// BreakpointStrategy splits media into segments, returned breakpoints start
+// with 0 and end with media duration.
+type BreakpointStrategy interface {
+	Breakpoints(metadata *ProbeMediaData, segmentLength, segmentOffset float64) []float64
+}
+
+// BreakpointProber is implemented by strategies, that need additional data
+// about media. Data are stored in metadata, so that they are cached with it.
+type BreakpointProber interface {
+	// Returns true, if metadata were changed.
+	ProbeBreakpoints(ctx context.Context, transcoder Transcoder, inputFilePath string, metadata *ProbeMediaData) (bool, error)
+}
+
+// FixedBreakpoints splits media into segments of the same length regardless
+// of its content, e.g. for screen recordings with rare keyframes.
+type FixedBreakpoints struct{}
+
+func (FixedBreakpoints) Breakpoints(metadata *ProbeMediaData, segmentLength, segmentOffset float64) []float64 {
+	return convertToSegments([]float64{}, metadata.Duration, segmentLength, segmentOffset)
+}
+
+// KeyframeBreakpoints aligns segments to video keyframes, when they were
+// probed (see Config.VideoKeyframes), otherwise segments have fixed length.
+type KeyframeBreakpoints struct{}
+
+func (KeyframeBreakpoints) Breakpoints(metadata *ProbeMediaData, segmentLength, segmentOffset float64) []float64 {
+	keyframes := []float64{}
+	if metadata.Video != nil && metadata.Video.PktPtsTime != nil {
+		keyframes = metadata.Video.PktPtsTime
+	}
+
+	return convertToSegments(keyframes, metadata.Duration, segmentLength, segmentOffset)
+}
+
+// SceneBreakpoints prefers scene changes as segment boundaries, so that
+// segments start with new shot, e.g. for movies and edited content. Segments
+// without scene change nearby have fixed length.
+type SceneBreakpoints struct {
+	Threshold float64 // Scene score from 0 to 1, that is considered as scene change, 0 means default.
+}
+
+func (s SceneBreakpoints) threshold() float64 {
+	if s.Threshold > 0 {
+		return s.Threshold
+	}
+
+	return sceneThreshold
+}
+
+func (s SceneBreakpoints) ProbeBreakpoints(ctx context.Context, transcoder Transcoder, inputFilePath string, metadata *ProbeMediaData) (bool, error) {
+	// already probed or nothing to probe
+	if metadata.AudioOnly() || metadata.Video.SceneTimes != nil {
+		return false, nil
+	}
+
+	prober, ok := transcoder.(SceneProber)
+	if !ok {
+		return false, nil
+	}
+
+	scenes, err := prober.ProbeScenes(ctx, inputFilePath, s.threshold())
+	if err != nil {
+		return false, err
+	}
+
+	metadata.Video.SceneTimes = append([]float64{}, scenes...)
+	return true, nil
+}
+
+func (SceneBreakpoints) Breakpoints(metadata *ProbeMediaData, segmentLength, segmentOffset float64) []float64 {
+	scenes := []float64{}
+	if metadata.Video != nil && metadata.Video.SceneTimes != nil {
+		scenes = metadata.Video.SceneTimes
+	}
+
+	return convertToSegments(scenes, metadata.Duration, segmentLength, segmentOffset)
+}
+
+// SceneProber is implemented by transcoders, that are able to detect scene changes.
+type SceneProber interface {
+	ProbeScenes(ctx context.Context, inputFilePath string, threshold float64) ([]float64, error)
+}
+
+// ProbeScenes returns times of frames, that differ from previous frame more
+// than threshold. All frames must be decoded, so this is slow.
+func ProbeScenes(ctx context.Context, ffprobeBinary string, inputFilePath string, threshold float64) ([]float64, error) {
+	return probeScenes(ctx, ffprobeBinary, FFmpegVersion{}, inputFilePath, threshold)
+}
+
+func probeScenes(ctx context.Context, ffprobeBinary string, version FFmpegVersion, inputFilePath string, threshold float64) ([]float64, error) {
+	// movie source is not able to read sequence at configured frame rate
+	if ImageSequence(inputFilePath) {
+		return nil, fmt.Errorf("scene detection is not supported for image sequences")
+	}
+
+	args := []string{
+		"-v", "error", // Hide debug information
+
+		"-f", "lavfi",
+		"-i", fmt.Sprintf("movie=%s,select=gt(scene\\,%g)", filterEscape(inputFilePath), threshold),
+		"-show_entries", version.frameTimeEntries(),
+
+		"-of", "json",
+	}
+
+	cmd := exec.CommandContext(ctx, ffprobeBinary, args...)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, stderr.String())
+	}
+
+	out := struct {
+		Frames []struct {
+			PktPtsTime string `json:"pkt_pts_time"`
+			PtsTime    string `json:"pts_time"` // since ffprobe 5.0
+		} `json:"frames"`
+	}{}
+
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return nil, err
+	}
+
+	scenes := []float64{}
+	for _, frame := range out.Frames {
+		ptsTime := frame.PtsTime
+		if ptsTime == "" {
+			ptsTime = frame.PktPtsTime
+		}
+
+		if ptsTime == "" {
+			continue
+		}
+
+		time, err := strconv.ParseFloat(ptsTime, 64)
+		if err != nil {
+			return nil, err
+		}
+
+		scenes = append(scenes, time)
+	}
+
+	return scenes, nil
+}
+
+func (m *ManagerCtx) breakpointStrategy() BreakpointStrategy {
+	if m.config.Breakpoints != nil {
+		return m.config.Breakpoints
+	}
+
+	return KeyframeBreakpoints{}
+}
+
+// probes data needed by breakpoint strategy, returns true if metadata changed
+func (m *ManagerCtx) probeBreakpoints(ctx context.Context) bool {
+	prober, ok := m.breakpointStrategy().(BreakpointProber)
+	if !ok {
+		return false
+	}
+
+	changed, err := prober.ProbeBreakpoints(ctx, m.transcoder, m.config.MediaPath, m.metadata)
+	if err != nil {
+		// segments are still created, just without probed data
+		m.logger.Warn().Err(err).Msg("unable to probe media for breakpoints")
+		return false
+	}
+
+	return changed
+}
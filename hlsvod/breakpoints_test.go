@@ -0,0 +1,73 @@
+package hlsvod
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type sceneTranscoder struct {
+	*FakeTranscoder
+	scenes []float64
+	calls  int
+}
+
+func (t *sceneTranscoder) ProbeScenes(ctx context.Context, inputFilePath string, threshold float64) ([]float64, error) {
+	t.calls++
+	return t.scenes, nil
+}
+
+func TestBreakpointStrategies(t *testing.T) {
+	metadata := &ProbeMediaData{
+		Duration: 12 * time.Second,
+		Video: &ProbeVideoData{
+			PktPtsTime: []float64{0, 4.5, 9},
+			SceneTimes: []float64{3.5, 7.5},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		strategy BreakpointStrategy
+		want     []float64
+	}{
+		{"fixed", FixedBreakpoints{}, []float64{0, 4, 8, 12}},
+		{"keyframe", KeyframeBreakpoints{}, []float64{0, 4.5, 9, 12}},
+		{"scene", SceneBreakpoints{}, []float64{0, 3.5, 7.5, 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.strategy.Breakpoints(metadata, 4, 1)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Breakpoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSceneBreakpointsProbe(t *testing.T) {
+	transcoder := &sceneTranscoder{
+		FakeTranscoder: NewFakeTranscoder(12 * time.Second),
+		scenes:         []float64{},
+	}
+
+	metadata, _ := transcoder.ProbeMedia(context.Background(), "")
+	strategy := SceneBreakpoints{Threshold: 0.3}
+
+	changed, err := strategy.ProbeBreakpoints(context.Background(), transcoder, "", metadata)
+	if err != nil || !changed {
+		t.Fatalf("ProbeBreakpoints() = %v, %v, want true, nil", changed, err)
+	}
+
+	// no scene changes were found, but probe must not be repeated
+	changed, err = strategy.ProbeBreakpoints(context.Background(), transcoder, "", metadata)
+	if err != nil || changed {
+		t.Fatalf("ProbeBreakpoints() = %v, %v, want false, nil", changed, err)
+	}
+
+	if transcoder.calls != 1 {
+		t.Errorf("ProbeScenes called %d times, want 1", transcoder.calls)
+	}
+}
@@ -1,48 +1,97 @@
 package hlsvod
 
 import (
-	"crypto/sha1"
-	"fmt"
 	"os"
-	"path"
+	"path/filepath"
 )
 
 const cacheFileSuffix = ".go-transcode-cache"
 
 func (m *ManagerCtx) getCacheData() ([]byte, error) {
+	return m.getCacheFile(cacheFileSuffix)
+}
+
+func (m *ManagerCtx) getCacheFile(suffix string) ([]byte, error) {
+	// check for cache store
+	if store := m.config.CacheStore; store != nil {
+		data, err := store.Get(m.cacheFileName(suffix))
+		if err != nil {
+			return nil, err
+		}
+
+		m.logger.Info().Str("suffix", suffix).Msg("media cache store hit")
+		return m.openCacheData(data)
+	}
+
 	// check for local cache
-	localCachePath := m.config.MediaPath + cacheFileSuffix
-	if _, err := os.Stat(localCachePath); err == nil {
+	localCachePath := m.config.MediaPath + suffix
+	if _, err := m.fs.Stat(localCachePath); err == nil {
 		m.logger.Info().Str("path", localCachePath).Msg("media local cache hit")
-		return os.ReadFile(localCachePath)
+		return m.readCacheFile(localCachePath)
 	}
 
 	// check for global cache
-	h := sha1.New()
-	h.Write([]byte(m.config.MediaPath))
-	hash := h.Sum(nil)
-
-	fileName := fmt.Sprintf("%x%s", hash, cacheFileSuffix)
-	globalCachePath := path.Join(m.config.CacheDir, fileName)
-	if _, err := os.Stat(globalCachePath); err == nil {
+	globalCachePath := m.globalCachePath(suffix)
+	if _, err := m.fs.Stat(globalCachePath); err == nil {
 		m.logger.Info().Str("path", globalCachePath).Msg("media global cache hit")
-		return os.ReadFile(globalCachePath)
+		return m.readCacheFile(globalCachePath)
 	}
 
 	return nil, os.ErrNotExist
 }
 
-func (m *ManagerCtx) saveLocalCacheData(data []byte) error {
-	localCachePath := m.config.MediaPath + cacheFileSuffix
-	return os.WriteFile(localCachePath, data, 0755)
+func (m *ManagerCtx) readCacheFile(path string) ([]byte, error) {
+	data, err := m.fs.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return m.openCacheData(data)
 }
 
-func (m *ManagerCtx) saveGlobalCacheData(data []byte) error {
-	h := sha1.New()
-	h.Write([]byte(m.config.MediaPath))
-	hash := h.Sum(nil)
+func (m *ManagerCtx) saveCacheFile(suffix string, data []byte) error {
+	data, err := m.sealCacheData(data)
+	if err != nil {
+		return err
+	}
+
+	if store := m.config.CacheStore; store != nil {
+		return store.Set(m.cacheFileName(suffix), data)
+	}
+
+	if m.config.CacheDir != "" {
+		return m.fs.WriteFile(m.globalCachePath(suffix), data, 0755)
+	}
+
+	localCachePath := m.config.MediaPath + suffix
+	return m.fs.WriteFile(localCachePath, data, 0755)
+}
+
+func (m *ManagerCtx) globalCachePath(suffix string) string {
+	return filepath.Join(m.config.CacheDir, m.cacheFileName(suffix))
+}
+
+// PurgeCache removes cached metadata and segments popularity of media,
+// so that media is probed again by the next session.
+func (m *ManagerCtx) PurgeCache() error {
+	for _, suffix := range []string{cacheFileSuffix, heatmapFileSuffix} {
+		if store := m.config.CacheStore; store != nil {
+			if err := store.Delete(m.cacheFileName(suffix)); err != nil {
+				return err
+			}
+		}
+
+		paths := []string{m.config.MediaPath + suffix}
+		if m.config.CacheDir != "" {
+			paths = append(paths, m.globalCachePath(suffix))
+		}
+
+		for _, path := range paths {
+			if err := m.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
 
-	fileName := fmt.Sprintf("%x%s", hash, cacheFileSuffix)
-	globalCachePath := path.Join(m.config.CacheDir, fileName)
-	return os.WriteFile(globalCachePath, data, 0755)
+	return nil
 }
@@ -0,0 +1,96 @@
+package hlsvod
+
+import (
+	"container/list"
+	"os"
+	"sync"
+)
+
+// CacheStore stores cache data of media (e.g. probed metadata, segments
+// popularity) by keys derived from media path, so that it can be kept
+// outside of media directory and shared by multiple instances. Missing
+// key is reported as os.ErrNotExist.
+type CacheStore interface {
+	Get(key string) ([]byte, error)
+	Set(key string, data []byte) error
+	Delete(key string) error
+}
+
+type memoryCacheEntry struct {
+	key  string
+	data []byte
+}
+
+// MemoryCacheStore keeps cache data in memory of this instance, least
+// recently used entries are removed, when maximum entries are exceeded.
+type MemoryCacheStore struct {
+	mu         sync.Mutex
+	maxEntries int
+	entries    map[string]*list.Element
+	recent     *list.List // most recently used first
+}
+
+// NewMemoryCacheStore creates memory store, 0 max entries means unlimited.
+func NewMemoryCacheStore(maxEntries int) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		recent:     list.New(),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.entries[key]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	s.recent.MoveToFront(elem)
+	return append([]byte{}, elem.Value.(*memoryCacheEntry).data...), nil
+}
+
+func (s *MemoryCacheStore) Set(key string, data []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data = append([]byte{}, data...)
+	if elem, ok := s.entries[key]; ok {
+		elem.Value.(*memoryCacheEntry).data = data
+		s.recent.MoveToFront(elem)
+		return nil
+	}
+
+	s.entries[key] = s.recent.PushFront(&memoryCacheEntry{key, data})
+
+	// evict least recently used entries
+	for s.maxEntries > 0 && s.recent.Len() > s.maxEntries {
+		elem := s.recent.Back()
+		s.recent.Remove(elem)
+		delete(s.entries, elem.Value.(*memoryCacheEntry).key)
+	}
+
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.recent.Remove(elem)
+		delete(s.entries, key)
+	}
+
+	return nil
+}
+
+// Len returns number of cached entries.
+func (s *MemoryCacheStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.recent.Len()
+}
@@ -0,0 +1,83 @@
+package hlsvod
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestMemoryCacheStore(t *testing.T) {
+	store := NewMemoryCacheStore(2)
+
+	_ = store.Set("a", []byte("1"))
+	_ = store.Set("b", []byte("2"))
+
+	// a is used recently, b is evicted
+	if data, err := store.Get("a"); err != nil || string(data) != "1" {
+		t.Fatalf("get a = %q %v, want %q", data, err, "1")
+	}
+	_ = store.Set("c", []byte("3"))
+
+	if _, err := store.Get("b"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("least recently used entry was not evicted: %v", err)
+	}
+
+	if store.Len() != 2 {
+		t.Errorf("store has %d entries, want 2", store.Len())
+	}
+
+	_ = store.Delete("a")
+	if _, err := store.Get("a"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("deleted entry was found: %v", err)
+	}
+}
+
+func TestManagerCacheStore(t *testing.T) {
+	fs := newMemFS()
+	fs.files["/media/video.mp4"] = make([]byte, 100)
+
+	store := NewMemoryCacheStore(0)
+	newManager := func(transcoder Transcoder) *ManagerCtx {
+		return New(Config{
+			MediaPath:    "/media/video.mp4",
+			Cache:        true,
+			CacheStore:   store,
+			ObfuscateKey: []byte("secret"),
+			Transcoder:   transcoder,
+			FS:           fs,
+		})
+	}
+
+	m := newManager(NewFakeTranscoder(10 * time.Second))
+	if err := m.loadMetadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.Len() != 1 {
+		t.Fatalf("store has %d entries, want 1", store.Len())
+	}
+
+	if _, ok := fs.files["/media/video.mp4"+cacheFileSuffix]; ok {
+		t.Error("metadata were cached in media path")
+	}
+
+	// other instance gets metadata from store without probing
+	m = newManager(NewFakeTranscoder(20 * time.Second))
+	if err := m.loadMetadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.metadata.Duration != 10*time.Second {
+		t.Errorf("duration = %v, want cached %v", m.metadata.Duration, 10*time.Second)
+	}
+
+	if err := m.PurgeCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	if store.Len() != 0 {
+		t.Errorf("store has %d entries after purge, want 0", store.Len())
+	}
+}
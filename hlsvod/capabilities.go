@@ -0,0 +1,143 @@
+package hlsvod
+
+import (
+	"context"
+	"os/exec"
+	"sort"
+	"strings"
+)
+
+// codecs produced by known encoders
+var encoderCodecs = map[string]string{
+	"libx264":    "h264",
+	"h264_nvenc": "h264",
+	"h264_vaapi": "h264",
+	"h264_qsv":   "h264",
+	"libx265":    "hevc",
+	"hevc_nvenc": "hevc",
+	"hevc_vaapi": "hevc",
+	"libvpx-vp9": "vp9",
+	"vp9_vaapi":  "vp9",
+	"libaom-av1": "av1",
+	"libsvtav1":  "av1",
+	"aac":        "aac",
+	"libfdk_aac": "aac",
+	"libopus":    "opus",
+	"libmp3lame": "mp3",
+	"flac":       "flac",
+}
+
+// FFmpegCapabilities lists features compiled into ffmpeg binary.
+type FFmpegCapabilities struct {
+	VideoCodecs []string // Codecs, that can be encoded, e.g. h264 or vp9.
+	AudioCodecs []string
+	Encoders    []string // Known encoders, e.g. libx264 or h264_nvenc.
+	Muxers      []string
+	HWAccels    []string // Hardware acceleration methods, e.g. cuda or vaapi.
+}
+
+// parses list printed by ffmpeg -encoders or -muxers, lines with flags
+// and names follow separator line
+func parseFFmpegList(output string) map[string]string {
+	entries := map[string]string{}
+	started := false
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if !started {
+			started = len(fields) == 1 && strings.HasPrefix(fields[0], "--")
+			continue
+		}
+
+		if len(fields) < 2 {
+			continue
+		}
+
+		// muxers may be listed with multiple comma separated names
+		for _, name := range strings.Split(fields[1], ",") {
+			entries[name] = fields[0]
+		}
+	}
+
+	return entries
+}
+
+// parses list printed by ffmpeg -hwaccels
+func parseFFmpegHWAccels(output string) []string {
+	hwaccels := []string{}
+
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasSuffix(line, ":") {
+			continue
+		}
+
+		hwaccels = append(hwaccels, line)
+	}
+
+	return hwaccels
+}
+
+// ParseFFmpegCapabilities parses outputs of ffmpeg -encoders, -muxers and -hwaccels.
+func ParseFFmpegCapabilities(encoders, muxers, hwaccels string) FFmpegCapabilities {
+	c := FFmpegCapabilities{
+		VideoCodecs: []string{},
+		AudioCodecs: []string{},
+		Encoders:    []string{},
+		Muxers:      []string{},
+		HWAccels:    parseFFmpegHWAccels(hwaccels),
+	}
+
+	videoCodecs, audioCodecs := map[string]bool{}, map[string]bool{}
+	for name, flags := range parseFFmpegList(encoders) {
+		codec, ok := encoderCodecs[name]
+		if !ok {
+			continue
+		}
+
+		c.Encoders = append(c.Encoders, name)
+		switch {
+		case strings.HasPrefix(flags, "V"):
+			videoCodecs[codec] = true
+		case strings.HasPrefix(flags, "A"):
+			audioCodecs[codec] = true
+		}
+	}
+
+	for codec := range videoCodecs {
+		c.VideoCodecs = append(c.VideoCodecs, codec)
+	}
+
+	for codec := range audioCodecs {
+		c.AudioCodecs = append(c.AudioCodecs, codec)
+	}
+
+	for name, flags := range parseFFmpegList(muxers) {
+		if strings.Contains(flags, "E") {
+			c.Muxers = append(c.Muxers, name)
+		}
+	}
+
+	sort.Strings(c.VideoCodecs)
+	sort.Strings(c.AudioCodecs)
+	sort.Strings(c.Encoders)
+	sort.Strings(c.Muxers)
+	return c
+}
+
+// ProbeFFmpegCapabilities returns encoders, muxers and hardware acceleration
+// methods of ffmpeg binary.
+func ProbeFFmpegCapabilities(ctx context.Context, ffmpegBinary string) (FFmpegCapabilities, error) {
+	outputs := []string{}
+
+	for _, arg := range []string{"-encoders", "-muxers", "-hwaccels"} {
+		out, err := exec.CommandContext(ctx, ffmpegBinary, "-hide_banner", arg).Output()
+		if err != nil {
+			return FFmpegCapabilities{}, err
+		}
+
+		outputs = append(outputs, string(out))
+	}
+
+	return ParseFFmpegCapabilities(outputs[0], outputs[1], outputs[2]), nil
+}
@@ -0,0 +1,53 @@
+package hlsvod
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseFFmpegCapabilities(t *testing.T) {
+	encoders := `Encoders:
+ V..... = Video
+ A..... = Audio
+ S..... = Subtitle
+ .F.... = Frame-level multithreading
+ ------
+ V....D libx264              libx264 H.264 / AVC / MPEG-4 AVC / MPEG-4 part 10 (codec h264)
+ V....D h264_nvenc           NVIDIA NVENC H.264 encoder (codec h264)
+ V....D libvpx-vp9           libvpx VP9 (codec vp9)
+ V....D mpeg4                MPEG-4 part 2
+ A....D aac                  AAC (Advanced Audio Coding)
+ A....D libopus              libopus Opus (codec opus)
+ S..... webvtt               WebVTT subtitle
+`
+
+	muxers := `File formats:
+ D. = Demuxing supported
+ .E = Muxing supported
+ --
+  E dash            DASH Muxer
+ DE hls             Apple HTTP Live Streaming
+  E mp4             MP4 (MPEG-4 Part 14)
+ D  mpegts          MPEG-TS (MPEG-2 Transport Stream)
+`
+
+	hwaccels := `Hardware acceleration methods:
+vdpau
+cuda
+vaapi
+
+`
+
+	got := ParseFFmpegCapabilities(encoders, muxers, hwaccels)
+	want := FFmpegCapabilities{
+		VideoCodecs: []string{"h264", "vp9"},
+		AudioCodecs: []string{"aac", "opus"},
+		Encoders:    []string{"aac", "h264_nvenc", "libopus", "libvpx-vp9", "libx264"},
+		Muxers:      []string{"dash", "hls", "mp4"},
+		HWAccels:    []string{"vdpau", "cuda", "vaapi"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseFFmpegCapabilities() = %+v, want %+v", got, want)
+	}
+}
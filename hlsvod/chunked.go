@@ -0,0 +1,134 @@
+package hlsvod
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// how often is segment, that is being written, checked for new data
+const chunkedPollInterval = 100 * time.Millisecond
+
+// size of chunks read from segment, that is being written
+const chunkedBufferSize = 32 * 1024
+
+// segments can be served while they are written only if they are not
+// modified after transcode, e.g. encrypted or split from fMP4 init section
+func (m *ManagerCtx) chunkedSegments() bool {
+	return m.config.ChunkedSegments && m.config.KeyProvider == nil && !m.sealedSegments() && !m.fragmented()
+}
+
+// marks segment as being written by transcode process to output dir
+func (m *ManagerCtx) segmentWriting(index int, outputDir string) {
+	if !m.chunkedSegments() {
+		return
+	}
+
+	m.segmentsMu.Lock()
+	defer m.segmentsMu.Unlock()
+
+	// transcoders name segments by prefix and index
+	segmentName := fmt.Sprintf("%s-%05d%s", m.outputPrefix(), index, segmentExtension(m.segmentFormat()))
+	m.segmentsWriting[index] = filepath.Join(outputDir, segmentName)
+}
+
+func (m *ManagerCtx) segmentWritten(index int) {
+	m.segmentsMu.Lock()
+	defer m.segmentsMu.Unlock()
+
+	delete(m.segmentsWriting, index)
+}
+
+// returns path of segment, if it is being written
+func (m *ManagerCtx) getSegmentWriting(index int) (segmentPath string, ok bool) {
+	m.segmentsMu.RLock()
+	defer m.segmentsMu.RUnlock()
+
+	segmentPath, ok = m.segmentsWriting[index]
+	return
+}
+
+// streams segment with chunked transfer while it is being written, response
+// ends when segment is finished (done is closed), incomplete segment aborts it
+func (m *ManagerCtx) serveWritingSegment(w http.ResponseWriter, r *http.Request, index int, segmentPath string, done <-chan struct{}) {
+	// transcode process might not have created file yet
+	file, err := m.fs.Open(segmentPath)
+	for errors.Is(err, os.ErrNotExist) {
+		select {
+		case <-done:
+			// segment was finished or failed before it was opened
+			if segmentPath, ok := m.getSegment(index); ok && segmentPath != "" {
+				m.serveSegment(w, r, index, segmentPath)
+			} else {
+				m.httpError(w, r, http.StatusConflict, ErrorConflict, "segment not found even after transcoding", time.Second)
+			}
+			return
+		case <-r.Context().Done():
+			return
+		case <-m.clock.After(chunkedPollInterval):
+		}
+
+		file, err = m.fs.Open(segmentPath)
+	}
+
+	if err != nil {
+		m.logger.Err(err).Int("index", index).Str("path", segmentPath).Msg("unable to open segment being written")
+		m.httpError(w, r, http.StatusInternalServerError, ErrorTranscode, "unable to open media", time.Second)
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", utils.MediaContentType(r.URL.Path))
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	// flushes through wrapping writers, that implement Unwrap
+	rc := http.NewResponseController(w)
+	buf := make([]byte, chunkedBufferSize)
+
+	finished := false
+	for {
+		n, err := file.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+
+			// writer, that does not support flushing, sends data when buffer is full
+			_ = rc.Flush()
+			continue
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			m.logger.Err(err).Int("index", index).Str("path", segmentPath).Msg("unable to read segment being written")
+			panic(http.ErrAbortHandler)
+		}
+
+		// whole file was read after segment was finished
+		if finished {
+			break
+		}
+
+		select {
+		case <-done:
+			finished = true
+		case <-r.Context().Done():
+			return
+		case <-m.ctx.Done():
+			panic(http.ErrAbortHandler)
+		case <-m.clock.After(chunkedPollInterval):
+		}
+	}
+
+	// client must not consider incomplete segment to be finished
+	if !m.isSegmentTranscoded(index) {
+		m.logger.Warn().Int("index", index).Msg("segment being served was not finished")
+		panic(http.ErrAbortHandler)
+	}
+}
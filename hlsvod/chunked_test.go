@@ -0,0 +1,109 @@
+package hlsvod
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestServeWritingSegment(t *testing.T) {
+	dir := t.TempDir()
+	m := New(Config{TranscodeDir: dir, SegmentPrefix: "test", ChunkedSegments: true})
+	m.segments = map[int]string{0: ""}
+	m.segmentsWriting = map[int]string{}
+
+	m.segmentWriting(0, dir)
+	segmentPath, ok := m.getSegmentWriting(0)
+	if !ok {
+		t.Fatal("segment is not being written")
+	}
+
+	// segment is written in two parts
+	if err := os.WriteFile(segmentPath, []byte("first "), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		time.Sleep(2 * chunkedPollInterval)
+
+		file, err := os.OpenFile(segmentPath, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Error(err)
+		} else {
+			_, _ = file.WriteString("second")
+			file.Close()
+		}
+
+		m.segmentsMu.Lock()
+		m.segments[0] = filepath.Base(segmentPath)
+		m.segmentsMu.Unlock()
+
+		m.segmentWritten(0)
+		close(done)
+	}()
+
+	// writer is wrapped, e.g. by bandwidth accounting
+	r := httptest.NewRequest(http.MethodGet, "/test-00000.ts", nil)
+	w := httptest.NewRecorder()
+	m.serveWritingSegment(&wrappedWriter{w}, r, 0, segmentPath, done)
+
+	if w.Code != http.StatusOK || w.Body.String() != "first second" {
+		t.Errorf("served segment = %d %q, want %d %q", w.Code, w.Body.String(), http.StatusOK, "first second")
+	}
+
+	if !w.Flushed {
+		t.Error("segment being written was not flushed")
+	}
+
+	if got := w.Header().Get("Content-Type"); got != "video/mp2t" {
+		t.Errorf("content type = %q, want %q", got, "video/mp2t")
+	}
+
+	if _, ok := m.getSegmentWriting(0); ok {
+		t.Error("finished segment is still being written")
+	}
+}
+
+// writer, that does not implement http.Flusher itself
+type wrappedWriter struct {
+	http.ResponseWriter
+}
+
+func (w *wrappedWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func TestServeWritingSegmentFailed(t *testing.T) {
+	dir := t.TempDir()
+	m := New(Config{TranscodeDir: dir, SegmentPrefix: "test", ChunkedSegments: true})
+	m.segments = map[int]string{0: ""}
+
+	segmentPath := filepath.Join(dir, "test-00000.ts")
+	if err := os.WriteFile(segmentPath, []byte("partial"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// transcode failed, segment was not finished
+	done := make(chan struct{})
+	close(done)
+
+	defer func() {
+		if err := recover(); err != http.ErrAbortHandler {
+			t.Errorf("incomplete segment recovered %v, want %v", err, http.ErrAbortHandler)
+		}
+	}()
+
+	r := httptest.NewRequest(http.MethodGet, "/test-00000.ts", nil)
+	m.serveWritingSegment(httptest.NewRecorder(), r, 0, segmentPath, done)
+}
+
+func TestChunkedSegmentsEncrypted(t *testing.T) {
+	m := New(Config{ChunkedSegments: true, SegmentKey: []byte("secret")})
+	if m.chunkedSegments() {
+		t.Error("encrypted segments are served while being written")
+	}
+}
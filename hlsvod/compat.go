@@ -0,0 +1,76 @@
+package hlsvod
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CompatibilityMatrix describes streams, that can be copied to HLS without
+// encoding and still be played by target players.
+type CompatibilityMatrix struct {
+	VideoCodecs   []string // e.g. h264
+	VideoProfiles []string // e.g. Main, High
+	VideoMaxLevel int      // e.g. 41 for level 4.1, 0 means unlimited
+	PixelFormats  []string // e.g. yuv420p
+	MaxBFrames    int      // -1 means unlimited
+
+	AudioCodecs   []string // e.g. aac
+	AudioProfiles []string // e.g. LC, HE-AAC
+}
+
+var DefaultCompatibilityMatrix = CompatibilityMatrix{
+	VideoCodecs:   []string{"h264"},
+	VideoProfiles: []string{"Constrained Baseline", "Baseline", "Main", "High"},
+	VideoMaxLevel: 42,
+	PixelFormats:  []string{"yuv420p", "yuvj420p"},
+	MaxBFrames:    2,
+
+	AudioCodecs:   []string{"aac", "mp3"},
+	AudioProfiles: []string{"LC", "HE-AAC", "HE-AACv2", ""},
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// returns error describing the reason, why media streams cannot be copied
+func (c CompatibilityMatrix) Check(data *ProbeMediaData) error {
+	if video := data.Video; video != nil {
+		if !containsFold(c.VideoCodecs, video.CodecName) {
+			return fmt.Errorf("unsupported video codec %q", video.CodecName)
+		}
+
+		if len(c.VideoProfiles) > 0 && !containsFold(c.VideoProfiles, video.Profile) {
+			return fmt.Errorf("unsupported video profile %q", video.Profile)
+		}
+
+		if c.VideoMaxLevel > 0 && video.Level > c.VideoMaxLevel {
+			return fmt.Errorf("unsupported video level %d, maximum is %d", video.Level, c.VideoMaxLevel)
+		}
+
+		if len(c.PixelFormats) > 0 && !containsFold(c.PixelFormats, video.PixFmt) {
+			return fmt.Errorf("unsupported pixel format %q", video.PixFmt)
+		}
+
+		if c.MaxBFrames >= 0 && video.HasBFrames > c.MaxBFrames {
+			return fmt.Errorf("unsupported number of b-frames %d, maximum is %d", video.HasBFrames, c.MaxBFrames)
+		}
+	}
+
+	for _, audio := range data.Audio {
+		if !containsFold(c.AudioCodecs, audio.CodecName) {
+			return fmt.Errorf("unsupported audio codec %q", audio.CodecName)
+		}
+
+		if len(c.AudioProfiles) > 0 && !containsFold(c.AudioProfiles, audio.Profile) {
+			return fmt.Errorf("unsupported audio profile %q", audio.Profile)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,212 @@
+package hlsvod
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultMaxLevel is the highest H.264 level of encoded video, it allows
+// 4K at 60 fps.
+const DefaultMaxLevel = 52
+
+// encoded video has at least this level, so that players, that already
+// play it, are not affected by computed levels of low profiles
+const minLevel = 40
+
+// frame rate assumed for source, whose frame rate is not known
+const defaultFramerate = 30
+
+// limits of H.264 levels (Table A-1), bitrate is of High profile
+type h264Limits struct {
+	level   int     // e.g. 41 for 4.1
+	mbps    float64 // macroblocks per second
+	fs      int     // macroblocks per frame
+	bitrate int     // in kilobits per second
+}
+
+var h264Levels = []h264Limits{
+	{10, 1485, 99, 80},
+	{11, 3000, 396, 240},
+	{12, 6000, 396, 480},
+	{13, 11880, 396, 960},
+	{20, 11880, 396, 2500},
+	{21, 19800, 792, 5000},
+	{22, 20250, 1620, 5000},
+	{30, 40500, 1620, 12500},
+	{31, 108000, 3600, 17500},
+	{32, 216000, 5120, 25000},
+	{40, 245760, 8192, 25000},
+	{41, 245760, 8192, 62500},
+	{42, 522240, 8704, 62500},
+	{50, 589824, 22080, 168750},
+	{51, 983040, 36864, 300000},
+	{52, 2073600, 36864, 300000},
+	{60, 4177920, 139264, 300000},
+	{61, 8355840, 139264, 600000},
+	{62, 16711680, 139264, 1000000},
+}
+
+// limits of HEVC levels of Main tier (Table A.8), level is general_level_idc
+type hevcLimits struct {
+	level   int     // e.g. 123 for 4.1
+	lumaSr  float64 // luma samples per second
+	lumaPs  int     // luma samples per frame
+	bitrate int     // in kilobits per second
+}
+
+var hevcLevels = []hevcLimits{
+	{30, 552960, 36864, 128},
+	{60, 3686400, 122880, 1500},
+	{63, 7372800, 245760, 3000},
+	{90, 16588800, 552960, 6000},
+	{93, 33177600, 983040, 10000},
+	{120, 66846720, 2228224, 12000},
+	{123, 133693440, 2228224, 20000},
+	{150, 267386880, 8912896, 25000},
+	{153, 534773760, 8912896, 40000},
+	{156, 1069547520, 8912896, 60000},
+	{180, 1069547520, 35651584, 60000},
+	{183, 2139095040, 35651584, 120000},
+	{186, 4278190080, 35651584, 240000},
+}
+
+// HEVCCodecs returns RFC 6381 codecs of HEVC Main profile video of resolution,
+// frame rate and bitrate in kilobits, with AAC audio, if audio is set. Level
+// is the lowest one, that can encode video, as chosen by x265.
+func HEVCCodecs(width, height int, framerate float64, bitrate int, audio bool) string {
+	if framerate <= 0 {
+		framerate = defaultFramerate
+	}
+
+	level := hevcLevels[len(hevcLevels)-1].level
+	for _, limits := range hevcLevels {
+		if width*height <= limits.lumaPs && float64(width*height)*framerate <= limits.lumaSr && bitrate <= limits.bitrate {
+			level = limits.level
+			break
+		}
+	}
+
+	codecs := fmt.Sprintf("hvc1.1.6.L%d.B0", level)
+	if audio {
+		codecs += ",mp4a.40.2"
+	}
+
+	return codecs
+}
+
+// ParseLevel parses H.264 level, e.g. 4.1 or 41.
+func ParseLevel(value string) (int, error) {
+	level, err := strconv.Atoi(strings.Replace(value, ".", "", 1))
+	if err == nil {
+		for _, limits := range h264Levels {
+			if limits.level == level {
+				return level, nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("unknown H.264 level %q", value)
+}
+
+// returns level formatted for ffmpeg, e.g. 4.1
+func formatLevel(level int) string {
+	if level == 0 {
+		level = minLevel
+	}
+
+	return fmt.Sprintf("%d.%d", level/10, level%10)
+}
+
+// H264Level returns the lowest H.264 level, that can encode video of
+// resolution, frame rate and bitrate in kilobits, 0 if there is none.
+func H264Level(width, height int, framerate float64, bitrate int) int {
+	// frame is encoded in 16x16 macroblocks
+	mbs := ((width + 15) / 16) * ((height + 15) / 16)
+
+	for _, limits := range h264Levels {
+		if mbs <= limits.fs && float64(mbs)*framerate <= limits.mbps && bitrate <= limits.bitrate {
+			return limits.level
+		}
+	}
+
+	return 0
+}
+
+// returns resolution of video scaled by scaleFilter, dimension scaled to -2
+// is rounded to even number
+func scaledSize(profile *VideoProfile, width, height int) (int, int) {
+	if width <= 0 || height <= 0 {
+		return profile.Width, profile.Height
+	}
+
+	if profile.Width >= profile.Height {
+		w := int(math.Round(float64(width)*float64(profile.Height)/float64(height)/2)) * 2
+		return w, profile.Height
+	}
+
+	h := int(math.Round(float64(height)*float64(profile.Width)/float64(width)/2)) * 2
+	return profile.Width, h
+}
+
+// pixel formats accepted by H.264 High profile, other are converted
+var encodablePixelFormats = map[string]bool{
+	"yuv420p":  true,
+	"yuvj420p": true,
+	"nv12":     true,
+}
+
+// returns true, if source pixel format must be converted before encoding,
+// e.g. 10-bit or 4:2:2 video
+func convertPixelFormat(pixFmt string) bool {
+	return pixFmt != "" && !encodablePixelFormats[pixFmt]
+}
+
+// CheckProfile returns H.264 level of video encoded from source using
+// profile, or error describing, why it cannot be encoded. Max level of 0
+// means DefaultMaxLevel. HEVC profiles are not limited by level and 0 is
+// returned for them.
+func CheckProfile(video *ProbeVideoData, profile *VideoProfile, framerate float64, maxLevel int) (int, error) {
+	if maxLevel == 0 {
+		maxLevel = DefaultMaxLevel
+	}
+
+	if profile.Width <= 0 || profile.Height <= 0 {
+		return 0, fmt.Errorf("%w: resolution %dx%d must be positive", ErrProfileConstraint, profile.Width, profile.Height)
+	}
+
+	// 4:2:0 chroma has half resolution of luma
+	if profile.Width%2 != 0 || profile.Height%2 != 0 {
+		return 0, fmt.Errorf("%w: resolution %dx%d has odd dimensions, use even width and height", ErrProfileConstraint, profile.Width, profile.Height)
+	}
+
+	if video.PixFmt == "" || video.PixFmt == "unknown" {
+		return 0, fmt.Errorf("%w: pixel format of source is unknown, video codec %q is probably not supported by ffmpeg", ErrProfileConstraint, video.CodecName)
+	}
+
+	// x265 picks level by itself
+	if profile.Codec == CodecHEVC {
+		return 0, nil
+	}
+
+	if framerate <= 0 {
+		framerate = video.FrameRate
+	}
+	if framerate <= 0 {
+		framerate = defaultFramerate
+	}
+
+	width, height := scaledSize(profile, video.Width, video.Height)
+	level := H264Level(width, height, framerate, profile.Bitrate)
+	if level == 0 || level > maxLevel {
+		return 0, fmt.Errorf("%w: %dx%d at %g fps and %d kbps exceeds H.264 level %s, lower resolution or bitrate of profile, or raise max level",
+			ErrProfileConstraint, width, height, math.Round(framerate*100)/100, profile.Bitrate, formatLevel(maxLevel))
+	}
+
+	if level < minLevel {
+		level = minLevel
+	}
+
+	return level, nil
+}
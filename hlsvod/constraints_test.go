@@ -0,0 +1,121 @@
+package hlsvod
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestH264Level(t *testing.T) {
+	tests := []struct {
+		width, height int
+		framerate     float64
+		bitrate       int
+		level         int
+	}{
+		{1280, 720, 30, 2800, 31},
+		{1920, 1080, 30, 5000, 40},
+		{1920, 1080, 60, 5000, 42},
+		{3840, 2160, 30, 16000, 51},
+		{3840, 2160, 60, 16000, 52},
+		{7680, 4320, 240, 16000, 0},
+	}
+
+	for _, test := range tests {
+		if level := H264Level(test.width, test.height, test.framerate, test.bitrate); level != test.level {
+			t.Errorf("H264Level(%dx%d@%g) = %d, want %d", test.width, test.height, test.framerate, level, test.level)
+		}
+	}
+}
+
+func TestHEVCCodecs(t *testing.T) {
+	tests := []struct {
+		width, height int
+		framerate     float64
+		bitrate       int
+		audio         bool
+		codecs        string
+	}{
+		{1280, 720, 30, 2800, true, "hvc1.1.6.L93.B0,mp4a.40.2"},
+		{1920, 1080, 0, 3500, true, "hvc1.1.6.L120.B0,mp4a.40.2"},
+		{1920, 1080, 60, 3500, false, "hvc1.1.6.L123.B0"},
+		{3840, 2160, 30, 16000, false, "hvc1.1.6.L150.B0"},
+	}
+
+	for _, test := range tests {
+		if codecs := HEVCCodecs(test.width, test.height, test.framerate, test.bitrate, test.audio); codecs != test.codecs {
+			t.Errorf("HEVCCodecs(%dx%d@%g) = %s, want %s", test.width, test.height, test.framerate, codecs, test.codecs)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for value, want := range map[string]int{"4.1": 41, "52": 52, "5.2": 52} {
+		if level, err := ParseLevel(value); err != nil || level != want {
+			t.Errorf("ParseLevel(%q) = %d, %v", value, level, err)
+		}
+	}
+
+	for _, value := range []string{"", "4.3", "high"} {
+		if _, err := ParseLevel(value); err == nil {
+			t.Errorf("ParseLevel(%q) should fail", value)
+		}
+	}
+}
+
+func TestCheckProfile(t *testing.T) {
+	source := &ProbeVideoData{CodecName: "hevc", Width: 3840, Height: 2160, PixFmt: "yuv420p10le", FrameRate: 60}
+
+	tests := []struct {
+		name     string
+		video    *ProbeVideoData
+		profile  VideoProfile
+		maxLevel int
+		level    int
+	}{
+		{"720p", source, VideoProfile{Width: 1280, Height: 720, Bitrate: 2800}, 0, 40},
+		{"2160p60", source, VideoProfile{Width: 3840, Height: 2160, Bitrate: 16000}, 0, 52},
+		{"2160p60 over max level", source, VideoProfile{Width: 3840, Height: 2160, Bitrate: 16000}, 51, 0},
+		{"odd dimensions", source, VideoProfile{Width: 1281, Height: 721, Bitrate: 2800}, 0, 0},
+		{"unknown pixel format", &ProbeVideoData{CodecName: "prores", Width: 1920, Height: 1080}, VideoProfile{Width: 1280, Height: 720, Bitrate: 2800}, 0, 0},
+	}
+
+	for _, test := range tests {
+		level, err := CheckProfile(test.video, &test.profile, 0, test.maxLevel)
+		if level != test.level {
+			t.Errorf("%s: level = %d, want %d", test.name, level, test.level)
+		}
+
+		if (test.level == 0) != errors.Is(err, ErrProfileConstraint) {
+			t.Errorf("%s: err = %v", test.name, err)
+		}
+	}
+
+	// preview has one frame per second
+	if level, err := CheckProfile(source, &VideoProfile{Width: 3840, Height: 2160, Bitrate: 16000}, 1, 51); err != nil || level != 51 {
+		t.Errorf("preview level = %d, %v", level, err)
+	}
+
+	// HEVC is not limited by H.264 level
+	if level, err := CheckProfile(source, &VideoProfile{Width: 3840, Height: 2160, Bitrate: 16000, Codec: CodecHEVC}, 60, 41); err != nil || level != 0 {
+		t.Errorf("HEVC level = %d, %v", level, err)
+	}
+}
+
+func TestScaledSize(t *testing.T) {
+	// portrait video scaled to landscape profile keeps its aspect ratio
+	if width, height := scaledSize(&VideoProfile{Width: 1280, Height: 720}, 1080, 1920); width != 406 || height != 720 {
+		t.Errorf("scaledSize() = %dx%d", width, height)
+	}
+
+	if width, height := scaledSize(&VideoProfile{Width: 720, Height: 1280}, 1920, 1080); width != 720 || height != 406 {
+		t.Errorf("scaledSize() = %dx%d", width, height)
+	}
+}
+
+func TestConvertPixelFormat(t *testing.T) {
+	for pixFmt, want := range map[string]bool{"": false, "yuv420p": false, "yuvj420p": false, "yuv420p10le": true, "yuv422p": true} {
+		if got := convertPixelFormat(pixFmt); got != want {
+			t.Errorf("convertPixelFormat(%q) = %v, want %v", pixFmt, got, want)
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package hlsvod
+
+import (
+	"context"
+	"os/exec"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// video encoders, that can be assigned to renditions
+const (
+	EncoderAuto     = ""         // Hardware encoder with free session, otherwise software.
+	EncoderSoftware = "software" // libx264 or libx265
+	EncoderNVENC    = "nvenc"    // h264_nvenc or hevc_nvenc
+	EncoderVAAPI    = "vaapi"    // h264_vaapi or hevc_vaapi
+)
+
+// returns ffmpeg encoder of video codec
+func videoEncoder(encoder, codec string) string {
+	hevc := codec == CodecHEVC
+
+	switch encoder {
+	case EncoderNVENC:
+		if hevc {
+			return "hevc_nvenc"
+		}
+		return "h264_nvenc"
+	case EncoderVAAPI:
+		if hevc {
+			return "hevc_vaapi"
+		}
+		return "h264_vaapi"
+	}
+
+	if hevc {
+		return "libx265"
+	}
+	return "libx264"
+}
+
+// hardware encoders in order of preference for auto placement
+var hardwareEncoders = []string{EncoderNVENC, EncoderVAAPI}
+
+// EncoderPool places renditions on hardware encoders with limited number of
+// simultaneous sessions, renditions that do not fit are encoded in software.
+type EncoderPool struct {
+	mu     sync.Mutex
+	limits map[string]int
+	active map[string]int
+
+	// last polled GPUs and encode sessions of other processes using them
+	gpus     []GPUStats
+	external map[string]int
+	busy     map[string]bool
+
+	// Renditions with auto encoder lower than this height are encoded in
+	// software, so that hardware sessions are left for demanding renditions.
+	AutoMinHeight int
+	// Hardware encoder is considered full, when encode utilization of its
+	// GPU reaches this percent. 0 means disabled.
+	MaxUtilization float64
+}
+
+// NewEncoderPool creates pool with maximum sessions per hardware encoder.
+func NewEncoderPool(limits map[string]int) *EncoderPool {
+	p := &EncoderPool{
+		limits:   map[string]int{},
+		active:   map[string]int{},
+		external: map[string]int{},
+		busy:     map[string]bool{},
+	}
+
+	for encoder, limit := range limits {
+		if limit > 0 {
+			p.limits[encoder] = limit
+		}
+	}
+
+	return p
+}
+
+// Limits returns maximum sessions per hardware encoder.
+func (p *EncoderPool) Limits() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	limits := map[string]int{}
+	for encoder, limit := range p.limits {
+		limits[encoder] = limit
+	}
+
+	return limits
+}
+
+// Sessions returns active sessions per hardware encoder started by pool.
+func (p *EncoderPool) Sessions() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sessions := map[string]int{}
+	for encoder := range p.limits {
+		sessions[encoder] = p.active[encoder]
+	}
+
+	return sessions
+}
+
+// GPUs returns last polled GPU utilization.
+func (p *EncoderPool) GPUs() []GPUStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]GPUStats{}, p.gpus...)
+}
+
+// UpdateGPUs sets polled GPU utilization. Encode sessions of other processes
+// (e.g. live transcodes) count into session limits of hardware encoders.
+func (p *EncoderPool) UpdateGPUs(gpus []GPUStats) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sessions := map[string]int{}
+	busy := map[string]bool{}
+	for _, gpu := range gpus {
+		if gpu.Sessions >= 0 {
+			sessions[gpu.Encoder] += gpu.Sessions
+		}
+
+		if p.MaxUtilization > 0 && gpu.EncodeUtilization >= p.MaxUtilization {
+			busy[gpu.Encoder] = true
+		}
+	}
+
+	// polled sessions include sessions started by pool
+	external := map[string]int{}
+	for encoder, count := range sessions {
+		if count -= p.active[encoder]; count > 0 {
+			external[encoder] = count
+		}
+	}
+
+	p.gpus = append([]GPUStats{}, gpus...)
+	p.external = external
+	p.busy = busy
+}
+
+// Acquire returns encoder for rendition and function releasing its session.
+// Explicitly assigned hardware encoder falls back to software, if it is full.
+func (p *EncoderPool) Acquire(preferred string, height int) (string, func()) {
+	if p == nil {
+		return preferred, func() {}
+	}
+
+	var candidates []string
+	switch preferred {
+	case EncoderSoftware:
+	case EncoderAuto:
+		if height >= p.AutoMinHeight {
+			candidates = hardwareEncoders
+		}
+	default:
+		candidates = []string{preferred}
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, encoder := range candidates {
+		if p.active[encoder]+p.external[encoder] >= p.limits[encoder] || p.busy[encoder] {
+			continue
+		}
+
+		p.active[encoder]++
+
+		var once sync.Once
+		return encoder, func() {
+			once.Do(func() {
+				p.mu.Lock()
+				p.active[encoder]--
+				p.mu.Unlock()
+			})
+		}
+	}
+
+	return EncoderSoftware, func() {}
+}
+
+// ProbeEncoderPool detects available hardware encoders and their session
+// limits by running up to maxSessions simultaneous test encodes. Limits
+// that are specified explicitly are not probed.
+func ProbeEncoderPool(ctx context.Context, ffmpegBinary string, maxSessions int, limits map[string]int) *EncoderPool {
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "encoders").Logger()
+
+	probed := map[string]int{}
+	for encoder, limit := range limits {
+		probed[encoder] = limit
+	}
+
+	for _, encoder := range hardwareEncoders {
+		if _, ok := probed[encoder]; ok {
+			continue
+		}
+
+		probed[encoder] = probeEncoderSessions(ctx, ffmpegBinary, encoder, maxSessions)
+		logger.Info().Str("encoder", encoder).Int("sessions", probed[encoder]).Msg("probed hardware encoder")
+	}
+
+	return NewEncoderPool(probed)
+}
+
+// returns number of simultaneous test encodes, that succeeded
+func probeEncoderSessions(ctx context.Context, ffmpegBinary, encoder string, maxSessions int) int {
+	var args []string
+	switch encoder {
+	case EncoderNVENC:
+		args = []string{"-c:v", "h264_nvenc"}
+	case EncoderVAAPI:
+		args = []string{
+			"-vaapi_device", "/dev/dri/renderD128",
+			"-vf", "format=nv12,hwupload",
+			"-c:v", "h264_vaapi",
+		}
+	default:
+		return 0
+	}
+
+	// sessions must overlap, therefore test source is read at native frame rate
+	args = append([]string{
+		"-loglevel", "error",
+		"-re",
+		"-f", "lavfi",
+		"-i", "testsrc2=size=256x256:rate=25:duration=2",
+	}, args...)
+	args = append(args, "-f", "null", "-")
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+
+	for i := 0; i < maxSessions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			if err := exec.CommandContext(ctx, ffmpegBinary, args...).Run(); err != nil {
+				return
+			}
+
+			mu.Lock()
+			succeeded++
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+	return succeeded
+}
+
+// returns encoder used by transcode process
+func (m *ManagerCtx) acquireEncoder(opts transcodeOptions, profile segmentProfile) (string, func()) {
+	// failed segments are retried in software, fMP4 segments are always
+	// encoded in software, as they share init section of the first one
+	if opts.fallback || profile.passthrough || profile.video == nil || m.fragmented() {
+		return EncoderSoftware, func() {}
+	}
+
+	return m.config.Encoders.Acquire(m.config.Encoder, profile.video.Height)
+}
@@ -0,0 +1,82 @@
+package hlsvod
+
+import "testing"
+
+func TestEncoderPool(t *testing.T) {
+	pool := NewEncoderPool(map[string]int{EncoderNVENC: 1})
+	pool.AutoMinHeight = 720
+
+	encoder, release := pool.Acquire(EncoderAuto, 2160)
+	if encoder != EncoderNVENC {
+		t.Fatalf("expected %s, got %s", EncoderNVENC, encoder)
+	}
+
+	// session limit reached
+	if encoder, _ := pool.Acquire(EncoderNVENC, 2160); encoder != EncoderSoftware {
+		t.Fatalf("expected %s, got %s", EncoderSoftware, encoder)
+	}
+
+	release()
+	release()
+
+	// low renditions are kept in software
+	if encoder, _ := pool.Acquire(EncoderAuto, 480); encoder != EncoderSoftware {
+		t.Fatalf("expected %s, got %s", EncoderSoftware, encoder)
+	}
+
+	// not available hardware encoder
+	if encoder, _ := pool.Acquire(EncoderVAAPI, 2160); encoder != EncoderSoftware {
+		t.Fatalf("expected %s, got %s", EncoderSoftware, encoder)
+	}
+
+	if encoder, _ := pool.Acquire(EncoderNVENC, 480); encoder != EncoderNVENC {
+		t.Fatalf("expected %s, got %s", EncoderNVENC, encoder)
+	}
+}
+
+func TestEncoderPoolNil(t *testing.T) {
+	var pool *EncoderPool
+
+	if encoder, _ := pool.Acquire(EncoderVAAPI, 720); encoder != EncoderVAAPI {
+		t.Fatalf("expected %s, got %s", EncoderVAAPI, encoder)
+	}
+}
+
+func TestEncoderPoolGPUs(t *testing.T) {
+	pool := NewEncoderPool(map[string]int{EncoderNVENC: 3, EncoderVAAPI: 2})
+	pool.MaxUtilization = 90
+
+	_, release := pool.Acquire(EncoderNVENC, 1080)
+	defer release()
+
+	// polled sessions include one started by pool
+	pool.UpdateGPUs([]GPUStats{
+		{Encoder: EncoderNVENC, Sessions: 3, EncodeUtilization: 50},
+		{Encoder: EncoderVAAPI, Sessions: -1, EncodeUtilization: 95},
+	})
+
+	if encoder, _ := pool.Acquire(EncoderNVENC, 1080); encoder != EncoderSoftware {
+		t.Fatalf("expected %s, got %s", EncoderSoftware, encoder)
+	}
+
+	if encoder, _ := pool.Acquire(EncoderVAAPI, 1080); encoder != EncoderSoftware {
+		t.Fatalf("expected %s, got %s", EncoderSoftware, encoder)
+	}
+
+	// other process stopped encoding
+	pool.UpdateGPUs([]GPUStats{
+		{Encoder: EncoderNVENC, Sessions: 2, EncodeUtilization: 50},
+	})
+
+	if encoder, _ := pool.Acquire(EncoderNVENC, 1080); encoder != EncoderNVENC {
+		t.Fatalf("expected %s, got %s", EncoderNVENC, encoder)
+	}
+
+	if encoder, _ := pool.Acquire(EncoderVAAPI, 1080); encoder != EncoderVAAPI {
+		t.Fatalf("expected %s, got %s", EncoderVAAPI, encoder)
+	}
+
+	if sessions := pool.Sessions(); sessions[EncoderNVENC] != 2 || sessions[EncoderVAAPI] != 1 {
+		t.Fatalf("unexpected sessions %v", sessions)
+	}
+}
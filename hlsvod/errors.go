@@ -0,0 +1,85 @@
+package hlsvod
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// error codes returned in HTTP error responses
+const (
+	ErrorBadRequest         = "bad-request"
+	ErrorNotFound           = "not-found"
+	ErrorConflict           = "conflict"
+	ErrorNotReady           = "not-ready"
+	ErrorShutdown           = "shutdown"
+	ErrorReadyTimeout       = "ready-timeout"
+	ErrorTranscode          = "transcode-failed"
+	ErrorTranscodeTimeout   = "transcode-timeout"
+	ErrorUnsupportedMedia   = "unsupported-media"
+	ErrorUnsupportedProfile = "unsupported-profile"
+	ErrorGap                = "segment-gap"
+	ErrorSourceChanged      = "source-changed"
+)
+
+// media, that cannot be transcoded, session fails to start with these errors
+var (
+	ErrNoStreams  = errors.New("media has no video or audio stream")
+	ErrNoDuration = errors.New("media has unknown duration")
+	ErrStillImage = errors.New("media is a single still image")
+)
+
+// ErrProfileConstraint is wrapped by errors of profile, that cannot be
+// encoded from media, e.g. because it exceeds H.264 level limits.
+var ErrProfileConstraint = errors.New("profile cannot be encoded")
+
+// ErrClipRange is returned by session of virtual clip, that is outside of
+// media, e.g. it starts after media ends.
+var ErrClipRange = errors.New("clip is outside of media")
+
+// ErrProbeFailed is wrapped by errors of ffprobe, that was not able to read
+// media, it is not returned when probe was cancelled.
+var ErrProbeFailed = errors.New("unable to probe media")
+
+// session states returned in HTTP error responses
+const (
+	StateStarting = "starting"
+	StateReady    = "ready"
+	StateStopped  = "stopped"
+)
+
+// HTTPError is body of JSON error responses.
+type HTTPError = httperror.Error
+
+// PanicError is cause of session, that was stopped because of panic in its
+// goroutine, it contains stack trace of the panic.
+type PanicError = utils.PanicError
+
+func (m *ManagerCtx) state() string {
+	if m.ctx.Err() != nil {
+		return StateStopped
+	}
+
+	if m.isReady() {
+		return StateReady
+	}
+
+	return StateStarting
+}
+
+// writes error with current session state using error responder (JSON by
+// default), if retry is set client is hinted when to retry the request
+func (m *ManagerCtx) httpError(w http.ResponseWriter, r *http.Request, status int, code, message string, retry time.Duration) {
+	e := httperror.New(r, status, code, message).WithRetry(retry)
+	e.State = m.state()
+
+	responder := m.config.ErrorResponder
+	if responder == nil {
+		responder = httperror.JSON
+	}
+
+	e.Write(w, r, responder)
+}
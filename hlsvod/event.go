@@ -0,0 +1,41 @@
+package hlsvod
+
+import "github.com/m1k1o/go-transcode/internal/utils"
+
+// playlist lists only segments transcoded in order, it is extended as they
+// are transcoded in background, so that players can start before whole
+// media is transcoded, growing media has its own event playlist
+func (m *ManagerCtx) eventPlaylist() bool {
+	return m.event
+}
+
+// returns number of segments listed in playlist
+func (m *ManagerCtx) playlistSegments() int {
+	if m.eventPlaylist() {
+		return m.eventSegments
+	}
+
+	return len(m.breakpoints) - 1
+}
+
+// extends event playlist by segments transcoded (or listed as gaps) in
+// order, returns true if it was extended, lock must be held
+func (m *ManagerCtx) extendEventPlaylist() bool {
+	extended := false
+	for m.eventSegments < len(m.breakpoints)-1 && (m.segments[m.eventSegments] != "" || m.segmentGaps[m.eventSegments]) {
+		m.eventSegments++
+		extended = true
+	}
+
+	return extended
+}
+
+// transcodes whole media in background, so that event playlist is extended
+func (m *ManagerCtx) transcodeEvent() {
+	defer utils.RecoverPanic(m.logger, m.panicked)
+
+	if err := m.Warm(m.ctx, nil); err != nil && m.ctx.Err() == nil {
+		m.logger.Err(err).Msg("unable to transcode media of event playlist")
+		m.publishTranscodeFailed(err)
+	}
+}
@@ -0,0 +1,69 @@
+package hlsvod
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManagerEventPlaylist(t *testing.T) {
+	fs := newMemFS()
+	fs.files["/media/video.mp4"] = make([]byte, 100)
+
+	m := New(Config{
+		MediaPath:     "/media/video.mp4",
+		TranscodeDir:  "/transcode",
+		SegmentPrefix: "test",
+		EventPlaylist: true,
+		Transcoder:    NewFakeTranscoder(10 * time.Second),
+		Clock:         newFakeClock(),
+		FS:            fs,
+	})
+
+	if err := m.loadMetadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	segmentsTotal := len(m.breakpoints) - 1
+	if segmentsTotal < 3 {
+		t.Fatalf("media has %d segments, want at least 3", segmentsTotal)
+	}
+
+	if !strings.Contains(m.playlist, "#EXT-X-PLAYLIST-TYPE:EVENT") || strings.Contains(m.playlist, "#EXTINF") {
+		t.Errorf("playlist should be empty event playlist:\n%s", m.playlist)
+	}
+
+	addSegment := func(index int) {
+		segmentName := m.getSegmentName(index)
+		fs.files["/transcode/"+segmentName] = []byte("segment")
+		m.addSegment(index, "/transcode", segmentName)
+	}
+
+	// segments are listed only in order
+	addSegment(1)
+	if got := strings.Count(m.playlist, "#EXTINF"); got != 0 {
+		t.Errorf("playlist has %d segments, want 0", got)
+	}
+
+	addSegment(0)
+	if got := strings.Count(m.playlist, "#EXTINF"); got != 2 {
+		t.Errorf("playlist has %d segments, want 2", got)
+	}
+
+	for i := 2; i < segmentsTotal; i++ {
+		addSegment(i)
+	}
+
+	if !strings.Contains(m.playlist, "#EXT-X-PLAYLIST-TYPE:VOD") || !strings.HasSuffix(m.playlist, "#EXT-X-ENDLIST") {
+		t.Errorf("transcoded media should have vod playlist:\n%s", m.playlist)
+	}
+
+	if got := strings.Count(m.playlist, "#EXTINF"); got != segmentsTotal {
+		t.Errorf("playlist has %d segments, want %d", got, segmentsTotal)
+	}
+}
@@ -0,0 +1,293 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+const (
+	ExportMP4  = "mp4"
+	ExportWebM = "webm"
+)
+
+// keyframes closer than this to clip boundary are considered to be at boundary
+const exportKeyframeEpsilon = 0.001
+
+type ExportConfig struct {
+	InputFilePath  string // Exported video input.
+	OutputFilePath string // Exported file, it is written only when export succeeds.
+	Format         string // Container of exported file, mp4 (default) or webm.
+
+	Start float64 // Clip start in seconds.
+	End   float64 // Clip end in seconds.
+
+	// Without video profile, video keeps its resolution and only GOPs at clip
+	// boundaries are reencoded, if its codec fits container. Otherwise whole
+	// clip is reencoded.
+	VideoProfile *VideoProfile
+	AudioProfile *AudioProfile
+
+	Control  *utils.JobControl // Pauses export, nil means it is never paused.
+	Progress func(float64)     // Called with finished part of export from 0 to 1.
+}
+
+// part of exported clip, that is either copied or reencoded
+type ExportPart struct {
+	Start float64
+	End   float64
+	Copy  bool
+}
+
+// returns parts of clip, GOPs between the first and the last keyframe of clip
+// are copied, frames before and after them are reencoded
+func ExportPlan(start, end float64, keyframes []float64) []ExportPart {
+	first, last := math.Inf(1), math.Inf(-1)
+	for _, keyframe := range keyframes {
+		if keyframe < start-exportKeyframeEpsilon || keyframe > end+exportKeyframeEpsilon {
+			continue
+		}
+
+		first = math.Min(first, keyframe)
+		last = math.Max(last, keyframe)
+	}
+
+	// clip does not contain whole GOP
+	if last-first <= exportKeyframeEpsilon {
+		return []ExportPart{{Start: start, End: end}}
+	}
+
+	parts := []ExportPart{}
+	if first-start > exportKeyframeEpsilon {
+		parts = append(parts, ExportPart{Start: start, End: first})
+	}
+
+	parts = append(parts, ExportPart{Start: first, End: last, Copy: true})
+
+	if end-last > exportKeyframeEpsilon {
+		parts = append(parts, ExportPart{Start: last, End: end})
+	}
+
+	return parts
+}
+
+// returns encoder, that produces video codec of media fitting container, so
+// that reencoded parts can be joined with copied ones
+func exportSmartEncoder(format string, codecName string) string {
+	switch {
+	case format == ExportWebM && codecName == "vp9":
+		return "libvpx-vp9"
+	case format != ExportWebM && codecName == "h264":
+		return "libx264"
+	}
+
+	return ""
+}
+
+func exportVideoEncoder(format string) string {
+	if format == ExportWebM {
+		return "libvpx-vp9"
+	}
+
+	return "libx264"
+}
+
+func exportPartArgs(config ExportConfig, part ExportPart, encoder string, pixFmt string, outputFilePath string) []string {
+	args := []string{
+		"-loglevel", "warning",
+		"-autorotate", "0", // consistent behavior
+		"-ss", fmt.Sprintf("%.6f", part.Start),
+		"-i", config.InputFilePath,
+		"-t", fmt.Sprintf("%.6f", part.End-part.Start),
+		"-map", "0:v:0",
+		"-an", "-sn", // Audio is exported from media at once
+	}
+
+	if part.Copy {
+		args = append(args, "-c:v", "copy", "-avoid_negative_ts", "make_zero")
+		return append(args, "-f", "matroska", "-y", outputFilePath)
+	}
+
+	if profile := config.VideoProfile; profile != nil {
+		args = append(args, "-vf", scaleFilter(profile), "-b:v", fmt.Sprintf("%dk", profile.Bitrate))
+	} else if encoder == "libvpx-vp9" {
+		args = append(args, "-crf", "31", "-b:v", "0")
+	} else {
+		args = append(args, "-crf", "18")
+	}
+
+	args = append(args, "-c:v", encoder)
+
+	// parameters of copied stream are kept
+	if pixFmt != "" {
+		args = append(args, "-pix_fmt", pixFmt)
+	}
+
+	return append(args, "-f", "matroska", "-y", outputFilePath)
+}
+
+func exportMuxArgs(config ExportConfig, concatFilePath string, audio bool, outputFilePath string) []string {
+	args := []string{"-loglevel", "warning"}
+
+	video := concatFilePath != ""
+	if video {
+		args = append(args, "-f", "concat", "-safe", "0", "-i", concatFilePath)
+	}
+
+	if audio {
+		args = append(args,
+			"-ss", fmt.Sprintf("%.6f", config.Start),
+			"-t", fmt.Sprintf("%.6f", config.End-config.Start),
+			"-i", config.InputFilePath,
+		)
+	}
+
+	if video {
+		args = append(args, "-map", "0:v:0", "-c:v", "copy")
+	}
+
+	if audio {
+		input := "0"
+		if video {
+			input = "1"
+		}
+
+		args = append(args, "-map", input+":a:0")
+
+		if config.Format == ExportWebM {
+			args = append(args, "-c:a", "libopus")
+		} else {
+			args = append(args, "-c:a", "aac")
+		}
+
+		if profile := config.AudioProfile; profile != nil {
+			args = append(args, "-b:a", fmt.Sprintf("%dk", profile.Bitrate))
+		}
+	}
+
+	if config.Format == ExportWebM {
+		args = append(args, "-f", "webm")
+	} else {
+		args = append(args, "-movflags", "+faststart", "-f", "mp4")
+	}
+
+	return append(args, "-y", outputFilePath)
+}
+
+func exportFFmpeg(ctx context.Context, ffmpegBinary string, control *utils.JobControl, args []string) error {
+	// paused exports do not start new parts
+	if err := control.Wait(ctx); err != nil {
+		return err
+	}
+
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "export").Logger()
+
+	cmd := exec.Command(ffmpegBinary, args...)
+	logger.Info().Str("args", strings.Join(cmd.Args[:], " ")).Msg("starting FFmpeg process")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := utils.ProcessGroupStart(ctx, cmd); err != nil {
+		return err
+	}
+
+	untrack := control.Track(cmd)
+	err := utils.ProcessGroupWait(cmd)
+	untrack()
+
+	if err != nil {
+		return fmt.Errorf("%w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return nil
+}
+
+// exports frame accurate clip of media into single file, parts of video are
+// rendered separately and joined with audio of the whole clip
+func Export(ctx context.Context, ffmpegBinary string, ffprobeBinary string, config ExportConfig) error {
+	if config.Format == "" {
+		config.Format = ExportMP4
+	}
+
+	progress := func(value float64) {
+		if config.Progress != nil {
+			config.Progress(value)
+		}
+	}
+
+	data, err := ProbeMedia(ctx, ffprobeBinary, config.InputFilePath)
+	if err != nil {
+		return fmt.Errorf("unable to probe media: %w", err)
+	}
+
+	if duration := data.Duration.Seconds(); duration > 0 && config.End > duration {
+		config.End = duration
+	}
+
+	if config.Start < 0 || config.End <= config.Start {
+		return fmt.Errorf("invalid export range %.3f-%.3f", config.Start, config.End)
+	}
+
+	tmpDir, err := os.MkdirTemp(filepath.Dir(config.OutputFilePath), ".export-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	var concatFilePath string
+	if !data.AudioOnly() {
+		encoder, pixFmt := exportVideoEncoder(config.Format), ""
+		parts := []ExportPart{{Start: config.Start, End: config.End}}
+
+		// only keyframes within clip are probed
+		if smart := exportSmartEncoder(config.Format, data.Video.CodecName); smart != "" && config.VideoProfile == nil {
+			interval := fmt.Sprintf("%f%%%f", config.Start, config.End)
+			video, err := probeVideoInterval(ctx, ffprobeBinary, FFmpegVersion{}, config.InputFilePath, 0, interval)
+			if err != nil {
+				return fmt.Errorf("unable to probe keyframes: %w", err)
+			}
+
+			encoder, pixFmt = smart, data.Video.PixFmt
+			parts = ExportPlan(config.Start, config.End, video.PktPtsTime)
+		}
+
+		var concat strings.Builder
+		for i, part := range parts {
+			partFilePath := filepath.Join(tmpDir, fmt.Sprintf("part-%d.mkv", i))
+			if err := exportFFmpeg(ctx, ffmpegBinary, config.Control, exportPartArgs(config, part, encoder, pixFmt, partFilePath)); err != nil {
+				return err
+			}
+
+			fmt.Fprintf(&concat, "file '%s'\n", partFilePath)
+			progress(float64(i+1) / float64(len(parts)+1))
+		}
+
+		concatFilePath = filepath.Join(tmpDir, "concat.txt")
+		if err := os.WriteFile(concatFilePath, []byte(concat.String()), 0644); err != nil {
+			return err
+		}
+	}
+
+	// partial output is never seen by clients
+	outputFilePath := filepath.Join(tmpDir, "output."+config.Format)
+	if err := exportFFmpeg(ctx, ffmpegBinary, config.Control, exportMuxArgs(config, concatFilePath, len(data.Audio) > 0, outputFilePath)); err != nil {
+		return err
+	}
+
+	if err := os.Rename(outputFilePath, config.OutputFilePath); err != nil {
+		return err
+	}
+
+	progress(1)
+	return nil
+}
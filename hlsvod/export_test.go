@@ -0,0 +1,134 @@
+package hlsvod
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExportPlan(t *testing.T) {
+	keyframes := []float64{0, 2, 4, 6, 8, 10}
+
+	tests := []struct {
+		name       string
+		start, end float64
+		want       []ExportPart
+	}{
+		{
+			name:  "boundaries between keyframes",
+			start: 1.5, end: 8.5,
+			want: []ExportPart{
+				{Start: 1.5, End: 2},
+				{Start: 2, End: 8, Copy: true},
+				{Start: 8, End: 8.5},
+			},
+		},
+		{
+			name:  "boundaries at keyframes",
+			start: 2, end: 6,
+			want: []ExportPart{
+				{Start: 2, End: 6, Copy: true},
+			},
+		},
+		{
+			name:  "clip within single GOP",
+			start: 2.5, end: 3.5,
+			want: []ExportPart{
+				{Start: 2.5, End: 3.5},
+			},
+		},
+		{
+			name:  "single keyframe in clip",
+			start: 3, end: 5,
+			want: []ExportPart{
+				{Start: 3, End: 5},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ExportPlan(tt.start, tt.end, keyframes)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExportPlan(%v, %v) = %v, want %v", tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+
+	// without keyframes whole clip is reencoded
+	if got := ExportPlan(1, 5, nil); !reflect.DeepEqual(got, []ExportPart{{Start: 1, End: 5}}) {
+		t.Errorf("ExportPlan without keyframes = %v", got)
+	}
+}
+
+func TestExportSmartEncoder(t *testing.T) {
+	if got := exportSmartEncoder(ExportMP4, "h264"); got != "libx264" {
+		t.Errorf("h264 in mp4 encoder = %q", got)
+	}
+
+	if got := exportSmartEncoder(ExportWebM, "vp9"); got != "libvpx-vp9" {
+		t.Errorf("vp9 in webm encoder = %q", got)
+	}
+
+	if got := exportSmartEncoder(ExportWebM, "h264"); got != "" {
+		t.Errorf("h264 in webm is copied by %q", got)
+	}
+}
+
+func TestExportPartArgs(t *testing.T) {
+	config := ExportConfig{InputFilePath: "in.mp4"}
+
+	args := strings.Join(exportPartArgs(config, ExportPart{Start: 2, End: 8, Copy: true}, "libx264", "yuv420p", "part.mkv"), " ")
+	for _, want := range []string{"-ss 2.000000 -i in.mp4 -t 6.000000", "-c:v copy", "-f matroska -y part.mkv"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("copy args %q do not contain %q", args, want)
+		}
+	}
+
+	args = strings.Join(exportPartArgs(config, ExportPart{Start: 1.5, End: 2}, "libx264", "yuv420p", "part.mkv"), " ")
+	for _, want := range []string{"-ss 1.500000 -i in.mp4 -t 0.500000", "-c:v libx264", "-pix_fmt yuv420p"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("encode args %q do not contain %q", args, want)
+		}
+	}
+
+	config.VideoProfile = &VideoProfile{Width: 1280, Height: 720, Bitrate: 2000}
+	args = strings.Join(exportPartArgs(config, ExportPart{Start: 0, End: 5}, "libvpx-vp9", "", "part.mkv"), " ")
+	for _, want := range []string{"-vf scale=-2:720", "-b:v 2000k", "-c:v libvpx-vp9"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("profile args %q do not contain %q", args, want)
+		}
+	}
+}
+
+func TestExportMuxArgs(t *testing.T) {
+	config := ExportConfig{
+		InputFilePath: "in.mp4",
+		Format:        ExportWebM,
+		Start:         1.5,
+		End:           8.5,
+		AudioProfile:  &AudioProfile{Bitrate: 128},
+	}
+
+	args := strings.Join(exportMuxArgs(config, "concat.txt", true, "out.webm"), " ")
+	for _, want := range []string{
+		"-f concat -safe 0 -i concat.txt",
+		"-ss 1.500000 -t 7.000000 -i in.mp4",
+		"-map 0:v:0 -c:v copy",
+		"-map 1:a:0 -c:a libopus -b:a 128k",
+		"-f webm -y out.webm",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("mux args %q do not contain %q", args, want)
+		}
+	}
+
+	// audio only media
+	config.Format = ExportMP4
+	args = strings.Join(exportMuxArgs(config, "", true, "out.mp4"), " ")
+	for _, want := range []string{"-map 0:a:0 -c:a aac", "-movflags +faststart -f mp4"} {
+		if !strings.Contains(args, want) {
+			t.Errorf("audio mux args %q do not contain %q", args, want)
+		}
+	}
+}
@@ -0,0 +1,447 @@
+package hlsvod
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	fakeVideoPid = 0x100
+	fakePmtPid   = 0x1000
+
+	// fake video consists of one color bar per macroblock column
+	fakeMbWidth  = 8
+	fakeMbHeight = 2
+)
+
+// color bars in YUV
+var fakeColorBars = [fakeMbWidth][3]byte{
+	{180, 128, 128}, // white
+	{162, 44, 142},  // yellow
+	{131, 156, 44},  // cyan
+	{112, 72, 58},   // green
+	{84, 184, 198},  // magenta
+	{65, 100, 212},  // red
+	{35, 212, 114},  // blue
+	{16, 128, 128},  // black
+}
+
+// FakeTranscoder generates tiny valid MPEG-TS segments with color bars
+// (H.264, one keyframe per second, no audio) without spawning any process.
+// It is meant for integration tests and demos, input file is never read.
+// Only MPEG-TS is generated, profiles with fMP4 segments fail to transcode.
+type FakeTranscoder struct {
+	Duration time.Duration // Reported media duration.
+	Delay    time.Duration // Simulated transcode time of every segment.
+
+	framesOnce sync.Once
+	frames     [2][]byte // IDR access units with alternating idr_pic_id
+}
+
+func NewFakeTranscoder(duration time.Duration) *FakeTranscoder {
+	return &FakeTranscoder{
+		Duration: duration,
+	}
+}
+
+func (t *FakeTranscoder) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	return &ProbeMediaData{
+		FormatName: []string{"mpegts"},
+		Duration:   t.Duration,
+		Video: &ProbeVideoData{
+			Width:     fakeMbWidth * 16,
+			Height:    fakeMbHeight * 16,
+			Duration:  t.Duration,
+			CodecName: "h264",
+			Profile:   "Constrained Baseline",
+			Level:     30,
+			PixFmt:    "yuv420p",
+		},
+	}, nil
+}
+
+func (t *FakeTranscoder) ProbeVideo(ctx context.Context, inputFilePath string) (*ProbeVideoData, error) {
+	data, err := t.ProbeMedia(ctx, inputFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// every frame is a keyframe
+	for i := 0; i < int(math.Ceil(t.Duration.Seconds())); i++ {
+		data.Video.PktPtsTime = append(data.Video.PktPtsTime, float64(i))
+	}
+
+	return data.Video, nil
+}
+
+func (t *FakeTranscoder) Capabilities() Capabilities {
+	return Capabilities{
+		Keyframes: true,
+	}
+}
+
+func (t *FakeTranscoder) TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error) {
+	if len(config.SegmentTimes) < 2 {
+		return nil, fmt.Errorf("minimum 2 segment times needed")
+	}
+
+	if config.SegmentFormat == SegmentFormatFMP4 {
+		return nil, fmt.Errorf("fake transcoder generates only MPEG-TS segments")
+	}
+
+	t.framesOnce.Do(func() {
+		t.frames[0] = fakeAccessUnit(0)
+		t.frames[1] = fakeAccessUnit(1)
+	})
+
+	segments := make(chan string, 1)
+
+	go func() {
+		defer close(segments)
+
+		for i := 0; i < len(config.SegmentTimes)-1; i++ {
+			select {
+			case <-time.After(t.Delay):
+			case <-ctx.Done():
+				return
+			}
+
+			segmentName := fmt.Sprintf("%s-%05d.ts", config.SegmentPrefix, config.SegmentOffset+i)
+			data := t.segment(config.SegmentTimes[i], config.SegmentTimes[i+1])
+
+			err := os.WriteFile(filepath.Join(config.OutputDirPath, segmentName), data, 0644)
+			if err != nil {
+				if config.OnError != nil && ctx.Err() == nil {
+					config.OnError(err)
+				}
+				return
+			}
+
+			select {
+			case segments <- segmentName:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return segments, nil
+}
+
+// returns transport stream with one frame per second from start to end
+func (t *FakeTranscoder) segment(start, end float64) []byte {
+	var counters = map[uint16]byte{}
+
+	data := []byte{}
+	data = append(data, tsPSIPacket(0, &counters, fakePAT())...)
+	data = append(data, tsPSIPacket(fakePmtPid, &counters, fakePMT())...)
+
+	for i, ts := 0, start; ts < end; i, ts = i+1, ts+1 {
+		pts := uint64(ts * 90000)
+
+		pes := []byte{
+			0x00, 0x00, 0x01, 0xe0, // start code, video stream
+			0x00, 0x00, // unbounded length
+			0x80, 0x80, 0x05, // PTS only
+			byte(0x21 | (pts>>29)&0x0e),
+			byte(pts >> 22),
+			byte(0x01 | (pts>>14)&0xfe),
+			byte(pts >> 7),
+			byte(0x01 | (pts<<1)&0xfe),
+		}
+		pes = append(pes, t.frames[i%2]...)
+
+		data = append(data, tsPESPackets(fakeVideoPid, &counters, pes, pts)...)
+	}
+
+	return data
+}
+
+//
+// MPEG-TS
+//
+
+// MPEG-2 CRC32 used by PSI sections
+func crc32MPEG2(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc ^= uint32(b) << 24
+		for i := 0; i < 8; i++ {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func withCRC(section []byte) []byte {
+	crc := crc32MPEG2(section)
+	return append(section, byte(crc>>24), byte(crc>>16), byte(crc>>8), byte(crc))
+}
+
+func fakePAT() []byte {
+	return withCRC([]byte{
+		0x00,       // table id
+		0xb0, 0x0d, // section length
+		0x00, 0x01, // transport stream id
+		0xc1, 0x00, 0x00, // version, section numbers
+		0x00, 0x01, // program number
+		0xe0 | fakePmtPid>>8, fakePmtPid & 0xff,
+	})
+}
+
+func fakePMT() []byte {
+	return withCRC([]byte{
+		0x02,       // table id
+		0xb0, 0x12, // section length
+		0x00, 0x01, // program number
+		0xc1, 0x00, 0x00, // version, section numbers
+		0xe0 | fakeVideoPid>>8, fakeVideoPid & 0xff, // PCR pid
+		0xf0, 0x00, // program info length
+		0x1b, // H.264
+		0xe0 | fakeVideoPid>>8, fakeVideoPid & 0xff,
+		0xf0, 0x00, // ES info length
+	})
+}
+
+// returns packet with PSI section, that fits into single packet
+func tsPSIPacket(pid uint16, counters *map[uint16]byte, section []byte) []byte {
+	payload := append([]byte{0x00}, section...) // pointer field
+	for len(payload) < tsPacketSize-4 {
+		payload = append(payload, 0xff)
+	}
+
+	packet, _ := tsMuxPacket(pid, true, (*counters)[pid], nil, payload)
+	(*counters)[pid] = ((*counters)[pid] + 1) & 0x0f
+	return packet
+}
+
+// returns packets with PES, first packet carries PCR and random access indicator
+func tsPESPackets(pid uint16, counters *map[uint16]byte, pes []byte, pcr uint64) []byte {
+	data := []byte{}
+
+	first := true
+	for len(pes) > 0 {
+		var adaptation []byte
+		if first {
+			adaptation = []byte{
+				0x50, // random access, PCR
+				byte(pcr >> 25),
+				byte(pcr >> 17),
+				byte(pcr >> 9),
+				byte(pcr >> 1),
+				byte(pcr&1)<<7 | 0x7e,
+				0x00,
+			}
+		}
+
+		packet, n := tsMuxPacket(pid, first, (*counters)[pid], adaptation, pes)
+		(*counters)[pid] = ((*counters)[pid] + 1) & 0x0f
+
+		data = append(data, packet...)
+		pes = pes[n:]
+		first = false
+	}
+
+	return data
+}
+
+// returns packet and number of payload bytes used, adaptation field
+// is stuffed if payload does not fill whole packet
+func tsMuxPacket(pid uint16, unitStart bool, counter byte, adaptation []byte, payload []byte) ([]byte, int) {
+	hasAdaptation := adaptation != nil
+
+	space := tsPacketSize - 4
+	if hasAdaptation {
+		space -= 1 + len(adaptation)
+	}
+
+	n := len(payload)
+	if n > space {
+		n = space
+	}
+
+	if stuffing := space - n; stuffing > 0 {
+		if !hasAdaptation {
+			hasAdaptation = true
+			stuffing-- // adaptation field length
+			if stuffing > 0 {
+				adaptation = []byte{0x00} // no flags
+				stuffing--
+			} else {
+				adaptation = []byte{}
+			}
+		}
+
+		for i := 0; i < stuffing; i++ {
+			adaptation = append(adaptation, 0xff)
+		}
+	}
+
+	control := byte(0x10) // payload only
+	if hasAdaptation {
+		control = 0x30 // adaptation field and payload
+	}
+
+	b := []byte{tsSyncByte, byte(pid>>8) & 0x1f, byte(pid), control | counter}
+	if unitStart {
+		b[1] |= 0x40
+	}
+
+	if hasAdaptation {
+		b = append(b, byte(len(adaptation)))
+		b = append(b, adaptation...)
+	}
+
+	return append(b, payload[:n]...), n
+}
+
+//
+// H.264
+//
+
+type bitWriter struct {
+	data  []byte
+	cur   byte
+	nbits int
+}
+
+func (w *bitWriter) bits(value uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		w.cur = w.cur<<1 | byte(value>>uint(i)&1)
+		w.nbits++
+		if w.nbits == 8 {
+			w.data = append(w.data, w.cur)
+			w.cur, w.nbits = 0, 0
+		}
+	}
+}
+
+// unsigned Exp-Golomb code
+func (w *bitWriter) ue(value uint32) {
+	value++
+	n := 0
+	for v := value; v > 1; v >>= 1 {
+		n++
+	}
+	w.bits(0, n)
+	w.bits(value, n+1)
+}
+
+func (w *bitWriter) align() {
+	for w.nbits != 0 {
+		w.bits(0, 1)
+	}
+}
+
+// rbsp stop bit followed by alignment
+func (w *bitWriter) trailing() []byte {
+	w.bits(1, 1)
+	w.align()
+	return w.data
+}
+
+// returns NAL unit with start code and emulation prevention bytes
+func nalUnit(header byte, rbsp []byte) []byte {
+	nal := []byte{0x00, 0x00, 0x00, 0x01, header}
+
+	zeros := 0
+	for _, b := range rbsp {
+		if zeros >= 2 && b <= 0x03 {
+			nal = append(nal, 0x03)
+			zeros = 0
+		}
+
+		nal = append(nal, b)
+		if b == 0x00 {
+			zeros++
+		} else {
+			zeros = 0
+		}
+	}
+
+	return nal
+}
+
+// returns access unit with single IDR frame of I_PCM macroblocks
+func fakeAccessUnit(idrPicID uint32) []byte {
+	// access unit delimiter, I slices
+	au := nalUnit(0x09, []byte{0xf0})
+
+	// sequence parameter set
+	sps := &bitWriter{}
+	sps.bits(66, 8)   // profile_idc, baseline
+	sps.bits(0xc0, 8) // constraint_set0_flag, constraint_set1_flag
+	sps.bits(30, 8)   // level_idc
+	sps.ue(0)         // seq_parameter_set_id
+	sps.ue(0)         // log2_max_frame_num_minus4
+	sps.ue(2)         // pic_order_cnt_type
+	sps.ue(1)         // max_num_ref_frames
+	sps.bits(0, 1)    // gaps_in_frame_num_value_allowed_flag
+	sps.ue(fakeMbWidth - 1)
+	sps.ue(fakeMbHeight - 1)
+	sps.bits(1, 1) // frame_mbs_only_flag
+	sps.bits(1, 1) // direct_8x8_inference_flag
+	sps.bits(0, 1) // frame_cropping_flag
+	sps.bits(0, 1) // vui_parameters_present_flag
+	au = append(au, nalUnit(0x67, sps.trailing())...)
+
+	// picture parameter set
+	pps := &bitWriter{}
+	pps.ue(0)      // pic_parameter_set_id
+	pps.ue(0)      // seq_parameter_set_id
+	pps.bits(0, 1) // entropy_coding_mode_flag, CAVLC
+	pps.bits(0, 1) // bottom_field_pic_order_in_frame_present_flag
+	pps.ue(0)      // num_slice_groups_minus1
+	pps.ue(0)      // num_ref_idx_l0_default_active_minus1
+	pps.ue(0)      // num_ref_idx_l1_default_active_minus1
+	pps.bits(0, 1) // weighted_pred_flag
+	pps.bits(0, 2) // weighted_bipred_idc
+	pps.ue(0)      // pic_init_qp_minus26
+	pps.ue(0)      // pic_init_qs_minus26
+	pps.ue(0)      // chroma_qp_index_offset
+	pps.bits(0, 1) // deblocking_filter_control_present_flag
+	pps.bits(0, 1) // constrained_intra_pred_flag
+	pps.bits(0, 1) // redundant_pic_cnt_present_flag
+	au = append(au, nalUnit(0x68, pps.trailing())...)
+
+	// IDR slice
+	slice := &bitWriter{}
+	slice.ue(0)        // first_mb_in_slice
+	slice.ue(7)        // slice_type, I
+	slice.ue(0)        // pic_parameter_set_id
+	slice.bits(0, 4)   // frame_num
+	slice.ue(idrPicID) // idr_pic_id
+	slice.bits(0, 1)   // no_output_of_prior_pics_flag
+	slice.bits(0, 1)   // long_term_reference_flag
+	slice.ue(0)        // slice_qp_delta
+
+	for y := 0; y < fakeMbHeight; y++ {
+		for x := 0; x < fakeMbWidth; x++ {
+			color := fakeColorBars[x]
+
+			slice.ue(25) // mb_type, I_PCM
+			slice.align()
+			for i := 0; i < 256; i++ {
+				slice.bits(uint32(color[0]), 8)
+			}
+			for i := 0; i < 64; i++ {
+				slice.bits(uint32(color[1]), 8)
+			}
+			for i := 0; i < 64; i++ {
+				slice.bits(uint32(color[2]), 8)
+			}
+		}
+	}
+	au = append(au, nalUnit(0x65, slice.trailing())...)
+
+	return au
+}
@@ -0,0 +1,72 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFakeTranscoder(t *testing.T) {
+	dir := t.TempDir()
+	transcoder := NewFakeTranscoder(8 * time.Second)
+
+	segments, err := transcoder.TranscodeSegments(context.Background(), TranscodeConfig{
+		OutputDirPath: dir,
+		SegmentPrefix: "test",
+		SegmentOffset: 2,
+		SegmentTimes:  []float64{8, 12, 16},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	names := []string{}
+	for name := range segments {
+		names = append(names, name)
+	}
+
+	if want := []string{"test-00002.ts", "test-00003.ts"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("segments = %v, want %v", names, want)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, names[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(data)%tsPacketSize != 0 || !isTransportStream(filepath.Join(dir, names[0])) {
+		t.Fatalf("segment is not a valid transport stream")
+	}
+
+	// split fake segment again at its keyframes
+	splitDir := t.TempDir()
+	split := make(chan string, 4)
+	err = SegmentTransportStream(context.Background(), bytes.NewReader(data), TranscodeConfig{
+		OutputDirPath: splitDir,
+		SegmentPrefix: "split",
+		SegmentTimes:  []float64{8, 10, 12},
+	}, split)
+	if err != nil {
+		t.Fatal(err)
+	}
+	close(split)
+
+	if len(split) != 2 {
+		t.Errorf("fake segment split into %d segments, want 2", len(split))
+	}
+}
+
+func TestCRC32MPEG2(t *testing.T) {
+	// section including its CRC has zero remainder
+	if crc := crc32MPEG2(fakePAT()); crc != 0 {
+		t.Errorf("PAT CRC remainder = %#x, want 0", crc)
+	}
+
+	if crc := crc32MPEG2(fakePMT()); crc != 0 {
+		t.Errorf("PMT CRC remainder = %#x, want 0", crc)
+	}
+}
@@ -0,0 +1,239 @@
+package hlsvod
+
+import (
+	"container/list"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// how long is unused file kept opened
+const filePoolIdleTimeout = 30 * time.Second
+
+// filePool is a FileSystem keeping opened files of hot segments for reuse,
+// so that concurrent viewers do not open and close them on every request.
+// Every file is used by one request at a time, so that its offset is not
+// shared and it can still be served by sendfile. Files are invalidated,
+// when they are removed or rewritten through file system.
+type filePool struct {
+	FileSystem
+	clock Clock
+	max   int // opened unused files in total
+
+	mu     sync.Mutex
+	files  map[string]*filePoolEntry
+	idle   *list.List // unused files, the least recently used first
+	closed bool       // pool was purged, released files are closed
+}
+
+// opened files of the same name
+type filePoolEntry struct {
+	idle  []*list.Element
+	users int  // files currently used by requests
+	stale bool // file was removed or rewritten, files are closed when unused
+}
+
+type pooledFile struct {
+	File
+	pool  *filePool
+	name  string
+	entry *filePoolEntry
+	used  time.Time
+}
+
+func newFilePool(fs FileSystem, max int, clock Clock) *filePool {
+	return &filePool{
+		FileSystem: fs,
+		clock:      clock,
+		max:        max,
+		files:      map[string]*filePoolEntry{},
+		idle:       list.New(),
+	}
+}
+
+// Unwrap returns opened file of underlying file system, so that operating
+// system files can be served by sendfile.
+func (f *pooledFile) Unwrap() File {
+	return f.File
+}
+
+func (f *pooledFile) Close() error {
+	return f.pool.release(f)
+}
+
+func (p *filePool) Open(name string) (File, error) {
+	p.mu.Lock()
+	p.expire()
+
+	entry, ok := p.files[name]
+	if ok && len(entry.idle) > 0 {
+		elem := entry.idle[len(entry.idle)-1]
+		entry.idle = entry.idle[:len(entry.idle)-1]
+		entry.users++
+		p.idle.Remove(elem)
+		p.mu.Unlock()
+
+		// previous request might have left offset anywhere
+		file := elem.Value.(*pooledFile)
+		if _, err := file.File.Seek(0, io.SeekStart); err != nil {
+			p.mu.Lock()
+			entry.users--
+			p.forget(name, entry)
+			p.mu.Unlock()
+
+			file.File.Close()
+			return nil, err
+		}
+
+		return file, nil
+	}
+
+	if !ok {
+		entry = &filePoolEntry{}
+		p.files[name] = entry
+	}
+	entry.users++
+	p.mu.Unlock()
+
+	file, err := p.FileSystem.Open(name)
+	if err != nil {
+		p.mu.Lock()
+		entry.users--
+		p.forget(name, entry)
+		p.mu.Unlock()
+		return nil, err
+	}
+
+	return &pooledFile{
+		File:  file,
+		pool:  p,
+		name:  name,
+		entry: entry,
+	}, nil
+}
+
+// returns file to pool, unless it is stale or pool is full or purged
+func (p *filePool) release(f *pooledFile) error {
+	p.mu.Lock()
+	f.entry.users--
+
+	if f.entry.stale || p.closed || p.max <= 0 {
+		p.forget(f.name, f.entry)
+		p.mu.Unlock()
+		return f.File.Close()
+	}
+
+	// the least recently used file makes room
+	var evicted *pooledFile
+	if p.idle.Len() >= p.max {
+		evicted = p.remove(p.idle.Front())
+	}
+
+	f.used = p.clock.Now()
+	f.entry.idle = append(f.entry.idle, p.idle.PushBack(f))
+	p.mu.Unlock()
+
+	if evicted != nil {
+		return evicted.File.Close()
+	}
+
+	return nil
+}
+
+// removes unused file from pool, lock must be held
+func (p *filePool) remove(elem *list.Element) *pooledFile {
+	file := p.idle.Remove(elem).(*pooledFile)
+
+	entry := file.entry
+	for i, e := range entry.idle {
+		if e == elem {
+			entry.idle = append(entry.idle[:i], entry.idle[i+1:]...)
+			break
+		}
+	}
+
+	p.forget(file.name, entry)
+	return file
+}
+
+// forgets entry without any opened files, lock must be held
+func (p *filePool) forget(name string, entry *filePoolEntry) {
+	if entry.users == 0 && len(entry.idle) == 0 && p.files[name] == entry {
+		delete(p.files, name)
+	}
+}
+
+// closes files unused for idle timeout, lock must be held
+func (p *filePool) expire() {
+	now := p.clock.Now()
+	for elem := p.idle.Front(); elem != nil; elem = p.idle.Front() {
+		if now.Sub(elem.Value.(*pooledFile).used) < filePoolIdleTimeout {
+			return
+		}
+
+		p.remove(elem).File.Close()
+	}
+}
+
+// closes unused files of name, files in use are closed when they are released
+func (p *filePool) invalidate(name string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	entry, ok := p.files[name]
+	if !ok {
+		return
+	}
+
+	entry.stale = true
+	for len(entry.idle) > 0 {
+		p.remove(entry.idle[0]).File.Close()
+	}
+
+	// new files are opened by later requests
+	delete(p.files, name)
+}
+
+// closes all unused files, files in use are closed when they are released
+func (p *filePool) purge() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+
+	for elem := p.idle.Front(); elem != nil; elem = p.idle.Front() {
+		p.remove(elem).File.Close()
+	}
+}
+
+func (p *filePool) Create(name string) (io.WriteCloser, error) {
+	p.invalidate(name)
+	return p.FileSystem.Create(name)
+}
+
+func (p *filePool) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	p.invalidate(name)
+	return p.FileSystem.WriteFile(name, data, perm)
+}
+
+func (p *filePool) Remove(name string) error {
+	p.invalidate(name)
+	return p.FileSystem.Remove(name)
+}
+
+// returns operating system file of opened file, if it is one, so that it
+// can be served by sendfile
+func osFile(file File) (*os.File, bool) {
+	for {
+		switch f := file.(type) {
+		case *os.File:
+			return f, true
+		case interface{ Unwrap() File }:
+			file = f.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package hlsvod
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// counts files opened by underlying file system
+type countingFS struct {
+	*memFS
+	opened int
+}
+
+func (c *countingFS) Open(name string) (File, error) {
+	c.opened++
+	return c.memFS.Open(name)
+}
+
+func readPooled(t *testing.T, pool *filePool, name string) string {
+	t.Helper()
+
+	file, err := pool.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
+
+func TestFilePoolReuse(t *testing.T) {
+	fs := &countingFS{memFS: newMemFS()}
+	_ = fs.WriteFile("/seg-0.ts", []byte("segment"), 0644)
+
+	pool := newFilePool(fs, 4, newFakeClock())
+
+	for i := 0; i < 3; i++ {
+		if data := readPooled(t, pool, "/seg-0.ts"); data != "segment" {
+			t.Fatalf("read %q", data)
+		}
+	}
+
+	if fs.opened != 1 {
+		t.Errorf("file opened %d times, want once", fs.opened)
+	}
+
+	// concurrent requests do not share file
+	first, _ := pool.Open("/seg-0.ts")
+	second, _ := pool.Open("/seg-0.ts")
+	if first == second {
+		t.Error("file in use was opened again")
+	}
+	first.Close()
+	second.Close()
+
+	if fs.opened != 2 {
+		t.Errorf("file opened %d times, want twice", fs.opened)
+	}
+}
+
+func TestFilePoolInvalidate(t *testing.T) {
+	fs := &countingFS{memFS: newMemFS()}
+	_ = fs.WriteFile("/seg-0.ts", []byte("plain"), 0644)
+
+	pool := newFilePool(fs, 4, newFakeClock())
+	readPooled(t, pool, "/seg-0.ts")
+
+	// file used during rewrite is not returned to pool
+	used, _ := pool.Open("/seg-0.ts")
+	if err := pool.WriteFile("/seg-0.ts", []byte("sealed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	used.Close()
+
+	if data := readPooled(t, pool, "/seg-0.ts"); data != "sealed" {
+		t.Errorf("read %q after rewrite", data)
+	}
+
+	if err := pool.Remove("/seg-0.ts"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := pool.Open("/seg-0.ts"); !os.IsNotExist(err) {
+		t.Errorf("removed file opened with %v", err)
+	}
+
+	if len(pool.files) != 0 || pool.idle.Len() != 0 {
+		t.Errorf("pool keeps %d entries and %d files", len(pool.files), pool.idle.Len())
+	}
+}
+
+func TestFilePoolLimits(t *testing.T) {
+	fs := &countingFS{memFS: newMemFS()}
+	_ = fs.WriteFile("/seg-0.ts", []byte("0"), 0644)
+	_ = fs.WriteFile("/seg-1.ts", []byte("1"), 0644)
+
+	clock := newFakeClock()
+	pool := newFilePool(fs, 1, clock)
+
+	// the least recently used file is closed
+	readPooled(t, pool, "/seg-0.ts")
+	readPooled(t, pool, "/seg-1.ts")
+	readPooled(t, pool, "/seg-1.ts")
+	readPooled(t, pool, "/seg-0.ts")
+
+	if fs.opened != 3 {
+		t.Errorf("files opened %d times, want 3", fs.opened)
+	}
+
+	// unused file expires
+	clock.Advance(filePoolIdleTimeout)
+	readPooled(t, pool, "/seg-0.ts")
+
+	if fs.opened != 4 {
+		t.Errorf("files opened %d times, want 4", fs.opened)
+	}
+
+	pool.purge()
+	if pool.idle.Len() != 0 {
+		t.Errorf("purged pool keeps %d files", pool.idle.Len())
+	}
+}
+
+func TestFilePoolOSFile(t *testing.T) {
+	name := filepath.Join(t.TempDir(), "seg-0.ts")
+	if err := os.WriteFile(name, []byte("segment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := newFilePool(OSFileSystem{}, 4, SystemClock{})
+
+	file, err := pool.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if _, ok := osFile(file); !ok {
+		t.Error("pooled file is not served by sendfile")
+	}
+
+	if _, ok := osFile(memFile{}); ok {
+		t.Error("memory file is operating system file")
+	}
+}
+
+// closes files of underlying file system
+type closingFS struct {
+	*memFS
+	closed int
+}
+
+type closingFile struct {
+	File
+	fs *closingFS
+}
+
+func (c *closingFS) Open(name string) (File, error) {
+	file, err := c.memFS.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &closingFile{file, c}, nil
+}
+
+func (f *closingFile) Close() error {
+	f.fs.closed++
+	return f.File.Close()
+}
+
+func TestFilePoolPurge(t *testing.T) {
+	fs := &closingFS{memFS: newMemFS()}
+	_ = fs.WriteFile("/seg-0.ts", []byte("0"), 0644)
+
+	pool := newFilePool(fs, 4, newFakeClock())
+	readPooled(t, pool, "/seg-0.ts")
+
+	// file used while pool is purged is closed when released
+	used, err := pool.Open("/seg-0.ts")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool.purge()
+	used.Close()
+
+	// files opened after purge are not kept either
+	readPooled(t, pool, "/seg-0.ts")
+
+	if fs.closed != 2 || pool.idle.Len() != 0 || len(pool.files) != 0 {
+		t.Errorf("purged pool closed %d files, keeps %d entries and %d files", fs.closed, len(pool.files), pool.idle.Len())
+	}
+}
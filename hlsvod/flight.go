@@ -0,0 +1,126 @@
+package hlsvod
+
+import (
+	"context"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// probes of the same media running at the same time, e.g. when link is
+// shared and sessions of all profiles are created at once
+var probeFlights = newFlightGroup()
+
+type flightCall struct {
+	done    chan struct{}
+	cancel  context.CancelFunc
+	waiters int
+
+	val interface{}
+	err error
+}
+
+// runs only one call of the same key at once, callers of running call wait
+// for its result instead of running it again
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+func newFlightGroup() *flightGroup {
+	return &flightGroup{
+		calls: map[string]*flightCall{},
+	}
+}
+
+// returns result of fn, that is shared by all callers of key, that joined
+// before it finished, shared returns true if call was joined. Call is not
+// bound to context of any caller, it is cancelled when all callers left.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (val interface{}, shared bool, err error) {
+	g.mu.Lock()
+	call, shared := g.calls[key]
+	if shared {
+		call.waiters++
+	} else {
+		callCtx, cancel := context.WithCancel(context.Background())
+		call = &flightCall{
+			done:    make(chan struct{}),
+			cancel:  cancel,
+			waiters: 1,
+		}
+		g.calls[key] = call
+
+		go func() {
+			defer func() {
+				g.mu.Lock()
+				if g.calls[key] == call {
+					delete(g.calls, key)
+				}
+				g.mu.Unlock()
+
+				cancel()
+				close(call.done)
+			}()
+
+			// panic is returned to all callers, so that their sessions fail
+			defer utils.RecoverPanic(log.With().Str("module", "hlsvod").Str("flight", key).Logger(), func(err *PanicError) {
+				call.err = err
+			})
+
+			call.val, call.err = fn(callCtx)
+		}()
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.val, shared, call.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		call.waiters--
+		if call.waiters == 0 {
+			// joining a cancelled call would return its error
+			if g.calls[key] == call {
+				delete(g.calls, key)
+			}
+			call.cancel()
+		}
+		g.mu.Unlock()
+
+		return nil, shared, ctx.Err()
+	}
+}
+
+// probes media, probe running for the same media is joined
+func probeMediaShared(ctx context.Context, transcoder Transcoder, inputFilePath string) (*ProbeMediaData, bool, error) {
+	val, shared, err := probeFlights.do(ctx, "media:"+inputFilePath, func(ctx context.Context) (interface{}, error) {
+		return transcoder.ProbeMedia(ctx, inputFilePath)
+	})
+	if err != nil {
+		return nil, shared, err
+	}
+
+	// every session modifies its own metadata, e.g. keyframes and duration
+	data := *val.(*ProbeMediaData)
+	if data.Video != nil {
+		video := *data.Video
+		data.Video = &video
+	}
+
+	return &data, shared, nil
+}
+
+// probes keyframes of media, probe running for the same media is joined
+func probeVideoShared(ctx context.Context, transcoder Transcoder, inputFilePath string) (*ProbeVideoData, bool, error) {
+	val, shared, err := probeFlights.do(ctx, "video:"+inputFilePath, func(ctx context.Context) (interface{}, error) {
+		return transcoder.ProbeVideo(ctx, inputFilePath)
+	})
+	if err != nil {
+		return nil, shared, err
+	}
+
+	data := *val.(*ProbeVideoData)
+	return &data, shared, nil
+}
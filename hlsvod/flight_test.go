@@ -0,0 +1,223 @@
+package hlsvod
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestFlightGroup(t *testing.T) {
+	g := newFlightGroup()
+
+	var calls int32
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "metadata", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan interface{}, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, _, err := g.do(context.Background(), "media:/media/movie.mp4", fn)
+			if err != nil {
+				t.Error(err)
+			}
+			results <- val
+		}()
+	}
+
+	// all callers joined before call finished
+	for {
+		g.mu.Lock()
+		call := g.calls["media:/media/movie.mp4"]
+		joined := call != nil && call.waiters == 3
+		g.mu.Unlock()
+
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if calls != 1 {
+		t.Errorf("fn called %d times, want 1", calls)
+	}
+
+	for val := range results {
+		if val != "metadata" {
+			t.Errorf("val = %v", val)
+		}
+	}
+
+	// finished call is not reused
+	if _, shared, _ := g.do(context.Background(), "media:/media/movie.mp4", func(ctx context.Context) (interface{}, error) {
+		return nil, nil
+	}); shared {
+		t.Error("finished call should not be joined")
+	}
+}
+
+func TestFlightGroupCancel(t *testing.T) {
+	g := newFlightGroup()
+
+	cancelled := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-ctx.Done()
+		close(cancelled)
+		return nil, ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+
+	errs := make(chan error, 2)
+	go func() {
+		_, _, err := g.do(ctx1, "key", fn)
+		errs <- err
+	}()
+
+	// wait for the first caller to start the call
+	for {
+		g.mu.Lock()
+		_, ok := g.calls["key"]
+		g.mu.Unlock()
+
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	go func() {
+		_, _, err := g.do(ctx2, "key", fn)
+		errs <- err
+	}()
+
+	// wait for the second caller to join it
+	for {
+		g.mu.Lock()
+		joined := g.calls["key"].waiters == 2
+		g.mu.Unlock()
+
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// caller, that started the call, leaves, but call keeps running for other
+	cancel1()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v", err)
+	}
+
+	select {
+	case <-cancelled:
+		t.Fatal("call cancelled while it has waiting caller")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	cancel2()
+	<-errs
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("call not cancelled after all callers left")
+	}
+}
+
+func TestFlightGroupPanic(t *testing.T) {
+	g := newFlightGroup()
+
+	_, _, err := g.do(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		panic("broken probe")
+	})
+
+	var panicErr *PanicError
+	if !errors.As(err, &panicErr) {
+		t.Errorf("err = %v, want panic error", err)
+	}
+}
+
+// blocking transcoder counts probes, that wait until released
+type blockingTranscoder struct {
+	*FakeTranscoder
+	probes  int32
+	release chan struct{}
+}
+
+func (b *blockingTranscoder) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	atomic.AddInt32(&b.probes, 1)
+	<-b.release
+	return b.FakeTranscoder.ProbeMedia(ctx, inputFilePath)
+}
+
+func TestManagerSharedProbe(t *testing.T) {
+	transcoder := &blockingTranscoder{
+		FakeTranscoder: NewFakeTranscoder(time.Minute),
+		release:        make(chan struct{}),
+	}
+
+	managers := []*ManagerCtx{}
+	for _, profile := range []*VideoProfile{
+		{Width: 1280, Height: 720, Bitrate: 2800},
+		{Width: 640, Height: 360, Bitrate: 800},
+	} {
+		managers = append(managers, New(Config{
+			MediaPath:    "/media/shared.mp4",
+			FS:           newMemFS(),
+			Transcoder:   transcoder,
+			VideoProfile: profile,
+		}))
+	}
+
+	errs := make(chan error, len(managers))
+	for _, m := range managers {
+		go func(m *ManagerCtx) {
+			_, err := m.Preload(context.Background())
+			errs <- err
+		}(m)
+	}
+
+	// second session joins probe of the first one
+	for {
+		probeFlights.mu.Lock()
+		call := probeFlights.calls["media:/media/shared.mp4"]
+		joined := call != nil && call.waiters == len(managers)
+		probeFlights.mu.Unlock()
+
+		if joined {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	close(transcoder.release)
+	for range managers {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if transcoder.probes != 1 {
+		t.Errorf("media probed %d times, want 1", transcoder.probes)
+	}
+
+	// sessions do not share their metadata
+	if managers[0].metadata == managers[1].metadata || managers[0].metadata.Video == managers[1].metadata.Video {
+		t.Error("sessions share metadata")
+	}
+}
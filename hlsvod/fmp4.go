@@ -0,0 +1,121 @@
+package hlsvod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+var ErrInitSegment = errors.New("fMP4 segment has no init section")
+
+// name of fMP4 init segment, that is shared by all segments of session
+func (m *ManagerCtx) getInitSegmentName() string {
+	return m.config.SegmentPrefix + "-init.mp4"
+}
+
+// splits fMP4 segment into init section (everything up to and including
+// moov box) and media section (fragments), as every segment written by
+// ffmpeg with empty_moov starts with its own init section
+func splitFragmentedMP4(data []byte) (init, media []byte, err error) {
+	offset := 0
+	for offset+8 <= len(data) {
+		size := uint64(binary.BigEndian.Uint32(data[offset:]))
+		boxType := string(data[offset+4 : offset+8])
+
+		switch size {
+		case 0:
+			// box extends to the end of file
+			size = uint64(len(data) - offset)
+		case 1:
+			// 64-bit size follows box type
+			if offset+16 > len(data) {
+				return nil, nil, fmt.Errorf("%w: truncated %s box", ErrInitSegment, boxType)
+			}
+			size = binary.BigEndian.Uint64(data[offset+8:])
+		}
+
+		if size < 8 || size > uint64(len(data)-offset) {
+			return nil, nil, fmt.Errorf("%w: invalid size of %s box", ErrInitSegment, boxType)
+		}
+
+		offset += int(size)
+		if boxType == "moov" {
+			return data[:offset], data[offset:], nil
+		}
+	}
+
+	return nil, nil, ErrInitSegment
+}
+
+// strips init section from transcoded fMP4 segment, the first one is kept
+// and served as init segment of session
+func (m *ManagerCtx) splitInitSegment(segmentPath string) error {
+	data, err := m.fs.ReadFile(segmentPath)
+	if err != nil {
+		return err
+	}
+
+	init, media, err := splitFragmentedMP4(data)
+	if err != nil {
+		return err
+	}
+
+	if err := m.fs.WriteFile(segmentPath, media, 0644); err != nil {
+		return err
+	}
+
+	m.segmentsMu.Lock()
+	defer m.segmentsMu.Unlock()
+
+	// all segments are encoded with the same settings, so that their init
+	// sections are interchangeable
+	if m.initSegment == nil {
+		m.initSegment = init
+		close(m.initReady)
+	}
+
+	return nil
+}
+
+// returns init segment and channel, that is closed when it becomes available
+func (m *ManagerCtx) getInitSegment() ([]byte, chan struct{}) {
+	m.segmentsMu.RLock()
+	defer m.segmentsMu.RUnlock()
+
+	return m.initSegment, m.initReady
+}
+
+// serves init segment of fMP4 session, it is taken from the first
+// transcoded segment, so that transcode is started if there is none
+func (m *ManagerCtx) serveInitSegment(w http.ResponseWriter, r *http.Request) {
+	init, initReady := m.getInitSegment()
+	if init == nil {
+		if err := m.transcodeFromSegment(0); err != nil {
+			m.logger.Err(err).Msg("unable to transcode init segment")
+			m.httpError(w, r, http.StatusInternalServerError, ErrorTranscode, "unable to transcode", 5*time.Second)
+			return
+		}
+
+		select {
+		case <-initReady:
+			init, _ = m.getInitSegment()
+		case <-m.ctx.Done():
+			m.logger.Warn().Msg("init segment transcode failed because of shutdown")
+			m.httpError(w, r, http.StatusServiceUnavailable, ErrorShutdown, "media not available", 0)
+			return
+		case <-m.clock.After(transcodeTimeout):
+			m.logger.Warn().Msg("init segment transcode timeouted")
+			m.httpError(w, r, http.StatusGatewayTimeout, ErrorTranscodeTimeout, "media timeout", time.Second)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", utils.MediaContentType(r.URL.Path))
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(init))
+}
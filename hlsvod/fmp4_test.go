@@ -0,0 +1,160 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testMP4Box(boxType string, payload []byte) []byte {
+	box := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint32(box, uint32(8+len(payload)))
+	copy(box[4:], boxType)
+	return append(box, payload...)
+}
+
+func testFragmentedMP4(index int) (init, media []byte) {
+	init = append(testMP4Box("ftyp", []byte("iso6")), testMP4Box("moov", []byte("tracks"))...)
+	media = append(testMP4Box("moof", []byte(fmt.Sprintf("fragment %d", index))), testMP4Box("mdat", []byte("samples"))...)
+	return
+}
+
+func TestSplitFragmentedMP4(t *testing.T) {
+	wantInit, wantMedia := testFragmentedMP4(0)
+
+	init, media, err := splitFragmentedMP4(append(wantInit, wantMedia...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(init, wantInit) || !bytes.Equal(media, wantMedia) {
+		t.Errorf("splitFragmentedMP4() = %q, %q, want %q, %q", init, media, wantInit, wantMedia)
+	}
+
+	// box with 64-bit size before moov
+	large := make([]byte, 16)
+	binary.BigEndian.PutUint32(large, 1)
+	copy(large[4:], "free")
+	binary.BigEndian.PutUint64(large[8:], 16)
+
+	data := append(append(large, wantInit...), wantMedia...)
+	if init, _, err := splitFragmentedMP4(data); err != nil || !bytes.Equal(init, data[:16+len(wantInit)]) {
+		t.Errorf("splitFragmentedMP4() with 64-bit box = %q, %v", init, err)
+	}
+
+	// segments without init section and truncated segments
+	for _, data := range [][]byte{
+		wantMedia,
+		wantInit[:len(wantInit)-1],
+		{0, 0, 0, 4, 'f', 't', 'y', 'p'},
+	} {
+		if _, _, err := splitFragmentedMP4(data); !errors.Is(err, ErrInitSegment) {
+			t.Errorf("splitFragmentedMP4(%q) = %v, want %v", data, err, ErrInitSegment)
+		}
+	}
+}
+
+// writes fMP4 segments, that start with init section
+type fragmentedTranscoder struct {
+	*FakeTranscoder
+	fs *memFS
+}
+
+func (f *fragmentedTranscoder) TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error) {
+	if config.SegmentFormat != SegmentFormatFMP4 {
+		return nil, fmt.Errorf("unexpected segment format %q", config.SegmentFormat)
+	}
+
+	segments := make(chan string)
+
+	go func() {
+		defer close(segments)
+
+		for i := 0; i < len(config.SegmentTimes)-1; i++ {
+			index := config.SegmentOffset + i
+			init, media := testFragmentedMP4(index)
+
+			name := fmt.Sprintf("%s-%05d.m4s", config.SegmentPrefix, index)
+			_ = f.fs.WriteFile(path.Join(config.OutputDirPath, name), append(init, media...), 0644)
+
+			select {
+			case segments <- name:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return segments, nil
+}
+
+func TestManagerFragmentedSegments(t *testing.T) {
+	fs := newMemFS()
+	fs.files["/media/video.mp4"] = make([]byte, 100)
+
+	m := New(Config{
+		MediaPath:     "/media/video.mp4",
+		TranscodeDir:  "/transcode",
+		SegmentPrefix: "test",
+		VideoProfile:  &VideoProfile{Width: 1920, Height: 1080, Bitrate: 3500, Codec: CodecHEVC, Format: SegmentFormatFMP4},
+		Transcoder:    &fragmentedTranscoder{NewFakeTranscoder(30 * time.Second), fs},
+		Clock:         newFakeClock(),
+		FS:            fs,
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	w := httptest.NewRecorder()
+	m.ServePlaylist(w, httptest.NewRequest(http.MethodGet, "/test.m3u8?token=x", nil))
+
+	playlist := w.Body.String()
+	if !strings.Contains(playlist, "#EXT-X-VERSION:6") || !strings.Contains(playlist, "\n#EXT-X-MAP:URI=\"test-init.mp4?token=x\"\n") {
+		t.Errorf("playlist should list init segment:\n%s", playlist)
+	}
+
+	if !strings.Contains(playlist, "\ntest-00000.m4s?token=x\n") {
+		t.Errorf("playlist should list fMP4 segments:\n%s", playlist)
+	}
+
+	// init segment is taken from the first transcoded segment
+	wantInit, wantMedia := testFragmentedMP4(0)
+
+	w = httptest.NewRecorder()
+	m.ServeMedia(w, httptest.NewRequest(http.MethodGet, "/test-init.mp4", nil))
+
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), wantInit) {
+		t.Errorf("init segment = %d %q, want %d %q", w.Code, w.Body.Bytes(), http.StatusOK, wantInit)
+	}
+
+	if contentType := w.Header().Get("Content-Type"); contentType != "video/mp4" {
+		t.Errorf("init segment content type = %q, want %q", contentType, "video/mp4")
+	}
+
+	// segments are served without init section
+	w = httptest.NewRecorder()
+	m.ServeMedia(w, httptest.NewRequest(http.MethodGet, "/test-00000.m4s", nil))
+
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), wantMedia) {
+		t.Errorf("segment = %d %q, want %d %q", w.Code, w.Body.Bytes(), http.StatusOK, wantMedia)
+	}
+
+	// MPEG-TS segments are not served by fMP4 session
+	if _, ok := m.parseSegmentIndex("test-00000.ts"); ok {
+		t.Errorf("parseSegmentIndex() should reject MPEG-TS segment of fMP4 session")
+	}
+
+	if _, err := m.SwapProfile(&VideoProfile{Width: 1280, Height: 720, Bitrate: 2000}, nil); !errors.Is(err, ErrSwapFragmented) {
+		t.Errorf("SwapProfile() = %v, want %v", err, ErrSwapFragmented)
+	}
+}
@@ -0,0 +1,110 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// FontExtractor is implemented by transcoders, that are able to extract
+// fonts attached to media, so that burned-in subtitles are rendered with them.
+type FontExtractor interface {
+	ExtractFonts(ctx context.Context, inputFilePath string, fonts []ProbeFontData, outputDirPath string) error
+}
+
+// returns file name of extracted font, name stored in container is not
+// used, because it might contain path separators
+func fontFileName(font ProbeFontData) string {
+	ext := strings.ToLower(filepath.Ext(font.Filename))
+	if ext != ".otf" && ext != ".ttc" {
+		ext = ".ttf"
+	}
+
+	return fmt.Sprintf("font-%d%s", font.Stream, ext)
+}
+
+// ExtractFonts dumps attached fonts to output directory.
+func ExtractFonts(ctx context.Context, ffmpegBinary string, inputFilePath string, fonts []ProbeFontData, outputDirPath string) error {
+	if len(fonts) == 0 {
+		return nil
+	}
+
+	args := []string{
+		"-nostdin",
+		"-loglevel", "error",
+		"-y",
+	}
+
+	for _, font := range fonts {
+		args = append(args,
+			fmt.Sprintf("-dump_attachment:%d", font.Stream),
+			filepath.Join(outputDirPath, fontFileName(font)),
+		)
+	}
+
+	args = append(args, "-i", inputFilePath)
+
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
+	cmd.Stderr = &stderr
+
+	// ffmpeg exits with error, because no output is specified, but
+	// attachments are dumped while opening input
+	_ = cmd.Run()
+
+	for _, font := range fonts {
+		if _, err := os.Stat(filepath.Join(outputDirPath, fontFileName(font))); err != nil {
+			return fmt.Errorf("unable to extract font %q: %s", font.Filename, strings.TrimSpace(stderr.String()))
+		}
+	}
+
+	return nil
+}
+
+// returns subtitles filter burning subtitle stream of input into video
+func subtitlesFilter(inputFilePath string, stream int, fontsDir string) string {
+	filter := fmt.Sprintf("subtitles=filename=%s:si=%d", filterEscape(inputFilePath), stream)
+	if fontsDir != "" {
+		filter += ":fontsdir=" + filterEscape(fontsDir)
+	}
+
+	return filter
+}
+
+// escapes filter option value, that is used in filtergraph
+func filterEscape(value string) string {
+	// option value level
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`, `:`, `\:`).Replace(value)
+
+	// filtergraph level
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`, `[`, `\[`, `]`, `\]`, `,`, `\,`, `;`, `\;`).Replace(value)
+}
+
+// extracts fonts attached to media, so that subtitles are not rendered
+// with fallback fonts, failure is not fatal
+func (m *ManagerCtx) extractFonts(ctx context.Context) {
+	m.fontsDir = ""
+
+	extractor, ok := m.transcoder.(FontExtractor)
+	if !ok || len(m.metadata.Fonts) == 0 {
+		return
+	}
+
+	fontsDir := filepath.Join(m.config.TranscodeDir, "fonts")
+	if err := os.MkdirAll(fontsDir, 0755); err != nil {
+		m.logger.Warn().Err(err).Msg("unable to create fonts directory")
+		return
+	}
+
+	if err := extractor.ExtractFonts(ctx, m.config.MediaPath, m.metadata.Fonts, fontsDir); err != nil {
+		m.logger.Warn().Err(err).Msg("unable to extract fonts, subtitles will use fallback fonts")
+		return
+	}
+
+	m.logger.Info().Int("fonts", len(m.metadata.Fonts)).Msg("extracted attached fonts")
+	m.fontsDir = fontsDir
+}
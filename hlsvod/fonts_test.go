@@ -0,0 +1,47 @@
+package hlsvod
+
+import "testing"
+
+func TestSubtitlesFilter(t *testing.T) {
+	got := subtitlesFilter("/media/It's: a [test], 1;2.mkv", 1, "/tmp/vod-1/fonts")
+	want := `subtitles=filename=/media/It\\\'s\\: a \[test\]\, 1\;2.mkv:si=1:fontsdir=/tmp/vod-1/fonts`
+	if got != want {
+		t.Errorf("subtitlesFilter() = %s, want %s", got, want)
+	}
+}
+
+func TestFontFileName(t *testing.T) {
+	tests := []struct {
+		font ProbeFontData
+		want string
+	}{
+		{ProbeFontData{Stream: 3, Filename: "Arial.TTF"}, "font-3.ttf"},
+		{ProbeFontData{Stream: 4, Filename: "../../etc/passwd"}, "font-4.ttf"},
+		{ProbeFontData{Stream: 5, Filename: "Fancy.otf"}, "font-5.otf"},
+	}
+
+	for _, tt := range tests {
+		if got := fontFileName(tt.font); got != tt.want {
+			t.Errorf("fontFileName(%q) = %q, want %q", tt.font.Filename, got, tt.want)
+		}
+	}
+}
+
+func TestIsFontAttachment(t *testing.T) {
+	tests := []struct {
+		filename string
+		mimetype string
+		want     bool
+	}{
+		{"arial.ttf", "application/x-truetype-font", true},
+		{"font.bin", "application/vnd.ms-opentype", true},
+		{"font.otf", "", true},
+		{"cover.jpg", "image/jpeg", false},
+	}
+
+	for _, tt := range tests {
+		if got := isFontAttachment(tt.filename, tt.mimetype); got != tt.want {
+			t.Errorf("isFontAttachment(%q, %q) = %v, want %v", tt.filename, tt.mimetype, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package hlsvod
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// FileSystem is used by manager to access cache and transcoded segments,
+// it can be replaced in tests so that no real files are needed.
+type FileSystem interface {
+	Open(name string) (File, error)
+	Create(name string) (io.WriteCloser, error)
+	Stat(name string) (fs.FileInfo, error)
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	Remove(name string) error
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+	Free(name string) (uint64, error) // Free space of volume in bytes.
+}
+
+// File is a readable file, that can be served over HTTP.
+type File interface {
+	io.ReadSeekCloser
+	Stat() (fs.FileInfo, error)
+}
+
+// OSFileSystem is a FileSystem using operating system files.
+type OSFileSystem struct{}
+
+func (OSFileSystem) Open(name string) (File, error) {
+	return os.Open(name)
+}
+
+func (OSFileSystem) Create(name string) (io.WriteCloser, error) {
+	return os.Create(name)
+}
+
+func (OSFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFileSystem) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFileSystem) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
+
+func (OSFileSystem) Free(name string) (uint64, error) {
+	return utils.DiskFree(name)
+}
+
+// serves file from manager file system
+func (m *ManagerCtx) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	file, err := m.fs.Open(name)
+	if err != nil {
+		m.httpError(w, r, http.StatusNotFound, ErrorNotFound, "media not found", 0)
+		return
+	}
+	defer file.Close()
+
+	fi, err := file.Stat()
+	if err != nil {
+		m.httpError(w, r, http.StatusInternalServerError, ErrorNotFound, "media not available", 0)
+		return
+	}
+
+	// validator for conditional requests, same as nginx uses
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, fi.ModTime().Unix(), fi.Size()))
+
+	// encrypted segment is decrypted in memory
+	if m.sealedSegments() {
+		data, err := m.openSegment(name)
+		if err != nil {
+			m.logger.Err(err).Str("path", name).Msg("unable to decrypt segment")
+			m.httpError(w, r, http.StatusInternalServerError, ErrorNotFound, "media not available", 0)
+			return
+		}
+
+		http.ServeContent(w, r, fi.Name(), fi.ModTime(), bytes.NewReader(data))
+		return
+	}
+
+	// operating system files are served by sendfile
+	var content io.ReadSeeker = file
+	if f, ok := osFile(file); ok {
+		content = f
+	}
+
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), content)
+}
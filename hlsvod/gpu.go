@@ -0,0 +1,130 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GPUStats is utilization of single GPU polled from vendor tools.
+type GPUStats struct {
+	Encoder     string  `json:"encoder"` // nvenc or vaapi
+	Index       int     `json:"index"`
+	Name        string  `json:"name"`
+	Utilization float64 `json:"utilization"` // in percent, -1 means unknown
+
+	// Utilization of video encode engine in percent, -1 means unknown.
+	EncodeUtilization float64 `json:"encode_utilization"`
+	// Encode sessions of all processes using GPU, -1 means unknown.
+	Sessions int `json:"sessions"`
+}
+
+// queried fields of nvidia-smi in order of columns
+const nvidiaSMIQuery = "index,name,utilization.gpu,utilization.encoder,encoder.stats.sessionCount"
+
+// PollNVIDIA returns utilization and encode sessions of NVIDIA GPUs
+// reported by nvidia-smi.
+func PollNVIDIA(ctx context.Context, nvidiaSMIBinary string) ([]GPUStats, error) {
+	cmd := exec.CommandContext(ctx, nvidiaSMIBinary, "--query-gpu="+nvidiaSMIQuery, "--format=csv,noheader,nounits")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	return parseNvidiaSMI(out)
+}
+
+func parseNvidiaSMI(out []byte) ([]GPUStats, error) {
+	reader := csv.NewReader(bytes.NewReader(out))
+	reader.FieldsPerRecord = 5
+	reader.TrimLeadingSpace = true
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	stats := []GPUStats{}
+	for _, record := range records {
+		index, err := strconv.Atoi(strings.TrimSpace(record[0]))
+		if err != nil {
+			return nil, err
+		}
+
+		stats = append(stats, GPUStats{
+			Encoder:           EncoderNVENC,
+			Index:             index,
+			Name:              strings.TrimSpace(record[1]),
+			Utilization:       parseGPUPercent(record[2]),
+			EncodeUtilization: parseGPUPercent(record[3]),
+			Sessions:          parseGPUSessions(record[4]),
+		})
+	}
+
+	return stats, nil
+}
+
+// values not supported by GPU are reported as [N/A] or [Not Supported]
+func parseGPUPercent(value string) float64 {
+	percent, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return -1
+	}
+
+	return percent
+}
+
+func parseGPUSessions(value string) int {
+	sessions, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return -1
+	}
+
+	return sessions
+}
+
+// PollDRM returns utilization of VAAPI GPUs exposed by kernel drivers in
+// drm class directory (e.g. /sys/class/drm). Only drivers exporting busy
+// percent (amdgpu) report utilization, encode sessions are never known.
+func PollDRM(drmDir string) ([]GPUStats, error) {
+	paths, err := filepath.Glob(filepath.Join(drmDir, "card*", "device", "gpu_busy_percent"))
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(paths)
+
+	stats := []GPUStats{}
+	for _, path := range paths {
+		card := filepath.Base(filepath.Dir(filepath.Dir(path)))
+
+		// connectors (e.g. card0-DP-1) share device of their card
+		index, err := strconv.Atoi(strings.TrimPrefix(card, "card"))
+		if err != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		stats = append(stats, GPUStats{
+			Encoder:           EncoderVAAPI,
+			Index:             index,
+			Name:              card,
+			Utilization:       parseGPUPercent(string(data)),
+			EncodeUtilization: -1,
+			Sessions:          -1,
+		})
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,57 @@
+package hlsvod
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseNvidiaSMI(t *testing.T) {
+	out := []byte("0, NVIDIA GeForce RTX 3060, 35, 62, 3\n1, Tesla T4, 0, [N/A], [Not Supported]\n")
+
+	stats, err := parseNvidiaSMI(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 2 {
+		t.Fatalf("expected 2 GPUs, got %d", len(stats))
+	}
+
+	expected := GPUStats{Encoder: EncoderNVENC, Index: 0, Name: "NVIDIA GeForce RTX 3060", Utilization: 35, EncodeUtilization: 62, Sessions: 3}
+	if stats[0] != expected {
+		t.Fatalf("expected %+v, got %+v", expected, stats[0])
+	}
+
+	if stats[1].EncodeUtilization != -1 || stats[1].Sessions != -1 {
+		t.Fatalf("expected unknown values, got %+v", stats[1])
+	}
+
+	if _, err := parseNvidiaSMI([]byte("0, GPU\n")); err == nil {
+		t.Fatal("expected error of incomplete record")
+	}
+}
+
+func TestPollDRM(t *testing.T) {
+	dir := t.TempDir()
+
+	for card, busy := range map[string]string{"card0": "17\n", "card1-DP-1": "99\n"} {
+		device := filepath.Join(dir, card, "device")
+		if err := os.MkdirAll(device, 0755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(device, "gpu_busy_percent"), []byte(busy), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats, err := PollDRM(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 1 || stats[0].Encoder != EncoderVAAPI || stats[0].Utilization != 17 || stats[0].Sessions != -1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
@@ -0,0 +1,178 @@
+package hlsvod
+
+import (
+	"context"
+	"time"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// how often is growing media checked for new data, if not specified in config
+const growingPollPeriod = 10 * time.Second
+
+// how long must growing media stay unchanged to be considered finished, if not specified in config
+const growingIdleTimeout = time.Minute
+
+// end of growing media in seconds, that is not offered, because it might not be fully written yet
+const growingMargin = 2.0
+
+// shortest last segment of finished media in seconds, shorter remainder is dropped
+const growingMinLastSegment = 0.1
+
+// returns segment breakpoints of growing media, segments have fixed length,
+// so that already offered segments never change when media grows
+func growingBreakpoints(duration, segmentLength float64, finished bool) []float64 {
+	available := duration
+	if !finished {
+		available -= growingMargin
+	}
+
+	breakpoints := []float64{0}
+	for i := 1; float64(i)*segmentLength <= available; i++ {
+		breakpoints = append(breakpoints, float64(i)*segmentLength)
+	}
+
+	if last := breakpoints[len(breakpoints)-1]; finished && duration-last >= growingMinLastSegment {
+		breakpoints = append(breakpoints, duration)
+	}
+
+	return breakpoints
+}
+
+func (m *ManagerCtx) growingPoll() time.Duration {
+	if m.config.GrowingPoll > 0 {
+		return m.config.GrowingPoll
+	}
+
+	return growingPollPeriod
+}
+
+func (m *ManagerCtx) growingIdle() time.Duration {
+	if m.config.GrowingIdle > 0 {
+		return m.config.GrowingIdle
+	}
+
+	return growingIdleTimeout
+}
+
+// returns true, if media was modified recently, so that it is still being written
+func (m *ManagerCtx) mediaGrowing() bool {
+	fi, err := m.fs.Stat(m.config.MediaPath)
+	if err != nil {
+		return false
+	}
+
+	m.growingSize = fi.Size()
+	m.growingChanged = fi.ModTime()
+	return m.clock.Now().Sub(fi.ModTime()) < m.growingIdle()
+}
+
+// watches growing media until it is finished or manager is stopped
+func (m *ManagerCtx) watchGrowing(ctx context.Context) {
+	defer utils.RecoverPanic(m.logger, m.panicked)
+
+	ticker := m.clock.NewTicker(m.growingPoll())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if m.checkGrowing(ctx) {
+				return
+			}
+		}
+	}
+}
+
+// re-probes media, when it grew, and extends playlist, returns true when media is finished
+func (m *ManagerCtx) checkGrowing(ctx context.Context) bool {
+	fi, err := m.fs.Stat(m.config.MediaPath)
+	if err != nil {
+		m.logger.Warn().Err(err).Msg("unable to check growing media")
+		return false
+	}
+
+	now := m.clock.Now()
+	grew := fi.Size() != m.growingSize
+	if grew {
+		m.growingSize = fi.Size()
+		m.growingChanged = now
+	}
+
+	finished := now.Sub(m.growingChanged) >= m.growingIdle()
+	if !grew && !finished {
+		return false
+	}
+
+	metadata, err := m.transcoder.ProbeMedia(ctx, m.config.MediaPath)
+	if err != nil {
+		m.logger.Warn().Err(err).Msg("unable to probe growing media")
+		return false
+	}
+
+	if err := m.extendSegments(metadata.Duration, finished); err != nil {
+		m.logger.Err(err).Msg("unable to extend growing media")
+		return false
+	}
+
+	if finished {
+		m.logger.Info().Str("duration", metadata.Duration.String()).Msg("growing media finished")
+
+		// cache only final metadata
+		if m.config.Cache {
+			m.segmentsMu.RLock()
+			err := m.saveMetadata()
+			m.segmentsMu.RUnlock()
+
+			if err != nil {
+				m.logger.Err(err).Msg("unable to cache metadata")
+			}
+		}
+	}
+
+	return finished
+}
+
+// appends segments available in growing media and updates playlist
+func (m *ManagerCtx) extendSegments(duration time.Duration, finished bool) error {
+	m.transcodeMu.Lock()
+	defer m.transcodeMu.Unlock()
+
+	m.segmentsMu.Lock()
+	defer m.segmentsMu.Unlock()
+
+	breakpoints := growingBreakpoints(duration.Seconds(), m.segmentLength, finished)
+
+	// already offered segments must not disappear
+	if len(breakpoints) < len(m.breakpoints) {
+		breakpoints = m.breakpoints
+	}
+
+	if len(breakpoints) == len(m.breakpoints) && !(finished && m.growing) {
+		return nil
+	}
+
+	count := len(m.breakpoints)
+	m.breakpoints = breakpoints
+	if err := m.loadKeys(); err != nil {
+		return err
+	}
+
+	for i := count; i < len(m.breakpoints); i++ {
+		m.segments[i] = ""
+	}
+
+	m.metadata.Duration = duration
+	m.growing = !finished
+	m.playlist = m.getPlaylist()
+	m.playlistMod = m.clock.Now()
+
+	m.logger.Info().
+		Int("segments", len(m.breakpoints)-1).
+		Bool("finished", finished).
+		Msg("growing media extended")
+
+	return nil
+}
@@ -0,0 +1,102 @@
+package hlsvod
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestGrowingBreakpoints(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration float64
+		finished bool
+		want     []float64
+	}{
+		{"growing keeps margin", 13.5, false, []float64{0, 4, 8}},
+		{"growing without full segment", 3, false, []float64{0}},
+		{"finished adds remainder", 13.5, true, []float64{0, 4, 8, 12, 13.5}},
+		{"finished drops tiny remainder", 12.05, true, []float64{0, 4, 8, 12}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := growingBreakpoints(tt.duration, 4, tt.finished); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("growingBreakpoints() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManagerGrowingMedia(t *testing.T) {
+	clock := newFakeClock()
+	fs := newMemFS()
+	fs.now = clock.Now()
+	fs.files["/media/rec.ts"] = make([]byte, 100)
+
+	transcoder := NewFakeTranscoder(10 * time.Second)
+	m := New(Config{
+		MediaPath:     "/media/rec.ts",
+		SegmentPrefix: "test",
+		Growing:       true,
+		GrowingIdle:   time.Minute,
+		Transcoder:    transcoder,
+		Clock:         clock,
+		FS:            fs,
+	})
+
+	ctx := context.Background()
+	m.growing = m.config.Growing && m.mediaGrowing()
+	if !m.growing {
+		t.Fatal("recently modified media should be growing")
+	}
+
+	if err := m.loadMetadata(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(m.playlist, "#EXT-X-PLAYLIST-TYPE:EVENT") || strings.Contains(m.playlist, "#EXT-X-ENDLIST") {
+		t.Errorf("growing media should have open event playlist:\n%s", m.playlist)
+	}
+
+	if got := strings.Count(m.playlist, "#EXTINF"); got != 2 {
+		t.Errorf("playlist has %d segments, want 2", got)
+	}
+
+	// media grows
+	clock.Advance(10 * time.Second)
+	fs.files["/media/rec.ts"] = make([]byte, 200)
+	transcoder.Duration = 21 * time.Second
+
+	if m.checkGrowing(ctx) {
+		t.Fatal("media should not be finished yet")
+	}
+
+	if got := strings.Count(m.playlist, "#EXTINF"); got != 4 {
+		t.Errorf("playlist has %d segments, want 4", got)
+	}
+
+	if _, ok := m.segments[4]; !ok {
+		t.Errorf("new segments were not prepared for transcoding")
+	}
+
+	// media stops growing
+	clock.Advance(time.Minute)
+	if !m.checkGrowing(ctx) {
+		t.Fatal("media should be finished")
+	}
+
+	if !strings.Contains(m.playlist, "#EXT-X-PLAYLIST-TYPE:VOD") || !strings.HasSuffix(m.playlist, "#EXT-X-ENDLIST") {
+		t.Errorf("finished media should have vod playlist:\n%s", m.playlist)
+	}
+
+	if got := strings.Count(m.playlist, "#EXTINF"); got != 6 {
+		t.Errorf("playlist has %d segments, want 6", got)
+	}
+}
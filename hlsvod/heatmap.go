@@ -0,0 +1,147 @@
+package hlsvod
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"sort"
+	"time"
+)
+
+const heatmapFileSuffix = ".go-transcode-heatmap"
+
+// how long it takes for segment popularity to drop by half
+const heatmapHalfLife = 10 * time.Minute
+
+// how many segments from the beginning are never evicted
+const heatmapKeepHead = 3
+
+type SegmentHeat struct {
+	Requests    int       `json:"requests"`
+	LastRequest time.Time `json:"last_request"`
+}
+
+// returns segment popularity, decreasing with time since last request
+func (h SegmentHeat) score(now time.Time) float64 {
+	age := now.Sub(h.LastRequest).Seconds()
+	return float64(h.Requests) / (1 + age/heatmapHalfLife.Seconds())
+}
+
+func (m *ManagerCtx) heatmapRecord(index int) {
+	m.heatmapMu.Lock()
+	defer m.heatmapMu.Unlock()
+
+	heat := m.heatmap[index]
+	heat.Requests++
+	heat.LastRequest = m.clock.Now()
+	m.heatmap[index] = heat
+	m.heatmapLast = index
+}
+
+func (m *ManagerCtx) heatmapGet(index int) SegmentHeat {
+	m.heatmapMu.RLock()
+	defer m.heatmapMu.RUnlock()
+
+	return m.heatmap[index]
+}
+
+// load heatmap from cache, if enabled
+func (m *ManagerCtx) heatmapLoad() {
+	m.heatmapMu.Lock()
+	defer m.heatmapMu.Unlock()
+
+	m.heatmap = map[int]SegmentHeat{}
+	m.heatmapLast = 0
+
+	if !m.config.Cache {
+		return
+	}
+
+	data, err := m.getCacheFile(heatmapFileSuffix)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			m.logger.Err(err).Msg("unable to load heatmap from cache")
+		}
+		return
+	}
+
+	if err := json.Unmarshal(data, &m.heatmap); err != nil || m.heatmap == nil {
+		m.logger.Err(err).Msg("heatmap unmarshalling returned error, replacing")
+		m.heatmap = map[int]SegmentHeat{}
+	}
+}
+
+// save heatmap to cache, if enabled
+func (m *ManagerCtx) heatmapSave() {
+	if !m.config.Cache {
+		return
+	}
+
+	// heatmap is marshalled under lock, file is written without holding it
+	m.heatmapMu.RLock()
+	if m.heatmap == nil {
+		m.heatmapMu.RUnlock()
+		return
+	}
+	data, err := json.Marshal(m.heatmap)
+	m.heatmapMu.RUnlock()
+
+	if err == nil {
+		err = m.saveCacheFile(heatmapFileSuffix, data)
+	}
+
+	if err != nil {
+		m.logger.Err(err).Msg("unable to save heatmap to cache")
+	}
+}
+
+// remove least popular transcoded segments, if there are more than allowed,
+// beginning of the file and segments around last played one are always kept
+func (m *ManagerCtx) heatmapEvict() {
+	if m.config.SegmentsMax <= 0 {
+		return
+	}
+
+	now := m.clock.Now()
+
+	m.heatmapMu.RLock()
+	last := m.heatmapLast
+	m.heatmapMu.RUnlock()
+
+	m.segmentsMu.RLock()
+	candidates := []int{}
+	transcoded := 0
+	for index, segmentName := range m.segments {
+		if segmentName == "" {
+			continue
+		}
+
+		transcoded++
+		if index < heatmapKeepHead || (index >= last-1 && index <= last+m.segmentBufferMax) {
+			continue
+		}
+
+		candidates = append(candidates, index)
+	}
+	m.segmentsMu.RUnlock()
+
+	evict := transcoded - m.config.SegmentsMax
+	if evict <= 0 {
+		return
+	}
+
+	// least popular first
+	sort.Slice(candidates, func(i, j int) bool {
+		return m.heatmapGet(candidates[i]).score(now) < m.heatmapGet(candidates[j]).score(now)
+	})
+
+	if evict > len(candidates) {
+		evict = len(candidates)
+	}
+
+	for _, index := range candidates[:evict] {
+		m.removeSegment(index)
+	}
+
+	m.logger.Debug().Int("evicted", evict).Msg("evicted least popular segments")
+}
@@ -0,0 +1,60 @@
+package hlsvod
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// printf-like number in file name of image sequence, e.g. %d or %04d
+var imageSequenceRegex = regexp.MustCompile(`%0?[0-9]*d`)
+
+// codecs of still images, single image of them is not transcoded
+var stillImageCodecs = map[string]bool{
+	"mjpeg": true,
+	"png":   true,
+	"bmp":   true,
+	"tiff":  true,
+	"webp":  true,
+}
+
+// ImageSequence returns true, if input path is pattern of numbered images,
+// e.g. snapshots/frame-%04d.jpg for timelapse or camera snapshot archives.
+func ImageSequence(inputFilePath string) bool {
+	return imageSequenceRegex.MatchString(filepath.Base(inputFilePath))
+}
+
+// ImageAnimation returns true, if input is animated image, e.g. GIF or APNG.
+func ImageAnimation(inputFilePath string) bool {
+	switch strings.ToLower(filepath.Ext(inputFilePath)) {
+	case ".gif", ".apng":
+		return true
+	}
+
+	return false
+}
+
+// ImageSequenceExists returns true, if at least one image of sequence exists.
+func ImageSequenceExists(inputFilePath string) bool {
+	dir, name := filepath.Split(inputFilePath)
+	pattern := imageSequenceRegex.ReplaceAllString(name, "[0-9]*")
+
+	matches, err := filepath.Glob(filepath.Join(dir, pattern))
+	return err == nil && len(matches) > 0
+}
+
+// returns input options of ffmpeg and ffprobe, image sequences are read at
+// given frame rate, 0 means demuxer default (25 fps)
+func imageInputArgs(inputFilePath string, framerate float64) []string {
+	if !ImageSequence(inputFilePath) {
+		return nil
+	}
+
+	args := []string{"-f", "image2"}
+	if framerate > 0 {
+		args = append(args, "-framerate", fmt.Sprintf("%g", framerate))
+	}
+
+	return args
+}
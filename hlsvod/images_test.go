@@ -0,0 +1,66 @@
+package hlsvod
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestImageInputs(t *testing.T) {
+	tests := []struct {
+		path      string
+		sequence  bool
+		animation bool
+	}{
+		{"/media/timelapse/frame-%04d.jpg", true, false},
+		{"/media/snapshots/%d.png", true, false},
+		{"/media/100%/movie.mp4", false, false},
+		{"/media/%04d/movie.mp4", false, false},
+		{"/media/funny.GIF", false, true},
+		{"/media/loader.apng", false, true},
+	}
+
+	for _, tt := range tests {
+		if got := ImageSequence(tt.path); got != tt.sequence {
+			t.Errorf("ImageSequence(%q) = %v, want %v", tt.path, got, tt.sequence)
+		}
+		if got := ImageAnimation(tt.path); got != tt.animation {
+			t.Errorf("ImageAnimation(%q) = %v, want %v", tt.path, got, tt.animation)
+		}
+	}
+}
+
+func TestImageSequenceExists(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "frame-0001.jpg"), []byte{}, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !ImageSequenceExists(filepath.Join(dir, "frame-%04d.jpg")) {
+		t.Errorf("sequence with existing image not found")
+	}
+
+	if ImageSequenceExists(filepath.Join(dir, "other-%04d.jpg")) {
+		t.Errorf("sequence without images found")
+	}
+}
+
+func TestImageInputArgs(t *testing.T) {
+	tests := []struct {
+		path      string
+		framerate float64
+		want      []string
+	}{
+		{"frame-%04d.jpg", 0, []string{"-f", "image2"}},
+		{"frame-%04d.jpg", 0.5, []string{"-f", "image2", "-framerate", "0.5"}},
+		{"funny.gif", 10, nil},
+		{"movie.mp4", 10, nil},
+	}
+
+	for _, tt := range tests {
+		if got := imageInputArgs(tt.path, tt.framerate); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("imageInputArgs(%q, %g) = %v, want %v", tt.path, tt.framerate, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package hlsvod
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// encryption methods of HLS segments
+const (
+	EncryptionAES128    = "AES-128"
+	EncryptionSampleAES = "SAMPLE-AES"
+)
+
+// Key is used to encrypt segments, it is announced in playlist using its URI.
+type Key struct {
+	ID     string
+	Method string // AES-128 or SAMPLE-AES
+	Key    []byte // 16 bytes
+	IV     []byte // 16 bytes, if nil, segment sequence number is used
+	URI    string
+	Format string // e.g. com.apple.streamingkeydelivery, empty means identity
+}
+
+// KeyProvider returns keys for segments, keys are rotated by returning
+// different keys for different segments. Key server (e.g. FairPlay) can
+// be plugged in by implementing this interface.
+type KeyProvider interface {
+	SegmentKey(session string, index int) (*Key, error)
+}
+
+// KeyReleaser is implemented by key providers, that keep keys of sessions,
+// keys of session are released, when it is stopped.
+type KeyReleaser interface {
+	ReleaseKeys(session string)
+}
+
+// SegmentEncrypter encrypts transcoded segment file in place.
+type SegmentEncrypter func(segmentPath string, key *Key, index int) error
+
+// RotatingKeyProvider generates random AES-128 keys, that are rotated every
+// period of segments. Generated keys are kept in memory and can be served
+// using Key function.
+type RotatingKeyProvider struct {
+	Period    int    // Number of segments encrypted by the same key, 0 means single key per session.
+	URIFormat string // Key URI with %s placeholder for key ID.
+
+	OnRotate func(session string, key *Key) // Called for every generated key, e.g. to register it at key server.
+
+	mu       sync.RWMutex
+	keys     map[string]*Key         // map of key IDs and keys
+	sessions map[string]map[int]*Key // map of sessions, their periods and keys
+}
+
+func NewRotatingKeyProvider(period int, uriFormat string) *RotatingKeyProvider {
+	return &RotatingKeyProvider{
+		Period:    period,
+		URIFormat: uriFormat,
+
+		keys:     map[string]*Key{},
+		sessions: map[string]map[int]*Key{},
+	}
+}
+
+func (p *RotatingKeyProvider) SegmentKey(session string, index int) (*Key, error) {
+	period := 0
+	if p.Period > 0 {
+		period = index / p.Period
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	periods, ok := p.sessions[session]
+	if !ok {
+		periods = map[int]*Key{}
+		p.sessions[session] = periods
+	}
+
+	if key, ok := periods[period]; ok {
+		return key, nil
+	}
+
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+
+	id := hex.EncodeToString(buf[:16])
+	key := &Key{
+		ID:     id,
+		Method: EncryptionAES128,
+		Key:    buf[16:],
+		URI:    fmt.Sprintf(p.URIFormat, id),
+	}
+
+	p.keys[id] = key
+	periods[period] = key
+
+	if p.OnRotate != nil {
+		p.OnRotate(session, key)
+	}
+
+	return key, nil
+}
+
+// forgets keys of stopped session, they are not served anymore
+func (p *RotatingKeyProvider) ReleaseKeys(session string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, key := range p.sessions[session] {
+		delete(p.keys, key.ID)
+	}
+
+	delete(p.sessions, session)
+}
+
+// returns generated key by its ID
+func (p *RotatingKeyProvider) Key(id string) (*Key, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	key, ok := p.keys[id]
+	return key, ok
+}
+
+// returns IV of segment, segment sequence number is used if key has no IV
+func (k *Key) segmentIV(index int) []byte {
+	if k.IV != nil {
+		return k.IV
+	}
+
+	iv := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(iv[8:], uint64(index))
+	return iv
+}
+
+// returns EXT-X-KEY playlist tag
+func (k *Key) playlistTag() string {
+	attrs := []string{
+		"METHOD=" + k.Method,
+		fmt.Sprintf("URI=%q", k.URI),
+	}
+
+	if k.IV != nil {
+		attrs = append(attrs, "IV=0x"+hex.EncodeToString(k.IV))
+	}
+
+	if k.Format != "" {
+		attrs = append(attrs,
+			fmt.Sprintf("KEYFORMAT=%q", k.Format),
+			`KEYFORMATVERSIONS="1"`,
+		)
+	}
+
+	return "#EXT-X-KEY:" + strings.Join(attrs, ",")
+}
+
+// encrypts whole segment using AES-128-CBC with PKCS7 padding, SAMPLE-AES
+// requires encrypting individual samples, that must be done by custom encrypter
+func EncryptSegmentAES128(segmentPath string, key *Key, index int) error {
+	if key.Method != EncryptionAES128 {
+		return fmt.Errorf("encryption method %s is not supported by built-in encrypter", key.Method)
+	}
+
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(segmentPath)
+	if err != nil {
+		return err
+	}
+
+	// PKCS7 padding
+	padding := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(data, bytes.Repeat([]byte{byte(padding)}, padding)...)
+
+	cipher.NewCBCEncrypter(block, key.segmentIV(index)).CryptBlocks(data, data)
+
+	// replace segment atomically, so that it is never served half written
+	tmpPath := filepath.Join(filepath.Dir(segmentPath), "."+filepath.Base(segmentPath)+".enc")
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, segmentPath)
+}
@@ -0,0 +1,99 @@
+package hlsvod
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRotatingKeyProvider(t *testing.T) {
+	p := NewRotatingKeyProvider(3, "/keys/%s")
+
+	rotated := 0
+	p.OnRotate = func(session string, key *Key) {
+		rotated++
+	}
+
+	keys := []*Key{}
+	for i := 0; i < 7; i++ {
+		key, err := p.SegmentKey("session", i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+	}
+
+	if keys[0] != keys[2] || keys[2] == keys[3] || keys[3] != keys[5] || keys[5] == keys[6] {
+		t.Errorf("keys are not rotated every 3 segments")
+	}
+
+	if rotated != 3 {
+		t.Errorf("rotated %d times, want 3", rotated)
+	}
+
+	if key, ok := p.Key(keys[3].ID); !ok || key != keys[3] {
+		t.Errorf("key %s not found", keys[3].ID)
+	}
+
+	if want := "/keys/" + keys[0].ID; keys[0].URI != want {
+		t.Errorf("key URI = %s, want %s", keys[0].URI, want)
+	}
+
+	other, err := p.SegmentKey("other", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// keys of stopped session are forgotten, other sessions keep theirs
+	p.ReleaseKeys("session")
+	for _, key := range keys {
+		if _, ok := p.Key(key.ID); ok {
+			t.Errorf("key %s of released session found", key.ID)
+		}
+	}
+
+	if _, ok := p.Key(other.ID); !ok {
+		t.Errorf("key %s of other session not found", other.ID)
+	}
+
+	if len(p.sessions) != 1 || len(p.keys) != 1 {
+		t.Errorf("provider keeps %d sessions and %d keys, want 1 and 1", len(p.sessions), len(p.keys))
+	}
+}
+
+func TestEncryptSegmentAES128(t *testing.T) {
+	segmentPath := filepath.Join(t.TempDir(), "test-00001.ts")
+	plain := bytes.Repeat([]byte{0x47}, 188*3)
+	if err := os.WriteFile(segmentPath, plain, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := NewRotatingKeyProvider(0, "%s").SegmentKey("session", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := EncryptSegmentAES128(segmentPath, key, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(segmentPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, err := aes.NewCipher(key.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cipher.NewCBCDecrypter(block, key.segmentIV(1)).CryptBlocks(data, data)
+
+	padding := int(data[len(data)-1])
+	if !bytes.Equal(data[:len(data)-padding], plain) {
+		t.Errorf("decrypted segment does not match")
+	}
+}
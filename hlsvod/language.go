@@ -0,0 +1,171 @@
+package hlsvod
+
+import (
+	"strings"
+)
+
+// ISO 639-1 codes of common languages and their ISO 639-2 codes used in
+// media tags, bibliographic code first where it differs
+var languageCodes = map[string][]string{
+	"ar": {"ara"},
+	"bg": {"bul"},
+	"ca": {"cat"},
+	"cs": {"cze", "ces"},
+	"da": {"dan"},
+	"de": {"ger", "deu"},
+	"el": {"gre", "ell"},
+	"en": {"eng"},
+	"es": {"spa"},
+	"et": {"est"},
+	"fa": {"per", "fas"},
+	"fi": {"fin"},
+	"fr": {"fre", "fra"},
+	"he": {"heb"},
+	"hi": {"hin"},
+	"hr": {"hrv"},
+	"hu": {"hun"},
+	"id": {"ind"},
+	"is": {"ice", "isl"},
+	"it": {"ita"},
+	"ja": {"jpn"},
+	"ko": {"kor"},
+	"lt": {"lit"},
+	"lv": {"lav"},
+	"nl": {"dut", "nld"},
+	"no": {"nor"},
+	"pl": {"pol"},
+	"pt": {"por"},
+	"ro": {"rum", "ron"},
+	"ru": {"rus"},
+	"sk": {"slo", "slk"},
+	"sl": {"slv"},
+	"sr": {"srp"},
+	"sv": {"swe"},
+	"th": {"tha"},
+	"tr": {"tur"},
+	"uk": {"ukr"},
+	"vi": {"vie"},
+	"zh": {"chi", "zho"},
+}
+
+// English names of languages, that some muxers write instead of codes
+var languageNames = map[string]string{
+	"arabic":     "ar",
+	"bulgarian":  "bg",
+	"catalan":    "ca",
+	"czech":      "cs",
+	"danish":     "da",
+	"german":     "de",
+	"greek":      "el",
+	"english":    "en",
+	"spanish":    "es",
+	"estonian":   "et",
+	"persian":    "fa",
+	"finnish":    "fi",
+	"french":     "fr",
+	"hebrew":     "he",
+	"hindi":      "hi",
+	"croatian":   "hr",
+	"hungarian":  "hu",
+	"indonesian": "id",
+	"icelandic":  "is",
+	"italian":    "it",
+	"japanese":   "ja",
+	"korean":     "ko",
+	"lithuanian": "lt",
+	"latvian":    "lv",
+	"dutch":      "nl",
+	"norwegian":  "no",
+	"polish":     "pl",
+	"portuguese": "pt",
+	"romanian":   "ro",
+	"russian":    "ru",
+	"slovak":     "sk",
+	"slovenian":  "sl",
+	"serbian":    "sr",
+	"swedish":    "sv",
+	"thai":       "th",
+	"turkish":    "tr",
+	"ukrainian":  "uk",
+	"vietnamese": "vi",
+	"chinese":    "zh",
+}
+
+// NormalizeLanguage returns BCP-47 tag of language tag found in media, e.g.
+// eng, en and english are all en, and en_us is en-US. ISO 639-2 codes without
+// ISO 639-1 equivalent are kept. Undetermined or malformed languages are
+// empty. Overrides map lowercase media tags to tags of mislabeled libraries.
+func NormalizeLanguage(tag string, overrides map[string]string) string {
+	tag = strings.TrimSpace(tag)
+	if override, ok := overrides[strings.ToLower(tag)]; ok {
+		return NormalizeLanguage(override, nil)
+	}
+
+	subtags := strings.FieldsFunc(tag, func(r rune) bool {
+		return r == '-' || r == '_'
+	})
+
+	if len(subtags) == 0 {
+		return ""
+	}
+
+	primary := strings.ToLower(subtags[0])
+	switch primary {
+	case "und", "unknown", "none":
+		return ""
+	}
+
+	if code, ok := languageNames[primary]; ok {
+		primary = code
+	} else if len(primary) == 3 {
+		for code, codes := range languageCodes {
+			for _, c := range codes {
+				if c == primary {
+					primary = code
+				}
+			}
+		}
+	}
+
+	// primary language consists of 2 or 3 letters
+	if len(primary) < 2 || len(primary) > 3 || strings.Trim(primary, "abcdefghijklmnopqrstuvwxyz") != "" {
+		return ""
+	}
+
+	normalized := []string{primary}
+	for _, subtag := range subtags[1:] {
+		if !languageSubtag(subtag) {
+			return ""
+		}
+
+		switch {
+		case len(subtag) == 4 && !strings.ContainsAny(subtag, "0123456789"):
+			// script, e.g. Hant
+			subtag = strings.ToUpper(subtag[:1]) + strings.ToLower(subtag[1:])
+		case len(subtag) == 2, len(subtag) == 3 && strings.Trim(subtag, "0123456789") == "":
+			// region, e.g. US or 419
+			subtag = strings.ToUpper(subtag)
+		default:
+			subtag = strings.ToLower(subtag)
+		}
+
+		normalized = append(normalized, subtag)
+	}
+
+	return strings.Join(normalized, "-")
+}
+
+// returns true if subtag consists of at most 8 letters or digits
+func languageSubtag(subtag string) bool {
+	if len(subtag) > 8 {
+		return false
+	}
+
+	for _, r := range subtag {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,48 @@
+package hlsvod
+
+import "testing"
+
+func TestNormalizeLanguage(t *testing.T) {
+	tests := map[string]string{
+		"en":           "en",
+		"eng":          "en",
+		"English":      "en",
+		"ger":          "de",
+		"deu":          "de",
+		"en_us":        "en-US",
+		"EN-gb":        "en-GB",
+		"zh-hant-tw":   "zh-Hant-TW",
+		"es-419":       "es-419",
+		"fil":          "fil",
+		"und":          "",
+		"":             "",
+		"  ":           "",
+		"English (US)": "",
+		"e":            "",
+	}
+
+	for tag, want := range tests {
+		if got := NormalizeLanguage(tag, nil); got != want {
+			t.Errorf("NormalizeLanguage(%q) = %q, want %q", tag, got, want)
+		}
+	}
+}
+
+func TestNormalizeLanguageOverrides(t *testing.T) {
+	overrides := map[string]string{
+		"und": "en",
+		"cze": "slk", // mislabeled library
+	}
+
+	if got := NormalizeLanguage("und", overrides); got != "en" {
+		t.Errorf("override of und = %q", got)
+	}
+
+	if got := NormalizeLanguage("CZE", overrides); got != "sk" {
+		t.Errorf("override of CZE = %q", got)
+	}
+
+	if got := NormalizeLanguage("fre", overrides); got != "fr" {
+		t.Errorf("tag without override = %q", got)
+	}
+}
@@ -0,0 +1,115 @@
+package hlsvod
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+)
+
+// LazyManager defers start of wrapped manager until the first playlist or
+// segment request (or warming), so that manager, that is created but never
+// played, does not probe media nor load its cache.
+type LazyManager struct {
+	Manager
+
+	mu      sync.Mutex
+	started bool
+}
+
+func NewLazyManager(manager Manager) *LazyManager {
+	return &LazyManager{
+		Manager: manager,
+	}
+}
+
+// Start is deferred, wrapped manager is started upon the first request.
+func (l *LazyManager) Start() error {
+	return nil
+}
+
+// Started returns true, if wrapped manager was started.
+func (l *LazyManager) Started() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.started
+}
+
+// starts wrapped manager, if it was not started yet
+func (l *LazyManager) start() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.started {
+		return nil
+	}
+
+	if err := l.Manager.Start(); err != nil {
+		return err
+	}
+
+	l.started = true
+	return nil
+}
+
+// Stop stops wrapped manager also if it was not started, so that session
+// stop is reported, next request starts it again.
+func (l *LazyManager) Stop() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.Manager.Stop()
+	l.started = false
+}
+
+func (l *LazyManager) Warm(ctx context.Context, ranges []WarmRange) error {
+	if err := l.start(); err != nil {
+		return err
+	}
+
+	return l.Manager.Warm(ctx, ranges)
+}
+
+// WaitReady starts wrapped manager, if it was not started yet, and waits
+// until it is ready.
+func (l *LazyManager) WaitReady(ctx context.Context) error {
+	if err := l.start(); err != nil {
+		return err
+	}
+
+	return l.Manager.WaitReady(ctx)
+}
+
+func (l *LazyManager) ServePlaylist(w http.ResponseWriter, r *http.Request) {
+	if err := l.start(); err != nil {
+		http.Error(w, "500 unable to start manager", http.StatusInternalServerError)
+		return
+	}
+
+	l.Manager.ServePlaylist(w, r)
+}
+
+func (l *LazyManager) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	if err := l.start(); err != nil {
+		http.Error(w, "500 unable to start manager", http.StatusInternalServerError)
+		return
+	}
+
+	l.Manager.ServeMedia(w, r)
+}
+
+// ServeStats does not start manager, manager, that was not started, has no
+// segments yet.
+func (l *LazyManager) ServeStats(w http.ResponseWriter, r *http.Request) {
+	if !l.Started() {
+		l.Heartbeat()
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode([]SegmentStats{})
+		return
+	}
+
+	l.Manager.ServeStats(w, r)
+}
@@ -1,13 +1,16 @@
 package hlsvod
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha1"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"net/http"
 	"os"
-	"path"
+	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -16,17 +19,43 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/internal/utils"
 )
 
-// how long can it take for transcode to be ready
+// how long can it take for transcode to be ready, if not specified in config
 const readyTimeout = 80 * time.Second
 
+// maximum ready timeout, that can be requested by client
+const readyTimeoutMax = 5 * time.Minute
+
 // how long can it take for transcode to return first data
 const transcodeTimeout = 10 * time.Second
 
+// how often should be cleanup called
+const cleanupPeriod = 4 * time.Second
+
+// how long must be session idle to stop transcoding ahead
+const lookaheadIdleTimeout = 30 * time.Second
+
+// measured segment duration must differ at least by this to update playlist
+const playlistDurationTolerance = 0.001
+
+// ErrStoppedBeforeReady is returned by WaitReady, when session is stopped
+// while it is starting.
+var ErrStoppedBeforeReady = errors.New("session stopped before getting ready")
+
+// how many times can be failed segment transcode retried, last retry uses fallback settings
+const segmentRetries = 2
+
 type ManagerCtx struct {
-	logger zerolog.Logger
-	config Config
+	logger     zerolog.Logger
+	config     Config
+	transcoder Transcoder
+	segmenter  Transcoder // passthrough of MPEG-TS, falls back to transcoder
+	clock      Clock
+	fs         FileSystem
 
 	segmentLength    float64
 	segmentOffset    float64
@@ -34,28 +63,101 @@ type ManagerCtx struct {
 	segmentBufferMax int // maximum segments to be transcoded at once
 
 	ready     bool
+	readyErr  error // reason, why session failed to get ready
 	readyMu   sync.RWMutex
 	readyChan chan struct{}
+	stopped   bool // OnStop was called since start
 
 	metadata    *ProbeMediaData
-	playlist    string    // m3u8 playlist string
+	passthrough bool      // streams are copied without encoding
+	burnSubs    bool      // subtitle stream is rendered into video
+	fontsDir    string    // extracted fonts used by burned subtitles
+	playlist    string    // m3u8 playlist string, updated with measured durations
+	playlistMod time.Time // last modification of playlist
 	breakpoints []float64 // list of breakpoints for segments
-
-	segments   map[int]string // map of segments and their filename
-	segmentsMu sync.RWMutex
+	keys        []*Key    // list of encryption keys for segments
+
+	growing        bool      // media is still being written, playlist is extended as it grows
+	growingSize    int64     // last seen size of growing media
+	growingChanged time.Time // last time, when growing media changed
+	event          bool      // playlist is extended as segments are transcoded in order
+	eventSegments  int       // segments listed in event playlist, that were transcoded in order
+
+	segments         map[int]string  // map of segments and their filename
+	segmentSizes     map[int]int64   // map of segments and their encoded size
+	segmentDurations map[int]float64 // map of segments and their measured duration
+	segmentGaps      map[int]bool    // segments, that failed to transcode and are listed as gaps
+	segmentsMemory   []int           // segments in memory dir, from the oldest
+	segmentVolumes   map[int]string  // map of segments and transcode dir, where they are stored
+	segmentsWriting  map[int]string  // map of segments being transcoded and their path
+	segmentReadyAt   time.Time       // last time, when segment became ready
+	segmentInterval  time.Duration   // smoothed time between ready segments
+	initSegment      []byte          // init section of fMP4 segments, taken from the first transcoded one
+	initReady        chan struct{}   // closed, when init segment is available
+	segmentsMu       sync.RWMutex
 
 	segmentQueue   map[int]chan struct{} // map of segments and signaling channel for finished transcoding
+	profileSwaps   []segmentProfile      // profiles swapped while running, by their first segment
 	segmentQueueMu sync.RWMutex
 
+	segmentFailures   map[int]int // map of segments and their failed transcode attempts
+	segmentFailuresMu sync.Mutex
+
+	sourceSize    int64     // size of source media, when session started
+	sourceModTime time.Time // modification time of source media, when session started
+	sourceChanged bool      // source media was replaced or truncated during session
+	sourceMu      sync.Mutex
+
+	transcodeMu sync.Mutex
+
+	volumeNext int // next volume used by round-robin placement
+	volumeMu   sync.Mutex
+
+	heatmap     map[int]SegmentHeat // map of segments and their popularity
+	heatmapLast int                 // last requested segment
+	heatmapMu   sync.RWMutex
+
+	lastRequest   time.Time
+	lastRequestMu sync.RWMutex
+
+	lookaheadCtx    context.Context
+	lookaheadCancel context.CancelFunc
+	lookaheadMu     sync.Mutex
+
 	ctx    context.Context
 	cancel context.CancelFunc
 }
 
 func New(config Config) *ManagerCtx {
 	ctx, cancel := context.WithCancel(context.Background())
+
+	transcoder := config.Transcoder
+	if transcoder == nil {
+		transcoder = NewFFmpegTranscoder(config.FFmpegBinary, config.FFprobeBinary)
+	}
+
+	clock := config.Clock
+	if clock == nil {
+		clock = SystemClock{}
+	}
+
+	fs := config.FS
+	if fs == nil {
+		fs = OSFileSystem{}
+	}
+
+	// hot segments are served without opening them again
+	if config.OpenFiles > 0 {
+		fs = newFilePool(fs, config.OpenFiles, clock)
+	}
+
 	return &ManagerCtx{
-		logger: log.With().Str("module", "hlsvod").Str("submodule", "manager").Logger(),
-		config: config,
+		logger:     log.With().Str("module", "hlsvod").Str("submodule", "manager").Logger(),
+		config:     config,
+		transcoder: transcoder,
+		segmenter:  NewTSSegmenter(transcoder),
+		clock:      clock,
+		fs:         fs,
 
 		segmentLength:    4,
 		segmentOffset:    1,
@@ -76,9 +178,22 @@ func (m *ManagerCtx) readyReset() {
 	defer m.readyMu.Unlock()
 
 	m.ready = false
+	m.readyErr = nil
 	m.readyChan = make(chan struct{})
 }
 
+// calls OnStop, if it was not called since start
+func (m *ManagerCtx) fireStop(err error) {
+	m.readyMu.Lock()
+	stopped := m.stopped
+	m.stopped = true
+	m.readyMu.Unlock()
+
+	if !stopped && m.config.OnStop != nil {
+		m.config.OnStop(err)
+	}
+}
+
 func (m *ManagerCtx) readyDone() {
 	m.readyMu.Lock()
 	defer m.readyMu.Unlock()
@@ -90,6 +205,34 @@ func (m *ManagerCtx) readyDone() {
 	m.readyChan = nil
 }
 
+// fails session because of panic recovered in its goroutine, transcodes are
+// cancelled and waiting requests woken up, so that they do not time out
+func (m *ManagerCtx) panicked(err *PanicError) {
+	m.publishTranscodeFailed(err)
+	m.readyFail(err)
+	m.cancel()
+	m.fireStop(err)
+}
+
+// wakes up waiting requests, session will not get ready because of error
+func (m *ManagerCtx) readyFail(err error) {
+	m.readyMu.Lock()
+	defer m.readyMu.Unlock()
+
+	m.readyErr = err
+	if m.readyChan != nil {
+		close(m.readyChan)
+	}
+	m.readyChan = nil
+}
+
+func (m *ManagerCtx) readyError() error {
+	m.readyMu.RLock()
+	defer m.readyMu.RUnlock()
+
+	return m.readyErr
+}
+
 func (m *ManagerCtx) isReady() bool {
 	m.readyMu.RLock()
 	defer m.readyMu.RUnlock()
@@ -104,26 +247,95 @@ func (m *ManagerCtx) waitForReady() chan struct{} {
 	return m.readyChan
 }
 
-func (m *ManagerCtx) httpEnsureReady(w http.ResponseWriter) bool {
+// Err returns reason, why session failed to get ready, nil while it is
+// starting or when it is ready.
+func (m *ManagerCtx) Err() error {
+	return m.readyError()
+}
+
+// WaitReady blocks until session is ready and returns nil, or until it fails
+// to get ready and returns the cause. Context only bounds waiting, session
+// keeps starting after it is done.
+func (m *ManagerCtx) WaitReady(ctx context.Context) error {
+	if err := m.readyError(); err != nil {
+		return err
+	}
+
+	if m.isReady() {
+		return nil
+	}
+
+	select {
+	case <-m.waitForReady():
+		if err := m.readyError(); err != nil {
+			return err
+		}
+
+		if !m.isReady() {
+			return ErrStoppedBeforeReady
+		}
+
+		return nil
+	case <-m.ctx.Done():
+		return ErrStoppedBeforeReady
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// returns ready timeout from config, that can be overridden by
+// ready-timeout query parameter in seconds
+func (m *ManagerCtx) getReadyTimeout(r *http.Request) time.Duration {
+	timeout := m.config.ReadyTimeout
+	if timeout <= 0 {
+		timeout = readyTimeout
+	}
+
+	if value := r.URL.Query().Get("ready-timeout"); value != "" {
+		seconds, err := strconv.ParseFloat(value, 64)
+		if err == nil && seconds > 0 {
+			timeout = time.Duration(seconds * float64(time.Second))
+		}
+	}
+
+	if timeout > readyTimeoutMax {
+		timeout = readyTimeoutMax
+	}
+
+	return timeout
+}
+
+func (m *ManagerCtx) httpEnsureReady(w http.ResponseWriter, r *http.Request) bool {
+	// session failed to start and will not get ready
+	if err := m.readyError(); err != nil {
+		m.httpReadyError(w, r, err)
+		return false
+	}
+
 	// ensure that transcode started
 	if !m.isReady() {
 		select {
 		// waiting for transcode to be ready
 		case <-m.waitForReady():
+			if err := m.readyError(); err != nil {
+				m.httpReadyError(w, r, err)
+				return false
+			}
+
 			// check if it started succesfully
 			if !m.isReady() {
 				m.logger.Warn().Msgf("manager is not ready")
-				http.Error(w, "500 manager not available", http.StatusInternalServerError)
+				m.httpError(w, r, http.StatusServiceUnavailable, ErrorNotReady, "manager not available", time.Second)
 				return false
 			}
 		// when transcode stops before getting ready
 		case <-m.ctx.Done():
 			m.logger.Warn().Msg("manager load failed because of shutdown")
-			http.Error(w, "500 manager not available", http.StatusInternalServerError)
+			m.httpError(w, r, http.StatusServiceUnavailable, ErrorShutdown, "manager not available", 0)
 			return false
-		case <-time.After(readyTimeout):
+		case <-m.clock.After(m.getReadyTimeout(r)):
 			m.logger.Warn().Msg("manager load timeouted")
-			http.Error(w, "504 manager timeout", http.StatusGatewayTimeout)
+			m.httpError(w, r, http.StatusGatewayTimeout, ErrorReadyTimeout, "manager timeout", 5*time.Second)
 			return false
 		}
 	}
@@ -131,6 +343,26 @@ func (m *ManagerCtx) httpEnsureReady(w http.ResponseWriter) bool {
 	return true
 }
 
+// responds with reason, why session failed to start
+func (m *ManagerCtx) httpReadyError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, ErrNoStreams) || errors.Is(err, ErrNoDuration) || errors.Is(err, ErrStillImage) {
+		m.httpError(w, r, http.StatusUnprocessableEntity, ErrorUnsupportedMedia, err.Error(), 0)
+		return
+	}
+
+	if errors.Is(err, ErrProfileConstraint) {
+		m.httpError(w, r, http.StatusUnprocessableEntity, ErrorUnsupportedProfile, err.Error(), 0)
+		return
+	}
+
+	if errors.Is(err, ErrClipRange) {
+		m.httpError(w, r, http.StatusBadRequest, ErrorBadRequest, err.Error(), 0)
+		return
+	}
+
+	m.httpError(w, r, http.StatusServiceUnavailable, ErrorNotReady, "manager not available", 0)
+}
+
 //
 // metadata
 //
@@ -140,22 +372,52 @@ func (m *ManagerCtx) fetchMetadata(ctx context.Context) (err error) {
 	start := time.Now()
 	m.logger.Info().Msg("fetching metadata")
 
-	// start ffprobe to get metadata about current media
-	m.metadata, err = ProbeMedia(ctx, m.config.FFprobeBinary, m.config.MediaPath)
+	// start ffprobe to get metadata about current media, or join probe of
+	// other session of the same media
+	var shared bool
+	m.metadata, shared, err = probeMediaShared(ctx, m.transcoder, m.config.MediaPath)
 	if err != nil {
-		return fmt.Errorf("unable probe media for metadata: %v", err)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		// panic of shared probe fails session the same as its own panic
+		var panicErr *PanicError
+		if errors.As(err, &panicErr) {
+			return err
+		}
+		return fmt.Errorf("%w for metadata: %v", ErrProbeFailed, err)
+	}
+	if shared {
+		m.logger.Info().Msg("joined running metadata probe")
 	}
 
-	// if media has video, use keyframes as reference for segments if allowed so
-	if m.metadata.Video != nil && m.metadata.Video.PktPtsTime == nil && m.config.VideoKeyframes {
-		// start ffprobe to get keyframes from video
-		videoData, err := ProbeVideo(ctx, m.config.FFprobeBinary, m.config.MediaPath)
+	// audio has no keyframes, scanning packets of whole file would be wasted
+	if m.metadata.AudioOnly() {
+		m.logger.Info().Msg("audio-only media, segment times are computed from duration")
+	} else if m.metadata.Video.PktPtsTime == nil && m.config.VideoKeyframes && m.transcoder.Capabilities().Keyframes {
+		// start ffprobe to get keyframes from video, they are reference for segments
+		videoData, shared, err := probeVideoShared(ctx, m.transcoder, m.config.MediaPath)
 		if err != nil {
-			return fmt.Errorf("unable probe video for keyframes: %v", err)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			var panicErr *PanicError
+			if errors.As(err, &panicErr) {
+				return err
+			}
+			return fmt.Errorf("%w for keyframes: %v", ErrProbeFailed, err)
+		}
+		if shared {
+			m.logger.Info().Msg("joined running keyframes probe")
 		}
 		m.metadata.Video.PktPtsTime = videoData.PktPtsTime
 	}
 
+	// probe data needed by breakpoint strategy, e.g. scene changes
+	if !m.growing {
+		m.probeBreakpoints(ctx)
+	}
+
 	elapsed := time.Since(start)
 	m.logger.Info().Interface("duration", elapsed).Msg("fetched metadata")
 	return
@@ -163,8 +425,8 @@ func (m *ManagerCtx) fetchMetadata(ctx context.Context) (err error) {
 
 // load metadata from cache or fetch them and cache
 func (m *ManagerCtx) loadMetadata(ctx context.Context) error {
-	// bypass cache if not enabled
-	if !m.config.Cache {
+	// bypass cache if not enabled, growing media is cached when finished
+	if !m.config.Cache || m.growing {
 		return m.fetchMetadata(ctx)
 	}
 
@@ -174,6 +436,10 @@ func (m *ManagerCtx) loadMetadata(ctx context.Context) error {
 		// unmarshall cache data
 		err := json.Unmarshal(data, &m.metadata)
 		if err == nil {
+			// strategy could have been changed since metadata were cached
+			if m.probeBreakpoints(ctx) {
+				return m.saveMetadata()
+			}
 			return nil
 		}
 
@@ -187,28 +453,59 @@ func (m *ManagerCtx) loadMetadata(ctx context.Context) error {
 		return err
 	}
 
-	// marshall new metadata to bytes
-	data, err = json.Marshal(m.metadata)
+	return m.saveMetadata()
+}
+
+// save metadata to cache
+func (m *ManagerCtx) saveMetadata() error {
+	// marshall metadata to bytes
+	data, err := json.Marshal(m.metadata)
 	if err != nil {
 		return err
 	}
 
-	if m.config.CacheDir != "" {
-		return m.saveGlobalCacheData(data)
+	return m.saveCacheFile(cacheFileSuffix, data)
+}
+
+// SegmentName returns name of MPEG-TS segment at index, as served by
+// manager with segment prefix.
+func SegmentName(prefix string, index int) string {
+	return fmt.Sprintf("%s-%05d.ts", prefix, index)
+}
+
+// returns extension of segments in format
+func segmentExtension(format string) string {
+	if format == SegmentFormatFMP4 {
+		return ".m4s"
+	}
+
+	return ".ts"
+}
+
+// returns format of segments, it is the same for all profiles of session
+func (m *ManagerCtx) segmentFormat() string {
+	if m.config.VideoProfile == nil || m.config.VideoProfile.Format == "" {
+		return SegmentFormatTS
 	}
 
-	return m.saveLocalCacheData(data)
+	return m.config.VideoProfile.Format
+}
+
+// returns true, if segments are fMP4 with separate init segment
+func (m *ManagerCtx) fragmented() bool {
+	return m.segmentFormat() == SegmentFormatFMP4
 }
 
 func (m *ManagerCtx) getSegmentName(index int) string {
-	return fmt.Sprintf("%s-%05d.ts", m.config.SegmentPrefix, index)
+	return fmt.Sprintf("%s-%05d%s", m.config.SegmentPrefix, index, segmentExtension(m.segmentFormat()))
 }
 
+var segmentNameRegex = regexp.MustCompile(`^(.*)-([0-9]{5})(\.ts|\.m4s)$`)
+
 func (m *ManagerCtx) parseSegmentIndex(segmentName string) (int, bool) {
-	regex := regexp.MustCompile(`^(.*)-([0-9]{5})\.ts$`)
-	matches := regex.FindStringSubmatch(segmentName)
+	matches := segmentNameRegex.FindStringSubmatch(segmentName)
 
-	if len(matches) != 3 || matches[1] != m.config.SegmentPrefix {
+	if len(matches) != 4 || matches[1] != m.config.SegmentPrefix || matches[3] != segmentExtension(m.segmentFormat()) {
 		return 0, false
 	}
 
@@ -222,46 +519,276 @@ func (m *ManagerCtx) parseSegmentIndex(segmentName string) (int, bool) {
 }
 
 func (m *ManagerCtx) getPlaylist() string {
+	// KEYFORMAT and SAMPLE-AES require version 5, EXT-X-MAP version 6,
+	// EXT-X-GAP version 8
+	version := 4
+	if len(m.segmentGaps) > 0 {
+		version = 8
+	} else if m.fragmented() {
+		version = 6
+	} else if m.keys != nil {
+		version = 5
+	}
+
+	targetDuration := m.segmentLength + m.segmentOffset
+
+	// segments transcoded with swapped profile
+	discontinuities := m.profileDiscontinuities()
+
+	// playlist segments
+	var segments []string
+	var lastKey *Key
+	segmentsTotal := m.playlistSegments()
+	for i := 1; i <= segmentsTotal; i++ {
+		if discontinuities[i-1] {
+			segments = append(segments, "#EXT-X-DISCONTINUITY")
+		}
+
+		// announce key, when it rotates
+		if m.keys != nil && m.keys[i-1] != lastKey {
+			lastKey = m.keys[i-1]
+			segments = append(segments, lastKey.playlistTag())
+		}
+
+		// prefer measured duration of transcoded segment
+		duration, ok := m.segmentDurations[i-1]
+		if !ok {
+			duration = m.breakpoints[i] - m.breakpoints[i-1]
+		}
+
+		if duration > targetDuration {
+			targetDuration = math.Ceil(duration)
+		}
+
+		// players skip segments, that cannot be transcoded
+		if m.segmentGaps[i-1] {
+			segments = append(segments, "#EXT-X-GAP")
+		}
+
+		segments = append(segments,
+			fmt.Sprintf("#EXTINF:%.3f, no desc", duration),
+			m.getSegmentName(i-1),
+		)
+	}
+
+	// growing media and event playlist can only be appended to, until
+	// the last segment is listed
+	finished := !m.growing && segmentsTotal == len(m.breakpoints)-1
+
+	playlistType := "VOD"
+	if !finished {
+		playlistType = "EVENT"
+	}
+
 	// playlist prefix
 	playlist := []string{
 		"#EXTM3U",
-		"#EXT-X-VERSION:4",
-		"#EXT-X-PLAYLIST-TYPE:VOD",
+		fmt.Sprintf("#EXT-X-VERSION:%d", version),
+		"#EXT-X-PLAYLIST-TYPE:" + playlistType,
 		"#EXT-X-MEDIA-SEQUENCE:0",
-		fmt.Sprintf("#EXT-X-TARGETDURATION:%.2f", m.segmentLength+m.segmentOffset),
+		fmt.Sprintf("#EXT-X-TARGETDURATION:%.2f", targetDuration),
 	}
 
-	// playlist segments
-	for i := 1; i < len(m.breakpoints); i++ {
-		playlist = append(playlist,
-			fmt.Sprintf("#EXTINF:%.3f, no desc", m.breakpoints[i]-m.breakpoints[i-1]),
-			m.getSegmentName(i-1),
-		)
+	// fMP4 segments share one init segment
+	if m.fragmented() {
+		playlist = append(playlist, fmt.Sprintf("#EXT-X-MAP:URI=%q", m.getInitSegmentName()))
 	}
 
+	playlist = append(playlist, segments...)
+
 	// playlist suffix
-	playlist = append(playlist,
-		"#EXT-X-ENDLIST",
-	)
+	if finished {
+		playlist = append(playlist,
+			"#EXT-X-ENDLIST",
+		)
+	}
 
 	// join with newlines
 	return strings.Join(playlist, "\n")
 }
 
-func (m *ManagerCtx) initialize() {
-	keyframes := []float64{}
-	if m.metadata.Video != nil && m.metadata.Video.PktPtsTime != nil {
-		keyframes = m.metadata.Video.PktPtsTime
+// load encryption keys for all segments without key, if enabled
+func (m *ManagerCtx) loadKeys() error {
+	if m.config.KeyProvider == nil {
+		return nil
+	}
+
+	keys := m.keys
+	for i := len(keys); i < len(m.breakpoints)-1; i++ {
+		key, err := m.config.KeyProvider.SegmentKey(m.config.Session, i)
+		if err != nil {
+			return fmt.Errorf("unable to get key for segment %d: %v", i, err)
+		}
+
+		if key.Method == EncryptionSampleAES && m.config.SegmentEncrypter == nil {
+			return fmt.Errorf("encryption method %s requires custom segment encrypter", key.Method)
+		}
+
+		keys = append(keys, key)
+	}
+
+	m.keys = keys
+	return nil
+}
+
+// encrypts transcoded segment, if enabled
+func (m *ManagerCtx) encryptSegment(index int, segmentPath string) error {
+	if m.keys == nil || index >= len(m.keys) {
+		return nil
+	}
+
+	encrypter := m.config.SegmentEncrypter
+	if encrypter == nil {
+		encrypter = EncryptSegmentAES128
+	}
+
+	err := encrypter(segmentPath, m.keys[index], index)
+
+	// encrypter rewrites segment outside of file system, files opened before
+	// (e.g. to measure it) must not be served
+	if pool, ok := m.fs.(*filePool); ok {
+		pool.invalidate(segmentPath)
+	}
+
+	return err
+}
+
+// returns error, if media cannot be transcoded
+func (m *ManagerCtx) checkMedia() error {
+	if m.metadata.Video == nil && len(m.metadata.Audio) == 0 {
+		return ErrNoStreams
+	}
+
+	// single image would produce a segment with one frame
+	if m.metadata.Video != nil && len(m.metadata.Audio) == 0 && stillImageCodecs[m.metadata.Video.CodecName] &&
+		!ImageSequence(m.config.MediaPath) && !ImageAnimation(m.config.MediaPath) {
+		return ErrStillImage
+	}
+
+	// growing media are re-probed as they grow
+	if m.metadata.Duration <= 0 && !m.growing {
+		return ErrNoDuration
+	}
+
+	return nil
+}
+
+// returns video profile of rendition, media without video (except for cover
+// art) is transcoded as audio-only
+func (m *ManagerCtx) videoProfile() *VideoProfile {
+	if m.metadata == nil || m.metadata.AudioOnly() {
+		return nil
+	}
+
+	return m.config.VideoProfile
+}
+
+// returns H.264 level of video encoded using profile, or error, if profile
+// does not fit source and encoder constraints
+func (m *ManagerCtx) checkProfile(profile *VideoProfile) (int, error) {
+	if m.metadata.Video == nil {
+		return 0, nil
+	}
+
+	// preview has one frame per second
+	framerate := 0.0
+	if profile.Preview {
+		framerate = 1
+	}
+
+	return CheckProfile(m.metadata.Video, profile, framerate, m.config.MaxLevel)
+}
+
+// returns breakpoints of segments from metadata
+func (m *ManagerCtx) getBreakpoints() []float64 {
+	if m.growing {
+		// fixed breakpoints, that do not change as media grows
+		return growingBreakpoints(m.metadata.Duration.Seconds(), m.segmentLength, false)
+	}
+
+	// generate breakpoints using configured strategy
+	breakpoints := m.breakpointStrategy().Breakpoints(m.metadata, m.segmentLength, m.segmentOffset)
+
+	// restrict breakpoints to virtual clip
+	if m.config.ClipStart > 0 || m.config.ClipEnd > 0 {
+		breakpoints = clipSegments(breakpoints, m.config.ClipStart, m.config.ClipEnd, m.segmentOffset)
+	}
+
+	return breakpoints
+}
+
+func (m *ManagerCtx) initialize() error {
+	if err := m.checkMedia(); err != nil {
+		return err
+	}
+
+	m.profileSwapsReset()
+
+	if m.config.VideoProfile != nil && m.videoProfile() == nil {
+		m.logger.Info().Msg("media has no video, transcoding audio only")
+	}
+
+	// check if subtitle stream can be burned into video
+	m.burnSubs = false
+	if m.config.BurnSubtitles && m.videoProfile() != nil {
+		if m.config.SubtitleStream >= len(m.metadata.Subtitles) {
+			m.logger.Warn().Int("stream", m.config.SubtitleStream).Msg("subtitle stream not found, not burning subtitles")
+		} else if subtitle := m.metadata.Subtitles[m.config.SubtitleStream]; !subtitle.Text() {
+			m.logger.Warn().Str("codec", subtitle.CodecName).Msg("only text subtitles can be burned, not burning subtitles")
+		} else {
+			m.burnSubs = true
+		}
 	}
 
-	// generate breakpoints from keyframes
-	m.breakpoints = convertToSegments(keyframes, m.metadata.Duration, m.segmentLength, m.segmentOffset)
+	// check if streams can be copied without encoding
+	m.passthrough = false
+	if m.config.Passthrough && !m.burnSubs && m.config.Overlay == nil && (m.config.VideoProfile == nil || m.config.VideoProfile.Codec != CodecHEVC) {
+		matrix := DefaultCompatibilityMatrix
+		if m.config.CompatibilityMatrix != nil {
+			matrix = *m.config.CompatibilityMatrix
+		}
+
+		if err := matrix.Check(m.metadata); err != nil {
+			m.logger.Info().Str("reason", err.Error()).Msg("passthrough not possible, falling back to encoding")
+		} else {
+			m.passthrough = true
+		}
+	}
+
+	// check if profile can be encoded, before it fails mid-playback
+	if profile := m.videoProfile(); profile != nil && !m.passthrough {
+		if _, err := m.checkProfile(profile); err != nil {
+			return err
+		}
+	}
+
+	m.breakpoints = m.getBreakpoints()
+	if len(m.breakpoints) < 2 && (m.config.ClipStart > 0 || m.config.ClipEnd > 0) {
+		return fmt.Errorf("%w: clip %g-%g, media duration is %g", ErrClipRange, m.config.ClipStart, m.config.ClipEnd, m.metadata.Duration.Seconds())
+	}
+
+	// load encryption keys
+	m.keys = nil
+	if err := m.loadKeys(); err != nil {
+		return err
+	}
 
 	// generate playlist
+	m.segmentDurations = map[int]float64{}
+	m.segmentGaps = map[int]bool{}
+	m.event = m.config.EventPlaylist && !m.growing
+	m.eventSegments = 0
 	m.playlist = m.getPlaylist()
+	m.playlistMod = m.clock.Now()
 
 	// prepare transcode matrix from breakpoints
 	m.segments = map[int]string{}
+	m.segmentSizes = map[int]int64{}
+	m.segmentsMemory = []int{}
+	m.segmentVolumes = map[int]string{}
+	m.segmentsWriting = map[int]string{}
+	m.initSegment = nil
+	m.initReady = make(chan struct{})
 	for i := 0; i < len(m.breakpoints); i++ {
 		m.segments[i] = ""
 	}
@@ -269,43 +796,192 @@ func (m *ManagerCtx) initialize() {
 	// prepare segment queue map
 	m.segmentQueue = map[int]chan struct{}{}
 
+	// prepare segment failures map
+	m.segmentFailures = map[int]int{}
+
 	m.logger.Info().
 		Int("segments", len(m.segments)).
 		Bool("video", m.metadata.Video != nil).
+		Bool("passthrough", m.passthrough).
+		Bool("subtitles", m.burnSubs).
 		Int("audios", len(m.metadata.Audio)).
 		Str("duration", fmt.Sprintf("%v", m.metadata.Duration)).
+		Bool("encrypted", m.keys != nil).
+		Bool("growing", m.growing).
 		Msg("initialization completed")
+
+	return nil
 }
 
 //
 // segments
 //
 
-func (m *ManagerCtx) addSegment(index int, segmentName string) {
+// returns real duration of transcoded segment
+func (m *ManagerCtx) measureSegment(segmentPath string) (float64, error) {
+	file, err := m.fs.Open(segmentPath)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	return TransportStreamDuration(bufio.NewReader(file))
+}
+
+func (m *ManagerCtx) addSegment(index int, outputDir, segmentName string) {
+	segmentPath := filepath.Join(outputDir, segmentName)
+
+	// fMP4 segments are served without their init section
+	if m.fragmented() {
+		if err := m.splitInitSegment(segmentPath); err != nil {
+			m.logger.Err(err).Str("path", segmentPath).Msg("unable to split init segment")
+			m.publishTranscodeFailed(err)
+
+			if err := m.fs.Remove(segmentPath); err != nil {
+				m.logger.Err(err).Str("path", segmentPath).Msg("error while removing file")
+			}
+			return
+		}
+	}
+
+	// measure segment duration, before it is encrypted, only MPEG-TS
+	// segments are measured
+	var duration float64
+	measured := false
+	if !m.fragmented() {
+		var err error
+		if duration, err = m.measureSegment(segmentPath); err != nil {
+			m.logger.Warn().Err(err).Str("path", segmentPath).Msg("unable to measure segment duration")
+		} else {
+			measured = true
+		}
+	}
+
+	// encrypt segment before it is served
+	if err := m.encryptSegment(index, segmentPath); err != nil {
+		m.logger.Err(err).Str("path", segmentPath).Msg("unable to encrypt segment")
+		m.publishTranscodeFailed(err)
+
+		// never serve unencrypted segment
+		if err := m.fs.Remove(segmentPath); err != nil {
+			m.logger.Err(err).Str("path", segmentPath).Msg("error while removing file")
+		}
+		return
+	}
+
+	// get encoded segment size
+	var size int64
+	if fi, err := m.fs.Stat(segmentPath); err == nil {
+		size = fi.Size()
+	} else {
+		m.logger.Err(err).Str("path", segmentPath).Msg("unable to get segment size")
+	}
+
+	// encrypt segment at rest, size of served segment is kept
+	if err := m.sealSegment(segmentPath); err != nil {
+		m.logger.Err(err).Str("path", segmentPath).Msg("unable to seal segment")
+		m.publishTranscodeFailed(err)
+
+		if err := m.fs.Remove(segmentPath); err != nil {
+			m.logger.Err(err).Str("path", segmentPath).Msg("error while removing file")
+		}
+		return
+	}
+
+	m.segmentsMu.Lock()
+	m.segments[index] = segmentName
+	m.segmentSizes[index] = size
+	m.progressRecord()
+
+	// update playlist, if segment duration differs from expected one
+	updated := false
+	if measured && index+1 < len(m.breakpoints) {
+		expected := m.breakpoints[index+1] - m.breakpoints[index]
+		if math.Abs(duration-expected) >= playlistDurationTolerance {
+			m.segmentDurations[index] = duration
+			updated = true
+		}
+	}
+	if m.eventPlaylist() && m.extendEventPlaylist() {
+		updated = true
+	}
+	if updated {
+		m.playlist = m.getPlaylist()
+		m.playlistMod = m.clock.Now()
+	}
+	if m.config.MemoryDir != "" {
+		m.segmentsMemory = append(m.segmentsMemory, index)
+	} else {
+		m.segmentVolumes[index] = outputDir
+	}
+	m.segmentsMu.Unlock()
+
+	m.config.Events.Publish(events.SegmentReady{Session: m.config.Session, Index: index, Name: m.getSegmentName(index)})
+
+	// move older segments from memory to disk
+	m.spillSegments()
+}
+
+func (m *ManagerCtx) removeSegment(index int) {
 	m.segmentsMu.Lock()
 	defer m.segmentsMu.Unlock()
 
-	m.segments[index] = segmentName
+	segmentName := m.segments[index]
+	if segmentName == "" {
+		return
+	}
+
+	segmentPath := filepath.Join(m.segmentDir(index), segmentName)
+	if err := m.fs.Remove(segmentPath); err != nil {
+		m.logger.Err(err).Str("path", segmentPath).Msg("error while removing file")
+	}
+
+	m.segments[index] = ""
+	delete(m.segmentSizes, index)
+	delete(m.segmentVolumes, index)
+	m.segmentsMemory = removeIndex(m.segmentsMemory, index)
+
+	m.config.Events.Publish(events.CacheEvicted{Session: m.config.Session, Key: m.getSegmentName(index)})
 }
 
 func (m *ManagerCtx) getSegment(index int) (segmentPath string, ok bool) {
-	var segmentName string
-
 	m.segmentsMu.RLock()
-	segmentName, ok = m.segments[index]
-	m.segmentsMu.RUnlock()
+	defer m.segmentsMu.RUnlock()
 
+	segmentName, ok := m.segments[index]
 	if !ok {
 		return
 	}
 
 	if segmentName != "" {
-		segmentPath = path.Join(m.config.TranscodeDir, segmentName)
+		segmentPath = filepath.Join(m.segmentDir(index), segmentName)
 	}
 
 	return
 }
 
+// marks segment, that failed to transcode, as gap, so that the rest of media
+// stays playable
+func (m *ManagerCtx) markSegmentGap(index int) {
+	m.segmentsMu.Lock()
+	defer m.segmentsMu.Unlock()
+
+	m.segmentGaps[index] = true
+	if m.eventPlaylist() {
+		m.extendEventPlaylist()
+	}
+
+	m.playlist = m.getPlaylist()
+	m.playlistMod = m.clock.Now()
+}
+
+func (m *ManagerCtx) isSegmentGap(index int) bool {
+	m.segmentsMu.RLock()
+	defer m.segmentsMu.RUnlock()
+
+	return m.segmentGaps[index]
+}
+
 func (m *ManagerCtx) isSegmentTranscoded(index int) bool {
 	m.segmentsMu.RLock()
 	segmentName, ok := m.segments[index]
@@ -318,13 +994,13 @@ func (m *ManagerCtx) clearAllSegments() {
 	m.segmentsMu.Lock()
 	defer m.segmentsMu.Unlock()
 
-	for _, segmentName := range m.segments {
+	for index, segmentName := range m.segments {
 		if segmentName == "" {
 			continue
 		}
 
-		segmentPath := path.Join(m.config.TranscodeDir, segmentName)
-		if err := os.Remove(segmentPath); err != nil {
+		segmentPath := filepath.Join(m.segmentDir(index), segmentName)
+		if err := m.fs.Remove(segmentPath); err != nil {
 			m.logger.Err(err).Str("path", segmentPath).Msg("error while removing file")
 		}
 	}
@@ -334,14 +1010,23 @@ func (m *ManagerCtx) clearAllSegments() {
 // segment queue
 //
 
-func (m *ManagerCtx) enqueueSegments(offset, limit int) {
+// enqueues segments transcoded with the same profile, returns the profile
+// and limit capped before the next profile swap
+func (m *ManagerCtx) enqueueSegments(offset, limit int) (segmentProfile, int) {
 	m.segmentQueueMu.Lock()
 	defer m.segmentQueueMu.Unlock()
 
-	// create new segment signaling channels queue
+	profile, limit := m.profileAt(offset, limit)
+
+	// create new segment signaling channels queue, existing channels
+	// are kept, so that retried segments do not lose their waiters
 	for i := offset; i < offset+limit; i++ {
-		m.segmentQueue[i] = make(chan struct{}, 1)
+		if _, ok := m.segmentQueue[i]; !ok {
+			m.segmentQueue[i] = make(chan struct{}, 1)
+		}
 	}
+
+	return profile, limit
 }
 
 func (m *ManagerCtx) dequeueSegment(index int) {
@@ -362,19 +1047,115 @@ func (m *ManagerCtx) waitForSegment(index int) (chan struct{}, bool) {
 	return res, ok
 }
 
-func (m *ManagerCtx) transcodeSegments(offset, limit int) error {
-	logger := m.logger.With().Int("offset", offset).Int("limit", limit).Logger()
+func (m *ManagerCtx) publishTranscodeFailed(err error) {
+	event := events.TranscodeFailed{Session: m.config.Session, Err: err}
+
+	var ffmpegErr *utils.FFmpegError
+	if errors.As(err, &ffmpegErr) {
+		event.Class = ffmpegErr.Class
+		event.Message = ffmpegErr.Message
+	}
+
+	m.config.Events.Publish(event)
+}
+
+// increments failed attempts of segment and returns their count
+func (m *ManagerCtx) segmentFailed(index int) int {
+	m.segmentFailuresMu.Lock()
+	defer m.segmentFailuresMu.Unlock()
+
+	m.segmentFailures[index]++
+	return m.segmentFailures[index]
+}
+
+func (m *ManagerCtx) segmentSucceeded(index int) {
+	m.segmentFailuresMu.Lock()
+	defer m.segmentFailuresMu.Unlock()
+
+	delete(m.segmentFailures, index)
+}
+
+type transcodeOptions struct {
+	fallback   bool // use fallback settings for failed segments
+	background bool // low priority transcode, e.g. warming
+}
+
+func (m *ManagerCtx) transcodeSegments(offset, limit int, opts transcodeOptions) error {
+	// old playlist must not be mixed with segments of new media
+	if m.sourceReplaced() {
+		return ErrSourceChanged
+	}
+
+	// create new segment signaling channels queue, before transcode starts
+	// so that simultaneous requests wait for this transcode
+	profile, limit := m.enqueueSegments(offset, limit)
+
+	logger := m.logger.With().
+		Int("offset", offset).
+		Int("limit", limit).
+		Bool("fallback", opts.fallback).
+		Bool("background", opts.background).
+		Logger()
 
 	segmentTimes := m.breakpoints[offset : offset+limit+1]
 	logger.Info().Interface("segments-times", segmentTimes).Msg("transcoding segments")
 
-	segments, err := TranscodeSegments(m.ctx, m.config.FFmpegBinary, TranscodeConfig{
-		InputFilePath: m.config.MediaPath,
-		OutputDirPath: m.config.TranscodeDir,
-		SegmentPrefix: m.config.SegmentPrefix, // This does not need to match.
+	// error of transcode process, it is always reported before segments channel closes
+	transcodeErr := make(chan error, 1)
+
+	// hardware encoder session is held until transcode process finishes
+	encoder, releaseEncoder := m.acquireEncoder(opts, profile)
+	logger = logger.With().Str("encoder", encoder).Logger()
+
+	// all segments of transcode process are stored in the same dir
+	outputDir := m.outputDir()
+
+	// profile was checked when session was initialized or profile swapped
+	var level int
+	var pixelFormat string
+	if profile.video != nil && !profile.passthrough {
+		level, _ = m.checkProfile(profile.video)
+		pixelFormat = m.metadata.Video.PixFmt
+	}
+
+	// streams of MPEG-TS source are copied into segments without ffmpeg
+	transcoder := m.transcoder
+	if profile.passthrough {
+		transcoder = m.segmenter
+	}
 
-		VideoProfile: m.config.VideoProfile,
-		AudioProfile: m.config.AudioProfile,
+	segments, err := transcoder.TranscodeSegments(m.lookaheadContext(), TranscodeConfig{
+		InputFilePath: m.config.MediaPath,
+		OutputDirPath: outputDir,
+		SegmentPrefix: m.outputPrefix(), // This does not need to match.
+		SegmentFormat: m.segmentFormat(),
+
+		VideoProfile: profile.video,
+		AudioProfile: profile.audio,
+		AudioOffset:  m.config.AudioOffset,
+		AudioStream:  m.config.AudioStream,
+		Passthrough:  profile.passthrough,
+		IONice:       m.config.IONice || opts.background,
+		Fallback:     opts.fallback,
+		Encoder:      encoder,
+		Level:        level,
+		PixelFormat:  pixelFormat,
+
+		BurnSubtitles:  m.burnSubs,
+		SubtitleStream: m.config.SubtitleStream,
+		FontsDir:       m.fontsDir,
+
+		Overlay: m.config.Overlay,
+
+		OnError: func(err error) {
+			select {
+			case transcodeErr <- err:
+			default:
+			}
+		},
+		OnLog: func(line string) {
+			m.config.Events.Publish(events.CmdLog{Session: m.config.Session, Message: line})
+		},
 
 		SegmentOffset: offset,
 		SegmentTimes:  segmentTimes,
@@ -382,20 +1163,39 @@ func (m *ManagerCtx) transcodeSegments(offset, limit int) error {
 
 	if err != nil {
 		logger.Err(err).Msg("error occured while starting to transcode segment")
+		m.publishTranscodeFailed(err)
+		releaseEncoder()
+
+		// drop segments from queue
+		for i := offset; i < offset+limit; i++ {
+			m.dequeueSegment(i)
+		}
 		return err
 	}
 
-	// create new segment signaling channels queue
-	m.enqueueSegments(offset, limit)
-
 	index := offset
 	logger.Info().Msg("transcode process started")
+	m.segmentWriting(index, outputDir)
 
 	go func() {
+		defer utils.RecoverPanic(logger, m.panicked)
+
 		for {
 			segmentName, ok := <-segments
 			if !ok {
 				logger.Info().Int("index", index).Msg("transcode process finished")
+				releaseEncoder()
+				m.segmentWritten(index)
+
+				// retry segments that were not transcoded because of failure
+				if index < offset+limit && m.retrySegments(index, offset+limit-index, opts, transcodeErr) {
+					return
+				}
+
+				// drop segments that were not transcoded from queue
+				for i := index; i < offset+limit; i++ {
+					m.dequeueSegment(i)
+				}
 				return
 			}
 
@@ -405,20 +1205,68 @@ func (m *ManagerCtx) transcodeSegments(offset, limit int) error {
 				Msg("transcode process returned a segment")
 
 			// add transcoded segment name
-			m.addSegment(index, segmentName)
+			m.addSegment(index, outputDir, segmentName)
+			m.segmentSucceeded(index)
+			m.segmentWritten(index)
 
 			// notify and drop from queue, if exists
 			m.dequeueSegment(index)
 
 			// expect new segment to come
 			index++
+			if index < offset+limit {
+				m.segmentWriting(index, outputDir)
+			}
 		}
 	}()
 
 	return nil
 }
 
+// retries transcode of segments, if it failed, returns true if retry started
+func (m *ManagerCtx) retrySegments(offset, limit int, opts transcodeOptions, transcodeErr chan error) bool {
+	var err error
+	select {
+	case err = <-transcodeErr:
+	default:
+		// transcode did not fail or it was cancelled
+		return false
+	}
+
+	// failure is counted for the first segment, that was not transcoded
+	failures := m.segmentFailed(offset)
+	if m.ctx.Err() != nil {
+		return false
+	}
+
+	if failures > segmentRetries {
+		m.logger.Warn().Int("index", offset).Int("failures", failures).Msg("segment transcode failed, giving up")
+		m.publishTranscodeFailed(err)
+
+		// broken region of media is skipped, remaining segments are
+		// transcoded, so that players do not stall at it
+		m.markSegmentGap(offset)
+		m.dequeueSegment(offset)
+		if limit > 1 {
+			opts.fallback = false
+			_ = m.transcodeSegments(offset+1, limit-1, opts)
+		}
+		return true
+	}
+
+	m.logger.Warn().Err(err).Int("index", offset).Int("failures", failures).Msg("segment transcode failed, retrying")
+
+	// last retry uses fallback settings
+	opts.fallback = failures == segmentRetries
+	return m.transcodeSegments(offset, limit, opts) == nil
+}
+
 func (m *ManagerCtx) transcodeFromSegment(index int) error {
+	// coalesce simultaneous requests, only one of them can start transcode
+	// while others will wait for already enqueued segments
+	m.transcodeMu.Lock()
+	defer m.transcodeMu.Unlock()
+
 	segmentsTotal := len(m.segments)
 	if segmentsTotal <= m.segmentBufferMax {
 		// if all our segments can fit in the buffer
@@ -433,7 +1281,7 @@ func (m *ManagerCtx) transcodeFromSegment(index int) error {
 	offset, limit := 0, 0
 	for i := index; i < segmentsTotal-1; i++ {
 		_, isEnqueued := m.waitForSegment(i)
-		isTranscoded := m.isSegmentTranscoded(i)
+		isTranscoded := m.isSegmentTranscoded(i) || m.isSegmentGap(i)
 
 		// increase offset if transcoded without limit
 		if (isTranscoded || isEnqueued) && limit == 0 {
@@ -456,7 +1304,67 @@ func (m *ManagerCtx) transcodeFromSegment(index int) error {
 	}
 
 	// otherwise transcode chosen segment range
-	return m.transcodeSegments(offset+index, limit)
+	return m.transcodeSegments(offset+index, limit, transcodeOptions{})
+}
+
+//
+// activity
+//
+
+// keeps session alive without requesting any playlist or media
+func (m *ManagerCtx) Heartbeat() {
+	m.lastRequestMu.Lock()
+	defer m.lastRequestMu.Unlock()
+
+	m.lastRequest = m.clock.Now()
+}
+
+// returns how long is session without any request or heartbeat
+func (m *ManagerCtx) Idle() time.Duration {
+	m.lastRequestMu.RLock()
+	defer m.lastRequestMu.RUnlock()
+
+	return m.clock.Now().Sub(m.lastRequest)
+}
+
+// returns context for transcoding ahead, that is cancelled when session is idle
+func (m *ManagerCtx) lookaheadContext() context.Context {
+	m.lookaheadMu.Lock()
+	defer m.lookaheadMu.Unlock()
+
+	if m.lookaheadCtx == nil || m.lookaheadCtx.Err() != nil {
+		m.lookaheadCtx, m.lookaheadCancel = context.WithCancel(m.ctx)
+	}
+
+	return m.lookaheadCtx
+}
+
+func (m *ManagerCtx) lookaheadStop() {
+	m.lookaheadMu.Lock()
+	defer m.lookaheadMu.Unlock()
+
+	if m.lookaheadCancel != nil {
+		m.lookaheadCancel()
+		m.lookaheadCancel = nil
+		m.logger.Info().Msg("transcode lookahead stopped")
+	}
+}
+
+func (m *ManagerCtx) Cleanup() {
+	idle := m.Idle()
+	stop := idle > lookaheadIdleTimeout
+
+	m.logger.Debug().
+		Dur("idle", idle).
+		Bool("stop", stop).
+		Msg("performing cleanup")
+
+	if stop {
+		m.lookaheadStop()
+	}
+
+	// evict least popular segments
+	m.heatmapEvict()
 }
 
 func (m *ManagerCtx) Start() (err error) {
@@ -466,35 +1374,130 @@ func (m *ManagerCtx) Start() (err error) {
 	// initialize ready state
 	m.readyReset()
 
+	m.readyMu.Lock()
+	m.stopped = false
+	m.readyMu.Unlock()
+
+	// initialize activity
+	m.Heartbeat()
+
+	// load segments popularity
+	m.heatmapLoad()
+
+	// periodic cleanup
+	go func() {
+		defer utils.RecoverPanic(m.logger, m.panicked)
+
+		ticker := m.clock.NewTicker(cleanupPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-m.ctx.Done():
+				return
+			case <-ticker.C():
+				m.Cleanup()
+			}
+		}
+	}()
+
 	// initialize transcoder asynchronously
 	go func() {
+		defer utils.RecoverPanic(m.logger, m.panicked)
+
+		// changes of source media after this point are detected
+		m.sourceRecord()
+
+		// media still being written is extended as it grows
+		m.growing = m.config.Growing && m.mediaGrowing()
+
 		if err := m.loadMetadata(m.ctx); err != nil {
 			m.logger.Err(err).Msg("unable to load metadata")
+			m.publishTranscodeFailed(err)
+			m.readyFail(err)
+			m.fireStop(err)
 			return
 		}
 
 		// initialization based on metadata
-		m.initialize()
+		if err := m.initialize(); err != nil {
+			m.logger.Err(err).Msg("unable to initialize")
+			m.publishTranscodeFailed(err)
+			m.readyFail(err)
+			m.fireStop(err)
+			return
+		}
+
+		// fonts for burned subtitles
+		if m.burnSubs {
+			m.extractFonts(m.ctx)
+		}
 
 		// set ready state as done
 		m.readyDone()
+
+		if m.growing {
+			go m.watchGrowing(m.ctx)
+		}
+
+		if m.config.SourceWatch > 0 && !ImageSequence(m.config.MediaPath) {
+			go m.watchSource(m.ctx)
+		}
+
+		if m.eventPlaylist() {
+			go m.transcodeEvent()
+		}
+
+		m.config.Events.Publish(events.SessionStarted{Session: m.config.Session, Time: m.clock.Now()})
 	}()
 
 	return nil
 }
 
 func (m *ManagerCtx) Stop() {
-	// reset ready state
+	// reset ready state, cause of failed start is kept for requests, that
+	// are still waiting for it
+	err := m.readyError()
 	m.readyReset()
+	if err != nil {
+		m.readyFail(err)
+	}
 
 	// cancel current context
 	m.cancel()
 
+	// persist segments popularity
+	m.heatmapSave()
+
 	// remove all transcoded segments
 	m.clearAllSegments()
+
+	// keys of removed segments are not needed anymore
+	if releaser, ok := m.config.KeyProvider.(KeyReleaser); ok {
+		releaser.ReleaseKeys(m.config.Session)
+	}
+
+	// close files kept opened for requests
+	if pool, ok := m.fs.(*filePool); ok {
+		pool.purge()
+	}
+
+	// remove extracted fonts
+	if m.fontsDir != "" {
+		if err := os.RemoveAll(m.fontsDir); err != nil {
+			m.logger.Err(err).Str("path", m.fontsDir).Msg("error while removing fonts")
+		}
+	}
+
+	m.config.Events.Publish(events.SessionStopped{Session: m.config.Session, Time: m.clock.Now()})
+
+	m.fireStop(nil)
 }
 
 func (m *ManagerCtx) Preload(ctx context.Context) (*ProbeMediaData, error) {
+	// metadata of growing media must not be cached
+	m.growing = m.config.Growing && m.mediaGrowing()
+
 	if err := m.loadMetadata(ctx); err != nil {
 		return nil, err
 	}
@@ -503,42 +1506,79 @@ func (m *ManagerCtx) Preload(ctx context.Context) (*ProbeMediaData, error) {
 }
 
 func (m *ManagerCtx) ServePlaylist(w http.ResponseWriter, r *http.Request) {
+	m.Heartbeat()
+
 	// ensure that manager started
-	if !m.httpEnsureReady(w) {
+	if !m.httpEnsureReady(w, r) {
 		return
 	}
 
+	// propagate session query to segments
+	m.segmentsMu.RLock()
+	playlist, playlistMod := m.playlist, m.playlistMod
+	m.segmentsMu.RUnlock()
+
+	if r.URL.RawQuery != "" {
+		playlist = playlistWithQuery(playlist, r.URL.RawQuery)
+	}
+
+	// validator for conditional requests
+	hash := sha1.Sum([]byte(playlist))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, hash[:8]))
+
 	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
-	_, _ = w.Write([]byte(m.playlist))
+	http.ServeContent(w, r, "", playlistMod, strings.NewReader(playlist))
 }
 
 func (m *ManagerCtx) ServeMedia(w http.ResponseWriter, r *http.Request) {
+	m.Heartbeat()
+
 	// ensure that manager started
-	if !m.httpEnsureReady(w) {
+	if !m.httpEnsureReady(w, r) {
 		return
 	}
 
 	// same of the requested segment is everything after last slash
 	reqSegName := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
 
+	if m.fragmented() && reqSegName == m.getInitSegmentName() {
+		m.serveInitSegment(w, r)
+		return
+	}
+
 	// getting index from segment name
 	index, ok := m.parseSegmentIndex(reqSegName)
 	if !ok {
-		http.Error(w, "400 bad media path", http.StatusBadRequest)
+		m.httpError(w, r, http.StatusBadRequest, ErrorBadRequest, "bad media path", 0)
 		return
 	}
 
 	// check if segment exists
 	segmentPath, ok := m.getSegment(index)
 	if !ok {
-		http.Error(w, "404 index not found", http.StatusNotFound)
+		m.httpError(w, r, http.StatusNotFound, ErrorNotFound, "index not found", 0)
+		return
+	}
+
+	// track segment popularity
+	m.heatmapRecord(index)
+
+	// segments of replaced media are not transcoded anymore
+	if !m.isSegmentTranscoded(index) && m.sourceReplaced() {
+		m.httpError(w, r, http.StatusConflict, ErrorSourceChanged, ErrSourceChanged.Error(), 0)
 		return
 	}
 
 	// try to transcode from current segment
 	if err := m.transcodeFromSegment(index); err != nil {
 		m.logger.Err(err).Int("index", index).Msg("unable to transcode media")
-		http.Error(w, "500 unable to transcode", http.StatusInternalServerError)
+		m.httpError(w, r, http.StatusInternalServerError, ErrorTranscode, "unable to transcode", 5*time.Second)
+		return
+	}
+
+	// segment failed to transcode and is listed as gap
+	if m.isSegmentGap(index) {
+		m.httpError(w, r, http.StatusNotFound, ErrorGap, "segment could not be transcoded", 0)
 		return
 	}
 
@@ -549,42 +1589,75 @@ func (m *ManagerCtx) ServeMedia(w http.ResponseWriter, r *http.Request) {
 		if !ok {
 			// this should never happen
 			m.logger.Error().Int("index", index).Msg("media not queued even after transcode")
-			http.Error(w, "409 media not queued even after transcode", http.StatusConflict)
+			m.httpError(w, r, http.StatusConflict, ErrorConflict, "media not queued even after transcode", time.Second)
+			return
+		}
+
+		// client prefers transcode progress over waiting
+		var asyncWait <-chan time.Time
+		if wait, ok := preferAsync(r); ok {
+			if wait == 0 {
+				m.httpProgress(w, index)
+				return
+			}
+
+			asyncWait = m.clock.After(wait)
+		} else if writingPath, ok := m.getSegmentWriting(index); ok {
+			// stream segment, while it is being written
+			m.serveWritingSegment(w, r, index, writingPath, segChan)
 			return
 		}
 
 		select {
 		// waiting for new segment to be transcoded
 		case <-segChan:
+			if m.isSegmentGap(index) {
+				m.httpError(w, r, http.StatusNotFound, ErrorGap, "segment could not be transcoded", 0)
+				return
+			}
+
 			// now segment should be available
 			segmentPath, ok = m.getSegment(index)
 			if !ok || segmentPath == "" {
 				// this should never happen
 				m.logger.Error().Int("index", index).Msg("segment not found even after transcoding")
-				http.Error(w, "409 segment not found even after transcoding", http.StatusConflict)
+				m.httpError(w, r, http.StatusConflict, ErrorConflict, "segment not found even after transcoding", time.Second)
 				return
 			}
 		// when transcode stops before getting ready
 		case <-m.ctx.Done():
 			m.logger.Warn().Msg("media transcode failed because of shutdown")
-			http.Error(w, "500 media not available", http.StatusInternalServerError)
+			m.httpError(w, r, http.StatusServiceUnavailable, ErrorShutdown, "media not available", 0)
 			return
-		case <-time.After(transcodeTimeout):
+		case <-m.clock.After(transcodeTimeout):
 			m.logger.Warn().Msg("media transcode timeouted")
-			http.Error(w, "504 media timeout", http.StatusGatewayTimeout)
+			m.httpError(w, r, http.StatusGatewayTimeout, ErrorTranscodeTimeout, "media timeout", time.Second)
+			return
+		case <-asyncWait:
+			m.httpProgress(w, index)
 			return
 		}
 	}
 
-	// check if segment is on the disk
-	if _, err := os.Stat(segmentPath); os.IsNotExist(err) {
+	m.serveSegment(w, r, index, segmentPath)
+}
+
+// serves transcoded segment
+func (m *ManagerCtx) serveSegment(w http.ResponseWriter, r *http.Request, index int, segmentPath string) {
+	// check if segment is on the disk, it might have been just moved from memory
+	if _, err := m.fs.Stat(segmentPath); os.IsNotExist(err) {
+		segmentPath, _ = m.getSegment(index)
+	}
+
+	if _, err := m.fs.Stat(segmentPath); os.IsNotExist(err) {
 		m.logger.Warn().Int("index", index).Str("path", segmentPath).Msg("media file not found")
-		http.Error(w, "404 media not found", http.StatusNotFound)
+		m.httpError(w, r, http.StatusNotFound, ErrorNotFound, "media not found", 0)
 		return
 	}
 
-	// return existing segment
-	w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+	// return existing segment, container is known from requested name, as
+	// file on disk might have obfuscated name
+	w.Header().Set("Content-Type", utils.MediaContentType(r.URL.Path))
 	w.Header().Set("Cache-Control", "no-cache")
-	http.ServeFile(w, r, segmentPath)
+	m.serveFile(w, r, segmentPath)
 }
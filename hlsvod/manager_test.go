@@ -0,0 +1,768 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	waiters []fakeWaiter
+}
+
+type fakeWaiter struct {
+	at time.Time
+	ch chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ch := make(chan time.Time, 1)
+	c.waiters = append(c.waiters, fakeWaiter{c.now.Add(d), ch})
+	return ch
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) Ticker {
+	return fakeTicker{make(chan time.Time)}
+}
+
+// moves time forward and fires expired waiters
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = c.now.Add(d)
+
+	waiters := c.waiters[:0]
+	for _, w := range c.waiters {
+		if w.at.After(c.now) {
+			waiters = append(waiters, w)
+		} else {
+			w.ch <- c.now
+		}
+	}
+	c.waiters = waiters
+}
+
+func (c *fakeClock) Waiters() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.waiters)
+}
+
+type fakeTicker struct {
+	ch chan time.Time
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.ch }
+func (t fakeTicker) Stop()               {}
+
+type memFS struct {
+	mu    sync.Mutex
+	files map[string][]byte
+	free  map[string]uint64 // free space of volumes
+	now   time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{files: map[string][]byte{}}
+}
+
+type memFileInfo struct {
+	name    string
+	size    int64
+	modTime time.Time
+}
+
+func (fi memFileInfo) Name() string       { return fi.name }
+func (fi memFileInfo) Size() int64        { return fi.size }
+func (fi memFileInfo) Mode() fs.FileMode  { return 0644 }
+func (fi memFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi memFileInfo) IsDir() bool        { return false }
+func (fi memFileInfo) Sys() interface{}   { return nil }
+
+type memFile struct {
+	*bytes.Reader
+	info memFileInfo
+}
+
+func (f memFile) Close() error               { return nil }
+func (f memFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+
+type memWriter struct {
+	bytes.Buffer
+	fs   *memFS
+	name string
+}
+
+func (w *memWriter) Close() error {
+	return w.fs.WriteFile(w.name, w.Bytes(), 0644)
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return memFile{bytes.NewReader(data), memFileInfo{path.Base(name), int64(len(data)), m.now}}, nil
+}
+
+func (m *memFS) Create(name string) (io.WriteCloser, error) {
+	return &memWriter{fs: m, name: name}, nil
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return memFileInfo{path.Base(name), int64(len(data)), m.now}, nil
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	data, ok := m.files[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return data, nil
+}
+
+func (m *memFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.files[name] = append([]byte{}, data...)
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return os.ErrNotExist
+	}
+
+	delete(m.files, name)
+	return nil
+}
+
+func (m *memFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[name]; !ok {
+		return os.ErrNotExist
+	}
+
+	return nil
+}
+
+func (m *memFS) Free(name string) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	free, ok := m.free[name]
+	if !ok {
+		return 0, os.ErrNotExist
+	}
+
+	return free, nil
+}
+
+func TestManagerIdle(t *testing.T) {
+	clock := newFakeClock()
+	m := New(Config{Clock: clock, FS: newMemFS()})
+
+	m.Heartbeat()
+	clock.Advance(time.Minute)
+
+	if idle := m.Idle(); idle != time.Minute {
+		t.Errorf("Idle() = %v, want %v", idle, time.Minute)
+	}
+}
+
+func TestManagerReadyTimeout(t *testing.T) {
+	clock := newFakeClock()
+	m := New(Config{Clock: clock, FS: newMemFS(), ReadyTimeout: 10 * time.Second})
+	m.readyReset()
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/test.m3u8", nil)
+
+	done := make(chan bool)
+	go func() {
+		done <- m.httpEnsureReady(w, r)
+	}()
+
+	// wait until request starts waiting for timeout
+	for clock.Waiters() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(10 * time.Second)
+	if <-done {
+		t.Fatal("manager should not be ready")
+	}
+
+	if w.Code != http.StatusGatewayTimeout {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusGatewayTimeout)
+	}
+
+	var body HTTPError
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Code != ErrorReadyTimeout || body.State != StateStarting {
+		t.Errorf("unexpected error body %+v", body)
+	}
+}
+
+func TestManagerCacheFile(t *testing.T) {
+	fs := newMemFS()
+	m := New(Config{
+		MediaPath: "/media/test.mp4",
+		Cache:     true,
+		CacheDir:  "/cache",
+		FS:        fs,
+	})
+
+	if _, err := m.getCacheFile(cacheFileSuffix); err == nil {
+		t.Fatal("cache should be empty")
+	}
+
+	if err := m.saveCacheFile(cacheFileSuffix, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := fs.files[m.globalCachePath(cacheFileSuffix)]; !ok {
+		t.Errorf("cache was not saved to global cache path")
+	}
+
+	data, err := m.getCacheFile(cacheFileSuffix)
+	if err != nil || string(data) != "data" {
+		t.Errorf("getCacheFile() = %q, %v", data, err)
+	}
+}
+
+func TestManagerPurgeCache(t *testing.T) {
+	fs := newMemFS()
+	m := New(Config{
+		MediaPath: "/media/test.mp4",
+		Cache:     true,
+		CacheDir:  "/cache",
+		FS:        fs,
+	})
+
+	if err := m.saveCacheFile(cacheFileSuffix, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	// heatmap is not cached, but purge must not fail
+	if err := m.PurgeCache(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.getCacheFile(cacheFileSuffix); err == nil {
+		t.Errorf("cache was not purged")
+	}
+}
+
+func TestManagerObfuscatedCacheFile(t *testing.T) {
+	fs := newMemFS()
+	m := New(Config{
+		MediaPath:     "/media/test.mp4",
+		SegmentPrefix: "720p",
+		Cache:         true,
+		CacheDir:      "/cache",
+		FS:            fs,
+		ObfuscateKey:  []byte("secret"),
+	})
+
+	if err := m.saveCacheFile(cacheFileSuffix, []byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	path := m.globalCachePath(cacheFileSuffix)
+	if strings.Contains(path, cacheFileSuffix) {
+		t.Errorf("cache file name %q reveals its content", path)
+	}
+
+	stored, ok := fs.files[path]
+	if !ok {
+		t.Fatalf("cache was not saved to global cache path")
+	}
+
+	if strings.Contains(string(stored), "data") {
+		t.Errorf("cache data was not encrypted")
+	}
+
+	data, err := m.getCacheFile(cacheFileSuffix)
+	if err != nil || string(data) != "data" {
+		t.Errorf("getCacheFile() = %q, %v", data, err)
+	}
+
+	// other key must not be able to read cache
+	other := New(Config{
+		MediaPath:    "/media/test.mp4",
+		Cache:        true,
+		CacheDir:     "/cache",
+		FS:           fs,
+		ObfuscateKey: []byte("other"),
+	})
+
+	if _, err := other.readCacheFile(path); !errors.Is(err, ErrCacheDecrypt) {
+		t.Errorf("readCacheFile() with other key = %v, want %v", err, ErrCacheDecrypt)
+	}
+
+	// segments on disk do not use served prefix
+	if prefix := m.outputPrefix(); prefix == "720p" || len(prefix) != obfuscatedNameLength {
+		t.Errorf("outputPrefix() = %q, want obfuscated prefix", prefix)
+	}
+}
+
+func TestManagerSealedSegments(t *testing.T) {
+	fs := newMemFS()
+	m := New(Config{FS: fs, SegmentKey: []byte("secret")})
+
+	if err := fs.WriteFile("/segment.ts", []byte("segment data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.sealSegment("/segment.ts"); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(string(fs.files["/segment.ts"]), "segment data") {
+		t.Errorf("segment was not encrypted on disk")
+	}
+
+	// segment is decrypted while serving, also for range requests
+	r := httptest.NewRequest(http.MethodGet, "/segment.ts", nil)
+	r.Header.Set("Range", "bytes=8-")
+
+	w := httptest.NewRecorder()
+	m.serveFile(w, r, "/segment.ts")
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != "data" {
+		t.Errorf("served segment = %d %q, want %d %q", w.Code, w.Body.String(), http.StatusPartialContent, "data")
+	}
+
+	// other key must not be able to read segment
+	other := New(Config{FS: fs, SegmentKey: []byte("other")})
+	if _, err := other.openSegment("/segment.ts"); !errors.Is(err, ErrSegmentDecrypt) {
+		t.Errorf("openSegment() with other key = %v, want %v", err, ErrSegmentDecrypt)
+	}
+}
+
+func TestManagerConditionalRequests(t *testing.T) {
+	clock := newFakeClock()
+	fs := newMemFS()
+	fs.now = clock.Now()
+
+	m := New(Config{Clock: clock, FS: fs})
+	m.readyReset()
+	m.playlist = "#EXTM3U"
+	m.playlistMod = clock.Now()
+	m.readyDone()
+
+	// playlist revalidation
+	w := httptest.NewRecorder()
+	m.ServePlaylist(w, httptest.NewRequest(http.MethodGet, "/test.m3u8", nil))
+
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("status = %d, etag = %q", w.Code, etag)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/test.m3u8", nil)
+	r.Header.Set("If-None-Match", etag)
+
+	w = httptest.NewRecorder()
+	m.ServePlaylist(w, r)
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+
+	// segment revalidation
+	if err := fs.WriteFile("/segment.ts", []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/segment.ts", nil)
+	r.Header.Set("If-Modified-Since", clock.Now().Format(http.TimeFormat))
+
+	w = httptest.NewRecorder()
+	m.serveFile(w, r, "/segment.ts")
+
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
+
+// media transcoder returns fixed probe data
+type mediaTranscoder struct {
+	*FakeTranscoder
+	media *ProbeMediaData
+}
+
+func (m *mediaTranscoder) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	return m.media, nil
+}
+
+func TestManagerUnsupportedMedia(t *testing.T) {
+	m := New(Config{
+		MediaPath:  "/media/broken.mp4",
+		FS:         newMemFS(),
+		Transcoder: &mediaTranscoder{NewFakeTranscoder(0), &ProbeMediaData{}},
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	w := httptest.NewRecorder()
+	if m.httpEnsureReady(w, httptest.NewRequest(http.MethodGet, "/test.m3u8", nil)) {
+		t.Fatal("manager should not be ready")
+	}
+
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusUnprocessableEntity)
+	}
+
+	var body HTTPError
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Code != ErrorUnsupportedMedia || body.Message != ErrNoStreams.Error() {
+		t.Errorf("unexpected error body %+v", body)
+	}
+}
+
+func TestManagerCheckMedia(t *testing.T) {
+	audio := []ProbeAudioData{{CodecName: "aac"}}
+	cover := &ProbeVideoData{CodecName: "mjpeg", AttachedPic: true}
+
+	tests := []struct {
+		name     string
+		path     string
+		metadata *ProbeMediaData
+		err      error
+		video    bool
+	}{
+		{"video", "/media/movie.mp4", &ProbeMediaData{Duration: time.Minute, Video: &ProbeVideoData{CodecName: "h264"}, Audio: audio}, nil, true},
+		{"audio with cover art", "/media/song.mp3", &ProbeMediaData{Duration: time.Minute, Video: cover, Audio: audio}, nil, false},
+		{"no streams", "/media/broken.mp4", &ProbeMediaData{Duration: time.Minute}, ErrNoStreams, false},
+		{"no duration", "/media/broken.mp4", &ProbeMediaData{Audio: audio}, ErrNoDuration, false},
+		{"still image", "/media/photo.jpg", &ProbeMediaData{Duration: time.Second / 25, Video: &ProbeVideoData{CodecName: "mjpeg"}}, ErrStillImage, true},
+		{"image sequence", "/media/frame-%04d.jpg", &ProbeMediaData{Duration: time.Minute, Video: &ProbeVideoData{CodecName: "mjpeg"}}, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := New(Config{MediaPath: tt.path, FS: newMemFS(), VideoProfile: &VideoProfile{Width: 1280, Height: 720}})
+			m.metadata = tt.metadata
+
+			if err := m.checkMedia(); !errors.Is(err, tt.err) {
+				t.Errorf("checkMedia() = %v, want %v", err, tt.err)
+			}
+
+			if video := m.videoProfile() != nil; video != tt.video {
+				t.Errorf("videoProfile() != nil is %v, want %v", video, tt.video)
+			}
+		})
+	}
+}
+
+// broken transcoder writes segments to memory fs and fails at the broken
+// segment every time, -1 means it never fails
+type brokenTranscoder struct {
+	*FakeTranscoder
+	fs     *memFS
+	broken int
+}
+
+func (b *brokenTranscoder) TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error) {
+	segments := make(chan string)
+
+	go func() {
+		defer close(segments)
+
+		for i := 0; i < len(config.SegmentTimes)-1; i++ {
+			index := config.SegmentOffset + i
+			if index == b.broken {
+				config.OnError(errors.New("corrupt source region"))
+				return
+			}
+
+			name := fmt.Sprintf("%s-%05d.ts", config.SegmentPrefix, index)
+			_ = b.fs.WriteFile(path.Join(config.OutputDirPath, name), []byte("segment"), 0644)
+
+			select {
+			case segments <- name:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return segments, nil
+}
+
+func TestManagerWaitReadyFailure(t *testing.T) {
+	stopped := make(chan error, 2)
+
+	m := New(Config{
+		MediaPath:  "/media/broken.mp4",
+		FS:         newMemFS(),
+		Transcoder: &mediaTranscoder{NewFakeTranscoder(0), &ProbeMediaData{}},
+		OnStop: func(err error) {
+			stopped <- err
+		},
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.WaitReady(context.Background()); err == nil {
+		t.Fatal("unsupported media should fail to get ready")
+	}
+
+	if m.Err() == nil {
+		t.Error("cause should be kept")
+	}
+
+	if err := <-stopped; err == nil {
+		t.Error("OnStop should be called with cause")
+	}
+
+	// already reported stop is not reported again
+	m.Stop()
+	select {
+	case err := <-stopped:
+		t.Errorf("OnStop called again with %v", err)
+	default:
+	}
+	if m.Err() == nil {
+		t.Error("cause should be kept after stop")
+	}
+}
+
+// unprobeable transcoder fails to probe any media
+type unprobeableTranscoder struct {
+	*FakeTranscoder
+}
+
+func (u *unprobeableTranscoder) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	return nil, errors.New("invalid data found when processing input")
+}
+
+func TestManagerProbeFailed(t *testing.T) {
+	m := New(Config{
+		MediaPath:  "/media/broken.mp4",
+		FS:         newMemFS(),
+		Transcoder: &unprobeableTranscoder{NewFakeTranscoder(0)},
+	})
+
+	if _, err := m.Preload(context.Background()); !errors.Is(err, ErrProbeFailed) {
+		t.Errorf("Preload() = %v, want %v", err, ErrProbeFailed)
+	}
+
+	// cancelled probe is not failure of media
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := m.Preload(ctx); errors.Is(err, ErrProbeFailed) {
+		t.Errorf("Preload() of cancelled context = %v", err)
+	}
+}
+
+// panicking transcoder has nil metadata, as if probe output was not checked
+type panickingTranscoder struct {
+	*FakeTranscoder
+}
+
+func (p *panickingTranscoder) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	var metadata *ProbeMediaData
+	return metadata, fmt.Errorf("duration %v", metadata.Duration)
+}
+
+func TestManagerPanic(t *testing.T) {
+	stopped := make(chan error, 1)
+
+	m := New(Config{
+		MediaPath:  "/media/movie.mp4",
+		FS:         newMemFS(),
+		Transcoder: &panickingTranscoder{NewFakeTranscoder(0)},
+		OnStop: func(err error) {
+			stopped <- err
+		},
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	// waiting request is woken up instead of timing out
+	var panicErr *PanicError
+	if err := m.WaitReady(context.Background()); !errors.As(err, &panicErr) {
+		t.Fatalf("WaitReady() = %v, want panic error", err)
+	}
+
+	if len(panicErr.Stack) == 0 {
+		t.Error("panic error should contain stack trace")
+	}
+
+	if err := <-stopped; !errors.As(err, &panicErr) {
+		t.Errorf("OnStop called with %v, want panic error", err)
+	}
+}
+
+func TestManagerProfileConstraint(t *testing.T) {
+	m := New(Config{
+		MediaPath:    "/media/movie.mp4",
+		FS:           newMemFS(),
+		Transcoder:   NewFakeTranscoder(time.Minute),
+		VideoProfile: &VideoProfile{Width: 1280, Height: 719, Bitrate: 2800},
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	// session fails at creation, not at the first transcoded segment
+	if err := m.WaitReady(context.Background()); !errors.Is(err, ErrProfileConstraint) {
+		t.Fatalf("WaitReady() = %v, want %v", err, ErrProfileConstraint)
+	}
+}
+
+func TestManagerClipRange(t *testing.T) {
+	m := New(Config{
+		MediaPath:  "/media/movie.mp4",
+		FS:         newMemFS(),
+		Transcoder: NewFakeTranscoder(time.Minute),
+		ClipStart:  90,
+		ClipEnd:    120,
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.WaitReady(context.Background()); !errors.Is(err, ErrClipRange) {
+		t.Fatalf("WaitReady() = %v, want %v", err, ErrClipRange)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServePlaylist(w, httptest.NewRequest(http.MethodGet, "/index.m3u8", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestManagerSegmentGap(t *testing.T) {
+	fs := newMemFS()
+	fs.files["/media/video.mp4"] = make([]byte, 100)
+
+	m := New(Config{
+		MediaPath:     "/media/video.mp4",
+		TranscodeDir:  "/transcode",
+		SegmentPrefix: "test",
+		Transcoder:    &brokenTranscoder{NewFakeTranscoder(30 * time.Second), fs, 1},
+		Clock:         newFakeClock(),
+		FS:            fs,
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.Warm(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	segmentsTotal := len(m.breakpoints) - 1
+	if segmentsTotal < 3 {
+		t.Fatalf("media has %d segments, want at least 3", segmentsTotal)
+	}
+
+	// segments after broken one are transcoded
+	for i := 0; i < segmentsTotal; i++ {
+		if got := m.isSegmentTranscoded(i); got != (i != 1) {
+			t.Errorf("segment %d transcoded = %v", i, got)
+		}
+	}
+
+	playlist := m.playlist
+	if !strings.Contains(playlist, "#EXT-X-VERSION:8") || strings.Count(playlist, "#EXT-X-GAP") != 1 {
+		t.Errorf("playlist should list one gap:\n%s", playlist)
+	}
+
+	if !strings.Contains(playlist, "#EXT-X-GAP\n#EXTINF:") || !strings.Contains(playlist, "\n"+m.getSegmentName(1)) {
+		t.Errorf("gap should be listed with its segment:\n%s", playlist)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeMedia(w, httptest.NewRequest(http.MethodGet, "/"+m.getSegmentName(1), nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotFound)
+	}
+
+	var body HTTPError
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Code != ErrorGap {
+		t.Errorf("unexpected error body %+v", body)
+	}
+}
@@ -0,0 +1,123 @@
+package hlsvod
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// MediaMetadata is probed media info served to frontends, e.g. to render
+// duration and track pickers.
+type MediaMetadata struct {
+	Duration  float64            `json:"duration"` // in seconds
+	Format    []string           `json:"format"`
+	Video     *VideoMetadata     `json:"video,omitempty"`
+	Audio     []AudioMetadata    `json:"audio"`
+	Subtitles []SubtitleMetadata `json:"subtitles"`
+	Chapters  []ChapterMetadata  `json:"chapters"`
+}
+
+type VideoMetadata struct {
+	Codec     string `json:"codec"`
+	Profile   string `json:"profile,omitempty"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	PixFmt    string `json:"pix_fmt,omitempty"`
+	Keyframes int    `json:"keyframes,omitempty"` // 0 if keyframes were not probed
+}
+
+type AudioMetadata struct {
+	Index       int    `json:"index"` // index among audio streams, e.g. 1 for 0:a:1
+	Codec       string `json:"codec"`
+	Profile     string `json:"profile,omitempty"`
+	Language    string `json:"language,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Default     bool   `json:"default"`
+	Descriptive bool   `json:"descriptive"`
+	Commentary  bool   `json:"commentary"`
+}
+
+type SubtitleMetadata struct {
+	Index    int    `json:"index"` // index among subtitle streams, e.g. 1 for 0:s:1
+	Codec    string `json:"codec"`
+	Language string `json:"language,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Text     bool   `json:"text"` // can be burned into video
+}
+
+type ChapterMetadata struct {
+	Start float64 `json:"start"` // in seconds
+	End   float64 `json:"end"`   // in seconds
+	Title string  `json:"title,omitempty"`
+}
+
+// Metadata returns probe data in form served to frontends, languages of
+// tracks are normalized with overrides of mislabeled tags.
+func (data *ProbeMediaData) Metadata(languages map[string]string) MediaMetadata {
+	metadata := MediaMetadata{
+		Duration:  data.Duration.Seconds(),
+		Format:    data.FormatName,
+		Audio:     []AudioMetadata{},
+		Subtitles: []SubtitleMetadata{},
+		Chapters:  []ChapterMetadata{},
+	}
+
+	// cover art is not offered as video
+	if !data.AudioOnly() {
+		metadata.Video = &VideoMetadata{
+			Codec:     data.Video.CodecName,
+			Profile:   data.Video.Profile,
+			Width:     data.Video.Width,
+			Height:    data.Video.Height,
+			PixFmt:    data.Video.PixFmt,
+			Keyframes: len(data.Video.PktPtsTime),
+		}
+	}
+
+	for _, audio := range data.Audio {
+		metadata.Audio = append(metadata.Audio, AudioMetadata{
+			Index:       audio.Index,
+			Codec:       audio.CodecName,
+			Profile:     audio.Profile,
+			Language:    NormalizeLanguage(audio.Language, languages),
+			Title:       audio.Title,
+			Default:     audio.Default,
+			Descriptive: audio.Descriptive,
+			Commentary:  audio.Commentary,
+		})
+	}
+
+	for _, subtitle := range data.Subtitles {
+		metadata.Subtitles = append(metadata.Subtitles, SubtitleMetadata{
+			Index:    subtitle.Index,
+			Codec:    subtitle.CodecName,
+			Language: NormalizeLanguage(subtitle.Language, languages),
+			Title:    subtitle.Title,
+			Text:     subtitle.Text(),
+		})
+	}
+
+	for _, chapter := range data.Chapters {
+		metadata.Chapters = append(metadata.Chapters, ChapterMetadata{
+			Start: chapter.Start,
+			End:   chapter.End,
+			Title: chapter.Title,
+		})
+	}
+
+	return metadata
+}
+
+// ServeMetadata serves probed media info as JSON, metadata are loaded from
+// cache, if available. Session is not started.
+func (m *ManagerCtx) ServeMetadata(w http.ResponseWriter, r *http.Request) {
+	data, err := m.Preload(r.Context())
+	if err != nil {
+		m.logger.Warn().Err(err).Msg("unable to preload metadata")
+		m.httpError(w, r, http.StatusInternalServerError, ErrorTranscode, "unable to probe media", 0)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(data.Metadata(m.config.LanguageMap))
+}
@@ -0,0 +1,50 @@
+package hlsvod
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestManagerServeMetadata(t *testing.T) {
+	m := New(Config{
+		MediaPath: "/media/movie.mkv",
+		FS:        newMemFS(),
+		Transcoder: &mediaTranscoder{NewFakeTranscoder(90 * time.Second), &ProbeMediaData{
+			FormatName: []string{"matroska", "webm"},
+			Duration:   90 * time.Second,
+			Video:      &ProbeVideoData{CodecName: "h264", Width: 1920, Height: 1080, PktPtsTime: []float64{0, 30, 60}},
+			Audio:      []ProbeAudioData{{CodecName: "aac", Language: "eng", Default: true}},
+			Subtitles:  []ProbeSubtitleData{{CodecName: "hdmv_pgs_subtitle", Language: "ger"}},
+			Chapters:   []ProbeChapterData{{Start: 0, End: 45, Title: "Opening"}, {Start: 45, End: 90}},
+		}},
+	})
+
+	w := httptest.NewRecorder()
+	m.ServeMetadata(w, httptest.NewRequest(http.MethodGet, "/metadata.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", w.Code, w.Body.String())
+	}
+
+	var got MediaMetadata
+	if err := json.NewDecoder(w.Body).Decode(&got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := MediaMetadata{
+		Duration:  90,
+		Format:    []string{"matroska", "webm"},
+		Video:     &VideoMetadata{Codec: "h264", Width: 1920, Height: 1080, Keyframes: 3},
+		Audio:     []AudioMetadata{{Codec: "aac", Language: "en", Default: true}},
+		Subtitles: []SubtitleMetadata{{Codec: "hdmv_pgs_subtitle", Language: "de"}},
+		Chapters:  []ChapterMetadata{{Start: 0, End: 45, Title: "Opening"}, {Start: 45, End: 90}},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("metadata = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// keyframe interval of mezzanine files in seconds, it divides segment length,
+// so that segments can be cut by copying without reencoding
+const MezzanineKeyframeInterval = 2
+
+type MezzanineConfig struct {
+	InputFilePath  string // Pre-encoded video input.
+	OutputFilePath string // Mezzanine file, it is written only when encoding succeeds.
+
+	VideoProfile *VideoProfile
+	AudioProfile *AudioProfile
+	IONice       bool // Run with idle I/O priority, so that it does not starve reads.
+
+	Control *utils.JobControl // Pauses encoding, nil means it is never paused.
+}
+
+// returns mezzanine file name of media rendition, it does not reveal media path
+func MezzanineFileName(mediaPath string, profileID string) string {
+	hash := sha1.Sum([]byte(mediaPath + "\x00" + profileID))
+	return hex.EncodeToString(hash[:]) + ".mkv"
+}
+
+// returns true if mezzanine file exists and is not older than media
+func MezzanineFresh(mezzaninePath string, mediaPath string) bool {
+	mezzanine, err := os.Stat(mezzaninePath)
+	if err != nil {
+		return false
+	}
+
+	media, err := os.Stat(mediaPath)
+	if err != nil {
+		return false
+	}
+
+	return !mezzanine.ModTime().Before(media.ModTime())
+}
+
+func mezzanineArgs(config MezzanineConfig, outputFilePath string) []string {
+	args := []string{
+		"-loglevel", "warning",
+		"-autorotate", "0", // consistent behavior
+		"-i", config.InputFilePath,
+		"-map", "0:v:0",
+		"-map", "0:a?", // All audio streams, so that they can be selected later
+		"-sn", // No subtitles
+	}
+
+	// Video specs
+	if profile := config.VideoProfile; profile != nil {
+		var scale string
+		if profile.Width >= profile.Height {
+			scale = fmt.Sprintf("scale=-2:%d", profile.Height)
+		} else {
+			scale = fmt.Sprintf("scale=%d:-2", profile.Width)
+		}
+
+		args = append(args, []string{
+			"-vf", scale,
+			"-c:v", "libx264",
+			"-profile:v", "high",
+			"-level:v", "4.0",
+			"-preset", "medium", // Encoded only once, can be slower than live transcode
+			"-b:v", fmt.Sprintf("%dk", profile.Bitrate),
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", MezzanineKeyframeInterval),
+		}...)
+	}
+
+	// Audio specs
+	if profile := config.AudioProfile; profile != nil {
+		args = append(args, []string{
+			"-c:a", "aac",
+			"-b:a", fmt.Sprintf("%dk", profile.Bitrate),
+		}...)
+	}
+
+	return append(args, "-f", "matroska", "-y", outputFilePath)
+}
+
+// encodes media into mezzanine file, segments are later only remuxed from it
+func EncodeMezzanine(ctx context.Context, ffmpegBinary string, config MezzanineConfig) error {
+	// partial output is never seen by sessions
+	tmpFile, err := os.CreateTemp(filepath.Dir(config.OutputFilePath), ".mezzanine-*.mkv")
+	if err != nil {
+		return err
+	}
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "mezzanine").Logger()
+
+	cmd := exec.Command(ffmpegBinary, mezzanineArgs(config, tmpFile.Name())...)
+	logger.Info().Str("args", strings.Join(cmd.Args[:], " ")).Msg("starting FFmpeg process")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	if err := utils.ProcessGroupStart(ctx, cmd); err != nil {
+		return err
+	}
+
+	if config.IONice {
+		if err := utils.SetIOPriorityIdle(cmd.Process.Pid); err != nil {
+			logger.Err(err).Msg("unable to set idle I/O priority")
+		}
+	}
+
+	untrack := config.Control.Track(cmd)
+	err = utils.ProcessGroupWait(cmd)
+	untrack()
+
+	if err != nil {
+		return fmt.Errorf("%w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return os.Rename(tmpFile.Name(), config.OutputFilePath)
+}
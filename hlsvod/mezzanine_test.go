@@ -0,0 +1,74 @@
+package hlsvod
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMezzanineFresh(t *testing.T) {
+	dir := t.TempDir()
+	mediaPath := filepath.Join(dir, "media.mp4")
+	mezzaninePath := filepath.Join(dir, MezzanineFileName(mediaPath, "720p"))
+
+	if err := os.WriteFile(mediaPath, []byte("media"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if MezzanineFresh(mezzaninePath, mediaPath) {
+		t.Error("missing mezzanine is fresh")
+	}
+
+	if err := os.WriteFile(mezzaninePath, []byte("mezzanine"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if !MezzanineFresh(mezzaninePath, mediaPath) {
+		t.Error("mezzanine is not fresh")
+	}
+
+	// media replaced after mezzanine was encoded
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(mediaPath, future, future); err != nil {
+		t.Fatal(err)
+	}
+
+	if MezzanineFresh(mezzaninePath, mediaPath) {
+		t.Error("mezzanine older than media is fresh")
+	}
+}
+
+func TestMezzanineFileName(t *testing.T) {
+	name := MezzanineFileName("/media/movie.mp4", "720p")
+	if strings.Contains(name, "movie") || strings.Contains(name, "720p") {
+		t.Errorf("mezzanine file name %q reveals media", name)
+	}
+
+	if name == MezzanineFileName("/media/movie.mp4", "1080p") {
+		t.Error("profiles share mezzanine file name")
+	}
+}
+
+func TestMezzanineArgs(t *testing.T) {
+	args := strings.Join(mezzanineArgs(MezzanineConfig{
+		InputFilePath: "in.mp4",
+		VideoProfile:  &VideoProfile{Width: 1280, Height: 720, Bitrate: 2000},
+		AudioProfile:  &AudioProfile{Bitrate: 128},
+	}, "out.mkv"), " ")
+
+	for _, want := range []string{
+		"-i in.mp4",
+		"-map 0:a?",
+		"-vf scale=-2:720",
+		"-b:v 2000k",
+		"-force_key_frames expr:gte(t,n_forced*2)",
+		"-c:a aac",
+		"-f matroska -y out.mkv",
+	} {
+		if !strings.Contains(args, want) {
+			t.Errorf("args %q do not contain %q", args, want)
+		}
+	}
+}
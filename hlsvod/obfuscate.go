@@ -0,0 +1,105 @@
+package hlsvod
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// length of obfuscated names in hex characters
+const obfuscatedNameLength = 32
+
+var ErrCacheDecrypt = errors.New("unable to decrypt cache file")
+
+func (m *ManagerCtx) obfuscated() bool {
+	return len(m.config.ObfuscateKey) > 0
+}
+
+// returns HMAC of parts, so that names do not reveal media path or profile
+func (m *ManagerCtx) obfuscate(parts ...string) []byte {
+	h := hmac.New(sha256.New, m.config.ObfuscateKey)
+	for _, part := range parts {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+
+	return h.Sum(nil)
+}
+
+// returns prefix of segment files written to disk, it is mapped back to
+// served segment names by segment index
+func (m *ManagerCtx) outputPrefix() string {
+	if !m.obfuscated() {
+		return m.config.SegmentPrefix
+	}
+
+	return hex.EncodeToString(m.obfuscate("segments", m.config.MediaPath, m.config.SegmentPrefix))[:obfuscatedNameLength]
+}
+
+// returns file name of global cache file, cache is shared by all profiles
+func (m *ManagerCtx) cacheFileName(suffix string) string {
+	if !m.obfuscated() {
+		hash := sha1.Sum([]byte(m.config.MediaPath))
+		return hex.EncodeToString(hash[:]) + suffix
+	}
+
+	return hex.EncodeToString(m.obfuscate("cache", m.config.MediaPath, suffix))[:obfuscatedNameLength]
+}
+
+// returns cipher used for cache data of media
+func (m *ManagerCtx) cacheCipher() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(m.obfuscate("cache-key", m.config.MediaPath))
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// encrypts cache data, if obfuscation is enabled
+func (m *ManagerCtx) sealCacheData(data []byte) ([]byte, error) {
+	if !m.obfuscated() {
+		return data, nil
+	}
+
+	aead, err := m.cacheCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, data, nil), nil
+}
+
+// decrypts cache data, if obfuscation is enabled
+func (m *ManagerCtx) openCacheData(data []byte) ([]byte, error) {
+	if !m.obfuscated() {
+		return data, nil
+	}
+
+	aead, err := m.cacheCipher()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) < aead.NonceSize() {
+		return nil, ErrCacheDecrypt
+	}
+
+	plain, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, ErrCacheDecrypt
+	}
+
+	return plain, nil
+}
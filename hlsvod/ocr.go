@@ -0,0 +1,294 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// how long is the last subtitle shown, if its end is not known
+const ocrLastCueDuration = 5.0
+
+// OCR recognizes text of subtitle rendered to image.
+type OCR interface {
+	Recognize(ctx context.Context, imagePath string, language string) (string, error)
+}
+
+// TesseractOCR recognizes text using tesseract binary, language is ISO 639-2
+// code of subtitle stream, matching tesseract language data must be installed.
+type TesseractOCR struct {
+	Binary string // Tesseract binary, empty means tesseract in PATH.
+}
+
+// ISO 639-2/B codes, that differ from 639-2/T codes used by tesseract
+var tesseractLanguages = map[string]string{
+	"alb": "sqi", "arm": "hye", "baq": "eus", "bur": "mya", "chi": "chi_sim",
+	"cze": "ces", "dut": "nld", "fre": "fra", "geo": "kat", "ger": "deu",
+	"gre": "ell", "ice": "isl", "mac": "mkd", "may": "msa", "per": "fas",
+	"rum": "ron", "slo": "slk", "tib": "bod", "wel": "cym",
+}
+
+func (t TesseractOCR) Recognize(ctx context.Context, imagePath string, language string) (string, error) {
+	binary := t.Binary
+	if binary == "" {
+		binary = "tesseract"
+	}
+
+	if code, ok := tesseractLanguages[language]; ok {
+		language = code
+	} else if language == "" || language == "und" {
+		language = "eng"
+	}
+
+	// single block of text, subtitles have at most few lines
+	cmd := exec.CommandContext(ctx, binary, imagePath, "stdout", "-l", language, "--psm", "6")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("%w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return string(out), nil
+}
+
+type SubtitleOCRConfig struct {
+	InputFilePath  string
+	OutputFilePath string // WebVTT file, it is written only when OCR succeeds.
+	SubtitleStream int    // Index among subtitle streams, e.g. 0:s:1.
+	Language       string // ISO 639-2 language of subtitle stream.
+
+	FFmpegBinary  string
+	FFprobeBinary string
+	OCR           OCR
+
+	Control *utils.JobControl // Pauses recognition between subtitles, nil means it is never paused.
+}
+
+// returns WebVTT file name of media subtitle stream, it does not reveal media path
+func SubtitleFileName(mediaPath string, stream int) string {
+	hash := sha1.Sum([]byte(mediaPath + "\x00" + strconv.Itoa(stream)))
+	return hex.EncodeToString(hash[:]) + ".vtt"
+}
+
+// returns true if WebVTT file exists and is not older than media
+func SubtitleFresh(subtitlePath string, mediaPath string) bool {
+	return MezzanineFresh(subtitlePath, mediaPath)
+}
+
+type subtitleCue struct {
+	Start float64
+	End   float64
+	Text  string
+}
+
+// returns start times and durations (0 if unknown) of subtitle packets
+func probeSubtitlePackets(ctx context.Context, ffprobeBinary string, inputFilePath string, stream int) ([]subtitleCue, error) {
+	cmd := exec.CommandContext(ctx, ffprobeBinary,
+		"-v", "error",
+		"-select_streams", fmt.Sprintf("s:%d", stream),
+		"-show_entries", "packet=pts_time,duration_time",
+		"-of", "csv=p=0",
+		inputFilePath,
+	)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w (%s)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseSubtitlePackets(string(out)), nil
+}
+
+// parses "pts_time,duration_time" lines, packets without time are skipped
+func parseSubtitlePackets(out string) []subtitleCue {
+	cues := []subtitleCue{}
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ",")
+
+		start, err := strconv.ParseFloat(fields[0], 64)
+		if err != nil {
+			continue
+		}
+
+		cue := subtitleCue{Start: start}
+		if len(fields) > 1 {
+			if duration, err := strconv.ParseFloat(fields[1], 64); err == nil && duration > 0 {
+				cue.End = start + duration
+			}
+		}
+
+		cues = append(cues, cue)
+	}
+
+	// packet without duration is shown until the next one, e.g. PGS clears
+	// subtitles by empty display set
+	for i := range cues {
+		if cues[i].End > 0 {
+			continue
+		}
+
+		if i+1 < len(cues) {
+			cues[i].End = cues[i+1].Start
+		} else {
+			cues[i].End = cues[i].Start + ocrLastCueDuration
+		}
+	}
+
+	return cues
+}
+
+// returns ffmpeg args rendering subtitle shown at time as dark text on
+// light background, that is preferred by OCR
+func subtitleFrameArgs(config SubtitleOCRConfig, time float64, outputFilePath string) []string {
+	// input seeking is fast, but subtitle must start after seek point
+	seek := math.Max(0, time-1)
+
+	return []string{
+		"-loglevel", "error",
+		"-ss", fmt.Sprintf("%.6f", seek),
+		"-i", config.InputFilePath,
+		"-ss", fmt.Sprintf("%.6f", time-seek+0.05),
+		"-filter_complex", fmt.Sprintf("[0:v:0]drawbox=c=black:t=fill[bg];[bg][0:s:%d]overlay,format=gray,negate", config.SubtitleStream),
+		"-frames:v", "1",
+		"-y", outputFilePath,
+	}
+}
+
+// joins consecutive cues with the same text
+func mergeSubtitleCues(cues []subtitleCue) []subtitleCue {
+	merged := []subtitleCue{}
+	for _, cue := range cues {
+		if n := len(merged); n > 0 && merged[n-1].Text == cue.Text && cue.Start-merged[n-1].End < 0.1 {
+			merged[n-1].End = cue.End
+			continue
+		}
+
+		merged = append(merged, cue)
+	}
+
+	return merged
+}
+
+// formats time as WebVTT timestamp
+func webvttTime(seconds float64) string {
+	ms := int64(math.Round(seconds * 1000))
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)
+}
+
+func webvtt(cues []subtitleCue) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+
+	for _, cue := range cues {
+		fmt.Fprintf(&buf, "\n%s --> %s\n%s\n", webvttTime(cue.Start), webvttTime(cue.End), cue.Text)
+	}
+
+	return buf.Bytes()
+}
+
+// normalizes recognized text to non-empty lines
+func ocrText(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// OCRSubtitles renders every packet of bitmap subtitle stream (e.g. PGS or
+// VobSub) to image, recognizes its text and writes them as WebVTT.
+func OCRSubtitles(ctx context.Context, config SubtitleOCRConfig) error {
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "ocr").Logger()
+
+	packets, err := probeSubtitlePackets(ctx, config.FFprobeBinary, config.InputFilePath, config.SubtitleStream)
+	if err != nil {
+		return fmt.Errorf("unable to probe subtitle packets: %v", err)
+	}
+
+	tmpDir, err := os.MkdirTemp("", "go-transcode-ocr-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	imagePath := filepath.Join(tmpDir, "subtitle.png")
+
+	cues := []subtitleCue{}
+	for _, packet := range packets {
+		if err := config.Control.Wait(ctx); err != nil {
+			return err
+		}
+
+		cmd := exec.Command(config.FFmpegBinary, subtitleFrameArgs(config, packet.Start, imagePath)...)
+
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+
+		if err := utils.ProcessGroupStart(ctx, cmd); err != nil {
+			return err
+		}
+
+		untrack := config.Control.Track(cmd)
+		err := utils.ProcessGroupWait(cmd)
+		untrack()
+
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// single broken subtitle does not fail whole stream
+			logger.Warn().Err(err).Str("stderr", strings.TrimSpace(stderr.String())).
+				Float64("time", packet.Start).Msg("unable to render subtitle")
+			continue
+		}
+
+		text, err := config.OCR.Recognize(ctx, imagePath, config.Language)
+		if err != nil {
+			return fmt.Errorf("unable to recognize subtitle at %.3f: %v", packet.Start, err)
+		}
+
+		// empty packets clear previous subtitle
+		if packet.Text = ocrText(text); packet.Text != "" {
+			cues = append(cues, packet)
+		}
+	}
+
+	// partial output is never seen by sessions
+	tmpFile, err := os.CreateTemp(filepath.Dir(config.OutputFilePath), ".subtitles-*.vtt")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(webvtt(mergeSubtitleCues(cues)))
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmpFile.Name(), config.OutputFilePath)
+}
@@ -0,0 +1,100 @@
+package hlsvod
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+func TestParseSubtitlePackets(t *testing.T) {
+	// PGS packets without duration, VobSub packet with duration
+	got := parseSubtitlePackets("1.000000,N/A\n3.500000,N/A\n\n10.000000,2.000000\n20.000000,N/A\n")
+	want := []subtitleCue{
+		{Start: 1, End: 3.5},
+		{Start: 3.5, End: 10},
+		{Start: 10, End: 12},
+		{Start: 20, End: 20 + ocrLastCueDuration},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseSubtitlePackets() = %v, want %v", got, want)
+	}
+}
+
+func TestWebVTT(t *testing.T) {
+	cues := mergeSubtitleCues([]subtitleCue{
+		{Start: 1, End: 2, Text: "Hello"},
+		{Start: 2, End: 3.25, Text: "Hello"},
+		{Start: 3661.5, End: 3663, Text: "Two\nlines"},
+	})
+
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:03.250\nHello\n\n01:01:01.500 --> 01:01:03.000\nTwo\nlines\n"
+	if got := string(webvtt(cues)); got != want {
+		t.Errorf("webvtt() = %q, want %q", got, want)
+	}
+}
+
+func TestOCRText(t *testing.T) {
+	if got := ocrText("  Hello\n\n world \n\f"); got != "Hello\nworld" {
+		t.Errorf("ocrText() = %q", got)
+	}
+}
+
+type fakeOCR map[string]string
+
+func (o fakeOCR) Recognize(ctx context.Context, imagePath string, language string) (string, error) {
+	data, err := os.ReadFile(imagePath)
+	if err != nil {
+		return "", err
+	}
+
+	return o[string(data)], nil
+}
+
+func TestOCRSubtitles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell scripts are not supported")
+	}
+
+	dir := t.TempDir()
+
+	// ffprobe lists three packets, the second clears the first
+	ffprobe := filepath.Join(dir, "ffprobe")
+	if err := os.WriteFile(ffprobe, []byte("#!/bin/sh\nprintf '1.000000,N/A\\n2.000000,N/A\\n5.000000,1.500000\\n'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	// ffmpeg writes seek time of rendered frame as image
+	ffmpeg := filepath.Join(dir, "ffmpeg")
+	if err := os.WriteFile(ffmpeg, []byte("#!/bin/sh\nfor last; do :; done\nprintf '%s' \"$4\" > \"$last\"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "out.vtt")
+	err := OCRSubtitles(context.Background(), SubtitleOCRConfig{
+		InputFilePath:  "media.mkv",
+		OutputFilePath: output,
+		FFmpegBinary:   ffmpeg,
+		FFprobeBinary:  ffprobe,
+		OCR: fakeOCR{
+			"0.000000": "First\n",
+			"4.000000": "Second\n",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := "WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nFirst\n\n00:00:05.000 --> 00:00:06.500\nSecond\n"
+	if string(data) != want {
+		t.Errorf("output = %q, want %q", data, want)
+	}
+}
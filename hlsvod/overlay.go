@@ -0,0 +1,82 @@
+package hlsvod
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// positions of overlay text, text is 10px from edges
+var overlayPositions = map[string]string{
+	"top-left":     "x=10:y=10",
+	"top-right":    "x=w-tw-10:y=10",
+	"bottom-left":  "x=10:y=h-th-10",
+	"bottom-right": "x=w-tw-10:y=h-th-10",
+	"center":       "x=(w-tw)/2:y=(h-th)/2",
+}
+
+// placeholders of overlay text, that are expanded by ffmpeg for every frame
+var overlayExpansions = map[string]string{
+	"{time}": `%{localtime:%Y-%m-%d %H\:%M\:%S}`, // wall clock time
+	"{pts}":  `%{pts:hms}`,                       // media time
+}
+
+var overlayPlaceholderRegex = regexp.MustCompile(`\{time\}|\{pts\}`)
+
+// literal text must not be expanded by drawtext
+var overlayTextEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`)
+
+// Overlay is text burned into video by drawtext filter, e.g. timestamp of
+// camera feed or viewer-specific watermark of screener.
+type Overlay struct {
+	Text      string // {time} is replaced by wall clock time and {pts} by media time of frame
+	Position  string // top-left, top-right, bottom-left, bottom-right or center, top-left by default
+	FontSize  int    // in px, 24 by default
+	FontColor string // ffmpeg color, e.g. white@0.8, white by default
+	FontFile  string // default font of fontconfig, if empty
+	Box       bool   // draw semi-transparent box behind text
+}
+
+// ValidOverlayPosition returns true, if position is known, empty position
+// is the default one.
+func ValidOverlayPosition(position string) bool {
+	_, ok := overlayPositions[position]
+	return ok || position == ""
+}
+
+// Filter returns drawtext filter, that is escaped to be used in filtergraph.
+func (o Overlay) Filter() string {
+	// literal parts are escaped, placeholders are expanded
+	text, last := "", 0
+	for _, match := range overlayPlaceholderRegex.FindAllStringIndex(o.Text, -1) {
+		text += overlayTextEscaper.Replace(o.Text[last:match[0]]) + overlayExpansions[o.Text[match[0]:match[1]]]
+		last = match[1]
+	}
+	text += overlayTextEscaper.Replace(o.Text[last:])
+
+	position, ok := overlayPositions[o.Position]
+	if !ok {
+		position = overlayPositions["top-left"]
+	}
+
+	fontSize := o.FontSize
+	if fontSize <= 0 {
+		fontSize = 24
+	}
+
+	fontColor := o.FontColor
+	if fontColor == "" {
+		fontColor = "white"
+	}
+
+	filter := fmt.Sprintf("drawtext=text=%s:%s:fontsize=%d:fontcolor=%s", filterEscape(text), position, fontSize, filterEscape(fontColor))
+	if o.FontFile != "" {
+		filter += ":fontfile=" + filterEscape(o.FontFile)
+	}
+
+	if o.Box {
+		filter += ":box=1:boxcolor=black@0.5:boxborderw=5"
+	}
+
+	return filter
+}
@@ -0,0 +1,41 @@
+package hlsvod
+
+import "testing"
+
+func TestOverlayFilter(t *testing.T) {
+	tests := []struct {
+		overlay Overlay
+		want    string
+	}{
+		{
+			Overlay{Text: "cam"},
+			`drawtext=text=cam:x=10:y=10:fontsize=24:fontcolor=white`,
+		},
+		{
+			Overlay{Text: "Cam 1: 100% {time}", Position: "bottom-right", FontColor: "white@0.8", Box: true},
+			`drawtext=text=Cam 1\\: 100\\\\% %{localtime\\:%Y-%m-%d %H\\\\\\:%M\\\\\\:%S}:x=w-tw-10:y=h-th-10:fontsize=24:fontcolor=white@0.8:box=1:boxcolor=black@0.5:boxborderw=5`,
+		},
+		{
+			Overlay{Text: "It's [{pts}]", FontSize: 16, FontFile: "/fonts/mono.ttf"},
+			`drawtext=text=It\\\'s \[%{pts\\:hms}\]:x=10:y=10:fontsize=16:fontcolor=white:fontfile=/fonts/mono.ttf`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := tt.overlay.Filter(); got != tt.want {
+			t.Errorf("Filter() of %q = %s, want %s", tt.overlay.Text, got, tt.want)
+		}
+	}
+}
+
+func TestValidOverlayPosition(t *testing.T) {
+	for _, position := range []string{"", "top-left", "center", "bottom-right"} {
+		if !ValidOverlayPosition(position) {
+			t.Errorf("position %q is not valid", position)
+		}
+	}
+
+	if ValidOverlayPosition("middle") {
+		t.Error("unknown position is valid")
+	}
+}
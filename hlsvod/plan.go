@@ -0,0 +1,116 @@
+package hlsvod
+
+import (
+	"context"
+	"fmt"
+)
+
+// SegmentPlan describes how media is split into segments, so that
+// unexpected segment boundaries can be debugged without transcoding.
+type SegmentPlan struct {
+	MediaPath     string  `json:"media_path"`
+	Duration      float64 `json:"duration"`
+	Strategy      string  `json:"strategy"`
+	Growing       bool    `json:"growing"`
+	SegmentLength float64 `json:"segment_length"`
+	SegmentOffset float64 `json:"segment_offset"`
+	Keyframes     int     `json:"keyframes"` // number of probed keyframes, 0 if not probed
+	Scenes        int     `json:"scenes"`    // number of probed scene changes, 0 if not probed
+
+	Segments []PlannedSegment `json:"segments"`
+}
+
+type PlannedSegment struct {
+	Index    int     `json:"index"`
+	Start    float64 `json:"start"`
+	End      float64 `json:"end"`
+	Duration float64 `json:"duration"`
+	// What segment start is aligned to: start, clip, keyframe, scene or
+	// fixed, when it was computed from segment length.
+	Boundary string `json:"boundary"`
+}
+
+// returns name of breakpoint strategy
+func breakpointStrategyName(strategy BreakpointStrategy) string {
+	switch strategy.(type) {
+	case FixedBreakpoints:
+		return "fixed"
+	case KeyframeBreakpoints:
+		return "keyframe"
+	case SceneBreakpoints:
+		return "scene"
+	default:
+		return fmt.Sprintf("%T", strategy)
+	}
+}
+
+// PlanSegments probes media (or loads its metadata from cache) and selects
+// breakpoints the same way as manager does, but nothing is transcoded.
+func PlanSegments(ctx context.Context, config Config) (*SegmentPlan, error) {
+	m := New(config)
+	defer m.cancel()
+
+	if _, err := m.Preload(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := m.checkMedia(); err != nil {
+		return nil, err
+	}
+
+	plan := &SegmentPlan{
+		MediaPath:     config.MediaPath,
+		Duration:      m.metadata.Duration.Seconds(),
+		Strategy:      breakpointStrategyName(m.breakpointStrategy()),
+		Growing:       m.growing,
+		SegmentLength: m.segmentLength,
+		SegmentOffset: m.segmentOffset,
+		Segments:      []PlannedSegment{},
+	}
+
+	keyframes := map[float64]bool{}
+	scenes := map[float64]bool{}
+	if video := m.metadata.Video; video != nil {
+		for _, time := range video.PktPtsTime {
+			keyframes[time] = true
+		}
+		for _, time := range video.SceneTimes {
+			scenes[time] = true
+		}
+		plan.Keyframes = len(video.PktPtsTime)
+		plan.Scenes = len(video.SceneTimes)
+	}
+
+	if m.growing {
+		plan.Strategy = "growing"
+	}
+
+	clipped := m.config.ClipStart > 0 || m.config.ClipEnd > 0
+
+	breakpoints := m.getBreakpoints()
+	for i := 0; i < len(breakpoints)-1; i++ {
+		start, end := breakpoints[i], breakpoints[i+1]
+
+		boundary := "fixed"
+		switch {
+		case i == 0 && clipped:
+			boundary = "clip"
+		case i == 0:
+			boundary = "start"
+		case keyframes[start]:
+			boundary = "keyframe"
+		case scenes[start]:
+			boundary = "scene"
+		}
+
+		plan.Segments = append(plan.Segments, PlannedSegment{
+			Index:    i,
+			Start:    start,
+			End:      end,
+			Duration: end - start,
+			Boundary: boundary,
+		})
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,63 @@
+package hlsvod
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanSegments(t *testing.T) {
+	transcoder := &sceneTranscoder{
+		FakeTranscoder: NewFakeTranscoder(12 * time.Second),
+		scenes:         []float64{3.5, 7.5},
+	}
+
+	plan, err := PlanSegments(context.Background(), Config{
+		MediaPath:   "media.mp4",
+		Breakpoints: SceneBreakpoints{},
+		Transcoder:  transcoder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []PlannedSegment{
+		{Index: 0, Start: 0, End: 3.5, Duration: 3.5, Boundary: "start"},
+		{Index: 1, Start: 3.5, End: 7.5, Duration: 4, Boundary: "scene"},
+		{Index: 2, Start: 7.5, End: 12, Duration: 4.5, Boundary: "scene"},
+	}
+
+	if !reflect.DeepEqual(plan.Segments, want) {
+		t.Errorf("segments = %+v, want %+v", plan.Segments, want)
+	}
+
+	if plan.Strategy != "scene" || plan.Scenes != 2 || plan.Duration != 12 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+}
+
+func TestPlanSegmentsKeyframes(t *testing.T) {
+	plan, err := PlanSegments(context.Background(), Config{
+		MediaPath:      "media.mp4",
+		VideoKeyframes: true,
+		ClipStart:      1,
+		Transcoder:     NewFakeTranscoder(10 * time.Second),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	boundaries := []string{}
+	for _, segment := range plan.Segments {
+		boundaries = append(boundaries, segment.Boundary)
+	}
+
+	if want := []string{"clip", "keyframe", "keyframe"}; !reflect.DeepEqual(boundaries, want) {
+		t.Errorf("boundaries = %v, want %v (segments %+v)", boundaries, want, plan.Segments)
+	}
+
+	if plan.Strategy != "keyframe" || plan.Keyframes != 10 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+}
@@ -0,0 +1,117 @@
+package hlsvod
+
+import "sort"
+
+// DefaultPreset is x264 preset of profiles without preset.
+const DefaultPreset = "faster"
+
+// Presets are x264 presets from the fastest to the slowest.
+var Presets = []string{
+	"ultrafast",
+	"superfast",
+	"veryfast",
+	"faster",
+	"fast",
+	"medium",
+	"slow",
+	"slower",
+	"veryslow",
+}
+
+// encode time of presets relative to ultrafast, roughly measured on 1080p
+var presetCost = map[string]float64{
+	"ultrafast": 1,
+	"superfast": 1.5,
+	"veryfast":  2.2,
+	"faster":    3.2,
+	"fast":      4.5,
+	"medium":    5.5,
+	"slow":      8.5,
+	"slower":    18,
+	"veryslow":  40,
+}
+
+const (
+	// pixels encoded per second by single CPU using ultrafast preset
+	presetCorePixelRate = 150e6
+
+	// frame rate assumed for profiles, media frame rate is not known yet
+	presetFramerate = 30
+
+	// auto presets are not slower than this, slower presets gain little
+	// compression for their cost
+	presetAutoSlowest = "medium"
+
+	// share of CPUs used by encoding, rest is left for decoding and muxing
+	presetAutoHeadroom = 0.75
+)
+
+// ValidPreset returns true, if preset is known x264 preset.
+func ValidPreset(preset string) bool {
+	_, ok := presetCost[preset]
+	return ok
+}
+
+// returns preset of profile, default if not set
+func profilePreset(profile *VideoProfile) string {
+	if profile.Preset == "" {
+		return DefaultPreset
+	}
+
+	return profile.Preset
+}
+
+// PresetLoad returns number of CPUs needed to encode profile in real time
+// using preset.
+func PresetLoad(profile VideoProfile, preset string) float64 {
+	framerate := float64(presetFramerate)
+	if profile.Preview {
+		framerate = 1
+	}
+
+	pixelRate := float64(profile.Width*profile.Height) * framerate
+	return pixelRate * presetCost[preset] / presetCorePixelRate
+}
+
+// AutoPresets returns preset of every profile without preset. It is the
+// slowest preset, that encodes all profiles at once in real time using
+// available CPUs. Profiles with preset keep it and their load is counted.
+// The fastest preset is used, when no preset is fast enough.
+func AutoPresets(profiles map[string]VideoProfile, cpus float64) map[string]string {
+	budget := cpus * presetAutoHeadroom
+
+	names := []string{}
+	for name, profile := range profiles {
+		if profile.Preset != "" {
+			budget -= PresetLoad(profile, profile.Preset)
+			continue
+		}
+
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	preset := Presets[0]
+	for _, candidate := range Presets {
+		load := 0.0
+		for _, name := range names {
+			load += PresetLoad(profiles[name], candidate)
+		}
+
+		if load > budget {
+			break
+		}
+
+		preset = candidate
+		if candidate == presetAutoSlowest {
+			break
+		}
+	}
+
+	presets := map[string]string{}
+	for _, name := range names {
+		presets[name] = preset
+	}
+
+	return presets
+}
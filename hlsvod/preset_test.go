@@ -0,0 +1,48 @@
+package hlsvod
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAutoPresets(t *testing.T) {
+	ladder := map[string]VideoProfile{
+		"360p":  {Width: 640, Height: 360},
+		"720p":  {Width: 1280, Height: 720},
+		"1080p": {Width: 1920, Height: 1080},
+	}
+
+	tests := []struct {
+		cpus   float64
+		preset string
+	}{
+		{0.5, "ultrafast"}, // even the fastest preset is not sufficient
+		{2, "veryfast"},
+		{4, "fast"},
+		{64, "medium"}, // slower presets are not picked
+	}
+
+	for _, test := range tests {
+		want := map[string]string{"360p": test.preset, "720p": test.preset, "1080p": test.preset}
+		if got := AutoPresets(ladder, test.cpus); !reflect.DeepEqual(got, want) {
+			t.Errorf("AutoPresets(%v) = %v, want %v", test.cpus, got, want)
+		}
+	}
+
+	// overridden profile keeps its preset and its load is counted
+	ladder["1080p"] = VideoProfile{Width: 1920, Height: 1080, Preset: "slow"}
+	want := map[string]string{"360p": "ultrafast", "720p": "ultrafast"}
+	if got := AutoPresets(ladder, 4); !reflect.DeepEqual(got, want) {
+		t.Errorf("AutoPresets() = %v, want %v", got, want)
+	}
+}
+
+func TestProfilePreset(t *testing.T) {
+	if preset := profilePreset(&VideoProfile{}); preset != DefaultPreset {
+		t.Errorf("preset = %q", preset)
+	}
+
+	if preset := profilePreset(&VideoProfile{Preset: "veryfast"}); preset != "veryfast" {
+		t.Errorf("preset = %q", preset)
+	}
+}
@@ -7,8 +7,12 @@ import (
 	"fmt"
 	"log"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -16,19 +20,29 @@ type ProbeMediaData struct {
 	FormatName []string
 	Duration   time.Duration
 
-	Video *ProbeVideoData
-	Audio []ProbeAudioData
+	Video     *ProbeVideoData
+	Audio     []ProbeAudioData
+	Subtitles []ProbeSubtitleData
+	Fonts     []ProbeFontData // Fonts attached to container, e.g. for ASS subtitles in MKV.
+	Chapters  []ProbeChapterData
 }
 
 func ProbeMedia(ctx context.Context, ffprobeBinary string, inputFilePath string) (*ProbeMediaData, error) {
+	return probeMedia(ctx, ffprobeBinary, inputFilePath, 0)
+}
+
+func probeMedia(ctx context.Context, ffprobeBinary string, inputFilePath string, imageFramerate float64) (*ProbeMediaData, error) {
 	args := []string{
 		"-v", "error", // Hide debug information
-		"-show_format",  // Show container information
-		"-show_streams", // Show codec information
+		"-show_format",   // Show container information
+		"-show_streams",  // Show codec information
+		"-show_chapters", // Show chapter list
 		"-of", "json",
-		inputFilePath,
 	}
 
+	args = append(args, imageInputArgs(inputFilePath, imageFramerate)...)
+	args = append(args, inputFilePath)
+
 	cmd := exec.CommandContext(ctx, ffprobeBinary, args...)
 
 	var stdout, stderr bytes.Buffer
@@ -45,17 +59,33 @@ func ProbeMedia(ctx context.Context, ffprobeBinary string, inputFilePath string)
 
 	out := struct {
 		Streams []struct {
+			Index     int    `json:"index"`
 			CodecName string `json:"codec_name"`
 			CodecType string `json:"codec_type"`
 			Duration  string `json:"duration"`
 
+			Profile string `json:"profile"`
+
 			// For video streams.
-			Width  int `json:"width"`
-			Height int `json:"height"`
+			Width      int    `json:"width"`
+			Height     int    `json:"height"`
+			Level      int    `json:"level"`
+			PixFmt     string `json:"pix_fmt"`
+			HasBFrames int    `json:"has_b_frames"`
+			FrameRate  string `json:"avg_frame_rate"`
+			RFrameRate string `json:"r_frame_rate"`
 
 			// For audio streams.
 			BitRate string `json:"bit_rate"`
+
+			Disposition map[string]int    `json:"disposition"`
+			Tags        map[string]string `json:"tags"`
 		} `json:"streams"`
+		Chapters []struct {
+			StartTime string            `json:"start_time"`
+			EndTime   string            `json:"end_time"`
+			Tags      map[string]string `json:"tags"`
+		} `json:"chapters"`
 		Format struct {
 			FormatName string `json:"format_name"`
 			Duration   string `json:"duration"`
@@ -78,14 +108,29 @@ func ProbeMedia(ctx context.Context, ffprobeBinary string, inputFilePath string)
 
 		switch stream.CodecType {
 		case "video":
+			// cover art of audio files, real video is preferred
+			attachedPic := stream.Disposition["attached_pic"] == 1
 			if data.Video != nil {
-				log.Printf("found multiple video streams for %s\n", inputFilePath)
+				if attachedPic || !data.Video.AttachedPic {
+					log.Printf("found multiple video streams for %s\n", inputFilePath)
+				}
+				if attachedPic {
+					continue
+				}
 			}
 
 			data.Video = &ProbeVideoData{
-				Width:    stream.Width,
-				Height:   stream.Height,
-				Duration: duration,
+				Width:      stream.Width,
+				Height:     stream.Height,
+				Duration:   duration,
+				CodecName:  stream.CodecName,
+				Profile:    stream.Profile,
+				Level:      stream.Level,
+				PixFmt:     stream.PixFmt,
+				HasBFrames: stream.HasBFrames,
+				FrameRate:  parseFrameRate(stream.FrameRate, stream.RFrameRate),
+
+				AttachedPic: attachedPic,
 			}
 		case "audio":
 			var bitRate float64
@@ -96,11 +141,54 @@ func ProbeMedia(ctx context.Context, ffprobeBinary string, inputFilePath string)
 				}
 			}
 
+			title := stream.Tags["title"]
 			data.Audio = append(data.Audio, ProbeAudioData{
-				BitRate:  bitRate,
-				Duration: duration,
+				BitRate:   bitRate,
+				Duration:  duration,
+				CodecName: stream.CodecName,
+				Profile:   stream.Profile,
+
+				Index:       len(data.Audio),
+				Language:    stream.Tags["language"],
+				Title:       title,
+				Default:     stream.Disposition["default"] == 1,
+				Descriptive: stream.Disposition["visual_impaired"] == 1 || audioDescriptionRegex.MatchString(title),
+				Commentary:  stream.Disposition["comment"] == 1 || audioCommentaryRegex.MatchString(title),
+			})
+		case "subtitle":
+			data.Subtitles = append(data.Subtitles, ProbeSubtitleData{
+				CodecName: stream.CodecName,
+				Index:     len(data.Subtitles),
+				Language:  stream.Tags["language"],
+				Title:     stream.Tags["title"],
 			})
+		case "attachment":
+			filename := stream.Tags["filename"]
+			if isFontAttachment(filename, stream.Tags["mimetype"]) {
+				data.Fonts = append(data.Fonts, ProbeFontData{
+					Stream:   stream.Index,
+					Filename: filename,
+				})
+			}
+		}
+	}
+
+	for _, chapter := range out.Chapters {
+		start, err := strconv.ParseFloat(chapter.StartTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse chapter start: %v", err)
+		}
+
+		end, err := strconv.ParseFloat(chapter.EndTime, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse chapter end: %v", err)
 		}
+
+		data.Chapters = append(data.Chapters, ProbeChapterData{
+			Start: start,
+			End:   end,
+			Title: chapter.Tags["title"],
+		})
 	}
 
 	if out.Format.FormatName != "" {
@@ -114,31 +202,97 @@ func ProbeMedia(ctx context.Context, ffprobeBinary string, inputFilePath string)
 		}
 	}
 
+	// some containers of audio files report only duration of streams
+	if data.Duration == 0 && data.AudioOnly() {
+		for _, audio := range data.Audio {
+			if audio.Duration > data.Duration {
+				data.Duration = audio.Duration
+			}
+		}
+	}
+
 	return &data, nil
 }
 
+// parses the first known frame rate reported by ffprobe, e.g. 30000/1001,
+// unknown rate is reported as 0/0
+func parseFrameRate(rates ...string) float64 {
+	for _, rate := range rates {
+		parts := strings.SplitN(rate, "/", 2)
+		if len(parts) == 1 {
+			parts = append(parts, "1")
+		}
+
+		n, err := strconv.ParseFloat(parts[0], 64)
+		if err != nil {
+			continue
+		}
+
+		d, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil || d == 0 || n <= 0 {
+			continue
+		}
+
+		return n / d
+	}
+
+	return 0
+}
+
+// AudioOnly returns true, if media has no video, except for cover art. Such
+// media have no keyframes, segment times are computed from duration.
+func (data *ProbeMediaData) AudioOnly() bool {
+	return data.Video == nil || data.Video.AttachedPic
+}
+
 type ProbeVideoData struct {
 	Width      int
 	Height     int
 	Duration   time.Duration
 	PktPtsTime []float64
+	SceneTimes []float64 // Probed only for scene breakpoints.
+
+	CodecName  string
+	Profile    string
+	Level      int
+	PixFmt     string
+	HasBFrames int
+	FrameRate  float64 // 0 if unknown.
+
+	AttachedPic bool // Cover art of audio file, single still image.
 }
 
 func ProbeVideo(ctx context.Context, ffprobeBinary string, inputFilePath string) (*ProbeVideoData, error) {
+	return probeVideo(ctx, ffprobeBinary, FFmpegVersion{}, inputFilePath, 0)
+}
+
+func probeVideo(ctx context.Context, ffprobeBinary string, version FFmpegVersion, inputFilePath string, imageFramerate float64) (*ProbeVideoData, error) {
+	return probeVideoInterval(ctx, ffprobeBinary, version, inputFilePath, imageFramerate, "")
+}
+
+// probes keyframes only in read interval of ffprobe (e.g. "60%120"), empty
+// interval means whole media
+func probeVideoInterval(ctx context.Context, ffprobeBinary string, version FFmpegVersion, inputFilePath string, imageFramerate float64, interval string) (*ProbeVideoData, error) {
 	args := []string{
 		"-v", "error", // Hide debug information
 
 		// video
 		"-skip_frame", "nokey",
-		"-show_entries", "frame=pkt_pts_time", // List all I frames
+		"-show_entries", version.frameTimeEntries(), // List all I frames
 		"-show_entries", "format=duration",
 		"-show_entries", "stream=duration,width,height",
 		"-select_streams", "v", // Video stream only, we're not interested in audio
 
 		"-of", "json",
-		inputFilePath,
 	}
 
+	if interval != "" {
+		args = append(args, "-read_intervals", interval)
+	}
+
+	args = append(args, imageInputArgs(inputFilePath, imageFramerate)...)
+	args = append(args, inputFilePath)
+
 	cmd := exec.CommandContext(ctx, ffprobeBinary, args...)
 
 	var stdout, stderr bytes.Buffer
@@ -156,6 +310,7 @@ func ProbeVideo(ctx context.Context, ffprobeBinary string, inputFilePath string)
 	out := struct {
 		Frames []struct {
 			PktPtsTime string `json:"pkt_pts_time"`
+			PtsTime    string `json:"pts_time"` // since ffprobe 5.0
 		} `json:"frames"`
 		Streams []struct {
 			Width    int    `json:"width"`
@@ -192,11 +347,16 @@ func ProbeVideo(ctx context.Context, ffprobeBinary string, inputFilePath string)
 	}
 
 	for _, frame := range out.Frames {
-		if frame.PktPtsTime == "" {
+		ptsTime := frame.PtsTime
+		if ptsTime == "" {
+			ptsTime = frame.PktPtsTime
+		}
+
+		if ptsTime == "" {
 			continue
 		}
 
-		pktPtsTime, err := strconv.ParseFloat(frame.PktPtsTime, 64)
+		pktPtsTime, err := strconv.ParseFloat(ptsTime, 64)
 		if err != nil {
 			return nil, err
 		}
@@ -207,11 +367,202 @@ func ProbeVideo(ctx context.Context, ffprobeBinary string, inputFilePath string)
 	return &data, nil
 }
 
+// minimum length of interval, that is worth separate ffprobe run
+const probeIntervalMin = 10 * time.Minute
+
+// keyframes closer than this are the same keyframe found by adjacent intervals
+const probeKeyframeEpsilon = 1e-6
+
+// probes keyframes of long video by parallel ffprobe runs over intervals of
+// media and merges them, short videos and images are probed by single run
+func probeVideoParallel(ctx context.Context, ffprobeBinary string, version FFmpegVersion, inputFilePath string, imageFramerate float64, workers int) (*ProbeVideoData, error) {
+	if workers <= 1 || len(imageInputArgs(inputFilePath, imageFramerate)) > 0 {
+		return probeVideo(ctx, ffprobeBinary, version, inputFilePath, imageFramerate)
+	}
+
+	duration, err := probeDuration(ctx, ffprobeBinary, inputFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	intervals := int(duration / probeIntervalMin)
+	if intervals > workers {
+		intervals = workers
+	}
+
+	if intervals <= 1 {
+		return probeVideo(ctx, ffprobeBinary, version, inputFilePath, imageFramerate)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make([]*ProbeVideoData, intervals)
+	errs := make([]error, intervals)
+	length := duration.Seconds() / float64(intervals)
+
+	var wg sync.WaitGroup
+	for i := 0; i < intervals; i++ {
+		// each run seeks to keyframe before its start, so that no keyframe
+		// is missed between intervals, the last one reads until the end
+		interval := fmt.Sprintf("%f%%%f", float64(i)*length, float64(i+1)*length)
+		if i == intervals-1 {
+			interval = fmt.Sprintf("%f%%", float64(i)*length)
+		}
+
+		wg.Add(1)
+		go func(i int, interval string) {
+			defer wg.Done()
+
+			results[i], errs[i] = probeVideoInterval(ctx, ffprobeBinary, version, inputFilePath, imageFramerate, interval)
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, interval)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return mergeVideoIntervals(results), nil
+}
+
+// merges keyframes of intervals, keyframes found by multiple intervals are
+// listed only once
+func mergeVideoIntervals(results []*ProbeVideoData) *ProbeVideoData {
+	data := *results[0]
+	data.PktPtsTime = []float64{}
+
+	keyframes := []float64{}
+	for _, result := range results {
+		keyframes = append(keyframes, result.PktPtsTime...)
+	}
+	sort.Float64s(keyframes)
+
+	for _, keyframe := range keyframes {
+		if n := len(data.PktPtsTime); n > 0 && keyframe-data.PktPtsTime[n-1] < probeKeyframeEpsilon {
+			continue
+		}
+
+		data.PktPtsTime = append(data.PktPtsTime, keyframe)
+	}
+
+	return &data
+}
+
+// returns duration of media container
+func probeDuration(ctx context.Context, ffprobeBinary string, inputFilePath string) (time.Duration, error) {
+	cmd := exec.CommandContext(ctx, ffprobeBinary,
+		"-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "json",
+		inputFilePath,
+	)
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("%w: %s", err, stderr.String())
+	}
+
+	out := struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}{}
+
+	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
+		return 0, err
+	}
+
+	if out.Format.Duration == "" {
+		return 0, nil
+	}
+
+	return time.ParseDuration(out.Format.Duration + "s")
+}
+
 type ProbeAudioData struct {
 	Duration time.Duration
 	BitRate  float64
+
+	CodecName string
+	Profile   string
+
+	Index       int    // Index among audio streams, e.g. 0:a:1.
+	Language    string // ISO 639 language tag.
+	Title       string
+	Default     bool
+	Descriptive bool // Audio description of video for visually impaired.
+	Commentary  bool
+}
+
+type ProbeSubtitleData struct {
+	CodecName string
+
+	Index    int    // Index among subtitle streams, e.g. 0:s:1.
+	Language string // ISO 639 language tag.
+	Title    string
 }
 
+// Text returns true, if subtitles can be rendered by subtitles filter,
+// bitmap subtitles (e.g. PGS or DVD) cannot.
+func (s ProbeSubtitleData) Text() bool {
+	switch s.CodecName {
+	case "ass", "ssa", "subrip", "srt", "webvtt", "mov_text", "text":
+		return true
+	}
+
+	return false
+}
+
+// Bitmap returns true, if subtitles are images, that must be recognized by
+// OCR to get their text.
+func (s ProbeSubtitleData) Bitmap() bool {
+	switch s.CodecName {
+	case "hdmv_pgs_subtitle", "dvd_subtitle", "dvb_subtitle", "xsub":
+		return true
+	}
+
+	return false
+}
+
+type ProbeChapterData struct {
+	Start float64 // in seconds
+	End   float64 // in seconds
+	Title string
+}
+
+type ProbeFontData struct {
+	Stream   int    // Absolute index of attachment stream.
+	Filename string // File name stored in container, it is not trusted.
+}
+
+// returns true, if attachment is a font
+func isFontAttachment(filename, mimetype string) bool {
+	mimetype = strings.ToLower(mimetype)
+	if strings.Contains(mimetype, "font") || strings.Contains(mimetype, "truetype") || strings.Contains(mimetype, "opentype") {
+		return true
+	}
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".ttf", ".otf", ".ttc":
+		return true
+	}
+
+	return false
+}
+
+// audio stream titles, that are used when disposition is not set
+var audioDescriptionRegex = regexp.MustCompile(`(?i)audio description|described video|descriptive`)
+var audioCommentaryRegex = regexp.MustCompile(`(?i)commentary`)
+
 func ProbeAudio(ctx context.Context, ffprobeBinary string, inputFilePath string) (*ProbeAudioData, error) {
 	args := []string{
 		"-v", "error", // Hide debug information
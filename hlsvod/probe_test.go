@@ -0,0 +1,171 @@
+package hlsvod
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// audio transcoder fails the test, when keyframes are probed
+type audioTranscoder struct {
+	*FakeTranscoder
+	t *testing.T
+}
+
+func (a *audioTranscoder) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	return &ProbeMediaData{
+		FormatName: []string{"mp3"},
+		Duration:   a.Duration,
+		Video:      &ProbeVideoData{CodecName: "mjpeg", AttachedPic: true},
+		Audio:      []ProbeAudioData{{CodecName: "mp3", Duration: a.Duration}},
+	}, nil
+}
+
+func (a *audioTranscoder) ProbeVideo(ctx context.Context, inputFilePath string) (*ProbeVideoData, error) {
+	a.t.Error("keyframes of audio-only media were probed")
+	return a.FakeTranscoder.ProbeVideo(ctx, inputFilePath)
+}
+
+func TestProbeMediaAudioOnly(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires POSIX shell")
+	}
+
+	// ffprobe of MP3 with cover art, duration is reported only by stream
+	script := filepath.Join(t.TempDir(), "ffprobe")
+	output := `{"streams": [
+	{"index": 0, "codec_name": "mp3", "codec_type": "audio", "duration": "245.5"},
+	{"index": 1, "codec_name": "mjpeg", "codec_type": "video", "width": 500, "height": 500, "disposition": {"attached_pic": 1}}
+], "format": {"format_name": "mp3"}}`
+
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat <<'EOF'\n"+output+"\nEOF\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ProbeMedia(context.Background(), script, "song.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !data.AudioOnly() {
+		t.Errorf("media with cover art is not audio-only")
+	}
+
+	if want := 245500 * time.Millisecond; data.Duration != want {
+		t.Errorf("duration = %v, want %v", data.Duration, want)
+	}
+
+	// media with video has keyframes
+	video := &ProbeMediaData{Video: &ProbeVideoData{CodecName: "h264"}}
+	if video.AudioOnly() {
+		t.Errorf("media with video is audio-only")
+	}
+}
+
+func TestProbeMediaChapters(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires POSIX shell")
+	}
+
+	script := filepath.Join(t.TempDir(), "ffprobe")
+	output := `{"streams": [{"index": 0, "codec_name": "h264", "codec_type": "video", "width": 1280, "height": 720}],
+"chapters": [
+	{"id": 0, "start_time": "0.000000", "end_time": "300.500000", "tags": {"title": "Intro"}},
+	{"id": 1, "start_time": "300.500000", "end_time": "600.000000"}
+], "format": {"format_name": "matroska,webm", "duration": "600.0"}}`
+
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat <<'EOF'\n"+output+"\nEOF\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ProbeMedia(context.Background(), script, "movie.mkv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []ProbeChapterData{{Start: 0, End: 300.5, Title: "Intro"}, {Start: 300.5, End: 600}}
+	if !reflect.DeepEqual(data.Chapters, want) {
+		t.Errorf("chapters = %+v, want %+v", data.Chapters, want)
+	}
+}
+
+func TestFetchMetadataAudioOnly(t *testing.T) {
+	m := New(Config{
+		MediaPath:      "/media/song.mp3",
+		VideoKeyframes: true,
+		Transcoder:     &audioTranscoder{NewFakeTranscoder(10 * time.Second), t},
+	})
+
+	if err := m.fetchMetadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	breakpoints := m.breakpointStrategy().Breakpoints(m.metadata, 4, 1)
+	if len(breakpoints) < 2 || breakpoints[0] != 0 || breakpoints[len(breakpoints)-1] != 10 {
+		t.Errorf("breakpoints = %v, want from 0 to duration", breakpoints)
+	}
+}
+
+func TestProbeVideoParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires POSIX shell")
+	}
+
+	// ffprobe reporting keyframes every 10 minutes of hour long video, runs
+	// seek to keyframe before interval start, so boundaries are reported twice
+	script := filepath.Join(t.TempDir(), "ffprobe")
+	err := os.WriteFile(script, []byte(`#!/bin/sh
+interval=""
+while [ $# -gt 0 ]; do
+	if [ "$1" = "-read_intervals" ]; then interval="$2"; fi
+	shift
+done
+
+case "$interval" in
+	"") echo '{"format": {"duration": "3600.0"}}' ;;
+	0.000000%*) echo '{"frames": [{"pts_time": "0.0"}, {"pts_time": "600.0"}, {"pts_time": "1200.0"}], "streams": [{"width": 1920, "height": 1080}], "format": {"duration": "3600.0"}}' ;;
+	1200.000000%*) echo '{"frames": [{"pts_time": "1200.0"}, {"pts_time": "1800.0"}, {"pts_time": "2400.0"}], "streams": [{"width": 1920, "height": 1080}], "format": {"duration": "3600.0"}}' ;;
+	2400.000000%) echo '{"frames": [{"pts_time": "2400.0"}, {"pts_time": "3000.0"}], "streams": [{"width": 1920, "height": 1080}], "format": {"duration": "3600.0"}}' ;;
+	*) echo "unexpected interval $interval" >&2; exit 1 ;;
+esac
+`), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := probeVideoParallel(context.Background(), script, FFmpegVersion{}, "movie.mkv", 0, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []float64{0, 600, 1200, 1800, 2400, 3000}
+	if !reflect.DeepEqual(data.PktPtsTime, want) {
+		t.Errorf("keyframes = %v, want %v", data.PktPtsTime, want)
+	}
+
+	if data.Width != 1920 || data.Height != 1080 || data.Duration != time.Hour {
+		t.Errorf("unexpected video data %+v", data)
+	}
+}
+
+func TestParseFrameRate(t *testing.T) {
+	tests := []struct {
+		rates []string
+		want  float64
+	}{
+		{[]string{"30000/1001", "30/1"}, 30000.0 / 1001},
+		{[]string{"0/0", "25/1"}, 25},
+		{[]string{"0/0", "0/0"}, 0},
+		{[]string{"24"}, 24},
+	}
+
+	for _, test := range tests {
+		if got := parseFrameRate(test.rates...); got != test.want {
+			t.Errorf("parseFrameRate(%q) = %v, want %v", test.rates, got, test.want)
+		}
+	}
+}
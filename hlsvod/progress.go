@@ -0,0 +1,131 @@
+package hlsvod
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// longest wait for segment, that client can prefer before asynchronous response
+const progressWaitMax = 30 * time.Second
+
+// intervals between ready segments longer than this are not used for estimates,
+// e.g. when transcoding was idle in between
+const progressIntervalMax = time.Minute
+
+// SegmentProgress is returned with 202 Accepted instead of waiting for segment,
+// when client prefers asynchronous response.
+type SegmentProgress struct {
+	Index         int     `json:"index"`
+	State         string  `json:"state"`
+	QueuePosition int     `json:"queue_position"` // segments transcoded before requested one
+	Transcoded    int     `json:"transcoded"`     // transcoded segments of session
+	Total         int     `json:"total"`          // all segments of session
+	RetryAfter    float64 `json:"retry_after"`    // estimated seconds until segment is ready
+}
+
+// returns how long client waits for segment, before it is answered with
+// progress, when it sends "Prefer: respond-async" (optionally with "wait=N")
+func preferAsync(r *http.Request) (time.Duration, bool) {
+	async, wait := false, time.Duration(0)
+
+	for _, header := range r.Header.Values("Prefer") {
+		for _, pref := range strings.Split(header, ",") {
+			pref = strings.ToLower(strings.TrimSpace(pref))
+
+			if pref == "respond-async" {
+				async = true
+			} else if strings.HasPrefix(pref, "wait=") {
+				seconds, err := strconv.Atoi(strings.TrimPrefix(pref, "wait="))
+				if err == nil && seconds > 0 {
+					wait = time.Duration(seconds) * time.Second
+				}
+			}
+		}
+	}
+
+	if wait > progressWaitMax {
+		wait = progressWaitMax
+	}
+
+	return wait, async
+}
+
+// records when segment became ready, so that time per segment can be
+// estimated, segments lock must be held
+func (m *ManagerCtx) progressRecord() {
+	now := m.clock.Now()
+
+	if !m.segmentReadyAt.IsZero() {
+		if interval := now.Sub(m.segmentReadyAt); interval < progressIntervalMax {
+			if m.segmentInterval == 0 {
+				m.segmentInterval = interval
+			} else {
+				m.segmentInterval = (3*m.segmentInterval + interval) / 4
+			}
+		}
+	}
+
+	m.segmentReadyAt = now
+}
+
+func (m *ManagerCtx) segmentProgress(index int) SegmentProgress {
+	// segments are transcoded in order, queued segments before requested
+	// one are transcoded first
+	m.segmentQueueMu.RLock()
+	position := 0
+	for i := index - 1; i >= 0; i-- {
+		if _, ok := m.segmentQueue[i]; !ok {
+			break
+		}
+		position++
+	}
+	m.segmentQueueMu.RUnlock()
+
+	state := m.state()
+
+	m.segmentsMu.RLock()
+	defer m.segmentsMu.RUnlock()
+
+	progress := SegmentProgress{
+		Index:         index,
+		State:         state,
+		QueuePosition: position,
+		Total:         len(m.breakpoints) - 1,
+	}
+
+	for _, segmentName := range m.segments {
+		if segmentName != "" {
+			progress.Transcoded++
+		}
+	}
+
+	// without measurements, segment is expected to be transcoded in real time
+	interval := m.segmentInterval
+	if interval == 0 && index+1 < len(m.breakpoints) {
+		interval = time.Duration((m.breakpoints[index+1] - m.breakpoints[index]) * float64(time.Second))
+	}
+
+	retry := time.Duration(position+1) * interval
+	if retry < time.Second {
+		retry = time.Second
+	}
+
+	progress.RetryAfter = retry.Seconds()
+	return progress
+}
+
+// writes 202 Accepted with transcode progress of segment
+func (m *ManagerCtx) httpProgress(w http.ResponseWriter, index int) {
+	progress := m.segmentProgress(index)
+
+	w.Header().Set("Preference-Applied", "respond-async")
+	w.Header().Set("Retry-After", fmt.Sprintf("%.0f", time.Duration(progress.RetryAfter*float64(time.Second)).Round(time.Second).Seconds()))
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(progress)
+}
@@ -0,0 +1,65 @@
+package hlsvod
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPreferAsync(t *testing.T) {
+	tests := []struct {
+		prefer string
+		wait   time.Duration
+		async  bool
+	}{
+		{"", 0, false},
+		{"respond-async", 0, true},
+		{"respond-async, wait=5", 5 * time.Second, true},
+		{"wait=5", 5 * time.Second, false},
+		{"respond-async, wait=3600", progressWaitMax, true},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/test-00001.ts", nil)
+		if tt.prefer != "" {
+			r.Header.Set("Prefer", tt.prefer)
+		}
+
+		wait, async := preferAsync(r)
+		if wait != tt.wait || async != tt.async {
+			t.Errorf("preferAsync(%q) = %v, %v, want %v, %v", tt.prefer, wait, async, tt.wait, tt.async)
+		}
+	}
+}
+
+func TestSegmentProgress(t *testing.T) {
+	clock := newFakeClock()
+	m := New(Config{Clock: clock})
+	m.breakpoints = []float64{0, 4, 8, 12, 16}
+	m.segments = map[int]string{0: "test-00000.ts"}
+	m.segmentQueue = map[int]chan struct{}{}
+
+	// without measurements, segments are expected in real time
+	m.enqueueSegments(1, 3)
+	progress := m.segmentProgress(3)
+	if progress.QueuePosition != 2 || progress.Transcoded != 1 || progress.Total != 4 || progress.RetryAfter != 12 {
+		t.Errorf("got %+v, want position 2 with retry after 12s", progress)
+	}
+
+	// segments become ready every second
+	m.progressRecord()
+	clock.Advance(time.Second)
+	m.progressRecord()
+
+	progress = m.segmentProgress(3)
+	if progress.RetryAfter != 3 {
+		t.Errorf("got retry after %v, want 3s", progress.RetryAfter)
+	}
+
+	w := httptest.NewRecorder()
+	m.httpProgress(w, 3)
+	if w.Code != http.StatusAccepted || w.Header().Get("Retry-After") != "3" {
+		t.Errorf("got %d with Retry-After %q, want 202 with 3", w.Code, w.Header().Get("Retry-After"))
+	}
+}
@@ -0,0 +1,234 @@
+package hlsvod
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"time"
+)
+
+// how many idle connections are kept by redis store
+const redisIdleConns = 4
+
+// default timeout of redis commands
+const redisDefaultTimeout = 5 * time.Second
+
+type RedisConfig struct {
+	Addr     string        // Address of redis server, e.g. localhost:6379.
+	Password string        // If not empty, connection is authenticated.
+	DB       int           // Selected database.
+	Prefix   string        // Prefix of keys, so that database can be shared.
+	TTL      time.Duration // Expiration of cache data, 0 means no expiration.
+	Timeout  time.Duration // Timeout of single command including dial, 0 means default.
+}
+
+// RedisCacheStore keeps cache data in redis, so that probe results are
+// shared by all instances using the same server.
+type RedisCacheStore struct {
+	config RedisConfig
+	idle   chan *redisConn
+}
+
+func NewRedisCacheStore(config RedisConfig) *RedisCacheStore {
+	if config.Timeout <= 0 {
+		config.Timeout = redisDefaultTimeout
+	}
+
+	return &RedisCacheStore{
+		config: config,
+		idle:   make(chan *redisConn, redisIdleConns),
+	}
+}
+
+func (s *RedisCacheStore) Get(key string) ([]byte, error) {
+	reply, err := s.do("GET", s.config.Prefix+key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, ok := reply.([]byte)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return data, nil
+}
+
+func (s *RedisCacheStore) Set(key string, data []byte) error {
+	args := []string{"SET", s.config.Prefix + key, string(data)}
+	if s.config.TTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(s.config.TTL.Milliseconds(), 10))
+	}
+
+	_, err := s.do(args...)
+	return err
+}
+
+func (s *RedisCacheStore) Delete(key string) error {
+	_, err := s.do("DEL", s.config.Prefix+key)
+	return err
+}
+
+// Close closes idle connections.
+func (s *RedisCacheStore) Close() {
+	for {
+		select {
+		case conn := <-s.idle:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+// sends command using idle or new connection and returns its reply
+func (s *RedisCacheStore) do(args ...string) (interface{}, error) {
+	var conn *redisConn
+	select {
+	case conn = <-s.idle:
+	default:
+		var err error
+		conn, err = s.dial()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := conn.do(s.config.Timeout, args...)
+
+	// connection in unknown state is not reused, errors replied by server
+	// do not break connection
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		conn.Close()
+		return nil, err
+	}
+
+	select {
+	case s.idle <- conn:
+	default:
+		conn.Close()
+	}
+
+	return reply, err
+}
+
+func (s *RedisCacheStore) dial() (*redisConn, error) {
+	c, err := net.DialTimeout("tcp", s.config.Addr, s.config.Timeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn := &redisConn{
+		Conn:   c,
+		reader: bufio.NewReader(c),
+	}
+
+	if s.config.Password != "" {
+		if _, err := conn.do(s.config.Timeout, "AUTH", s.config.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	if s.config.DB != 0 {
+		if _, err := conn.do(s.config.Timeout, "SELECT", strconv.Itoa(s.config.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// error replied by redis server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type redisConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// writes command in RESP format and reads its reply
+func (c *redisConn) do(timeout time.Duration, args ...string) (interface{}, error) {
+	if err := c.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+
+	cmd := []byte(fmt.Sprintf("*%d\r\n", len(args)))
+	for _, arg := range args {
+		cmd = append(cmd, fmt.Sprintf("$%d\r\n", len(arg))...)
+		cmd = append(cmd, arg...)
+		cmd = append(cmd, "\r\n"...)
+	}
+
+	if _, err := c.Write(cmd); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+// reads reply, bulk string is returned as bytes, nil bulk string as nil
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: invalid reply %q", line)
+	}
+	line = line[:len(line)-2]
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		if size < 0 {
+			return nil, nil
+		}
+
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+
+		return data[:size], nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+
+		items := []interface{}{}
+		for i := 0; i < count; i++ {
+			item, err := c.readReply()
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+
+		return items, nil
+	}
+
+	return nil, fmt.Errorf("redis: unknown reply %q", line)
+}
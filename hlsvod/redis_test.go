@@ -0,0 +1,145 @@
+package hlsvod
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// serves GET, SET, DEL and AUTH commands of redis protocol from memory
+func fakeRedisServer(t *testing.T, password string) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("unable to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	var mu sync.Mutex
+	data := map[string]string{}
+
+	readArgs := func(reader *bufio.Reader) ([]string, error) {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+
+		count, _ := strconv.Atoi(line[1 : len(line)-2])
+		args := make([]string, count)
+		for i := range args {
+			line, err := reader.ReadString('\n')
+			if err != nil {
+				return nil, err
+			}
+
+			size, _ := strconv.Atoi(line[1 : len(line)-2])
+			arg := make([]byte, size+2)
+			if _, err := io.ReadFull(reader, arg); err != nil {
+				return nil, err
+			}
+			args[i] = string(arg[:size])
+		}
+
+		return args, nil
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				reader := bufio.NewReader(conn)
+				authenticated := password == ""
+				for {
+					args, err := readArgs(reader)
+					if err != nil {
+						return
+					}
+
+					mu.Lock()
+					var reply string
+					switch {
+					case args[0] == "AUTH" && args[1] == password:
+						authenticated = true
+						reply = "+OK\r\n"
+					case !authenticated:
+						reply = "-NOAUTH Authentication required.\r\n"
+					case args[0] == "SET":
+						data[args[1]] = args[2]
+						reply = "+OK\r\n"
+					case args[0] == "GET":
+						if value, ok := data[args[1]]; ok {
+							reply = "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+						} else {
+							reply = "$-1\r\n"
+						}
+					case args[0] == "DEL":
+						delete(data, args[1])
+						reply = ":1\r\n"
+					default:
+						reply = "-ERR unknown command\r\n"
+					}
+					mu.Unlock()
+
+					if _, err := conn.Write([]byte(reply)); err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestRedisCacheStore(t *testing.T) {
+	addr := fakeRedisServer(t, "secret")
+
+	store := NewRedisCacheStore(RedisConfig{
+		Addr:     addr,
+		Password: "secret",
+		Prefix:   "test:",
+		TTL:      time.Hour,
+	})
+	defer store.Close()
+
+	if _, err := store.Get("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("missing key returned %v, want %v", err, os.ErrNotExist)
+	}
+
+	value := []byte("line\r\nbreak")
+	if err := store.Set("key", value); err != nil {
+		t.Fatal(err)
+	}
+
+	if data, err := store.Get("key"); err != nil || string(data) != string(value) {
+		t.Errorf("get = %q %v, want %q", data, err, value)
+	}
+
+	if err := store.Delete("key"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get("key"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("deleted key returned %v, want %v", err, os.ErrNotExist)
+	}
+
+	// unauthenticated connection is rejected
+	unauthenticated := NewRedisCacheStore(RedisConfig{Addr: addr})
+	defer unauthenticated.Close()
+
+	var replyErr redisError
+	if _, err := unauthenticated.Get("key"); !errors.As(err, &replyErr) {
+		t.Errorf("unauthenticated get returned %v, want redis error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package hlsvod
+
+import (
+	"errors"
+	"sync"
+)
+
+var ErrNotRegistered = errors.New("path is not registered")
+
+// ConfigFactory returns config of manager of media path, it is called when
+// manager is created, i.e. upon the first acquire of path.
+type ConfigFactory func(path string) (Config, error)
+
+// Registry creates managers of registered paths on demand. Managers start
+// lazily upon the first playlist or segment request (see LazyManager) and
+// they are stopped and removed, when the last reference is released, so
+// that media, that is not played, does not consume any resources.
+type Registry struct {
+	mu        sync.Mutex
+	fallback  ConfigFactory
+	factories map[string]ConfigFactory
+	managers  map[string]*registryEntry
+
+	// creates manager from config, replaced in tests
+	newManager func(config Config) Manager
+}
+
+type registryEntry struct {
+	manager *LazyManager
+	refs    int
+}
+
+// NewRegistry creates registry, fallback factory is used for paths, that
+// were not registered, nil means that only registered paths are served.
+func NewRegistry(fallback ConfigFactory) *Registry {
+	return &Registry{
+		fallback:  fallback,
+		factories: map[string]ConfigFactory{},
+		managers:  map[string]*registryEntry{},
+		newManager: func(config Config) Manager {
+			return New(config)
+		},
+	}
+}
+
+// Register sets config factory of path, manager, that already exists, is
+// not affected until it is released.
+func (r *Registry) Register(path string, factory ConfigFactory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.factories[path] = factory
+}
+
+func (r *Registry) Unregister(path string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.factories, path)
+}
+
+// Acquire returns manager of path and increments its reference count,
+// manager is created by config factory of path, if it does not exist.
+// Every acquire must be followed by release.
+func (r *Registry) Acquire(path string) (*LazyManager, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.managers[path]; ok {
+		entry.refs++
+		return entry.manager, nil
+	}
+
+	factory, ok := r.factories[path]
+	if !ok {
+		factory = r.fallback
+	}
+
+	if factory == nil {
+		return nil, ErrNotRegistered
+	}
+
+	config, err := factory(path)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &registryEntry{
+		manager: NewLazyManager(r.newManager(config)),
+		refs:    1,
+	}
+
+	r.managers[path] = entry
+	return entry.manager, nil
+}
+
+// Release decrements reference count of manager of path, manager is
+// stopped and removed, when it is not referenced anymore.
+func (r *Registry) Release(path string) {
+	r.mu.Lock()
+	entry, ok := r.managers[path]
+	if !ok {
+		r.mu.Unlock()
+		return
+	}
+
+	entry.refs--
+	if entry.refs > 0 {
+		r.mu.Unlock()
+		return
+	}
+
+	delete(r.managers, path)
+	r.mu.Unlock()
+
+	entry.manager.Stop()
+}
+
+// Refs returns reference count of manager of path, 0 if it does not exist.
+func (r *Registry) Refs(path string) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.managers[path]; ok {
+		return entry.refs
+	}
+
+	return 0
+}
+
+// Shutdown stops and removes all managers regardless of their references.
+func (r *Registry) Shutdown() {
+	r.mu.Lock()
+	managers := r.managers
+	r.managers = map[string]*registryEntry{}
+	r.mu.Unlock()
+
+	for _, entry := range managers {
+		entry.manager.Stop()
+	}
+}
@@ -0,0 +1,107 @@
+package hlsvod
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// records starts and stops, other methods are not used
+type countingManager struct {
+	Manager
+	starts int
+	stops  int
+}
+
+func (m *countingManager) Start() error { m.starts++; return nil }
+func (m *countingManager) Stop()        { m.stops++ }
+
+func (m *countingManager) ServePlaylist(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestLazyManager(t *testing.T) {
+	inner := &countingManager{}
+	manager := NewLazyManager(inner)
+
+	if err := manager.Start(); err != nil || inner.starts != 0 {
+		t.Fatalf("Start() started manager %d times, err %v", inner.starts, err)
+	}
+
+	for i := 0; i < 2; i++ {
+		manager.ServePlaylist(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/index.m3u8", nil))
+	}
+
+	if inner.starts != 1 || !manager.Started() {
+		t.Errorf("playlist requests started manager %d times, want 1", inner.starts)
+	}
+
+	manager.Stop()
+	if inner.stops != 1 || manager.Started() {
+		t.Errorf("manager stopped %d times, started %v", inner.stops, manager.Started())
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	created := map[string]*countingManager{}
+
+	registry := NewRegistry(nil)
+	registry.newManager = func(config Config) Manager {
+		created[config.MediaPath] = &countingManager{}
+		return created[config.MediaPath]
+	}
+
+	registry.Register("movie.mp4", func(path string) (Config, error) {
+		return Config{MediaPath: "/media/" + path}, nil
+	})
+
+	if _, err := registry.Acquire("other.mp4"); !errors.Is(err, ErrNotRegistered) {
+		t.Errorf("Acquire() of unregistered path: got %v, want %v", err, ErrNotRegistered)
+	}
+
+	first, err := registry.Acquire("movie.mp4")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	second, _ := registry.Acquire("movie.mp4")
+	if first != second || registry.Refs("movie.mp4") != 2 || len(created) != 1 {
+		t.Fatalf("expected single manager with 2 references, got %d references of %d managers", registry.Refs("movie.mp4"), len(created))
+	}
+
+	inner := created["/media/movie.mp4"]
+	if inner.starts != 0 {
+		t.Errorf("manager started before playlist request")
+	}
+
+	first.ServePlaylist(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/index.m3u8", nil))
+
+	registry.Release("movie.mp4")
+	if inner.stops != 0 {
+		t.Errorf("manager stopped while referenced")
+	}
+
+	registry.Release("movie.mp4")
+	if inner.starts != 1 || inner.stops != 1 || registry.Refs("movie.mp4") != 0 {
+		t.Errorf("got %d starts and %d stops, want 1 and 1", inner.starts, inner.stops)
+	}
+}
+
+func TestRegistryFallback(t *testing.T) {
+	registry := NewRegistry(func(path string) (Config, error) {
+		return Config{MediaPath: path}, nil
+	})
+	registry.newManager = func(config Config) Manager {
+		return &countingManager{}
+	}
+
+	if _, err := registry.Acquire("any.mp4"); err != nil {
+		t.Errorf("Acquire() with fallback factory: %v", err)
+	}
+
+	registry.Shutdown()
+	if registry.Refs("any.mp4") != 0 {
+		t.Errorf("manager not removed by shutdown")
+	}
+}
@@ -0,0 +1,49 @@
+package hlsvod
+
+import "sort"
+
+// SeekRanges returns windows after likely seek destinations of media, so
+// that they can be transcoded before viewer seeks there. Destinations are
+// starts of chapters and every 1/intervals of duration. Beginning of media
+// is played first anyway, so that it is left out, and destinations closer
+// than window to each other share a single range.
+func SeekRanges(data *ProbeMediaData, intervals int, window float64) []WarmRange {
+	duration := data.Duration.Seconds()
+	if window <= 0 || duration <= 0 {
+		return []WarmRange{}
+	}
+
+	points := []float64{}
+	for _, chapter := range data.Chapters {
+		points = append(points, chapter.Start)
+	}
+
+	for i := 1; i < intervals; i++ {
+		points = append(points, duration*float64(i)/float64(intervals))
+	}
+
+	sort.Float64s(points)
+
+	ranges := []WarmRange{}
+	for _, point := range points {
+		if point < window || point >= duration {
+			continue
+		}
+
+		// extend previous range instead of overlapping it
+		if last := len(ranges) - 1; last >= 0 && point < ranges[last].End {
+			ranges[last].End = point + window
+			continue
+		}
+
+		ranges = append(ranges, WarmRange{Start: point, End: point + window})
+	}
+
+	for i := range ranges {
+		if ranges[i].End > duration {
+			ranges[i].End = duration
+		}
+	}
+
+	return ranges
+}
@@ -0,0 +1,40 @@
+package hlsvod
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSeekRanges(t *testing.T) {
+	data := &ProbeMediaData{
+		Duration: 100 * time.Second,
+		Chapters: []ProbeChapterData{
+			{Start: 0, End: 22, Title: "Intro"},
+			{Start: 22, End: 61, Title: "Part 1"},
+			{Start: 61, End: 100, Title: "Credits"},
+		},
+	}
+
+	got := SeekRanges(data, 4, 6)
+	want := []WarmRange{
+		{Start: 22, End: 31}, // chapter start merged with 25%
+		{Start: 50, End: 56},
+		{Start: 61, End: 67},
+		{Start: 75, End: 81},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("SeekRanges() = %v, want %v", got, want)
+	}
+
+	// range is clipped to duration
+	short := &ProbeMediaData{Duration: 10 * time.Second, Chapters: []ProbeChapterData{{Start: 9, End: 10}}}
+	if got := SeekRanges(short, 0, 3); !reflect.DeepEqual(got, []WarmRange{{Start: 9, End: 10}}) {
+		t.Errorf("SeekRanges() of short media = %v", got)
+	}
+
+	if got := SeekRanges(data, 4, 0); len(got) != 0 {
+		t.Errorf("SeekRanges() without window = %v", got)
+	}
+}
@@ -0,0 +1,104 @@
+package hlsvod
+
+import "fmt"
+
+// SidecarVersion is version of sidecar schema, it is increased only when
+// fields are removed or their meaning changes.
+const SidecarVersion = 1
+
+// Sidecar describes master playlist as JSON, so that custom players can
+// build track menus without parsing M3U8 attributes. URLs are relative to
+// master playlist, the same as in the playlist.
+type Sidecar struct {
+	Version    int                `json:"version"`
+	Duration   float64            `json:"duration"` // in seconds
+	Renditions []SidecarRendition `json:"renditions"`
+	Audio      []SidecarAudio     `json:"audio"`     // alternative audio tracks, empty if audio is only muxed in renditions
+	Subtitles  []SidecarSubtitles `json:"subtitles"` // WebVTT subtitle tracks
+	Thumbnails string             `json:"thumbnails,omitempty"`
+}
+
+// SidecarRendition is video rendition in order of master playlist.
+type SidecarRendition struct {
+	ID         string `json:"id"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Bandwidth  int    `json:"bandwidth"` // in bits per second
+	VideoRange string `json:"video_range,omitempty"`
+	HDCPLevel  string `json:"hdcp_level,omitempty"`
+	Codecs     string `json:"codecs,omitempty"`
+	URL        string `json:"url"`
+}
+
+type SidecarAudio struct {
+	ID          string `json:"id,omitempty"`
+	Name        string `json:"name"`
+	Language    string `json:"language,omitempty"`
+	Default     bool   `json:"default"`
+	Descriptive bool   `json:"descriptive"`
+	Commentary  bool   `json:"commentary"`
+	URL         string `json:"url,omitempty"` // empty means audio muxed in renditions
+}
+
+type SidecarSubtitles struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	Default  bool   `json:"default"`
+	URL      string `json:"url"`
+}
+
+// MasterSidecar returns sidecar of master playlist returned by MasterPlaylist
+// with the same arguments, content steering is not described.
+func MasterSidecar(profiles map[string]VideoProfile, segmentNameFmt string, duration float64, opts MasterPlaylistOptions) Sidecar {
+	sidecar := Sidecar{
+		Version:    SidecarVersion,
+		Duration:   duration,
+		Renditions: []SidecarRendition{},
+		Audio:      []SidecarAudio{},
+		Subtitles:  []SidecarSubtitles{},
+	}
+
+	for _, name := range profileOrder(profiles, opts) {
+		profile := profiles[name]
+		sidecar.Renditions = append(sidecar.Renditions, SidecarRendition{
+			ID:         name,
+			Width:      profile.Width,
+			Height:     profile.Height,
+			Bandwidth:  profile.Bitrate,
+			VideoRange: profile.VideoRange,
+			HDCPLevel:  profile.HDCPLevel,
+			Codecs:     profile.Codecs,
+			URL:        fmt.Sprintf(segmentNameFmt, name),
+		})
+	}
+
+	for _, rendition := range opts.Audio {
+		audio := SidecarAudio{
+			ID:          rendition.ID,
+			Name:        rendition.Name,
+			Language:    rendition.Language,
+			Default:     rendition.Default,
+			Descriptive: rendition.Descriptive,
+			Commentary:  rendition.Commentary,
+		}
+
+		if rendition.ID != "" {
+			audio.URL = fmt.Sprintf(segmentNameFmt, rendition.ID)
+		}
+
+		sidecar.Audio = append(sidecar.Audio, audio)
+	}
+
+	for _, rendition := range opts.Subtitles {
+		sidecar.Subtitles = append(sidecar.Subtitles, SidecarSubtitles{
+			ID:       rendition.ID,
+			Name:     rendition.Name,
+			Language: rendition.Language,
+			Default:  rendition.Default,
+			URL:      fmt.Sprintf(segmentNameFmt, rendition.ID),
+		})
+	}
+
+	return sidecar
+}
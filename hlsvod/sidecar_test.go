@@ -0,0 +1,44 @@
+package hlsvod
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMasterSidecar(t *testing.T) {
+	profiles := map[string]VideoProfile{
+		"360p": {Width: 640, Height: 360, Bitrate: 1000000, VideoRange: "SDR"},
+		"720p": {Width: 1280, Height: 720, Bitrate: 3000000, VideoRange: "SDR", HDCPLevel: "NONE"},
+	}
+
+	opts := MasterPlaylistOptions{
+		Audio: []AudioRendition{
+			{Name: "Main", Language: "en", Default: true},
+			{ID: "audio1", Name: "Commentary", Commentary: true},
+		},
+		Subtitles: []SubtitleRendition{
+			{ID: "subtitles-0", Name: "English", Language: "eng"},
+		},
+		First: "720p",
+	}
+
+	want := Sidecar{
+		Version:  SidecarVersion,
+		Duration: 90,
+		Renditions: []SidecarRendition{
+			{ID: "720p", Width: 1280, Height: 720, Bandwidth: 3000000, VideoRange: "SDR", HDCPLevel: "NONE", URL: "720p.m3u8?token=x"},
+			{ID: "360p", Width: 640, Height: 360, Bandwidth: 1000000, VideoRange: "SDR", URL: "360p.m3u8?token=x"},
+		},
+		Audio: []SidecarAudio{
+			{Name: "Main", Language: "en", Default: true},
+			{ID: "audio1", Name: "Commentary", Commentary: true, URL: "audio1.m3u8?token=x"},
+		},
+		Subtitles: []SidecarSubtitles{
+			{ID: "subtitles-0", Name: "English", Language: "eng", URL: "subtitles-0.m3u8?token=x"},
+		},
+	}
+
+	if got := MasterSidecar(profiles, "%s.m3u8?token=x", 90, opts); !reflect.DeepEqual(got, want) {
+		t.Errorf("MasterSidecar() = %+v, want %+v", got, want)
+	}
+}
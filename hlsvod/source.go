@@ -0,0 +1,123 @@
+package hlsvod
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+var ErrSourceChanged = errors.New("source media changed")
+
+// remembers size and modification time of source media, that is being
+// transcoded, so that its replacement can be detected
+func (m *ManagerCtx) sourceRecord() {
+	fi, err := m.fs.Stat(m.config.MediaPath)
+	if err != nil {
+		return
+	}
+
+	m.sourceMu.Lock()
+	defer m.sourceMu.Unlock()
+
+	m.sourceSize = fi.Size()
+	m.sourceModTime = fi.ModTime()
+}
+
+// returns true, if source media was replaced or truncated
+func (m *ManagerCtx) sourceReplaced() bool {
+	m.sourceMu.Lock()
+	defer m.sourceMu.Unlock()
+
+	return m.sourceChanged
+}
+
+// watches source media, until it changes or manager is stopped
+func (m *ManagerCtx) watchSource(ctx context.Context) {
+	defer utils.RecoverPanic(m.logger, m.panicked)
+
+	ticker := m.clock.NewTicker(m.config.SourceWatch)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C():
+			if m.checkSource() {
+				return
+			}
+		}
+	}
+}
+
+// invalidates session, if source media was replaced or truncated, returns
+// true if it changed
+func (m *ManagerCtx) checkSource() bool {
+	// pattern of image sequence is not a file, that could be checked
+	if ImageSequence(m.config.MediaPath) {
+		return false
+	}
+
+	fi, err := m.fs.Stat(m.config.MediaPath)
+	if err != nil && !os.IsNotExist(err) {
+		m.logger.Warn().Err(err).Msg("unable to check source media")
+		return false
+	}
+
+	m.segmentsMu.RLock()
+	growing := m.growing
+	m.segmentsMu.RUnlock()
+
+	m.sourceMu.Lock()
+	var changed bool
+	switch {
+	case err != nil:
+		// removed media
+		changed = true
+	case growing:
+		// growing media only grows, unless it is truncated
+		changed = fi.Size() < m.sourceSize
+		m.sourceSize = fi.Size()
+	default:
+		changed = fi.Size() != m.sourceSize || !fi.ModTime().Equal(m.sourceModTime)
+	}
+
+	if !changed || m.sourceChanged {
+		m.sourceMu.Unlock()
+		return changed
+	}
+
+	m.sourceChanged = true
+	m.sourceMu.Unlock()
+
+	m.logger.Warn().Msg("source media changed, invalidating session")
+
+	// segments must not be transcoded from new media into old playlist
+	m.lookaheadStop()
+
+	if err := m.PurgeCache(); err != nil {
+		m.logger.Err(err).Msg("unable to purge cached metadata")
+	}
+
+	m.segmentsMu.RLock()
+	segmentsTotal := len(m.breakpoints) - 1
+	m.segmentsMu.RUnlock()
+
+	// segments, that were not requested yet, would mix old media with new
+	for index := 0; index < segmentsTotal; index++ {
+		if m.heatmapGet(index).Requests == 0 {
+			m.removeSegment(index)
+		}
+	}
+
+	m.config.Events.Publish(events.SourceChanged{
+		Session: m.config.Session,
+		Time:    m.clock.Now(),
+		Path:    m.config.MediaPath,
+	})
+
+	return true
+}
@@ -0,0 +1,102 @@
+package hlsvod
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/m1k1o/go-transcode/events"
+)
+
+func TestManagerSourceChanged(t *testing.T) {
+	fs := newMemFS()
+	fs.files["/media/video.mp4"] = make([]byte, 100)
+
+	bus := events.New()
+	changed, unsubscribe := bus.Subscribe(1, events.SourceChangedType)
+	defer unsubscribe()
+
+	m := New(Config{
+		MediaPath:     "/media/video.mp4",
+		TranscodeDir:  "/transcode",
+		SegmentPrefix: "test",
+		SourceWatch:   time.Second,
+		Transcoder:    &brokenTranscoder{NewFakeTranscoder(30 * time.Second), fs, -1},
+		Clock:         newFakeClock(),
+		FS:            fs,
+		Session:       "test",
+		Events:        bus,
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.Warm(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// unchanged media
+	if m.checkSource() {
+		t.Fatal("unchanged media should not be reported")
+	}
+
+	m.heatmapRecord(0)
+
+	// media replaced by another one
+	fs.files["/media/video.mp4"] = make([]byte, 200)
+	if !m.checkSource() {
+		t.Fatal("replaced media should be reported")
+	}
+
+	select {
+	case event := <-changed:
+		if e := event.(events.SourceChanged); e.Session != "test" || e.Path != "/media/video.mp4" {
+			t.Errorf("unexpected event %+v", e)
+		}
+	default:
+		t.Error("source changed event was not published")
+	}
+
+	// requested segment is kept, others are removed
+	if !m.isSegmentTranscoded(0) || m.isSegmentTranscoded(1) {
+		t.Error("only requested segments should be kept")
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeMedia(w, httptest.NewRequest(http.MethodGet, "/"+m.getSegmentName(1), nil))
+
+	if w.Code != http.StatusConflict {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusConflict)
+	}
+
+	var body HTTPError
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Code != ErrorSourceChanged {
+		t.Errorf("unexpected error body %+v", body)
+	}
+
+	if m.isSegmentTranscoded(1) {
+		t.Error("segment of replaced media should not be transcoded")
+	}
+}
+
+func TestManagerSourceImageSequence(t *testing.T) {
+	m := New(Config{
+		MediaPath:   "/media/frame-%04d.jpg",
+		SourceWatch: time.Second,
+		FS:          newMemFS(),
+	})
+
+	// pattern does not exist, but session is not invalidated
+	if m.checkSource() {
+		t.Error("image sequence should not be reported as changed")
+	}
+}
@@ -0,0 +1,71 @@
+package hlsvod
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type SegmentStats struct {
+	Index      int     `json:"index"`
+	Name       string  `json:"name"`
+	Duration   float64 `json:"duration"` // in seconds
+	Transcoded bool    `json:"transcoded"`
+	Size       int64   `json:"size,omitempty"`    // in bytes
+	Bitrate    int     `json:"bitrate,omitempty"` // in bits per second
+
+	Requests    int        `json:"requests"`
+	LastRequest *time.Time `json:"last_request,omitempty"`
+}
+
+// returns per-segment statistics, transcoded segments include real encoded size and bitrate,
+// requested segments include their popularity
+func (m *ManagerCtx) getStats() []SegmentStats {
+	m.segmentsMu.RLock()
+	defer m.segmentsMu.RUnlock()
+
+	stats := []SegmentStats{}
+	for i := 1; i < len(m.breakpoints); i++ {
+		index := i - 1
+		segment := SegmentStats{
+			Index:    index,
+			Name:     m.getSegmentName(index),
+			Duration: m.breakpoints[i] - m.breakpoints[i-1],
+		}
+
+		if heat := m.heatmapGet(index); heat.Requests > 0 {
+			segment.Requests = heat.Requests
+			segment.LastRequest = &heat.LastRequest
+		}
+
+		if segmentName := m.segments[index]; segmentName != "" {
+			segment.Transcoded = true
+			segment.Size = m.segmentSizes[index]
+			if segment.Duration > 0 {
+				segment.Bitrate = int(float64(segment.Size*8) / segment.Duration)
+			}
+		}
+
+		stats = append(stats, segment)
+	}
+
+	return stats
+}
+
+// Stats returns per-segment statistics without keeping session alive.
+func (m *ManagerCtx) Stats() []SegmentStats {
+	return m.getStats()
+}
+
+func (m *ManagerCtx) ServeStats(w http.ResponseWriter, r *http.Request) {
+	m.Heartbeat()
+
+	// ensure that manager started
+	if !m.httpEnsureReady(w, r) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(m.getStats())
+}
@@ -0,0 +1,50 @@
+package hlsvod
+
+import (
+	"fmt"
+	"strings"
+)
+
+// version of steering manifest format
+const steeringManifestVersion = 1
+
+// SteeringPathway is a host (e.g. CDN), that serves all renditions.
+type SteeringPathway struct {
+	ID      string // Pathway ID, letters, digits, dot, dash and underscore.
+	BaseURL string // Prefix of rendition URIs, e.g. https://cdn-a.example.com/vod/movie.mkv/
+}
+
+// ContentSteering lists renditions for every pathway, steering server tells
+// players, which pathway should they use.
+type ContentSteering struct {
+	ServerURI string // URI of steering manifest.
+	Pathways  []SteeringPathway
+}
+
+// returns EXT-X-CONTENT-STEERING playlist tag, the first pathway is used
+// until steering manifest is loaded
+func (s *ContentSteering) tag() string {
+	attrs := []string{fmt.Sprintf("SERVER-URI=%q", s.ServerURI)}
+	if len(s.Pathways) > 0 {
+		attrs = append(attrs, fmt.Sprintf("PATHWAY-ID=%q", s.Pathways[0].ID))
+	}
+
+	return "#EXT-X-CONTENT-STEERING:" + strings.Join(attrs, ",")
+}
+
+// SteeringManifest is served by steering server, players reload it after TTL.
+type SteeringManifest struct {
+	Version         int      `json:"VERSION"`
+	TTL             int      `json:"TTL"` // in seconds
+	ReloadURI       string   `json:"RELOAD-URI,omitempty"`
+	PathwayPriority []string `json:"PATHWAY-PRIORITY"`
+}
+
+func NewSteeringManifest(ttl int, reloadURI string, priority []string) SteeringManifest {
+	return SteeringManifest{
+		Version:         steeringManifestVersion,
+		TTL:             ttl,
+		ReloadURI:       reloadURI,
+		PathwayPriority: priority,
+	}
+}
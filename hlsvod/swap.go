@@ -0,0 +1,180 @@
+package hlsvod
+
+import (
+	"errors"
+)
+
+// ErrNotReady is returned, when profile of session, that is not ready yet,
+// is swapped.
+var ErrNotReady = errors.New("manager is not ready")
+
+// ErrSwapFragmented is returned, when profile of session with fMP4 segments
+// is swapped, as its segments share one init section.
+var ErrSwapFragmented = errors.New("profile of fMP4 session cannot be swapped")
+
+// profile, that segments are transcoded with, starting from index
+type segmentProfile struct {
+	index       int
+	video       *VideoProfile
+	audio       *AudioProfile
+	passthrough bool
+}
+
+// returns profile of segment at offset and limit capped before the next
+// profile swap, so that single transcode does not mix profiles; must be
+// called with segment queue lock held
+func (m *ManagerCtx) profileAt(offset, limit int) (segmentProfile, int) {
+	profile := segmentProfile{
+		video:       m.videoProfile(),
+		audio:       m.config.AudioProfile,
+		passthrough: m.passthrough,
+	}
+
+	for _, swap := range m.profileSwaps {
+		if swap.index <= offset {
+			profile = swap
+			continue
+		}
+
+		if offset+limit > swap.index {
+			limit = swap.index - offset
+		}
+		break
+	}
+
+	return profile, limit
+}
+
+// returns limit of segments from offset, that are transcoded with the same
+// profile
+func (m *ManagerCtx) profileLimit(offset, limit int) int {
+	m.segmentQueueMu.RLock()
+	defer m.segmentQueueMu.RUnlock()
+
+	_, limit = m.profileAt(offset, limit)
+	return limit
+}
+
+// returns segments, that start with swapped profile and are preceded by
+// discontinuity in playlist
+func (m *ManagerCtx) profileDiscontinuities() map[int]bool {
+	m.segmentQueueMu.RLock()
+	defer m.segmentQueueMu.RUnlock()
+
+	discontinuities := map[int]bool{}
+	for _, swap := range m.profileSwaps {
+		if swap.index > 0 {
+			discontinuities[swap.index] = true
+		}
+	}
+
+	return discontinuities
+}
+
+// SwapProfile changes profile of running session without stopping it, e.g.
+// to lower bitrate during bandwidth emergency. Nil profile is kept. Segments,
+// that are transcoded or being transcoded, are kept, segments after them are
+// transcoded with new profile and discontinuity is listed before them in
+// playlist. Returns index of the first segment with new profile.
+func (m *ManagerCtx) SwapProfile(video *VideoProfile, audio *AudioProfile) (int, error) {
+	if !m.isReady() {
+		return 0, ErrNotReady
+	}
+
+	if m.fragmented() {
+		return 0, ErrSwapFragmented
+	}
+
+	m.segmentsMu.Lock()
+	defer m.segmentsMu.Unlock()
+
+	m.segmentQueueMu.Lock()
+
+	// the first segment, that was not transcoded nor enqueued yet, segments
+	// before it are kept with their profile
+	index := 0
+	after := func(i int) {
+		if i+1 > index {
+			index = i + 1
+		}
+	}
+	for i, segmentName := range m.segments {
+		if segmentName != "" {
+			after(i)
+		}
+	}
+	for i := range m.segmentsWriting {
+		after(i)
+	}
+	for i := range m.segmentGaps {
+		after(i)
+	}
+	for i := range m.segmentQueue {
+		after(i)
+	}
+
+	// swap, whose segments were not transcoded yet, is replaced
+	n := len(m.profileSwaps)
+	if n > 0 && m.profileSwaps[n-1].index > index {
+		index = m.profileSwaps[n-1].index
+	}
+
+	current, _ := m.profileAt(index, 0)
+	swap := segmentProfile{
+		index: index,
+		video: current.video,
+		audio: current.audio,
+	}
+
+	// media without video stays audio-only
+	if video != nil && current.video != nil {
+		swap.video = video
+	}
+	if audio != nil {
+		swap.audio = audio
+	}
+
+	if swap.video != nil {
+		if _, err := m.checkProfile(swap.video); err != nil {
+			m.segmentQueueMu.Unlock()
+			return 0, err
+		}
+	}
+
+	if n > 0 && m.profileSwaps[n-1].index == index {
+		m.profileSwaps[n-1] = swap
+	} else {
+		m.profileSwaps = append(m.profileSwaps, swap)
+	}
+
+	m.segmentQueueMu.Unlock()
+
+	m.playlist = m.getPlaylist()
+	m.playlistMod = m.clock.Now()
+
+	m.logger.Info().
+		Int("index", swap.index).
+		Interface("video", swap.video).
+		Interface("audio", swap.audio).
+		Msg("profile swapped")
+
+	return swap.index, nil
+}
+
+// profile swapped while session was running is kept, when it is started
+// again, without discontinuity
+func (m *ManagerCtx) profileSwapsReset() {
+	m.segmentQueueMu.Lock()
+	defer m.segmentQueueMu.Unlock()
+
+	if n := len(m.profileSwaps); n > 0 {
+		swap := m.profileSwaps[n-1]
+		if swap.video != nil {
+			m.config.VideoProfile = swap.video
+		}
+		m.config.AudioProfile = swap.audio
+		m.config.Passthrough = false
+	}
+
+	m.profileSwaps = nil
+}
@@ -0,0 +1,95 @@
+package hlsvod
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestManagerSwapProfile(t *testing.T) {
+	fs := newMemFS()
+	fs.files["/media/video.mp4"] = make([]byte, 100)
+
+	m := New(Config{
+		MediaPath:     "/media/video.mp4",
+		TranscodeDir:  "/transcode",
+		SegmentPrefix: "test",
+		VideoProfile:  &VideoProfile{Width: 1280, Height: 720, Bitrate: 2800},
+		AudioProfile:  &AudioProfile{Bitrate: 128},
+		Transcoder:    NewFakeTranscoder(30 * time.Second),
+		Clock:         newFakeClock(),
+		FS:            fs,
+	})
+
+	if _, err := m.SwapProfile(&VideoProfile{}, nil); err != ErrNotReady {
+		t.Errorf("SwapProfile() of not ready session = %v, want %v", err, ErrNotReady)
+	}
+
+	if err := m.loadMetadata(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := m.initialize(); err != nil {
+		t.Fatal(err)
+	}
+	m.readyDone()
+
+	if segmentsTotal := len(m.breakpoints) - 1; segmentsTotal < 4 {
+		t.Fatalf("media has %d segments, want at least 4", segmentsTotal)
+	}
+
+	for i := 0; i < 2; i++ {
+		segmentName := m.getSegmentName(i)
+		fs.files["/transcode/"+segmentName] = []byte("segment")
+		m.addSegment(i, "/transcode", segmentName)
+	}
+
+	// profile, that cannot be encoded, is not swapped
+	if _, err := m.SwapProfile(&VideoProfile{Width: 641, Height: 360, Bitrate: 800}, nil); !errors.Is(err, ErrProfileConstraint) {
+		t.Errorf("SwapProfile() of odd profile = %v, want %v", err, ErrProfileConstraint)
+	}
+
+	lower := &VideoProfile{Width: 640, Height: 360, Bitrate: 800}
+	index, err := m.SwapProfile(lower, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index != 2 {
+		t.Errorf("SwapProfile() = %d, want 2", index)
+	}
+
+	// discontinuity is listed before the first segment with new profile
+	lines := strings.Split(m.playlist, "\n")
+	for i, line := range lines {
+		if line == m.getSegmentName(2) {
+			if lines[i-2] != "#EXT-X-DISCONTINUITY" {
+				t.Errorf("segment 2 is not preceded by discontinuity:\n%s", m.playlist)
+			}
+		} else if line == "#EXT-X-DISCONTINUITY" && lines[i+2] != m.getSegmentName(2) {
+			t.Errorf("unexpected discontinuity at line %d:\n%s", i, m.playlist)
+		}
+	}
+
+	// transcode does not mix profiles
+	profile, limit := m.enqueueSegments(1, 3)
+	if profile.video.Height != 720 || limit != 1 {
+		t.Errorf("segment 1 has profile %+v and limit %d, want 720p and 1", profile.video, limit)
+	}
+
+	profile, limit = m.enqueueSegments(2, 2)
+	if profile.video != lower || profile.audio.Bitrate != 128 || profile.passthrough || limit != 2 {
+		t.Errorf("segment 2 has profile %+v and limit %d, want swapped profile and 2", profile, limit)
+	}
+
+	// swapped profile is kept after restart without discontinuity
+	if err := m.initialize(); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.config.VideoProfile != lower || strings.Contains(m.playlist, "#EXT-X-DISCONTINUITY") {
+		t.Errorf("swapped profile should be kept after restart, got %+v:\n%s", m.config.VideoProfile, m.playlist)
+	}
+}
@@ -0,0 +1,138 @@
+package hlsvod
+
+import (
+	"io"
+	"path/filepath"
+)
+
+// returns directory, where new segments are transcoded
+func (m *ManagerCtx) outputDir() string {
+	if m.config.MemoryDir != "" {
+		return m.config.MemoryDir
+	}
+
+	return m.placeVolume()
+}
+
+// returns directory of transcoded segment, segments mutex must be held
+func (m *ManagerCtx) segmentDir(index int) string {
+	for _, i := range m.segmentsMemory {
+		if i == index {
+			return m.config.MemoryDir
+		}
+	}
+
+	if dir, ok := m.segmentVolumes[index]; ok {
+		return dir
+	}
+
+	return m.config.TranscodeDir
+}
+
+func removeIndex(indexes []int, index int) []int {
+	for i, v := range indexes {
+		if v == index {
+			return append(indexes[:i], indexes[i+1:]...)
+		}
+	}
+
+	return indexes
+}
+
+// returns the oldest segment in memory dir, if memory size exceeds its maximum
+func (m *ManagerCtx) spillCandidate() (index int, segmentName string, ok bool) {
+	m.segmentsMu.RLock()
+	defer m.segmentsMu.RUnlock()
+
+	var size int64
+	for _, i := range m.segmentsMemory {
+		size += m.segmentSizes[i]
+	}
+
+	if len(m.segmentsMemory) == 0 || size <= m.config.MemoryMax {
+		return
+	}
+
+	index = m.segmentsMemory[0]
+	return index, m.segments[index], true
+}
+
+// moves the oldest segments from memory dir to transcode dir, until memory
+// size is within its maximum, serving path is updated after segment is copied
+func (m *ManagerCtx) spillSegments() {
+	if m.config.MemoryDir == "" {
+		return
+	}
+
+	for {
+		index, segmentName, ok := m.spillCandidate()
+		if !ok {
+			return
+		}
+
+		memoryPath := filepath.Join(m.config.MemoryDir, segmentName)
+		diskDir := m.placeVolume()
+		diskPath := filepath.Join(diskDir, segmentName)
+
+		if err := m.copyFile(memoryPath, diskPath); err != nil {
+			m.logger.Err(err).Str("path", memoryPath).Msg("unable to move segment to disk")
+
+			// keep segment in memory and try to move it later
+			return
+		}
+
+		m.segmentsMu.Lock()
+		// segment could have been removed meanwhile
+		removed := m.segments[index] != segmentName
+		if !removed {
+			m.segmentsMemory = removeIndex(m.segmentsMemory, index)
+			m.segmentVolumes[index] = diskDir
+		}
+		m.segmentsMu.Unlock()
+
+		if removed {
+			if err := m.fs.Remove(diskPath); err != nil {
+				m.logger.Err(err).Str("path", diskPath).Msg("error while removing file")
+			}
+			continue
+		}
+
+		if err := m.fs.Remove(memoryPath); err != nil {
+			m.logger.Err(err).Str("path", memoryPath).Msg("error while removing file")
+		}
+
+		m.logger.Debug().Int("index", index).Str("segment", segmentName).Msg("segment moved from memory to disk")
+	}
+}
+
+// copies file, works across filesystems unlike rename
+func (m *ManagerCtx) copyFile(src, dst string) error {
+	in, err := m.fs.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := m.fs.Create(dst)
+	if err != nil {
+		return err
+	}
+
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		m.fs.Remove(dst)
+		return err
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+
+	// keep modification time, so that conditional requests still match
+	return m.fs.Chtimes(dst, fi.ModTime(), fi.ModTime())
+}
@@ -0,0 +1,64 @@
+package hlsvod
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestSpillSegments(t *testing.T) {
+	memoryDir, diskDir := t.TempDir(), t.TempDir()
+
+	m := &ManagerCtx{
+		logger: zerolog.Nop(),
+		fs:     OSFileSystem{},
+		clock:  SystemClock{},
+		config: Config{
+			TranscodeDir:  diskDir,
+			MemoryDir:     memoryDir,
+			MemoryMax:     250,
+			SegmentPrefix: "test",
+		},
+		segments:       map[int]string{},
+		segmentSizes:   map[int]int64{},
+		segmentsMemory: []int{},
+		segmentVolumes: map[int]string{},
+	}
+
+	for i := 0; i < 4; i++ {
+		name := m.getSegmentName(i)
+		if err := os.WriteFile(filepath.Join(memoryDir, name), make([]byte, 100), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m.addSegment(i, memoryDir, name)
+	}
+
+	// only the newest segments fit in memory
+	if want := []int{2, 3}; !reflect.DeepEqual(m.segmentsMemory, want) {
+		t.Errorf("segments in memory = %v, want %v", m.segmentsMemory, want)
+	}
+
+	for i := 0; i < 4; i++ {
+		dir := diskDir
+		if i >= 2 {
+			dir = memoryDir
+		}
+
+		segmentPath, ok := m.getSegment(i)
+		if want := filepath.Join(dir, m.getSegmentName(i)); !ok || segmentPath != want {
+			t.Errorf("getSegment(%d) = %v, want %v", i, segmentPath, want)
+		}
+
+		if _, err := os.Stat(segmentPath); err != nil {
+			t.Errorf("segment %d not found: %v", i, err)
+		}
+	}
+
+	// spilled segments are removed from memory
+	if entries, _ := os.ReadDir(memoryDir); len(entries) != 2 {
+		t.Errorf("memory dir contains %d files, want 2", len(entries))
+	}
+}
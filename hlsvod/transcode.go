@@ -4,12 +4,28 @@ import (
 	"bufio"
 	"context"
 	"fmt"
-	"log"
+	"io"
 	"os"
 	"os/exec"
-	"path"
+	"path/filepath"
 	"strings"
 	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// video codecs of renditions
+const (
+	CodecH264 = "h264"
+	CodecHEVC = "hevc"
+)
+
+// formats of segments
+const (
+	SegmentFormatTS   = "mpegts"
+	SegmentFormatFMP4 = "fmp4" // Segments are served without init section, that is listed in playlist.
 )
 
 type TranscodeConfig struct {
@@ -17,24 +33,97 @@ type TranscodeConfig struct {
 	OutputDirPath string // Segments output path.
 	SegmentPrefix string // e.g. prefix-000001.ts
 	SegmentOffset int    // Start segment number.
+	SegmentFormat string // SegmentFormatTS if empty, every fMP4 segment starts with its init section.
 
 	SegmentTimes []float64
 	VideoProfile *VideoProfile
 	AudioProfile *AudioProfile
+	AudioOffset  float64 // Audio delay in seconds, negative values make audio play earlier.
+	AudioStream  int     // Index of transcoded audio stream, e.g. 1 for 0:a:1.
+	Passthrough  bool    // Copy streams without encoding, profiles are ignored.
+	IONice       bool    // Run with idle I/O priority, so that it does not starve reads.
+	Fallback     bool    // Use software decoding and error resilient flags, when retrying failed segments.
+	Encoder      string  // Video encoder, auto uses VAAPI if VAAPI=1 env is set, otherwise software.
+	Level        int     // H.264 level, e.g. 41 for 4.1, 0 means 4.0.
+	PixelFormat  string  // Source pixel format, it is converted, if not supported by H.264 High profile.
+
+	// Frame rate of image sequence input, animated images (GIF, APNG) are
+	// converted to it, 0 means ffmpeg default for sequences and original for animations.
+	ImageFramerate float64
+
+	BurnSubtitles  bool   // Render text subtitle stream into video.
+	SubtitleStream int    // Index of burned subtitle stream, e.g. 1 for 0:s:1.
+	FontsDir       string // Fonts used by burned subtitles, e.g. extracted attachments.
+
+	Overlay *Overlay // Text burned into video, e.g. timestamp or watermark.
+
+	OnError func(err error)   // Called when transcode process exits with error.
+	OnLog   func(line string) // Called with every line of transcode process log.
 }
 
 type VideoProfile struct {
 	Width   int
 	Height  int
-	Bitrate int // in kilobytes
+	Bitrate int    // in kilobytes
+	Preview bool   // Keyframe-only rendition without audio for scrubbing previews.
+	Preset  string // x264 or x265 preset, DefaultPreset if empty.
+
+	Codec  string // CodecH264 if empty.
+	Format string // Segment format, SegmentFormatTS if empty.
+
+	// Listed in master playlist, if set.
+	VideoRange string // SDR, PQ or HLG
+	HDCPLevel  string // NONE, TYPE-0 or TYPE-1
+	Codecs     string // e.g. hvc1.1.6.L120.B0,mp4a.40.2
 }
 
 type AudioProfile struct {
 	Bitrate int // in kilobytes
 }
 
+// returns software scale filter fitting video into profile
+func scaleFilter(profile *VideoProfile) string {
+	if profile.Width >= profile.Height {
+		return fmt.Sprintf("scale=-2:%d", profile.Height)
+	}
+
+	return fmt.Sprintf("scale=%d:-2", profile.Width)
+}
+
+// returns output args of segment muxer, completed segments are listed to segment list
+func segmentArgs(config TranscodeConfig, commaSeparatedSegTimes, segmentList string) []string {
+	args := []string{
+		"-f", "segment",
+		"-segment_time_delta", "0.2",
+	}
+
+	// every segment is written by its own muxer with init section, fragments
+	// keep timestamps of source, so that segments of different transcodes
+	// follow each other
+	if config.SegmentFormat == SegmentFormatFMP4 {
+		args = append(args,
+			"-segment_format", "mp4",
+			"-segment_format_options", "movflags=+frag_keyframe+empty_moov+default_base_moof+frag_discont",
+		)
+	} else {
+		args = append(args, "-segment_format", "mpegts")
+	}
+
+	return append(args,
+		"-segment_times", commaSeparatedSegTimes,
+		"-segment_start_number", fmt.Sprintf("%d", config.SegmentOffset),
+		"-segment_list_type", "flat",
+		"-segment_list", segmentList,
+		filepath.Join(config.OutputDirPath, fmt.Sprintf("%s-%%05d%s", config.SegmentPrefix, segmentExtension(config.SegmentFormat))),
+	)
+}
+
 // returns a channel, that delivers name of the segments as they are encoded
 func TranscodeSegments(ctx context.Context, ffmpegBinary string, config TranscodeConfig) (chan string, error) {
+	return transcodeSegments(ctx, ffmpegBinary, FFmpegVersion{}, config)
+}
+
+func transcodeSegments(ctx context.Context, ffmpegBinary string, version FFmpegVersion, config TranscodeConfig) (chan string, error) {
 	totalSegments := len(config.SegmentTimes)
 	if totalSegments < 2 {
 		return nil, fmt.Errorf("minimum 2 segment times needed")
@@ -58,7 +147,7 @@ func TranscodeSegments(ctx context.Context, ffmpegBinary string, config Transcod
 	commaSeparatedSegTimes := strings.Join(fmtSegTimes[1:], ",")
 
 	args := []string{
-		"-loglevel", "warning",
+		"-loglevel", version.logLevel("warning"),
 	}
 
 	// Seek to start point. Note there is a bug(?) in ffmpeg: https://github.com/FFmpeg/FFmpeg/blob/fe964d80fec17f043763405f5804f397279d6b27/fftools/ffmpeg_opt.c#L1240
@@ -70,58 +159,175 @@ func TranscodeSegments(ctx context.Context, ffmpegBinary string, config Transcod
 		}...)
 	}
 
-	VAAPI := os.Getenv("VAAPI") == "1"
-	CV := "libx264"
+	encoder := config.Encoder
+	if encoder == EncoderAuto && os.Getenv("VAAPI") == "1" {
+		encoder = EncoderVAAPI
+	}
+
+	// subtitles are rendered in software, video frames must not stay on GPU
+	burnSubtitles := config.BurnSubtitles && config.VideoProfile != nil && !config.VideoProfile.Preview && !config.Passthrough
+	overlay := config.Overlay != nil && config.VideoProfile != nil && !config.VideoProfile.Preview && !config.Passthrough
+
+	// hardware decoders tend to choke on corrupted input
+	if config.Fallback || (burnSubtitles || overlay) && encoder == EncoderVAAPI {
+		encoder = EncoderSoftware
+	}
+
+	var codec string
+	if config.VideoProfile != nil {
+		codec = config.VideoProfile.Codec
+	}
+
+	VAAPI := encoder == EncoderVAAPI
+	CV := videoEncoder(encoder, codec)
 	VF := ""
 
 	if VAAPI {
-		CV = "h264_vaapi"
 		VF = "scale_vaapi=w=SCALE_WIDTH:h=SCALE_HEIGHT:force_original_aspect_ratio=decrease"
 		extra := strings.Split("-hwaccel vaapi -hwaccel_device /dev/dri/renderD128 -hwaccel_output_format vaapi", " ")
 		args = append(args, extra...)
 	}
 
+	// Error resilience specs
+	if config.Fallback {
+		args = append(args, []string{
+			"-err_detect", "ignore_err",
+			"-fflags", "+genpts+discardcorrupt",
+		}...)
+	}
+
 	// Input specs
+	args = append(args, "-autorotate", "0") // consistent behavior
+	args = append(args, imageInputArgs(config.InputFilePath, config.ImageFramerate)...)
+	args = append(args, "-i", config.InputFilePath) // Input file
+
+	// Audio-only rendition without video profile
+	audioOnly := config.VideoProfile == nil && !config.Passthrough
+
+	// Audio sync correction, audio is read from the same input with shifted timestamps
+	if config.AudioOffset != 0 {
+		if audioStartAt := startAt - config.AudioOffset; audioStartAt > 0 {
+			args = append(args, []string{
+				"-ss", fmt.Sprintf("%.6f", audioStartAt),
+			}...)
+		}
+
+		args = append(args, []string{
+			"-itsoffset", fmt.Sprintf("%.6f", config.AudioOffset),
+			"-i", config.InputFilePath, // Input file for audio
+		}...)
+
+		if !audioOnly {
+			args = append(args, "-map", "0:v:0?")
+		}
+
+		args = append(args, "-map", fmt.Sprintf("1:a:%d?", config.AudioStream))
+	} else if audioOnly || config.AudioStream != 0 {
+		if !audioOnly {
+			args = append(args, "-map", "0:v:0?")
+		}
+
+		args = append(args, "-map", fmt.Sprintf("0:a:%d?", config.AudioStream))
+	}
+
 	args = append(args, []string{
-		"-autorotate", "0", // consistent behavior
-		"-i", config.InputFilePath, // Input file
 		"-to", fmt.Sprintf("%.6f", endAt),
 		"-copyts", // So the "-to" refers to the original TS
 		"-force_key_frames", commaSeparatedSegTimes,
 		"-sn", // No subtitles
 	}...)
 
+	if audioOnly {
+		args = append(args, "-vn")
+	}
+
+	// Passthrough specs
+	if config.Passthrough {
+		args = append(args, []string{
+			"-c:v", "copy",
+			"-c:a", "copy",
+		}...)
+	}
+
 	// Video specs
-	if config.VideoProfile != nil {
+	if config.VideoProfile != nil && !config.Passthrough {
 		profile := config.VideoProfile
 
 		var scale string
 		if VAAPI {
 			scale = strings.Replace(VF, "SCALE_WIDTH", fmt.Sprintf("%d", profile.Width), 1)
 			scale = strings.Replace(scale, "SCALE_HEIGHT", fmt.Sprintf("%d", profile.Height), 1)
-		} else if profile.Width >= profile.Height {
-			scale = fmt.Sprintf("scale=-2:%d", profile.Height)
 		} else {
-			scale = fmt.Sprintf("scale=%d:-2", profile.Width)
+			scale = scaleFilter(profile)
+		}
+
+		// subtitles are rendered in source resolution before scaling
+		if burnSubtitles {
+			scale = subtitlesFilter(config.InputFilePath, config.SubtitleStream, config.FontsDir) + "," + scale
+		}
+
+		// text is drawn in output resolution, so that font size is kept
+		if overlay {
+			scale += "," + config.Overlay.Filter()
+		}
+
+		// images are often paletted or full range and video can be 10-bit or
+		// 4:2:2, high profile requires 8-bit 4:2:0
+		images := ImageSequence(config.InputFilePath) || ImageAnimation(config.InputFilePath)
+		if (images || convertPixelFormat(config.PixelFormat)) && !VAAPI {
+			scale += ",format=yuv420p"
 		}
 
 		args = append(args, []string{
 			"-vf", scale,
 			"-c:v", CV,
-			"-profile:v", "high",
-			"-b:v", fmt.Sprintf("%dk", profile.Bitrate),
 		}...)
 
-		if !VAAPI {
+		if codec == CodecHEVC {
+			// Apple players require hvc1 sample entry
+			args = append(args, []string{
+				"-profile:v", "main",
+				"-tag:v", "hvc1",
+			}...)
+		} else {
+			args = append(args, "-profile:v", "high")
+		}
+
+		args = append(args, "-b:v", fmt.Sprintf("%dk", profile.Bitrate))
+
+		switch CV {
+		case "libx264":
+			args = append(args, []string{
+				"-preset", profilePreset(profile),
+				"-level:v", formatLevel(config.Level),
+			}...)
+		case "libx265":
+			// forced keyframes at segment times must be IDR, so that
+			// segments are decodable on their own
+			args = append(args, []string{
+				"-preset", profilePreset(profile),
+				"-forced-idr", "1",
+				"-x265-params", "log-level=error",
+			}...)
+		}
+
+		// animations have variable frame delays, output has constant frame rate
+		if ImageAnimation(config.InputFilePath) && config.ImageFramerate > 0 {
+			args = append(args, "-r", fmt.Sprintf("%g", config.ImageFramerate))
+		}
+
+		// one keyframe per second and no audio
+		if profile.Preview {
 			args = append(args, []string{
-				"-preset", "faster",
-				"-level:v", "4.0",
+				"-r", "1",
+				"-g", "1",
+				"-an",
 			}...)
 		}
 	}
 
 	// Audio specs
-	if config.AudioProfile != nil {
+	if config.AudioProfile != nil && !config.Passthrough {
 		profile := config.AudioProfile
 
 		args = append(args, []string{
@@ -131,19 +337,12 @@ func TranscodeSegments(ctx context.Context, ffmpegBinary string, config Transcod
 	}
 
 	// Segmenting specs
-	args = append(args, []string{
-		"-f", "segment",
-		"-segment_time_delta", "0.2",
-		"-segment_format", "mpegts",
-		"-segment_times", commaSeparatedSegTimes,
-		"-segment_start_number", fmt.Sprintf("%d", config.SegmentOffset),
-		"-segment_list_type", "flat",
-		"-segment_list", "pipe:1", // Output completed segments to stdout.
-		path.Join(config.OutputDirPath, fmt.Sprintf("%s-%%05d.ts", config.SegmentPrefix)),
-	}...)
+	args = append(args, segmentArgs(config, commaSeparatedSegTimes, "pipe:1")...) // Output completed segments to stdout.
+
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "ffmpeg").Logger()
 
-	cmd := exec.CommandContext(ctx, ffmpegBinary, args...)
-	log.Println("Starting FFmpeg process with args", strings.Join(cmd.Args[:], " "))
+	cmd := exec.Command(ffmpegBinary, args...)
+	logger.Info().Str("args", strings.Join(cmd.Args[:], " ")).Msg("starting FFmpeg process")
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
@@ -174,36 +373,66 @@ func TranscodeSegments(ctx context.Context, ffmpegBinary string, config Transcod
 		}
 
 		if err := scanner.Err(); err != nil {
-			log.Println("Error while reading FFmpeg stdout:", err)
+			logger.Err(err).Msg("error while reading FFmpeg stdout")
 		}
 	}()
 
 	// handle stderr
+	ffmpegLog := utils.FFmpegLog(logger)
 	go func() {
 		defer wg.Done()
+		defer utils.RecoverPanic(logger, func(err *utils.PanicError) {
+			// unblock ffmpeg writing rest of its log
+			_, _ = io.Copy(io.Discard, stderr)
+
+			if config.OnError != nil {
+				config.OnError(err)
+			}
+		})
 
 		scanner := bufio.NewScanner(stderr)
 		for scanner.Scan() {
-			log.Println(scanner.Text())
+			ffmpegLog.Line(scanner.Text())
+
+			if config.OnLog != nil {
+				config.OnLog(scanner.Text())
+			}
 		}
 
 		if err := scanner.Err(); err != nil {
-			log.Println("Error while reading FFmpeg stderr:", err)
+			logger.Err(err).Msg("error while reading FFmpeg stderr")
 		}
 	}()
 
-	// start execution
-	err = cmd.Start()
+	// start execution, helpers spawned by ffmpeg are killed with it
+	err = utils.ProcessGroupStart(ctx, cmd)
+	if err == nil && config.IONice {
+		if err := utils.SetIOPriorityIdle(cmd.Process.Pid); err != nil {
+			logger.Err(err).Msg("unable to set idle I/O priority")
+		}
+	}
 
-	// wait until execution finishes
+	// wait until execution finishes, process, that failed to start, is not
+	// waited for and its error is returned
+	started := err == nil
 	go func() {
 		defer wg.Done()
+		defer utils.RecoverPanic(logger, nil)
 
-		err := cmd.Wait()
+		if !started {
+			return
+		}
+
+		err := utils.ProcessGroupWait(cmd)
 		if err != nil {
-			log.Println("FFmpeg process exited with error:", err)
+			err = ffmpegLog.Wrap(err)
+			logger.Err(err).Msg("FFmpeg process exited with error")
+
+			if config.OnError != nil && ctx.Err() == nil {
+				config.OnError(err)
+			}
 		} else {
-			log.Println("FFmpeg process successfully finished.")
+			logger.Info().Msg("FFmpeg process successfully finished")
 		}
 	}()
 
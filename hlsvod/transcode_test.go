@@ -0,0 +1,62 @@
+package hlsvod
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTranscodeSegmentsHEVC(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("requires POSIX shell")
+	}
+
+	// fake ffmpeg stores its arguments
+	dir := t.TempDir()
+	script := filepath.Join(dir, "ffmpeg")
+	err := os.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > \"$(dirname \"$0\")/args\"\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	segments, err := TranscodeSegments(context.Background(), script, TranscodeConfig{
+		InputFilePath: "/media/video.mp4",
+		OutputDirPath: "/out",
+		SegmentPrefix: "1080p",
+		SegmentFormat: SegmentFormatFMP4,
+		SegmentTimes:  []float64{0, 4},
+		VideoProfile:  &VideoProfile{Width: 1920, Height: 1080, Bitrate: 3500, Codec: CodecHEVC, Format: SegmentFormatFMP4},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// wait for process to finish
+	for range segments {
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "args"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := string(data)
+	for _, expected := range []string{
+		"-c:v libx265 -profile:v main -tag:v hvc1",
+		"-forced-idr 1",
+		"-segment_format mp4 -segment_format_options movflags=+frag_keyframe+empty_moov+default_base_moof+frag_discont",
+		"/out/1080p-%05d.m4s",
+	} {
+		if !strings.Contains(args, expected) {
+			t.Errorf("args do not contain %q:\n%s", expected, args)
+		}
+	}
+
+	// H.264 level does not apply to HEVC
+	if strings.Contains(args, "-level:v") {
+		t.Errorf("args should not contain H.264 level:\n%s", args)
+	}
+}
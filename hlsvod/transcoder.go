@@ -0,0 +1,123 @@
+package hlsvod
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// Transcoder is a backend, that is able to probe and transcode media.
+// By default ffmpeg binaries are used, but any other backend (e.g. GStreamer
+// pipelines or remote transcoding API) can be plugged in using Config.
+type Transcoder interface {
+	// Returns basic information about media container and its streams.
+	ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error)
+	// Returns video stream information including keyframes.
+	ProbeVideo(ctx context.Context, inputFilePath string) (*ProbeVideoData, error)
+	// Returns a channel, that delivers name of the segments as they are encoded.
+	TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error)
+	// Returns features supported by this backend.
+	Capabilities() Capabilities
+}
+
+type Capabilities struct {
+	Keyframes bool // Backend is able to probe video keyframes.
+}
+
+type FFmpegTranscoder struct {
+	FFmpegBinary  string
+	FFprobeBinary string
+
+	// Frame rate of image sequence inputs, animated images are converted
+	// to it, 0 means ffmpeg default for sequences and original for animations.
+	ImageFramerate float64
+
+	// Keyframes of long videos are probed by parallel ffprobe runs over
+	// intervals of media, 0 or 1 means single run.
+	ProbeWorkers int
+
+	// Detected versions, flags that changed across versions are adapted.
+	FFmpegVersion  FFmpegVersion
+	FFprobeVersion FFmpegVersion
+}
+
+func NewFFmpegTranscoder(ffmpegBinary, ffprobeBinary string) *FFmpegTranscoder {
+	if ffmpegBinary == "" {
+		ffmpegBinary = utils.BinaryName("ffmpeg")
+	}
+
+	if ffprobeBinary == "" {
+		ffprobeBinary = utils.BinaryName("ffprobe")
+	}
+
+	return &FFmpegTranscoder{
+		FFmpegBinary:  ffmpegBinary,
+		FFprobeBinary: ffprobeBinary,
+	}
+}
+
+// Detect probes versions of binaries, so that flags can be adapted,
+// error is returned if any of them is not supported.
+func (t *FFmpegTranscoder) Detect(ctx context.Context) error {
+	ffmpegVersion, err := ProbeFFmpegVersion(ctx, t.FFmpegBinary)
+	if err != nil {
+		return fmt.Errorf("unable to detect ffmpeg version: %w", err)
+	}
+
+	if err := ffmpegVersion.Check(); err != nil {
+		return fmt.Errorf("ffmpeg: %w", err)
+	}
+
+	ffprobeVersion, err := ProbeFFmpegVersion(ctx, t.FFprobeBinary)
+	if err != nil {
+		return fmt.Errorf("unable to detect ffprobe version: %w", err)
+	}
+
+	if err := ffprobeVersion.Check(); err != nil {
+		return fmt.Errorf("ffprobe: %w", err)
+	}
+
+	// flags of current version are used
+	for _, version := range []FFmpegVersion{ffmpegVersion, ffprobeVersion} {
+		if !version.Known() {
+			log.Warn().Str("module", "hlsvod").Str("version", version.Raw).Msg("unrecognized ffmpeg version, assuming it is current")
+		}
+	}
+
+	t.FFmpegVersion = ffmpegVersion
+	t.FFprobeVersion = ffprobeVersion
+	return nil
+}
+
+func (t *FFmpegTranscoder) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	return probeMedia(ctx, t.FFprobeBinary, inputFilePath, t.ImageFramerate)
+}
+
+func (t *FFmpegTranscoder) ProbeVideo(ctx context.Context, inputFilePath string) (*ProbeVideoData, error) {
+	return probeVideoParallel(ctx, t.FFprobeBinary, t.FFprobeVersion, inputFilePath, t.ImageFramerate, t.ProbeWorkers)
+}
+
+func (t *FFmpegTranscoder) TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error) {
+	if config.ImageFramerate == 0 {
+		config.ImageFramerate = t.ImageFramerate
+	}
+
+	return transcodeSegments(ctx, t.FFmpegBinary, t.FFmpegVersion, config)
+}
+
+func (t *FFmpegTranscoder) ExtractFonts(ctx context.Context, inputFilePath string, fonts []ProbeFontData, outputDirPath string) error {
+	return ExtractFonts(ctx, t.FFmpegBinary, inputFilePath, fonts, outputDirPath)
+}
+
+func (t *FFmpegTranscoder) ProbeScenes(ctx context.Context, inputFilePath string, threshold float64) ([]float64, error) {
+	return probeScenes(ctx, t.FFprobeBinary, t.FFprobeVersion, inputFilePath, threshold)
+}
+
+func (t *FFmpegTranscoder) Capabilities() Capabilities {
+	return Capabilities{
+		Keyframes: true,
+	}
+}
@@ -0,0 +1,593 @@
+package hlsvod
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	tsPacketSize = 188
+	tsSyncByte   = 0x47
+
+	// tolerance for segment cut points, same as -segment_time_delta for ffmpeg
+	tsSegmentTimeDelta = 0.2
+
+	// PES timestamps are 33-bit numbers of 90kHz clock
+	tsTimestampWrap  = int64(1) << 33
+	tsTimestampClock = 90000
+
+	// source is read from this time before the first segment time, so that
+	// its keyframe is not missed because of reordered frames
+	tsSeekMargin = 1.0
+
+	// packets read when looking for a timestamp, at start and when seeking
+	tsSeekScanPackets = 4096
+)
+
+// TSSegmenter splits MPEG-TS sources into segments at keyframes in pure Go,
+// without spawning any process. It is used only for passthrough of MPEG-TS
+// sources into MPEG-TS segments, everything else is delegated to fallback
+// transcoder.
+type TSSegmenter struct {
+	logger   zerolog.Logger
+	fallback Transcoder
+}
+
+func NewTSSegmenter(fallback Transcoder) *TSSegmenter {
+	return &TSSegmenter{
+		logger:   log.With().Str("module", "hlsvod").Str("submodule", "tssegmenter").Logger(),
+		fallback: fallback,
+	}
+}
+
+func (t *TSSegmenter) ProbeMedia(ctx context.Context, inputFilePath string) (*ProbeMediaData, error) {
+	return t.fallback.ProbeMedia(ctx, inputFilePath)
+}
+
+func (t *TSSegmenter) ProbeVideo(ctx context.Context, inputFilePath string) (*ProbeVideoData, error) {
+	return t.fallback.ProbeVideo(ctx, inputFilePath)
+}
+
+func (t *TSSegmenter) Capabilities() Capabilities {
+	return t.fallback.Capabilities()
+}
+
+func (t *TSSegmenter) TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error) {
+	if !config.Passthrough || config.AudioOffset != 0 || config.Fallback || config.SegmentFormat == SegmentFormatFMP4 || !isTransportStream(config.InputFilePath) {
+		return t.fallback.TranscodeSegments(ctx, config)
+	}
+
+	if len(config.SegmentTimes) < 2 {
+		return nil, fmt.Errorf("minimum 2 segment times needed")
+	}
+
+	file, err := os.Open(config.InputFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	segments := make(chan string, 1)
+
+	go func() {
+		defer close(segments)
+		defer file.Close()
+
+		err := SegmentTransportStream(ctx, file, config, segments)
+		if err != nil {
+			t.logger.Err(err).Str("path", config.InputFilePath).Msg("segmenting transport stream failed")
+
+			if config.OnError != nil && ctx.Err() == nil {
+				config.OnError(err)
+			}
+		}
+	}()
+
+	return segments, nil
+}
+
+// checks if file starts with MPEG-TS sync bytes
+func isTransportStream(inputFilePath string) bool {
+	file, err := os.Open(inputFilePath)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	buf := make([]byte, 2*tsPacketSize+1)
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return false
+	}
+
+	return buf[0] == tsSyncByte && buf[tsPacketSize] == tsSyncByte && buf[2*tsPacketSize] == tsSyncByte
+}
+
+type tsPacket struct {
+	pid          uint16
+	unitStart    bool
+	randomAccess bool
+	payload      []byte
+}
+
+func parseTSPacket(b []byte) (tsPacket, error) {
+	if b[0] != tsSyncByte {
+		return tsPacket{}, errors.New("lost transport stream sync")
+	}
+
+	packet := tsPacket{
+		pid:       uint16(b[1]&0x1f)<<8 | uint16(b[2]),
+		unitStart: b[1]&0x40 != 0,
+	}
+
+	offset := 4
+	adaptationFieldControl := (b[3] >> 4) & 0x3
+
+	// adaptation field present
+	if adaptationFieldControl&0x2 != 0 {
+		length := int(b[4])
+		if length > 0 {
+			packet.randomAccess = b[5]&0x40 != 0
+		}
+		offset += 1 + length
+	}
+
+	// payload present
+	if adaptationFieldControl&0x1 != 0 && offset < tsPacketSize {
+		packet.payload = b[offset:]
+	}
+
+	return packet, nil
+}
+
+// returns PES presentation timestamp in 90kHz clock ticks
+func parsePESTimestamp(payload []byte) (int64, bool) {
+	if len(payload) < 14 || payload[0] != 0 || payload[1] != 0 || payload[2] != 1 {
+		return 0, false
+	}
+
+	// PTS flag
+	if payload[7]&0x80 == 0 {
+		return 0, false
+	}
+
+	p := payload[9:14]
+	pts := int64(p[0]>>1&0x07)<<30 |
+		int64(p[1])<<22 |
+		int64(p[2]>>1)<<15 |
+		int64(p[3])<<7 |
+		int64(p[4]>>1)
+
+	return pts, true
+}
+
+// unwraps 33-bit timestamps relative to the first timestamp of stream, so
+// that they keep increasing after wrap
+type tsClock struct {
+	first int64
+	set   bool
+}
+
+// returns unwrapped timestamp in seconds, first call sets reference
+func (c *tsClock) seconds(pts int64) float64 {
+	if !c.set {
+		c.first, c.set = pts, true
+	}
+
+	if pts < c.first-tsTimestampWrap/2 {
+		pts += tsTimestampWrap
+	}
+
+	return float64(pts) / tsTimestampClock
+}
+
+// returns payload of PSI section, without pointer field
+func psiSection(payload []byte) []byte {
+	if len(payload) < 1 {
+		return nil
+	}
+
+	pointer := int(payload[0])
+	if 1+pointer >= len(payload) {
+		return nil
+	}
+
+	return payload[1+pointer:]
+}
+
+// returns PMT pid from PAT section
+func parsePAT(payload []byte) (uint16, bool) {
+	section := psiSection(payload)
+	if len(section) < 8 {
+		return 0, false
+	}
+
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+	end := 3 + length - 4 // without CRC
+	if end > len(section) {
+		end = len(section)
+	}
+
+	for i := 8; i+4 <= end; i += 4 {
+		program := uint16(section[i])<<8 | uint16(section[i+1])
+		if program == 0 {
+			continue // network PID
+		}
+
+		return uint16(section[i+2]&0x1f)<<8 | uint16(section[i+3]), true
+	}
+
+	return 0, false
+}
+
+// returns video and audio pids from PMT section
+func parsePMT(payload []byte) (video uint16, audio uint16, ok bool) {
+	section := psiSection(payload)
+	if len(section) < 12 {
+		return
+	}
+
+	length := int(section[1]&0x0f)<<8 | int(section[2])
+	end := 3 + length - 4 // without CRC
+	if end > len(section) {
+		end = len(section)
+	}
+
+	programInfoLength := int(section[10]&0x0f)<<8 | int(section[11])
+	for i := 12 + programInfoLength; i+5 <= end; {
+		streamType := section[i]
+		pid := uint16(section[i+1]&0x1f)<<8 | uint16(section[i+2])
+		esInfoLength := int(section[i+3]&0x0f)<<8 | int(section[i+4])
+
+		switch streamType {
+		// MPEG-1, MPEG-2, H.264, H.265
+		case 0x01, 0x02, 0x1b, 0x24:
+			if video == 0 {
+				video = pid
+			}
+		// MPEG-1, MPEG-2, AAC, LATM, AC-3
+		case 0x03, 0x04, 0x0f, 0x11, 0x81:
+			if audio == 0 {
+				audio = pid
+			}
+		}
+
+		i += 5 + esInfoLength
+	}
+
+	ok = true
+	return
+}
+
+// program tables and streams of transport stream
+type tsStreams struct {
+	patPacket, pmtPacket []byte
+	pmtPid               uint16
+	videoPid, audioPid   uint16
+	clock                tsClock
+}
+
+// updates program tables from packet
+func (s *tsStreams) update(packet tsPacket, buf []byte) {
+	switch {
+	case packet.pid == 0 && packet.unitStart:
+		if pid, ok := parsePAT(packet.payload); ok {
+			s.pmtPid = pid
+			s.patPacket = append([]byte{}, buf...)
+		}
+	case s.pmtPid != 0 && packet.pid == s.pmtPid && packet.unitStart:
+		if video, audio, ok := parsePMT(packet.payload); ok {
+			s.videoPid, s.audioPid = video, audio
+			s.pmtPacket = append([]byte{}, buf...)
+		}
+	}
+}
+
+// returns unwrapped timestamp of packet starting PES of video stream, or of
+// audio stream without video
+func (s *tsStreams) timestamp(packet tsPacket) (float64, bool) {
+	pid := s.videoPid
+	if pid == 0 {
+		pid = s.audioPid
+	}
+
+	if pid == 0 || packet.pid != pid || !packet.unitStart {
+		return 0, false
+	}
+
+	pts, ok := parsePESTimestamp(packet.payload)
+	if !ok {
+		return 0, false
+	}
+
+	return s.clock.seconds(pts), true
+}
+
+// returns true, if segment can be cut at packet, segments are cut at video
+// keyframes or at audio frames, if there is no video
+func (s *tsStreams) isCutPoint(packet tsPacket) bool {
+	return packet.unitStart && ((s.videoPid != 0 && packet.pid == s.videoPid && packet.randomAccess) ||
+		(s.videoPid == 0 && s.audioPid != 0 && packet.pid == s.audioPid))
+}
+
+// returns first timestamp found within scanned packets from offset
+func (s *tsStreams) timestampAt(reader io.ReadSeeker, offset int64, update bool) (float64, bool, error) {
+	if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+		return 0, false, err
+	}
+
+	r := bufio.NewReaderSize(reader, 512*tsPacketSize)
+	buf := make([]byte, tsPacketSize)
+
+	for n := 0; n < tsSeekScanPackets; n++ {
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return 0, false, nil
+			}
+			return 0, false, err
+		}
+
+		packet, err := parseTSPacket(buf)
+		if err != nil {
+			return 0, false, err
+		}
+
+		if update {
+			s.update(packet, buf)
+		}
+
+		if pts, ok := s.timestamp(packet); ok {
+			return pts, true, nil
+		}
+	}
+
+	return 0, false, nil
+}
+
+// returns packet aligned offset, from which reading finds keyframe at time,
+// it is found by bisection on timestamps, so that long sources are not read
+// from the beginning
+func (s *tsStreams) seek(reader io.ReadSeeker, time float64) (int64, error) {
+	size, err := reader.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+
+	// offset of lo packet is before time
+	lo, hi := int64(0), size/tsPacketSize
+	for hi-lo > tsSeekScanPackets {
+		mid := lo + (hi-lo)/2
+
+		pts, ok, err := s.timestampAt(reader, mid*tsPacketSize, false)
+		if err != nil {
+			return 0, err
+		}
+
+		if ok && pts < time {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+
+	return lo * tsPacketSize, nil
+}
+
+// reads transport stream and writes segments split at keyframes closest to
+// segment times, names of the finished segments are sent to channel
+func SegmentTransportStream(ctx context.Context, reader io.ReadSeeker, config TranscodeConfig, segments chan<- string) error {
+	segmentTimes := config.SegmentTimes
+	if len(segmentTimes) < 2 {
+		return fmt.Errorf("minimum 2 segment times needed")
+	}
+
+	var (
+		streams tsStreams
+
+		index   = -1 // current segment index, relative to segment times
+		output  *os.File
+		outName string
+	)
+
+	// partial segment is never left on disk
+	defer func() {
+		if output != nil {
+			output.Close()
+			os.Remove(output.Name())
+		}
+	}()
+
+	// closes current segment and notifies about it
+	finishSegment := func() error {
+		if output == nil {
+			return nil
+		}
+
+		file := output
+		output = nil
+		if err := file.Close(); err != nil {
+			os.Remove(file.Name())
+			return err
+		}
+
+		select {
+		case segments <- outName:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		return nil
+	}
+
+	// opens new segment starting with program tables
+	startSegment := func(i int) error {
+		if err := finishSegment(); err != nil {
+			return err
+		}
+
+		index = i
+		outName = fmt.Sprintf("%s-%05d.ts", config.SegmentPrefix, config.SegmentOffset+i)
+
+		var err error
+		output, err = os.Create(filepath.Join(config.OutputDirPath, outName))
+		if err != nil {
+			return err
+		}
+
+		for _, table := range [][]byte{streams.patPacket, streams.pmtPacket} {
+			if table == nil {
+				continue
+			}
+
+			if _, err := output.Write(table); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	// program tables and first timestamp are at the beginning
+	first, ok, err := streams.timestampAt(reader, 0, true)
+	if err != nil {
+		return err
+	}
+
+	offset := int64(0)
+	if ok && segmentTimes[0]-tsSeekMargin > first {
+		offset, err = streams.seek(reader, segmentTimes[0]-tsSeekMargin)
+		if err != nil {
+			return err
+		}
+	}
+
+	if _, err := reader.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	r := bufio.NewReaderSize(reader, 512*tsPacketSize)
+	buf := make([]byte, tsPacketSize)
+
+	for n := 0; ; n++ {
+		// check for cancellation from time to time
+		if n%1024 == 0 && ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if _, err := io.ReadFull(r, buf); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				break
+			}
+			return err
+		}
+
+		packet, err := parseTSPacket(buf)
+		if err != nil {
+			return err
+		}
+
+		streams.update(packet, buf)
+
+		if streams.isCutPoint(packet) {
+			if pts, ok := streams.timestamp(packet); ok {
+				next := index + 1
+				if next >= len(segmentTimes)-1 {
+					// reached end time
+					if pts >= segmentTimes[len(segmentTimes)-1]-tsSegmentTimeDelta {
+						return finishSegment()
+					}
+				} else if pts >= segmentTimes[next]-tsSegmentTimeDelta {
+					if err := startSegment(next); err != nil {
+						return err
+					}
+				}
+			}
+		}
+
+		if output != nil {
+			if _, err := output.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+
+	return finishSegment()
+}
+
+// TransportStreamDuration returns duration of transport stream measured from
+// presentation timestamps of its video stream, or audio stream without video.
+func TransportStreamDuration(reader io.Reader) (float64, error) {
+	var (
+		pmtPid             uint16
+		videoPid, audioPid uint16
+		videoPts, audioPts []float64
+		clock              tsClock
+	)
+
+	buf := make([]byte, tsPacketSize)
+	for {
+		if _, err := io.ReadFull(reader, buf); err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return 0, err
+		}
+
+		packet, err := parseTSPacket(buf)
+		if err != nil {
+			return 0, err
+		}
+
+		// timestamps are only in packets starting PES
+		if !packet.unitStart || packet.payload == nil {
+			continue
+		}
+
+		switch {
+		case packet.pid == 0:
+			if pid, ok := parsePAT(packet.payload); ok {
+				pmtPid = pid
+			}
+		case pmtPid != 0 && packet.pid == pmtPid:
+			if video, audio, ok := parsePMT(packet.payload); ok {
+				videoPid, audioPid = video, audio
+			}
+		case videoPid != 0 && packet.pid == videoPid:
+			if pts, ok := parsePESTimestamp(packet.payload); ok {
+				videoPts = append(videoPts, clock.seconds(pts))
+			}
+		case audioPid != 0 && packet.pid == audioPid:
+			if pts, ok := parsePESTimestamp(packet.payload); ok {
+				audioPts = append(audioPts, clock.seconds(pts))
+			}
+		}
+	}
+
+	pts := videoPts
+	if len(pts) == 0 {
+		pts = audioPts
+	}
+
+	if len(pts) == 0 {
+		return 0, errors.New("no presentation timestamps found")
+	}
+
+	// frames can be reordered
+	sort.Float64s(pts)
+
+	last := len(pts) - 1
+	duration := pts[last] - pts[0]
+
+	// last frame lasts as long as the previous one
+	if last > 0 {
+		duration += pts[last] - pts[last-1]
+	}
+
+	return duration, nil
+}
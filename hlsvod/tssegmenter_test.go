@@ -0,0 +1,352 @@
+package hlsvod
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testPmtPid   = 0x1000
+	testVideoPid = 0x100
+)
+
+func testTSPacket(pid uint16, unitStart, randomAccess bool, payload []byte) []byte {
+	b := make([]byte, tsPacketSize)
+	b[0] = tsSyncByte
+	b[1] = byte(pid>>8) & 0x1f
+	if unitStart {
+		b[1] |= 0x40
+	}
+	b[2] = byte(pid)
+
+	// adaptation field with stuffing followed by payload
+	adaptationLength := tsPacketSize - 4 - 1 - len(payload)
+	b[3] = 0x30
+	b[4] = byte(adaptationLength)
+	if adaptationLength > 0 {
+		for i := 5; i < 5+adaptationLength; i++ {
+			b[i] = 0xff
+		}
+		b[5] = 0
+		if randomAccess {
+			b[5] = 0x40
+		}
+	}
+
+	copy(b[5+adaptationLength:], payload)
+	return b
+}
+
+func testPESPayload(seconds float64) []byte {
+	pts := int64(math.Round(seconds*tsTimestampClock)) % tsTimestampWrap
+	return []byte{
+		0x00, 0x00, 0x01, 0xe0, 0x00, 0x00, 0x80, 0x80, 0x05,
+		byte(0x21 | (pts>>29)&0x0e),
+		byte(pts >> 22),
+		byte(0x01 | (pts>>14)&0xfe),
+		byte(pts >> 7),
+		byte(0x01 | (pts<<1)&0xfe),
+	}
+}
+
+func testTransportStream(keyframes []float64) []byte {
+	pat := []byte{
+		0x00,             // pointer field
+		0x00, 0xb0, 0x0d, // table id, section length
+		0x00, 0x01, 0xc1, 0x00, 0x00,
+		0x00, 0x01, 0xf0, 0x00, // program 1 -> PMT pid
+		0x00, 0x00, 0x00, 0x00, // CRC
+	}
+	pat[11] = 0xe0 | byte(testPmtPid>>8)
+	pat[12] = byte(testPmtPid & 0xff)
+
+	pmt := []byte{
+		0x00,             // pointer field
+		0x02, 0xb0, 0x12, // table id, section length
+		0x00, 0x01, 0xc1, 0x00, 0x00,
+		0xe1, 0x00, // PCR pid
+		0xf0, 0x00, // program info length
+		0x1b, 0xe1, 0x00, 0xf0, 0x00, // H.264 video stream
+		0x00, 0x00, 0x00, 0x00, // CRC
+	}
+
+	var buf bytes.Buffer
+	buf.Write(testTSPacket(0, true, false, pat))
+	buf.Write(testTSPacket(testPmtPid, true, false, pmt))
+
+	for _, keyframe := range keyframes {
+		buf.Write(testTSPacket(testVideoPid, true, true, testPESPayload(keyframe)))
+		buf.Write(testTSPacket(testVideoPid, false, false, []byte{0x00}))
+	}
+
+	return buf.Bytes()
+}
+
+func TestSegmentTransportStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		keyframes     []float64
+		segmentTimes  []float64
+		segmentOffset int
+		want          []string
+		wantPackets   []int
+	}{
+		{
+			name:         "from beginning",
+			keyframes:    []float64{0, 2, 4, 6, 8, 10},
+			segmentTimes: []float64{0, 4, 8, 10},
+			want:         []string{"test-00000.ts", "test-00001.ts", "test-00002.ts"},
+			wantPackets:  []int{2 + 4, 2 + 4, 2 + 2},
+		},
+		{
+			name:          "with offset",
+			keyframes:     []float64{0, 2, 4, 6, 8, 10, 12},
+			segmentTimes:  []float64{4, 8, 12},
+			segmentOffset: 1,
+			want:          []string{"test-00001.ts", "test-00002.ts"},
+			wantPackets:   []int{2 + 4, 2 + 4},
+		},
+		{
+			name:         "keyframes within delta",
+			keyframes:    []float64{0, 3.9, 8.1},
+			segmentTimes: []float64{0, 4, 8.1},
+			want:         []string{"test-00000.ts", "test-00001.ts"},
+			wantPackets:  []int{2 + 2, 2 + 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			segments := make(chan string, len(tt.segmentTimes))
+
+			err := SegmentTransportStream(context.Background(), bytes.NewReader(testTransportStream(tt.keyframes)), TranscodeConfig{
+				OutputDirPath: dir,
+				SegmentPrefix: "test",
+				SegmentOffset: tt.segmentOffset,
+				SegmentTimes:  tt.segmentTimes,
+			}, segments)
+			close(segments)
+
+			if err != nil {
+				t.Fatalf("SegmentTransportStream() error = %v", err)
+			}
+
+			got := []string{}
+			gotPackets := []int{}
+			for segment := range segments {
+				got = append(got, segment)
+
+				fi, err := os.Stat(filepath.Join(dir, segment))
+				if err != nil {
+					t.Fatalf("segment %s not found: %v", segment, err)
+				}
+				gotPackets = append(gotPackets, int(fi.Size())/tsPacketSize)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SegmentTransportStream() = %v, want %v", got, tt.want)
+			}
+
+			if !reflect.DeepEqual(gotPackets, tt.wantPackets) {
+				t.Errorf("SegmentTransportStream() packets = %v, want %v", gotPackets, tt.wantPackets)
+			}
+		})
+	}
+}
+
+// reader counting bytes read
+type countingReader struct {
+	*bytes.Reader
+	read int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.Reader.Read(p)
+	c.read += int64(n)
+	return n, err
+}
+
+func TestSegmentTransportStreamSeek(t *testing.T) {
+	keyframes := []float64{}
+	for i := 0; i <= 20000; i++ {
+		keyframes = append(keyframes, float64(i)/10)
+	}
+
+	data := testTransportStream(keyframes)
+	reader := &countingReader{Reader: bytes.NewReader(data)}
+	segments := make(chan string, 2)
+
+	err := SegmentTransportStream(context.Background(), reader, TranscodeConfig{
+		OutputDirPath: t.TempDir(),
+		SegmentPrefix: "test",
+		SegmentTimes:  []float64{1990, 1995, 2000},
+	}, segments)
+	close(segments)
+
+	if err != nil {
+		t.Fatalf("SegmentTransportStream() error = %v", err)
+	}
+
+	if len(segments) != 2 {
+		t.Errorf("SegmentTransportStream() returned %d segments, want 2", len(segments))
+	}
+
+	// source must not be read from the beginning up to segment times
+	if reader.read > int64(len(data))/4 {
+		t.Errorf("SegmentTransportStream() read %d of %d bytes", reader.read, len(data))
+	}
+}
+
+func TestSegmentTransportStreamWrap(t *testing.T) {
+	wrap := float64(tsTimestampWrap) / tsTimestampClock
+
+	dir := t.TempDir()
+	segments := make(chan string, 2)
+
+	err := SegmentTransportStream(context.Background(), bytes.NewReader(testTransportStream([]float64{
+		wrap - 4, wrap - 2, wrap, wrap + 2, wrap + 4,
+	})), TranscodeConfig{
+		OutputDirPath: dir,
+		SegmentPrefix: "test",
+		SegmentTimes:  []float64{wrap - 4, wrap, wrap + 4},
+	}, segments)
+	close(segments)
+
+	if err != nil {
+		t.Fatalf("SegmentTransportStream() error = %v", err)
+	}
+
+	got := []string{}
+	for segment := range segments {
+		got = append(got, segment)
+	}
+
+	if want := []string{"test-00000.ts", "test-00001.ts"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SegmentTransportStream() = %v, want %v", got, want)
+	}
+}
+
+func TestSegmentTransportStreamError(t *testing.T) {
+	data := testTransportStream([]float64{0, 2, 4, 6})
+
+	// lost sync within the second segment
+	data = append(data[:len(data)-tsPacketSize], make([]byte, tsPacketSize)...)
+
+	dir := t.TempDir()
+	segments := make(chan string, 2)
+
+	err := SegmentTransportStream(context.Background(), bytes.NewReader(data), TranscodeConfig{
+		OutputDirPath: dir,
+		SegmentPrefix: "test",
+		SegmentTimes:  []float64{0, 4, 8},
+	}, segments)
+	close(segments)
+
+	if err == nil {
+		t.Fatal("SegmentTransportStream() expected error")
+	}
+
+	// only finished segment is left
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(files) != 1 || files[0].Name() != "test-00000.ts" {
+		t.Errorf("files left after error = %v, want only finished segment", files)
+	}
+}
+
+func TestTransportStreamDuration(t *testing.T) {
+	// reordered frames
+	data := testTransportStream([]float64{10, 10.08, 10.04, 10.12})
+
+	got, err := TransportStreamDuration(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("TransportStreamDuration() error = %v", err)
+	}
+
+	if want := 0.16; math.Abs(got-want) > 0.0001 {
+		t.Errorf("TransportStreamDuration() = %v, want %v", got, want)
+	}
+
+	// no timestamps
+	if _, err := TransportStreamDuration(bytes.NewReader(testTransportStream(nil))); err == nil {
+		t.Error("TransportStreamDuration() expected error")
+	}
+}
+
+// counting transcoder counts transcodes, that would spawn ffmpeg
+type countingTranscoder struct {
+	*FakeTranscoder
+	transcodes int32
+}
+
+func (c *countingTranscoder) TranscodeSegments(ctx context.Context, config TranscodeConfig) (chan string, error) {
+	atomic.AddInt32(&c.transcodes, 1)
+	return c.FakeTranscoder.TranscodeSegments(ctx, config)
+}
+
+func TestManagerTSSegmenter(t *testing.T) {
+	dir := t.TempDir()
+
+	// keyframe every second, as reported by fake probe
+	keyframes := []float64{}
+	for i := 0; i <= 10; i++ {
+		keyframes = append(keyframes, float64(i))
+	}
+
+	mediaPath := filepath.Join(dir, "video.ts")
+	if err := os.WriteFile(mediaPath, testTransportStream(keyframes), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	transcodeDir := filepath.Join(dir, "transcode")
+	if err := os.Mkdir(transcodeDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	transcoder := &countingTranscoder{FakeTranscoder: NewFakeTranscoder(10 * time.Second)}
+	m := New(Config{
+		MediaPath:     mediaPath,
+		TranscodeDir:  transcodeDir,
+		SegmentPrefix: "test",
+		Passthrough:   true,
+		Transcoder:    transcoder,
+	})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer m.Stop()
+
+	if err := m.Warm(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.passthrough {
+		t.Fatal("source should be passed through")
+	}
+
+	if transcoder.transcodes != 0 {
+		t.Errorf("transcoder called %d times, want 0", transcoder.transcodes)
+	}
+
+	for index := 0; index < len(m.breakpoints)-1; index++ {
+		data, err := os.ReadFile(filepath.Join(transcodeDir, m.getSegmentName(index)))
+		if err != nil {
+			t.Fatalf("segment %d: %v", index, err)
+		}
+
+		if len(data) == 0 || len(data)%tsPacketSize != 0 || data[0] != tsSyncByte {
+			t.Errorf("segment %d is not transport stream", index)
+		}
+	}
+}
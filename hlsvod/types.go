@@ -3,29 +3,139 @@ package hlsvod
 import (
 	"context"
 	"net/http"
+	"time"
+
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/httperror"
 )
 
 type Config struct {
 	MediaPath     string // Transcoded video input.
 	TranscodeDir  string // Temporary directory to store transcoded elements.
+	MemoryDir     string // Fast directory (e.g. tmpfs) for recently transcoded segments, empty means disabled.
+	MemoryMax     int64  // Maximum size of segments in memory dir in bytes, older segments are moved to transcode dir.
 	SegmentPrefix string
+	SegmentsMax   int // Maximum transcoded segments kept on disk, least popular are evicted. 0 means unlimited.
+
+	// Transcode directories on other volumes (e.g. disks), transcoded segments
+	// are balanced between them and transcode dir and found by their index.
+	TranscodeDirs []string
+	Placement     string // Free-space (default) or round-robin.
+
+	ReadyTimeout time.Duration // How long can requests wait for transcode to be ready, 0 means default.
+
+	// Serve segments while they are still transcoded using chunked transfer,
+	// so that seeking does not wait for whole segment. Segments encrypted by
+	// key provider or segment key are always served when finished.
+	ChunkedSegments bool
+
+	// Playlist of type EVENT lists only segments transcoded so far, whole media
+	// is transcoded in background and playlist is switched to VOD with ENDLIST,
+	// when last segment exists. Not used with growing media.
+	EventPlaylist bool
+
+	ClipStart float64 // Virtual clip start in seconds.
+	ClipEnd   float64 // Virtual clip end in seconds, 0 means until the end of media.
+
+	// Media modified recently is considered to be still written (e.g. ongoing
+	// recording), it is periodically re-probed and its playlist is extended
+	// until it stays unchanged for idle period. Keyframes and clip are not used.
+	Growing     bool
+	GrowingPoll time.Duration // How often is growing media checked, 0 means default.
+	GrowingIdle time.Duration // How long must media stay unchanged to be finished, 0 means default.
+
+	// How often is source media checked for replacement or truncation, 0 means
+	// disabled. Changed media invalidates cached metadata and segments, that
+	// were not requested yet, and SourceChanged event is published.
+	SourceWatch time.Duration
 
 	VideoProfile   *VideoProfile
 	VideoKeyframes bool
+	Breakpoints    BreakpointStrategy // How media is split into segments, if nil, keyframes are used.
 	AudioProfile   *AudioProfile
+	AudioOffset    float64 // Audio delay in seconds, negative values make audio play earlier.
+	AudioStream    int     // Index of audio stream, e.g. 1 for 0:a:1. Without video profile, rendition is audio-only.
+
+	// Language tags of media mapped to BCP-47 tags served in metadata, keys
+	// are lowercase, e.g. mislabeled "und" to "en".
+	LanguageMap map[string]string
+
+	// Render text subtitle stream into video, fonts attached to media
+	// (e.g. MKV with ASS subtitles) are extracted to transcode dir.
+	BurnSubtitles  bool
+	SubtitleStream int // Index of subtitle stream, e.g. 1 for 0:s:1.
+
+	// Text burned into video, e.g. viewer-specific watermark. Streams are
+	// not copied, so that text is never left out.
+	Overlay *Overlay
+
+	// Copy streams without encoding if they pass compatibility matrix,
+	// otherwise video and audio profiles are used.
+	Passthrough         bool
+	CompatibilityMatrix *CompatibilityMatrix // If nil, default matrix is used.
+
+	Encoder  string       // Video encoder of this rendition, empty means auto.
+	Encoders *EncoderPool // Hardware encoder sessions shared by renditions, if nil, encoder is used as is.
+	MaxLevel int          // Highest H.264 level of encoded video, e.g. 51 for 5.1, 0 means DefaultMaxLevel.
 
 	Cache    bool
 	CacheDir string // If not empty, cache will folder will be used instead of media path
 
+	// If not nil, cache data are stored in it (e.g. shared by instances)
+	// instead of cache files in media path or cache dir.
+	CacheStore CacheStore
+
+	// If not empty, segment files on disk and global cache files are named by
+	// HMAC of media path and segment prefix, and cache data is encrypted, so
+	// that shared directories do not reveal media library. Served segment
+	// names are mapped to files on disk by their index.
+	ObfuscateKey []byte
+
+	// If not empty, segment files are encrypted on disk using AES-GCM and
+	// decrypted while serving, so that storage does not expose watchable media.
+	SegmentKey []byte
+
 	FFmpegBinary  string
 	FFprobeBinary string
+	IONice        bool // Run transcode processes with idle I/O priority, so that they do not starve serving reads.
+
+	Transcoder Transcoder // If nil, ffmpeg binaries will be used.
+	Clock      Clock      // If nil, system clock will be used.
+	FS         FileSystem // If nil, operating system files will be used.
+	OpenFiles  int        // Opened segment files kept for reuse by requests, 0 means disabled.
+
+	KeyProvider      KeyProvider      // If not nil, segments are encrypted using provided keys.
+	SegmentEncrypter SegmentEncrypter // If nil, built-in AES-128 encrypter is used, SAMPLE-AES requires custom one.
+
+	ErrorResponder httperror.Responder // Writes error responses, if nil, JSON is used.
+
+	Session string      // Session identifier used in published events.
+	Events  *events.Bus // Bus for published events, can be nil.
+
+	// If not nil, it is called once per start, when session fails to get
+	// ready with the cause, or when it is stopped with nil.
+	OnStop func(err error)
 }
 
 type Manager interface {
 	Start() error
 	Stop()
+	Err() error
+	WaitReady(ctx context.Context) error
 	Preload(ctx context.Context) (*ProbeMediaData, error)
+	Waveform(ctx context.Context, samplesPerPixel int) (*WaveformData, error)
+	Cleanup()
+
+	Heartbeat()
+	Idle() time.Duration
+	Warm(ctx context.Context, ranges []WarmRange) error
+	SwapProfile(video *VideoProfile, audio *AudioProfile) (int, error)
 
 	ServePlaylist(w http.ResponseWriter, r *http.Request)
 	ServeMedia(w http.ResponseWriter, r *http.Request)
+	ServeStats(w http.ResponseWriter, r *http.Request)
+	ServeMetadata(w http.ResponseWriter, r *http.Request)
+
+	Stats() []SegmentStats
+	PurgeCache() error
 }
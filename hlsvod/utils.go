@@ -2,6 +2,7 @@ package hlsvod
 
 import (
 	"fmt"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -54,36 +55,270 @@ func convertToSegments(rawTimeList []float64, duration time.Duration, segmentLen
 	return append(segmentStartTimes, durationSec)
 }
 
+// restricts segments to clip boundaries, breakpoints too close to clip start or end are dropped
+func clipSegments(breakpoints []float64, clipStart float64, clipEnd float64, segmentOffset float64) []float64 {
+	if len(breakpoints) == 0 {
+		return breakpoints
+	}
+
+	last := breakpoints[len(breakpoints)-1]
+	if clipEnd <= 0 || clipEnd > last {
+		clipEnd = last
+	}
+
+	if clipStart < 0 {
+		clipStart = 0
+	}
+
+	// clip starts at or after end of media
+	if clipStart >= clipEnd {
+		return nil
+	}
+
+	segmentStartTimes := []float64{clipStart}
+	for _, time := range breakpoints {
+		if time-clipStart < segmentOffset || clipEnd-time < segmentOffset {
+			continue
+		}
+
+		segmentStartTimes = append(segmentStartTimes, time)
+	}
+
+	return append(segmentStartTimes, clipEnd)
+}
+
+// appends query to all URIs in playlist
+func playlistWithQuery(playlist string, rawQuery string) string {
+	lines := strings.Split(playlist, "\n")
+	for i, line := range lines {
+		// init segment of fMP4 segments
+		if strings.HasPrefix(line, "#EXT-X-MAP:URI=") && strings.HasSuffix(line, `"`) {
+			lines[i] = strings.TrimSuffix(line, `"`) + "?" + rawQuery + `"`
+			continue
+		}
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		lines[i] = line + "?" + rawQuery
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// AudioRendition is an alternative audio track advertised in master playlist.
+type AudioRendition struct {
+	ID          string // Profile name formatted by segment name format, empty means audio muxed in video renditions.
+	Name        string
+	Language    string
+	Default     bool
+	Descriptive bool // Audio description of video for visually impaired.
+	Commentary  bool
+}
+
+// group of audio renditions in master playlist
+const audioGroupID = "audio"
+
+func (a AudioRendition) media(groupID, segmentNameFmt string) string {
+	attrs := []string{
+		"TYPE=AUDIO",
+		fmt.Sprintf("GROUP-ID=%q", groupID),
+		fmt.Sprintf("NAME=%q", a.Name),
+	}
+
+	if a.Language != "" {
+		attrs = append(attrs, fmt.Sprintf("LANGUAGE=%q", a.Language))
+	}
+
+	if a.Default {
+		attrs = append(attrs, "DEFAULT=YES")
+	} else {
+		attrs = append(attrs, "DEFAULT=NO")
+	}
+
+	// commentary should be selected only by user, default rendition must be
+	// selectable automatically (RFC 8216 section 4.3.4.1)
+	if a.Commentary && !a.Default {
+		attrs = append(attrs, "AUTOSELECT=NO")
+	} else {
+		attrs = append(attrs, "AUTOSELECT=YES")
+	}
+
+	if a.Descriptive {
+		attrs = append(attrs, `CHARACTERISTICS="public.accessibility.describes-video"`)
+	}
+
+	if a.ID != "" {
+		attrs = append(attrs, fmt.Sprintf("URI=%q", fmt.Sprintf(segmentNameFmt, a.ID)))
+	}
+
+	return "#EXT-X-MEDIA:" + strings.Join(attrs, ",")
+}
+
+// SubtitleRendition is a WebVTT subtitle track advertised in master playlist.
+type SubtitleRendition struct {
+	ID       string // Subtitle playlist name formatted by segment name format.
+	Name     string
+	Language string
+	Default  bool
+}
+
+// group of subtitle renditions in master playlist
+const subtitleGroupID = "subs"
+
+func (s SubtitleRendition) media(groupID, segmentNameFmt string) string {
+	attrs := []string{
+		"TYPE=SUBTITLES",
+		fmt.Sprintf("GROUP-ID=%q", groupID),
+		fmt.Sprintf("NAME=%q", s.Name),
+	}
+
+	if s.Language != "" {
+		attrs = append(attrs, fmt.Sprintf("LANGUAGE=%q", s.Language))
+	}
+
+	if s.Default {
+		attrs = append(attrs, "DEFAULT=YES")
+	} else {
+		attrs = append(attrs, "DEFAULT=NO")
+	}
+
+	attrs = append(attrs, "AUTOSELECT=YES", fmt.Sprintf("URI=%q", fmt.Sprintf(segmentNameFmt, s.ID)))
+	return "#EXT-X-MEDIA:" + strings.Join(attrs, ",")
+}
+
+// SubtitlePlaylist returns media playlist with single WebVTT file covering
+// whole media duration.
+func SubtitlePlaylist(duration float64, uri string) string {
+	return strings.Join([]string{
+		"#EXTM3U",
+		"#EXT-X-VERSION:3",
+		fmt.Sprintf("#EXT-X-TARGETDURATION:%.0f", math.Ceil(duration)),
+		"#EXT-X-MEDIA-SEQUENCE:0",
+		"#EXT-X-PLAYLIST-TYPE:VOD",
+		fmt.Sprintf("#EXTINF:%.3f,", duration),
+		uri,
+		"#EXT-X-ENDLIST",
+	}, "\n")
+}
+
 func StreamsPlaylist(profiles map[string]VideoProfile, segmentNameFmt string) string {
-	layers := []struct {
-		Bitrate int
-		Entries []string
-	}{}
-
-	for name, profile := range profiles {
-		layers = append(layers, struct {
-			Bitrate int
-			Entries []string
-		}{
-			profile.Bitrate,
-			[]string{
-				fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d,NAME=%s", profile.Bitrate, profile.Width, profile.Height, name),
-				fmt.Sprintf(segmentNameFmt, name),
-			},
-		})
-	}
-
-	// sort by bitrate
-	sort.Slice(layers, func(i, j int) bool {
-		return layers[i].Bitrate < layers[j].Bitrate
+	return MasterPlaylist(profiles, segmentNameFmt, MasterPlaylistOptions{})
+}
+
+type MasterPlaylistOptions struct {
+	Audio     []AudioRendition    // Alternative audio renditions, e.g. audio descriptions or commentary tracks.
+	Subtitles []SubtitleRendition // WebVTT subtitle tracks, e.g. recognized from bitmap subtitles.
+	First     string              // Profile listed first, most players start playback with it.
+	Order     []string            // Profiles listed in this order before remaining profiles, some players start with the first one blindly.
+	Steering  *ContentSteering    // If not nil, renditions are listed for every pathway of content steering.
+}
+
+// returns names of video profiles in order of master playlist, sorted by
+// bitrate, lowest first, unless they are ordered by options
+func profileOrder(profiles map[string]VideoProfile, opts MasterPlaylistOptions) []string {
+	names := []string{}
+	for name := range profiles {
+		names = append(names, name)
+	}
+
+	// position in configured order, unlisted profiles follow
+	rank := map[string]int{}
+	for i, name := range opts.Order {
+		if _, ok := rank[name]; !ok {
+			rank[name] = i
+		}
+	}
+
+	// sort by order and bitrate, preferred profile first
+	sort.SliceStable(names, func(i, j int) bool {
+		if names[i] == opts.First || names[j] == opts.First {
+			return names[i] == opts.First
+		}
+
+		ri, iok := rank[names[i]]
+		rj, jok := rank[names[j]]
+		if iok || jok {
+			return iok && (!jok || ri < rj)
+		}
+
+		if profiles[names[i]].Bitrate != profiles[names[j]].Bitrate {
+			return profiles[names[i]].Bitrate < profiles[names[j]].Bitrate
+		}
+
+		return names[i] < names[j]
 	})
 
+	return names
+}
+
+// MasterPlaylist returns master playlist with video profiles sorted by
+// bitrate, lowest first, unless they are ordered by options.
+func MasterPlaylist(profiles map[string]VideoProfile, segmentNameFmt string, opts MasterPlaylistOptions) string {
+	names := profileOrder(profiles, opts)
+
 	// playlist prefix
 	playlist := []string{"#EXTM3U"}
 
-	// playlist segments
-	for _, profile := range layers {
-		playlist = append(playlist, profile.Entries...)
+	// without content steering, there is single pathway with relative URIs
+	pathways := []SteeringPathway{{}}
+	if opts.Steering != nil && len(opts.Steering.Pathways) > 0 {
+		playlist = append(playlist, opts.Steering.tag())
+		pathways = opts.Steering.Pathways
+	}
+
+	for _, pathway := range pathways {
+		// renditions of pathway are served from its host
+		pathwayNameFmt := strings.ReplaceAll(pathway.BaseURL, "%", "%%") + segmentNameFmt
+
+		var pathwayAttr string
+		groupID, subsGroupID := audioGroupID, subtitleGroupID
+		if pathway.ID != "" {
+			pathwayAttr = fmt.Sprintf(",PATHWAY-ID=%q", pathway.ID)
+			groupID = audioGroupID + "-" + pathway.ID
+			subsGroupID = subtitleGroupID + "-" + pathway.ID
+		}
+
+		// alternative audio renditions
+		for _, rendition := range opts.Audio {
+			playlist = append(playlist, rendition.media(groupID, pathwayNameFmt))
+		}
+
+		// subtitle renditions
+		for _, rendition := range opts.Subtitles {
+			playlist = append(playlist, rendition.media(subsGroupID, pathwayNameFmt))
+		}
+
+		// video renditions reference audio and subtitle groups
+		var groups string
+		if len(opts.Audio) > 0 {
+			groups = fmt.Sprintf(",AUDIO=%q", groupID)
+		}
+		if len(opts.Subtitles) > 0 {
+			groups += fmt.Sprintf(",SUBTITLES=%q", subsGroupID)
+		}
+
+		// playlist segments
+		for _, name := range names {
+			profile := profiles[name]
+
+			var rangeAttrs string
+			if profile.VideoRange != "" {
+				rangeAttrs += ",VIDEO-RANGE=" + profile.VideoRange
+			}
+			if profile.HDCPLevel != "" {
+				rangeAttrs += ",HDCP-LEVEL=" + profile.HDCPLevel
+			}
+			if profile.Codecs != "" {
+				rangeAttrs += fmt.Sprintf(",CODECS=%q", profile.Codecs)
+			}
+
+			playlist = append(playlist,
+				fmt.Sprintf("#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d%s,NAME=%s%s%s", profile.Bitrate, profile.Width, profile.Height, rangeAttrs, name, groups, pathwayAttr),
+				fmt.Sprintf(pathwayNameFmt, name),
+			)
+		}
 	}
 
 	// join with newlines
@@ -0,0 +1,238 @@
+package hlsvod
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClipSegments(t *testing.T) {
+	type args struct {
+		breakpoints []float64
+		clipStart   float64
+		clipEnd     float64
+	}
+	tests := []struct {
+		name string
+		args args
+		want []float64
+	}{
+		{
+			name: "whole media",
+			args: args{
+				breakpoints: []float64{0, 4, 8, 12},
+				clipStart:   0,
+				clipEnd:     0,
+			},
+			want: []float64{0, 4, 8, 12},
+		},
+		{
+			name: "clip inside",
+			args: args{
+				breakpoints: []float64{0, 4, 8, 12, 16, 20},
+				clipStart:   5,
+				clipEnd:     15,
+			},
+			want: []float64{5, 8, 12, 15},
+		},
+		{
+			name: "breakpoints close to boundaries",
+			args: args{
+				breakpoints: []float64{0, 4, 8, 12, 16, 20},
+				clipStart:   3.5,
+				clipEnd:     16.5,
+			},
+			want: []float64{3.5, 8, 12, 16.5},
+		},
+		{
+			name: "clip end after media end",
+			args: args{
+				breakpoints: []float64{0, 4, 8, 12},
+				clipStart:   6,
+				clipEnd:     60,
+			},
+			want: []float64{6, 8, 12},
+		},
+		{
+			name: "clip start at media end",
+			args: args{
+				breakpoints: []float64{0, 4, 8, 12},
+				clipStart:   12,
+				clipEnd:     60,
+			},
+			want: nil,
+		},
+		{
+			name: "clip start after media end",
+			args: args{
+				breakpoints: []float64{0, 4, 8, 12},
+				clipStart:   30,
+				clipEnd:     60,
+			},
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clipSegments(tt.args.breakpoints, tt.args.clipStart, tt.args.clipEnd, 1); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("clipSegments() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAudioRenditionCommentaryDefault(t *testing.T) {
+	rendition := AudioRendition{ID: "audio1", Name: "Commentary", Default: true, Commentary: true}
+
+	want := `#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="Commentary",DEFAULT=YES,AUTOSELECT=YES,URI="audio1.m3u8"`
+	if got := rendition.media(audioGroupID, "%s.m3u8"); got != want {
+		t.Errorf("media() = %s, want %s", got, want)
+	}
+}
+
+func TestMasterPlaylist(t *testing.T) {
+	profiles := map[string]VideoProfile{
+		"720p": {Width: 1280, Height: 720, Bitrate: 3000000},
+	}
+
+	audio := []AudioRendition{
+		{Name: "Main", Language: "en", Default: true},
+		{ID: "audio1", Name: "Audio description", Language: "en", Descriptive: true},
+		{ID: "audio2", Name: "Commentary", Commentary: true},
+	}
+
+	want := `#EXTM3U
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="Main",LANGUAGE="en",DEFAULT=YES,AUTOSELECT=YES
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="Audio description",LANGUAGE="en",DEFAULT=NO,AUTOSELECT=YES,CHARACTERISTICS="public.accessibility.describes-video",URI="audio1.m3u8?token=x"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio",NAME="Commentary",DEFAULT=NO,AUTOSELECT=NO,URI="audio2.m3u8?token=x"
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,NAME=720p,AUDIO="audio"
+720p.m3u8?token=x`
+
+	if got := MasterPlaylist(profiles, "%s.m3u8?token=x", MasterPlaylistOptions{Audio: audio}); got != want {
+		t.Errorf("MasterPlaylist() = %v, want %v", got, want)
+	}
+
+	// preferred profile first
+	profiles["360p"] = VideoProfile{Width: 640, Height: 360, Bitrate: 1000000}
+	profiles["1080p"] = VideoProfile{Width: 1920, Height: 1080, Bitrate: 6000000}
+
+	want = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,NAME=720p
+720p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360,NAME=360p
+360p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=6000000,RESOLUTION=1920x1080,NAME=1080p
+1080p.m3u8`
+
+	if got := MasterPlaylist(profiles, "%s.m3u8", MasterPlaylistOptions{First: "720p"}); got != want {
+		t.Errorf("MasterPlaylist() = %v, want %v", got, want)
+	}
+
+	delete(profiles, "360p")
+	delete(profiles, "1080p")
+
+	// without audio renditions, playlist is unchanged
+	want = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,NAME=720p
+720p.m3u8`
+
+	if got := StreamsPlaylist(profiles, "%s.m3u8"); got != want {
+		t.Errorf("StreamsPlaylist() = %v, want %v", got, want)
+	}
+}
+
+func TestMasterPlaylistCodecs(t *testing.T) {
+	profiles := map[string]VideoProfile{
+		"1080p": {Width: 1920, Height: 1080, Bitrate: 3800000, Codecs: "hvc1.1.6.L120.B0,mp4a.40.2"},
+	}
+
+	want := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3800000,RESOLUTION=1920x1080,CODECS="hvc1.1.6.L120.B0,mp4a.40.2",NAME=1080p
+1080p.m3u8`
+
+	if got := MasterPlaylist(profiles, "%s.m3u8", MasterPlaylistOptions{}); got != want {
+		t.Errorf("MasterPlaylist() = %v, want %v", got, want)
+	}
+}
+
+func TestMasterPlaylistOrder(t *testing.T) {
+	profiles := map[string]VideoProfile{
+		"360p":  {Width: 640, Height: 360, Bitrate: 1000000, VideoRange: "SDR"},
+		"720p":  {Width: 1280, Height: 720, Bitrate: 3000000, VideoRange: "SDR", HDCPLevel: "NONE"},
+		"2160p": {Width: 3840, Height: 2160, Bitrate: 16000000, VideoRange: "PQ", HDCPLevel: "TYPE-1"},
+	}
+
+	// configured order first, remaining profiles by bitrate
+	want := `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,VIDEO-RANGE=SDR,HDCP-LEVEL=NONE,NAME=720p
+720p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360,VIDEO-RANGE=SDR,NAME=360p
+360p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=16000000,RESOLUTION=3840x2160,VIDEO-RANGE=PQ,HDCP-LEVEL=TYPE-1,NAME=2160p
+2160p.m3u8`
+
+	if got := MasterPlaylist(profiles, "%s.m3u8", MasterPlaylistOptions{Order: []string{"720p", "unknown"}}); got != want {
+		t.Errorf("MasterPlaylist() = %v, want %v", got, want)
+	}
+
+	// preferred profile is listed before configured order
+	want = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=1000000,RESOLUTION=640x360,VIDEO-RANGE=SDR,NAME=360p
+360p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=16000000,RESOLUTION=3840x2160,VIDEO-RANGE=PQ,HDCP-LEVEL=TYPE-1,NAME=2160p
+2160p.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,VIDEO-RANGE=SDR,HDCP-LEVEL=NONE,NAME=720p
+720p.m3u8`
+
+	if got := MasterPlaylist(profiles, "%s.m3u8", MasterPlaylistOptions{First: "360p", Order: []string{"2160p", "720p"}}); got != want {
+		t.Errorf("MasterPlaylist() = %v, want %v", got, want)
+	}
+}
+
+func TestMasterPlaylistSubtitles(t *testing.T) {
+	profiles := map[string]VideoProfile{
+		"720p": {Width: 1280, Height: 720, Bitrate: 3000000},
+	}
+
+	subtitles := []SubtitleRendition{
+		{ID: "subtitles-0", Name: "English", Language: "eng"},
+	}
+
+	want := `#EXTM3U
+#EXT-X-MEDIA:TYPE=SUBTITLES,GROUP-ID="subs",NAME="English",LANGUAGE="eng",DEFAULT=NO,AUTOSELECT=YES,URI="subtitles-0.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,NAME=720p,SUBTITLES="subs"
+720p.m3u8`
+
+	if got := MasterPlaylist(profiles, "%s.m3u8", MasterPlaylistOptions{Subtitles: subtitles}); got != want {
+		t.Errorf("MasterPlaylist() = %v, want %v", got, want)
+	}
+}
+
+func TestMasterPlaylistSteering(t *testing.T) {
+	profiles := map[string]VideoProfile{
+		"720p": {Width: 1280, Height: 720, Bitrate: 3000000},
+	}
+
+	opts := MasterPlaylistOptions{
+		Audio: []AudioRendition{{ID: "audio1", Name: "Commentary", Commentary: true}},
+		Steering: &ContentSteering{
+			ServerURI: "/steering.json",
+			Pathways: []SteeringPathway{
+				{ID: "cdn-a", BaseURL: "https://a.example.com/vod/movie.mkv/"},
+				{ID: "cdn-b", BaseURL: "https://b.example.com/vod/movie.mkv/"},
+			},
+		},
+	}
+
+	want := `#EXTM3U
+#EXT-X-CONTENT-STEERING:SERVER-URI="/steering.json",PATHWAY-ID="cdn-a"
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio-cdn-a",NAME="Commentary",DEFAULT=NO,AUTOSELECT=NO,URI="https://a.example.com/vod/movie.mkv/audio1.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,NAME=720p,AUDIO="audio-cdn-a",PATHWAY-ID="cdn-a"
+https://a.example.com/vod/movie.mkv/720p.m3u8
+#EXT-X-MEDIA:TYPE=AUDIO,GROUP-ID="audio-cdn-b",NAME="Commentary",DEFAULT=NO,AUTOSELECT=NO,URI="https://b.example.com/vod/movie.mkv/audio1.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=3000000,RESOLUTION=1280x720,NAME=720p,AUDIO="audio-cdn-b",PATHWAY-ID="cdn-b"
+https://b.example.com/vod/movie.mkv/720p.m3u8`
+
+	if got := MasterPlaylist(profiles, "%s.m3u8", opts); got != want {
+		t.Errorf("MasterPlaylist() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,131 @@
+package hlsvod
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+)
+
+// minimum supported version of ffmpeg and ffprobe
+var FFmpegMinVersion = FFmpegVersion{Major: 4, Minor: 0}
+
+var ErrUnsupportedFFmpeg = errors.New("unsupported ffmpeg version")
+
+// e.g. "ffmpeg version 6.1.1-3ubuntu5", "ffprobe version n4.4.2" or with
+// debian epoch "ffmpeg version 7:4.4.2-0ubuntu0.22.04.1"
+var ffmpegVersionRegex = regexp.MustCompile(`(?m)^\S+ version (?:[0-9]+:)?n?([0-9]+)\.([0-9]+)\S*`)
+
+// development builds, e.g. "ffmpeg version N-113000-g1234abcd"
+var ffmpegDevVersionRegex = regexp.MustCompile(`(?m)^\S+ version (N-|git-)\S*`)
+
+// any other version, e.g. "ffmpeg version 2023-03-05-git-abcdef"
+var ffmpegAnyVersionRegex = regexp.MustCompile(`(?m)^\S+ version \S+`)
+
+type FFmpegVersion struct {
+	Major int
+	Minor int
+	Dev   bool   // Development build, it is considered to be the newest.
+	Raw   string // Version as reported by binary.
+}
+
+// ParseFFmpegVersion parses output of ffmpeg -version or ffprobe -version.
+func ParseFFmpegVersion(output string) (FFmpegVersion, error) {
+	if match := ffmpegDevVersionRegex.FindStringSubmatch(output); match != nil {
+		return FFmpegVersion{Dev: true, Raw: match[0]}, nil
+	}
+
+	match := ffmpegVersionRegex.FindStringSubmatch(output)
+	if match == nil {
+		// version of custom builds is not recognized, it is unknown
+		if raw := ffmpegAnyVersionRegex.FindString(output); raw != "" {
+			return FFmpegVersion{Raw: raw}, nil
+		}
+
+		return FFmpegVersion{}, errors.New("version not found in output")
+	}
+
+	major, _ := strconv.Atoi(match[1])
+	minor, _ := strconv.Atoi(match[2])
+
+	return FFmpegVersion{
+		Major: major,
+		Minor: minor,
+		Raw:   match[0],
+	}, nil
+}
+
+// ProbeFFmpegVersion returns version of ffmpeg or ffprobe binary.
+func ProbeFFmpegVersion(ctx context.Context, binary string) (FFmpegVersion, error) {
+	out, err := exec.CommandContext(ctx, binary, "-version").Output()
+	if err != nil {
+		return FFmpegVersion{}, err
+	}
+
+	return ParseFFmpegVersion(string(out))
+}
+
+// Known returns true, if version was detected.
+func (v FFmpegVersion) Known() bool {
+	return v.Dev || v.Major > 0
+}
+
+// AtLeast returns true, if version is newer or equal, unknown version is never.
+func (v FFmpegVersion) AtLeast(major, minor int) bool {
+	if v.Dev {
+		return true
+	}
+
+	return v.Major > major || v.Major == major && v.Minor >= minor
+}
+
+// Check returns error, if version is not supported, unknown version is
+// assumed to be current.
+func (v FFmpegVersion) Check() error {
+	if v.Known() && !v.AtLeast(FFmpegMinVersion.Major, FFmpegMinVersion.Minor) {
+		return fmt.Errorf("%w %q, minimum is %s", ErrUnsupportedFFmpeg, v.Raw, FFmpegMinVersion)
+	}
+
+	return nil
+}
+
+func (v FFmpegVersion) String() string {
+	if v.Dev {
+		return "dev"
+	}
+
+	if !v.Known() {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("%d.%d", v.Major, v.Minor)
+}
+
+//
+// flags that changed across versions, unknown version keeps previous behavior
+//
+
+// returns log level, level prefix of log lines is supported since 4.4
+func (v FFmpegVersion) logLevel(level string) string {
+	if v.Known() && !v.AtLeast(4, 4) {
+		return level
+	}
+
+	return "level+" + level
+}
+
+// returns ffprobe frame timestamp entries, pkt_pts_time was removed in 5.0
+// and replaced by pts_time, if version is unknown, both are requested
+func (v FFmpegVersion) frameTimeEntries() string {
+	if !v.Known() {
+		return "frame=pkt_pts_time,pts_time"
+	}
+
+	if v.AtLeast(5, 0) {
+		return "frame=pts_time"
+	}
+
+	return "frame=pkt_pts_time"
+}
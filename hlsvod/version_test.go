@@ -0,0 +1,88 @@
+package hlsvod
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseFFmpegVersion(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   FFmpegVersion
+	}{
+		{
+			name:   "distribution build",
+			output: "ffmpeg version 6.1.1-3ubuntu5 Copyright (c) 2000-2023 the FFmpeg developers\nbuilt with gcc 13",
+			want:   FFmpegVersion{Major: 6, Minor: 1, Raw: "ffmpeg version 6.1.1-3ubuntu5"},
+		},
+		{
+			name:   "release tag",
+			output: "ffprobe version n4.4.2 Copyright (c) 2007-2021 the FFmpeg developers",
+			want:   FFmpegVersion{Major: 4, Minor: 4, Raw: "ffprobe version n4.4.2"},
+		},
+		{
+			name:   "development build",
+			output: "ffmpeg version N-113000-g1234abcd Copyright (c) 2000-2024 the FFmpeg developers",
+			want:   FFmpegVersion{Dev: true, Raw: "ffmpeg version N-113000-g1234abcd"},
+		},
+		{
+			name:   "debian epoch",
+			output: "ffmpeg version 7:4.4.2-0ubuntu0.22.04.1 Copyright (c) 2000-2021 the FFmpeg developers",
+			want:   FFmpegVersion{Major: 4, Minor: 4, Raw: "ffmpeg version 7:4.4.2-0ubuntu0.22.04.1"},
+		},
+		{
+			name:   "custom build",
+			output: "ffmpeg version 2023-03-05-git-912ac82a3c-full_build-www.gyan.dev Copyright (c) 2000-2023 the FFmpeg developers",
+			want:   FFmpegVersion{Raw: "ffmpeg version 2023-03-05-git-912ac82a3c-full_build-www.gyan.dev"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFFmpegVersion(tt.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got != tt.want {
+				t.Errorf("ParseFFmpegVersion() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseFFmpegVersion("command not found"); err == nil {
+		t.Error("ParseFFmpegVersion() expected error")
+	}
+}
+
+func TestFFmpegVersionFlags(t *testing.T) {
+	old := FFmpegVersion{Major: 3, Minor: 4}
+	if err := old.Check(); !errors.Is(err, ErrUnsupportedFFmpeg) {
+		t.Errorf("Check() = %v, want %v", err, ErrUnsupportedFFmpeg)
+	}
+
+	if err := (FFmpegVersion{Raw: "ffmpeg version custom"}).Check(); err != nil {
+		t.Errorf("Check() of unknown version = %v", err)
+	}
+
+	tests := []struct {
+		version  FFmpegVersion
+		logLevel string
+		entries  string
+	}{
+		{FFmpegVersion{}, "level+warning", "frame=pkt_pts_time,pts_time"},
+		{FFmpegVersion{Major: 4, Minor: 2}, "warning", "frame=pkt_pts_time"},
+		{FFmpegVersion{Major: 4, Minor: 4}, "level+warning", "frame=pkt_pts_time"},
+		{FFmpegVersion{Major: 7, Minor: 0}, "level+warning", "frame=pts_time"},
+		{FFmpegVersion{Dev: true}, "level+warning", "frame=pts_time"},
+	}
+	for _, tt := range tests {
+		if got := tt.version.logLevel("warning"); got != tt.logLevel {
+			t.Errorf("%s: logLevel() = %v, want %v", tt.version, got, tt.logLevel)
+		}
+
+		if got := tt.version.frameTimeEntries(); got != tt.entries {
+			t.Errorf("%s: frameTimeEntries() = %v, want %v", tt.version, got, tt.entries)
+		}
+	}
+}
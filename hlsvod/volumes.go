@@ -0,0 +1,48 @@
+package hlsvod
+
+// placement of transcoded segments, when there are more transcode dirs
+const (
+	PlacementFreeSpace  = "free-space"
+	PlacementRoundRobin = "round-robin"
+)
+
+// returns all directories, where transcoded segments can be stored
+func (m *ManagerCtx) volumes() []string {
+	return append([]string{m.config.TranscodeDir}, m.config.TranscodeDirs...)
+}
+
+// returns transcode dir for new segments, free space of volumes is compared,
+// unless round-robin is requested or free space cannot be measured
+func (m *ManagerCtx) placeVolume() string {
+	volumes := m.volumes()
+	if len(volumes) == 1 {
+		return volumes[0]
+	}
+
+	if m.config.Placement != PlacementRoundRobin {
+		var best string
+		var bestFree uint64
+		for _, dir := range volumes {
+			free, err := m.fs.Free(dir)
+			if err != nil {
+				m.logger.Debug().Err(err).Str("dir", dir).Msg("unable to get free space of volume")
+				continue
+			}
+
+			if best == "" || free > bestFree {
+				best, bestFree = dir, free
+			}
+		}
+
+		if best != "" {
+			return best
+		}
+	}
+
+	m.volumeMu.Lock()
+	defer m.volumeMu.Unlock()
+
+	dir := volumes[m.volumeNext%len(volumes)]
+	m.volumeNext++
+	return dir
+}
@@ -0,0 +1,88 @@
+package hlsvod
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestPlaceVolume(t *testing.T) {
+	fs := newMemFS()
+	fs.free = map[string]uint64{"/disk1": 100, "/disk2": 300, "/disk3": 200}
+
+	m := &ManagerCtx{
+		logger: zerolog.Nop(),
+		fs:     fs,
+		config: Config{
+			TranscodeDir:  "/disk1",
+			TranscodeDirs: []string{"/disk2", "/disk3"},
+		},
+	}
+
+	if dir := m.placeVolume(); dir != "/disk2" {
+		t.Errorf("placeVolume() = %q, want volume with the most free space", dir)
+	}
+
+	// free space cannot be measured, round-robin is used
+	fs.free = nil
+	for _, want := range []string{"/disk1", "/disk2", "/disk3", "/disk1"} {
+		if dir := m.placeVolume(); dir != want {
+			t.Errorf("placeVolume() = %q, want %q", dir, want)
+		}
+	}
+}
+
+func TestSegmentVolumes(t *testing.T) {
+	fs := newMemFS()
+	m := &ManagerCtx{
+		logger: zerolog.Nop(),
+		fs:     fs,
+		clock:  SystemClock{},
+		config: Config{
+			TranscodeDir:  "/disk1",
+			TranscodeDirs: []string{"/disk2"},
+			Placement:     PlacementRoundRobin,
+			SegmentPrefix: "test",
+		},
+		segments:       map[int]string{},
+		segmentSizes:   map[int]int64{},
+		segmentsMemory: []int{},
+		segmentVolumes: map[int]string{},
+	}
+
+	// segments of transcode processes land on different volumes
+	for i := 0; i < 2; i++ {
+		dir, name := m.outputDir(), m.getSegmentName(i)
+		if err := fs.WriteFile(filepath.Join(dir, name), []byte(dir), 0644); err != nil {
+			t.Fatal(err)
+		}
+		m.addSegment(i, dir, name)
+	}
+
+	for i, want := range []string{"/disk1", "/disk2"} {
+		w := httptest.NewRecorder()
+		m.serveFile(w, httptest.NewRequest(http.MethodGet, "/"+m.getSegmentName(i), nil), mustSegment(t, m, i))
+
+		if w.Body.String() != want {
+			t.Errorf("segment %d served from %q, want %q", i, w.Body.String(), want)
+		}
+	}
+
+	// removed segment is removed from its volume
+	m.removeSegment(1)
+	if _, ok := fs.files[filepath.Join("/disk2", m.getSegmentName(1))]; ok {
+		t.Error("removed segment is kept on its volume")
+	}
+}
+
+func mustSegment(t *testing.T, m *ManagerCtx, index int) string {
+	segmentPath, ok := m.getSegment(index)
+	if !ok || segmentPath == "" {
+		t.Fatalf("segment %d not found", index)
+	}
+
+	return segmentPath
+}
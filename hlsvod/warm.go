@@ -0,0 +1,125 @@
+package hlsvod
+
+import (
+	"context"
+	"errors"
+)
+
+// WarmRange is a time range of media to be transcoded ahead of playback.
+type WarmRange struct {
+	Start float64 `json:"start"` // in seconds
+	End   float64 `json:"end"`   // in seconds, 0 means until the end of media
+}
+
+// returns indexes of segments overlapping with time range
+func (m *ManagerCtx) warmSegments(r WarmRange) (first, last int) {
+	segmentsTotal := len(m.breakpoints) - 1
+
+	first, last = -1, -1
+	for i := 0; i < segmentsTotal; i++ {
+		start, end := m.breakpoints[i], m.breakpoints[i+1]
+		if end <= r.Start || (r.End > 0 && start >= r.End) {
+			continue
+		}
+
+		if first == -1 {
+			first = i
+		}
+		last = i
+	}
+
+	return
+}
+
+// transcodes segments of given ranges with low priority, blocks until they
+// are transcoded, session is kept alive meanwhile
+func (m *ManagerCtx) Warm(ctx context.Context, ranges []WarmRange) error {
+	// wait for transcode to be ready
+	if !m.isReady() {
+		select {
+		case <-m.waitForReady():
+			if !m.isReady() {
+				return errors.New("manager is not ready")
+			}
+		case <-m.ctx.Done():
+			return m.ctx.Err()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	// whole media by default
+	if len(ranges) == 0 {
+		ranges = []WarmRange{{}}
+	}
+
+	for _, r := range ranges {
+		first, last := m.warmSegments(r)
+		if first == -1 {
+			continue
+		}
+
+		m.logger.Info().Int("first", first).Int("last", last).Msg("warming segments")
+
+		for index := first; index <= last; {
+			m.Heartbeat()
+
+			next, err := m.warmFromSegment(index, last)
+			if err != nil {
+				return err
+			}
+
+			// wait for last segment of the batch
+			if segChan, ok := m.waitForSegment(next - 1); ok {
+				select {
+				case <-segChan:
+				case <-m.ctx.Done():
+					return m.ctx.Err()
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+
+			index = next
+		}
+	}
+
+	return nil
+}
+
+// starts background transcode of segments that are neither transcoded
+// nor enqueued, returns index after last segment of the batch
+func (m *ManagerCtx) warmFromSegment(index, last int) (int, error) {
+	m.transcodeMu.Lock()
+	defer m.transcodeMu.Unlock()
+
+	// skip already transcoded or enqueued segments
+	for ; index <= last; index++ {
+		_, isEnqueued := m.waitForSegment(index)
+		if !isEnqueued && !m.isSegmentTranscoded(index) && !m.isSegmentGap(index) {
+			break
+		}
+	}
+
+	if index > last {
+		return index, nil
+	}
+
+	limit := 0
+	for i := index; i <= last && limit < m.segmentBufferMax; i++ {
+		_, isEnqueued := m.waitForSegment(i)
+		if isEnqueued || m.isSegmentTranscoded(i) || m.isSegmentGap(i) {
+			break
+		}
+		limit++
+	}
+
+	// batch does not mix profiles, the rest is warmed by the next one
+	limit = m.profileLimit(index, limit)
+
+	if err := m.transcodeSegments(index, limit, transcodeOptions{background: true}); err != nil {
+		return index, err
+	}
+
+	return index + limit, nil
+}
@@ -0,0 +1,202 @@
+package hlsvod
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+const waveformFileSuffix = ".go-transcode-waveform"
+
+// sample rate used for waveform generation
+const WaveformSampleRate = 8000
+
+// resolutions of waveform, every one of them is generated and cached
+// separately, so only powers of two between them are allowed
+const (
+	WaveformMinSamplesPerPixel = 32
+	WaveformMaxSamplesPerPixel = 8192
+)
+
+// ValidSamplesPerPixel returns true, if waveform of this resolution can be
+// generated.
+func ValidSamplesPerPixel(samplesPerPixel int) bool {
+	return samplesPerPixel >= WaveformMinSamplesPerPixel &&
+		samplesPerPixel <= WaveformMaxSamplesPerPixel &&
+		samplesPerPixel&(samplesPerPixel-1) == 0
+}
+
+// WaveformData are peaks in audiowaveform format, that is supported by
+// wavesurfer.js and peaks.js, data contain min and max pair for each pixel.
+type WaveformData struct {
+	Version         int     `json:"version"`
+	Channels        int     `json:"channels"`
+	SampleRate      int     `json:"sample_rate"`
+	SamplesPerPixel int     `json:"samples_per_pixel"`
+	Bits            int     `json:"bits"`
+	Length          int     `json:"length"`
+	Data            []int16 `json:"data"`
+}
+
+// returns data in binary .dat format of audiowaveform
+func (w *WaveformData) MarshalDat() []byte {
+	buf := bytes.Buffer{}
+
+	header := []int32{
+		2, // version
+		0, // flags, 16-bit resolution
+		int32(w.SampleRate),
+		int32(w.SamplesPerPixel),
+		int32(w.Length),
+		int32(w.Channels),
+	}
+
+	_ = binary.Write(&buf, binary.LittleEndian, header)
+	_ = binary.Write(&buf, binary.LittleEndian, w.Data)
+	return buf.Bytes()
+}
+
+// returns min and max pairs for each samples per pixel from 16-bit mono samples
+func waveformPeaks(r io.Reader, samplesPerPixel int) ([]int16, error) {
+	data := []int16{}
+	reader := bufio.NewReader(r)
+
+	var min, max int16
+	var count int
+	for {
+		var sample int16
+		err := binary.Read(reader, binary.LittleEndian, &sample)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if count == 0 || sample < min {
+			min = sample
+		}
+		if count == 0 || sample > max {
+			max = sample
+		}
+
+		count++
+		if count == samplesPerPixel {
+			data = append(data, min, max)
+			count = 0
+		}
+	}
+
+	// last incomplete pixel
+	if count > 0 {
+		data = append(data, min, max)
+	}
+
+	return data, nil
+}
+
+// generates waveform of the first audio stream using ffmpeg
+func Waveform(ctx context.Context, ffmpegBinary string, inputFilePath string, samplesPerPixel int) (*WaveformData, error) {
+	if !ValidSamplesPerPixel(samplesPerPixel) {
+		return nil, fmt.Errorf("samples per pixel must be power of two between %d and %d", WaveformMinSamplesPerPixel, WaveformMaxSamplesPerPixel)
+	}
+
+	args := []string{
+		"-v", "error", // Hide debug information
+		"-i", inputFilePath,
+		"-map", "0:a:0",
+		"-ac", "1", // Mono
+		"-ar", fmt.Sprintf("%d", WaveformSampleRate),
+		"-f", "s16le",
+		"pipe:1",
+	}
+
+	cmd := exec.Command(ffmpegBinary, args...)
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := utils.ProcessGroupStart(ctx, cmd); err != nil {
+		return nil, err
+	}
+
+	data, err := waveformPeaks(stdout, samplesPerPixel)
+	if err != nil {
+		_ = utils.ProcessGroupKill(cmd)
+		_ = utils.ProcessGroupWait(cmd)
+		return nil, err
+	}
+
+	if err := utils.ProcessGroupWait(cmd); err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return &WaveformData{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      WaveformSampleRate,
+		SamplesPerPixel: samplesPerPixel,
+		Bits:            16,
+		Length:          len(data) / 2,
+		Data:            data,
+	}, nil
+}
+
+// load waveform from cache or generate it and cache
+func (m *ManagerCtx) Waveform(ctx context.Context, samplesPerPixel int) (*WaveformData, error) {
+	ffmpegBinary := m.config.FFmpegBinary
+	if ffmpegBinary == "" {
+		ffmpegBinary = utils.BinaryName("ffmpeg")
+	}
+
+	// bypass cache if not enabled
+	if !m.config.Cache {
+		return Waveform(ctx, ffmpegBinary, m.config.MediaPath, samplesPerPixel)
+	}
+
+	suffix := fmt.Sprintf("%s-%d", waveformFileSuffix, samplesPerPixel)
+
+	// try to get cached data
+	data, err := m.getCacheFile(suffix)
+	if err == nil {
+		var waveform WaveformData
+		err := json.Unmarshal(data, &waveform)
+		if err == nil {
+			return &waveform, nil
+		}
+
+		m.logger.Err(err).Msg("waveform cache unmarhalling returned error, replacing")
+	} else if !errors.Is(err, os.ErrNotExist) {
+		m.logger.Err(err).Msg("waveform cache hit returned error, replacing")
+	}
+
+	waveform, err := Waveform(ctx, ffmpegBinary, m.config.MediaPath, samplesPerPixel)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err = json.Marshal(waveform)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.saveCacheFile(suffix, data); err != nil {
+		m.logger.Err(err).Msg("unable to save waveform cache")
+	}
+
+	return waveform, nil
+}
@@ -0,0 +1,60 @@
+package hlsvod
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func TestWaveformPeaks(t *testing.T) {
+	samples := []int16{1, -5, 3, 7, -2, 0, 10}
+
+	buf := bytes.Buffer{}
+	if err := binary.Write(&buf, binary.LittleEndian, samples); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := waveformPeaks(&buf, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []int16{-5, 3, -2, 7, 10, 10}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("waveformPeaks() = %v, want %v", got, want)
+	}
+}
+
+func TestWaveformMarshalDat(t *testing.T) {
+	waveform := WaveformData{
+		Version:         2,
+		Channels:        1,
+		SampleRate:      WaveformSampleRate,
+		SamplesPerPixel: 256,
+		Bits:            16,
+		Length:          1,
+		Data:            []int16{-1, 1},
+	}
+
+	dat := waveform.MarshalDat()
+	if len(dat) != 6*4+2*2 {
+		t.Fatalf("unexpected length %d", len(dat))
+	}
+
+	if version := binary.LittleEndian.Uint32(dat[0:4]); version != 2 {
+		t.Errorf("version = %d, want 2", version)
+	}
+
+	if length := binary.LittleEndian.Uint32(dat[16:20]); length != 1 {
+		t.Errorf("length = %d, want 1", length)
+	}
+}
+
+func TestValidSamplesPerPixel(t *testing.T) {
+	for spp, want := range map[int]bool{0: false, -256: false, 16: false, 32: true, 256: true, 300: false, 8192: true, 16384: false, 1 << 30: false} {
+		if got := ValidSamplesPerPixel(spp); got != want {
+			t.Errorf("ValidSamplesPerPixel(%d) = %v, want %v", spp, got, want)
+		}
+	}
+}
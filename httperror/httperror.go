@@ -0,0 +1,83 @@
+package httperror
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// error codes shared by handlers, handlers can use their own more specific codes
+const (
+	CodeBadRequest  = "bad-request"
+	CodeNotFound    = "not-found"
+	CodeInternal    = "internal-error"
+	CodeTimeout     = "timeout"
+	CodeUnavailable = "unavailable"
+	CodeBadGateway  = "bad-gateway"
+	CodeRateLimited = "rate-limited"
+)
+
+// Error is an error response of HTTP handler.
+type Error struct {
+	Status     int     `json:"-"`
+	Code       string  `json:"code"`
+	Message    string  `json:"message"`
+	RequestID  string  `json:"request_id,omitempty"`
+	State      string  `json:"state,omitempty"`       // state of session, if error belongs to one
+	RetryAfter float64 `json:"retry_after,omitempty"` // in seconds, 0 means request should not be retried
+}
+
+// Responder writes error response, embedding application can provide its own,
+// e.g. to render custom error pages.
+type Responder func(w http.ResponseWriter, r *http.Request, e Error)
+
+// New returns error of request with its request ID, if it has one.
+func New(r *http.Request, status int, code, message string) Error {
+	return Error{
+		Status:    status,
+		Code:      code,
+		Message:   message,
+		RequestID: middleware.GetReqID(r.Context()),
+	}
+}
+
+// WithRetry returns error hinting client when to retry the request.
+func (e Error) WithRetry(retry time.Duration) Error {
+	e.RetryAfter = retry.Seconds()
+	return e
+}
+
+// Write writes error using responder, if nil, text is used.
+func (e Error) Write(w http.ResponseWriter, r *http.Request, responder Responder) {
+	if responder == nil {
+		responder = Text
+	}
+
+	responder(w, r, e)
+}
+
+func retryHeader(w http.ResponseWriter, e Error) {
+	if e.RetryAfter > 0 {
+		retry := time.Duration(e.RetryAfter * float64(time.Second))
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", retry.Round(time.Second).Seconds()))
+	}
+}
+
+// Text writes plain text body with status and message, e.g. "404 media not found".
+func Text(w http.ResponseWriter, r *http.Request, e Error) {
+	retryHeader(w, e)
+	http.Error(w, fmt.Sprintf("%d %s", e.Status, e.Message), e.Status)
+}
+
+// JSON writes error as JSON envelope.
+func JSON(w http.ResponseWriter, r *http.Request, e Error) {
+	retryHeader(w, e)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(e.Status)
+	_ = json.NewEncoder(w).Encode(e)
+}
@@ -0,0 +1,49 @@
+package httperror
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+func TestText(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	w := httptest.NewRecorder()
+
+	New(r, http.StatusNotFound, CodeNotFound, "media not found").Write(w, r, nil)
+
+	if w.Code != http.StatusNotFound || w.Body.String() != "404 media not found\n" {
+		t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), http.StatusNotFound, "404 media not found\n")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	var r *http.Request
+	middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r = req
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+
+	w := httptest.NewRecorder()
+	New(r, http.StatusServiceUnavailable, CodeUnavailable, "not available").WithRetry(2*time.Second).Write(w, r, JSON)
+
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "2" {
+		t.Errorf("got %d with Retry-After %q, want %d with 2", w.Code, w.Header().Get("Retry-After"), http.StatusServiceUnavailable)
+	}
+
+	var body Error
+	if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+
+	if body.Code != CodeUnavailable || body.Message != "not available" || body.RetryAfter != 2 {
+		t.Errorf("unexpected body %+v", body)
+	}
+
+	if body.RequestID == "" || body.RequestID != middleware.GetReqID(r.Context()) {
+		t.Errorf("request id = %q, want %q", body.RequestID, middleware.GetReqID(r.Context()))
+	}
+}
@@ -0,0 +1,127 @@
+// Package icy interleaves SHOUTcast/Icecast (ICY) metadata into audio
+// streams, so that internet radio players show what is playing now.
+package icy
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// DefaultMetaInt is number of audio bytes between metadata blocks, that is
+// used by most Icecast servers.
+const DefaultMetaInt = 16000
+
+// metadata block length is encoded in single byte as multiple of 16
+const maxMetadataLength = 255 * 16
+
+// Requested returns true, if client asked for interleaved metadata by
+// Icy-MetaData header.
+func Requested(r *http.Request) bool {
+	return r.Header.Get("Icy-MetaData") == "1"
+}
+
+// Metadata returns metadata block with stream title, it is prefixed by its
+// length in 16 bytes and padded by zeros. Quotes are removed from title,
+// because players do not unescape them, and too long title is truncated.
+func Metadata(title string) []byte {
+	title = strings.NewReplacer("'", "", "\x00", "").Replace(title)
+
+	text := "StreamTitle='" + title + "';"
+	if len(text) > maxMetadataLength {
+		text = text[:maxMetadataLength-2] + "';"
+	}
+
+	blocks := (len(text) + 15) / 16
+	data := make([]byte, 1+blocks*16)
+	data[0] = byte(blocks)
+	copy(data[1:], text)
+	return data
+}
+
+// Writer writes metadata block after every metaint bytes of audio, title
+// is read for every block, so that it can change while streaming. Blocks
+// with unchanged title are written empty, as players keep the last title.
+type Writer struct {
+	w       io.Writer
+	metaInt int
+	title   func() string
+
+	written int    // audio bytes since last metadata block
+	last    string // title in last metadata block
+	sent    bool   // at least one title was sent
+}
+
+func NewWriter(w io.Writer, metaInt int, title func() string) *Writer {
+	if metaInt <= 0 {
+		metaInt = DefaultMetaInt
+	}
+
+	return &Writer{
+		w:       w,
+		metaInt: metaInt,
+		title:   title,
+	}
+}
+
+// Write writes audio interleaved with metadata, returned count does not
+// include metadata.
+func (w *Writer) Write(p []byte) (int, error) {
+	n := 0
+	for len(p) > 0 {
+		chunk := w.metaInt - w.written
+		if chunk > len(p) {
+			chunk = len(p)
+		}
+
+		written, err := w.w.Write(p[:chunk])
+		n += written
+		w.written += written
+		if err != nil {
+			return n, err
+		}
+
+		p = p[chunk:]
+
+		if w.written == w.metaInt {
+			if _, err := w.w.Write(w.metadata()); err != nil {
+				return n, err
+			}
+			w.written = 0
+		}
+	}
+
+	return n, nil
+}
+
+// returns next metadata block, empty if title did not change
+func (w *Writer) metadata() []byte {
+	title := w.title()
+	if w.sent && title == w.last {
+		return []byte{0}
+	}
+
+	w.last, w.sent = title, true
+	return Metadata(title)
+}
+
+// SetHeaders sets ICY response headers of stream, metaint is set only, if
+// metadata are interleaved.
+func SetHeaders(h http.Header, name, genre, url string, metaInt int) {
+	if name != "" {
+		h.Set("icy-name", name)
+	}
+
+	if genre != "" {
+		h.Set("icy-genre", genre)
+	}
+
+	if url != "" {
+		h.Set("icy-url", url)
+	}
+
+	if metaInt > 0 {
+		h.Set("icy-metaint", strconv.Itoa(metaInt))
+	}
+}
@@ -0,0 +1,93 @@
+package icy
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	data := Metadata("Artist - Song")
+
+	text := "StreamTitle='Artist - Song';"
+	if data[0] != 2 || len(data) != 33 {
+		t.Fatalf("metadata length = %d blocks, %d bytes, want 2 blocks, 33 bytes", data[0], len(data))
+	}
+
+	if got := string(bytes.TrimRight(data[1:], "\x00")); got != text {
+		t.Errorf("metadata = %q, want %q", got, text)
+	}
+
+	// quotes would end title early
+	if got := string(bytes.TrimRight(Metadata("Rock 'n' Roll")[1:], "\x00")); got != "StreamTitle='Rock n Roll';" {
+		t.Errorf("metadata = %q", got)
+	}
+
+	long := Metadata(strings.Repeat("a", 5000))
+	if long[0] != 255 || !bytes.HasSuffix(long, []byte("';")) {
+		t.Errorf("long title should be truncated to 255 blocks, got %d", long[0])
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	title := "first"
+	w := NewWriter(&buf, 4, func() string { return title })
+
+	// audio split across writes
+	if n, err := w.Write([]byte("abcdef")); err != nil || n != 6 {
+		t.Fatalf("write = %d, %v", n, err)
+	}
+	if _, err := w.Write([]byte("gh")); err != nil {
+		t.Fatal(err)
+	}
+
+	// unchanged title is sent as empty block
+	title = "first"
+	if _, err := w.Write([]byte("ijkl")); err != nil {
+		t.Fatal(err)
+	}
+
+	title = "second"
+	if _, err := w.Write([]byte("mnop")); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte("abcd")
+	want = append(want, Metadata("first")...)
+	want = append(want, "efgh"...)
+	want = append(want, 0)
+	want = append(want, "ijkl"...)
+	want = append(want, 0)
+	want = append(want, "mnop"...)
+	want = append(want, Metadata("second")...)
+
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("stream = %q, want %q", buf.Bytes(), want)
+	}
+}
+
+func TestHeaders(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/radio/jazz.mp3", nil)
+	if Requested(r) {
+		t.Error("metadata were not requested")
+	}
+
+	r.Header.Set("Icy-MetaData", "1")
+	if !Requested(r) {
+		t.Error("metadata were requested")
+	}
+
+	h := http.Header{}
+	SetHeaders(h, "Jazz Radio", "jazz", "", DefaultMetaInt)
+
+	if h.Get("icy-name") != "Jazz Radio" || h.Get("icy-genre") != "jazz" || h.Get("icy-metaint") != "16000" {
+		t.Errorf("unexpected headers %v", h)
+	}
+
+	if _, ok := h["Icy-Url"]; ok {
+		t.Error("empty url should not be set")
+	}
+}
@@ -0,0 +1,526 @@
+package api
+
+import (
+	"crypto/subtle"
+	"embed"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+//go:embed admin
+var adminFS embed.FS
+
+// number of log lines kept per session
+const adminLogLines = 200
+
+// Authorizer returns true, if request is allowed to access admin UI
+type Authorizer func(r *http.Request) bool
+
+// replaces admin authorizer, by default token from config is required
+func (a *ApiManagerCtx) SetAuthorizer(authorizer Authorizer) {
+	a.authorizer = authorizer
+}
+
+// returns authorizer accepting token as bearer token or basic auth
+// password, empty token denies all requests
+func adminConfigAuthorizer(token string) Authorizer {
+	return func(r *http.Request) bool {
+		if token == "" {
+			return false
+		}
+
+		provided := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if _, password, ok := r.BasicAuth(); ok {
+			provided = password
+		}
+
+		return subtle.ConstantTimeCompare([]byte(provided), []byte(token)) == 1
+	}
+}
+
+// adminLogs keeps last log lines of sessions
+type adminLogs struct {
+	mu    sync.Mutex
+	lines map[string][]string
+}
+
+func newAdminLogs() *adminLogs {
+	return &adminLogs{
+		lines: map[string][]string{},
+	}
+}
+
+func (l *adminLogs) add(session, line string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	lines := append(l.lines[session], line)
+	if len(lines) > adminLogLines {
+		lines = lines[len(lines)-adminLogLines:]
+	}
+
+	l.lines[session] = lines
+}
+
+func (l *adminLogs) get(session string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return append([]string{}, l.lines[session]...)
+}
+
+// removes logs of sessions, that no longer exist
+func (l *adminLogs) prune(sessions map[string]bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for session := range l.lines {
+		if !sessions[session] {
+			delete(l.lines, session)
+		}
+	}
+}
+
+type adminSession struct {
+	ID   string `json:"id"`
+	Kind string `json:"kind"` // live, vod or proxy
+
+	Idle       float64 `json:"idle,omitempty"` // seconds since last request
+	Segments   int     `json:"segments,omitempty"`
+	Transcoded int     `json:"transcoded,omitempty"`
+	Bytes      int64   `json:"bytes,omitempty"` // bytes served to clients
+}
+
+// returns all running sessions
+func (a *ApiManagerCtx) adminSessions() []adminSession {
+	sessions := []adminSession{}
+
+	hlsManagersMu.Lock()
+	for ID := range hlsManagers {
+		sessions = append(sessions, adminSession{ID: ID, Kind: "live"})
+	}
+	hlsManagersMu.Unlock()
+
+	hlsVodManagersMu.Lock()
+	for ID, manager := range hlsVodManagers {
+		session := adminSession{
+			ID:   ID,
+			Kind: "vod",
+			Idle: manager.Idle().Seconds(),
+		}
+
+		for _, segment := range manager.Stats() {
+			session.Segments++
+			if segment.Transcoded {
+				session.Transcoded++
+			}
+		}
+
+		sessions = append(sessions, session)
+	}
+	hlsVodManagersMu.Unlock()
+
+	hlsProxyManagersMu.Lock()
+	for ID := range hlsProxyManagers {
+		sessions = append(sessions, adminSession{ID: ID, Kind: "proxy"})
+	}
+	hlsProxyManagersMu.Unlock()
+
+	for i := range sessions {
+		sessions[i].Bytes = a.quotas.session(sessions[i].ID)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		if sessions[i].Kind != sessions[j].Kind {
+			return sessions[i].Kind < sessions[j].Kind
+		}
+		return sessions[i].ID < sessions[j].ID
+	})
+
+	return sessions
+}
+
+// collects logs of sessions until shutdown
+func (a *ApiManagerCtx) adminCollectLogs() {
+	logs, unsubscribe := a.events.Subscribe(256, events.CmdLogType)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-a.shutdown:
+			return
+		case event := <-logs:
+			if cmdLog, ok := event.(events.CmdLog); ok {
+				a.adminLogs.add(cmdLog.Session, cmdLog.Message)
+			}
+		}
+	}
+}
+
+// removes logs of sessions, that were evicted
+func (a *ApiManagerCtx) adminCleanup() {
+	sessions := map[string]bool{}
+	for _, session := range a.adminSessions() {
+		sessions[session.ID] = true
+	}
+
+	a.adminLogs.prune(sessions)
+}
+
+func (a *ApiManagerCtx) Admin(r chi.Router) {
+	logger := log.With().Str("module", "api").Str("submodule", "admin").Logger()
+	route := a.config.Admin.Route
+
+	r.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !a.authorizer(r) {
+				w.Header().Set("WWW-Authenticate", `Basic realm="go-transcode admin"`)
+				http.Error(w, "401 unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	r.Get("/api/sessions", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(a.adminSessions())
+	})
+
+	r.Get("/api/stats", func(w http.ResponseWriter, r *http.Request) {
+		ID := r.URL.Query().Get("id")
+
+		hlsVodManagersMu.Lock()
+		manager, ok := hlsVodManagers[ID]
+		hlsVodManagersMu.Unlock()
+
+		if !ok {
+			http.Error(w, "404 vod session not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(manager.Stats())
+	})
+
+	r.Get("/api/logs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(a.adminLogs.get(r.URL.Query().Get("id")))
+	})
+
+	// persisted log files of session, session does not need to be running
+	r.Get("/api/logfiles", func(w http.ResponseWriter, r *http.Request) {
+		if a.config.SessionLogs.Dir == "" {
+			http.Error(w, "404 session logs are disabled", http.StatusNotFound)
+			return
+		}
+
+		files, err := a.logFiles.find(r.URL.Query().Get("id")).Files()
+		if err != nil {
+			logger.Warn().Err(err).Msg("unable to list session log files")
+			http.Error(w, "500 unable to list log files", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(files)
+	})
+
+	r.Get("/api/logfile", func(w http.ResponseWriter, r *http.Request) {
+		if a.config.SessionLogs.Dir == "" {
+			http.Error(w, "404 session logs are disabled", http.StatusNotFound)
+			return
+		}
+
+		name := r.URL.Query().Get("name")
+		file, err := a.logFiles.find(r.URL.Query().Get("id")).Open(name)
+		if err != nil {
+			http.Error(w, "404 log file not found", http.StatusNotFound)
+			return
+		}
+		defer file.Close()
+
+		fi, err := file.Stat()
+		if err != nil {
+			http.Error(w, "500 unable to read log file", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		http.ServeContent(w, r, name, fi.ModTime(), file)
+	})
+
+	r.Post("/api/stop", func(w http.ResponseWriter, r *http.Request) {
+		ID := r.URL.Query().Get("id")
+
+		hlsManagersMu.Lock()
+		live, ok := hlsManagers[ID]
+		hlsManagersMu.Unlock()
+
+		if ok {
+			// graceful stop ends playlist, so that players end cleanly
+			if r.URL.Query().Get("graceful") == "1" {
+				logger.Info().Str("id", ID).Msg("gracefully stopping live session")
+				live.StopGraceful()
+			} else {
+				logger.Info().Str("id", ID).Msg("stopping live session")
+				live.Stop()
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		hlsVodManagersMu.Lock()
+		manager, ok := hlsVodManagers[ID]
+		delete(hlsVodManagers, ID)
+		hlsVodManagersMu.Unlock()
+
+		if !ok {
+			http.Error(w, "404 session not found", http.StatusNotFound)
+			return
+		}
+
+		logger.Info().Str("id", ID).Msg("stopping vod session")
+		manager.Stop()
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// stops vod session and removes its cache, so that media is probed again
+	r.Post("/api/purge", func(w http.ResponseWriter, r *http.Request) {
+		ID := r.URL.Query().Get("id")
+
+		hlsVodManagersMu.Lock()
+		manager, ok := hlsVodManagers[ID]
+		delete(hlsVodManagers, ID)
+		hlsVodManagersMu.Unlock()
+
+		if !ok {
+			http.Error(w, "404 vod session not found", http.StatusNotFound)
+			return
+		}
+
+		logger.Info().Str("id", ID).Msg("purging vod session")
+		manager.Stop()
+
+		if err := manager.PurgeCache(); err != nil {
+			logger.Warn().Err(err).Str("id", ID).Msg("unable to purge cache")
+			http.Error(w, "500 unable to purge cache", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// media, whose probe failed, quarantined ones are not probed again
+	r.Get("/api/quarantine", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(a.quarantine.list())
+	})
+
+	// lifts quarantine of media relative to media dir, e.g. ?path=movies/broken.mkv,
+	// all media without path
+	r.Delete("/api/quarantine", func(w http.ResponseWriter, r *http.Request) {
+		path := r.URL.Query().Get("path")
+
+		if a.quarantine.clear(path) == 0 && path != "" {
+			http.Error(w, "404 media not in quarantine", http.StatusNotFound)
+			return
+		}
+
+		logger.Info().Str("path", path).Msg("quarantine cleared")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// swaps profile of running vod session, segments after those already
+	// transcoded are transcoded with it, e.g. ?id=[session]&profile=360p&bitrate=600
+	r.Post("/api/profile", func(w http.ResponseWriter, r *http.Request) {
+		ID := r.URL.Query().Get("id")
+
+		hlsVodManagersMu.Lock()
+		manager, ok := hlsVodManagers[ID]
+		hlsVodManagersMu.Unlock()
+
+		if !ok {
+			http.Error(w, "404 vod session not found", http.StatusNotFound)
+			return
+		}
+
+		profileID := r.URL.Query().Get("profile")
+		profile, ok := a.config.Vod.VideoProfiles[profileID]
+		if !ok {
+			http.Error(w, "400 unknown profile", http.StatusBadRequest)
+			return
+		}
+
+		// bitrate can be lowered without changing resolution
+		if value := r.URL.Query().Get("bitrate"); value != "" {
+			bitrate, err := strconv.Atoi(value)
+			if err != nil || bitrate <= 0 {
+				http.Error(w, "400 invalid bitrate", http.StatusBadRequest)
+				return
+			}
+			profile.Bitrate = bitrate
+		}
+
+		index, err := manager.SwapProfile(&hlsvod.VideoProfile{
+			Width:   profile.Width,
+			Height:  profile.Height,
+			Bitrate: profile.Bitrate,
+			Preset:  profile.Preset,
+		}, nil)
+		if errors.Is(err, hlsvod.ErrProfileConstraint) {
+			http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			http.Error(w, "409 "+err.Error(), http.StatusConflict)
+			return
+		}
+
+		logger.Info().Str("id", ID).Str("profile", profileID).Int("bitrate", profile.Bitrate).Int("segment", index).Msg("vod session profile swapped")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// state of background jobs (mezzanine encoding, subtitle OCR and clip export)
+	r.Get("/api/jobs", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"paused":    a.jobs.Paused(),
+			"mezzanine": len(a.mezzanine.jobs),
+			"subtitles": len(a.subtitles.jobs),
+			"export":    len(a.exports.queue),
+		})
+	})
+
+	// running jobs are stopped and queued jobs wait, until they are resumed,
+	// so that interactive sessions get CPU
+	r.Post("/api/jobs/pause", func(w http.ResponseWriter, r *http.Request) {
+		if err := a.jobs.Pause(); err != nil {
+			logger.Warn().Err(err).Msg("unable to pause running background jobs")
+		}
+
+		logger.Info().Msg("background jobs paused")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	r.Post("/api/jobs/resume", func(w http.ResponseWriter, r *http.Request) {
+		if err := a.jobs.Resume(); err != nil {
+			logger.Warn().Err(err).Msg("unable to resume running background jobs")
+		}
+
+		logger.Info().Msg("background jobs resumed")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// pathway priority of content steering
+	r.Get("/api/steering", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(a.steering.getPriority())
+	})
+
+	// shifts traffic between hosts, e.g. ?priority=cdn-b,cdn-a
+	r.Post("/api/steering", func(w http.ResponseWriter, r *http.Request) {
+		priority := strings.Split(r.URL.Query().Get("priority"), ",")
+		if err := a.steering.setPriority(priority); err != nil {
+			http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		logger.Info().Strs("priority", priority).Msg("content steering priority changed")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// changes now playing of radio stream, JSON {"title": "Artist - Song"}
+	r.Post("/api/radio/{input}/title", func(w http.ResponseWriter, r *http.Request) {
+		input := chi.URLParam(r, "input")
+		if _, ok := a.config.Radio.Streams[input]; !ok {
+			http.Error(w, "404 radio not found", http.StatusNotFound)
+			return
+		}
+
+		var body struct {
+			Title string `json:"title"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "400 invalid body", http.StatusBadRequest)
+			return
+		}
+
+		a.radio.setTitle(input, body.Title)
+		logger.Info().Str("input", input).Str("title", body.Title).Msg("radio title changed")
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	// signed URL of VOD path, e.g. ?path=/vod/movie.mp4/index.m3u8&ttl=2h
+	r.Get("/api/sign", func(w http.ResponseWriter, r *http.Request) {
+		if a.signer == nil {
+			http.Error(w, "404 signed URLs are disabled", http.StatusNotFound)
+			return
+		}
+
+		urlPath := r.URL.Query().Get("path")
+		if !strings.HasPrefix(urlPath, "/") {
+			http.Error(w, "400 path must be absolute", http.StatusBadRequest)
+			return
+		}
+
+		var ttl time.Duration
+		if value := r.URL.Query().Get("ttl"); value != "" {
+			var err error
+			if ttl, err = time.ParseDuration(value); err != nil {
+				http.Error(w, "400 invalid ttl", http.StatusBadRequest)
+				return
+			}
+		}
+
+		signed, expires, err := a.signURL(urlPath, r.URL.Query().Get("acl"), ttl)
+		if err != nil {
+			logger.Warn().Err(err).Str("path", urlPath).Msg("unable to sign URL")
+			http.Error(w, "500 unable to sign URL", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"url":     signed,
+			"expires": expires.Unix(),
+		})
+	})
+
+	// static bundle, relative paths require trailing slash
+	static, _ := fs.Sub(adminFS, "admin")
+	fileServer := http.StripPrefix(route, http.FileServer(http.FS(static)))
+
+	r.Get("/*", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == route {
+			http.Redirect(w, r, route+"/", http.StatusMovedPermanently)
+			return
+		}
+
+		fileServer.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,149 @@
+var selected = null;
+
+function api(method, path, id) {
+    var url = "api/" + path;
+    if (id !== undefined) {
+        url += (url.indexOf("?") < 0 ? "?" : "&") + "id=" + encodeURIComponent(id);
+    }
+
+    return fetch(url, { method: method, credentials: "same-origin" }).then(function(res) {
+        if (!res.ok) {
+            throw new Error(res.status + " " + res.statusText);
+        }
+
+        return res.status === 204 ? null : res.json();
+    });
+}
+
+function action(path, session) {
+    if (!confirm(path + " " + session.id + "?")) {
+        return;
+    }
+
+    api("POST", path, session.id).then(refresh).catch(alert);
+}
+
+function button(label, onclick) {
+    var el = document.createElement("button");
+    el.textContent = label;
+    el.onclick = function(e) {
+        e.stopPropagation();
+        onclick();
+    };
+    return el;
+}
+
+function refresh() {
+    api("GET", "sessions").then(function(sessions) {
+        var tbody = document.querySelector("#sessions tbody");
+        tbody.innerHTML = "";
+
+        sessions.forEach(function(session) {
+            var tr = document.createElement("tr");
+            if (selected && selected.id === session.id) {
+                tr.className = "selected";
+            }
+
+            [
+                session.kind,
+                session.id,
+                session.idle ? Math.round(session.idle) + "s" : "",
+                session.segments ? session.transcoded + " / " + session.segments : "",
+                session.bytes ? (session.bytes / 1048576).toFixed(1) + " MB" : "",
+            ].forEach(function(value) {
+                var td = document.createElement("td");
+                td.textContent = value;
+                tr.appendChild(td);
+            });
+
+            var td = document.createElement("td");
+            if (session.kind === "live") {
+                td.appendChild(button("End", function() { action("stop?graceful=1", session); }));
+            }
+            if (session.kind !== "proxy") {
+                td.appendChild(button("Stop", function() { action("stop", session); }));
+            }
+            if (session.kind === "vod") {
+                td.appendChild(button("Purge", function() { action("purge", session); }));
+            }
+            tr.appendChild(td);
+
+            tr.onclick = function() {
+                selected = session;
+                refresh();
+            };
+
+            tbody.appendChild(tr);
+        });
+
+        details();
+    }).catch(function(err) {
+        console.error(err);
+    });
+}
+
+function details() {
+    var el = document.getElementById("details");
+    if (!selected) {
+        el.hidden = true;
+        return;
+    }
+
+    el.hidden = false;
+    document.getElementById("details-title").textContent = selected.id;
+
+    var heatmap = document.getElementById("heatmap");
+    if (selected.kind === "vod") {
+        api("GET", "stats", selected.id).then(function(stats) {
+            heatmap.innerHTML = "";
+            stats.forEach(function(segment) {
+                var span = document.createElement("span");
+                span.className = "segment";
+                if (segment.transcoded) {
+                    span.className += " transcoded";
+                }
+                if (segment.requests > 0) {
+                    span.className += " requested";
+                    span.style.opacity = Math.min(1, 0.3 + segment.requests / 10);
+                }
+                span.title = segment.name + ", " + segment.requests + " requests";
+                heatmap.appendChild(span);
+            });
+        }).catch(function() {
+            heatmap.innerHTML = "";
+        });
+    } else {
+        heatmap.innerHTML = "";
+    }
+
+    api("GET", "logs", selected.id).then(function(lines) {
+        var logs = document.getElementById("logs");
+        var bottom = logs.scrollTop + logs.clientHeight >= logs.scrollHeight - 10;
+        logs.textContent = lines.join("\n");
+        if (bottom) {
+            logs.scrollTop = logs.scrollHeight;
+        }
+    });
+
+    var section = document.getElementById("logfiles-section");
+    api("GET", "logfiles", selected.id).then(function(files) {
+        var list = document.getElementById("logfiles");
+        list.innerHTML = "";
+        files.forEach(function(file) {
+            var a = document.createElement("a");
+            a.href = "api/logfile?id=" + encodeURIComponent(selected.id) + "&name=" + encodeURIComponent(file.name);
+            a.target = "_blank";
+            a.textContent = file.name + " (" + Math.ceil(file.size / 1024) + " KiB)";
+
+            var li = document.createElement("li");
+            li.appendChild(a);
+            list.appendChild(li);
+        });
+        section.hidden = files.length === 0;
+    }).catch(function() {
+        section.hidden = true;
+    });
+}
+
+refresh();
+setInterval(refresh, 2000);
@@ -0,0 +1,173 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// smoothing factor of measured throughput, higher values prefer recent samples
+const bandwidthAlpha = 0.3
+
+// responses smaller than this are not measured, they fit into socket buffers
+const bandwidthMinBytes = 64 * 1024
+
+// how long is client throughput remembered after its last sample
+const bandwidthTimeout = time.Hour
+
+// part of throughput, that can be used by variant started first
+const bandwidthSafety = 0.8
+
+type bandwidthEstimate struct {
+	Bandwidth float64   `json:"bandwidth"` // in bits per second
+	Samples   int       `json:"samples"`
+	Updated   time.Time `json:"updated"`
+}
+
+func (e *bandwidthEstimate) add(bps float64, now time.Time) {
+	if e.Samples == 0 {
+		e.Bandwidth = bps
+	} else {
+		e.Bandwidth = bandwidthAlpha*bps + (1-bandwidthAlpha)*e.Bandwidth
+	}
+
+	e.Samples++
+	e.Updated = now
+}
+
+// tracks measured delivery throughput per client and per session
+type bandwidthTracker struct {
+	mu       sync.Mutex
+	clients  map[string]*bandwidthEstimate            // map of client keys and their throughput
+	sessions map[string]map[string]*bandwidthEstimate // map of session IDs and throughput of their clients
+}
+
+func newBandwidthTracker() *bandwidthTracker {
+	return &bandwidthTracker{
+		clients:  map[string]*bandwidthEstimate{},
+		sessions: map[string]map[string]*bandwidthEstimate{},
+	}
+}
+
+func (t *bandwidthTracker) record(clientKey, ID string, bytes int64, elapsed time.Duration) {
+	if bytes < bandwidthMinBytes || elapsed <= 0 {
+		return
+	}
+
+	bps := float64(bytes*8) / elapsed.Seconds()
+	now := time.Now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[clientKey]
+	if !ok {
+		client = &bandwidthEstimate{}
+		t.clients[clientKey] = client
+	}
+	client.add(bps, now)
+
+	session, ok := t.sessions[ID]
+	if !ok {
+		session = map[string]*bandwidthEstimate{}
+		t.sessions[ID] = session
+	}
+
+	estimate, ok := session[clientKey]
+	if !ok {
+		estimate = &bandwidthEstimate{}
+		session[clientKey] = estimate
+	}
+	estimate.add(bps, now)
+}
+
+// returns throughput of client and its sessions
+func (t *bandwidthTracker) client(clientKey string) (bandwidthEstimate, map[string]bandwidthEstimate, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	client, ok := t.clients[clientKey]
+	if !ok {
+		return bandwidthEstimate{}, nil, false
+	}
+
+	sessions := map[string]bandwidthEstimate{}
+	for ID, session := range t.sessions {
+		if estimate, ok := session[clientKey]; ok {
+			sessions[ID] = *estimate
+		}
+	}
+
+	return *client, sessions, true
+}
+
+// forgets stopped session
+func (t *bandwidthTracker) release(ID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.sessions, ID)
+}
+
+// forgets clients, that were not seen recently
+func (t *bandwidthTracker) cleanup() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	for key, client := range t.clients {
+		if now.Sub(client.Updated) >= bandwidthTimeout {
+			delete(t.clients, key)
+		}
+	}
+}
+
+// counts written bytes and time from the first write
+type bandwidthWriter struct {
+	http.ResponseWriter
+	bytes int64
+	start time.Time
+}
+
+func (w *bandwidthWriter) Write(p []byte) (int, error) {
+	if w.start.IsZero() {
+		w.start = time.Now()
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// files are copied by underlying writer, so that they are served by sendfile
+func (w *bandwidthWriter) ReadFrom(src io.Reader) (int64, error) {
+	if w.start.IsZero() {
+		w.start = time.Now()
+	}
+
+	n, err := io.Copy(w.ResponseWriter, src)
+	w.bytes += n
+	return n, err
+}
+
+func (w *bandwidthWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// underlying writer is used by http.ResponseController
+func (w *bandwidthWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// serves response and records its delivery throughput
+func (a *ApiManagerCtx) withBandwidth(w http.ResponseWriter, r *http.Request, ID string, serve func(w http.ResponseWriter, r *http.Request)) {
+	bw := &bandwidthWriter{ResponseWriter: w}
+	serve(bw, r)
+
+	if !bw.start.IsZero() {
+		a.bandwidth.record(a.limiter.clientKey(r), ID, bw.bytes, time.Since(bw.start))
+	}
+}
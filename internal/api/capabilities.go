@@ -0,0 +1,125 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+// how long can probing of ffmpeg capabilities take
+const capabilitiesProbeTimeout = 10 * time.Second
+
+// containers relevant for players, other ffmpeg muxers are not listed
+var capabilitiesContainers = map[string]bool{
+	"mpegts": true,
+	"mp4":    true,
+	"webm":   true,
+	"hls":    true,
+	"dash":   true,
+}
+
+type capabilities struct {
+	Codecs struct {
+		Video []string `json:"video"`
+		Audio []string `json:"audio"`
+	} `json:"codecs"`
+	Containers []string `json:"containers"`
+	HWAccel    struct {
+		Methods  []string       `json:"methods"`            // hardware acceleration methods of ffmpeg
+		Encoders map[string]int `json:"encoders,omitempty"` // maximum sessions of hardware encoders used by vod
+	} `json:"hwaccel"`
+	Profiles map[string][]string `json:"profiles"` // profiles by output format, e.g. hls, dash, http or vod
+}
+
+// ffmpeg is probed once, its capabilities do not change while running
+type capabilitiesProbe struct {
+	once   sync.Once
+	ffmpeg hlsvod.FFmpegCapabilities
+}
+
+func (p *capabilitiesProbe) get(ffmpegBinary string) hlsvod.FFmpegCapabilities {
+	p.once.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), capabilitiesProbeTimeout)
+		defer cancel()
+
+		var err error
+		p.ffmpeg, err = hlsvod.ProbeFFmpegCapabilities(ctx, ffmpegBinary)
+		if err != nil {
+			log.Warn().Str("module", "api").Err(err).Msg("unable to probe ffmpeg capabilities")
+			p.ffmpeg = hlsvod.ParseFFmpegCapabilities("", "", "")
+		}
+	})
+
+	return p.ffmpeg
+}
+
+// returns names of profiles in profiles folder
+func (a *ApiManagerCtx) profileNames(folder string) []string {
+	profiles := []string{}
+
+	matches, _ := filepath.Glob(filepath.Join(a.config.Profiles, folder, "*.sh"))
+	for _, match := range matches {
+		profile := strings.TrimSuffix(filepath.Base(match), ".sh")
+		if resourceRegex.MatchString(profile) {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	return profiles
+}
+
+func (a *ApiManagerCtx) capabilities() capabilities {
+	ffmpeg := a.capabilitiesProbe.get(a.config.Vod.FFmpegBinary)
+
+	c := capabilities{
+		Containers: []string{},
+		Profiles:   map[string][]string{},
+	}
+
+	c.Codecs.Video = ffmpeg.VideoCodecs
+	c.Codecs.Audio = ffmpeg.AudioCodecs
+	c.HWAccel.Methods = ffmpeg.HWAccels
+
+	for _, muxer := range ffmpeg.Muxers {
+		if capabilitiesContainers[muxer] {
+			c.Containers = append(c.Containers, muxer)
+		}
+	}
+
+	for _, folder := range []string{"hls", "dash", "http"} {
+		if _, err := os.Stat(filepath.Join(a.config.Profiles, folder)); err == nil {
+			c.Profiles[folder] = a.profileNames(folder)
+		}
+	}
+
+	if a.config.Vod.MediaDir != "" {
+		vod := []string{}
+		for profileID := range a.config.Vod.VideoProfiles {
+			vod = append(vod, profileID)
+		}
+		sort.Strings(vod)
+		c.Profiles["vod"] = vod
+
+		if a.encoders != nil {
+			c.HWAccel.Encoders = a.encoders.Limits()
+		}
+	}
+
+	return c
+}
+
+func (a *ApiManagerCtx) Capabilities(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(a.capabilities())
+}
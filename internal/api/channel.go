@@ -0,0 +1,267 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/channel"
+	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/signedurl"
+)
+
+// default and maximal range of channel schedule
+const (
+	liveChannelGuideRange    = 24 * time.Hour
+	liveChannelGuideRangeMax = 7 * 24 * time.Hour
+)
+
+// scheduled channel, its items are planned upon the first request
+type liveChannel struct {
+	config config.Channel
+
+	mu       sync.Mutex
+	schedule *channel.Schedule
+}
+
+type liveChannels map[string]*liveChannel
+
+func newLiveChannels(channels map[string]config.Channel) liveChannels {
+	live := liveChannels{}
+	for id, c := range channels {
+		live[id] = &liveChannel{config: c}
+	}
+
+	return live
+}
+
+// returns schedule of channel, segments of all items are planned the same
+// way as they are served by vod sessions, failed planning is retried by the
+// next request
+func (a *ApiManagerCtx) liveChannelSchedule(ctx context.Context, c *liveChannel) (*channel.Schedule, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.schedule != nil {
+		return c.schedule, nil
+	}
+
+	items := []channel.Item{}
+	for _, item := range c.config.Items {
+		plan, err := a.HlsVodPlan(ctx, item.Path)
+		if err != nil {
+			return nil, fmt.Errorf("unable to plan %q: %w", item.Path, err)
+		}
+
+		segments := []channel.Segment{}
+		for _, segment := range plan.Segments {
+			segments = append(segments, channel.Segment{
+				Name:     hlsvod.SegmentName(c.config.Profile, segment.Index),
+				Duration: segment.Duration,
+			})
+		}
+
+		items = append(items, channel.Item{
+			Title:    item.Title,
+			Path:     item.Path,
+			Segments: segments,
+		})
+	}
+
+	schedule, err := channel.New(c.config.StartTime, c.config.Loop, items)
+	if err != nil {
+		return nil, err
+	}
+
+	c.schedule = schedule
+	return schedule, nil
+}
+
+// returns requested channel and its schedule or writes error response
+func (a *ApiManagerCtx) liveChannel(w http.ResponseWriter, r *http.Request) (*liveChannel, *channel.Schedule, bool) {
+	c, ok := a.channels[chi.URLParam(r, "channel")]
+	if !ok {
+		a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "channel not found")
+		return nil, nil, false
+	}
+
+	schedule, err := a.liveChannelSchedule(r.Context(), c)
+	if err != nil {
+		log.Warn().Str("module", "channel").Err(err).Str("channel", chi.URLParam(r, "channel")).Msg("unable to schedule channel")
+		a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to schedule channel")
+		return nil, nil, false
+	}
+
+	return c, schedule, true
+}
+
+// channel guide, as returned by schedule API
+type liveChannelGuide struct {
+	Channel    string              `json:"channel"`
+	Loop       bool                `json:"loop"`
+	Duration   float64             `json:"duration"` // of all items, in seconds
+	Current    *channel.Programme  `json:"current"`  // null, if nothing is airing
+	Programmes []channel.Programme `json:"programmes"`
+}
+
+func (a *ApiManagerCtx) Channel(r chi.Router) {
+	// access to media is verified the same way as for vod
+	channels := r
+	if a.signer != nil {
+		channels = r.With(signedurl.Middleware(a.signer, a.errors))
+	}
+
+	r.Get("/channels", func(w http.ResponseWriter, r *http.Request) {
+		ids := make([]string, 0, len(a.channels))
+		for id := range a.channels {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(ids)
+	})
+
+	// programmes airing in range, from now for 24 hours by default
+	r.Get("/channel/{channel}/schedule", func(w http.ResponseWriter, r *http.Request) {
+		c, schedule, ok := a.liveChannel(w, r)
+		if !ok {
+			return
+		}
+
+		now := time.Now()
+		from, to := now, now.Add(liveChannelGuideRange)
+
+		query := r.URL.Query()
+		if value := query.Get("from"); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid schedule from")
+				return
+			}
+			from, to = t, t.Add(liveChannelGuideRange)
+		}
+
+		if value := query.Get("to"); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid schedule to")
+				return
+			}
+			to = t
+		}
+
+		if !to.After(from) || to.Sub(from) > liveChannelGuideRangeMax {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid schedule range")
+			return
+		}
+
+		guide := liveChannelGuide{
+			Channel:    chi.URLParam(r, "channel"),
+			Loop:       c.config.Loop,
+			Duration:   schedule.Duration().Seconds(),
+			Programmes: schedule.Guide(from, to),
+		}
+
+		if programme, ok := schedule.At(now); ok {
+			guide.Current = &programme
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(guide)
+	})
+
+	channels.Get("/channel/{channel}/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		c, schedule, ok := a.liveChannel(w, r)
+		if !ok {
+			return
+		}
+
+		playlist, err := schedule.Playlist(time.Now(), c.config.Window, r.URL.RawQuery)
+		if err != nil {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, err.Error())
+			return
+		}
+
+		// viewers of channel are counted the same way as of live streams
+		a.liveViewerSeen(r, "channel/"+chi.URLParam(r, "channel"))
+
+		w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+		w.Header().Set("Cache-Control", "no-cache")
+		_, _ = w.Write([]byte(playlist))
+	})
+
+	// segments are served by vod session of item
+	channels.Get("/channel/{channel}/{item}/{segment}", func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().Str("module", "channel").Str("channel", chi.URLParam(r, "channel")).Logger()
+
+		c, ok := a.channels[chi.URLParam(r, "channel")]
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "channel not found")
+			return
+		}
+
+		item, err := strconv.Atoi(chi.URLParam(r, "item"))
+		if err != nil || item < 0 || item >= len(c.config.Items) {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "item not found")
+			return
+		}
+
+		profile, preview, _ := a.hlsVodProfile(c.config.Profile)
+		sessionConfig := hlsVodSessionConfig{
+			mediaPath: filepath.Join(a.config.Vod.MediaDir, filepath.Clean("/"+c.config.Items[item].Path)),
+			profileID: c.config.Profile,
+			profile:   profile,
+			preview:   preview,
+		}
+
+		if !preview {
+			sessionConfig.overlay = a.hlsVodOverlayText(r, c.config.Items[item].Path)
+		}
+
+		ID := hlsVodSessionID(sessionConfig)
+
+		hlsVodManagersMu.Lock()
+		manager, ok := hlsVodManagers[ID]
+		hlsVodManagersMu.Unlock()
+
+		if !ok {
+			if !hlsVodMediaExists(sessionConfig.mediaPath) {
+				a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "item not found")
+				return
+			}
+
+			// session is attributed to client, that starts it
+			if err := a.limiter.acquire(r, ID); err != nil {
+				logger.Warn().Err(err).Str("id", ID).Msg("session limit reached")
+				a.limiter.httpError(w, r, err, a.errors)
+				return
+			}
+
+			manager, err = a.hlsVodSession(ID, sessionConfig)
+			if err != nil {
+				a.limiter.release(ID)
+				logger.Warn().Err(err).Msg("hls vod manager could not be started")
+				a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "hls vod manager could not be started")
+				return
+			}
+		}
+
+		// bytes served are counted into quota of client
+		if w, ok := a.quotaResponse(w, r, ID); ok {
+			a.withBandwidth(w, r, ID, manager.ServeMedia)
+		}
+	})
+}
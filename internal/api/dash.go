@@ -0,0 +1,103 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/httperror"
+)
+
+// LL-DASH live sessions share managers with hls, they are distinguished by dash/ prefix
+func (a *ApiManagerCtx) Dash(r chi.Router) {
+	r.Get("/dash/{profile}/{input}/manifest.mpd", func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().Str("module", "dash").Logger()
+
+		profile := chi.URLParam(r, "profile")
+		input := chi.URLParam(r, "input")
+
+		if !resourceRegex.MatchString(profile) || !resourceRegex.MatchString(input) {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid parameters")
+			return
+		}
+
+		// check if stream exists
+		_, ok := a.config.Streams[input]
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "stream not found")
+			return
+		}
+
+		// check if profile exists
+		profilePath, err := a.ProfilePath("dash", profile)
+		if err != nil {
+			logger.Warn().Err(err).Msg("profile path could not be found")
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "profile not found")
+			return
+		}
+
+		ID := fmt.Sprintf("dash/%s/%s", profile, input)
+
+		hlsManagersMu.Lock()
+		manager, ok := hlsManagers[ID]
+		if !ok {
+			inputArgs, err := a.inputArgs(r, input)
+			if err != nil {
+				hlsManagersMu.Unlock()
+				logger.Warn().Err(err).Str("id", ID).Msg("invalid input options")
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid input options")
+				return
+			}
+
+			manager = a.hlsManager(ID, profilePath, input, inputArgs, true)
+			hlsManagers[ID] = manager
+		}
+		hlsManagersMu.Unlock()
+
+		// session is attributed to client, that starts it
+		if err := a.limiter.acquire(r, ID); err != nil {
+			logger.Warn().Err(err).Str("id", ID).Msg("session limit reached")
+			a.limiter.httpError(w, r, err, a.errors)
+			return
+		}
+
+		a.liveViewerSeen(r, input)
+		manager.ServeManifest(w, r)
+	})
+
+	// init segments and chunks, that can be still being written
+	serveMedia := func(w http.ResponseWriter, r *http.Request) {
+		profile := chi.URLParam(r, "profile")
+		input := chi.URLParam(r, "input")
+		file := chi.URLParam(r, "file")
+
+		if !resourceRegex.MatchString(profile) || !resourceRegex.MatchString(input) || !resourceRegex.MatchString(file) {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid parameters")
+			return
+		}
+
+		ID := fmt.Sprintf("dash/%s/%s", profile, input)
+
+		hlsManagersMu.Lock()
+		manager, ok := hlsManagers[ID]
+		hlsManagersMu.Unlock()
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "transcode not found")
+			return
+		}
+
+		// bytes served are counted into quota of client
+		w, ok = a.quotaResponse(w, r, ID)
+		if !ok {
+			return
+		}
+
+		a.liveViewerSeen(r, input)
+		manager.ServeMedia(w, r)
+	}
+
+	r.Get("/dash/{profile}/{input}/{file}.m4s", serveMedia)
+	r.Get("/dash/{profile}/{input}/{file}.webm", serveMedia) // WebM-DASH
+}
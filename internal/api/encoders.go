@@ -0,0 +1,130 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+// directory of kernel drm devices, that report utilization of VAAPI GPUs
+const hlsVodDRMDir = "/sys/class/drm"
+
+// periodically polls GPUs of hardware encoders, so that their utilization
+// is exported in metrics and sessions of other processes count into limits
+func (a *ApiManagerCtx) hlsVodEncoderPoller() {
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "encoders").Logger()
+
+	ticker := time.NewTicker(a.config.Vod.EncoderPoll)
+	defer ticker.Stop()
+
+	for {
+		limits := a.encoders.Limits()
+		gpus := []hlsvod.GPUStats{}
+
+		if limits[hlsvod.EncoderNVENC] > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), a.config.Vod.EncoderPoll)
+			stats, err := hlsvod.PollNVIDIA(ctx, a.config.Vod.NvidiaSMI)
+			cancel()
+
+			if err != nil {
+				logger.Warn().Err(err).Msg("unable to poll NVIDIA GPUs")
+			}
+			gpus = append(gpus, stats...)
+		}
+
+		if limits[hlsvod.EncoderVAAPI] > 0 {
+			stats, err := hlsvod.PollDRM(hlsVodDRMDir)
+			if err != nil {
+				logger.Warn().Err(err).Msg("unable to poll DRM GPUs")
+			}
+			gpus = append(gpus, stats...)
+		}
+
+		a.encoders.UpdateGPUs(gpus)
+
+		select {
+		case <-a.shutdown:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// escapes label value in Prometheus text format
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// writes gauges of live viewers and hardware encoders in Prometheus text
+// exposition format
+func (a *ApiManagerCtx) WriteMetrics(w io.Writer) {
+	a.writeViewersMetrics(w)
+
+	if a.encoders == nil {
+		return
+	}
+
+	limits := a.encoders.Limits()
+	sessions := a.encoders.Sessions()
+
+	encoders := make([]string, 0, len(limits))
+	for encoder := range limits {
+		encoders = append(encoders, encoder)
+	}
+	sort.Strings(encoders)
+
+	fmt.Fprintf(w, "# HELP gotranscode_encoder_session_limit Maximum sessions of hardware encoder.\n")
+	fmt.Fprintf(w, "# TYPE gotranscode_encoder_session_limit gauge\n")
+	for _, encoder := range encoders {
+		fmt.Fprintf(w, "gotranscode_encoder_session_limit{encoder=%q} %d\n", encoder, limits[encoder])
+	}
+
+	fmt.Fprintf(w, "# HELP gotranscode_encoder_sessions Active vod sessions of hardware encoder.\n")
+	fmt.Fprintf(w, "# TYPE gotranscode_encoder_sessions gauge\n")
+	for _, encoder := range encoders {
+		fmt.Fprintf(w, "gotranscode_encoder_sessions{encoder=%q} %d\n", encoder, sessions[encoder])
+	}
+
+	gpus := a.encoders.GPUs()
+	if len(gpus) == 0 {
+		return
+	}
+
+	gauges := []struct {
+		name  string
+		help  string
+		value func(gpu hlsvod.GPUStats) float64
+	}{
+		{"gotranscode_gpu_utilization_percent", "Utilization of GPU.", func(gpu hlsvod.GPUStats) float64 {
+			return gpu.Utilization
+		}},
+		{"gotranscode_gpu_encode_utilization_percent", "Utilization of GPU video encode engine.", func(gpu hlsvod.GPUStats) float64 {
+			return gpu.EncodeUtilization
+		}},
+		{"gotranscode_gpu_encode_sessions", "Encode sessions of all processes using GPU.", func(gpu hlsvod.GPUStats) float64 {
+			return float64(gpu.Sessions)
+		}},
+	}
+
+	for _, gauge := range gauges {
+		fmt.Fprintf(w, "# HELP %s %s\n", gauge.name, gauge.help)
+		fmt.Fprintf(w, "# TYPE %s gauge\n", gauge.name)
+
+		for _, gpu := range gpus {
+			// values not reported by GPU are omitted
+			value := gauge.value(gpu)
+			if value < 0 {
+				continue
+			}
+
+			fmt.Fprintf(w, "%s{encoder=\"%s\",gpu=\"%d\",name=\"%s\"} %s\n", gauge.name, gpu.Encoder, gpu.Index,
+				metricsLabelEscaper.Replace(gpu.Name), strconv.FormatFloat(value, 'g', -1, 64))
+		}
+	}
+}
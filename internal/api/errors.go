@@ -0,0 +1,30 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/m1k1o/go-transcode/httperror"
+)
+
+// replaces error responder of handlers and sessions created afterwards,
+// by default error-format from config is used
+func (a *ApiManagerCtx) SetErrorResponder(responder httperror.Responder) {
+	a.errors = responder
+}
+
+// returns error responder of error format, nil means default of every module
+func configErrorResponder(format string) httperror.Responder {
+	switch format {
+	case "text":
+		return httperror.Text
+	case "json":
+		return httperror.JSON
+	default:
+		return nil
+	}
+}
+
+// writes error using error responder, plain text by default
+func (a *ApiManagerCtx) httpError(w http.ResponseWriter, r *http.Request, status int, code, message string) {
+	httperror.New(r, status, code, message).Write(w, r, a.errors)
+}
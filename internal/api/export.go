@@ -0,0 +1,348 @@
+package api
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/signedurl"
+)
+
+const hlsVodExportQueueSize = 64
+
+// export, whose file was requested before it was finished
+const hlsVodExportPendingCode = "export-pending"
+
+// how often are expired exports removed
+const hlsVodExportCleanupPeriod = time.Minute
+
+const (
+	hlsVodExportQueued  = "queued"
+	hlsVodExportRunning = "running"
+	hlsVodExportDone    = "done"
+	hlsVodExportFailed  = "failed"
+)
+
+// status of export job, it is identified by random ID, that grants access to
+// status and exported file
+type hlsVodExportJob struct {
+	ID       string     `json:"id"`
+	State    string     `json:"state"`    // queued, running, done or failed
+	Progress float64    `json:"progress"` // from 0 to 1
+	Error    string     `json:"error,omitempty"`
+	Media    string     `json:"media"`
+	Start    float64    `json:"start"`
+	End      float64    `json:"end"`
+	Profile  string     `json:"profile,omitempty"` // empty means original quality
+	Format   string     `json:"format"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	URL      string     `json:"url,omitempty"` // download of exported file
+
+	mediaPath string
+	path      string
+}
+
+// background queue of clip exports, statuses are kept until they expire
+type hlsVodExports struct {
+	queue chan string
+
+	jobsMu sync.Mutex
+	jobs   map[string]*hlsVodExportJob
+}
+
+func newHlsVodExports() *hlsVodExports {
+	return &hlsVodExports{
+		queue: make(chan string, hlsVodExportQueueSize),
+		jobs:  map[string]*hlsVodExportJob{},
+	}
+}
+
+// queues job, it fails if queue is full
+func (q *hlsVodExports) enqueue(job *hlsVodExportJob) bool {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	select {
+	case q.queue <- job.ID:
+		q.jobs[job.ID] = job
+		return true
+	default:
+		return false
+	}
+}
+
+// returns copy of job status
+func (q *hlsVodExports) get(ID string) (hlsVodExportJob, bool) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	job, ok := q.jobs[ID]
+	if !ok {
+		return hlsVodExportJob{}, false
+	}
+
+	return *job, true
+}
+
+func (q *hlsVodExports) update(ID string, fn func(job *hlsVodExportJob)) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	if job, ok := q.jobs[ID]; ok {
+		fn(job)
+	}
+}
+
+func (q *hlsVodExports) finish(ID string, err error) {
+	q.update(ID, func(job *hlsVodExportJob) {
+		now := time.Now()
+		job.Finished = &now
+
+		if err != nil {
+			job.State = hlsVodExportFailed
+			job.Error = err.Error()
+			return
+		}
+
+		job.State = hlsVodExportDone
+		job.Progress = 1
+		job.URL = "/exports/" + job.ID + "/file"
+	})
+}
+
+// forgets jobs finished before TTL and removes their files
+func (q *hlsVodExports) cleanup(ttl time.Duration) {
+	q.jobsMu.Lock()
+	defer q.jobsMu.Unlock()
+
+	for ID, job := range q.jobs {
+		if job.Finished == nil || time.Since(*job.Finished) < ttl {
+			continue
+		}
+
+		if err := os.Remove(job.path); err != nil && !os.IsNotExist(err) {
+			log.Warn().Err(err).Str("id", ID).Msg("unable to remove exported file")
+		}
+
+		delete(q.jobs, ID)
+	}
+}
+
+func hlsVodExportID() (string, error) {
+	ID := make([]byte, 16)
+	if _, err := rand.Read(ID); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(ID), nil
+}
+
+// Export renders frame accurate clips of media into MP4 or WebM files for
+// sharing outside of HLS playback, e.g. POST /export/movie.mp4?start=10&end=20
+func (a *ApiManagerCtx) Export(r chi.Router) {
+	// access to media is verified the same way as for vod
+	export := r
+	if a.signer != nil {
+		export = r.With(signedurl.Middleware(a.signer, a.errors))
+	}
+
+	export.Post("/export/*", func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().Str("module", "hlsvod").Str("submodule", "export").Logger()
+
+		// remove /export/ from path, it is already unescaped
+		urlPath := r.URL.Path[8:]
+		if urlPath == "" {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid media path")
+			return
+		}
+
+		query := r.URL.Query()
+		start, err := strconv.ParseFloat(query.Get("start"), 64)
+		if err != nil || start < 0 {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid export start")
+			return
+		}
+
+		end, err := strconv.ParseFloat(query.Get("end"), 64)
+		if err != nil || end <= start {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid export end")
+			return
+		}
+
+		format := query.Get("format")
+		switch format {
+		case "":
+			format = hlsvod.ExportMP4
+		case hlsvod.ExportMP4, hlsvod.ExportWebM:
+		default:
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "unsupported export format")
+			return
+		}
+
+		// original quality, unless profile is requested
+		profileID := query.Get("profile")
+		if profileID != "" {
+			if _, preview, ok := a.hlsVodProfile(profileID); !ok || preview {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "unknown profile")
+				return
+			}
+		}
+
+		// use clean path, rooted so that it can not escape media dir
+		mediaPath := filepath.Join(a.config.Vod.MediaDir, filepath.Clean("/"+urlPath))
+
+		if !hlsVodMediaExists(mediaPath) {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "vod not found")
+			return
+		}
+
+		ID, err := hlsVodExportID()
+		if err != nil {
+			logger.Err(err).Msg("unable to generate export id")
+			a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to generate export id")
+			return
+		}
+
+		job := &hlsVodExportJob{
+			ID:      ID,
+			State:   hlsVodExportQueued,
+			Media:   path.Clean("/" + urlPath)[1:],
+			Start:   start,
+			End:     end,
+			Profile: profileID,
+			Format:  format,
+			Created: time.Now(),
+
+			mediaPath: mediaPath,
+			path:      filepath.Join(a.config.Vod.ExportDir, ID+"."+format),
+		}
+
+		if !a.exports.enqueue(job) {
+			a.httpError(w, r, http.StatusServiceUnavailable, httperror.CodeUnavailable, "export queue is full")
+			return
+		}
+
+		logger.Info().Str("id", ID).Str("media", mediaPath).Float64("start", start).Float64("end", end).Msg("export queued")
+
+		status, _ := a.exports.get(ID)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("Location", "/exports/"+ID)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(status)
+	})
+
+	r.Get("/exports/{id}", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := a.exports.get(chi.URLParam(r, "id"))
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "export not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(job)
+	})
+
+	r.Get("/exports/{id}/file", func(w http.ResponseWriter, r *http.Request) {
+		job, ok := a.exports.get(chi.URLParam(r, "id"))
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "export not found")
+			return
+		}
+
+		if job.State != hlsVodExportDone {
+			a.httpError(w, r, http.StatusConflict, hlsVodExportPendingCode, "export is not finished")
+			return
+		}
+
+		name := strconv.Quote(path.Base(job.Media) + "-" + job.ID[:8] + "." + job.Format)
+		w.Header().Set("Content-Disposition", "attachment; filename="+name)
+		http.ServeFile(w, r, job.path)
+	})
+}
+
+// exports clips one by one, so that they do not compete with playback
+func (a *ApiManagerCtx) hlsVodExportWorker() {
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "export").Logger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.shutdown
+		cancel()
+	}()
+
+	ticker := time.NewTicker(hlsVodExportCleanupPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.shutdown:
+			return
+		case <-ticker.C:
+			a.exports.cleanup(a.config.Vod.ExportTTL)
+		case ID := <-a.exports.queue:
+			job, ok := a.exports.get(ID)
+			if !ok {
+				continue
+			}
+
+			a.exports.update(ID, func(job *hlsVodExportJob) {
+				job.State = hlsVodExportRunning
+			})
+
+			config := hlsvod.ExportConfig{
+				InputFilePath:  job.mediaPath,
+				OutputFilePath: job.path,
+				Format:         job.Format,
+				Start:          job.Start,
+				End:            job.End,
+				AudioProfile: &hlsvod.AudioProfile{
+					Bitrate: a.config.Vod.AudioProfile.Bitrate,
+				},
+				Control: a.jobs,
+				Progress: func(progress float64) {
+					a.exports.update(ID, func(job *hlsVodExportJob) {
+						job.Progress = progress
+					})
+				},
+			}
+
+			if job.Profile != "" {
+				profile, _, _ := a.hlsVodProfile(job.Profile)
+				config.VideoProfile = &hlsvod.VideoProfile{
+					Width:   profile.Width,
+					Height:  profile.Height,
+					Bitrate: profile.Bitrate,
+				}
+			}
+
+			logger.Info().Str("id", ID).Str("media", job.mediaPath).Msg("exporting clip")
+			err := hlsvod.Export(ctx, a.config.Vod.FFmpegBinary, a.config.Vod.FFprobeBinary, config)
+			a.exports.finish(ID, err)
+
+			if err != nil {
+				logger.Warn().Err(err).Str("id", ID).Str("media", job.mediaPath).Msg("exporting clip failed")
+				continue
+			}
+
+			logger.Info().Str("id", ID).Str("media", job.mediaPath).Msg("exporting clip finished")
+		}
+	}
+}
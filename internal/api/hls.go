@@ -5,14 +5,21 @@ import (
 	"fmt"
 	"net/http"
 	"os/exec"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
 	"github.com/rs/zerolog/log"
 
 	"github.com/m1k1o/go-transcode/hls"
+	"github.com/m1k1o/go-transcode/httperror"
 )
 
 var hlsManagers map[string]hls.Manager = make(map[string]hls.Manager)
+var hlsManagersMu sync.Mutex
+
+// timeout of single upload to origin
+const hlsPublishTimeout = 30 * time.Second
 
 //go:embed play.html
 var playHTML string
@@ -25,14 +32,14 @@ func (a *ApiManagerCtx) HLS(r chi.Router) {
 		input := chi.URLParam(r, "input")
 
 		if !resourceRegex.MatchString(profile) || !resourceRegex.MatchString(input) {
-			http.Error(w, "400 invalid parameters", http.StatusBadRequest)
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid parameters")
 			return
 		}
 
 		// check if stream exists
 		_, ok := a.config.Streams[input]
 		if !ok {
-			http.Error(w, "404 stream not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "stream not found")
 			return
 		}
 
@@ -40,50 +47,97 @@ func (a *ApiManagerCtx) HLS(r chi.Router) {
 		profilePath, err := a.ProfilePath("hls", profile)
 		if err != nil {
 			logger.Warn().Err(err).Msg("profile path could not be found")
-			http.Error(w, "404 profile not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "profile not found")
 			return
 		}
 
 		ID := fmt.Sprintf("%s/%s", profile, input)
 
+		hlsManagersMu.Lock()
 		manager, ok := hlsManagers[ID]
 		if !ok {
-			// create new manager
-			manager = hls.New(func() *exec.Cmd {
-				// get transcode cmd
-				cmd, err := a.transcodeStart(profilePath, input)
-				if err != nil {
-					logger.Error().Err(err).Msg("transcode could not be started")
-				}
-
-				return cmd
-			})
-
+			inputArgs, err := a.inputArgs(r, input)
+			if err != nil {
+				hlsManagersMu.Unlock()
+				logger.Warn().Err(err).Str("id", ID).Msg("invalid input options")
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid input options")
+				return
+			}
+
+			manager = a.hlsManager(ID, profilePath, input, inputArgs, false)
 			hlsManagers[ID] = manager
 		}
+		hlsManagersMu.Unlock()
+
+		// session is attributed to client, that starts it
+		if err := a.limiter.acquire(r, ID); err != nil {
+			logger.Warn().Err(err).Str("id", ID).Msg("session limit reached")
+			a.limiter.httpError(w, r, err, a.errors)
+			return
+		}
 
+		a.liveViewerSeen(r, input)
 		manager.ServePlaylist(w, r)
 	})
 
-	r.Get("/{profile}/{input}/{file}.ts", func(w http.ResponseWriter, r *http.Request) {
+	// variant playlists and segments written to working directory
+	serveMedia := func(w http.ResponseWriter, r *http.Request) {
 		profile := chi.URLParam(r, "profile")
 		input := chi.URLParam(r, "input")
 		file := chi.URLParam(r, "file")
 
 		if !resourceRegex.MatchString(profile) || !resourceRegex.MatchString(input) || !resourceRegex.MatchString(file) {
-			http.Error(w, "400 invalid parameters", http.StatusBadRequest)
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid parameters")
 			return
 		}
 
 		ID := fmt.Sprintf("%s/%s", profile, input)
 
+		hlsManagersMu.Lock()
 		manager, ok := hlsManagers[ID]
+		hlsManagersMu.Unlock()
 		if !ok {
-			http.Error(w, "404 transcode not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "transcode not found")
 			return
 		}
 
+		// bytes served are counted into quota of client
+		w, ok = a.quotaResponse(w, r, ID)
+		if !ok {
+			return
+		}
+
+		a.liveViewerSeen(r, input)
 		manager.ServeMedia(w, r)
+	}
+
+	r.Get("/{profile}/{input}/{file}.m3u8", serveMedia)
+	r.Get("/{profile}/{input}/{file}.ts", serveMedia)
+	r.Get("/{profile}/{input}/{file}.m4s", serveMedia)
+	r.Get("/{profile}/{input}/{file}.mp4", serveMedia)
+
+	r.Get("/{profile}/{input}/heartbeat", func(w http.ResponseWriter, r *http.Request) {
+		profile := chi.URLParam(r, "profile")
+		input := chi.URLParam(r, "input")
+
+		if !resourceRegex.MatchString(profile) || !resourceRegex.MatchString(input) {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid parameters")
+			return
+		}
+
+		ID := fmt.Sprintf("%s/%s", profile, input)
+
+		hlsManagersMu.Lock()
+		manager, ok := hlsManagers[ID]
+		hlsManagersMu.Unlock()
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "transcode not found")
+			return
+		}
+
+		a.liveViewerSeen(r, input)
+		manager.Heartbeat()
+		w.WriteHeader(http.StatusNoContent)
 	})
 
 	r.Get("/{profile}/{input}/play.html", func(w http.ResponseWriter, r *http.Request) {
@@ -91,3 +145,88 @@ func (a *ApiManagerCtx) HLS(r chi.Router) {
 		_, _ = w.Write([]byte(playHTML))
 	})
 }
+
+// creates live session manager running profile for input
+func (a *ApiManagerCtx) hlsManager(ID, profilePath, input string, inputArgs []string, dash bool) hls.Manager {
+	logger := log.With().Str("module", "hls").Logger()
+
+	return hls.New(func() *exec.Cmd {
+		// get transcode cmd
+		cmd, err := a.transcodeStart(profilePath, input, inputArgs)
+		if err != nil {
+			logger.Error().Err(err).Msg("transcode could not be started")
+		}
+
+		return cmd
+	}, ID, a.events, hls.Config{
+		SourceIdleTimeout:  a.config.SourceIdleTimeout,
+		SourceIdleRestarts: a.config.SourceIdleRestarts,
+		DVRWindow:          a.config.DVRWindow,
+		AdaptiveSpeed:      a.config.LiveAdaptive.MinSpeed,
+		AdaptiveWindow:     a.config.LiveAdaptive.Window,
+		Dash:               dash,
+		Publish:            a.hlsPublishConfig(ID),
+		ErrorResponder:     a.errors,
+		Detect: hls.DetectConfig{
+			FFmpegBinary: a.config.Vod.FFmpegBinary,
+			Input:        a.hlsDetectInput(input),
+			InputArgs:    inputArgs,
+			Silence:      a.config.LiveDetect.Silence,
+			SilenceNoise: a.config.LiveDetect.SilenceNoise,
+			Black:        a.config.LiveDetect.Black,
+			BlackAmount:  a.config.LiveDetect.BlackAmount,
+		},
+	})
+}
+
+// returns publishing configuration of live session, session is stored
+// at origin under its profile and input
+func (a *ApiManagerCtx) hlsPublishConfig(ID string) hls.PublishConfig {
+	c := a.config.LivePublish
+	if c.URL == "" {
+		return hls.PublishConfig{}
+	}
+
+	var uploader hls.Uploader
+	switch c.Type {
+	case "s3":
+		uploader = &hls.S3Uploader{
+			Endpoint:  c.URL,
+			Bucket:    c.Bucket,
+			Region:    c.Region,
+			AccessKey: c.AccessKey,
+			SecretKey: c.SecretKey,
+			Client:    &http.Client{Timeout: hlsPublishTimeout},
+		}
+	default:
+		header := http.Header{}
+		for key, value := range c.Headers {
+			header.Set(key, value)
+		}
+
+		uploader = &hls.HTTPUploader{
+			URL:    c.URL,
+			Header: header,
+			Client: &http.Client{Timeout: hlsPublishTimeout},
+		}
+	}
+
+	return hls.PublishConfig{
+		Uploader:   uploader,
+		Prefix:     ID,
+		Workers:    c.Workers,
+		QueueSize:  c.QueueSize,
+		Retries:    c.Retries,
+		RetryDelay: c.RetryDelay,
+	}
+}
+
+// returns input analyzed by detector, invalid stream disables it
+func (a *ApiManagerCtx) hlsDetectInput(input string) string {
+	url, err := a.streamURL(input)
+	if err != nil {
+		return ""
+	}
+
+	return url
+}
@@ -1,17 +1,27 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"os/exec"
 	"strings"
+	"sync"
 
 	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
 
+	"github.com/m1k1o/go-transcode/hls"
 	"github.com/m1k1o/go-transcode/hlsproxy"
+	"github.com/m1k1o/go-transcode/httperror"
 )
 
 const hlsProxyPerfix = "/hlsproxy/"
 
+// path of transcoded variants, under proxy prefix
+const hlsProxyTranscodePath = "_transcode"
+
 var hlsProxyManagers map[string]hlsproxy.Manager = make(map[string]hlsproxy.Manager)
+var hlsProxyManagersMu sync.Mutex
 
 func (a *ApiManagerCtx) HLSProxy(r chi.Router) {
 	r.Get(hlsProxyPerfix+"{sourceId}/*", func(w http.ResponseWriter, r *http.Request) {
@@ -20,22 +30,157 @@ func (a *ApiManagerCtx) HLSProxy(r chi.Router) {
 		// check if stream exists
 		baseUrl, ok := a.config.HlsProxy[ID]
 		if !ok {
-			http.Error(w, "404 hls proxy source not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "hls proxy source not found")
 			return
 		}
 
+		hlsProxyManagersMu.Lock()
 		manager, ok := hlsProxyManagers[ID]
 		if !ok {
 			// create new manager
-			manager = hlsproxy.New(baseUrl, hlsProxyPerfix+ID+"/")
+			manager = hlsproxy.New(baseUrl, hlsProxyPerfix+ID+"/", hlsproxy.Config{
+				Variants:       a.hlsProxyVariants(ID),
+				ErrorResponder: a.errors,
+				Client:         a.upstream,
+			})
 			hlsProxyManagers[ID] = manager
 		}
+		hlsProxyManagersMu.Unlock()
 
 		// if this is playlist request
-		if strings.HasSuffix(r.URL.String(), ".m3u8") {
+		if strings.HasSuffix(r.URL.Path, ".m3u8") {
 			manager.ServePlaylist(w, r)
+			return
+		}
+
+		// bytes served are counted into quota of client
+		w, ok = a.quotaResponse(w, r, ID)
+		if !ok {
+			return
+		}
+
+		// fMP4 init segments are named .mp4, media segments .m4s
+		if strings.HasSuffix(r.URL.Path, ".mp4") {
+			manager.ServeInit(w, r)
 		} else {
 			manager.ServeMedia(w, r)
 		}
 	})
+
+	r.Get(hlsProxyPerfix+"{sourceId}/"+hlsProxyTranscodePath+"/{profile}/index.m3u8", func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().Str("module", "hlsproxy").Logger()
+
+		sourceId := chi.URLParam(r, "sourceId")
+		profile := chi.URLParam(r, "profile")
+
+		// only configured variants are transcoded
+		url, ok := a.hlsProxyTranscodeURL(sourceId, profile)
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "hls proxy transcode not found")
+			return
+		}
+
+		profilePath, err := a.ProfilePath("hls", profile)
+		if err != nil {
+			logger.Warn().Err(err).Msg("profile path could not be found")
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "profile not found")
+			return
+		}
+
+		ID := hlsProxyTranscodeID(sourceId, profile)
+
+		hlsManagersMu.Lock()
+		manager, ok := hlsManagers[ID]
+		if !ok {
+			manager = a.hlsProxyTranscodeManager(ID, profilePath, url)
+			hlsManagers[ID] = manager
+		}
+		hlsManagersMu.Unlock()
+
+		// session is attributed to client, that starts it
+		if err := a.limiter.acquire(r, ID); err != nil {
+			logger.Warn().Err(err).Str("id", ID).Msg("session limit reached")
+			a.limiter.httpError(w, r, err, a.errors)
+			return
+		}
+
+		manager.ServePlaylist(w, r)
+	})
+
+	serveMedia := func(w http.ResponseWriter, r *http.Request) {
+		sourceId := chi.URLParam(r, "sourceId")
+		profile := chi.URLParam(r, "profile")
+		file := chi.URLParam(r, "file")
+
+		if !resourceRegex.MatchString(file) {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid parameters")
+			return
+		}
+
+		ID := hlsProxyTranscodeID(sourceId, profile)
+
+		hlsManagersMu.Lock()
+		manager, ok := hlsManagers[ID]
+		hlsManagersMu.Unlock()
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "transcode not found")
+			return
+		}
+
+		// bytes served are counted into quota of client
+		w, ok = a.quotaResponse(w, r, ID)
+		if !ok {
+			return
+		}
+
+		manager.ServeMedia(w, r)
+	}
+
+	r.Get(hlsProxyPerfix+"{sourceId}/"+hlsProxyTranscodePath+"/{profile}/{file}.ts", serveMedia)
+	r.Get(hlsProxyPerfix+"{sourceId}/"+hlsProxyTranscodePath+"/{profile}/{file}.m4s", serveMedia)
+	r.Get(hlsProxyPerfix+"{sourceId}/"+hlsProxyTranscodePath+"/{profile}/{file}.mp4", serveMedia)
+}
+
+// returns session id of transcoded variant
+func hlsProxyTranscodeID(sourceId, profile string) string {
+	return fmt.Sprintf("hlsproxy/%s/%s", sourceId, profile)
+}
+
+// returns upstream url of variant transcoded with profile
+func (a *ApiManagerCtx) hlsProxyTranscodeURL(sourceId, profile string) (string, bool) {
+	for _, transcode := range a.config.HlsProxyTranscode {
+		if transcode.Proxy == sourceId && transcode.Profile == profile {
+			baseUrl := strings.TrimSuffix(a.config.HlsProxy[sourceId], "/")
+			return baseUrl + "/" + transcode.Variant, true
+		}
+	}
+
+	return "", false
+}
+
+// returns variants of hls proxy replaced by their transcodes
+func (a *ApiManagerCtx) hlsProxyVariants(sourceId string) map[string]string {
+	variants := map[string]string{}
+
+	for _, transcode := range a.config.HlsProxyTranscode {
+		if transcode.Proxy == sourceId {
+			variants[transcode.Variant] = hlsProxyPerfix + sourceId + "/" + hlsProxyTranscodePath + "/" + transcode.Profile + "/index.m3u8"
+		}
+	}
+
+	return variants
+}
+
+// creates live session manager transcoding upstream variant with profile
+func (a *ApiManagerCtx) hlsProxyTranscodeManager(ID, profilePath, url string) hls.Manager {
+	return hls.New(func() *exec.Cmd {
+		log.Info().Str("profilePath", profilePath).Str("url", url).Msg("command startred")
+		return exec.Command(profilePath, url)
+	}, ID, a.events, hls.Config{
+		SourceIdleTimeout:  a.config.SourceIdleTimeout,
+		SourceIdleRestarts: a.config.SourceIdleRestarts,
+		DVRWindow:          a.config.DVRWindow,
+		AdaptiveSpeed:      a.config.LiveAdaptive.MinSpeed,
+		AdaptiveWindow:     a.config.LiveAdaptive.Window,
+	})
 }
@@ -1,38 +1,849 @@
 package api
 
 import (
+	"context"
 	_ "embed"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
-	"net/url"
 	"os"
-	"path"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/m1k1o/go-transcode/events"
 	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/signedurl"
 	"github.com/rs/zerolog/log"
 )
 
+// how often should be idle vod sessions evicted
+const hlsVodCleanupPeriod = 30 * time.Second
+
+// how long must be vod session idle to be evicted
+const hlsVodSessionTimeout = 5 * time.Minute
+
+// profile used for scrubbing previews, if not overridden by configured profile
+const hlsVodPreviewProfileID = "preview"
+
+var hlsVodPreviewProfile = config.VideoProfile{
+	Width:   284,
+	Height:  160,
+	Bitrate: 64,
+}
+
+// audio-only rendition of secondary audio stream, e.g. audio1 for 0:a:1
+var hlsVodAudioRegex = regexp.MustCompile(`^audio([0-9]+)$`)
+
+// default waveform resolution, if not specified in query
+const hlsVodWaveformSamplesPerPixel = 256
+
+// duration of media reported by fake transcoder
+const hlsVodFakeDuration = 10 * time.Minute
+
+var hlsVodFakeTranscoder = hlsvod.NewFakeTranscoder(hlsVodFakeDuration)
+
+// URI of segment encryption keys
+const hlsVodKeyURIFormat = "/vod-key/%s"
+
+// how many warm jobs can be queued
+const hlsVodWarmQueueSize = 64
+
+var errHlsVodWarmQueueFull = errors.New("warm queue is full")
+
+// virtual clip directory, e.g. path/to/media.mp4/clip-10.5-30
+var hlsVodClipRegex = regexp.MustCompile(`^(.*)/clip-([0-9]+(?:\.[0-9]+)?)-([0-9]+(?:\.[0-9]+)?)$`)
+
 var hlsVodManagers map[string]hlsvod.Manager = make(map[string]hlsvod.Manager)
+var hlsVodManagersMu sync.Mutex
 
-func (a *ApiManagerCtx) HlsVod(r chi.Router) {
-	r.Get("/vod/*", func(w http.ResponseWriter, r *http.Request) {
-		logger := log.With().Str("module", "hlsvod").Logger()
+func (a *ApiManagerCtx) hlsVodCleanup() {
+	hlsVodManagersMu.Lock()
+	defer hlsVodManagersMu.Unlock()
+
+	for ID, manager := range hlsVodManagers {
+		if manager.Idle() < hlsVodSessionTimeout {
+			continue
+		}
+
+		log.Info().Str("module", "hlsvod").Str("id", ID).Msg("evicting idle vod session")
+		manager.Stop()
+		delete(hlsVodManagers, ID)
+		a.seekPrefetch.forget(ID)
+	}
+}
+
+// evicts session, that failed to get ready, if it was not replaced yet
+func (a *ApiManagerCtx) hlsVodSessionFailed(ID string, manager hlsvod.Manager, err error) {
+	hlsVodManagersMu.Lock()
+	current, ok := hlsVodManagers[ID]
+	if ok && current == manager {
+		delete(hlsVodManagers, ID)
+	}
+	hlsVodManagersMu.Unlock()
+
+	if ok && current == manager {
+		log.Warn().Str("module", "hlsvod").Err(err).Str("id", ID).Msg("evicting vod session, that failed to start")
+		a.seekPrefetch.forget(ID)
+		manager.Stop()
+	}
+}
+
+// stops sessions of media, that was replaced or truncated, so that the next
+// request starts new session with fresh metadata
+func (a *ApiManagerCtx) hlsVodSourceWorker() {
+	changed, unsubscribe := a.events.Subscribe(64, events.SourceChangedType)
+	defer unsubscribe()
+
+	for {
+		select {
+		case <-a.shutdown:
+			return
+		case event := <-changed:
+			e, ok := event.(events.SourceChanged)
+			if !ok {
+				continue
+			}
+
+			hlsVodManagersMu.Lock()
+			manager, ok := hlsVodManagers[e.Session]
+			delete(hlsVodManagers, e.Session)
+			hlsVodManagersMu.Unlock()
+			a.seekPrefetch.forget(e.Session)
+
+			if ok {
+				log.Info().Str("module", "hlsvod").Str("id", e.Session).Msg("stopping vod session of changed media")
+				manager.Stop()
+			}
+		}
+	}
+}
+
+// returns transcoder backend from config
+func (a *ApiManagerCtx) hlsVodTranscoder() hlsvod.Transcoder {
+	if a.config.Vod.Transcoder == "fake" {
+		return hlsVodFakeTranscoder
+	}
+
+	// renditions of the same segments are transcoded together, if enabled
+	return a.batch
+}
+
+// returns true, if media exists, image sequence exists with any of its images
+func hlsVodMediaExists(mediaPath string) bool {
+	if hlsvod.ImageSequence(mediaPath) {
+		return hlsvod.ImageSequenceExists(mediaPath)
+	}
+
+	_, err := os.Stat(mediaPath)
+	return !os.IsNotExist(err)
+}
+
+// returns configured strategy splitting media into segments
+func (a *ApiManagerCtx) hlsVodBreakpoints() hlsvod.BreakpointStrategy {
+	switch a.config.Vod.Breakpoints {
+	case "fixed":
+		return hlsvod.FixedBreakpoints{}
+	case "scene":
+		return hlsvod.SceneBreakpoints{Threshold: a.config.Vod.SceneThreshold}
+	default:
+		return hlsvod.KeyframeBreakpoints{}
+	}
+}
+
+// returns ffmpeg transcoder used by vod sessions
+func hlsVodFFmpegTranscoder(c config.VOD) *hlsvod.FFmpegTranscoder {
+	transcoder := hlsvod.NewFFmpegTranscoder(c.FFmpegBinary, c.FFprobeBinary)
+	transcoder.ImageFramerate = c.ImageFramerate
+	transcoder.ProbeWorkers = c.ProbeWorkers
+	return transcoder
+}
+
+// returns hardware encoder pool, nil if no hardware encoders are configured
+func hlsVodEncoderPool(c config.VOD) *hlsvod.EncoderPool {
+	if len(c.Encoders) == 0 && c.EncoderProbe == 0 {
+		return nil
+	}
+
+	pool := hlsvod.ProbeEncoderPool(context.Background(), c.FFmpegBinary, c.EncoderProbe, c.Encoders)
+	pool.AutoMinHeight = c.EncoderMin
+	pool.MaxUtilization = c.EncoderMaxUtil
+	return pool
+}
+
+// returns store of metadata cache, nil if cache files are used
+func hlsVodCacheStore(c config.CacheStore) hlsvod.CacheStore {
+	switch c.Type {
+	case "memory":
+		return hlsvod.NewMemoryCacheStore(c.MaxEntries)
+	case "redis":
+		return hlsvod.NewRedisCacheStore(hlsvod.RedisConfig{
+			Addr:     c.Addr,
+			Password: c.Password,
+			DB:       c.DB,
+			Prefix:   c.Prefix,
+			TTL:      c.TTL,
+		})
+	default:
+		return nil
+	}
+}
+
+// HlsVodPlan returns segment plan of media relative to media directory, as
+// it would be served by VOD sessions, without transcoding it.
+func (a *ApiManagerCtx) HlsVodPlan(ctx context.Context, mediaPath string) (*hlsvod.SegmentPlan, error) {
+	mediaPath = filepath.Join(a.config.Vod.MediaDir, filepath.Clean("/"+mediaPath))
+	if !hlsVodMediaExists(mediaPath) {
+		return nil, fmt.Errorf("media %q not found", mediaPath)
+	}
+
+	if entry, ok := a.quarantine.check(mediaPath); ok {
+		return nil, fmt.Errorf("media %q is quarantined: %s", mediaPath, entry.Error)
+	}
+
+	plan, err := hlsvod.PlanSegments(ctx, hlsvod.Config{
+		MediaPath: mediaPath,
+
+		Growing:     a.config.Vod.Growing,
+		GrowingIdle: a.config.Vod.GrowingIdle,
+
+		VideoKeyframes: a.config.Vod.VideoKeyframes,
+		Breakpoints:    a.hlsVodBreakpoints(),
+
+		Cache:        a.config.Vod.Cache,
+		CacheDir:     a.config.Vod.CacheDir,
+		CacheStore:   a.cache,
+		ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+		SegmentKey:   []byte(a.config.Vod.SegmentKey),
+
+		FFmpegBinary:  a.config.Vod.FFmpegBinary,
+		FFprobeBinary: a.config.Vod.FFprobeBinary,
+
+		Transcoder: a.hlsVodTranscoder(),
+	})
+
+	a.hlsVodProbed(mediaPath, err)
+	return plan, err
+}
+
+// returns configured profile or preview profile, if enabled
+func (a *ApiManagerCtx) hlsVodProfile(profileID string) (profile config.VideoProfile, preview bool, ok bool) {
+	profile, ok = a.config.Vod.VideoProfiles[profileID]
+	if ok {
+		return
+	}
+
+	if profileID == hlsVodPreviewProfileID && a.config.Vod.Preview {
+		return hlsVodPreviewProfile, true, true
+	}
+
+	return
+}
+
+// returns audio stream of audio-only rendition, if secondary audio is enabled
+func (a *ApiManagerCtx) hlsVodAudioProfile(profileID string) (stream int, ok bool) {
+	if !a.config.Vod.SecondaryAudio {
+		return 0, false
+	}
+
+	match := hlsVodAudioRegex.FindStringSubmatch(profileID)
+	if match == nil {
+		return 0, false
+	}
+
+	stream, err := strconv.Atoi(match[1])
+	return stream, err == nil
+}
+
+// returns audio renditions for master playlist, nil if media has no
+// audio descriptions, commentary tracks or, with preferred languages, no
+// tracks in other languages. Default rendition is the first track in
+// preferred language, otherwise the track muxed in video renditions.
+func hlsVodAudioRenditions(audio []hlsvod.ProbeAudioData, languages []string, overrides map[string]string) []hlsvod.AudioRendition {
+	// language tags of media are listed as BCP-47 tags
+	normalized := make([]hlsvod.ProbeAudioData, len(audio))
+	for i, stream := range audio {
+		stream.Language = hlsvod.NormalizeLanguage(stream.Language, overrides)
+		normalized[i] = stream
+	}
+	audio = normalized
+
+	var main *hlsvod.ProbeAudioData
+	var secondary []hlsvod.ProbeAudioData
+	for i, stream := range audio {
+		if stream.Descriptive || stream.Commentary {
+			secondary = append(secondary, stream)
+		} else if main == nil {
+			main = &audio[i]
+		} else if len(languages) > 0 {
+			// tracks in other languages are offered only to be selected by preference
+			secondary = append(secondary, stream)
+		}
+	}
+
+	if len(secondary) == 0 {
+		return nil
+	}
+
+	// audio muxed in video renditions
+	renditions := []hlsvod.AudioRendition{{
+		Name: "Main",
+	}}
+
+	if main != nil {
+		renditions[0].Language = main.Language
+		if main.Title != "" {
+			renditions[0].Name = main.Title
+		}
+	}
+
+	names := map[string]bool{renditions[0].Name: true}
+	for _, stream := range secondary {
+		name := stream.Title
+		if name == "" && stream.Descriptive {
+			name = "Audio description"
+		} else if name == "" && stream.Commentary {
+			name = "Commentary"
+		} else if name == "" && stream.Language != "" {
+			name = stream.Language
+		} else if name == "" {
+			name = "Audio"
+		}
+
+		// names must be unique within group
+		if names[name] {
+			name = fmt.Sprintf("%s %d", name, stream.Index)
+		}
+		names[name] = true
+
+		renditions = append(renditions, hlsvod.AudioRendition{
+			ID:          fmt.Sprintf("audio%d", stream.Index),
+			Name:        name,
+			Language:    stream.Language,
+			Descriptive: stream.Descriptive,
+			Commentary:  stream.Commentary,
+		})
+	}
+
+	renditions[hlsVodDefaultAudio(renditions, languages)].Default = true
+	return renditions
+}
+
+// returns index of first main rendition in preferred language, 0 if none
+func hlsVodDefaultAudio(renditions []hlsvod.AudioRendition, languages []string) int {
+	for _, language := range languages {
+		for i, rendition := range renditions {
+			if rendition.Descriptive || rendition.Commentary {
+				continue
+			}
+
+			if languageMatches(rendition.Language, language) {
+				return i
+			}
+		}
+	}
+
+	return 0
+}
+
+// returns profile with highest bitrate, that fits client throughput,
+// if none fits, profile with lowest bitrate is returned
+func hlsVodStartProfile(profiles map[string]hlsvod.VideoProfile, bandwidth float64) string {
+	var best, lowest string
+	for name, profile := range profiles {
+		if lowest == "" || profile.Bitrate < profiles[lowest].Bitrate {
+			lowest = name
+		}
+
+		if float64(profile.Bitrate) > bandwidth*bandwidthSafety {
+			continue
+		}
 
-		// remove /vod/ from path
-		urlPath, err := url.PathUnescape(r.URL.Path[5:])
+		if best == "" || profile.Bitrate > profiles[best].Bitrate {
+			best = name
+		}
+	}
+
+	if best == "" {
+		return lowest
+	}
+
+	return best
+}
+
+// returns profiles offered to client in master playlist, profiles larger
+// than source are skipped, bitrate includes audio and container overhead
+func (a *ApiManagerCtx) hlsVodOfferedProfiles(r *http.Request, data *hlsvod.ProbeMediaData) map[string]hlsvod.VideoProfile {
+	// profiles of variant matching client, all profiles are offered, if
+	// none of them is known or fits source
+	if a.variants != nil {
+		if names, ok := a.variants(r); ok {
+			videoProfiles := map[string]config.VideoProfile{}
+			for _, name := range names {
+				if profile, ok := a.config.Vod.VideoProfiles[name]; ok {
+					videoProfiles[name] = profile
+				}
+			}
+
+			if profiles := a.hlsVodFittingProfiles(videoProfiles, data); len(profiles) > 0 {
+				return profiles
+			}
+		}
+	}
+
+	return a.hlsVodFittingProfiles(a.config.Vod.VideoProfiles, data)
+}
+
+// returns profiles, that are not larger than source
+func (a *ApiManagerCtx) hlsVodFittingProfiles(videoProfiles map[string]config.VideoProfile, data *hlsvod.ProbeMediaData) map[string]hlsvod.VideoProfile {
+	width, height := 0, 0
+	if data.Video != nil {
+		width, height = data.Video.Width, data.Video.Height
+	}
+
+	profiles := map[string]hlsvod.VideoProfile{}
+	for name, profile := range videoProfiles {
+		if width != 0 && width < profile.Width &&
+			height != 0 && height < profile.Height {
+			continue
+		}
+
+		offered := hlsvod.VideoProfile{
+			Width:      profile.Width,
+			Height:     profile.Height,
+			Bitrate:    (profile.Bitrate + a.config.Vod.AudioProfile.Bitrate) / 100 * 105000,
+			VideoRange: profile.VideoRange,
+			HDCPLevel:  profile.HDCPLevel,
+		}
+
+		// players, that do not support HEVC, skip its renditions
+		if profile.Codec == hlsvod.CodecHEVC {
+			offered.Codecs = hlsvod.HEVCCodecs(profile.Width, profile.Height, 0, profile.Bitrate, len(data.Audio) > 0)
+		}
+
+		profiles[name] = offered
+	}
+
+	return profiles
+}
+
+type hlsVodSessionConfig struct {
+	mediaPath string
+	profileID string
+	profile   config.VideoProfile
+	preview   bool
+
+	audioOnly   bool // audio-only rendition of secondary audio stream
+	audioStream int
+
+	clipStart   float64
+	clipEnd     float64
+	audioOffset float64
+
+	subtitles      bool // burn subtitle stream into video
+	subtitleStream int
+
+	overlay string // text burned into video, empty means none
+}
+
+// returns ID of session, sessions of the same rendition are shared
+func hlsVodSessionID(c hlsVodSessionConfig) string {
+	ID := fmt.Sprintf("%s/%s", c.profileID, c.mediaPath)
+	if c.clipStart > 0 || c.clipEnd > 0 {
+		ID = fmt.Sprintf("%s/%s/clip-%g-%g", c.profileID, c.mediaPath, c.clipStart, c.clipEnd)
+	}
+	if c.audioOffset != 0 {
+		ID = fmt.Sprintf("%s?audio-offset=%g", ID, c.audioOffset)
+	}
+	if c.subtitles {
+		ID = fmt.Sprintf("%s?subtitles=%d", ID, c.subtitleStream)
+	}
+	if c.overlay != "" {
+		ID = fmt.Sprintf("%s?overlay=%s", ID, hlsVodOverlayID(c.overlay))
+	}
+
+	return ID
+}
+
+// returns existing vod session or creates and starts a new one
+func (a *ApiManagerCtx) hlsVodSession(ID string, c hlsVodSessionConfig) (hlsvod.Manager, error) {
+	hlsVodManagersMu.Lock()
+	defer hlsVodManagersMu.Unlock()
+
+	if manager, ok := hlsVodManagers[ID]; ok {
+		return manager, nil
+	}
+
+	// directory names do not reveal profile, if names are obfuscated
+	dirPattern := fmt.Sprintf("vod-%s-*", c.profileID)
+	if a.config.Vod.ObfuscateKey != "" {
+		dirPattern = "vod-*"
+	}
+
+	// create own transcoding directory
+	transcodeDir, err := os.MkdirTemp(a.config.Vod.TranscodeDir, dirPattern)
+	if err != nil {
+		return nil, fmt.Errorf("could not create temp dir: %w", err)
+	}
+
+	// create own transcoding directories on other volumes
+	transcodeDirs := []string{}
+	for _, dir := range a.config.Vod.TranscodeDirs {
+		transcodeDir, err := os.MkdirTemp(dir, dirPattern)
+		if err != nil {
+			return nil, fmt.Errorf("could not create temp dir: %w", err)
+		}
+
+		transcodeDirs = append(transcodeDirs, transcodeDir)
+	}
+
+	// create own memory directory, if enabled
+	var memoryDir string
+	if a.config.Vod.MemoryDir != "" {
+		memoryDir, err = os.MkdirTemp(a.config.Vod.MemoryDir, dirPattern)
 		if err != nil {
-			logger.Error().Err(err).Msg("Failed to unescape URL path")
-			http.Error(w, "Failed to unescape URL path", http.StatusBadRequest)
+			return nil, fmt.Errorf("could not create memory dir: %w", err)
+		}
+	}
+
+	// preview has no audio
+	var audioProfile *hlsvod.AudioProfile
+	if !c.preview {
+		audioProfile = &hlsvod.AudioProfile{
+			Bitrate: a.config.Vod.AudioProfile.Bitrate,
+		}
+	}
+
+	// audio-only rendition has no video
+	var videoProfile *hlsvod.VideoProfile
+	if !c.audioOnly {
+		videoProfile = &hlsvod.VideoProfile{
+			Width:   c.profile.Width,
+			Height:  c.profile.Height,
+			Bitrate: c.profile.Bitrate,
+			Preview: c.preview,
+			Preset:  c.profile.Preset,
+			Codec:   c.profile.Codec,
+			Format:  c.profile.SegmentFormat,
+		}
+	}
+
+	// validated in config, empty means default
+	maxLevel, _ := hlsvod.ParseLevel(a.config.Vod.MaxLevel)
+
+	// auto encoder is placed by encoder pool
+	encoder := c.profile.Encoder
+	if encoder == "auto" {
+		encoder = hlsvod.EncoderAuto
+	}
+
+	// encrypt segments, if enabled
+	var keyProvider hlsvod.KeyProvider
+	if a.config.Vod.Encryption {
+		keyProvider = a.keys
+	}
+
+	// segments are only remuxed from pre-encoded rendition, if it is ready
+	mediaPath, passthrough := c.mediaPath, c.profile.Passthrough
+	if mezzaninePath, ok := a.hlsVodMezzaninePath(c); ok {
+		mediaPath, passthrough = mezzaninePath, true
+	}
+
+	// create new manager, it is started upon the first playlist or segment
+	// request, so that sessions created by other requests do not probe media
+	var manager *hlsvod.LazyManager
+	manager = hlsvod.NewLazyManager(hlsvod.New(hlsvod.Config{
+		MediaPath:     mediaPath,
+		TranscodeDir:  transcodeDir,
+		MemoryDir:     memoryDir,
+		MemoryMax:     a.config.Vod.MemoryMax * 1024 * 1024,
+		SegmentPrefix: c.profileID,
+		SegmentsMax:   a.config.Vod.SegmentsMax,
+		OpenFiles:     a.config.Vod.OpenFiles,
+		TranscodeDirs: transcodeDirs,
+		Placement:     a.config.Vod.Placement,
+		ReadyTimeout:  a.config.Vod.ReadyTimeout,
+
+		ChunkedSegments: a.config.Vod.Chunked,
+		EventPlaylist:   a.config.Vod.EventPlaylist,
+
+		ClipStart: c.clipStart,
+		ClipEnd:   c.clipEnd,
+
+		Growing:     a.config.Vod.Growing,
+		GrowingPoll: a.config.Vod.GrowingPoll,
+		GrowingIdle: a.config.Vod.GrowingIdle,
+		SourceWatch: a.config.Vod.SourceWatch,
+
+		VideoProfile:   videoProfile,
+		VideoKeyframes: a.config.Vod.VideoKeyframes,
+		Breakpoints:    a.hlsVodBreakpoints(),
+		AudioProfile:   audioProfile,
+		AudioOffset:    c.audioOffset,
+		AudioStream:    c.audioStream,
+		BurnSubtitles:  c.subtitles,
+		SubtitleStream: c.subtitleStream,
+		Overlay:        a.overlay(c.overlay),
+		Passthrough:    passthrough,
+		Encoder:        encoder,
+		Encoders:       a.encoders,
+		MaxLevel:       maxLevel,
+
+		Cache:        a.config.Vod.Cache,
+		CacheDir:     a.config.Vod.CacheDir,
+		CacheStore:   a.cache,
+		ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+		SegmentKey:   []byte(a.config.Vod.SegmentKey),
+
+		FFmpegBinary:  a.config.Vod.FFmpegBinary,
+		FFprobeBinary: a.config.Vod.FFprobeBinary,
+		IONice:        a.config.Vod.IONice,
+
+		Transcoder:  a.hlsVodTranscoder(),
+		KeyProvider: keyProvider,
+
+		ErrorResponder: a.errors,
+
+		Session: ID,
+		Events:  a.events,
+
+		// session, that failed to get ready, is evicted right away, so that
+		// the next request starts it again instead of getting cached error
+		OnStop: func(err error) {
+			if err != nil {
+				a.quarantine.failed(c.mediaPath, err)
+				a.hlsVodSessionFailed(ID, manager, err)
+			}
+		},
+	}))
+
+	hlsVodManagers[ID] = manager
+	return manager, nil
+}
+
+// VariantResolver returns profiles offered in vod master playlist for
+// the request, if ok is false, all profiles are offered. Codec and segment
+// format are set by profiles, e.g. fMP4 HEVC profiles for Apple devices.
+type VariantResolver func(r *http.Request) (profiles []string, ok bool)
+
+// replaces variant resolver, by default variants from config are used
+func (a *ApiManagerCtx) SetVariantResolver(resolver VariantResolver) {
+	a.variants = resolver
+}
+
+// returns resolver matching User-Agent header against configured variants,
+// first matching variant is used, nil if there are no variants
+func hlsVodConfigVariants(variants []config.PlaylistVariant) VariantResolver {
+	if len(variants) == 0 {
+		return nil
+	}
+
+	type variant struct {
+		userAgent *regexp.Regexp
+		profiles  []string
+	}
+
+	compiled := []variant{}
+	for _, v := range variants {
+		compiled = append(compiled, variant{
+			userAgent: regexp.MustCompile(v.UserAgent),
+			profiles:  v.Profiles,
+		})
+	}
+
+	return func(r *http.Request) ([]string, bool) {
+		userAgent := r.UserAgent()
+		for _, v := range compiled {
+			if v.userAgent.MatchString(userAgent) {
+				return v.profiles, true
+			}
+		}
+
+		return nil, false
+	}
+}
+
+type hlsVodWarmJob struct {
+	mediaPath string
+	profileID string
+	ranges    []hlsvod.WarmRange
+	seek      bool // pre-transcode predicted seek destinations of played session
+}
+
+type hlsVodWarmRequest struct {
+	Profiles []string           `json:"profiles"`
+	Ranges   []hlsvod.WarmRange `json:"ranges"`
+}
+
+// queues background transcoding of media path for selected profiles and ranges,
+// if no profiles are specified, all configured profiles are used
+func (a *ApiManagerCtx) Warm(path string, profiles []string, ranges []hlsvod.WarmRange) error {
+	// use clean path, rooted so that it can not escape media dir
+	mediaPath := filepath.Join(a.config.Vod.MediaDir, filepath.Clean("/"+path))
+
+	if !hlsVodMediaExists(mediaPath) {
+		return os.ErrNotExist
+	}
+
+	if len(profiles) == 0 {
+		for profileID := range a.config.Vod.VideoProfiles {
+			profiles = append(profiles, profileID)
+		}
+	}
+
+	for _, profileID := range profiles {
+		if _, _, ok := a.hlsVodProfile(profileID); !ok {
+			return fmt.Errorf("profile %q not found", profileID)
+		}
+	}
+
+	for _, profileID := range profiles {
+		select {
+		case a.warm <- hlsVodWarmJob{mediaPath: mediaPath, profileID: profileID, ranges: ranges}:
+		default:
+			return errHlsVodWarmQueueFull
+		}
+	}
+
+	return nil
+}
+
+// processes warm jobs one by one, so that they do not compete with playback
+func (a *ApiManagerCtx) hlsVodWarmWorker() {
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "warm").Logger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.shutdown
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-a.shutdown:
 			return
+		case job := <-a.warm:
+			profile, preview, _ := a.hlsVodProfile(job.profileID)
+
+			ID := fmt.Sprintf("%s/%s", job.profileID, job.mediaPath)
+
+			// seek destinations are pre-transcoded only while session is played
+			ranges := job.ranges
+			if job.seek {
+				var ok bool
+				if ranges, ok = a.hlsVodSeekRanges(ctx, ID, job); !ok {
+					continue
+				}
+			}
+
+			manager, err := a.hlsVodSession(ID, hlsVodSessionConfig{
+				mediaPath: job.mediaPath,
+				profileID: job.profileID,
+				profile:   profile,
+				preview:   preview,
+			})
+			if err != nil {
+				logger.Warn().Err(err).Str("id", ID).Msg("hls vod manager could not be started")
+				continue
+			}
+
+			logger.Info().Str("id", ID).Interface("ranges", ranges).Msg("warming vod session")
+			if err := manager.Warm(ctx, ranges); err != nil {
+				logger.Warn().Err(err).Str("id", ID).Msg("warming vod session failed")
+				continue
+			}
+
+			logger.Info().Str("id", ID).Msg("warming vod session finished")
 		}
+	}
+}
+
+func (a *ApiManagerCtx) HlsVod(r chi.Router) {
+	r.Get("/vod-key/{id}", func(w http.ResponseWriter, r *http.Request) {
+		key, ok := a.keys.Key(chi.URLParam(r, "id"))
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "key not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(key.Key)
+	})
+
+	// measured throughput of requesting client
+	r.Get("/vod-bandwidth", func(w http.ResponseWriter, r *http.Request) {
+		estimate, sessions, ok := a.bandwidth.client(a.limiter.clientKey(r))
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "no throughput measured")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(struct {
+			bandwidthEstimate
+			Sessions map[string]bandwidthEstimate `json:"sessions"`
+		}{estimate, sessions})
+	})
+
+	r.Post("/vod/*", func(w http.ResponseWriter, r *http.Request) {
+		// remove /vod/ from path, it is already unescaped
+		urlPath := r.URL.Path[5:]
+
+		var req hlsVodWarmRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid request body")
+			return
+		}
+
+		if err := a.Warm(urlPath, req.Profiles, req.Ranges); err != nil {
+			if os.IsNotExist(err) {
+				a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "vod not found")
+				return
+			}
+
+			if errors.Is(err, errHlsVodWarmQueueFull) {
+				a.httpError(w, r, http.StatusServiceUnavailable, httperror.CodeUnavailable, err.Error())
+				return
+			}
+
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, err.Error())
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	// signature is verified also at CDN edge, query is propagated from
+	// playlists to segments
+	vod := r
+	if a.signer != nil {
+		vod = r.With(signedurl.Middleware(a.signer, a.errors))
+	}
+
+	vod.Get("/vod/*", func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().Str("module", "hlsvod").Logger()
+
+		// remove /vod/ from path, it is already unescaped, unescaping it
+		// again would let encoded dot segments pass signature check
+		urlPath := r.URL.Path[5:]
+		var err error
 
 		// get index of last slash from path
 		lastSlashIndex := strings.LastIndex(urlPath, "/")
 		if lastSlashIndex == -1 {
-			http.Error(w, "400 invalid parameters", http.StatusBadRequest)
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid parameters")
 			return
 		}
 
@@ -40,67 +851,326 @@ func (a *ApiManagerCtx) HlsVod(r chi.Router) {
 		hlsResource := urlPath[lastSlashIndex+1:]
 		// everything before last slash is vod media path
 		vodMediaPath := urlPath[:lastSlashIndex]
-		// use clean path
-		vodMediaPath = filepath.Clean(vodMediaPath)
-		vodMediaPath = path.Join(a.config.Vod.MediaDir, vodMediaPath)
 
-		// serve master profile
-		if hlsResource == "index.m3u8" {
+		// virtual clip is specified as last directory: [media-path]/clip-[start]-[end]/
+		var clipStart, clipEnd float64
+		if matches := hlsVodClipRegex.FindStringSubmatch(vodMediaPath); matches != nil {
+			clipStart, _ = strconv.ParseFloat(matches[2], 64)
+			clipEnd, _ = strconv.ParseFloat(matches[3], 64)
+			if clipEnd <= clipStart {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid clip range")
+				return
+			}
+
+			vodMediaPath = matches[1]
+		}
+
+		// audio sync correction in seconds, propagated to segments as query
+		var audioOffset float64
+		if value := r.URL.Query().Get("audio-offset"); value != "" {
+			audioOffset, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid audio offset")
+				return
+			}
+		}
+
+		// subtitle stream burned into video, propagated to segments as query
+		subtitleStream, subtitles := 0, false
+		if value := r.URL.Query().Get("subtitles"); value != "" && a.config.Vod.BurnSubtitles {
+			subtitleStream, err = strconv.Atoi(value)
+			if err != nil || subtitleStream < 0 {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid subtitle stream")
+				return
+			}
+
+			subtitles = true
+		}
+
+		// use clean path, rooted so that it can not escape media dir
+		vodMediaPath = filepath.Clean("/" + vodMediaPath)
+		overlayPath := vodMediaPath[1:]
+		vodMediaPath = filepath.Join(a.config.Vod.MediaDir, vodMediaPath)
+
+		// media, whose probe failed repeatedly, is not probed again
+		if !a.hlsVodQuarantineCheck(w, r, vodMediaPath) {
+			return
+		}
+
+		// serve audio waveform peaks
+		if hlsResource == "waveform.json" || hlsResource == "waveform.dat" {
+			samplesPerPixel := hlsVodWaveformSamplesPerPixel
+			if value := r.URL.Query().Get("samples-per-pixel"); value != "" {
+				samplesPerPixel, err = strconv.Atoi(value)
+				if err != nil || !hlsvod.ValidSamplesPerPixel(samplesPerPixel) {
+					a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid samples per pixel, use power of two between 32 and 8192")
+					return
+				}
+			}
+
+			if !hlsVodMediaExists(vodMediaPath) {
+				a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "vod not found")
+				return
+			}
+
+			waveform, err := hlsvod.New(hlsvod.Config{
+				MediaPath: vodMediaPath,
+
+				Cache:        a.config.Vod.Cache,
+				CacheDir:     a.config.Vod.CacheDir,
+				CacheStore:   a.cache,
+				ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+				SegmentKey:   []byte(a.config.Vod.SegmentKey),
+
+				FFmpegBinary:  a.config.Vod.FFmpegBinary,
+				FFprobeBinary: a.config.Vod.FFprobeBinary,
+			}).Waveform(r.Context(), samplesPerPixel)
+
+			if err != nil {
+				logger.Warn().Err(err).Msg("unable to generate waveform")
+				a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to generate waveform")
+				return
+			}
+
+			if hlsResource == "waveform.dat" {
+				w.Header().Set("Content-Type", "application/octet-stream")
+				_, _ = w.Write(waveform.MarshalDat())
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(waveform)
+			return
+		}
+
+		// serve probed media info
+		if hlsResource == "metadata.json" {
+			if !hlsVodMediaExists(vodMediaPath) {
+				a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "vod not found")
+				return
+			}
+
+			hlsvod.New(hlsvod.Config{
+				MediaPath:      vodMediaPath,
+				VideoKeyframes: a.config.Vod.VideoKeyframes,
+				Transcoder:     a.hlsVodTranscoder(),
+				Growing:        a.config.Vod.Growing,
+				GrowingIdle:    a.config.Vod.GrowingIdle,
+
+				Cache:        a.config.Vod.Cache,
+				CacheDir:     a.config.Vod.CacheDir,
+				CacheStore:   a.cache,
+				ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+				SegmentKey:   []byte(a.config.Vod.SegmentKey),
+				LanguageMap:  a.config.Vod.LanguageMap,
+
+				FFmpegBinary:  a.config.Vod.FFmpegBinary,
+				FFprobeBinary: a.config.Vod.FFprobeBinary,
+			}).ServeMetadata(w, r)
+			return
+		}
+
+		// serve master profile, or its JSON sidecar describing tracks
+		if hlsResource == "index.m3u8" || hlsResource == "index.json" {
 			data, err := hlsvod.New(hlsvod.Config{
 				MediaPath:      vodMediaPath,
 				VideoKeyframes: a.config.Vod.VideoKeyframes,
+				Transcoder:     a.hlsVodTranscoder(),
+				Growing:        a.config.Vod.Growing,
+				GrowingIdle:    a.config.Vod.GrowingIdle,
 
-				Cache:    a.config.Vod.Cache,
-				CacheDir: a.config.Vod.CacheDir,
+				Cache:        a.config.Vod.Cache,
+				CacheDir:     a.config.Vod.CacheDir,
+				CacheStore:   a.cache,
+				ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+				SegmentKey:   []byte(a.config.Vod.SegmentKey),
 
 				FFmpegBinary:  a.config.Vod.FFmpegBinary,
 				FFprobeBinary: a.config.Vod.FFprobeBinary,
 			}).Preload(r.Context())
 
+			a.hlsVodProbed(vodMediaPath, err)
 			if err != nil {
 				logger.Warn().Err(err).Msg("unable to preload metadata")
-				http.Error(w, "500 unable to preload metadata", http.StatusInternalServerError)
+				a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to preload metadata")
 				return
 			}
 
-			width, height := 0, 0
-			if data.Video != nil {
-				width, height = data.Video.Width, data.Video.Height
+			// clip end is clamped to media duration, but clip must start within it
+			if clipEnd > 0 && clipStart >= data.Duration.Seconds() {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid clip range")
+				return
 			}
 
-			profiles := map[string]hlsvod.VideoProfile{}
-			for name, profile := range a.config.Vod.VideoProfiles {
-				if width != 0 && width < profile.Width &&
-					height != 0 && height < profile.Height {
-					continue
+			profiles := a.hlsVodOfferedProfiles(r, data)
+
+			// propagate session query to profiles
+			segmentNameFmt := "%s.m3u8"
+			if r.URL.RawQuery != "" {
+				segmentNameFmt += "?" + strings.ReplaceAll(r.URL.RawQuery, "%", "%%")
+			}
+
+			// alternative audio renditions
+			opts := hlsvod.MasterPlaylistOptions{
+				Order: a.config.Vod.PlaylistOrder,
+			}
+			if a.config.Vod.SecondaryAudio {
+				opts.Audio = hlsVodAudioRenditions(data.Audio, a.hlsVodLanguages(r), a.config.Vod.LanguageMap)
+			}
+
+			// recognized bitmap subtitles
+			opts.Subtitles = a.hlsVodSubtitleRenditions(vodMediaPath, data.Subtitles)
+
+			// default audio depends on languages accepted by client
+			if a.config.Vod.AcceptLanguage {
+				w.Header().Add("Vary", "Accept-Language")
+			}
+
+			// offered profiles depend on client
+			if a.variants != nil {
+				w.Header().Add("Vary", "User-Agent")
+			}
+
+			// start with profile fitting client throughput, order is personal
+			// to client and must not be cached by shared caches
+			if a.config.Vod.AbrHint {
+				w.Header().Set("Cache-Control", "private, no-store")
+				if estimate, _, ok := a.bandwidth.client(a.limiter.clientKey(r)); ok {
+					opts.First = hlsVodStartProfile(profiles, estimate.Bandwidth)
+				}
+			}
+
+			if hlsResource == "index.json" {
+				duration := data.Duration.Seconds()
+				if clipEnd > 0 {
+					duration = math.Min(duration, clipEnd) - clipStart
 				}
 
-				profiles[name] = hlsvod.VideoProfile{
-					Width:   profile.Width,
-					Height:  profile.Height,
-					Bitrate: (profile.Bitrate + a.config.Vod.AudioProfile.Bitrate) / 100 * 105000,
+				sidecar := hlsvod.MasterSidecar(profiles, segmentNameFmt, duration, opts)
+				if _, _, ok := a.hlsVodProfile(hlsVodPreviewProfileID); ok && !data.AudioOnly() {
+					sidecar.Thumbnails = fmt.Sprintf(segmentNameFmt, hlsVodPreviewProfileID)
 				}
+
+				w.Header().Set("Content-Type", "application/json")
+				_ = json.NewEncoder(w).Encode(sidecar)
+				return
+			}
+
+			// renditions are listed for every host of content steering
+			if a.steering.enabled() {
+				opts.Steering = a.steering.playlist(r)
 			}
 
-			playlist := hlsvod.StreamsPlaylist(profiles, "%s.m3u8")
+			playlist := hlsvod.MasterPlaylist(profiles, segmentNameFmt, opts)
 			_, _ = w.Write([]byte(playlist))
 			return
 		}
 
+		// serve recognized bitmap subtitles
+		if matches := hlsVodSubtitlesRegex.FindStringSubmatch(hlsResource); matches != nil && a.config.Vod.SubtitlesDir != "" {
+			stream, _ := strconv.Atoi(matches[1])
+			subtitlesPath := a.hlsVodSubtitlesPath(vodMediaPath, stream)
+			if !hlsvod.SubtitleFresh(subtitlesPath, vodMediaPath) {
+				a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "subtitles not found")
+				return
+			}
+
+			if matches[2] == "vtt" {
+				w.Header().Set("Content-Type", "text/vtt")
+				http.ServeFile(w, r, subtitlesPath)
+				return
+			}
+
+			// single WebVTT file covers whole media
+			data, err := hlsvod.New(hlsvod.Config{
+				MediaPath:      vodMediaPath,
+				VideoKeyframes: a.config.Vod.VideoKeyframes,
+				Transcoder:     a.hlsVodTranscoder(),
+
+				Cache:        a.config.Vod.Cache,
+				CacheDir:     a.config.Vod.CacheDir,
+				CacheStore:   a.cache,
+				ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+				SegmentKey:   []byte(a.config.Vod.SegmentKey),
+
+				FFmpegBinary:  a.config.Vod.FFmpegBinary,
+				FFprobeBinary: a.config.Vod.FFprobeBinary,
+			}).Preload(r.Context())
+
+			a.hlsVodProbed(vodMediaPath, err)
+			if err != nil {
+				logger.Warn().Err(err).Msg("unable to preload metadata")
+				a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to preload metadata")
+				return
+			}
+
+			uri := matches[0][:len(matches[0])-len("m3u8")] + "vtt"
+			if r.URL.RawQuery != "" {
+				uri += "?" + r.URL.RawQuery
+			}
+
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			_, _ = w.Write([]byte(hlsvod.SubtitlePlaylist(data.Duration.Seconds(), uri)))
+			return
+		}
+
 		// get profile name (everythinb before . or -)
 		profileID := strings.FieldsFunc(hlsResource, func(r rune) bool {
 			return r == '.' || r == '-'
 		})[0]
 
 		// check if exists profile and fetch
-		profile, ok := a.config.Vod.VideoProfiles[profileID]
+		profile, preview, ok := a.hlsVodProfile(profileID)
+
+		// secondary audio stream is served as audio-only rendition
+		audioStream, audioOnly := 0, false
+		if !ok {
+			audioStream, audioOnly = a.hlsVodAudioProfile(profileID)
+			ok = audioOnly
+		}
+
 		if !ok {
-			http.Error(w, "404 profile not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "profile not found")
 			return
 		}
 
-		ID := fmt.Sprintf("%s/%s", profileID, vodMediaPath)
+		sessionConfig := hlsVodSessionConfig{
+			mediaPath:   vodMediaPath,
+			profileID:   profileID,
+			profile:     profile,
+			preview:     preview,
+			audioOnly:   audioOnly,
+			audioStream: audioStream,
+			clipStart:   clipStart,
+			clipEnd:     clipEnd,
+			audioOffset: audioOffset,
+
+			subtitles:      subtitles,
+			subtitleStream: subtitleStream,
+		}
+
+		// audio-only and preview renditions are shared by viewers
+		if !audioOnly && !preview {
+			sessionConfig.overlay = a.hlsVodOverlayText(r, overlayPath)
+		}
+
+		ID := hlsVodSessionID(sessionConfig)
+
+		hlsVodManagersMu.Lock()
 		manager, ok := hlsVodManagers[ID]
+		hlsVodManagersMu.Unlock()
+
+		// keep existing session alive
+		if hlsResource == profileID+".heartbeat" {
+			if !ok {
+				a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "vod session not found")
+				return
+			}
+
+			manager.Heartbeat()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
 
 		logger.Info().
 			Str("path", urlPath).
@@ -111,56 +1181,48 @@ func (a *ApiManagerCtx) HlsVod(r chi.Router) {
 		// if manager was not found
 		if !ok {
 			// check if vod media path exists
-			if _, err := os.Stat(vodMediaPath); os.IsNotExist(err) {
-				http.Error(w, "404 vod not found", http.StatusNotFound)
+			if !hlsVodMediaExists(vodMediaPath) {
+				a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "vod not found")
 				return
 			}
 
-			// create own transcoding directory
-			transcodeDir, err := os.MkdirTemp(a.config.Vod.TranscodeDir, fmt.Sprintf("vod-%s-*", profileID))
-			if err != nil {
-				logger.Warn().Err(err).Msg("could not create temp dir")
-				http.Error(w, "500 could not create temp dir", http.StatusInternalServerError)
+			// session is attributed to client, that starts it
+			if err := a.limiter.acquire(r, ID); err != nil {
+				logger.Warn().Err(err).Str("id", ID).Msg("session limit reached")
+				a.limiter.httpError(w, r, err, a.errors)
 				return
 			}
 
-			// create new manager
-			manager = hlsvod.New(hlsvod.Config{
-				MediaPath:     vodMediaPath,
-				TranscodeDir:  transcodeDir,
-				SegmentPrefix: profileID,
-
-				VideoProfile: &hlsvod.VideoProfile{
-					Width:   profile.Width,
-					Height:  profile.Height,
-					Bitrate: profile.Bitrate,
-				},
-				VideoKeyframes: a.config.Vod.VideoKeyframes,
-				AudioProfile: &hlsvod.AudioProfile{
-					Bitrate: a.config.Vod.AudioProfile.Bitrate,
-				},
-
-				Cache:    a.config.Vod.Cache,
-				CacheDir: a.config.Vod.CacheDir,
-
-				FFmpegBinary:  a.config.Vod.FFmpegBinary,
-				FFprobeBinary: a.config.Vod.FFprobeBinary,
-			})
-
-			hlsVodManagers[ID] = manager
-
-			if err := manager.Start(); err != nil {
+			manager, err = a.hlsVodSession(ID, sessionConfig)
+			if err != nil {
+				a.limiter.release(ID)
 				logger.Warn().Err(err).Msg("hls vod manager could not be started")
-				http.Error(w, "500 hls vod manager could not be started", http.StatusInternalServerError)
+				a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "hls vod manager could not be started")
 				return
 			}
+
+			// likely seek destinations of whole media are pre-transcoded
+			// in background, while it is played
+			if a.config.Vod.SeekPrefetch > 0 && !preview && !audioOnly && ID == hlsVodSessionID(hlsVodSessionConfig{mediaPath: vodMediaPath, profileID: profileID}) {
+				a.hlsVodSeekPredict(vodMediaPath, profileID)
+			}
 		}
 
-		// server playlist or segment
+		// server playlist, segment statistics or segment
 		if hlsResource == profileID+".m3u8" {
 			manager.ServePlaylist(w, r)
+		} else if hlsResource == profileID+".json" {
+			manager.ServeStats(w, r)
 		} else {
-			manager.ServeMedia(w, r)
+			// bytes served are counted into quota of client
+			if w, ok := a.quotaResponse(w, r, ID); ok {
+				a.withBandwidth(w, r, ID, manager.ServeMedia)
+			}
+
+			// thumbnail scrubbing predicts, where viewer is going to seek
+			if a.config.Vod.SeekPrefetch > 0 && preview && ID == hlsVodSessionID(hlsVodSessionConfig{mediaPath: vodMediaPath, profileID: profileID}) {
+				a.hlsVodSeekScrub(manager, hlsResource, vodMediaPath)
+			}
 		}
 	})
 }
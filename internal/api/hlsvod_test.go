@@ -0,0 +1,102 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/internal/config"
+)
+
+func TestHlsVodOfferedProfiles(t *testing.T) {
+	manager := New(&config.Server{
+		Vod: config.VOD{
+			VideoProfiles: map[string]config.VideoProfile{
+				"360p":  {Width: 640, Height: 360, Bitrate: 800},
+				"1080p": {Width: 1920, Height: 1080, Bitrate: 3500, Codec: hlsvod.CodecHEVC, SegmentFormat: hlsvod.SegmentFormatFMP4},
+			},
+			Variants: []config.PlaylistVariant{
+				{UserAgent: "iPhone", Profiles: []string{"1080p"}},
+				{UserAgent: "Unknown", Profiles: []string{"unknown"}},
+			},
+		},
+	})
+
+	// 720p source does not fit 1080p profile
+	data := &hlsvod.ProbeMediaData{
+		Video: &hlsvod.ProbeVideoData{Width: 1280, Height: 720},
+	}
+
+	tests := []struct {
+		userAgent string
+		want      []string
+	}{
+		{"Firefox", []string{"360p"}},
+		{"iPhone", []string{"360p"}},
+		{"Unknown", []string{"360p"}},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.Header.Set("User-Agent", test.userAgent)
+
+		profiles := manager.hlsVodOfferedProfiles(r, data)
+		if len(profiles) != len(test.want) {
+			t.Errorf("%s: offered profiles = %v, want %v", test.userAgent, profiles, test.want)
+			continue
+		}
+
+		for _, name := range test.want {
+			if _, ok := profiles[name]; !ok {
+				t.Errorf("%s: offered profiles = %v, want %v", test.userAgent, profiles, test.want)
+			}
+		}
+	}
+
+	// variant is used, if its profiles fit source, HEVC profile lists codecs
+	data.Video.Width, data.Video.Height = 1920, 1080
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("User-Agent", "iPhone")
+	if profiles := manager.hlsVodOfferedProfiles(r, data); len(profiles) != 1 || profiles["1080p"].Codecs != "hvc1.1.6.L120.B0" {
+		t.Errorf("iPhone: offered profiles = %v, want [1080p] with HEVC codecs", profiles)
+	}
+}
+
+func TestHlsVodMasterPlaylistAbrHint(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "movie.mp4"), []byte("movie"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manager := New(&config.Server{
+		Vod: config.VOD{
+			MediaDir:     dir,
+			TranscodeDir: t.TempDir(),
+			Transcoder:   "fake",
+			VideoProfiles: map[string]config.VideoProfile{
+				"360p": {Width: 640, Height: 360, Bitrate: 800},
+			},
+			AbrHint: true,
+		},
+	})
+
+	router := chi.NewRouter()
+	manager.Mount(router)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/vod/movie.mp4/index.m3u8", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	if cacheControl := rec.Header().Get("Cache-Control"); cacheControl != "private, no-store" {
+		t.Errorf("Cache-Control = %q, want %q", cacheControl, "private, no-store")
+	}
+}
@@ -1,13 +1,17 @@
 package api
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"os/exec"
 
 	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
 	"github.com/rs/zerolog/log"
 
+	"github.com/m1k1o/go-transcode/hls"
+	"github.com/m1k1o/go-transcode/httperror"
 	"github.com/m1k1o/go-transcode/internal/utils"
 )
 
@@ -35,12 +39,49 @@ func (a *ApiManagerCtx) Http(r chi.Router) {
 			write.Close()
 		}()
 
+		// program is killed, when client disconnects
 		go func() {
-			_ = cmd.Run()
+			_ = utils.ProcessGroupRun(r.Context(), cmd)
 		}()
 		_, _ = io.Copy(w, read)
 	})
 
+	// generated test pattern, that is used as stream source by profiles
+	r.Get("/testsrc/{input}.ts", func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().
+			Str("path", r.URL.Path).
+			Str("module", "ffmpeg").
+			Logger()
+
+		input := chi.URLParam(r, "input")
+
+		pattern, ok, err := hls.ParseTestPattern(a.config.Streams[input])
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "test pattern not found")
+			return
+		}
+
+		if err != nil {
+			logger.Warn().Err(err).Msg("invalid test pattern")
+			a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "invalid test pattern")
+			return
+		}
+
+		// generator runs as long as profile reads it
+		cmd := pattern.Cmd(r.Context(), a.config.Vod.FFmpegBinary)
+		logger.Info().Str("input", input).Msg("test pattern started")
+		w.Header().Set("Content-Type", "video/mp2t")
+
+		read, write := io.Pipe()
+		cmd.Stdout = write
+		cmd.Stderr = utils.LogWriter(logger)
+
+		go utils.IOPipeToHTTP(w, read)
+		_ = utils.ProcessGroupRun(r.Context(), cmd)
+		write.Close()
+		logger.Info().Str("input", input).Msg("test pattern stopped")
+	})
+
 	r.Get("/{profile}/{input}", func(w http.ResponseWriter, r *http.Request) {
 		logger := log.With().
 			Str("path", r.URL.Path).
@@ -53,7 +94,7 @@ func (a *ApiManagerCtx) Http(r chi.Router) {
 		// check if stream exists
 		_, ok := a.config.Streams[input]
 		if !ok {
-			http.Error(w, "404 stream not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "stream not found")
 			return
 		}
 
@@ -61,14 +102,37 @@ func (a *ApiManagerCtx) Http(r chi.Router) {
 		profilePath, err := a.ProfilePath("hls", profile)
 		if err != nil {
 			logger.Warn().Err(err).Msg("profile path could not be found")
-			http.Error(w, "404 profile not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "profile not found")
+			return
+		}
+
+		// every request is a separate session
+		ID := fmt.Sprintf("http/%s", middleware.GetReqID(r.Context()))
+		if err := a.limiter.acquire(r, ID); err != nil {
+			logger.Warn().Err(err).Msg("session limit reached")
+			a.limiter.httpError(w, r, err, a.errors)
+			return
+		}
+		defer a.limiter.release(ID)
+
+		// bytes streamed are counted into quota of client
+		w, ok = a.quotaResponse(w, r, ID)
+		if !ok {
+			return
+		}
+		defer a.quotas.release(ID)
+
+		inputArgs, err := a.inputArgs(r, input)
+		if err != nil {
+			logger.Warn().Err(err).Msg("invalid input options")
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid input options")
 			return
 		}
 
-		cmd, err := a.transcodeStart(profilePath, input)
+		cmd, err := a.transcodeStart(profilePath, input, inputArgs)
 		if err != nil {
 			logger.Warn().Err(err).Msg("transcode could not be started")
-			http.Error(w, "500 not available", http.StatusInternalServerError)
+			a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "not available")
 			return
 		}
 
@@ -86,8 +150,9 @@ func (a *ApiManagerCtx) Http(r chi.Router) {
 			write.Close()
 		}()
 
+		// program is killed, when client disconnects
 		go func() {
-			_ = cmd.Run()
+			_ = utils.ProcessGroupRun(r.Context(), cmd)
 		}()
 		_, _ = io.Copy(w, read)
 	})
@@ -105,7 +170,7 @@ func (a *ApiManagerCtx) Http(r chi.Router) {
 		// check if stream exists
 		_, ok := a.config.Streams[input]
 		if !ok {
-			http.Error(w, "404 stream not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "stream not found")
 			return
 		}
 
@@ -113,14 +178,37 @@ func (a *ApiManagerCtx) Http(r chi.Router) {
 		profilePath, err := a.ProfilePath("hls", profile)
 		if err != nil {
 			logger.Warn().Err(err).Msg("profile path could not be found")
-			http.Error(w, "404 profile not found", http.StatusNotFound)
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "profile not found")
+			return
+		}
+
+		// every request is a separate session
+		ID := fmt.Sprintf("http/%s", middleware.GetReqID(r.Context()))
+		if err := a.limiter.acquire(r, ID); err != nil {
+			logger.Warn().Err(err).Msg("session limit reached")
+			a.limiter.httpError(w, r, err, a.errors)
+			return
+		}
+		defer a.limiter.release(ID)
+
+		// bytes streamed are counted into quota of client
+		w, ok = a.quotaResponse(w, r, ID)
+		if !ok {
+			return
+		}
+		defer a.quotas.release(ID)
+
+		inputArgs, err := a.inputArgs(r, input)
+		if err != nil {
+			logger.Warn().Err(err).Msg("invalid input options")
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid input options")
 			return
 		}
 
-		cmd, err := a.transcodeStart(profilePath, input)
+		cmd, err := a.transcodeStart(profilePath, input, inputArgs)
 		if err != nil {
 			logger.Warn().Err(err).Msg("transcode could not be started")
-			http.Error(w, "500 not available", http.StatusInternalServerError)
+			a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "not available")
 			return
 		}
 
@@ -132,7 +220,7 @@ func (a *ApiManagerCtx) Http(r chi.Router) {
 		cmd.Stderr = utils.LogWriter(logger)
 
 		go utils.IOPipeToHTTP(w, read)
-		_ = cmd.Run()
+		_ = utils.ProcessGroupRun(r.Context(), cmd)
 		write.Close()
 		logger.Info().Msg("command stopped")
 	})
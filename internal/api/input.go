@@ -0,0 +1,68 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// InputOptions are ffmpeg input options of live session without leading dash
+// (e.g. headers, stream_loop), empty value means option without value (e.g. re).
+type InputOptions map[string]string
+
+// InputOptionsResolver returns input options of live session started by the
+// request, options not allowed by configuration are rejected
+type InputOptionsResolver func(r *http.Request, input string) (InputOptions, error)
+
+// replaces input options resolver, by default options from config are used
+func (a *ApiManagerCtx) SetInputOptionsResolver(resolver InputOptionsResolver) {
+	a.inputs = resolver
+}
+
+// returns resolver of static input options of streams from config
+func inputConfigOptions(streams map[string]map[string]string) InputOptionsResolver {
+	return func(r *http.Request, input string) (InputOptions, error) {
+		return streams[input], nil
+	}
+}
+
+// returns validated ffmpeg arguments placed before input of live session
+func (a *ApiManagerCtx) inputArgs(r *http.Request, input string) ([]string, error) {
+	options, err := a.inputs(r, input)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range a.config.InputOptions.Allow {
+		allowed[name] = true
+	}
+
+	names := []string{}
+	for name, value := range options {
+		if !allowed[name] {
+			return nil, fmt.Errorf("input option %q is not allowed", name)
+		}
+
+		// only headers are separated by line breaks
+		if strings.ContainsRune(value, 0) || (name != "headers" && strings.ContainsAny(value, "\r\n")) {
+			return nil, fmt.Errorf("input option %q has invalid value", name)
+		}
+
+		names = append(names, name)
+	}
+
+	// stable order of arguments
+	sort.Strings(names)
+
+	args := []string{}
+	for _, name := range names {
+		args = append(args, "-"+name)
+		if value := options[name]; value != "" {
+			args = append(args, value)
+		}
+	}
+
+	return args, nil
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+// returns primary language subtag as ISO 639-1 code if it is known,
+// e.g. en-US, eng, english and en are all en
+func languagePrimary(tag string) string {
+	tag = hlsvod.NormalizeLanguage(tag, nil)
+	if i := strings.IndexByte(tag, '-'); i >= 0 {
+		tag = tag[:i]
+	}
+
+	return tag
+}
+
+// returns true if media language tag matches preferred language
+func languageMatches(tag, preferred string) bool {
+	tag = languagePrimary(tag)
+	if tag == "" {
+		return false
+	}
+
+	return tag == languagePrimary(preferred)
+}
+
+// returns languages of Accept-Language header ordered by their quality
+func parseAcceptLanguage(header string) []string {
+	type language struct {
+		tag     string
+		quality float64
+	}
+
+	languages := []language{}
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+
+		tag := strings.TrimSpace(params[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if !strings.HasPrefix(param, "q=") {
+				continue
+			}
+
+			if q, err := strconv.ParseFloat(param[2:], 64); err == nil {
+				quality = q
+			}
+		}
+
+		if quality > 0 {
+			languages = append(languages, language{tag, quality})
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	tags := make([]string, len(languages))
+	for i, l := range languages {
+		tags[i] = l.tag
+	}
+
+	return tags
+}
+
+// returns preferred languages of request followed by configured ones
+func (a *ApiManagerCtx) hlsVodLanguages(r *http.Request) []string {
+	languages := []string{}
+	if a.config.Vod.AcceptLanguage {
+		languages = append(languages, parseAcceptLanguage(r.Header.Get("Accept-Language"))...)
+	}
+
+	return append(languages, a.config.Vod.Languages...)
+}
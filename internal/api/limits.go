@@ -0,0 +1,138 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/internal/config"
+)
+
+// window for counting new sessions
+const limitsNewSessionsWindow = time.Minute
+
+// limits sessions started by a single client, that is identified by its IP or token
+type sessionLimiter struct {
+	config config.Limits
+
+	mu       sync.Mutex
+	sessions map[string]string      // map of session IDs and client keys
+	active   map[string]int         // map of client keys and their active sessions
+	started  map[string][]time.Time // map of client keys and their recently started sessions
+}
+
+func newSessionLimiter(config config.Limits) *sessionLimiter {
+	return &sessionLimiter{
+		config:   config,
+		sessions: map[string]string{},
+		active:   map[string]int{},
+		started:  map[string][]time.Time{},
+	}
+}
+
+// returns client key, token is used if configured and present, otherwise IP
+func (l *sessionLimiter) clientKey(r *http.Request) string {
+	if l.config.Key == "token" {
+		token := r.Header.Get(l.config.TokenHeader)
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if token != "" {
+			return "token:" + token
+		}
+	}
+
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		ip = r.RemoteAddr
+	}
+
+	return "ip:" + ip
+}
+
+// registers session for client, if session is already active, nothing happens
+func (l *sessionLimiter) acquire(r *http.Request, ID string) error {
+	if l.config.MaxSessions <= 0 && l.config.MaxNewSessions <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, ok := l.sessions[ID]; ok {
+		return nil
+	}
+
+	key := l.clientKey(r)
+
+	if l.config.MaxSessions > 0 && l.active[key] >= l.config.MaxSessions {
+		return fmt.Errorf("maximum of %d simultaneous sessions reached", l.config.MaxSessions)
+	}
+
+	// drop starts outside of window
+	now := time.Now()
+	started := l.started[key][:0]
+	for _, t := range l.started[key] {
+		if now.Sub(t) < limitsNewSessionsWindow {
+			started = append(started, t)
+		}
+	}
+	l.started[key] = started
+
+	if l.config.MaxNewSessions > 0 && len(started) >= l.config.MaxNewSessions {
+		return fmt.Errorf("maximum of %d new sessions per minute reached", l.config.MaxNewSessions)
+	}
+
+	l.sessions[ID] = key
+	l.active[key]++
+	l.started[key] = append(started, now)
+	return nil
+}
+
+// unregisters session, when it stops
+func (l *sessionLimiter) release(ID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	key, ok := l.sessions[ID]
+	if !ok {
+		return
+	}
+
+	delete(l.sessions, ID)
+	l.active[key]--
+	if l.active[key] <= 0 {
+		delete(l.active, key)
+	}
+}
+
+// drops clients without active sessions and recent starts
+func (l *sessionLimiter) cleanup() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key, started := range l.started {
+		if _, ok := l.active[key]; ok {
+			continue
+		}
+
+		if len(started) == 0 || now.Sub(started[len(started)-1]) >= limitsNewSessionsWindow {
+			delete(l.started, key)
+		}
+	}
+}
+
+// writes configured response for rejected session using error responder
+func (l *sessionLimiter) httpError(w http.ResponseWriter, r *http.Request, err error, responder httperror.Responder) {
+	message := l.config.Message
+	if message == "" {
+		message = err.Error()
+	}
+
+	e := httperror.New(r, l.config.Status, httperror.CodeRateLimited, message)
+	e.WithRetry(time.Duration(l.config.RetryAfter)*time.Second).Write(w, r, responder)
+}
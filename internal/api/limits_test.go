@@ -0,0 +1,77 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/internal/config"
+)
+
+func TestSessionLimiter(t *testing.T) {
+	limiter := newSessionLimiter(config.Limits{MaxSessions: 2})
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	if err := limiter.acquire(r, "a"); err != nil {
+		t.Fatalf("acquire(a) = %v", err)
+	}
+	if err := limiter.acquire(r, "b"); err != nil {
+		t.Fatalf("acquire(b) = %v", err)
+	}
+
+	// already active session is not counted again
+	if err := limiter.acquire(r, "a"); err != nil {
+		t.Errorf("acquire(a) again = %v", err)
+	}
+
+	if err := limiter.acquire(r, "c"); err == nil {
+		t.Errorf("acquire(c) over limit succeeded")
+	}
+
+	// other clients are not affected
+	other := httptest.NewRequest(http.MethodGet, "/", nil)
+	other.RemoteAddr = "10.0.0.2:1234"
+	if err := limiter.acquire(other, "d"); err != nil {
+		t.Errorf("acquire(d) by other client = %v", err)
+	}
+
+	limiter.release("a")
+	limiter.release("a")
+	if err := limiter.acquire(r, "c"); err != nil {
+		t.Errorf("acquire(c) after release = %v", err)
+	}
+
+	if err := limiter.acquire(r, "e"); err == nil {
+		t.Errorf("acquire(e) over limit succeeded")
+	}
+}
+
+func TestSessionLimiterStoppedEvents(t *testing.T) {
+	manager := New(&config.Server{
+		Limits: config.Limits{MaxSessions: 1},
+	})
+	manager.Start()
+	defer func() {
+		_ = manager.Shutdown()
+	}()
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+
+	// stop events of a burst must release all sessions
+	for i := 0; i < 1000; i++ {
+		ID := "session"
+		if i%2 == 1 {
+			ID = "other"
+		}
+
+		if err := manager.limiter.acquire(r, ID); err != nil {
+			t.Fatalf("acquire %d = %v", i, err)
+		}
+
+		manager.events.Publish(events.SessionStopped{Session: ID})
+	}
+}
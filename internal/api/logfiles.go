@@ -0,0 +1,127 @@
+package api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"regexp"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+var logFileUnsafeRegex = regexp.MustCompile(`[^0-9A-Za-z_.-]+`)
+
+// sessionLogFiles persists command logs of sessions to rotating files, so
+// that failed encodes can be debugged after sessions are gone
+type sessionLogFiles struct {
+	config config.SessionLogs
+
+	mu   sync.Mutex
+	logs map[string]*utils.RotatingLog // sessions with open log file
+}
+
+func newSessionLogFiles(config config.SessionLogs) *sessionLogFiles {
+	return &sessionLogFiles{
+		config: config,
+		logs:   map[string]*utils.RotatingLog{},
+	}
+}
+
+// returns file name of session log, session IDs contain paths, so that
+// readable part is sanitized and hash keeps names unique
+func sessionLogName(session string) string {
+	hash := sha1.Sum([]byte(session))
+	name := logFileUnsafeRegex.ReplaceAllString(session, "_")
+	if len(name) > 64 {
+		name = name[len(name)-64:]
+	}
+
+	return name + "-" + hex.EncodeToString(hash[:4])
+}
+
+func (f *sessionLogFiles) log(session string) *utils.RotatingLog {
+	return &utils.RotatingLog{
+		Dir:      f.config.Dir,
+		Name:     sessionLogName(session),
+		MaxSize:  f.config.MaxSize * 1024 * 1024,
+		MaxAge:   f.config.MaxAge,
+		MaxFiles: f.config.MaxFiles,
+	}
+}
+
+// returns log of session, its file is kept open until session stops
+func (f *sessionLogFiles) get(session string) *utils.RotatingLog {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if l, ok := f.logs[session]; ok {
+		return l
+	}
+
+	l := f.log(session)
+	f.logs[session] = l
+	return l
+}
+
+// returns log of session for reading, session does not need to exist anymore
+func (f *sessionLogFiles) find(session string) *utils.RotatingLog {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if l, ok := f.logs[session]; ok {
+		return l
+	}
+
+	return f.log(session)
+}
+
+func (f *sessionLogFiles) close(session string) {
+	f.mu.Lock()
+	l, ok := f.logs[session]
+	delete(f.logs, session)
+	f.mu.Unlock()
+
+	if ok {
+		_ = l.Close()
+	}
+}
+
+func (f *sessionLogFiles) closeAll() {
+	f.mu.Lock()
+	logs := f.logs
+	f.logs = map[string]*utils.RotatingLog{}
+	f.mu.Unlock()
+
+	for _, l := range logs {
+		_ = l.Close()
+	}
+}
+
+// writes logs of sessions to files until shutdown
+func (a *ApiManagerCtx) collectLogFiles() {
+	logger := log.With().Str("module", "api").Str("submodule", "logfiles").Logger()
+
+	logs, unsubscribe := a.events.Subscribe(1024, events.CmdLogType, events.SessionStoppedType)
+	defer unsubscribe()
+	defer a.logFiles.closeAll()
+
+	for {
+		select {
+		case <-a.shutdown:
+			return
+		case event := <-logs:
+			switch e := event.(type) {
+			case events.CmdLog:
+				if _, err := a.logFiles.get(e.Session).Write([]byte(e.Message + "\n")); err != nil {
+					logger.Warn().Err(err).Str("session", e.Session).Msg("unable to write session log")
+				}
+			case events.SessionStopped:
+				a.logFiles.close(e.Session)
+			}
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package api
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+const hlsVodMezzanineQueueSize = 64
+
+type hlsVodMezzanineJob struct {
+	mediaPath string
+	profileID string
+	path      string
+}
+
+// background queue of mezzanine encodes, every rendition is queued at most once
+type hlsVodMezzanine struct {
+	jobs chan hlsVodMezzanineJob
+
+	pendingMu sync.Mutex
+	pending   map[string]bool
+}
+
+func newHlsVodMezzanine() *hlsVodMezzanine {
+	return &hlsVodMezzanine{
+		jobs:    make(chan hlsVodMezzanineJob, hlsVodMezzanineQueueSize),
+		pending: map[string]bool{},
+	}
+}
+
+// queues job unless it is already pending or queue is full
+func (q *hlsVodMezzanine) enqueue(job hlsVodMezzanineJob) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	if q.pending[job.path] {
+		return
+	}
+
+	select {
+	case q.jobs <- job:
+		q.pending[job.path] = true
+	default:
+	}
+}
+
+func (q *hlsVodMezzanine) done(job hlsVodMezzanineJob) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	delete(q.pending, job.path)
+}
+
+// returns mezzanine of session rendition, if it is ready, otherwise it is
+// queued for encoding and session transcodes from media as usual
+func (a *ApiManagerCtx) hlsVodMezzaninePath(c hlsVodSessionConfig) (string, bool) {
+	if a.config.Vod.MezzanineDir == "" {
+		return "", false
+	}
+
+	// only plain H.264 renditions of whole video files are pre-encoded
+	if c.preview || c.audioOnly || c.subtitles || c.audioOffset != 0 || c.profile.Codec == hlsvod.CodecHEVC {
+		return "", false
+	}
+
+	if hlsvod.ImageSequence(c.mediaPath) || hlsvod.ImageAnimation(c.mediaPath) {
+		return "", false
+	}
+
+	// media, that is still being written, would be encoded over and over
+	if a.config.Vod.Growing {
+		growingIdle := a.config.Vod.GrowingIdle
+		if growingIdle <= 0 {
+			growingIdle = time.Minute
+		}
+
+		fi, err := os.Stat(c.mediaPath)
+		if err != nil || time.Since(fi.ModTime()) < growingIdle {
+			return "", false
+		}
+	}
+
+	path := filepath.Join(a.config.Vod.MezzanineDir, hlsvod.MezzanineFileName(c.mediaPath, c.profileID))
+	if hlsvod.MezzanineFresh(path, c.mediaPath) {
+		return path, true
+	}
+
+	a.mezzanine.enqueue(hlsVodMezzanineJob{
+		mediaPath: c.mediaPath,
+		profileID: c.profileID,
+		path:      path,
+	})
+
+	return "", false
+}
+
+// encodes mezzanine files one by one, so that they do not compete with playback
+func (a *ApiManagerCtx) hlsVodMezzanineWorker() {
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "mezzanine").Logger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.shutdown
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-a.shutdown:
+			return
+		case job := <-a.mezzanine.jobs:
+			// jobs paused by admin API wait here
+			if err := a.jobs.Wait(ctx); err != nil {
+				a.mezzanine.done(job)
+				return
+			}
+
+			profile, _, ok := a.hlsVodProfile(job.profileID)
+			if !ok {
+				a.mezzanine.done(job)
+				continue
+			}
+
+			// might have been encoded by previous job
+			if hlsvod.MezzanineFresh(job.path, job.mediaPath) {
+				a.mezzanine.done(job)
+				continue
+			}
+
+			logger.Info().Str("media", job.mediaPath).Str("profile", job.profileID).Msg("encoding mezzanine")
+			err := hlsvod.EncodeMezzanine(ctx, a.config.Vod.FFmpegBinary, hlsvod.MezzanineConfig{
+				InputFilePath:  job.mediaPath,
+				OutputFilePath: job.path,
+				VideoProfile: &hlsvod.VideoProfile{
+					Width:   profile.Width,
+					Height:  profile.Height,
+					Bitrate: profile.Bitrate,
+				},
+				AudioProfile: &hlsvod.AudioProfile{
+					Bitrate: a.config.Vod.AudioProfile.Bitrate,
+				},
+				IONice:  true,
+				Control: a.jobs,
+			})
+			a.mezzanine.done(job)
+
+			if err != nil {
+				logger.Warn().Err(err).Str("media", job.mediaPath).Str("profile", job.profileID).Msg("encoding mezzanine failed")
+				continue
+			}
+
+			logger.Info().Str("media", job.mediaPath).Str("profile", job.profileID).Msg("encoding mezzanine finished")
+		}
+	}
+}
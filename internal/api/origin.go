@@ -0,0 +1,52 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// error code of requests, that did not come through CDN
+const originForbiddenCode = "origin-forbidden"
+
+// returns true, if media routes are protected from direct access
+func (a *ApiManagerCtx) originProtected() bool {
+	return a.config.OriginProtection.Secret != "" || a.config.OriginProtection.ClientCA != ""
+}
+
+// rejects requests without shared secret header or verified client
+// certificate, so that media is served only through CDN
+func (a *ApiManagerCtx) originProtection(next http.Handler) http.Handler {
+	c := a.config.OriginProtection
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.Secret != "" {
+			secret := r.Header.Get(c.Header)
+			if secret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(c.Secret)) == 1 {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		// certificate is verified against client CAs by TLS server
+		if c.ClientCA != "" && r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		a.httpError(w, r, http.StatusForbidden, originForbiddenCode, "direct access to origin is forbidden")
+	})
+}
+
+// returns routes protected from direct access, if enabled
+func (a *ApiManagerCtx) originGroup(routes func(r chi.Router)) func(r chi.Router) {
+	if !a.originProtected() {
+		return routes
+	}
+
+	return func(r chi.Router) {
+		r.Use(a.originProtection)
+		routes(r)
+	}
+}
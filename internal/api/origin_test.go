@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+
+	"github.com/m1k1o/go-transcode/internal/config"
+)
+
+func TestOriginProtectionRoutes(t *testing.T) {
+	dir := t.TempDir()
+
+	manager := New(&config.Server{
+		Vod: config.VOD{
+			MediaDir:   dir,
+			ExportDir:  dir,
+			Transcoder: "fake",
+		},
+		HlsProxy: map[string]string{"source": "http://127.0.0.1:1/"},
+		OriginProtection: config.OriginProtection{
+			Header: "X-Origin-Secret",
+			Secret: "secret",
+		},
+	})
+
+	router := chi.NewRouter()
+	manager.Mount(router)
+
+	routes := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/vod/movie.mp4/index.m3u8"},
+		{http.MethodGet, "/play/movie.mp4"},
+		{http.MethodPost, "/export/movie.mp4"},
+		{http.MethodGet, "/hlsproxy/source/index.m3u8"},
+		{http.MethodGet, "/hls/input/index.m3u8"},
+		{http.MethodGet, "/dash/hls/input/manifest.mpd"},
+		{http.MethodGet, "/http/input"},
+	}
+
+	for _, route := range routes {
+		req := httptest.NewRequest(route.method, route.path, nil)
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s without origin secret = %d, want %d", route.method, route.path, rec.Code, http.StatusForbidden)
+		}
+	}
+
+	// ping is not a media route
+	req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("GET /ping without origin secret = %d, want %d", rec.Code, http.StatusOK)
+	}
+}
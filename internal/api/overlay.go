@@ -0,0 +1,87 @@
+package api
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+// OverlayViewerResolver returns viewer, whose identity is burned into VOD
+// renditions as {viewer} of overlay text
+type OverlayViewerResolver func(r *http.Request) string
+
+// replaces overlay viewer resolver, by default client is identified the
+// same way as by session limits (token or address), as short hash of it
+func (a *ApiManagerCtx) SetOverlayViewerResolver(resolver OverlayViewerResolver) {
+	a.overlayViewer = resolver
+}
+
+// returns resolver of viewer identified by session limits, key is hashed, so
+// that token used as credential is not burned into video in plain text, it
+// can still be matched by hashing known keys
+func overlayLimitsViewer(limiter *sessionLimiter) OverlayViewerResolver {
+	return func(r *http.Request) string {
+		key := limiter.clientKey(r)
+		hash := sha256.Sum256([]byte(key[strings.Index(key, ":")+1:]))
+		return hex.EncodeToString(hash[:6])
+	}
+}
+
+// returns overlay with text, nil if text is empty
+func (a *ApiManagerCtx) overlay(text string) *hlsvod.Overlay {
+	if text == "" {
+		return nil
+	}
+
+	return &hlsvod.Overlay{
+		Text:      text,
+		Position:  a.config.Overlay.Position,
+		FontSize:  a.config.Overlay.FontSize,
+		FontColor: a.config.Overlay.FontColor,
+		FontFile:  a.config.Overlay.FontFile,
+		Box:       a.config.Overlay.Box,
+	}
+}
+
+// returns drawtext filter of live stream, that is passed to profiles as
+// OVERLAY environment variable, empty if disabled
+func (a *ApiManagerCtx) liveOverlayFilter(input string) string {
+	text, ok := a.config.Overlay.Streams[input]
+	if !ok {
+		text = a.config.Overlay.Text
+	}
+
+	// live session is shared by viewers
+	text = strings.NewReplacer("{stream}", input, "{viewer}", "").Replace(text)
+
+	if overlay := a.overlay(text); overlay != nil {
+		return overlay.Filter()
+	}
+
+	return ""
+}
+
+// returns overlay text of VOD media requested by viewer, empty if disabled
+func (a *ApiManagerCtx) hlsVodOverlayText(r *http.Request, mediaPath string) string {
+	if !a.config.Overlay.Vod || a.config.Overlay.Text == "" {
+		return ""
+	}
+
+	text := a.config.Overlay.Text
+	if strings.Contains(text, "{viewer}") {
+		text = strings.ReplaceAll(text, "{viewer}", a.overlayViewer(r))
+	}
+
+	return strings.ReplaceAll(text, "{stream}", mediaPath)
+}
+
+// returns short hash of overlay text, so that session ID does not reveal
+// viewer identity
+func hlsVodOverlayID(text string) string {
+	hash := sha1.Sum([]byte(text))
+	return hex.EncodeToString(hash[:8])
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/m1k1o/go-transcode/internal/config"
+)
+
+func TestOverlayLimitsViewer(t *testing.T) {
+	resolver := overlayLimitsViewer(newSessionLimiter(config.Limits{
+		Key:         "token",
+		TokenHeader: "Authorization",
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/?token=secret-token", nil)
+	viewer := resolver(r)
+
+	if strings.Contains(viewer, "secret-token") || len(viewer) != 12 {
+		t.Errorf("viewer = %q, want short hash of token", viewer)
+	}
+
+	// same token is the same viewer, whatever way it is sent
+	r = httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("Authorization", "secret-token")
+	if got := resolver(r); got != viewer {
+		t.Errorf("viewer of header token = %q, want %q", got, viewer)
+	}
+}
@@ -0,0 +1,286 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/signedurl"
+)
+
+// beginning of media, that is transcoded, when session is bootstrapped
+const hlsVodPlayWarmDuration = 10.0
+
+// everything player needs to start playback of media
+type hlsVodPlayBundle struct {
+	Master     string                `json:"master"`  // URL of master playlist
+	Profile    string                `json:"profile"` // profile, whose session was started
+	Profiles   []hlsVodPlayProfile   `json:"profiles"`
+	Metadata   hlsvod.MediaMetadata  `json:"metadata"`
+	Subtitles  []hlsVodPlaySubtitles `json:"subtitles"`            // recognized bitmap subtitles
+	Thumbnails string                `json:"thumbnails,omitempty"` // URL of scrubbing preview playlist
+	Token      string                `json:"token,omitempty"`      // signature query, that grants access to all URLs of media
+	Expires    *time.Time            `json:"expires,omitempty"`    // expiration of token
+}
+
+type hlsVodPlayProfile struct {
+	ID        string `json:"id"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Bandwidth int    `json:"bandwidth"` // in bits per second
+	URL       string `json:"url"`
+}
+
+type hlsVodPlaySubtitles struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Language string `json:"language,omitempty"`
+	URL      string `json:"url"` // WebVTT file
+}
+
+// Play bootstraps playback of media in one round trip, it starts session of
+// the first profile, warms its beginning and returns URLs, metadata and
+// tracks of media, e.g. /play/movie.mp4?profile=720p&audio-offset=0.5
+func (a *ApiManagerCtx) Play(r chi.Router) {
+	// access to media is verified the same way as for vod
+	play := r
+	if a.signer != nil {
+		play = r.With(signedurl.Middleware(a.signer, a.errors))
+	}
+
+	play.Get("/play/*", func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().Str("module", "hlsvod").Str("submodule", "play").Logger()
+
+		// remove /play/ from path, it is already unescaped
+		urlPath := r.URL.Path[6:]
+		if urlPath == "" {
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid media path")
+			return
+		}
+
+		var err error
+
+		// options propagated to rendition URLs
+		options := url.Values{}
+
+		// virtual clip is specified as last directory: [media-path]/clip-[start]-[end]
+		vodMediaPath := urlPath
+		var clipStart, clipEnd float64
+		if matches := hlsVodClipRegex.FindStringSubmatch(vodMediaPath); matches != nil {
+			clipStart, _ = strconv.ParseFloat(matches[2], 64)
+			clipEnd, _ = strconv.ParseFloat(matches[3], 64)
+			if clipEnd <= clipStart {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid clip range")
+				return
+			}
+
+			vodMediaPath = matches[1]
+		}
+
+		var audioOffset float64
+		if value := r.URL.Query().Get("audio-offset"); value != "" {
+			audioOffset, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid audio offset")
+				return
+			}
+
+			options.Set("audio-offset", value)
+		}
+
+		subtitleStream, subtitles := 0, false
+		if value := r.URL.Query().Get("subtitles"); value != "" && a.config.Vod.BurnSubtitles {
+			subtitleStream, err = strconv.Atoi(value)
+			if err != nil || subtitleStream < 0 {
+				a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid subtitle stream")
+				return
+			}
+
+			subtitles = true
+			options.Set("subtitles", value)
+		}
+
+		// use clean path, rooted so that it can not escape media dir
+		mediaPath := filepath.Join(a.config.Vod.MediaDir, filepath.Clean("/"+vodMediaPath))
+
+		if !hlsVodMediaExists(mediaPath) {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "vod not found")
+			return
+		}
+
+		if !a.hlsVodQuarantineCheck(w, r, mediaPath) {
+			return
+		}
+
+		data, err := hlsvod.New(hlsvod.Config{
+			MediaPath:      mediaPath,
+			VideoKeyframes: a.config.Vod.VideoKeyframes,
+			Transcoder:     a.hlsVodTranscoder(),
+			Growing:        a.config.Vod.Growing,
+			GrowingIdle:    a.config.Vod.GrowingIdle,
+
+			Cache:        a.config.Vod.Cache,
+			CacheDir:     a.config.Vod.CacheDir,
+			CacheStore:   a.cache,
+			ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+			SegmentKey:   []byte(a.config.Vod.SegmentKey),
+
+			FFmpegBinary:  a.config.Vod.FFmpegBinary,
+			FFprobeBinary: a.config.Vod.FFprobeBinary,
+		}).Preload(r.Context())
+
+		a.hlsVodProbed(mediaPath, err)
+		if err != nil {
+			logger.Warn().Err(err).Msg("unable to preload metadata")
+			a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to preload metadata")
+			return
+		}
+
+		profiles := a.hlsVodOfferedProfiles(r, data)
+		if len(profiles) == 0 {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "no profile offered")
+			return
+		}
+
+		// requested profile, or profile fitting client throughput, or the lowest one
+		profileID := r.URL.Query().Get("profile")
+		if _, ok := profiles[profileID]; !ok {
+			var bandwidth float64
+			if estimate, _, ok := a.bandwidth.client(a.limiter.clientKey(r)); ok && a.config.Vod.AbrHint {
+				bandwidth = estimate.Bandwidth
+			}
+
+			profileID = hlsVodStartProfile(profiles, bandwidth)
+		}
+
+		// signature of media directory grants access to all its URLs
+		baseURL := path.Join("/vod", urlPath)
+		bundle := hlsVodPlayBundle{
+			Profile:   profileID,
+			Profiles:  []hlsVodPlayProfile{},
+			Metadata:  data.Metadata(a.config.Vod.LanguageMap),
+			Subtitles: []hlsVodPlaySubtitles{},
+		}
+
+		// signature query is propagated to all URLs
+		access := url.Values{}
+		if a.signer != nil {
+			expires := time.Now().Add(a.config.SignedURLs.TTL)
+			token, err := a.signer.Sign(baseURL+"/index.m3u8", baseURL+"/*", expires)
+			if err != nil {
+				logger.Err(err).Msg("unable to sign media URLs")
+				a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "unable to sign media URLs")
+				return
+			}
+
+			for key, values := range token {
+				options[key] = values
+				access[key] = values
+			}
+
+			bundle.Token = token.Encode()
+			bundle.Expires = &expires
+		}
+
+		resourceURL := func(resource string, query url.Values) string {
+			u := a.config.SignedURLs.BaseURL + (&url.URL{Path: baseURL + "/" + resource}).EscapedPath()
+			if len(query) > 0 {
+				u += "?" + query.Encode()
+			}
+			return u
+		}
+
+		bundle.Master = resourceURL("index.m3u8", options)
+
+		for id, profile := range profiles {
+			bundle.Profiles = append(bundle.Profiles, hlsVodPlayProfile{
+				ID:        id,
+				Width:     profile.Width,
+				Height:    profile.Height,
+				Bandwidth: profile.Bitrate,
+				URL:       resourceURL(id+".m3u8", options),
+			})
+		}
+
+		sort.Slice(bundle.Profiles, func(i, j int) bool {
+			return bundle.Profiles[i].Bandwidth < bundle.Profiles[j].Bandwidth
+		})
+
+		for _, subtitles := range a.hlsVodSubtitleRenditions(mediaPath, data.Subtitles) {
+			bundle.Subtitles = append(bundle.Subtitles, hlsVodPlaySubtitles{
+				ID:       subtitles.ID,
+				Name:     subtitles.Name,
+				Language: subtitles.Language,
+				URL:      resourceURL(subtitles.ID+".vtt", access),
+			})
+		}
+
+		// preview is the same for all options
+		if _, _, ok := a.hlsVodProfile(hlsVodPreviewProfileID); ok && !data.AudioOnly() {
+			bundle.Thumbnails = resourceURL(hlsVodPreviewProfileID+".m3u8", access)
+		}
+
+		// start session of the first profile, so that playback starts
+		// without waiting for probe and the first segments
+		profile, preview, _ := a.hlsVodProfile(profileID)
+		sessionConfig := hlsVodSessionConfig{
+			mediaPath:   mediaPath,
+			profileID:   profileID,
+			profile:     profile,
+			preview:     preview,
+			clipStart:   clipStart,
+			clipEnd:     clipEnd,
+			audioOffset: audioOffset,
+
+			subtitles:      subtitles,
+			subtitleStream: subtitleStream,
+		}
+
+		ID := hlsVodSessionID(sessionConfig)
+
+		hlsVodManagersMu.Lock()
+		manager, ok := hlsVodManagers[ID]
+		hlsVodManagersMu.Unlock()
+
+		if !ok {
+			// session is attributed to client, that starts it
+			if err := a.limiter.acquire(r, ID); err != nil {
+				logger.Warn().Err(err).Str("id", ID).Msg("session limit reached")
+				a.limiter.httpError(w, r, err, a.errors)
+				return
+			}
+
+			manager, err = a.hlsVodSession(ID, sessionConfig)
+			if err != nil {
+				a.limiter.release(ID)
+				logger.Warn().Err(err).Msg("hls vod manager could not be started")
+				a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "hls vod manager could not be started")
+				return
+			}
+		}
+
+		go func() {
+			ranges := []hlsvod.WarmRange{{Start: 0, End: hlsVodPlayWarmDuration}}
+			if err := manager.Warm(context.Background(), ranges); err != nil {
+				logger.Warn().Err(err).Str("id", ID).Msg("warming vod session failed")
+			}
+		}()
+
+		logger.Info().Str("id", ID).Msg("vod session bootstrapped")
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(bundle)
+	})
+}
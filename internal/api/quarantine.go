@@ -0,0 +1,255 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+// failed probes of media, it is quarantined after too many failures in a row
+type hlsVodQuarantined struct {
+	Path        string    `json:"path"` // relative to media dir
+	Error       string    `json:"error"`
+	Failures    int       `json:"failures"`
+	Time        time.Time `json:"time"` // of last failure
+	Quarantined bool      `json:"quarantined"`
+
+	// media is probed again, when it is replaced
+	ModTime time.Time `json:"mod_time"`
+	Size    int64     `json:"size"`
+}
+
+// media, whose probe failed repeatedly, is not probed again on every retry
+// of users, until it changes or it is cleared by admin
+type hlsVodQuarantine struct {
+	mu       sync.Mutex
+	after    int
+	file     string
+	mediaDir string
+	entries  map[string]*hlsVodQuarantined // by path relative to media dir
+}
+
+func newHlsVodQuarantine(after int, file, mediaDir string) *hlsVodQuarantine {
+	q := &hlsVodQuarantine{
+		after:    after,
+		file:     file,
+		mediaDir: mediaDir,
+		entries:  map[string]*hlsVodQuarantined{},
+	}
+
+	if after > 0 && file != "" {
+		if err := q.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Warn().Str("module", "hlsvod").Err(err).Str("file", file).Msg("unable to load quarantine")
+		}
+	}
+
+	return q
+}
+
+func (q *hlsVodQuarantine) enabled() bool {
+	return q.after > 0
+}
+
+// returns path of media relative to media dir, that is key of entries
+func (q *hlsVodQuarantine) key(mediaPath string) string {
+	if rel, err := filepath.Rel(q.mediaDir, mediaPath); err == nil {
+		return filepath.ToSlash(rel)
+	}
+
+	return filepath.ToSlash(mediaPath)
+}
+
+// records failed probe of media, returns true if it has just been quarantined
+func (q *hlsVodQuarantine) failed(mediaPath string, err error) bool {
+	if !q.enabled() || !errors.Is(err, hlsvod.ErrProbeFailed) {
+		return false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := q.key(mediaPath)
+	modTime, size := hlsVodMediaStat(mediaPath)
+
+	entry, ok := q.entries[key]
+	if !ok || !entry.ModTime.Equal(modTime) || entry.Size != size {
+		entry = &hlsVodQuarantined{Path: key, ModTime: modTime, Size: size}
+		q.entries[key] = entry
+	}
+
+	entry.Error = err.Error()
+	entry.Failures++
+	entry.Time = time.Now()
+
+	quarantined := !entry.Quarantined && entry.Failures >= q.after
+	if quarantined {
+		entry.Quarantined = true
+		log.Warn().Str("module", "hlsvod").Str("path", key).Int("failures", entry.Failures).Str("error", entry.Error).Msg("media quarantined")
+	}
+
+	q.save()
+	return quarantined
+}
+
+// forgets failures of media, that was probed successfully
+func (q *hlsVodQuarantine) succeeded(mediaPath string) {
+	if !q.enabled() {
+		return
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := q.key(mediaPath)
+	if _, ok := q.entries[key]; ok {
+		delete(q.entries, key)
+		q.save()
+	}
+}
+
+// returns quarantine entry of media, if it must not be probed, entry of
+// replaced media is lifted
+func (q *hlsVodQuarantine) check(mediaPath string) (hlsVodQuarantined, bool) {
+	if !q.enabled() {
+		return hlsVodQuarantined{}, false
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := q.key(mediaPath)
+	entry, ok := q.entries[key]
+	if !ok || !entry.Quarantined {
+		return hlsVodQuarantined{}, false
+	}
+
+	if modTime, size := hlsVodMediaStat(mediaPath); !entry.ModTime.Equal(modTime) || entry.Size != size {
+		log.Info().Str("module", "hlsvod").Str("path", key).Msg("quarantined media changed, lifting quarantine")
+		delete(q.entries, key)
+		q.save()
+		return hlsVodQuarantined{}, false
+	}
+
+	return *entry, true
+}
+
+// returns all entries sorted by path, including media below threshold
+func (q *hlsVodQuarantine) list() []hlsVodQuarantined {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	list := make([]hlsVodQuarantined, 0, len(q.entries))
+	for _, entry := range q.entries {
+		list = append(list, *entry)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Path < list[j].Path
+	})
+
+	return list
+}
+
+// removes entry by path relative to media dir, or all entries if path is
+// empty, returns number of removed entries
+func (q *hlsVodQuarantine) clear(path string) int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	removed := 0
+	if path == "" {
+		removed = len(q.entries)
+		q.entries = map[string]*hlsVodQuarantined{}
+	} else if _, ok := q.entries[path]; ok {
+		delete(q.entries, path)
+		removed = 1
+	}
+
+	if removed > 0 {
+		q.save()
+	}
+
+	return removed
+}
+
+func (q *hlsVodQuarantine) load() error {
+	data, err := os.ReadFile(q.file)
+	if err != nil {
+		return err
+	}
+
+	var list []hlsVodQuarantined
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+
+	for i := range list {
+		q.entries[list[i].Path] = &list[i]
+	}
+
+	return nil
+}
+
+// persists entries, it is written into temporary file first, so that
+// interrupted write does not lose quarantine; must be called with lock held
+func (q *hlsVodQuarantine) save() {
+	if q.file == "" {
+		return
+	}
+
+	list := make([]*hlsVodQuarantined, 0, len(q.entries))
+	for _, entry := range q.entries {
+		list = append(list, entry)
+	}
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err == nil {
+		tmpPath := q.file + ".tmp"
+		if err = os.WriteFile(tmpPath, data, 0644); err == nil {
+			err = os.Rename(tmpPath, q.file)
+		}
+	}
+
+	if err != nil {
+		log.Warn().Str("module", "hlsvod").Err(err).Str("file", q.file).Msg("unable to save quarantine")
+	}
+}
+
+// records result of probe of media
+func (a *ApiManagerCtx) hlsVodProbed(mediaPath string, err error) {
+	if err != nil {
+		a.quarantine.failed(mediaPath, err)
+	} else {
+		a.quarantine.succeeded(mediaPath)
+	}
+}
+
+// responds with error, if media is quarantined, returns false then
+func (a *ApiManagerCtx) hlsVodQuarantineCheck(w http.ResponseWriter, r *http.Request, mediaPath string) bool {
+	entry, ok := a.quarantine.check(mediaPath)
+	if !ok {
+		return true
+	}
+
+	a.httpError(w, r, http.StatusUnprocessableEntity, hlsvod.ErrorUnsupportedMedia, "media is quarantined after repeated probe failures: "+entry.Error)
+	return false
+}
+
+// returns modification time and size of media, zero if it cannot be stat
+func hlsVodMediaStat(mediaPath string) (time.Time, int64) {
+	fi, err := os.Stat(mediaPath)
+	if err != nil {
+		return time.Time{}, 0
+	}
+
+	return fi.ModTime(), fi.Size()
+}
@@ -0,0 +1,201 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/m1k1o/go-transcode/httperror"
+)
+
+// error code of responses to clients, that exceeded their quota
+const errorCodeQuotaExceeded = "quota-exceeded"
+
+var errQuotaExceeded = errors.New("data quota exceeded")
+
+type quotaUsage struct {
+	Bytes int64     `json:"bytes"`
+	Quota int64     `json:"quota,omitempty"` // in bytes, 0 means unlimited
+	Reset time.Time `json:"reset"`           // when period ends and bytes are reset
+}
+
+// counts bytes served to clients in quota periods and to sessions, clients
+// are rejected, when they exceed their quota
+type byteQuotas struct {
+	quota  int64 // in bytes per client and period, 0 means unlimited
+	period time.Duration
+
+	mu       sync.Mutex
+	clients  map[string]*quotaUsage // map of client keys and their usage in current period
+	sessions map[string]int64       // map of session IDs and bytes served to them
+}
+
+func newByteQuotas(quota int64, period time.Duration) *byteQuotas {
+	return &byteQuotas{
+		quota:    quota,
+		period:   period,
+		clients:  map[string]*quotaUsage{},
+		sessions: map[string]int64{},
+	}
+}
+
+// returns usage of client in current period, lock must be held
+func (q *byteQuotas) usage(clientKey string, now time.Time) *quotaUsage {
+	usage, ok := q.clients[clientKey]
+	if !ok || !now.Before(usage.Reset) {
+		usage = &quotaUsage{
+			Quota: q.quota,
+			Reset: now.Add(q.period),
+		}
+		q.clients[clientKey] = usage
+	}
+
+	return usage
+}
+
+// returns usage of client, ok is false if client exceeded its quota
+func (q *byteQuotas) check(clientKey string) (quotaUsage, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	usage := q.usage(clientKey, time.Now())
+	return *usage, q.quota <= 0 || usage.Bytes < q.quota
+}
+
+// counts bytes served to client in session
+func (q *byteQuotas) add(clientKey, ID string, bytes int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.usage(clientKey, time.Now()).Bytes += bytes
+	q.sessions[ID] += bytes
+}
+
+// returns bytes served to session
+func (q *byteQuotas) session(ID string) int64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.sessions[ID]
+}
+
+// forgets stopped session
+func (q *byteQuotas) release(ID string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.sessions, ID)
+}
+
+// forgets clients, whose period ended
+func (q *byteQuotas) cleanup() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	for key, usage := range q.clients {
+		if !now.Before(usage.Reset) {
+			delete(q.clients, key)
+		}
+	}
+}
+
+// counts written bytes into quota, writes fail when quota is exceeded
+type quotaWriter struct {
+	http.ResponseWriter
+	quotas    *byteQuotas
+	clientKey string
+	ID        string
+}
+
+func (w *quotaWriter) Write(p []byte) (int, error) {
+	if _, ok := w.quotas.check(w.clientKey); !ok {
+		return 0, errQuotaExceeded
+	}
+
+	n, err := w.ResponseWriter.Write(p)
+	w.quotas.add(w.clientKey, w.ID, int64(n))
+	return n, err
+}
+
+// files are copied by underlying writer, so that they are served by sendfile,
+// limited reader of file is replaced instead of wrapped, as sendfile is used
+// only with single limited reader
+func (w *quotaWriter) ReadFrom(src io.Reader) (int64, error) {
+	usage, ok := w.quotas.check(w.clientKey)
+	if !ok {
+		return 0, errQuotaExceeded
+	}
+
+	if usage.Quota <= 0 {
+		n, err := io.Copy(w.ResponseWriter, src)
+		w.quotas.add(w.clientKey, w.ID, n)
+		return n, err
+	}
+
+	// response is cut off at remaining quota
+	remaining := usage.Quota - usage.Bytes
+	limited, ok := src.(*io.LimitedReader)
+	if !ok {
+		limited = &io.LimitedReader{R: src, N: remaining + 1}
+	}
+
+	reader := &io.LimitedReader{R: limited.R, N: limited.N}
+	if reader.N > remaining {
+		reader.N = remaining
+	}
+
+	n, err := io.Copy(w.ResponseWriter, reader)
+	w.quotas.add(w.clientKey, w.ID, n)
+	limited.N -= n
+
+	if err == nil && reader.N == 0 && limited.N > 0 {
+		return n, errQuotaExceeded
+	}
+
+	return n, err
+}
+
+func (w *quotaWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writes error with time, when quota of client is reset
+func (a *ApiManagerCtx) quotaError(w http.ResponseWriter, r *http.Request, usage quotaUsage) {
+	w.Header().Set("X-Quota-Reset", usage.Reset.UTC().Format(http.TimeFormat))
+
+	e := httperror.New(r, http.StatusForbidden, errorCodeQuotaExceeded, errQuotaExceeded.Error())
+	e.WithRetry(time.Until(usage.Reset)).Write(w, r, a.errors)
+}
+
+// returns response writer counting bytes into quota of client, client over
+// quota is rejected and response, that exceeds quota, is cut off
+func (a *ApiManagerCtx) quotaResponse(w http.ResponseWriter, r *http.Request, ID string) (http.ResponseWriter, bool) {
+	clientKey := a.limiter.clientKey(r)
+
+	if usage, ok := a.quotas.check(clientKey); !ok {
+		a.quotaError(w, r, usage)
+		return nil, false
+	}
+
+	return &quotaWriter{
+		ResponseWriter: w,
+		quotas:         a.quotas,
+		clientKey:      clientKey,
+		ID:             ID,
+	}, true
+}
+
+// serves usage of requesting client in current quota period
+func (a *ApiManagerCtx) Quota(w http.ResponseWriter, r *http.Request) {
+	usage, _ := a.quotas.check(a.limiter.clientKey(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(usage)
+}
@@ -0,0 +1,280 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/httperror"
+	"github.com/m1k1o/go-transcode/icy"
+	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// chunks buffered for listener, slower listener is disconnected
+const radioListenerBuffer = 64
+
+// size of chunks read from transcode
+const radioChunkSize = 4 * 1024
+
+// shared transcode of radio stream, that is fanned out to its listeners
+type radioStation struct {
+	listeners map[chan []byte]struct{}
+	cancel    context.CancelFunc
+}
+
+type radioStations struct {
+	mu       sync.Mutex
+	stations map[string]*radioStation // by input and format
+	titles   map[string]string        // now playing by input
+}
+
+func newRadioStations(config config.Radio) *radioStations {
+	titles := map[string]string{}
+	for input, stream := range config.Streams {
+		titles[input] = stream.Title
+	}
+
+	return &radioStations{
+		stations: map[string]*radioStation{},
+		titles:   titles,
+	}
+}
+
+func (s *radioStations) title(input string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.titles[input]
+}
+
+func (s *radioStations) setTitle(input, title string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.titles[input] = title
+}
+
+// sends chunk to all listeners of station, listeners, that are not able to
+// keep up, are dropped
+func (s *radioStations) broadcast(station *radioStation, chunk []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for listener := range station.listeners {
+		select {
+		case listener <- chunk:
+		default:
+			delete(station.listeners, listener)
+			close(listener)
+		}
+	}
+}
+
+// returns audio chunks of station, transcode is started for the first
+// listener and stopped after the last one leaves
+func (a *ApiManagerCtx) radioListen(ID, profilePath, input string, inputArgs []string) (<-chan []byte, func(), error) {
+	s := a.radio
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	listener := make(chan []byte, radioListenerBuffer)
+
+	station, ok := s.stations[ID]
+	if !ok {
+		cmd, err := a.transcodeStart(profilePath, input, inputArgs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		station = &radioStation{
+			listeners: map[chan []byte]struct{}{},
+			cancel:    cancel,
+		}
+		s.stations[ID] = station
+
+		logger := log.With().Str("module", "radio").Str("id", ID).Logger()
+
+		read, write := io.Pipe()
+		cmd.Stdout = write
+		cmd.Stderr = utils.LogWriter(logger)
+
+		go func() {
+			logger.Info().Msg("command started")
+			err := utils.ProcessGroupRun(ctx, cmd)
+			logger.Info().AnErr("err", err).Msg("command stopped")
+			write.Close()
+		}()
+
+		go func() {
+			defer read.Close()
+
+			for {
+				chunk := make([]byte, radioChunkSize)
+				n, err := read.Read(chunk)
+				if n > 0 {
+					s.broadcast(station, chunk[:n])
+				}
+
+				if err != nil {
+					break
+				}
+			}
+
+			// listeners of stopped transcode are disconnected
+			s.mu.Lock()
+			if s.stations[ID] == station {
+				delete(s.stations, ID)
+			}
+			for listener := range station.listeners {
+				delete(station.listeners, listener)
+				close(listener)
+			}
+			s.mu.Unlock()
+
+			cancel()
+		}()
+	}
+
+	station.listeners[listener] = struct{}{}
+
+	leave := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		if _, ok := station.listeners[listener]; ok {
+			delete(station.listeners, listener)
+			close(listener)
+		}
+
+		if len(station.listeners) == 0 && s.stations[ID] == station {
+			delete(s.stations, ID)
+			station.cancel()
+		}
+	}
+
+	return listener, leave, nil
+}
+
+// audio formats of radio streams, they are named the same as their
+// profiles in profiles/radio
+var radioFormats = []string{"mp3", "aac"}
+
+// serves radio stream in format to single listener
+func (a *ApiManagerCtx) radioServe(format string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		logger := log.With().
+			Str("path", r.URL.Path).
+			Str("module", "radio").
+			Logger()
+
+		input := chi.URLParam(r, "input")
+
+		stream, ok := a.config.Radio.Streams[input]
+		if !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "radio not found")
+			return
+		}
+
+		profilePath, err := a.ProfilePath("radio", format)
+		if err != nil {
+			logger.Warn().Err(err).Msg("profile path could not be found")
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "profile not found")
+			return
+		}
+
+		// every listener is a separate session
+		ID := fmt.Sprintf("radio/%s", middleware.GetReqID(r.Context()))
+		if err := a.limiter.acquire(r, ID); err != nil {
+			logger.Warn().Err(err).Msg("session limit reached")
+			a.limiter.httpError(w, r, err, a.errors)
+			return
+		}
+		defer a.limiter.release(ID)
+
+		// bytes streamed are counted into quota of client
+		w, ok = a.quotaResponse(w, r, ID)
+		if !ok {
+			return
+		}
+		defer a.quotas.release(ID)
+
+		inputArgs, err := a.inputArgs(r, input)
+		if err != nil {
+			logger.Warn().Err(err).Msg("invalid input options")
+			a.httpError(w, r, http.StatusBadRequest, httperror.CodeBadRequest, "invalid input options")
+			return
+		}
+
+		chunks, leave, err := a.radioListen(fmt.Sprintf("%s/%s", input, format), profilePath, input, inputArgs)
+		if err != nil {
+			logger.Warn().Err(err).Msg("transcode could not be started")
+			a.httpError(w, r, http.StatusInternalServerError, httperror.CodeInternal, "not available")
+			return
+		}
+		defer leave()
+
+		// metadata are interleaved only for players, that ask for them
+		var out io.Writer = w
+		metaInt := 0
+		if icy.Requested(r) {
+			metaInt = a.config.Radio.MetaInt
+			out = icy.NewWriter(w, metaInt, func() string {
+				return a.radio.title(input)
+			})
+		}
+
+		icy.SetHeaders(w.Header(), stream.Name, stream.Genre, stream.URL, metaInt)
+		w.Header().Set("Content-Type", utils.MediaContentType("."+format))
+		w.Header().Set("Cache-Control", "no-cache, no-store")
+
+		flusher, _ := w.(http.Flusher)
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case chunk, ok := <-chunks:
+				if !ok {
+					return
+				}
+
+				if _, err := out.Write(chunk); err != nil {
+					return
+				}
+
+				if flusher != nil {
+					flusher.Flush()
+				}
+			}
+		}
+	}
+}
+
+func (a *ApiManagerCtx) Radio(r chi.Router) {
+	for _, format := range radioFormats {
+		r.Get("/radio/{input}."+format, a.radioServe(format))
+	}
+
+	// now playing of radio stream
+	r.Get("/radio/{input}/title", func(w http.ResponseWriter, r *http.Request) {
+		input := chi.URLParam(r, "input")
+		if _, ok := a.config.Radio.Streams[input]; !ok {
+			a.httpError(w, r, http.StatusNotFound, httperror.CodeNotFound, "radio not found")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-cache")
+		_ = json.NewEncoder(w).Encode(struct {
+			Title string `json:"title"`
+		}{a.radio.title(input)})
+	})
+}
@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// maximum delay between reconnects of dropped HTTP inputs in seconds
+const remoteReconnectDelayMax = 10
+
+// returns config of connections to remote inputs
+func remoteInputsConfig(c config.RemoteInputs) utils.RemoteConfig {
+	// proxy url was validated by config
+	var proxy *url.URL
+	if c.Proxy != "" {
+		proxy, _ = url.Parse(c.Proxy)
+	}
+
+	return utils.RemoteConfig{
+		Proxy:         proxy,
+		NoProxy:       c.NoProxy,
+		Network:       c.Network,
+		FallbackDelay: c.FallbackDelay,
+		Timeout:       c.Timeout,
+	}
+}
+
+// returns client fetching upstreams of hls proxy
+func remoteInputsClient(c utils.RemoteConfig) *http.Client {
+	return &http.Client{Transport: c.Transport()}
+}
+
+// returns ffmpeg input options of stream url, only HTTP inputs support
+// proxy and reconnects, ffmpeg races IPv6 and IPv4 addresses on its own
+func (a *ApiManagerCtx) remoteInputArgs(input string) []string {
+	u, err := url.Parse(input)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil
+	}
+
+	args := []string{}
+	if proxy := a.remote.ProxyFor(u); proxy != nil && proxy.Scheme == "http" {
+		args = append(args, "-http_proxy", proxy.String())
+	}
+
+	if timeout := a.config.RemoteInputs.Timeout; timeout > 0 {
+		args = append(args, "-rw_timeout", strconv.FormatInt(timeout.Microseconds(), 10))
+	}
+
+	if a.config.RemoteInputs.Reconnect {
+		args = append(args,
+			"-reconnect", "1",
+			"-reconnect_streamed", "1",
+			"-reconnect_delay_max", strconv.Itoa(remoteReconnectDelayMax),
+		)
+	}
+
+	return args
+}
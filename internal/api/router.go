@@ -1,49 +1,289 @@
 package api
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
-	"path"
+	"path/filepath"
 	"regexp"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
 
+	"github.com/m1k1o/go-transcode/events"
+	"github.com/m1k1o/go-transcode/hls"
+	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/httperror"
 	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/internal/utils"
+	"github.com/m1k1o/go-transcode/signedurl"
 )
 
 var resourceRegex = regexp.MustCompile(`^[0-9A-Za-z_-]+$`)
 
 type ApiManagerCtx struct {
-	config *config.Server
+	config        *config.Server
+	events        *events.Bus
+	warm          chan hlsVodWarmJob
+	seekPrefetch  *hlsVodSeekPrefetch
+	quarantine    *hlsVodQuarantine
+	mezzanine     *hlsVodMezzanine
+	subtitles     *hlsVodSubtitles
+	exports       *hlsVodExports
+	channels      liveChannels
+	radio         *radioStations
+	jobs          *utils.JobControl
+	variants      VariantResolver
+	errors        httperror.Responder
+	inputs        InputOptionsResolver
+	authorizer    Authorizer
+	overlayViewer OverlayViewerResolver
+	adminLogs     *adminLogs
+	logFiles      *sessionLogFiles
+	limiter       *sessionLimiter
+	bandwidth     *bandwidthTracker
+	quotas        *byteQuotas
+	keys          *hlsvod.RotatingKeyProvider
+	encoders      *hlsvod.EncoderPool
+	cache         hlsvod.CacheStore
+	ffmpeg        *hlsvod.FFmpegTranscoder
+	batch         *hlsvod.BatchTranscoder
+	steering      *contentSteering
+	viewers       *hls.ViewerTracker
+	signer        signedurl.Signer
+	remote        utils.RemoteConfig
+	upstream      *http.Client
+	shutdown      chan struct{}
+
+	capabilitiesProbe capabilitiesProbe
 }
 
 func New(config *config.Server) *ApiManagerCtx {
+	ffmpeg := hlsVodFFmpegTranscoder(config.Vod)
+	remote := remoteInputsConfig(config.RemoteInputs)
+	bus := events.New()
+	limiter := newSessionLimiter(config.Limits)
+
 	return &ApiManagerCtx{
-		config: config,
+		config:        config,
+		events:        bus,
+		warm:          make(chan hlsVodWarmJob, hlsVodWarmQueueSize),
+		seekPrefetch:  newHlsVodSeekPrefetch(),
+		quarantine:    newHlsVodQuarantine(config.Vod.QuarantineAfter, config.Vod.QuarantineFile, config.Vod.MediaDir),
+		mezzanine:     newHlsVodMezzanine(),
+		subtitles:     newHlsVodSubtitles(),
+		exports:       newHlsVodExports(),
+		channels:      newLiveChannels(config.Channels),
+		radio:         newRadioStations(config.Radio),
+		jobs:          utils.NewJobControl(),
+		variants:      hlsVodConfigVariants(config.Vod.Variants),
+		errors:        configErrorResponder(config.ErrorFormat),
+		inputs:        inputConfigOptions(config.InputOptions.Streams),
+		authorizer:    adminConfigAuthorizer(config.Admin.Token),
+		overlayViewer: overlayLimitsViewer(limiter),
+		adminLogs:     newAdminLogs(),
+		logFiles:      newSessionLogFiles(config.SessionLogs),
+		limiter:       limiter,
+		bandwidth:     newBandwidthTracker(),
+		quotas:        newByteQuotas(config.Limits.Quota*1024*1024, config.Limits.QuotaPeriod),
+		keys:          hlsvod.NewRotatingKeyProvider(config.Vod.KeyRotation, hlsVodKeyURIFormat),
+		encoders:      hlsVodEncoderPool(config.Vod),
+		cache:         hlsVodCacheStore(config.Vod.CacheStore),
+		ffmpeg:        ffmpeg,
+		batch:         hlsvod.NewBatchTranscoder(ffmpeg, config.Vod.BatchWindow),
+		steering:      newContentSteering(config.ContentSteering),
+		viewers:       hls.NewViewerTracker(bus, config.ViewerTimeout),
+		signer:        newSignedURLs(config.SignedURLs),
+		remote:        remote,
+		upstream:      remoteInputsClient(remote),
+		shutdown:      make(chan struct{}),
 	}
 }
 
+func (manager *ApiManagerCtx) Events() *events.Bus {
+	return manager.events
+}
+
 func (manager *ApiManagerCtx) Start() {
+	// fail early, if ffmpeg used for static files is not supported
+	if manager.config.Vod.MediaDir != "" && manager.config.Vod.Transcoder != "fake" {
+		if err := manager.ffmpeg.Detect(context.Background()); err != nil {
+			log.Panic().Err(err).Msg("unable to use ffmpeg for static file transcoding")
+		}
+
+		log.Info().
+			Str("ffmpeg", manager.ffmpeg.FFmpegVersion.Raw).
+			Str("ffprobe", manager.ffmpeg.FFprobeVersion.Raw).
+			Msg("detected ffmpeg version")
+	}
+
+	// presets could have been picked automatically for available CPUs
+	if manager.config.Vod.MediaDir != "" && manager.config.Vod.Preset == "auto" {
+		presets := zerolog.Dict()
+		for profileID, profile := range manager.config.Vod.VideoProfiles {
+			presets.Str(profileID, profile.Preset)
+		}
+
+		log.Info().
+			Float64("cpus", utils.AvailableCPUs()).
+			Dict("presets", presets).
+			Msg("picked vod encoder presets")
+	}
+
+	// log session events
+	sessionEvents, unsubscribe := manager.events.Subscribe(64,
+		events.SessionStartedType,
+		events.SessionStoppedType,
+		events.TranscodeFailedType,
+		events.CacheEvictedType,
+		events.PublishFailedType,
+		events.InputAlertType,
+		events.ProfileDegradedType,
+		events.SourceChangedType,
+		events.ViewerJoinedType,
+		events.ViewerLeftType,
+	)
+
+	go func() {
+		defer unsubscribe()
+
+		logger := log.With().Str("module", "api").Str("submodule", "events").Logger()
+		for {
+			select {
+			case <-manager.shutdown:
+				return
+			case event := <-sessionEvents:
+				logger.Debug().Str("type", string(event.Type())).Interface("event", event).Msg("received event")
+			}
+		}
+	}()
+
+	// release limited sessions and their measured throughput, when they stop,
+	// stop events must not be dropped, otherwise clients stay locked out
+	unsubscribeStopped := manager.events.SubscribeFunc(func(event events.Event) {
+		if stopped, ok := event.(events.SessionStopped); ok {
+			manager.limiter.release(stopped.Session)
+			manager.bandwidth.release(stopped.Session)
+			manager.quotas.release(stopped.Session)
+		}
+	}, events.SessionStoppedType)
+
+	go func() {
+		defer unsubscribeStopped()
+
+		ticker := time.NewTicker(limitsNewSessionsWindow)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-manager.shutdown:
+				return
+			case <-ticker.C:
+				manager.limiter.cleanup()
+				manager.bandwidth.cleanup()
+				manager.quotas.cleanup()
+			}
+		}
+	}()
+
+	// viewers of live streams, that stopped watching, leave
+	go func() {
+		ticker := time.NewTicker(liveViewersPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-manager.shutdown:
+				return
+			case <-ticker.C:
+				manager.viewers.Expire()
+			}
+		}
+	}()
+
+	// background warming of vod sessions
+	go manager.hlsVodWarmWorker()
+
+	// sessions of replaced media are started again upon the next request
+	if manager.config.Vod.SourceWatch > 0 {
+		go manager.hlsVodSourceWorker()
+	}
+
+	// background pre-encoding of vod renditions
+	if manager.config.Vod.MezzanineDir != "" {
+		go manager.hlsVodMezzanineWorker()
+	}
+
+	// background OCR of bitmap subtitles
+	if manager.config.Vod.SubtitlesDir != "" {
+		go manager.hlsVodSubtitlesWorker()
+	}
+
+	// background export of clips
+	if manager.config.Vod.ExportDir != "" {
+		go manager.hlsVodExportWorker()
+	}
+
+	// utilization of GPUs used by hardware encoders
+	if manager.encoders != nil && manager.config.Vod.EncoderPoll > 0 {
+		go manager.hlsVodEncoderPoller()
+	}
+
+	// session logs shown in admin UI
+	if manager.config.Admin.Route != "" {
+		go manager.adminCollectLogs()
+	}
+
+	// session logs persisted to files
+	if manager.config.SessionLogs.Dir != "" {
+		go manager.collectLogFiles()
+	}
+
+	// periodic eviction of idle vod sessions
+	go func() {
+		ticker := time.NewTicker(hlsVodCleanupPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-manager.shutdown:
+				return
+			case <-ticker.C:
+				manager.hlsVodCleanup()
+				manager.adminCleanup()
+			}
+		}
+	}()
 }
 
 func (manager *ApiManagerCtx) Shutdown() error {
+	close(manager.shutdown)
+
 	// stop all hls managers
+	hlsManagersMu.Lock()
 	for _, hls := range hlsManagers {
 		hls.Stop()
 	}
+	hlsManagersMu.Unlock()
 
 	// stop all hls vod managers
+	hlsVodManagersMu.Lock()
 	for _, hls := range hlsVodManagers {
 		hls.Stop()
 	}
+	hlsVodManagersMu.Unlock()
 
 	// shutdown all hls proxy managers
+	hlsProxyManagersMu.Lock()
 	for _, hls := range hlsProxyManagers {
 		hls.Shutdown()
 	}
+	hlsProxyManagersMu.Unlock()
 
 	return nil
 }
@@ -54,18 +294,68 @@ func (a *ApiManagerCtx) Mount(r *chi.Mux) {
 		_, _ = w.Write([]byte("pong"))
 	})
 
+	// supported codecs, containers and profiles for player frontends
+	r.Get("/capabilities", a.Capabilities)
+
+	// bytes served to requesting client and its data quota
+	r.Get("/quota", a.Quota)
+
+	// concurrent viewers of live streams
+	r.Get("/viewers", a.Viewers)
+	r.Get("/viewers/{input}", a.Viewers)
+
+	if a.steering.enabled() {
+		r.Get(steeringManifestRoute, a.steering.ServeManifest)
+		log.Info().Strs("pathways", a.steering.getPriority()).Msg("content steering is active")
+	}
+
 	if a.config.Vod.MediaDir != "" {
-		r.Group(a.HlsVod)
+		r.Group(a.originGroup(a.HlsVod))
+		r.Group(a.originGroup(a.Play))
+
+		if a.config.Vod.ExportDir != "" {
+			r.Group(a.originGroup(a.Export))
+			log.Info().Str("export-dir", a.config.Vod.ExportDir).Msg("clip export is active")
+		}
+
+		if len(a.channels) > 0 {
+			r.Group(a.originGroup(a.Channel))
+			log.Info().Int("channels", len(a.channels)).Msg("scheduled channels are active")
+		}
+
 		log.Info().Str("vod-dir", a.config.Vod.MediaDir).Msg("static file transcoding is active")
+
+		if a.signer != nil {
+			log.Info().Str("scheme", a.config.SignedURLs.Scheme).Msg("vod requests must be signed")
+		}
+	}
+
+	if proxy := a.remote.Proxy; proxy != nil && proxy.Scheme != "http" {
+		log.Warn().Str("scheme", proxy.Scheme).Msg("ffmpeg supports only http proxy, live inputs are pulled directly")
 	}
 
 	if len(a.config.HlsProxy) > 0 {
-		r.Group(a.HLSProxy)
+		r.Group(a.originGroup(a.HLSProxy))
 		log.Info().Interface("hls-proxy", a.config.HlsProxy).Msg("hls proxy is active")
 	}
 
-	r.Group(a.HLS)
-	r.Group(a.Http)
+	if len(a.config.Radio.Streams) > 0 {
+		r.Group(a.originGroup(a.Radio))
+		log.Info().Int("streams", len(a.config.Radio.Streams)).Msg("radio is active")
+	}
+
+	if a.config.Admin.Route != "" {
+		r.Route(a.config.Admin.Route, a.Admin)
+		log.Info().Str("route", a.config.Admin.Route).Msg("admin ui is active")
+	}
+
+	if a.originProtected() {
+		log.Info().Str("header", a.config.OriginProtection.Header).Bool("client-ca", a.config.OriginProtection.ClientCA != "").Msg("media routes are protected from direct access")
+	}
+
+	r.Group(a.originGroup(a.HLS))
+	r.Group(a.originGroup(a.Dash))
+	r.Group(a.originGroup(a.Http))
 }
 
 func (a *ApiManagerCtx) ProfilePath(folder string, profile string) (string, error) {
@@ -76,7 +366,7 @@ func (a *ApiManagerCtx) ProfilePath(folder string, profile string) (string, erro
 		return "", fmt.Errorf("invalid profile path")
 	}
 
-	profilePath := path.Join(a.config.Profiles, folder, fmt.Sprintf("%s.sh", profile))
+	profilePath := filepath.Join(a.config.Profiles, folder, fmt.Sprintf("%s.sh", profile))
 	if _, err := os.Stat(profilePath); os.IsNotExist(err) {
 		return "", err
 	}
@@ -84,12 +374,58 @@ func (a *ApiManagerCtx) ProfilePath(folder string, profile string) (string, erro
 }
 
 // Call ProfilePath before
-func (a *ApiManagerCtx) transcodeStart(profilePath string, input string) (*exec.Cmd, error) {
+// input args are passed to profile after url, profile places them before input
+func (a *ApiManagerCtx) transcodeStart(profilePath string, input string, inputArgs []string) (*exec.Cmd, error) {
+	url, err := a.streamURL(input)
+	if err != nil {
+		return nil, err
+	}
+
+	// options of stream are placed after remote input options, so that
+	// they take precedence
+	inputArgs = append(a.remoteInputArgs(url), inputArgs...)
+
+	log.Info().Str("profilePath", profilePath).Str("url", url).Msg("command startred")
+	cmd := exec.Command(profilePath, append([]string{url}, inputArgs...)...)
+
+	// text burned into video by profiles, that support it
+	if filter := a.liveOverlayFilter(input); filter != "" {
+		cmd.Env = append(os.Environ(), "OVERLAY="+filter)
+	}
+
+	return cmd, nil
+}
+
+// returns url of stream, test patterns are served by this server
+func (a *ApiManagerCtx) streamURL(input string) (string, error) {
 	url, ok := a.config.Streams[input]
 	if !ok {
-		return nil, fmt.Errorf("stream not found")
+		return "", fmt.Errorf("stream not found")
 	}
 
-	log.Info().Str("profilePath", profilePath).Str("url", url).Msg("command startred")
-	return exec.Command(profilePath, url), nil
+	if _, ok, err := hls.ParseTestPattern(url); !ok {
+		return url, nil
+	} else if err != nil {
+		return "", err
+	}
+
+	scheme := "http"
+	if a.config.Cert != "" && a.config.Key != "" {
+		scheme = "https"
+	}
+
+	// listening on all interfaces is reachable through loopback
+	host, port, err := net.SplitHostPort(a.config.Bind)
+	if err != nil {
+		return "", fmt.Errorf("unable to get local address: %w", err)
+	}
+
+	if ip := net.ParseIP(host); host == "" || (ip != nil && ip.IsUnspecified()) {
+		host = "127.0.0.1"
+		if ip != nil && ip.To4() == nil {
+			host = "::1"
+		}
+	}
+
+	return fmt.Sprintf("%s://%s/testsrc/%s.ts", scheme, net.JoinHostPort(host, port), input), nil
 }
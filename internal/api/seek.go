@@ -0,0 +1,180 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+// windows after predicted seek destinations of vod sessions, that were
+// already queued to be pre-transcoded
+type hlsVodSeekPrefetch struct {
+	mu      sync.Mutex
+	windows map[string]map[int]bool // window indexes by session ID
+}
+
+func newHlsVodSeekPrefetch() *hlsVodSeekPrefetch {
+	return &hlsVodSeekPrefetch{
+		windows: map[string]map[int]bool{},
+	}
+}
+
+// returns ranges of session, whose windows were not queued yet, and marks
+// them as queued
+func (p *hlsVodSeekPrefetch) claim(ID string, ranges []hlsvod.WarmRange, window float64) []hlsvod.WarmRange {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	windows, ok := p.windows[ID]
+	if !ok {
+		windows = map[int]bool{}
+		p.windows[ID] = windows
+	}
+
+	claimed := []hlsvod.WarmRange{}
+	for _, r := range ranges {
+		index := int(r.Start / window)
+		if windows[index] {
+			continue
+		}
+
+		windows[index] = true
+		claimed = append(claimed, r)
+	}
+
+	return claimed
+}
+
+// unmarks ranges, that could not be queued
+func (p *hlsVodSeekPrefetch) release(ID string, ranges []hlsvod.WarmRange, window float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range ranges {
+		delete(p.windows[ID], int(r.Start/window))
+	}
+}
+
+// forgets windows of stopped session
+func (p *hlsVodSeekPrefetch) forget(ID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.windows, ID)
+}
+
+// queues pre-transcoding of windows after chapter starts and regular
+// intervals of media, that has started to be played by profile
+func (a *ApiManagerCtx) hlsVodSeekPredict(mediaPath, profileID string) {
+	select {
+	case a.warm <- hlsVodWarmJob{mediaPath: mediaPath, profileID: profileID, seek: true}:
+	default:
+		log.Debug().Str("module", "hlsvod").Str("submodule", "seek").Msg("warm queue is full, seek points are not pre-transcoded")
+	}
+}
+
+// queues pre-transcoding of window after position, that viewer scrubbed to
+// in preview, for all profiles of media, that are being played
+func (a *ApiManagerCtx) hlsVodSeekScrub(preview hlsvod.Manager, segmentName, mediaPath string) {
+	position, ok := 0.0, false
+	for _, segment := range preview.Stats() {
+		if segment.Name == segmentName {
+			ok = true
+			break
+		}
+		position += segment.Duration
+	}
+
+	if !ok {
+		return
+	}
+
+	window := a.config.Vod.SeekPrefetch.Seconds()
+	ranges := []hlsvod.WarmRange{{Start: position, End: position + window}}
+
+	for profileID := range a.config.Vod.VideoProfiles {
+		ID := hlsVodSessionID(hlsVodSessionConfig{mediaPath: mediaPath, profileID: profileID})
+
+		hlsVodManagersMu.Lock()
+		_, ok := hlsVodManagers[ID]
+		hlsVodManagersMu.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		claimed := a.seekPrefetch.claim(ID, ranges, window)
+		if len(claimed) == 0 {
+			continue
+		}
+
+		select {
+		case a.warm <- hlsVodWarmJob{mediaPath: mediaPath, profileID: profileID, ranges: claimed, seek: true}:
+		default:
+			a.seekPrefetch.release(ID, claimed, window)
+		}
+	}
+}
+
+// returns ranges of seek job, that were not pre-transcoded yet, false if
+// there is nothing to transcode or session is not played anymore
+func (a *ApiManagerCtx) hlsVodSeekRanges(ctx context.Context, ID string, job hlsVodWarmJob) ([]hlsvod.WarmRange, bool) {
+	hlsVodManagersMu.Lock()
+	_, ok := hlsVodManagers[ID]
+	hlsVodManagersMu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	// scrubbed ranges were claimed, when they were queued
+	if len(job.ranges) > 0 {
+		return job.ranges, true
+	}
+
+	data, err := a.hlsVodPreload(ctx, job.mediaPath)
+	if err != nil {
+		log.Warn().Str("module", "hlsvod").Str("submodule", "seek").Err(err).Str("id", ID).Msg("unable to predict seek points")
+		return nil, false
+	}
+
+	window := a.config.Vod.SeekPrefetch.Seconds()
+	ranges := hlsvod.SeekRanges(data, a.config.Vod.SeekIntervals, window)
+	ranges = a.seekPrefetch.claim(ID, ranges, window)
+	return ranges, len(ranges) > 0
+}
+
+// returns metadata of media without starting session
+func (a *ApiManagerCtx) hlsVodPreload(ctx context.Context, mediaPath string) (*hlsvod.ProbeMediaData, error) {
+	if !hlsVodMediaExists(mediaPath) {
+		return nil, fmt.Errorf("media %q not found", mediaPath)
+	}
+
+	if entry, ok := a.quarantine.check(mediaPath); ok {
+		return nil, fmt.Errorf("media %q is quarantined: %s", mediaPath, entry.Error)
+	}
+
+	data, err := hlsvod.New(hlsvod.Config{
+		MediaPath:      mediaPath,
+		VideoKeyframes: a.config.Vod.VideoKeyframes,
+		Transcoder:     a.hlsVodTranscoder(),
+		Growing:        a.config.Vod.Growing,
+		GrowingIdle:    a.config.Vod.GrowingIdle,
+
+		Cache:        a.config.Vod.Cache,
+		CacheDir:     a.config.Vod.CacheDir,
+		CacheStore:   a.cache,
+		ObfuscateKey: []byte(a.config.Vod.ObfuscateKey),
+		SegmentKey:   []byte(a.config.Vod.SegmentKey),
+
+		FFmpegBinary:  a.config.Vod.FFmpegBinary,
+		FFprobeBinary: a.config.Vod.FFprobeBinary,
+	}).Preload(ctx)
+
+	a.hlsVodProbed(mediaPath, err)
+	return data, err
+}
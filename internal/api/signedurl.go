@@ -0,0 +1,49 @@
+package api
+
+import (
+	"encoding/hex"
+	"fmt"
+	"path"
+	"time"
+
+	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/signedurl"
+)
+
+// returns signer of configured scheme, nil if signed URLs are disabled
+func newSignedURLs(c config.SignedURLs) signedurl.Signer {
+	switch c.Scheme {
+	case "hmac":
+		return signedurl.HMAC{Key: []byte(c.Key)}
+	case "akamai":
+		key, err := hex.DecodeString(c.Key)
+		if err != nil {
+			panic(fmt.Sprintf("signed URLs akamai key must be hex encoded: %v", err))
+		}
+		return signedurl.Akamai{Key: key, Param: c.Param}
+	case "cloudfront":
+		key, err := signedurl.ParseRSAPrivateKey([]byte(c.Key))
+		if err != nil {
+			panic(fmt.Sprintf("signed URLs cloudfront key is invalid: %v", err))
+		}
+		return signedurl.CloudFront{KeyPairID: c.KeyPairID, PrivateKey: key, BaseURL: c.BaseURL}
+	default:
+		return nil
+	}
+}
+
+// returns signed URL of path, by default whole directory of path is
+// allowed, so that playlists and segments share the signature
+func (a *ApiManagerCtx) signURL(urlPath, acl string, ttl time.Duration) (string, time.Time, error) {
+	if acl == "" {
+		acl = path.Dir(urlPath) + "/*"
+	}
+
+	if ttl <= 0 {
+		ttl = a.config.SignedURLs.TTL
+	}
+
+	expires := time.Now().Add(ttl)
+	signed, err := signedurl.URL(a.signer, urlPath, acl, expires)
+	return a.config.SignedURLs.BaseURL + signed, expires, err
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/internal/config"
+)
+
+// route of steering manifest, it is resolved against host of master playlist
+const steeringManifestRoute = "/steering.json"
+
+// contentSteering holds pathway priority, that can be changed at runtime to
+// shift traffic between hosts
+type contentSteering struct {
+	config config.ContentSteering
+
+	mu       sync.RWMutex
+	priority []string
+}
+
+func newContentSteering(config config.ContentSteering) *contentSteering {
+	priority := []string{}
+	for _, pathway := range config.Pathways {
+		priority = append(priority, pathway.ID)
+	}
+
+	return &contentSteering{
+		config:   config,
+		priority: priority,
+	}
+}
+
+func (s *contentSteering) enabled() bool {
+	return len(s.config.Pathways) > 0
+}
+
+func (s *contentSteering) getPriority() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]string{}, s.priority...)
+}
+
+// sets pathway priority, pathways left out are not used by players
+func (s *contentSteering) setPriority(priority []string) error {
+	if len(priority) == 0 {
+		return fmt.Errorf("at least one pathway is required")
+	}
+
+	known := map[string]bool{}
+	for _, pathway := range s.config.Pathways {
+		known[pathway.ID] = true
+	}
+
+	for _, ID := range priority {
+		if !known[ID] {
+			return fmt.Errorf("unknown pathway %q", ID)
+		}
+	}
+
+	s.mu.Lock()
+	s.priority = append([]string{}, priority...)
+	s.mu.Unlock()
+	return nil
+}
+
+// returns pathways of master playlist, renditions keep request path on
+// every host
+func (s *contentSteering) playlist(r *http.Request) *hlsvod.ContentSteering {
+	dir := path.Dir(r.URL.EscapedPath())
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+
+	steering := &hlsvod.ContentSteering{
+		ServerURI: steeringManifestRoute,
+	}
+
+	// default pathway is the first by current priority
+	priority := s.getPriority()
+	pathways := map[string]string{}
+	for _, pathway := range s.config.Pathways {
+		pathways[pathway.ID] = pathway.URL
+	}
+
+	for _, ID := range priority {
+		steering.Pathways = append(steering.Pathways, hlsvod.SteeringPathway{ID: ID, BaseURL: pathways[ID] + dir})
+		delete(pathways, ID)
+	}
+
+	// pathways left out of priority are still listed, so that priority can
+	// bring them back without reloading master playlist
+	for _, pathway := range s.config.Pathways {
+		if url, ok := pathways[pathway.ID]; ok {
+			steering.Pathways = append(steering.Pathways, hlsvod.SteeringPathway{ID: pathway.ID, BaseURL: url + dir})
+		}
+	}
+
+	return steering
+}
+
+func (s *contentSteering) ServeManifest(w http.ResponseWriter, r *http.Request) {
+	manifest := hlsvod.NewSteeringManifest(int(s.config.TTL.Seconds()), steeringManifestRoute, s.getPriority())
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+	_ = json.NewEncoder(w).Encode(manifest)
+}
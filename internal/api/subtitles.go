@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+)
+
+const hlsVodSubtitlesQueueSize = 64
+
+// recognized subtitle stream, e.g. subtitles-1.m3u8 or subtitles-1.vtt
+var hlsVodSubtitlesRegex = regexp.MustCompile(`^subtitles-([0-9]+)\.(m3u8|vtt)$`)
+
+type hlsVodSubtitlesJob struct {
+	mediaPath string
+	stream    hlsvod.ProbeSubtitleData
+	path      string
+}
+
+// background queue of subtitle OCR, every stream is queued at most once
+type hlsVodSubtitles struct {
+	jobs chan hlsVodSubtitlesJob
+
+	pendingMu sync.Mutex
+	pending   map[string]bool
+}
+
+func newHlsVodSubtitles() *hlsVodSubtitles {
+	return &hlsVodSubtitles{
+		jobs:    make(chan hlsVodSubtitlesJob, hlsVodSubtitlesQueueSize),
+		pending: map[string]bool{},
+	}
+}
+
+// queues job unless it is already pending or queue is full
+func (q *hlsVodSubtitles) enqueue(job hlsVodSubtitlesJob) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	if q.pending[job.path] {
+		return
+	}
+
+	select {
+	case q.jobs <- job:
+		q.pending[job.path] = true
+	default:
+	}
+}
+
+func (q *hlsVodSubtitles) done(job hlsVodSubtitlesJob) {
+	q.pendingMu.Lock()
+	defer q.pendingMu.Unlock()
+
+	delete(q.pending, job.path)
+}
+
+// returns path of recognized WebVTT subtitles of media stream
+func (a *ApiManagerCtx) hlsVodSubtitlesPath(mediaPath string, stream int) string {
+	return filepath.Join(a.config.Vod.SubtitlesDir, hlsvod.SubtitleFileName(mediaPath, stream))
+}
+
+// returns subtitle renditions of bitmap subtitles, that were already
+// recognized, others are queued for OCR
+func (a *ApiManagerCtx) hlsVodSubtitleRenditions(mediaPath string, subtitles []hlsvod.ProbeSubtitleData) []hlsvod.SubtitleRendition {
+	if a.config.Vod.SubtitlesDir == "" {
+		return nil
+	}
+
+	renditions := []hlsvod.SubtitleRendition{}
+	names := map[string]bool{}
+	for _, stream := range subtitles {
+		if !stream.Bitmap() {
+			continue
+		}
+
+		path := a.hlsVodSubtitlesPath(mediaPath, stream.Index)
+		if !hlsvod.SubtitleFresh(path, mediaPath) {
+			a.subtitles.enqueue(hlsVodSubtitlesJob{
+				mediaPath: mediaPath,
+				stream:    stream,
+				path:      path,
+			})
+			continue
+		}
+
+		// OCR uses language tag of media, playlists BCP-47 tag
+		language := hlsvod.NormalizeLanguage(stream.Language, a.config.Vod.LanguageMap)
+
+		name := stream.Title
+		if name == "" && language != "" {
+			name = language
+		} else if name == "" {
+			name = "Subtitles"
+		}
+
+		// names must be unique within group
+		if names[name] {
+			name = fmt.Sprintf("%s %d", name, stream.Index)
+		}
+		names[name] = true
+
+		renditions = append(renditions, hlsvod.SubtitleRendition{
+			ID:       fmt.Sprintf("subtitles-%d", stream.Index),
+			Name:     name,
+			Language: language,
+		})
+	}
+
+	return renditions
+}
+
+// recognizes subtitles one by one, so that they do not compete with playback
+func (a *ApiManagerCtx) hlsVodSubtitlesWorker() {
+	logger := log.With().Str("module", "hlsvod").Str("submodule", "ocr").Logger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.shutdown
+		cancel()
+	}()
+
+	for {
+		select {
+		case <-a.shutdown:
+			return
+		case job := <-a.subtitles.jobs:
+			// jobs paused by admin API wait here
+			if err := a.jobs.Wait(ctx); err != nil {
+				a.subtitles.done(job)
+				return
+			}
+
+			// might have been recognized by previous job
+			if hlsvod.SubtitleFresh(job.path, job.mediaPath) {
+				a.subtitles.done(job)
+				continue
+			}
+
+			logger.Info().Str("media", job.mediaPath).Int("stream", job.stream.Index).Msg("recognizing subtitles")
+			err := hlsvod.OCRSubtitles(ctx, hlsvod.SubtitleOCRConfig{
+				InputFilePath:  job.mediaPath,
+				OutputFilePath: job.path,
+				SubtitleStream: job.stream.Index,
+				Language:       job.stream.Language,
+
+				FFmpegBinary:  a.config.Vod.FFmpegBinary,
+				FFprobeBinary: a.config.Vod.FFprobeBinary,
+				OCR:           hlsvod.TesseractOCR{Binary: a.config.Vod.OCRBinary},
+				Control:       a.jobs,
+			})
+			a.subtitles.done(job)
+
+			if err != nil {
+				logger.Warn().Err(err).Str("media", job.mediaPath).Int("stream", job.stream.Index).Msg("recognizing subtitles failed")
+				continue
+			}
+
+			logger.Info().Str("media", job.mediaPath).Int("stream", job.stream.Index).Msg("recognizing subtitles finished")
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-chi/chi"
+
+	"github.com/m1k1o/go-transcode/hls"
+)
+
+// how often are viewers, that stopped watching, removed
+const liveViewersPeriod = 5 * time.Second
+
+// records request of live stream viewer, all profiles of stream are counted
+// together, so that viewer switching renditions is counted once
+func (a *ApiManagerCtx) liveViewerSeen(r *http.Request, input string) {
+	a.viewers.Seen(input, hls.ViewerID(r))
+}
+
+// Viewers serves concurrent viewers of all live streams or of single stream.
+func (a *ApiManagerCtx) Viewers(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if input := chi.URLParam(r, "input"); input != "" {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"stream":  input,
+			"viewers": a.viewers.Count(input),
+		})
+		return
+	}
+
+	_ = json.NewEncoder(w).Encode(a.viewers.Counts())
+}
+
+// writes gauges of live viewers in Prometheus text exposition format
+func (a *ApiManagerCtx) writeViewersMetrics(w io.Writer) {
+	counts := a.viewers.Counts()
+
+	streams := make([]string, 0, len(counts))
+	for stream := range counts {
+		streams = append(streams, stream)
+	}
+	sort.Strings(streams)
+
+	fmt.Fprintf(w, "# HELP gotranscode_live_viewers Concurrent viewers of live stream.\n")
+	fmt.Fprintf(w, "# TYPE gotranscode_live_viewers gauge\n")
+	for _, stream := range streams {
+		fmt.Fprintf(w, "gotranscode_live_viewers{stream=\"%s\"} %d\n", metricsLabelEscaper.Replace(stream), counts[stream])
+	}
+}
@@ -2,17 +2,29 @@ package config
 
 import (
 	"fmt"
+	"net/url"
 	"os"
-	"path"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+
+	"github.com/m1k1o/go-transcode/hlsvod"
+	"github.com/m1k1o/go-transcode/icy"
+	"github.com/m1k1o/go-transcode/internal/utils"
 )
 
 type Root struct {
 	Debug   bool
 	PProf   bool
+	LogAPI  bool
 	CfgFile string
+
+	Log utils.LogConfig
 }
 
 func (Root) Init(cmd *cobra.Command) error {
@@ -26,6 +38,11 @@ func (Root) Init(cmd *cobra.Command) error {
 		return err
 	}
 
+	cmd.PersistentFlags().Bool("log-api", false, "enable runtime log configuration endpoint available at /debug/log")
+	if err := viper.BindPFlag("log-api", cmd.PersistentFlags().Lookup("log-api")); err != nil {
+		return err
+	}
+
 	cmd.PersistentFlags().String("config", "", "configuration file path")
 	if err := viper.BindPFlag("config", cmd.PersistentFlags().Lookup("config")); err != nil {
 		return err
@@ -37,31 +54,341 @@ func (Root) Init(cmd *cobra.Command) error {
 func (s *Root) Set() {
 	s.Debug = viper.GetBool("debug")
 	s.PProf = viper.GetBool("pprof")
+	s.LogAPI = viper.GetBool("log-api")
 	s.CfgFile = viper.GetString("config")
+
+	s.Log = utils.LogConfig{
+		Level:        viper.GetString("log.level"),
+		Modules:      viper.GetStringMapString("log.modules"),
+		SampleBurst:  viper.GetInt("log.sample-burst"),
+		SamplePeriod: viper.GetDuration("log.sample-period"),
+	}
+
+	if s.Debug {
+		s.Log.Level = "debug"
+	}
 }
 
 type VideoProfile struct {
-	Width   int `mapstructure:"width"`
-	Height  int `mapstructure:"height"`
-	Bitrate int `mapstructure:"bitrate"` // in kilobytes
+	Width         int    `mapstructure:"width"`
+	Height        int    `mapstructure:"height"`
+	Bitrate       int    `mapstructure:"bitrate"`        // in kilobytes
+	Passthrough   bool   `mapstructure:"passthrough"`    // copy compatible streams without encoding
+	Encoder       string `mapstructure:"encoder"`        // auto, software, nvenc or vaapi
+	VideoRange    string `mapstructure:"video-range"`    // SDR, PQ or HLG listed in master playlist
+	HDCPLevel     string `mapstructure:"hdcp-level"`     // NONE, TYPE-0 or TYPE-1 listed in master playlist
+	Preset        string `mapstructure:"preset"`         // x264 or x265 preset, overrides VOD preset
+	Codec         string `mapstructure:"codec"`          // h264 or hevc
+	SegmentFormat string `mapstructure:"segment-format"` // mpegts or fmp4, hevc requires fmp4
 }
 
 type AudioProfile struct {
 	Bitrate int `mapstructure:"bitrate"` // in kilobytes
 }
 
+// PlaylistVariant selects profiles offered in master playlist to matching
+// clients, e.g. HEVC profiles for Apple devices.
+type PlaylistVariant struct {
+	UserAgent string   `mapstructure:"user-agent"` // regular expression matched against User-Agent header
+	Profiles  []string `mapstructure:"profiles"`
+}
+
 type VOD struct {
 	MediaDir       string                  `mapstructure:"media-dir"`
 	TranscodeDir   string                  `mapstructure:"transcode-dir"`
+	TranscodeDirs  []string                `mapstructure:"transcode-dirs"` // additional transcode dirs on other volumes
+	Placement      string                  `mapstructure:"placement"`      // free-space or round-robin
+	MemoryDir      string                  `mapstructure:"memory-dir"`
+	MemoryMax      int64                   `mapstructure:"memory-max"` // in megabytes per session
+	SegmentsMax    int                     `mapstructure:"segments-max"`
+	OpenFiles      int                     `mapstructure:"open-files"` // opened segment files kept for reuse per session
+	ReadyTimeout   time.Duration           `mapstructure:"ready-timeout"`
+	Chunked        bool                    `mapstructure:"chunked-segments"` // stream segments while they are transcoded
+	EventPlaylist  bool                    `mapstructure:"event-playlist"`   // list segments as they are transcoded in background
+	MaxQuality     string                  `mapstructure:"max-quality"`      // generate bitrate ladder up to this height, e.g. 1080p
 	VideoProfiles  map[string]VideoProfile `mapstructure:"video-profiles"`
+	Preset         string                  `mapstructure:"preset"`    // x264 preset of profiles, auto picks one encoding ladder in real time on available CPUs
+	MaxLevel       string                  `mapstructure:"max-level"` // highest H.264 level of encoded profiles, e.g. 5.1
+	Variants       []PlaylistVariant       `mapstructure:"playlist-variants"`
+	PlaylistOrder  []string                `mapstructure:"playlist-order"` // profiles listed first in master playlist, the rest by bitrate
 	VideoKeyframes bool                    `mapstructure:"video-keyframes"`
+	Breakpoints    string                  `mapstructure:"breakpoints"`     // keyframe, fixed or scene
+	SceneThreshold float64                 `mapstructure:"scene-threshold"` // scene score from 0 to 1 considered as scene change
+	Preview        bool                    `mapstructure:"preview"`
+	SecondaryAudio bool                    `mapstructure:"secondary-audio"` // advertise audio descriptions and commentary tracks
+	Languages      []string                `mapstructure:"languages"`       // preferred languages of default audio track
+	AcceptLanguage bool                    `mapstructure:"accept-language"` // prefer languages accepted by client
+	LanguageMap    map[string]string       `mapstructure:"language-map"`    // language tags of mislabeled media replaced before normalization
+	AbrHint        bool                    `mapstructure:"abr-hint"`        // list profile fitting measured client throughput first
 	AudioProfile   AudioProfile            `mapstructure:"audio-profile"`
 	Cache          bool                    `mapstructure:"cache"`
 	CacheDir       string                  `mapstructure:"cache-dir"`
+	ObfuscateKey   string                  `mapstructure:"obfuscate-key"`   // hash file names in shared directories and encrypt cache
+	SegmentKey     string                  `mapstructure:"segment-key"`     // encrypt segment files on disk
+	Growing        bool                    `mapstructure:"growing"`         // extend playlists of media, that is still being written
+	GrowingPoll    time.Duration           `mapstructure:"growing-poll"`    // how often is growing media checked
+	GrowingIdle    time.Duration           `mapstructure:"growing-idle"`    // how long must media stay unchanged to be finished
+	SourceWatch    time.Duration           `mapstructure:"source-watch"`    // how often is media of sessions checked for replacement, 0 means disabled
+	BurnSubtitles  bool                    `mapstructure:"burn-subtitles"`  // allow rendering subtitle stream into video
+	ImageFramerate float64                 `mapstructure:"image-framerate"` // frame rate of image sequences and animated images
+	ProbeWorkers   int                     `mapstructure:"probe-workers"`   // parallel keyframe probes of long videos
 	FFmpegBinary   string                  `mapstructure:"ffmpeg-binary"`
 	FFprobeBinary  string                  `mapstructure:"ffprobe-binary"`
+	IONice         bool                    `mapstructure:"io-nice"`
+	Encoders       map[string]int          `mapstructure:"encoders"`           // maximum sessions per hardware encoder
+	EncoderProbe   int                     `mapstructure:"encoder-probe"`      // probe limits of unlisted hardware encoders up to this many sessions
+	EncoderMin     int                     `mapstructure:"encoder-min-height"` // auto renditions lower than this are encoded in software
+	EncoderPoll    time.Duration           `mapstructure:"encoder-poll"`       // how often is GPU utilization polled, 0 means disabled
+	EncoderMaxUtil float64                 `mapstructure:"encoder-max-util"`   // encode utilization in percent, at which hardware encoder is full
+	NvidiaSMI      string                  `mapstructure:"nvidia-smi-binary"`  // polled for utilization and sessions of NVENC
+	Transcoder     string                  `mapstructure:"transcoder"`         // ffmpeg or fake
+	BatchWindow    time.Duration           `mapstructure:"batch-window"`       // renditions of the same segments requested within window share decode, 0 means disabled
+	Encryption     bool                    `mapstructure:"encryption"`         // encrypt segments using AES-128
+	KeyRotation    int                     `mapstructure:"key-rotation"`       // number of segments encrypted by the same key, 0 means single key per session
+
+	// Renditions are pre-encoded into this directory in background, and
+	// segments are then only remuxed from them. Empty means disabled.
+	MezzanineDir string `mapstructure:"mezzanine-dir"`
+
+	// Bitmap subtitles (PGS, VobSub) are recognized by OCR binary (tesseract)
+	// in background and WebVTT tracks are stored in this directory. Empty
+	// means disabled.
+	SubtitlesDir string `mapstructure:"subtitles-dir"`
+	OCRBinary    string `mapstructure:"ocr-binary"`
+
+	// Clips exported to MP4 or WebM files are rendered into this directory,
+	// and removed after TTL. Empty means disabled.
+	ExportDir string        `mapstructure:"export-dir"`
+	ExportTTL time.Duration `mapstructure:"export-ttl"`
+
+	// Windows after likely seek destinations (chapter starts, every 1/N of
+	// duration and positions scrubbed in preview) are pre-transcoded at idle
+	// priority while media is played. Zero window means disabled.
+	SeekPrefetch  time.Duration `mapstructure:"seek-prefetch"`
+	SeekIntervals int           `mapstructure:"seek-intervals"`
+
+	// Media, whose probe failed this many times in a row, is quarantined
+	// and not probed again until it changes or is cleared by admin API.
+	// Quarantine is persisted in file, if set. Zero means disabled.
+	QuarantineAfter int    `mapstructure:"quarantine-after"`
+	QuarantineFile  string `mapstructure:"quarantine-file"`
+
+	// Cache data are stored in files (default), in memory of this instance,
+	// or in redis shared by multiple instances.
+	CacheStore CacheStore `mapstructure:"cache-store"`
+}
+
+// CacheStore of VOD metadata cache.
+type CacheStore struct {
+	Type       string        `mapstructure:"type"`        // file, memory or redis
+	MaxEntries int           `mapstructure:"max-entries"` // of memory store, 0 means unlimited
+	Addr       string        `mapstructure:"addr"`        // of redis server
+	Password   string        `mapstructure:"password"`
+	DB         int           `mapstructure:"db"`
+	Prefix     string        `mapstructure:"prefix"` // of redis keys
+	TTL        time.Duration `mapstructure:"ttl"`    // of redis keys, 0 means no expiration
+}
+
+// LivePublish pushes live segments and playlists to external origin.
+type LivePublish struct {
+	Type       string            `mapstructure:"type"`    // http (PUT, WebDAV) or s3
+	URL        string            `mapstructure:"url"`     // base URL of origin or S3 endpoint
+	Headers    map[string]string `mapstructure:"headers"` // additional headers of http uploads
+	Bucket     string            `mapstructure:"bucket"`
+	Region     string            `mapstructure:"region"`
+	AccessKey  string            `mapstructure:"access-key"`
+	SecretKey  string            `mapstructure:"secret-key"`
+	Workers    int               `mapstructure:"workers"`     // parallel segment uploads
+	QueueSize  int               `mapstructure:"queue-size"`  // segments waiting for upload, the oldest are dropped when full
+	Retries    int               `mapstructure:"retries"`     // attempts of failed upload
+	RetryDelay time.Duration     `mapstructure:"retry-delay"` // doubles with every attempt
+}
+
+// RemoteInputs configures connections to remote stream sources pulled by
+// ffmpeg and to upstreams of HLS proxy, e.g. where direct egress is blocked.
+type RemoteInputs struct {
+	Proxy         string        `mapstructure:"proxy"`          // http, https or socks5 proxy URL, ffmpeg supports only http
+	NoProxy       []string      `mapstructure:"no-proxy"`       // hosts, domains or CIDRs connected directly
+	Network       string        `mapstructure:"network"`        // tcp (dual stack), tcp4 or tcp6, ffmpeg always uses dual stack
+	FallbackDelay time.Duration `mapstructure:"fallback-delay"` // happy eyeballs delay before racing other address family
+	Timeout       time.Duration `mapstructure:"timeout"`        // connect and read timeout, 0 means default
+	Reconnect     bool          `mapstructure:"reconnect"`      // ffmpeg reconnects dropped HTTP inputs
+}
+
+// LiveDetect analyzes live inputs and alerts, when they are silent or black.
+type LiveDetect struct {
+	Silence      time.Duration `mapstructure:"silence"`       // 0 means disabled
+	SilenceNoise string        `mapstructure:"silence-noise"` // noise tolerance, e.g. -50dB
+	Black        time.Duration `mapstructure:"black"`         // 0 means disabled
+	BlackAmount  int           `mapstructure:"black-amount"`  // percentage of pixels, that must be black
+}
+
+// LiveAdaptive restarts live sessions with faster profile settings, when
+// encoding is slower than real-time.
+type LiveAdaptive struct {
+	MinSpeed float64       `mapstructure:"min-speed"` // real-time factor, 0 means disabled
+	Window   time.Duration `mapstructure:"window"`    // period, over which is speed measured
+}
+
+// InputOptions are ffmpeg input options (without leading dash) of live
+// streams, e.g. headers of protected upstream URLs.
+type InputOptions struct {
+	Allow   []string                     `mapstructure:"allow"`   // options, that can be set for sessions
+	Streams map[string]map[string]string `mapstructure:"streams"` // options of stream, empty value means flag
+}
+
+// Admin serves web UI for managing sessions.
+type Admin struct {
+	Route string `mapstructure:"route"` // mount path, empty means disabled
+	Token string `mapstructure:"token"` // bearer token or basic auth password, empty denies all requests
+}
+
+// SessionLogs persists command logs of sessions to rotating files.
+type SessionLogs struct {
+	Dir      string        `mapstructure:"dir"`       // empty means disabled
+	MaxSize  int64         `mapstructure:"max-size"`  // in megabytes, current file is rotated when it exceeds it
+	MaxAge   time.Duration `mapstructure:"max-age"`   // current file older than this is rotated, rotated are removed
+	MaxFiles int           `mapstructure:"max-files"` // rotated files kept per session
+}
+
+// Metrics exposes HTTP request histograms in Prometheus format.
+type Metrics struct {
+	Route    string `mapstructure:"route"`    // mount path, empty means disabled
+	Sessions bool   `mapstructure:"sessions"` // tag by session, number of series grows with sessions
+}
+
+// ContentSteering lists VOD renditions for every pathway (e.g. CDN) in master
+// playlists, players follow pathway priority of steering manifest.
+type ContentSteering struct {
+	TTL      time.Duration     `mapstructure:"ttl"`      // how often players reload steering manifest
+	Pathways []SteeringPathway `mapstructure:"pathways"` // empty means disabled, the first is default
+}
+
+// SignedURLs requires VOD requests to be signed with expiry, signatures are
+// compatible with CDN edge authorization, so that CDN can verify them too.
+type SignedURLs struct {
+	Scheme    string        `mapstructure:"scheme"`      // hmac, akamai or cloudfront, empty means disabled
+	Key       string        `mapstructure:"key"`         // hmac secret, hex akamai key or cloudfront PEM private key
+	KeyFile   string        `mapstructure:"key-file"`    // file with key, used when key is empty
+	KeyPairID string        `mapstructure:"key-pair-id"` // of cloudfront public key
+	BaseURL   string        `mapstructure:"base-url"`    // of cloudfront distribution, prepended to signed paths
+	Param     string        `mapstructure:"param"`       // query parameter of akamai token
+	TTL       time.Duration `mapstructure:"ttl"`         // default validity of signed URLs
+}
+
+// OriginProtection rejects direct public access to media routes, that are
+// meant to be requested only by CDN. Request is allowed, if it has shared
+// secret header or verified client certificate.
+type OriginProtection struct {
+	Header     string `mapstructure:"header"`      // header with secret, X-Origin-Secret by default
+	Secret     string `mapstructure:"secret"`      // shared secret sent by CDN, empty means not accepted
+	SecretFile string `mapstructure:"secret-file"` // file with secret, used when secret is empty
+	ClientCA   string `mapstructure:"client-ca"`   // PEM certificates of CAs of CDN client certificates, requires TLS
+}
+
+type SteeringPathway struct {
+	ID  string `mapstructure:"id"`
+	URL string `mapstructure:"url"` // base url of host, request path is appended
+}
+
+// HlsProxyTranscode replaces variant of proxied upstream stream with live
+// transcode of that variant.
+type HlsProxyTranscode struct {
+	Proxy   string `mapstructure:"proxy"`   // id of hls proxy
+	Variant string `mapstructure:"variant"` // path of variant playlist relative to proxy url
+	Profile string `mapstructure:"profile"` // live HLS profile used to transcode variant
+}
+
+// Overlay burns text into transcoded video, e.g. timestamp and stream name of
+// camera feeds or viewer-specific forensic watermark of screeners. Text may
+// contain {stream}, {viewer} (VOD only), {time} (wall clock) and {pts} (media
+// time) placeholders.
+type Overlay struct {
+	Text      string            `mapstructure:"text"`       // empty means disabled
+	Streams   map[string]string `mapstructure:"streams"`    // text of live streams, replaces text, empty disables overlay of stream
+	Vod       bool              `mapstructure:"vod"`        // burn text also into VOD renditions, every viewer gets own session with {viewer}
+	Position  string            `mapstructure:"position"`   // top-left, top-right, bottom-left, bottom-right or center
+	FontSize  int               `mapstructure:"font-size"`  // in px
+	FontColor string            `mapstructure:"font-color"` // ffmpeg color, e.g. white@0.8
+	FontFile  string            `mapstructure:"font-file"`  // default font of fontconfig, if empty
+	Box       bool              `mapstructure:"box"`        // draw semi-transparent box behind text
+}
+
+// Radio serves live streams as audio-only Icecast-compatible MP3 or AAC
+// streams with ICY metadata (now playing) for internet radio players.
+// Listeners of the same stream and format share single transcode.
+type Radio struct {
+	Streams map[string]RadioStream `mapstructure:"streams"` // by stream, only listed streams are served
+	MetaInt int                    `mapstructure:"metaint"` // audio bytes between metadata blocks
 }
 
+type RadioStream struct {
+	Name  string `mapstructure:"name"`  // icy-name, stream name by default
+	Genre string `mapstructure:"genre"` // icy-genre
+	URL   string `mapstructure:"url"`   // icy-url, e.g. website of station
+	Title string `mapstructure:"title"` // now playing, until it is changed by admin API
+}
+
+// FFmpegBuilds are pinned static builds of ffmpeg and ffprobe per platform,
+// that are downloaded into managed directory and used instead of binaries
+// found in PATH, also by profiles.
+type FFmpegBuilds struct {
+	Dir    string                 `mapstructure:"dir"`    // managed directory, empty means disabled
+	Builds map[string]FFmpegBuild `mapstructure:"builds"` // by platform, e.g. linux/amd64
+}
+
+type FFmpegBuild struct {
+	URL    string `mapstructure:"url"`    // .tar.gz, .tar.xz or .zip archive containing both binaries
+	SHA256 string `mapstructure:"sha256"` // checksum of archive
+}
+
+// Channel plays scheduled VOD media one after another as a simulated live
+// stream, e.g. a 24/7 linear channel built from media library.
+type Channel struct {
+	Profile string        `mapstructure:"profile"` // VOD video profile, that items are transcoded to
+	Start   string        `mapstructure:"start"`   // RFC 3339 time of the first item, empty means server start
+	Loop    bool          `mapstructure:"loop"`    // air items again after the last one, otherwise channel ends
+	Window  int           `mapstructure:"window"`  // segments in live playlist
+	Items   []ChannelItem `mapstructure:"items"`
+
+	StartTime time.Time `mapstructure:"-"` // parsed start
+}
+
+type ChannelItem struct {
+	Path  string `mapstructure:"path"`  // relative to VOD media directory
+	Title string `mapstructure:"title"` // shown in schedule, file name by default
+}
+
+type Limits struct {
+	Key            string `mapstructure:"key"`              // client is identified by "ip" or "token"
+	TokenHeader    string `mapstructure:"token-header"`     // header with token, token query parameter is used as fallback
+	MaxSessions    int    `mapstructure:"max-sessions"`     // maximum simultaneous sessions per client, 0 means unlimited
+	MaxNewSessions int    `mapstructure:"max-new-sessions"` // maximum new sessions per minute per client, 0 means unlimited
+	Status         int    `mapstructure:"status"`           // HTTP status of rejected requests
+	Message        string `mapstructure:"message"`          // message of rejected requests
+	RetryAfter     int    `mapstructure:"retry-after"`      // in seconds, 0 means no Retry-After header
+
+	// Data quota of client, that is rejected when it exceeds it, e.g. for
+	// metered deployments. Bytes served are counted also without quota.
+	Quota       int64         `mapstructure:"quota"`        // in megabytes per quota period, 0 means unlimited
+	QuotaPeriod time.Duration `mapstructure:"quota-period"` // when bytes served to client are reset
+}
+
+// ffmpeg option names allowed in input options
+var inputOptionRegex = regexp.MustCompile(`^[a-z0-9_]+$`)
+
+// pathway ids allowed by HLS content steering
+var steeringPathwayRegex = regexp.MustCompile(`^[0-9A-Za-z._-]+$`)
+
+// channel ids are used as single path element
+var channelIDRegex = regexp.MustCompile(`^[0-9A-Za-z._-]+$`)
+
+// platforms of ffmpeg builds are GOOS/GOARCH
+var ffmpegPlatformRegex = regexp.MustCompile(`^[a-z0-9]+/[a-z0-9]+$`)
+
+// pinned checksums of ffmpeg builds
+var sha256Regex = regexp.MustCompile(`^[0-9A-Fa-f]{64}$`)
+
 type Server struct {
 	Cert   string
 	Key    string
@@ -73,8 +400,31 @@ type Server struct {
 	Streams  map[string]string `yaml:"streams"`
 	Profiles string            `yaml:"profiles,omitempty"`
 
-	Vod      VOD
-	HlsProxy map[string]string
+	SourceIdleTimeout  time.Duration // stop live session, if source produces no new data
+	SourceIdleRestarts int           // restart attempts of live session after source was idle
+	DVRWindow          time.Duration // keep live segments for time-shifted playback, 0 means disabled
+	ViewerTimeout      time.Duration // live viewer, that did not request stream for this period, has left
+	ErrorFormat        string        // text or json error responses, empty means default of every module
+
+	Vod               VOD
+	HlsProxy          map[string]string
+	HlsProxyTranscode []HlsProxyTranscode
+	Channels          map[string]Channel
+	Overlay           Overlay
+	Radio             Radio
+	FFmpegBuilds      FFmpegBuilds
+	Limits            Limits
+	LivePublish       LivePublish
+	RemoteInputs      RemoteInputs
+	LiveDetect        LiveDetect
+	LiveAdaptive      LiveAdaptive
+	InputOptions      InputOptions
+	ContentSteering   ContentSteering
+	Admin             Admin
+	Metrics           Metrics
+	SessionLogs       SessionLogs
+	SignedURLs        SignedURLs
+	OriginProtection  OriginProtection
 }
 
 func (Server) Init(cmd *cobra.Command) error {
@@ -136,9 +486,20 @@ func (s *Server) Set() {
 	s.Profiles = viper.GetString("profiles")
 	if s.Profiles == "" {
 		// TODO: issue #5
-		s.Profiles = fmt.Sprintf("%s/profiles", s.BaseDir)
+		s.Profiles = filepath.Join(s.BaseDir, "profiles")
 	}
 	s.Streams = viper.GetStringMapString("streams")
+	s.SourceIdleTimeout = viper.GetDuration("source-idle-timeout")
+	s.SourceIdleRestarts = viper.GetInt("source-idle-restarts")
+	s.DVRWindow = viper.GetDuration("dvr-window")
+	s.ViewerTimeout = viper.GetDuration("viewer-timeout")
+
+	s.ErrorFormat = viper.GetString("error-format")
+	switch s.ErrorFormat {
+	case "", "text", "json":
+	default:
+		panic(fmt.Sprintf("unknown error format %q", s.ErrorFormat))
+	}
 
 	//
 	// VOD
@@ -162,8 +523,216 @@ func (s *Server) Set() {
 		}
 	}
 
+	for _, dir := range s.Vod.TranscodeDirs {
+		err := os.MkdirAll(dir, 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	switch s.Vod.Placement {
+	case "":
+		s.Vod.Placement = "free-space"
+	case "free-space", "round-robin":
+	default:
+		panic(fmt.Sprintf("unknown VOD placement %q", s.Vod.Placement))
+	}
+
+	if s.Vod.MemoryDir != "" {
+		err := os.MkdirAll(s.Vod.MemoryDir, 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if s.Vod.MezzanineDir != "" {
+		err := os.MkdirAll(s.Vod.MezzanineDir, 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if s.Vod.SubtitlesDir != "" {
+		err := os.MkdirAll(s.Vod.SubtitlesDir, 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if s.Vod.ExportDir != "" {
+		err := os.MkdirAll(s.Vod.ExportDir, 0755)
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	if s.Vod.ExportTTL <= 0 {
+		s.Vod.ExportTTL = time.Hour
+	}
+
+	if s.Vod.OCRBinary == "" {
+		s.Vod.OCRBinary = "tesseract"
+	}
+
+	// generated profiles are overridden by profiles of the same name
+	if s.Vod.MaxQuality != "" {
+		profiles, err := ladderProfiles(s.Vod.MaxQuality)
+		if err != nil {
+			panic(fmt.Sprintf("VOD max quality: %v", err))
+		}
+
+		for profileID, profile := range s.Vod.VideoProfiles {
+			profiles[profileID] = profile
+		}
+
+		s.Vod.VideoProfiles = profiles
+	}
+
 	if len(s.Vod.VideoProfiles) == 0 {
-		panic("specify at least one VOD video profile")
+		panic("specify at least one VOD video profile or VOD max quality")
+	}
+
+	maxLevel := hlsvod.DefaultMaxLevel
+	if s.Vod.MaxLevel != "" {
+		level, err := hlsvod.ParseLevel(s.Vod.MaxLevel)
+		if err != nil {
+			panic(fmt.Sprintf("VOD max level: %v", err))
+		}
+		maxLevel = level
+	}
+
+	for profileID, profile := range s.Vod.VideoProfiles {
+		switch profile.Encoder {
+		case "", "auto", "software", "nvenc", "vaapi":
+		default:
+			panic(fmt.Sprintf("VOD video profile %q uses unknown encoder %q", profileID, profile.Encoder))
+		}
+
+		// encoded renditions are always SDR, range of passthrough depends on source
+		switch profile.VideoRange {
+		case "":
+			if !profile.Passthrough {
+				profile.VideoRange = "SDR"
+			}
+		case "SDR", "PQ", "HLG":
+		default:
+			panic(fmt.Sprintf("VOD video profile %q uses unknown video range %q", profileID, profile.VideoRange))
+		}
+
+		switch profile.HDCPLevel {
+		case "", "NONE", "TYPE-0", "TYPE-1":
+		default:
+			panic(fmt.Sprintf("VOD video profile %q uses unknown HDCP level %q", profileID, profile.HDCPLevel))
+		}
+
+		switch profile.Codec {
+		case "", hlsvod.CodecH264, hlsvod.CodecHEVC:
+		default:
+			panic(fmt.Sprintf("VOD video profile %q uses unknown codec %q", profileID, profile.Codec))
+		}
+
+		switch profile.SegmentFormat {
+		case "":
+			// Apple players play HEVC only from fMP4 segments
+			if profile.Codec == hlsvod.CodecHEVC {
+				profile.SegmentFormat = hlsvod.SegmentFormatFMP4
+			}
+		case hlsvod.SegmentFormatTS, hlsvod.SegmentFormatFMP4:
+		default:
+			panic(fmt.Sprintf("VOD video profile %q uses unknown segment format %q", profileID, profile.SegmentFormat))
+		}
+
+		if profile.Codec == hlsvod.CodecHEVC {
+			if profile.SegmentFormat != hlsvod.SegmentFormatFMP4 {
+				panic(fmt.Sprintf("VOD video profile %q with hevc codec requires fmp4 segment format", profileID))
+			}
+
+			if profile.Passthrough {
+				panic(fmt.Sprintf("VOD video profile %q with hevc codec cannot use passthrough", profileID))
+			}
+		}
+
+		// 4:2:0 chroma has half resolution of luma
+		if profile.Width <= 0 || profile.Height <= 0 || profile.Width%2 != 0 || profile.Height%2 != 0 {
+			panic(fmt.Sprintf("VOD video profile %q resolution %dx%d must have positive even dimensions", profileID, profile.Width, profile.Height))
+		}
+
+		// frame rate of media is not known yet, sessions check it again,
+		// x265 picks HEVC level by itself
+		if level := hlsvod.H264Level(profile.Width, profile.Height, 30, profile.Bitrate); profile.Codec != hlsvod.CodecHEVC && (level == 0 || level > maxLevel) {
+			panic(fmt.Sprintf("VOD video profile %q %dx%d at %d kbps exceeds H.264 level %d.%d at 30 fps", profileID, profile.Width, profile.Height, profile.Bitrate, maxLevel/10, maxLevel%10))
+		}
+
+		if profile.Preset != "" && !hlsvod.ValidPreset(profile.Preset) {
+			panic(fmt.Sprintf("VOD video profile %q uses unknown preset %q", profileID, profile.Preset))
+		}
+
+		s.Vod.VideoProfiles[profileID] = profile
+	}
+
+	// presets are picked once at startup, so that the same profile is always
+	// encoded the same way
+	switch s.Vod.Preset {
+	case "":
+	case "auto":
+		profiles := map[string]hlsvod.VideoProfile{}
+		for profileID, profile := range s.Vod.VideoProfiles {
+			// passthrough and hardware encoded profiles do not load CPU
+			if profile.Passthrough || profile.Encoder == "nvenc" || profile.Encoder == "vaapi" {
+				continue
+			}
+
+			profiles[profileID] = hlsvod.VideoProfile{
+				Width:  profile.Width,
+				Height: profile.Height,
+				Preset: profile.Preset,
+			}
+		}
+
+		for profileID, preset := range hlsvod.AutoPresets(profiles, utils.AvailableCPUs()) {
+			profile := s.Vod.VideoProfiles[profileID]
+			profile.Preset = preset
+			s.Vod.VideoProfiles[profileID] = profile
+		}
+	default:
+		if !hlsvod.ValidPreset(s.Vod.Preset) {
+			panic(fmt.Sprintf("unknown VOD preset %q", s.Vod.Preset))
+		}
+
+		for profileID, profile := range s.Vod.VideoProfiles {
+			if profile.Preset == "" {
+				profile.Preset = s.Vod.Preset
+				s.Vod.VideoProfiles[profileID] = profile
+			}
+		}
+	}
+
+	for _, profileID := range s.Vod.PlaylistOrder {
+		if _, ok := s.Vod.VideoProfiles[profileID]; !ok {
+			panic(fmt.Sprintf("VOD playlist order uses unknown video profile %q", profileID))
+		}
+	}
+
+	for encoder := range s.Vod.Encoders {
+		if encoder != "nvenc" && encoder != "vaapi" {
+			panic(fmt.Sprintf("unknown VOD hardware encoder %q", encoder))
+		}
+	}
+
+	if s.Vod.EncoderMaxUtil < 0 || s.Vod.EncoderMaxUtil > 100 {
+		panic(fmt.Sprintf("VOD encoder max utilization %v must be between 0 and 100", s.Vod.EncoderMaxUtil))
+	}
+
+	for _, variant := range s.Vod.Variants {
+		if _, err := regexp.Compile(variant.UserAgent); err != nil {
+			panic(err)
+		}
+
+		for _, profileID := range variant.Profiles {
+			if _, ok := s.Vod.VideoProfiles[profileID]; !ok {
+				panic(fmt.Sprintf("VOD playlist variant uses unknown video profile %q", profileID))
+			}
+		}
 	}
 
 	if s.Vod.Cache && s.Vod.CacheDir != "" {
@@ -173,22 +742,490 @@ func (s *Server) Set() {
 		}
 	}
 
+	switch s.Vod.CacheStore.Type {
+	case "":
+		s.Vod.CacheStore.Type = "file"
+	case "file", "memory":
+	case "redis":
+		if s.Vod.CacheStore.Addr == "" {
+			panic("VOD redis cache store requires addr")
+		}
+	default:
+		panic(fmt.Sprintf("unknown VOD cache store %q", s.Vod.CacheStore.Type))
+	}
+
+	if s.Vod.Breakpoints == "" {
+		s.Vod.Breakpoints = "keyframe"
+	}
+
+	if s.Vod.Breakpoints != "keyframe" && s.Vod.Breakpoints != "fixed" && s.Vod.Breakpoints != "scene" {
+		panic("vod breakpoints must be keyframe, fixed or scene")
+	}
+
+	if s.Vod.SceneThreshold == 0 {
+		s.Vod.SceneThreshold = 0.4
+	}
+
+	if s.Vod.SceneThreshold < 0 || s.Vod.SceneThreshold > 1 {
+		panic("vod scene threshold must be between 0 and 1")
+	}
+
+	if s.Vod.ImageFramerate < 0 {
+		panic("vod image framerate must not be negative")
+	}
+
+	if s.Vod.ProbeWorkers < 0 {
+		panic("vod probe workers must not be negative")
+	}
+
+	if s.Vod.ProbeWorkers == 0 {
+		s.Vod.ProbeWorkers = runtime.NumCPU()
+	}
+
+	if s.Vod.SeekPrefetch < 0 || s.Vod.SeekIntervals < 0 {
+		panic("vod seek prefetch and intervals must not be negative")
+	}
+
+	if s.Vod.SeekIntervals == 0 {
+		s.Vod.SeekIntervals = 10
+	}
+
+	if s.Vod.QuarantineAfter < 0 {
+		panic("vod quarantine after must not be negative")
+	}
+
 	if s.Vod.FFmpegBinary == "" {
-		s.Vod.FFmpegBinary = "ffmpeg"
+		s.Vod.FFmpegBinary = utils.BinaryName("ffmpeg")
 	}
 
 	if s.Vod.FFprobeBinary == "" {
-		s.Vod.FFprobeBinary = "ffprobe"
+		s.Vod.FFprobeBinary = utils.BinaryName("ffprobe")
+	}
+
+	if s.Vod.NvidiaSMI == "" {
+		s.Vod.NvidiaSMI = utils.BinaryName("nvidia-smi")
+	}
+
+	//
+	// LIMITS
+	//
+	if err := viper.UnmarshalKey("limits", &s.Limits); err != nil {
+		panic(err)
+	}
+
+	if s.Limits.Key == "" {
+		s.Limits.Key = "ip"
+	}
+
+	if s.Limits.Key != "ip" && s.Limits.Key != "token" {
+		panic("limits key must be ip or token")
+	}
+
+	if s.Limits.TokenHeader == "" {
+		s.Limits.TokenHeader = "Authorization"
+	}
+
+	if s.Limits.Status == 0 {
+		s.Limits.Status = 429
+	}
+
+	if s.Limits.Quota < 0 {
+		panic(fmt.Sprintf("limits quota must not be negative, got %d", s.Limits.Quota))
+	}
+
+	if s.Limits.QuotaPeriod == 0 {
+		s.Limits.QuotaPeriod = 24 * time.Hour
+	}
+
+	//
+	// LIVE PUBLISH
+	//
+	if err := viper.UnmarshalKey("live-publish", &s.LivePublish); err != nil {
+		panic(err)
+	}
+
+	if s.LivePublish.URL != "" {
+		switch s.LivePublish.Type {
+		case "":
+			s.LivePublish.Type = "http"
+		case "http":
+		case "s3":
+			if s.LivePublish.Bucket == "" || s.LivePublish.Region == "" {
+				panic("live publish to s3 requires bucket and region")
+			}
+		default:
+			panic(fmt.Sprintf("unknown live publish type %q", s.LivePublish.Type))
+		}
+	}
+
+	//
+	// LIVE DETECT
+	//
+	if err := viper.UnmarshalKey("live-detect", &s.LiveDetect); err != nil {
+		panic(err)
+	}
+
+	if s.LiveDetect.SilenceNoise == "" {
+		s.LiveDetect.SilenceNoise = "-50dB"
+	}
+
+	if s.LiveDetect.BlackAmount == 0 {
+		s.LiveDetect.BlackAmount = 98
+	}
+
+	//
+	// LIVE ADAPTIVE
+	//
+	if err := viper.UnmarshalKey("live-adaptive", &s.LiveAdaptive); err != nil {
+		panic(err)
+	}
+
+	if s.LiveAdaptive.MinSpeed < 0 {
+		panic(fmt.Sprintf("live-adaptive min-speed must not be negative, got %v", s.LiveAdaptive.MinSpeed))
+	}
+
+	if s.LiveAdaptive.Window == 0 {
+		s.LiveAdaptive.Window = 30 * time.Second
+	}
+
+	//
+	// INPUT OPTIONS
+	//
+	if err := viper.UnmarshalKey("input-options", &s.InputOptions); err != nil {
+		panic(err)
+	}
+
+	if s.InputOptions.Allow == nil {
+		s.InputOptions.Allow = []string{"headers", "cookies", "user_agent", "stream_loop", "re", "ss"}
+	}
+
+	allowed := map[string]bool{}
+	for _, name := range s.InputOptions.Allow {
+		if !inputOptionRegex.MatchString(name) {
+			panic(fmt.Sprintf("invalid input option %q", name))
+		}
+		allowed[name] = true
+	}
+
+	for stream, options := range s.InputOptions.Streams {
+		if _, ok := s.Streams[stream]; !ok {
+			panic(fmt.Sprintf("input options of unknown stream %q", stream))
+		}
+
+		for name := range options {
+			if !allowed[name] {
+				panic(fmt.Sprintf("input option %q of stream %q is not allowed", name, stream))
+			}
+		}
+	}
+
+	//
+	// ADMIN
+	//
+	if err := viper.UnmarshalKey("admin", &s.Admin); err != nil {
+		panic(err)
+	}
+
+	if s.Admin.Route != "" && !strings.HasPrefix(s.Admin.Route, "/") {
+		s.Admin.Route = "/" + s.Admin.Route
+	}
+	s.Admin.Route = strings.TrimSuffix(s.Admin.Route, "/")
+
+	//
+	// SESSION LOGS
+	//
+	if err := viper.UnmarshalKey("session-logs", &s.SessionLogs); err != nil {
+		panic(err)
+	}
+
+	if s.SessionLogs.Dir != "" {
+		if err := os.MkdirAll(s.SessionLogs.Dir, 0755); err != nil {
+			panic(err)
+		}
+	}
+
+	if s.SessionLogs.MaxSize == 0 {
+		s.SessionLogs.MaxSize = 10
+	}
+
+	if s.SessionLogs.MaxAge == 0 {
+		s.SessionLogs.MaxAge = 7 * 24 * time.Hour
+	}
+
+	if s.SessionLogs.MaxFiles == 0 {
+		s.SessionLogs.MaxFiles = 5
+	}
+
+	//
+	// CONTENT STEERING
+	//
+	if err := viper.UnmarshalKey("content-steering", &s.ContentSteering); err != nil {
+		panic(err)
+	}
+
+	if s.ContentSteering.TTL == 0 {
+		s.ContentSteering.TTL = 5 * time.Minute
+	}
+
+	pathways := map[string]bool{}
+	for i, pathway := range s.ContentSteering.Pathways {
+		if !steeringPathwayRegex.MatchString(pathway.ID) {
+			panic(fmt.Sprintf("invalid content steering pathway id %q", pathway.ID))
+		}
+
+		if pathways[pathway.ID] {
+			panic(fmt.Sprintf("content steering pathway %q is used multiple times", pathway.ID))
+		}
+		pathways[pathway.ID] = true
+
+		if pathway.URL == "" {
+			panic(fmt.Sprintf("content steering pathway %q must have url", pathway.ID))
+		}
+
+		s.ContentSteering.Pathways[i].URL = strings.TrimSuffix(pathway.URL, "/")
+	}
+
+	//
+	// REMOTE INPUTS
+	//
+	if err := viper.UnmarshalKey("remote-inputs", &s.RemoteInputs); err != nil {
+		panic(err)
+	}
+
+	if s.RemoteInputs.Proxy != "" {
+		proxy, err := url.Parse(s.RemoteInputs.Proxy)
+		if err != nil {
+			panic(fmt.Sprintf("invalid remote inputs proxy: %v", err))
+		}
+
+		switch proxy.Scheme {
+		case "http", "https", "socks5":
+		default:
+			panic(fmt.Sprintf("unsupported remote inputs proxy scheme %q", proxy.Scheme))
+		}
+	}
+
+	switch s.RemoteInputs.Network {
+	case "":
+		s.RemoteInputs.Network = "tcp"
+	case "tcp", "tcp4", "tcp6":
+	default:
+		panic(fmt.Sprintf("unknown remote inputs network %q", s.RemoteInputs.Network))
+	}
+
+	//
+	// METRICS
+	//
+	if err := viper.UnmarshalKey("metrics", &s.Metrics); err != nil {
+		panic(err)
+	}
+
+	if s.Metrics.Route != "" && !strings.HasPrefix(s.Metrics.Route, "/") {
+		s.Metrics.Route = "/" + s.Metrics.Route
+	}
+
+	//
+	// SIGNED URLS
+	//
+	if err := viper.UnmarshalKey("signed-urls", &s.SignedURLs); err != nil {
+		panic(err)
+	}
+
+	switch s.SignedURLs.Scheme {
+	case "":
+	case "hmac", "akamai", "cloudfront":
+		if s.SignedURLs.Key == "" && s.SignedURLs.KeyFile != "" {
+			key, err := os.ReadFile(s.SignedURLs.KeyFile)
+			if err != nil {
+				panic(err)
+			}
+			s.SignedURLs.Key = strings.TrimSpace(string(key))
+		}
+
+		if s.SignedURLs.Key == "" {
+			panic(fmt.Sprintf("signed URLs scheme %q requires key", s.SignedURLs.Scheme))
+		}
+
+		if s.SignedURLs.Scheme == "cloudfront" && s.SignedURLs.KeyPairID == "" {
+			panic("signed URLs scheme \"cloudfront\" requires key pair id")
+		}
+
+		s.SignedURLs.BaseURL = strings.TrimSuffix(s.SignedURLs.BaseURL, "/")
+	default:
+		panic(fmt.Sprintf("unknown signed URLs scheme %q", s.SignedURLs.Scheme))
+	}
+
+	if s.SignedURLs.TTL == 0 {
+		s.SignedURLs.TTL = time.Hour
+	}
+
+	//
+	// ORIGIN PROTECTION
+	//
+	if err := viper.UnmarshalKey("origin-protection", &s.OriginProtection); err != nil {
+		panic(err)
+	}
+
+	if s.OriginProtection.Secret == "" && s.OriginProtection.SecretFile != "" {
+		secret, err := os.ReadFile(s.OriginProtection.SecretFile)
+		if err != nil {
+			panic(err)
+		}
+		s.OriginProtection.Secret = strings.TrimSpace(string(secret))
+	}
+
+	if s.OriginProtection.Header == "" {
+		s.OriginProtection.Header = "X-Origin-Secret"
+	}
+
+	if s.OriginProtection.ClientCA != "" && (s.Cert == "" || s.Key == "") {
+		panic("origin protection client-ca requires cert and key")
 	}
 
 	//
 	// HLS PROXY
 	//
 	s.HlsProxy = viper.GetStringMapString("hls-proxy")
+
+	if err := viper.UnmarshalKey("hls-proxy-transcode", &s.HlsProxyTranscode); err != nil {
+		panic(err)
+	}
+
+	profiles := map[string]bool{}
+	for i, transcode := range s.HlsProxyTranscode {
+		if _, ok := s.HlsProxy[transcode.Proxy]; !ok {
+			panic(fmt.Sprintf("HLS proxy transcode uses unknown HLS proxy %q", transcode.Proxy))
+		}
+
+		if transcode.Variant == "" || transcode.Profile == "" {
+			panic(fmt.Sprintf("HLS proxy transcode of %q must have variant and profile", transcode.Proxy))
+		}
+
+		// variant is transcoded by session of proxy and profile
+		key := transcode.Proxy + "/" + transcode.Profile
+		if profiles[key] {
+			panic(fmt.Sprintf("HLS proxy transcode profile %q is used multiple times for %q", transcode.Profile, transcode.Proxy))
+		}
+		profiles[key] = true
+
+		s.HlsProxyTranscode[i].Variant = strings.TrimPrefix(transcode.Variant, "/")
+	}
+
+	//
+	// OVERLAY
+	//
+	if err := viper.UnmarshalKey("overlay", &s.Overlay); err != nil {
+		panic(err)
+	}
+
+	if !hlsvod.ValidOverlayPosition(s.Overlay.Position) {
+		panic(fmt.Sprintf("unknown overlay position %q", s.Overlay.Position))
+	}
+
+	for stream := range s.Overlay.Streams {
+		if _, ok := s.Streams[stream]; !ok {
+			panic(fmt.Sprintf("overlay of unknown stream %q", stream))
+		}
+	}
+
+	//
+	// RADIO
+	//
+	if err := viper.UnmarshalKey("radio", &s.Radio); err != nil {
+		panic(err)
+	}
+
+	if s.Radio.MetaInt < 0 {
+		panic("radio metaint must not be negative")
+	}
+
+	if s.Radio.MetaInt == 0 {
+		s.Radio.MetaInt = icy.DefaultMetaInt
+	}
+
+	for input, stream := range s.Radio.Streams {
+		if _, ok := s.Streams[input]; !ok {
+			panic(fmt.Sprintf("radio of unknown stream %q", input))
+		}
+
+		if stream.Name == "" {
+			stream.Name = input
+		}
+
+		s.Radio.Streams[input] = stream
+	}
+
+	//
+	// FFMPEG BUILDS
+	//
+	if err := viper.UnmarshalKey("ffmpeg-builds", &s.FFmpegBuilds); err != nil {
+		panic(err)
+	}
+
+	for platform, build := range s.FFmpegBuilds.Builds {
+		if !ffmpegPlatformRegex.MatchString(platform) {
+			panic(fmt.Sprintf("invalid ffmpeg build platform %q, expected os/arch", platform))
+		}
+
+		if build.URL == "" {
+			panic(fmt.Sprintf("ffmpeg build of %q has no url", platform))
+		}
+
+		if !sha256Regex.MatchString(build.SHA256) {
+			panic(fmt.Sprintf("ffmpeg build of %q has invalid sha256 checksum", platform))
+		}
+	}
+
+	//
+	// CHANNELS
+	//
+	if err := viper.UnmarshalKey("channels", &s.Channels); err != nil {
+		panic(err)
+	}
+
+	started := time.Now()
+	for id, channel := range s.Channels {
+		if !channelIDRegex.MatchString(id) {
+			panic(fmt.Sprintf("invalid channel id %q", id))
+		}
+
+		if s.Vod.MediaDir == "" {
+			panic(fmt.Sprintf("channel %q requires VOD media directory", id))
+		}
+
+		if _, ok := s.Vod.VideoProfiles[channel.Profile]; !ok {
+			panic(fmt.Sprintf("channel %q uses unknown VOD profile %q", id, channel.Profile))
+		}
+
+		if len(channel.Items) == 0 {
+			panic(fmt.Sprintf("channel %q has no items", id))
+		}
+
+		channel.StartTime = started
+		if channel.Start != "" {
+			start, err := time.Parse(time.RFC3339, channel.Start)
+			if err != nil {
+				panic(fmt.Sprintf("invalid start of channel %q: %v", id, err))
+			}
+			channel.StartTime = start
+		}
+
+		for i, item := range channel.Items {
+			if item.Path == "" {
+				panic(fmt.Sprintf("item %d of channel %q has no path", i, id))
+			}
+
+			if item.Title == "" {
+				channel.Items[i].Title = strings.TrimSuffix(filepath.Base(item.Path), filepath.Ext(item.Path))
+			}
+		}
+
+		s.Channels[id] = channel
+	}
 }
 
 func (s *Server) AbsPath(elem ...string) string {
 	// prepend base path
 	elem = append([]string{s.BaseDir}, elem...)
-	return path.Join(elem...)
+	return filepath.Join(elem...)
 }
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// steps of Apple HLS authoring specification for 16:9 H.264 video, the
+// highest bitrate of each resolution is used
+var ladderSteps = []VideoProfile{
+	{Width: 416, Height: 234, Bitrate: 145},
+	{Width: 640, Height: 360, Bitrate: 365},
+	{Width: 768, Height: 432, Bitrate: 1100},
+	{Width: 960, Height: 540, Bitrate: 2000},
+	{Width: 1280, Height: 720, Bitrate: 4500},
+	{Width: 1920, Height: 1080, Bitrate: 7800},
+	{Width: 2560, Height: 1440, Bitrate: 12000},
+	{Width: 3840, Height: 2160, Bitrate: 20000},
+}
+
+// parses quality as height, e.g. 1080p or 1080
+func parseQuality(quality string) (int, error) {
+	height, err := strconv.Atoi(strings.TrimSuffix(strings.ToLower(quality), "p"))
+	if err != nil || height <= 0 {
+		return 0, fmt.Errorf("invalid quality %q, expected height e.g. 1080p", quality)
+	}
+
+	return height, nil
+}
+
+// returns video profiles of ladder steps up to max quality, they are named
+// by their height, e.g. 720p
+func ladderProfiles(maxQuality string) (map[string]VideoProfile, error) {
+	maxHeight, err := parseQuality(maxQuality)
+	if err != nil {
+		return nil, err
+	}
+
+	profiles := map[string]VideoProfile{}
+	for _, step := range ladderSteps {
+		if step.Height > maxHeight {
+			break
+		}
+
+		profiles[fmt.Sprintf("%dp", step.Height)] = step
+	}
+
+	if len(profiles) == 0 {
+		return nil, fmt.Errorf("quality %q is lower than the lowest ladder step %dp", maxQuality, ladderSteps[0].Height)
+	}
+
+	return profiles, nil
+}
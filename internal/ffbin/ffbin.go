@@ -0,0 +1,299 @@
+// Package ffbin downloads pinned static builds of ffmpeg and ffprobe into
+// managed directory, so that server can run on hosts without ffmpeg
+// packages. Archives are verified by their checksum before extraction.
+package ffbin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+// ErrChecksum is returned, when downloaded archive does not match pinned
+// checksum.
+var ErrChecksum = errors.New("checksum mismatch")
+
+// Build is pinned archive of static ffmpeg build.
+type Build struct {
+	URL    string // .tar.gz, .tgz, .tar.xz, .tar or .zip archive containing ffmpeg and ffprobe
+	SHA256 string // hex checksum of archive
+}
+
+// Binaries of installed build.
+type Binaries struct {
+	Dir     string // directory containing both binaries
+	FFmpeg  string
+	FFprobe string
+}
+
+// Platform returns key of builds for this host, e.g. linux/amd64.
+func Platform() string {
+	return runtime.GOOS + "/" + runtime.GOARCH
+}
+
+// Install returns binaries of build in dir, they are downloaded and
+// extracted, if they are not installed yet. Every build is installed into
+// its own subdirectory by platform and checksum, so that changed pin does
+// not reuse old binaries. If client is nil, default client is used.
+func Install(ctx context.Context, client *http.Client, dir string, build Build) (Binaries, error) {
+	sum := strings.ToLower(build.SHA256)
+	if len(sum) != sha256.Size*2 {
+		return Binaries{}, fmt.Errorf("invalid checksum %q", build.SHA256)
+	}
+
+	target := filepath.Join(dir, runtime.GOOS+"-"+runtime.GOARCH, sum[:16])
+	if bins, ok := installed(target); ok {
+		return bins, nil
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return Binaries{}, err
+	}
+
+	archive, err := download(ctx, client, build.URL, sum, dir)
+	if err != nil {
+		return Binaries{}, err
+	}
+	defer os.Remove(archive)
+
+	// extracted into temporary directory, so that interrupted install is
+	// not mistaken for installed build
+	tmp, err := os.MkdirTemp(dir, ".extract-*")
+	if err != nil {
+		return Binaries{}, err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := extract(ctx, archive, build.URL, tmp); err != nil {
+		return Binaries{}, fmt.Errorf("unable to extract %q: %w", build.URL, err)
+	}
+
+	if _, ok := installed(tmp); !ok {
+		return Binaries{}, fmt.Errorf("archive %q does not contain ffmpeg and ffprobe", build.URL)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return Binaries{}, err
+	}
+
+	// build might have been installed concurrently
+	if err := os.Rename(tmp, target); err != nil {
+		if bins, ok := installed(target); ok {
+			return bins, nil
+		}
+		return Binaries{}, err
+	}
+
+	bins, _ := installed(target)
+	return bins, nil
+}
+
+// returns binaries in dir, false if any of them is missing
+func installed(dir string) (Binaries, bool) {
+	bins := Binaries{
+		Dir:     dir,
+		FFmpeg:  filepath.Join(dir, utils.BinaryName("ffmpeg")),
+		FFprobe: filepath.Join(dir, utils.BinaryName("ffprobe")),
+	}
+
+	for _, path := range []string{bins.FFmpeg, bins.FFprobe} {
+		if fi, err := os.Stat(path); err != nil || !fi.Mode().IsRegular() {
+			return Binaries{}, false
+		}
+	}
+
+	return bins, true
+}
+
+// downloads url into temporary file in dir and verifies its checksum
+func download(ctx context.Context, client *http.Client, url, sum, dir string) (string, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unable to download %q: %s", url, resp.Status)
+	}
+
+	file, err := os.CreateTemp(dir, ".download-*")
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hash), resp.Body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("unable to download %q: %w", url, err)
+	}
+
+	if got := hex.EncodeToString(hash.Sum(nil)); got != sum {
+		os.Remove(file.Name())
+		return "", fmt.Errorf("%w of %q: got %s, want %s", ErrChecksum, url, got, sum)
+	}
+
+	return file.Name(), nil
+}
+
+// extracts ffmpeg and ffprobe from archive into dir, archive type is given
+// by extension of url, other files are skipped
+func extract(ctx context.Context, archive, url, dir string) error {
+	name := strings.ToLower(url)
+	if i := strings.IndexAny(name, "?#"); i >= 0 {
+		name = name[:i]
+	}
+
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return extractZip(archive, dir)
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		file, err := os.Open(archive)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+
+		return extractTar(gz, dir)
+	case strings.HasSuffix(name, ".tar.xz"):
+		// standard library has no xz decoder
+		cmd := exec.CommandContext(ctx, utils.BinaryName("xz"), "-dc", archive)
+		stdout, err := cmd.StdoutPipe()
+		if err != nil {
+			return err
+		}
+
+		if err := cmd.Start(); err != nil {
+			return err
+		}
+
+		err = extractTar(stdout, dir)
+		if err != nil {
+			// unblock xz writing rest of archive
+			_, _ = io.Copy(io.Discard, stdout)
+		}
+
+		if waitErr := cmd.Wait(); err == nil {
+			err = waitErr
+		}
+
+		return err
+	case strings.HasSuffix(name, ".tar"):
+		file, err := os.Open(archive)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		return extractTar(file, dir)
+	default:
+		return fmt.Errorf("unknown archive type")
+	}
+}
+
+// returns true, if file in archive is one of managed binaries
+func wanted(name string) bool {
+	name = filepath.Base(filepath.FromSlash(name))
+	return name == utils.BinaryName("ffmpeg") || name == utils.BinaryName("ffprobe")
+}
+
+func extractTar(reader io.Reader, dir string) error {
+	tr := tar.NewReader(reader)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg || !wanted(header.Name) {
+			continue
+		}
+
+		if err := writeBinary(tr, dir, header.Name); err != nil {
+			return err
+		}
+	}
+}
+
+func extractZip(archive, dir string) error {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+
+	for _, file := range zr.File {
+		if !file.Mode().IsRegular() || !wanted(file.Name) {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		err = writeBinary(reader, dir, file.Name)
+		reader.Close()
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// writes executable file named by base name of archived file
+func writeBinary(reader io.Reader, dir, name string) error {
+	path := filepath.Join(dir, filepath.Base(filepath.FromSlash(name)))
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(file, reader)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
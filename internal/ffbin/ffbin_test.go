@@ -0,0 +1,140 @@
+package ffbin
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
+)
+
+var testBinaries = map[string]string{
+	"ffmpeg-7.0-static/" + utils.BinaryName("ffmpeg"):  "ffmpeg binary",
+	"ffmpeg-7.0-static/" + utils.BinaryName("ffprobe"): "ffprobe binary",
+	"ffmpeg-7.0-static/readme.txt":                     "readme",
+}
+
+func testTarGz(t *testing.T) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+
+	for name, content := range testBinaries {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func testZip(t *testing.T) []byte {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	for name, content := range testBinaries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestInstall(t *testing.T) {
+	archives := map[string][]byte{
+		"/ffmpeg.tar.gz": testTarGz(t),
+		"/ffmpeg.zip":    testZip(t),
+	}
+
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		_, _ = w.Write(archives[r.URL.Path])
+	}))
+	defer server.Close()
+
+	for path, archive := range archives {
+		dir := t.TempDir()
+		build := Build{URL: server.URL + path, SHA256: checksum(archive)}
+
+		bins, err := Install(context.Background(), nil, dir, build)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		for file, want := range map[string]string{bins.FFmpeg: "ffmpeg binary", bins.FFprobe: "ffprobe binary"} {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatalf("%s: %v", path, err)
+			}
+			if string(data) != want {
+				t.Errorf("%s: %s = %q, want %q", path, file, data, want)
+			}
+		}
+
+		// installed build is not downloaded again
+		before := requests
+		again, err := Install(context.Background(), nil, dir, build)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if again != bins || requests != before {
+			t.Errorf("%s: installed build was downloaded again", path)
+		}
+	}
+}
+
+func TestInstallChecksumMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(testTarGz(t))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	_, err := Install(context.Background(), nil, dir, Build{URL: server.URL + "/ffmpeg.tar.gz", SHA256: checksum([]byte("other"))})
+	if !errors.Is(err, ErrChecksum) {
+		t.Fatalf("err = %v, want %v", err, ErrChecksum)
+	}
+
+	// nothing is left in managed directory
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("managed directory contains %d entries after failed install", len(entries))
+	}
+}
@@ -1,10 +1,14 @@
 package http
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/pprof"
+	"time"
 
 	"github.com/go-chi/chi"
+
+	"github.com/m1k1o/go-transcode/internal/utils"
 )
 
 func (s *HttpManagerCtx) WithDebugPProf(pathPrefix string) {
@@ -29,3 +33,59 @@ func (s *HttpManagerCtx) WithDebugPProf(pathPrefix string) {
 		})
 	})
 }
+
+// log config with human readable sample period
+type debugLogConfig struct {
+	Level        string            `json:"level"`
+	Modules      map[string]string `json:"modules"`
+	SampleBurst  int               `json:"sample_burst"`
+	SamplePeriod string            `json:"sample_period"`
+}
+
+func (s *HttpManagerCtx) WithDebugLog(pathPrefix string, filter *utils.LogFilter) {
+	s.router.Route(pathPrefix, func(r chi.Router) {
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			config := filter.Config()
+
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(debugLogConfig{
+				Level:        config.Level,
+				Modules:      config.Modules,
+				SampleBurst:  config.SampleBurst,
+				SamplePeriod: config.SamplePeriod.String(),
+			})
+		})
+
+		r.Put("/", func(w http.ResponseWriter, r *http.Request) {
+			var req debugLogConfig
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "400 invalid json", http.StatusBadRequest)
+				return
+			}
+
+			var samplePeriod time.Duration
+			if req.SamplePeriod != "" {
+				var err error
+				samplePeriod, err = time.ParseDuration(req.SamplePeriod)
+				if err != nil {
+					http.Error(w, "400 invalid sample period", http.StatusBadRequest)
+					return
+				}
+			}
+
+			err := filter.Set(utils.LogConfig{
+				Level:        req.Level,
+				Modules:      req.Modules,
+				SampleBurst:  req.SampleBurst,
+				SamplePeriod: samplePeriod,
+			})
+			if err != nil {
+				http.Error(w, "400 "+err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			s.logger.Info().Interface("config", req).Msg("log config changed")
+			w.WriteHeader(http.StatusNoContent)
+		})
+	})
+}
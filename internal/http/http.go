@@ -2,6 +2,9 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
 	"net/http"
 	"os"
 	"time"
@@ -19,6 +22,8 @@ type HttpManagerCtx struct {
 	config *config.Server
 	router *chi.Mux
 	http   *http.Server
+
+	metrics *requestMetrics
 }
 
 func New(config *config.Server) *HttpManagerCtx {
@@ -33,6 +38,14 @@ func New(config *config.Server) *HttpManagerCtx {
 		router.Use(middleware.RealIP)
 	}
 
+	// expose request histograms for Prometheus
+	var metrics *requestMetrics
+	if config.Metrics.Route != "" {
+		metrics = newRequestMetrics(config.Metrics.Sessions)
+		router.Use(metrics.Middleware)
+		router.Method(http.MethodGet, config.Metrics.Route, metrics)
+	}
+
 	// serve static files
 	if config.Static != "" {
 		fs := http.FileServer(http.Dir(config.Static))
@@ -55,9 +68,34 @@ func New(config *config.Server) *HttpManagerCtx {
 		config: config,
 		router: router,
 		http: &http.Server{
-			Addr:    config.Bind,
-			Handler: router,
+			Addr:      config.Bind,
+			Handler:   router,
+			TLSConfig: clientCATLSConfig(logger, config.OriginProtection.ClientCA),
 		},
+		metrics: metrics,
+	}
+}
+
+// returns TLS config verifying client certificates, that are given, against
+// CAs from PEM file, so that routes can require them, nil if path is empty
+func clientCATLSConfig(logger zerolog.Logger, path string) *tls.Config {
+	if path == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		logger.Panic().Err(err).Msg("unable to read client CA certificates")
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		logger.Panic().Str("path", path).Msg("no client CA certificates found")
+	}
+
+	return &tls.Config{
+		ClientCAs:  pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
 	}
 }
 
@@ -87,6 +125,13 @@ func (s *HttpManagerCtx) Shutdown() error {
 	return s.http.Shutdown(ctx)
 }
 
+// adds metrics written after request histograms, if metrics are enabled
+func (s *HttpManagerCtx) WithMetrics(fn func(w io.Writer)) {
+	if s.metrics != nil {
+		s.metrics.collect(fn)
+	}
+}
+
 func (s *HttpManagerCtx) Mount(fn func(r *chi.Mux)) {
 	fn(s.router)
 }
@@ -0,0 +1,188 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// upper bounds of request duration buckets in seconds
+var metricsDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// upper bounds of response size buckets in bytes
+var metricsSizeBuckets = []float64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 5 << 20, 10 << 20, 50 << 20}
+
+type histogram struct {
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(buckets []float64) *histogram {
+	return &histogram{
+		buckets: buckets,
+		counts:  make([]uint64, len(buckets)),
+	}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += value
+	h.count++
+}
+
+type metricsLabels struct {
+	route   string // playlist, segment or other
+	session string
+	code    int
+}
+
+// escapes label value in Prometheus text format
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (l metricsLabels) String() string {
+	return fmt.Sprintf(`route="%s",session="%s",code="%d"`, l.route, metricsLabelEscaper.Replace(l.session), l.code)
+}
+
+// requestMetrics collects request duration and response size histograms
+// separately for playlist and segment routes, so that manifest latency can
+// be told apart from segment latency.
+type requestMetrics struct {
+	mu       sync.Mutex
+	sessions bool
+	duration map[metricsLabels]*histogram
+	size     map[metricsLabels]*histogram
+
+	// metrics of other modules, e.g. gauges of hardware encoders
+	collectors []func(w io.Writer)
+}
+
+func newRequestMetrics(sessions bool) *requestMetrics {
+	return &requestMetrics{
+		sessions: sessions,
+		duration: map[metricsLabels]*histogram{},
+		size:     map[metricsLabels]*histogram{},
+	}
+}
+
+func (m *requestMetrics) collect(fn func(w io.Writer)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.collectors = append(m.collectors, fn)
+}
+
+// returns route kind by requested file
+func metricsRoute(urlPath string) string {
+	switch path.Ext(urlPath) {
+	case ".m3u8", ".mpd":
+		return "playlist"
+	case ".ts", ".m4s", ".mp4", ".m4a", ".aac", ".vtt":
+		return "segment"
+	default:
+		return "other"
+	}
+}
+
+func (m *requestMetrics) observe(r *http.Request, status, bytes int, elapsed time.Duration) {
+	labels := metricsLabels{
+		route: metricsRoute(r.URL.Path),
+		code:  status,
+	}
+
+	// session is identified by directory of its playlists and segments
+	if m.sessions && labels.route != "other" {
+		labels.session = path.Dir(r.URL.Path)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	duration, ok := m.duration[labels]
+	if !ok {
+		duration = newHistogram(metricsDurationBuckets)
+		m.duration[labels] = duration
+	}
+	duration.observe(elapsed.Seconds())
+
+	size, ok := m.size[labels]
+	if !ok {
+		size = newHistogram(metricsSizeBuckets)
+		m.size[labels] = size
+	}
+	size.observe(float64(bytes))
+}
+
+func (m *requestMetrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		start := time.Now()
+
+		defer func() {
+			status := ww.Status()
+			if status == 0 {
+				status = http.StatusOK
+			}
+
+			m.observe(r, status, ww.BytesWritten(), time.Since(start))
+		}()
+
+		next.ServeHTTP(ww, r)
+	})
+}
+
+// writes histograms in Prometheus text exposition format
+func writeHistograms(w io.Writer, name, help string, histograms map[metricsLabels]*histogram) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s histogram\n", name)
+
+	labels := make([]metricsLabels, 0, len(histograms))
+	for l := range histograms {
+		labels = append(labels, l)
+	}
+
+	sort.Slice(labels, func(i, j int) bool {
+		return labels[i].String() < labels[j].String()
+	})
+
+	for _, l := range labels {
+		h := histograms[l]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket{%s,le=%q} %d\n", name, l, strconv.FormatFloat(bound, 'g', -1, 64), h.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, l, h.count)
+		fmt.Fprintf(w, "%s_sum{%s} %s\n", name, l, strconv.FormatFloat(h.sum, 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{%s} %d\n", name, l, h.count)
+	}
+}
+
+func (m *requestMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var b strings.Builder
+
+	m.mu.Lock()
+	writeHistograms(&b, "gotranscode_http_request_duration_seconds", "Duration of HTTP requests.", m.duration)
+	writeHistograms(&b, "gotranscode_http_response_size_bytes", "Size of HTTP responses.", m.size)
+	collectors := m.collectors
+	m.mu.Unlock()
+
+	for _, fn := range collectors {
+		fn(&b)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	_, _ = io.WriteString(w, b.String())
+}
@@ -1,6 +1,9 @@
 package transcode
 
 import (
+	"context"
+	"encoding/json"
+	"fmt"
 	"os"
 	"os/signal"
 
@@ -10,7 +13,9 @@ import (
 
 	"github.com/m1k1o/go-transcode/internal/api"
 	"github.com/m1k1o/go-transcode/internal/config"
+	"github.com/m1k1o/go-transcode/internal/ffbin"
 	"github.com/m1k1o/go-transcode/internal/http"
+	"github.com/m1k1o/go-transcode/internal/utils"
 )
 
 var Service *Main
@@ -25,6 +30,7 @@ func init() {
 type Main struct {
 	RootConfig   *config.Root
 	ServerConfig *config.Server
+	LogFilter    *utils.LogFilter
 
 	logger      zerolog.Logger
 	apiManager  *api.ApiManagerCtx
@@ -35,14 +41,60 @@ func (main *Main) Preflight() {
 	main.logger = log.With().Str("service", "main").Logger()
 }
 
+// installs pinned ffmpeg build of this platform, if it is configured, and
+// uses it instead of binaries found in PATH, binaries set explicitly in
+// config are kept
+func (main *Main) FFmpegInstall(ctx context.Context) (ffbin.Binaries, bool, error) {
+	config := main.ServerConfig
+	if config.FFmpegBuilds.Dir == "" {
+		return ffbin.Binaries{}, false, nil
+	}
+
+	build, ok := config.FFmpegBuilds.Builds[ffbin.Platform()]
+	if !ok {
+		return ffbin.Binaries{}, false, fmt.Errorf("no ffmpeg build pinned for %s", ffbin.Platform())
+	}
+
+	bins, err := ffbin.Install(ctx, nil, config.FFmpegBuilds.Dir, ffbin.Build{
+		URL:    build.URL,
+		SHA256: build.SHA256,
+	})
+	if err != nil {
+		return ffbin.Binaries{}, false, err
+	}
+
+	if config.Vod.FFmpegBinary == utils.BinaryName("ffmpeg") {
+		config.Vod.FFmpegBinary = bins.FFmpeg
+	}
+
+	if config.Vod.FFprobeBinary == utils.BinaryName("ffprobe") {
+		config.Vod.FFprobeBinary = bins.FFprobe
+	}
+
+	// profiles run ffmpeg found in PATH, also after config reload
+	if err := os.Setenv("PATH", bins.Dir+string(os.PathListSeparator)+os.Getenv("PATH")); err != nil {
+		return ffbin.Binaries{}, false, err
+	}
+
+	return bins, true, nil
+}
+
 func (main *Main) Start() {
 	config := main.ServerConfig
 
+	// system binaries are used, if pinned build is not available
+	if bins, ok, err := main.FFmpegInstall(context.Background()); err != nil {
+		main.logger.Err(err).Msg("unable to install ffmpeg build")
+	} else if ok {
+		main.logger.Info().Str("dir", bins.Dir).Msg("using pinned ffmpeg build")
+	}
+
 	main.apiManager = api.New(config)
 	main.apiManager.Start()
 
 	main.httpManager = http.New(config)
 	main.httpManager.Mount(main.apiManager.Mount)
+	main.httpManager.WithMetrics(main.apiManager.WriteMetrics)
 	main.httpManager.Start()
 
 	if main.RootConfig.PProf {
@@ -51,6 +103,12 @@ func (main *Main) Start() {
 		main.logger.Info().Msgf("mounted debug pprof endpoint at %s", pathPrefix)
 	}
 
+	if main.RootConfig.LogAPI && main.LogFilter != nil {
+		pathPrefix := "/debug/log"
+		main.httpManager.WithDebugLog(pathPrefix, main.LogFilter)
+		main.logger.Info().Msgf("mounted debug log endpoint at %s", pathPrefix)
+	}
+
 	main.logger.Info().Msgf("serving streams from basedir %s: %s", config.BaseDir, config.Streams)
 }
 
@@ -78,7 +136,59 @@ func (main *Main) ServeCommand(cmd *cobra.Command, args []string) {
 	main.logger.Info().Msg("shutdown complete")
 }
 
+// probes vod media and prints its segment plan as JSON, no segments are
+// transcoded
+func (main *Main) PlanCommand(cmd *cobra.Command, args []string) {
+	// plan is written to stdout, logs must not be mixed with it
+	log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stderr})
+
+	if _, _, err := main.FFmpegInstall(context.Background()); err != nil {
+		log.Fatal().Err(err).Msg("unable to install ffmpeg build")
+	}
+
+	plan, err := api.New(main.ServerConfig).HlsVodPlan(context.Background(), args[0])
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to plan segments")
+	}
+
+	// logs are written to stderr, output contains only the plan
+	out := os.Stdout
+	if output, _ := cmd.Flags().GetString("output"); output != "" {
+		out, err = os.Create(output)
+		if err != nil {
+			log.Fatal().Err(err).Msg("unable to create output file")
+		}
+		defer out.Close()
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(plan); err != nil {
+		log.Fatal().Err(err).Msg("unable to write segment plan")
+	}
+}
+
+func (main *Main) FFmpegInstallCommand(cmd *cobra.Command, args []string) {
+	bins, ok, err := main.FFmpegInstall(context.Background())
+	if err != nil {
+		log.Fatal().Err(err).Msg("unable to install ffmpeg build")
+	}
+
+	if !ok {
+		log.Fatal().Msg("ffmpeg-builds dir is not configured")
+	}
+
+	fmt.Println(bins.FFmpeg)
+	fmt.Println(bins.FFprobe)
+}
+
 func (main *Main) ConfigReload() {
 	main.RootConfig.Set()
 	main.ServerConfig.Set()
+
+	if main.LogFilter != nil {
+		if err := main.LogFilter.Set(main.RootConfig.Log); err != nil {
+			main.logger.Err(err).Msg("invalid log config")
+		}
+	}
 }
@@ -0,0 +1,15 @@
+package utils
+
+import (
+	"runtime"
+	"strings"
+)
+
+// returns platform specific executable name, e.g. ffmpeg.exe on windows
+func BinaryName(name string) string {
+	if runtime.GOOS == "windows" && !strings.HasSuffix(strings.ToLower(name), ".exe") {
+		return name + ".exe"
+	}
+
+	return name
+}
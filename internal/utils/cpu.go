@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// parses cgroup v2 cpu.max, e.g. "200000 100000", returns quota in CPUs,
+// false if CPU time is not limited
+func parseCgroupCPUMax(data string) (float64, bool) {
+	fields := strings.Fields(data)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, false
+	}
+
+	return parseCgroupCPUQuota(fields[0], fields[1])
+}
+
+// parses cgroup v1 cpu.cfs_quota_us and cpu.cfs_period_us, negative quota
+// means CPU time is not limited
+func parseCgroupCPUQuota(quota, period string) (float64, bool) {
+	q, err := strconv.ParseFloat(strings.TrimSpace(quota), 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+
+	p, err := strconv.ParseFloat(strings.TrimSpace(period), 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+
+	return q / p, true
+}
+
+// AvailableCPUs returns CPUs, that this process can use, it is lower than
+// number of CPUs of host, when container is limited by cgroup CPU quota.
+func AvailableCPUs() float64 {
+	cpus := float64(runtime.NumCPU())
+	if quota, ok := cgroupCPUQuota(); ok && quota < cpus {
+		return quota
+	}
+
+	return cpus
+}
@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package utils
+
+import "os"
+
+// returns CPU quota of cgroup v2 or v1 mounted at default path
+func cgroupCPUQuota() (float64, bool) {
+	if data, err := os.ReadFile("/sys/fs/cgroup/cpu.max"); err == nil {
+		return parseCgroupCPUMax(string(data))
+	}
+
+	quota, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_quota_us")
+	if err != nil {
+		return 0, false
+	}
+
+	period, err := os.ReadFile("/sys/fs/cgroup/cpu/cpu.cfs_period_us")
+	if err != nil {
+		return 0, false
+	}
+
+	return parseCgroupCPUQuota(string(quota), string(period))
+}
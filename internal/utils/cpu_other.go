@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+// cgroup quota is read only on linux
+func cgroupCPUQuota() (float64, bool) {
+	return 0, false
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestParseCgroupCPUMax(t *testing.T) {
+	tests := []struct {
+		data  string
+		quota float64
+		ok    bool
+	}{
+		{"max 100000\n", 0, false},
+		{"200000 100000\n", 2, true},
+		{"50000 100000", 0.5, true},
+		{"", 0, false},
+		{"x 100000", 0, false},
+	}
+
+	for _, test := range tests {
+		quota, ok := parseCgroupCPUMax(test.data)
+		if quota != test.quota || ok != test.ok {
+			t.Errorf("parseCgroupCPUMax(%q) = %v, %v, want %v, %v", test.data, quota, ok, test.quota, test.ok)
+		}
+	}
+}
+
+func TestParseCgroupCPUQuota(t *testing.T) {
+	if quota, ok := parseCgroupCPUQuota("-1\n", "100000\n"); ok {
+		t.Errorf("unlimited quota = %v", quota)
+	}
+
+	if quota, ok := parseCgroupCPUQuota("150000\n", "100000\n"); !ok || quota != 1.5 {
+		t.Errorf("quota = %v, %v", quota, ok)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package utils
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// returns bytes available to unprivileged user on file system of path
+func DiskFree(path string) (uint64, error) {
+	var stat unix.Statfs_t
+	if err := unix.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+
+	return stat.Bavail * uint64(stat.Bsize), nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+import "errors"
+
+// free space is measured only on linux
+func DiskFree(path string) (uint64, error) {
+	return 0, errors.New("free space is not supported on this platform")
+}
@@ -0,0 +1,189 @@
+package utils
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// well-known ffmpeg failure classes
+const (
+	FFmpegInvalidData      = "invalid-data"
+	FFmpegEncoderNotFound  = "encoder-not-found"
+	FFmpegDecoderNotFound  = "decoder-not-found"
+	FFmpegDeviceBusy       = "device-busy"
+	FFmpegOutOfMemory      = "out-of-memory"
+	FFmpegInputNotFound    = "input-not-found"
+	FFmpegPermissionDenied = "permission-denied"
+	FFmpegConnection       = "connection"
+)
+
+var ffmpegErrorPatterns = []struct {
+	class string
+	regex *regexp.Regexp
+}{
+	{FFmpegInvalidData, regexp.MustCompile(`(?i)invalid data found|invalid nal unit|error while decoding|corrupt`)},
+	{FFmpegEncoderNotFound, regexp.MustCompile(`(?i)unknown encoder|encoder not found|no such encoder`)},
+	{FFmpegDecoderNotFound, regexp.MustCompile(`(?i)decoder not found|no decoder for|unknown decoder`)},
+	{FFmpegDeviceBusy, regexp.MustCompile(`(?i)device or resource busy|device busy|openencodesessionex failed|no capable devices found`)},
+	{FFmpegOutOfMemory, regexp.MustCompile(`(?i)cannot allocate memory|out of memory`)},
+	{FFmpegInputNotFound, regexp.MustCompile(`(?i)no such file or directory|404 not found|server returned 404`)},
+	{FFmpegPermissionDenied, regexp.MustCompile(`(?i)permission denied|403 forbidden|server returned 403`)},
+	{FFmpegConnection, regexp.MustCompile(`(?i)connection refused|connection timed out|connection reset|i/o error`)},
+}
+
+// log level prefix, when ffmpeg is started with -loglevel level+...
+var ffmpegLevelRegex = regexp.MustCompile(`^\[(panic|fatal|error|warning|info|verbose|debug|trace)\]\s*`)
+
+type FFmpegLogLine struct {
+	Level   zerolog.Level
+	Message string
+	Class   string // failure class, empty if line does not match any known error
+}
+
+func ParseFFmpegLogLine(line string) FFmpegLogLine {
+	parsed := FFmpegLogLine{
+		Level:   zerolog.WarnLevel,
+		Message: strings.TrimSpace(line),
+	}
+
+	if matches := ffmpegLevelRegex.FindStringSubmatch(parsed.Message); matches != nil {
+		parsed.Message = parsed.Message[len(matches[0]):]
+
+		switch matches[1] {
+		case "panic", "fatal":
+			parsed.Level = zerolog.FatalLevel
+		case "error":
+			parsed.Level = zerolog.ErrorLevel
+		case "warning":
+			parsed.Level = zerolog.WarnLevel
+		case "info":
+			parsed.Level = zerolog.InfoLevel
+		default:
+			parsed.Level = zerolog.DebugLevel
+		}
+	}
+
+	for _, pattern := range ffmpegErrorPatterns {
+		if pattern.regex.MatchString(parsed.Message) {
+			parsed.Class = pattern.class
+			break
+		}
+	}
+
+	return parsed
+}
+
+// FFmpegError wraps process error with the last well-known error found in its log
+type FFmpegError struct {
+	Class   string
+	Message string
+	Err     error
+}
+
+func (e *FFmpegError) Error() string {
+	if e.Class == "" {
+		return e.Err.Error()
+	}
+
+	return e.Class + ": " + e.Message + ": " + e.Err.Error()
+}
+
+func (e *FFmpegError) Unwrap() error {
+	return e.Err
+}
+
+// longest line buffered by ffmpeg log writer, longer is logged in parts
+const ffmpegLogMaxLine = 64 * 1024
+
+// FFmpegLogCtx is a writer for ffmpeg stderr, that logs lines with their
+// level and remembers the last well-known error
+type FFmpegLogCtx struct {
+	logger zerolog.Logger
+
+	mu        sync.Mutex
+	buf       []byte // incomplete line of previous writes
+	lastClass string
+	lastLine  string
+}
+
+func FFmpegLog(l zerolog.Logger) *FFmpegLogCtx {
+	return &FFmpegLogCtx{
+		logger: l,
+	}
+}
+
+// lines can be split across writes, they are logged once they are complete,
+// progress lines ended by carriage return are complete as well
+func (l *FFmpegLogCtx) Write(p []byte) (n int, err error) {
+	l.mu.Lock()
+	l.buf = append(l.buf, p...)
+
+	lines := []string{}
+	for {
+		i := bytes.IndexAny(l.buf, "\r\n")
+		if i < 0 {
+			break
+		}
+
+		lines = append(lines, string(l.buf[:i]))
+		l.buf = l.buf[i+1:]
+	}
+
+	if len(l.buf) >= ffmpegLogMaxLine {
+		lines = append(lines, string(l.buf))
+		l.buf = nil
+	}
+	l.mu.Unlock()
+
+	for _, line := range lines {
+		if strings.TrimSpace(line) != "" {
+			l.Line(line)
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush logs incomplete line, that was written last, e.g. when process exited.
+func (l *FFmpegLogCtx) Flush() {
+	l.mu.Lock()
+	line := string(l.buf)
+	l.buf = nil
+	l.mu.Unlock()
+
+	if strings.TrimSpace(line) != "" {
+		l.Line(line)
+	}
+}
+
+func (l *FFmpegLogCtx) Line(line string) {
+	parsed := ParseFFmpegLogLine(line)
+
+	event := l.logger.WithLevel(parsed.Level)
+	if parsed.Class != "" {
+		event = event.Str("class", parsed.Class)
+
+		l.mu.Lock()
+		l.lastClass = parsed.Class
+		l.lastLine = parsed.Message
+		l.mu.Unlock()
+	}
+
+	event.Msg(parsed.Message)
+}
+
+// wraps process error with the last well-known error found in log
+func (l *FFmpegLogCtx) Wrap(err error) *FFmpegError {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return &FFmpegError{
+		Class:   l.lastClass,
+		Message: l.lastLine,
+		Err:     err,
+	}
+}
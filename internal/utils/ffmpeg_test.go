@@ -0,0 +1,90 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestParseFFmpegLogLine(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		want FFmpegLogLine
+	}{
+		{
+			name: "without level",
+			line: "frame=  100 fps= 25 q=28.0 size=     512kB",
+			want: FFmpegLogLine{Level: zerolog.WarnLevel, Message: "frame=  100 fps= 25 q=28.0 size=     512kB"},
+		},
+		{
+			name: "invalid data with level",
+			line: "[error] input.mp4: Invalid data found when processing input",
+			want: FFmpegLogLine{Level: zerolog.ErrorLevel, Message: "input.mp4: Invalid data found when processing input", Class: FFmpegInvalidData},
+		},
+		{
+			name: "encoder not found",
+			line: "[fatal] Unknown encoder 'h264_nvenc'",
+			want: FFmpegLogLine{Level: zerolog.FatalLevel, Message: "Unknown encoder 'h264_nvenc'", Class: FFmpegEncoderNotFound},
+		},
+		{
+			name: "device busy",
+			line: "[h264_nvenc @ 0x55] OpenEncodeSessionEx failed: out of memory (10): (no details)",
+			want: FFmpegLogLine{Level: zerolog.WarnLevel, Message: "[h264_nvenc @ 0x55] OpenEncodeSessionEx failed: out of memory (10): (no details)", Class: FFmpegDeviceBusy},
+		},
+		{
+			name: "out of memory",
+			line: "[error] Cannot allocate memory",
+			want: FFmpegLogLine{Level: zerolog.ErrorLevel, Message: "Cannot allocate memory", Class: FFmpegOutOfMemory},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseFFmpegLogLine(tt.line); got != tt.want {
+				t.Errorf("ParseFFmpegLogLine() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFFmpegLogWrite(t *testing.T) {
+	var buf bytes.Buffer
+	l := FFmpegLog(zerolog.New(&buf))
+
+	// line split across writes, progress line ended by carriage return
+	for _, chunk := range []string{"[error] input.mp4: Invalid da", "ta found when processing input\nframe=1\r", "[info] last"} {
+		if _, err := l.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Flush()
+
+	messages := []string{}
+	decoder := json.NewDecoder(&buf)
+	for decoder.More() {
+		var line struct {
+			Message string `json:"message"`
+		}
+		if err := decoder.Decode(&line); err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, line.Message)
+	}
+
+	want := []string{"input.mp4: Invalid data found when processing input", "frame=1", "last"}
+	if len(messages) != len(want) {
+		t.Fatalf("logged %q, want %q", messages, want)
+	}
+	for i := range want {
+		if messages[i] != want[i] {
+			t.Errorf("logged %q, want %q", messages[i], want[i])
+		}
+	}
+
+	if err := l.Wrap(errors.New("exit status 1")); err.Class != FFmpegInvalidData {
+		t.Errorf("class = %q, want %q", err.Class, FFmpegInvalidData)
+	}
+}
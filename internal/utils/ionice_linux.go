@@ -0,0 +1,25 @@
+//go:build linux
+// +build linux
+
+package utils
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+const (
+	ioprioWhoProcess = 1
+	ioprioClassShift = 13
+	ioprioClassIdle  = 3
+)
+
+// sets idle I/O scheduling class for process, so that it gets disk
+// time only when no other process needs it
+func SetIOPriorityIdle(pid int) error {
+	_, _, errno := unix.Syscall(unix.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(pid), ioprioClassIdle<<ioprioClassShift)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
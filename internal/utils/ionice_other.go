@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package utils
+
+// I/O scheduling classes are supported only on linux
+func SetIOPriorityIdle(pid int) error {
+	return nil
+}
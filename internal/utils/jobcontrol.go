@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+)
+
+var ErrPauseNotSupported = errors.New("pausing processes is not supported")
+
+// JobControl pauses and resumes background jobs, so that interactive sessions
+// get CPU, e.g. during peak hours. Running processes of jobs are stopped by
+// SIGSTOP and continued by SIGCONT, jobs wait at their checkpoints (e.g.
+// before starting next process) while paused. Nil job control is never
+// paused.
+type JobControl struct {
+	mu      sync.Mutex
+	paused  bool
+	resumed chan struct{}
+	cmds    map[*exec.Cmd]struct{}
+}
+
+func NewJobControl() *JobControl {
+	return &JobControl{
+		cmds: map[*exec.Cmd]struct{}{},
+	}
+}
+
+func (j *JobControl) Paused() bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.paused
+}
+
+// Pause stops tracked processes and holds jobs at their next checkpoint.
+func (j *JobControl) Pause() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.paused {
+		return nil
+	}
+
+	j.paused = true
+	j.resumed = make(chan struct{})
+
+	var err error
+	for cmd := range j.cmds {
+		if e := ProcessGroupPause(cmd); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Resume continues tracked processes and releases waiting jobs.
+func (j *JobControl) Resume() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if !j.paused {
+		return nil
+	}
+
+	j.paused = false
+	close(j.resumed)
+
+	var err error
+	for cmd := range j.cmds {
+		if e := ProcessGroupResume(cmd); e != nil && err == nil {
+			err = e
+		}
+	}
+
+	return err
+}
+
+// Wait is checkpoint of job, it blocks while jobs are paused.
+func (j *JobControl) Wait(ctx context.Context) error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	paused, resumed := j.paused, j.resumed
+	j.mu.Unlock()
+
+	if !paused {
+		return nil
+	}
+
+	select {
+	case <-resumed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Track pauses and resumes started command together with jobs, until the
+// returned function is called after command exited. Command started while
+// jobs are paused is stopped immediately.
+func (j *JobControl) Track(cmd *exec.Cmd) func() {
+	if j == nil {
+		return func() {}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.cmds[cmd] = struct{}{}
+	if j.paused {
+		_ = ProcessGroupPause(cmd)
+	}
+
+	return func() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+
+		delete(j.cmds, cmd)
+	}
+}
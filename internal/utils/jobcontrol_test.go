@@ -0,0 +1,67 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestJobControlWait(t *testing.T) {
+	jobs := NewJobControl()
+	if err := jobs.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := jobs.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !jobs.Paused() {
+		t.Fatal("jobs are not paused")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- jobs.Wait(context.Background())
+	}()
+
+	select {
+	case <-done:
+		t.Fatal("job was not held while paused")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := jobs.Resume(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job was not released after resume")
+	}
+}
+
+func TestJobControlWaitCanceled(t *testing.T) {
+	jobs := NewJobControl()
+	_ = jobs.Pause()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := jobs.Wait(ctx); err != context.Canceled {
+		t.Fatalf("expected context canceled, got %v", err)
+	}
+}
+
+func TestJobControlNil(t *testing.T) {
+	var jobs *JobControl
+	if err := jobs.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs.Track(nil)()
+}
@@ -0,0 +1,195 @@
+package utils
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogConfig is runtime adjustable configuration of LogFilter.
+type LogConfig struct {
+	Level   string            // default level
+	Modules map[string]string // level per module or module/submodule
+
+	// Messages below warning level, that are repeated more than burst
+	// times per period in the same module, are dropped. 0 means disabled.
+	SampleBurst  int
+	SamplePeriod time.Duration
+}
+
+// number of sampled messages, when expired samples are removed
+const logSamplesMax = 1024
+
+type logSample struct {
+	start time.Time
+	count int
+}
+
+// LogFilter is a writer for zerolog, that filters messages by level of
+// their module and samples high-frequency messages.
+type LogFilter struct {
+	out io.Writer
+
+	mu      sync.RWMutex
+	level   zerolog.Level
+	modules map[string]zerolog.Level
+
+	sampleBurst  int
+	samplePeriod time.Duration
+	samples      map[string]*logSample
+	samplesMu    sync.Mutex
+}
+
+func NewLogFilter(out io.Writer) *LogFilter {
+	return &LogFilter{
+		out:     out,
+		level:   zerolog.InfoLevel,
+		modules: map[string]zerolog.Level{},
+		samples: map[string]*logSample{},
+	}
+}
+
+// Set applies new configuration, it is validated before anything is changed.
+func (f *LogFilter) Set(config LogConfig) error {
+	level := zerolog.InfoLevel
+	if config.Level != "" {
+		var err error
+		level, err = zerolog.ParseLevel(config.Level)
+		if err != nil {
+			return err
+		}
+	}
+
+	modules := map[string]zerolog.Level{}
+	for module, value := range config.Modules {
+		moduleLevel, err := zerolog.ParseLevel(value)
+		if err != nil {
+			return err
+		}
+
+		modules[module] = moduleLevel
+	}
+
+	f.mu.Lock()
+	f.level = level
+	f.modules = modules
+	f.sampleBurst = config.SampleBurst
+	f.samplePeriod = config.SamplePeriod
+	f.mu.Unlock()
+
+	f.samplesMu.Lock()
+	f.samples = map[string]*logSample{}
+	f.samplesMu.Unlock()
+
+	// messages must not be dropped before they reach filter
+	minLevel := level
+	for _, moduleLevel := range modules {
+		if moduleLevel < minLevel {
+			minLevel = moduleLevel
+		}
+	}
+	zerolog.SetGlobalLevel(minLevel)
+
+	return nil
+}
+
+// Config returns current configuration.
+func (f *LogFilter) Config() LogConfig {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	modules := map[string]string{}
+	for module, level := range f.modules {
+		modules[module] = level.String()
+	}
+
+	return LogConfig{
+		Level:        f.level.String(),
+		Modules:      modules,
+		SampleBurst:  f.sampleBurst,
+		SamplePeriod: f.samplePeriod,
+	}
+}
+
+func (f *LogFilter) Write(p []byte) (n int, err error) {
+	entry := struct {
+		Level     string `json:"level"`
+		Module    string `json:"module"`
+		Submodule string `json:"submodule"`
+		Message   string `json:"message"`
+	}{}
+
+	// pass through messages, that cannot be parsed
+	if json.Unmarshal(p, &entry) != nil {
+		return f.out.Write(p)
+	}
+
+	level, err := zerolog.ParseLevel(entry.Level)
+	if err != nil {
+		return f.out.Write(p)
+	}
+
+	module := entry.Module
+	if entry.Submodule != "" {
+		module += "/" + entry.Submodule
+	}
+
+	if !f.enabled(entry.Module, module, level) || !f.sample(module+"\x00"+entry.Message, level) {
+		return len(p), nil
+	}
+
+	return f.out.Write(p)
+}
+
+// returns true, if level is enabled for module
+func (f *LogFilter) enabled(module, submodule string, level zerolog.Level) bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	// submodule level takes precedence over module level
+	if moduleLevel, ok := f.modules[submodule]; ok {
+		return level >= moduleLevel
+	}
+
+	if moduleLevel, ok := f.modules[module]; ok {
+		return level >= moduleLevel
+	}
+
+	return level >= f.level
+}
+
+// returns true, if message is not over sampling limit
+func (f *LogFilter) sample(key string, level zerolog.Level) bool {
+	f.mu.RLock()
+	burst, period := f.sampleBurst, f.samplePeriod
+	f.mu.RUnlock()
+
+	if burst <= 0 || period <= 0 || level >= zerolog.WarnLevel {
+		return true
+	}
+
+	f.samplesMu.Lock()
+	defer f.samplesMu.Unlock()
+
+	now := time.Now()
+	sample, ok := f.samples[key]
+	if !ok || now.Sub(sample.start) >= period {
+		// forget old samples, so that map does not grow indefinitely
+		if len(f.samples) >= logSamplesMax {
+			for k, s := range f.samples {
+				if now.Sub(s.start) >= period {
+					delete(f.samples, k)
+				}
+			}
+		}
+
+		sample = &logSample{start: now}
+		f.samples[key] = sample
+	}
+
+	sample.count++
+	return sample.count <= burst
+}
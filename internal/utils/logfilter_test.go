@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+func TestLogFilter(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.TraceLevel)
+
+	var out bytes.Buffer
+	filter := NewLogFilter(&out)
+
+	err := filter.Set(LogConfig{
+		Level: "info",
+		Modules: map[string]string{
+			"http":           "warn",
+			"hlsvod/manager": "debug",
+		},
+		SampleBurst:  2,
+		SamplePeriod: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if level := zerolog.GlobalLevel(); level != zerolog.DebugLevel {
+		t.Errorf("global level = %v, want %v", level, zerolog.DebugLevel)
+	}
+
+	logger := zerolog.New(filter)
+	logger.Info().Str("module", "http").Msg("http info")
+	logger.Debug().Str("module", "hlsvod").Str("submodule", "manager").Msg("manager debug")
+	logger.Debug().Str("module", "hlsvod").Str("submodule", "ffmpeg").Msg("ffmpeg debug")
+	for i := 0; i < 3; i++ {
+		logger.Info().Str("module", "hlsvod").Msg("segment")
+	}
+	logger.Warn().Str("module", "hlsvod").Msg("segment")
+
+	got := out.String()
+	if strings.Contains(got, "http info") || strings.Contains(got, "ffmpeg debug") {
+		t.Errorf("messages below module level were not filtered: %s", got)
+	}
+
+	if !strings.Contains(got, "manager debug") {
+		t.Errorf("submodule level was not applied: %s", got)
+	}
+
+	// two sampled info messages and warning
+	if count := strings.Count(got, `"segment"`); count != 3 {
+		t.Errorf("sampled messages = %d, want 3", count)
+	}
+
+	if err := filter.Set(LogConfig{Level: "invalid"}); err == nil {
+		t.Error("invalid level should be rejected")
+	}
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"path"
+	"strings"
+)
+
+// content types of media files by extension
+var mediaContentTypes = map[string]string{
+	".m3u8": "application/vnd.apple.mpegurl",
+	".mpd":  "application/dash+xml",
+	".ts":   "video/mp2t",
+	".mp4":  "video/mp4",
+	".m4s":  "video/mp4",
+	".m4v":  "video/mp4",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".mp3":  "audio/mpeg",
+	".webm": "video/webm",
+	".vtt":  "text/vtt",
+}
+
+// returns content type of media file by its container, name can be path or
+// url path, application/octet-stream if container is unknown
+func MediaContentType(name string) string {
+	if contentType, ok := mediaContentTypes[strings.ToLower(path.Ext(name))]; ok {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
@@ -0,0 +1,22 @@
+package utils
+
+import "testing"
+
+func TestMediaContentType(t *testing.T) {
+	tests := map[string]string{
+		"index.m3u8":                   "application/vnd.apple.mpegurl",
+		"/vod/movie.mkv/720p-00001.ts": "video/mp2t",
+		"init.mp4":                     "video/mp4",
+		"live_001.m4s":                 "video/mp4",
+		"chunk-stream1-00001.m4a":      "audio/mp4",
+		"subtitles-2.vtt":              "text/vtt",
+		"INIT-STREAM0.WEBM":            "video/webm",
+		"segment":                      "application/octet-stream",
+	}
+
+	for name, want := range tests {
+		if got := MediaContentType(name); got != want {
+			t.Errorf("MediaContentType(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"fmt"
+	"runtime/debug"
+
+	"github.com/rs/zerolog"
+)
+
+// PanicError is panic recovered in goroutine, with stack trace of the panic.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// RecoverPanic recovers panic of goroutine, it must be deferred directly.
+// Panic is logged with stack trace and passed to onPanic, if it is set, so
+// that owner of goroutine can fail instead of silently losing it.
+func RecoverPanic(logger zerolog.Logger, onPanic func(err *PanicError)) {
+	value := recover()
+	if value == nil {
+		return
+	}
+
+	err := &PanicError{Value: value, Stack: debug.Stack()}
+	logger.Error().
+		Interface("panic", value).
+		Str("stack", string(err.Stack)).
+		Msg("recovered panic in goroutine")
+
+	if onPanic != nil {
+		onPanic(err)
+	}
+}
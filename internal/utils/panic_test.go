@@ -0,0 +1,37 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	recovered := make(chan *PanicError, 1)
+	go func() {
+		defer RecoverPanic(logger, func(err *PanicError) {
+			recovered <- err
+		})
+
+		var metadata *struct{ Duration int }
+		_ = metadata.Duration
+	}()
+
+	err := <-recovered
+	if !strings.Contains(err.Error(), "nil pointer dereference") {
+		t.Errorf("err = %v", err)
+	}
+
+	if !strings.Contains(string(err.Stack), "TestRecoverPanic") {
+		t.Error("stack trace does not contain panicking function")
+	}
+
+	if !strings.Contains(buf.String(), `"stack"`) {
+		t.Errorf("panic was not logged with stack trace: %s", buf.String())
+	}
+}
@@ -0,0 +1,66 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ErrNotStarted is returned, when signal is sent to command, whose process
+// was not started, e.g. because program was not found.
+var ErrNotStarted = errors.New("process was not started")
+
+// channels closed when started process groups exit, key is command
+var groupWatchers sync.Map
+
+// starts command in a new process group, that is killed as whole when context
+// is done, so that no helper processes spawned by program outlive it. Command
+// must be waited for using ProcessGroupWait.
+func ProcessGroupStart(ctx context.Context, cmd *exec.Cmd) error {
+	ProcessGroupPrepare(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if err := ProcessGroupStarted(cmd); err != nil {
+		log.Warn().Err(err).Int("pid", cmd.Process.Pid).Msg("unable to assign process group")
+	}
+
+	done := make(chan struct{})
+	groupWatchers.Store(cmd, done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = ProcessGroupKill(cmd)
+		case <-done:
+		}
+	}()
+
+	return nil
+}
+
+// waits for command started by ProcessGroupStart, so that it does not stay
+// zombie, and kills processes left behind in its group
+func ProcessGroupWait(cmd *exec.Cmd) error {
+	err := cmd.Wait()
+
+	if done, ok := groupWatchers.LoadAndDelete(cmd); ok {
+		close(done.(chan struct{}))
+	}
+
+	ProcessGroupRelease(cmd)
+	return err
+}
+
+// starts command in a new process group and waits for it
+func ProcessGroupRun(ctx context.Context, cmd *exec.Cmd) error {
+	if err := ProcessGroupStart(ctx, cmd); err != nil {
+		return err
+	}
+
+	return ProcessGroupWait(cmd)
+}
@@ -0,0 +1,143 @@
+//go:build linux
+// +build linux
+
+package utils
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// returns true, if process is running, zombies are not running
+func processRunning(pid int) bool {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return false
+	}
+
+	fields := strings.Fields(string(data))
+	return len(fields) > 2 && fields[2] != "Z"
+}
+
+// starts shell, that spawns helper process and prints its pid
+func startHelper(t *testing.T, ctx context.Context, script string) (*exec.Cmd, int) {
+	cmd := exec.Command("sh", "-c", script)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ProcessGroupStart(ctx, cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(stdout).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return cmd, pid
+}
+
+// waits until process is not running
+func waitStopped(t *testing.T, pid int) {
+	for i := 0; i < 100; i++ {
+		if !processRunning(pid) {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("helper process %d is still running", pid)
+}
+
+func TestProcessGroupCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd, pid := startHelper(t, ctx, "sleep 30 & echo $!; wait")
+
+	cancel()
+	if err := ProcessGroupWait(cmd); err == nil {
+		t.Error("killed process exited without error")
+	}
+
+	waitStopped(t, pid)
+}
+
+func TestProcessGroupOrphans(t *testing.T) {
+	// program exits, but leaves its helper running
+	cmd, pid := startHelper(t, context.Background(), "sleep 30 & echo $!")
+
+	if err := ProcessGroupWait(cmd); err != nil {
+		t.Fatal(err)
+	}
+
+	waitStopped(t, pid)
+}
+
+// returns state of process, e.g. S (sleeping) or T (stopped)
+func processState(pid int) string {
+	data, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return ""
+	}
+
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return ""
+	}
+
+	return fields[2]
+}
+
+// waits until process has state
+func waitState(t *testing.T, pid int, state string) {
+	for i := 0; i < 100; i++ {
+		if processState(pid) == state {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Errorf("process %d has state %q, expected %q", pid, processState(pid), state)
+}
+
+func TestJobControlPause(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	jobs := NewJobControl()
+	cmd, pid := startHelper(t, ctx, "sleep 30 & echo $!; wait")
+	untrack := jobs.Track(cmd)
+
+	if err := jobs.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, pid, "T")
+
+	if err := jobs.Resume(); err != nil {
+		t.Fatal(err)
+	}
+	waitState(t, pid, "S")
+
+	// stopped process is still killed by context
+	if err := jobs.Pause(); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel()
+	_ = ProcessGroupWait(cmd)
+	untrack()
+
+	waitStopped(t, pid)
+}
@@ -0,0 +1,85 @@
+//go:build !windows
+// +build !windows
+
+package utils
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// prepares command to be started in a new process group
+func ProcessGroupPrepare(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// must be called after command has been started
+func ProcessGroupStarted(cmd *exec.Cmd) error {
+	return nil
+}
+
+// returns true, if command was started as leader of its own process group,
+// group id is its pid then, even after leader exited
+func processGroup(cmd *exec.Cmd) bool {
+	return cmd.SysProcAttr != nil && cmd.SysProcAttr.Setpgid
+}
+
+// kills whole process group, falls back to killing only the process
+func ProcessGroupKill(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return ErrNotStarted
+	}
+
+	if !processGroup(cmd) {
+		return cmd.Process.Kill()
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// interrupts whole process group, so that programs can finish their output
+func ProcessGroupInterrupt(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return ErrNotStarted
+	}
+
+	if !processGroup(cmd) {
+		return cmd.Process.Signal(syscall.SIGINT)
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGINT)
+}
+
+// kills processes left in process group after command exited, e.g. helpers
+// spawned by program, so that they do not run orphaned
+func ProcessGroupRelease(cmd *exec.Cmd) {
+	if cmd.Process != nil && processGroup(cmd) {
+		_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+}
+
+// pauses whole process group, falls back to pausing only the process
+func ProcessGroupPause(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return ErrNotStarted
+	}
+
+	if !processGroup(cmd) {
+		return cmd.Process.Signal(syscall.SIGSTOP)
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGSTOP)
+}
+
+// resumes process group paused by ProcessGroupPause
+func ProcessGroupResume(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return ErrNotStarted
+	}
+
+	if !processGroup(cmd) {
+		return cmd.Process.Signal(syscall.SIGCONT)
+	}
+
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGCONT)
+}
@@ -0,0 +1,110 @@
+//go:build windows
+// +build windows
+
+package utils
+
+import (
+	"os/exec"
+	"sync"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// job objects assigned to processes, key is process id
+var jobs sync.Map
+
+// prepares command to be started in a new process group
+func ProcessGroupPrepare(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: windows.CREATE_NEW_PROCESS_GROUP}
+}
+
+// must be called after command has been started, assigns process to a new
+// job object so that all its children can be terminated together
+func ProcessGroupStarted(cmd *exec.Cmd) error {
+	job, err := windows.CreateJobObject(nil, nil)
+	if err != nil {
+		return err
+	}
+
+	info := windows.JOBOBJECT_EXTENDED_LIMIT_INFORMATION{
+		BasicLimitInformation: windows.JOBOBJECT_BASIC_LIMIT_INFORMATION{
+			LimitFlags: windows.JOB_OBJECT_LIMIT_KILL_ON_JOB_CLOSE,
+		},
+	}
+
+	_, err = windows.SetInformationJobObject(
+		job,
+		windows.JobObjectExtendedLimitInformation,
+		uintptr(unsafe.Pointer(&info)),
+		uint32(unsafe.Sizeof(info)),
+	)
+	if err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+
+	process, err := windows.OpenProcess(windows.PROCESS_SET_QUOTA|windows.PROCESS_TERMINATE, false, uint32(cmd.Process.Pid))
+	if err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+	defer windows.CloseHandle(process)
+
+	if err := windows.AssignProcessToJobObject(job, process); err != nil {
+		windows.CloseHandle(job)
+		return err
+	}
+
+	jobs.Store(cmd.Process.Pid, job)
+	return nil
+}
+
+// kills whole process group, falls back to killing only the process
+func ProcessGroupKill(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return ErrNotStarted
+	}
+
+	value, ok := jobs.LoadAndDelete(cmd.Process.Pid)
+	if !ok {
+		return cmd.Process.Kill()
+	}
+
+	job := value.(windows.Handle)
+	defer windows.CloseHandle(job)
+
+	return windows.TerminateJobObject(job, 1)
+}
+
+// interrupts whole process group with CTRL_BREAK, so that programs can finish
+// their output, process must share console with this process
+func ProcessGroupInterrupt(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return ErrNotStarted
+	}
+
+	return windows.GenerateConsoleCtrlEvent(windows.CTRL_BREAK_EVENT, uint32(cmd.Process.Pid))
+}
+
+// releases resources held by process group after command exited
+func ProcessGroupRelease(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+
+	if value, ok := jobs.LoadAndDelete(cmd.Process.Pid); ok {
+		windows.CloseHandle(value.(windows.Handle))
+	}
+}
+
+// processes can not be paused, background jobs are paused only between
+// processes then
+func ProcessGroupPause(cmd *exec.Cmd) error {
+	return ErrPauseNotSupported
+}
+
+func ProcessGroupResume(cmd *exec.Cmd) error {
+	return ErrPauseNotSupported
+}
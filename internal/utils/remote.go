@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// default timeout of connecting to remote host
+const remoteDialTimeout = 30 * time.Second
+
+// RemoteConfig configures connections to remote inputs, e.g. in networks,
+// where direct egress is blocked.
+type RemoteConfig struct {
+	Proxy         *url.URL      // http, https or socks5 proxy, nil means direct connections.
+	NoProxy       []string      // Hosts, domains (with subdomains), IPs or CIDRs connected directly, * means all.
+	Network       string        // Address family: tcp (both), tcp4 or tcp6, empty means tcp.
+	FallbackDelay time.Duration // Happy Eyeballs delay before racing other address family, negative disables it.
+	Timeout       time.Duration // Timeout of connecting and waiting for response headers, 0 means default.
+}
+
+// Bypass returns true, if host (without port) is connected directly.
+func (c RemoteConfig) Bypass(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	ip := net.ParseIP(host)
+
+	for _, entry := range c.NoProxy {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+
+		if entry == "*" {
+			return true
+		}
+
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+
+		// domain matches itself and its subdomains
+		domain := strings.TrimPrefix(entry, ".")
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProxyFor returns proxy of URL, nil means direct connection.
+func (c RemoteConfig) ProxyFor(u *url.URL) *url.URL {
+	if c.Proxy == nil || c.Bypass(u.Hostname()) {
+		return nil
+	}
+
+	return c.Proxy
+}
+
+// Transport returns HTTP transport connecting through proxy, if configured,
+// otherwise directly using configured address family.
+func (c RemoteConfig) Transport() *http.Transport {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = remoteDialTimeout
+	}
+
+	dialer := &net.Dialer{
+		Timeout:       timeout,
+		KeepAlive:     30 * time.Second,
+		FallbackDelay: c.FallbackDelay,
+	}
+
+	network := c.Network
+	if network == "" {
+		network = "tcp"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(r *http.Request) (*url.URL, error) {
+		return c.ProxyFor(r.URL), nil
+	}
+	transport.DialContext = func(ctx context.Context, _, addr string) (net.Conn, error) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	if c.Timeout > 0 {
+		transport.ResponseHeaderTimeout = c.Timeout
+	}
+
+	return transport
+}
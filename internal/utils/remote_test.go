@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestRemoteConfigBypass(t *testing.T) {
+	config := RemoteConfig{
+		NoProxy: []string{"localhost", ".internal.example.com", "10.0.0.0/8"},
+	}
+
+	tests := map[string]bool{
+		"localhost":                 true,
+		"internal.example.com":      true,
+		"cdn.internal.example.com":  true,
+		"example.com":               false,
+		"notinternal.example.com":   false,
+		"10.1.2.3":                  true,
+		"192.168.1.1":               false,
+		"CDN.Internal.Example.com.": true,
+	}
+
+	for host, want := range tests {
+		if got := config.Bypass(host); got != want {
+			t.Errorf("Bypass(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	if !(RemoteConfig{NoProxy: []string{"*"}}).Bypass("example.com") {
+		t.Errorf("wildcard does not bypass proxy")
+	}
+}
+
+func TestRemoteConfigTransport(t *testing.T) {
+	// proxy receives absolute URL of remote input
+	var requested string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.String()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer proxy.Close()
+
+	proxyURL, _ := url.Parse(proxy.URL)
+	client := &http.Client{Transport: RemoteConfig{Proxy: proxyURL, Network: "tcp4"}.Transport()}
+
+	resp, err := client.Get("http://remote.example.com/live.m3u8")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if requested != "http://remote.example.com/live.m3u8" {
+		t.Errorf("proxy got request %q", requested)
+	}
+
+	// bypassed host is connected directly
+	client = &http.Client{Transport: RemoteConfig{Proxy: proxyURL, NoProxy: []string{"127.0.0.1"}}.Transport()}
+
+	direct := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer direct.Close()
+
+	requested = ""
+	resp, err = client.Get(direct.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || requested != "" {
+		t.Errorf("bypassed request went through proxy")
+	}
+}
@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatingLogFile describes current or rotated log file.
+type RotatingLogFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+// RotatingLog appends to <dir>/<name>.log, when it exceeds maximum size or
+// age, it is renamed with timestamp and new file is started. Rotated files
+// older than maximum age or above maximum count are removed.
+type RotatingLog struct {
+	Dir      string
+	Name     string
+	MaxSize  int64         // 0 means no size-based rotation
+	MaxAge   time.Duration // 0 means no age-based rotation and rotated files are kept regardless of age
+	MaxFiles int           // rotated files kept, 0 means unlimited
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	opened time.Time // current file is rotated, when it is older than max age
+}
+
+func (l *RotatingLog) path() string {
+	return filepath.Join(l.Dir, l.Name+".log")
+}
+
+func (l *RotatingLog) open() error {
+	if err := os.MkdirAll(l.Dir, 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(l.path(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	fi, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.size = fi.Size()
+	l.opened = time.Now()
+
+	// age of file left by previous run is not known, it is at least time
+	// since its last write
+	if fi.Size() > 0 && fi.ModTime().Before(l.opened) {
+		l.opened = fi.ModTime()
+	}
+
+	return nil
+}
+
+// returns true, if current file should be rotated before writing n bytes
+func (l *RotatingLog) expired(n int) bool {
+	if l.size == 0 {
+		return false
+	}
+
+	if l.MaxSize > 0 && l.size+int64(n) > l.MaxSize {
+		return true
+	}
+
+	return l.MaxAge > 0 && time.Since(l.opened) > l.MaxAge
+}
+
+func (l *RotatingLog) rotate() error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+	}
+
+	rotated := filepath.Join(l.Dir, fmt.Sprintf("%s-%s.log", l.Name, time.Now().UTC().Format("20060102T150405.000000000")))
+	if err := os.Rename(l.path(), rotated); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	l.prune()
+	return l.open()
+}
+
+// removes rotated files over age or count limits
+func (l *RotatingLog) prune() {
+	files, err := l.rotated()
+	if err != nil {
+		return
+	}
+
+	for i, file := range files {
+		expired := l.MaxAge > 0 && time.Since(file.Modified) > l.MaxAge
+		if expired || l.MaxFiles > 0 && i >= l.MaxFiles {
+			_ = os.Remove(filepath.Join(l.Dir, file.Name))
+		}
+	}
+}
+
+// returns rotated files from the newest one
+func (l *RotatingLog) rotated() ([]RotatingLogFile, error) {
+	matches, err := filepath.Glob(filepath.Join(l.Dir, l.Name+"-*.log"))
+	if err != nil {
+		return nil, err
+	}
+
+	files := []RotatingLogFile{}
+	for _, match := range matches {
+		fi, err := os.Stat(match)
+		if err != nil {
+			continue
+		}
+
+		files = append(files, RotatingLogFile{
+			Name:     fi.Name(),
+			Size:     fi.Size(),
+			Modified: fi.ModTime(),
+		})
+	}
+
+	// timestamps in names sort chronologically
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name > files[j].Name
+	})
+
+	return files, nil
+}
+
+func (l *RotatingLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	if l.expired(len(p)) {
+		if err := l.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := l.file.Write(p)
+	l.size += int64(n)
+	return n, err
+}
+
+// Files returns current and rotated log files from the newest one, expired files are removed.
+func (l *RotatingLog) Files() ([]RotatingLogFile, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.prune()
+
+	files, err := l.rotated()
+	if err != nil {
+		return nil, err
+	}
+
+	if fi, err := os.Stat(l.path()); err == nil {
+		files = append([]RotatingLogFile{{
+			Name:     fi.Name(),
+			Size:     fi.Size(),
+			Modified: fi.ModTime(),
+		}}, files...)
+	}
+
+	return files, nil
+}
+
+// Open opens current or rotated log file by its name.
+func (l *RotatingLog) Open(name string) (*os.File, error) {
+	if name != filepath.Base(name) || name != l.Name+".log" && !strings.HasPrefix(name, l.Name+"-") || filepath.Ext(name) != ".log" {
+		return nil, os.ErrNotExist
+	}
+
+	return os.Open(filepath.Join(l.Dir, name))
+}
+
+// Close closes current file, next write opens it again.
+func (l *RotatingLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"io"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestRotatingLog(t *testing.T) {
+	l := &RotatingLog{
+		Dir:      t.TempDir(),
+		Name:     "session",
+		MaxSize:  10,
+		MaxFiles: 2,
+	}
+	defer l.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		if _, err := l.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := l.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// current file and two newest rotated files
+	if len(files) != 3 {
+		t.Fatalf("got %d files, want 3: %v", len(files), files)
+	}
+
+	if files[0].Name != "session.log" {
+		t.Errorf("first file is %q, want current file", files[0].Name)
+	}
+
+	want := []string{"fourth\n", "third\n", "second\n"}
+	for i, file := range files {
+		f, err := l.Open(file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, _ := io.ReadAll(f)
+		f.Close()
+
+		if string(data) != want[i] {
+			t.Errorf("file %q contains %q, want %q", file.Name, data, want[i])
+		}
+	}
+
+	if _, err := l.Open("../session.log"); err == nil {
+		t.Errorf("file outside of log dir was opened")
+	}
+
+	if _, err := l.Open("other.log"); err == nil {
+		t.Errorf("file of other log was opened")
+	}
+}
+
+func TestRotatingLogMaxAge(t *testing.T) {
+	l := &RotatingLog{
+		Dir:    t.TempDir(),
+		Name:   "session",
+		MaxAge: time.Hour,
+	}
+	defer l.Close()
+
+	if _, err := l.Write([]byte("first\n")); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// file left by previous run is rotated, when it is opened again
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(l.path(), old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := l.Write([]byte("second\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	// current file is rotated, when it gets old
+	l.opened = time.Now().Add(-2 * time.Hour)
+	if _, err := l.Write([]byte("third\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := l.Files()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// expired first file is pruned
+	if len(files) != 2 || files[0].Name != "session.log" {
+		t.Fatalf("got files %v, want current and one rotated", files)
+	}
+
+	f, err := l.Open(files[1].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if data, _ := io.ReadAll(f); string(data) != "second\n" {
+		t.Errorf("rotated file contains %q, want %q", data, "second\n")
+	}
+}
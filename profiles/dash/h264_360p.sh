@@ -0,0 +1,10 @@
+#!/bin/sh
+
+export VW="640"
+export VH="360"
+export ABANDWIDTH="96k"
+export VBANDWIDTH="800k"
+export VMAXRATE="856k"
+export VBUFSIZE="1200k"
+
+"$(dirname "$0")"/../dash_h264.sh "$@"
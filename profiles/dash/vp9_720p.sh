@@ -0,0 +1,10 @@
+#!/bin/sh
+
+export VW="1280"
+export VH="720"
+export ABANDWIDTH="128k"
+export VBANDWIDTH="1800k"
+export VMAXRATE="1926k"
+export VBUFSIZE="2700k"
+
+"$(dirname "$0")"/../dash_vp9.sh "$@"
@@ -0,0 +1,51 @@
+#!/usr/bin/env bash
+
+# Low latency DASH with chunked CMAF. Manifest (manifest.mpd) with
+# availabilityTimeOffset and chunks are written to the working directory,
+# chunks are served while they are being written.
+
+export INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
+if [[ "$VW" = "" ]]; then echo "Missing \$VW"; exit 1; fi
+if [[ "$VH" = "" ]]; then echo "Missing \$VH"; exit 1; fi
+if [[ "$ABANDWIDTH" = "" ]]; then echo "Missing \$ABANDWIDTH"; exit 1; fi
+if [[ "$VBANDWIDTH" = "" ]]; then echo "Missing \$VBANDWIDTH"; exit 1; fi
+if [[ "$VMAXRATE" = "" ]]; then echo "Missing \$VMAXRATE"; exit 1; fi
+if [[ "$VBUFSIZE" = "" ]]; then echo "Missing \$VBUFSIZE"; exit 1; fi
+
+exec ffmpeg -hide_banner -loglevel warning \
+  "$@" \
+  -i "$INPUT" \
+  -map 0:v:0 -map 0:a:0 \
+  -vf "scale=w=$VW:h=$VH:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2${OVERLAY:+,$OVERLAY}" \
+    -c:a aac \
+      -ar 48000 \
+      -ac 2 \
+      -b:a $ABANDWIDTH \
+    -c:v h264 \
+      -profile:v main \
+      -preset veryfast \
+      -tune zerolatency \
+      -force_key_frames "expr:gte(t,n_forced*2)" \
+      -b:v $VBANDWIDTH \
+      -maxrate $VMAXRATE \
+      -bufsize $VBUFSIZE \
+      -sc_threshold 0 \
+  -f dash \
+    -ldash 1 \
+    -streaming 1 \
+    -use_template 1 \
+    -use_timeline 0 \
+    -seg_duration 2 \
+    -frag_type duration \
+    -frag_duration 0.5 \
+    -target_latency 3 \
+    -window_size 5 \
+    -extra_window_size 5 \
+    -remove_at_exit 1 \
+    -format_options "movflags=+cmaf" \
+    -utc_timing_url "https://time.akamai.com/?iso" \
+    manifest.mpd
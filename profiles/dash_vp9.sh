@@ -0,0 +1,49 @@
+#!/usr/bin/env bash
+
+# VP9 and Opus in WebM-DASH for deployments avoiding H.264/AAC licensing.
+# Manifest (manifest.mpd) and segments are written to the working directory.
+# WebM segments cannot be chunked, so that latency is higher than LL-DASH.
+
+export INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
+if [[ "$VW" = "" ]]; then echo "Missing \$VW"; exit 1; fi
+if [[ "$VH" = "" ]]; then echo "Missing \$VH"; exit 1; fi
+if [[ "$ABANDWIDTH" = "" ]]; then echo "Missing \$ABANDWIDTH"; exit 1; fi
+if [[ "$VBANDWIDTH" = "" ]]; then echo "Missing \$VBANDWIDTH"; exit 1; fi
+if [[ "$VMAXRATE" = "" ]]; then echo "Missing \$VMAXRATE"; exit 1; fi
+if [[ "$VBUFSIZE" = "" ]]; then echo "Missing \$VBUFSIZE"; exit 1; fi
+
+exec ffmpeg -hide_banner -loglevel warning \
+  "$@" \
+  -i "$INPUT" \
+  -map 0:v:0 -map 0:a:0 \
+  -vf "scale=w=$VW:h=$VH:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2${OVERLAY:+,$OVERLAY}" \
+    -c:a libopus \
+      -ar 48000 \
+      -ac 2 \
+      -b:a $ABANDWIDTH \
+    -c:v libvpx-vp9 \
+      -deadline realtime \
+      -cpu-used 8 \
+      -row-mt 1 \
+      -force_key_frames "expr:gte(t,n_forced*2)" \
+      -b:v $VBANDWIDTH \
+      -maxrate $VMAXRATE \
+      -bufsize $VBUFSIZE \
+      -g 48 \
+      -keyint_min 48 \
+  -f dash \
+    -dash_segment_type webm \
+    -use_template 1 \
+    -use_timeline 0 \
+    -seg_duration 2 \
+    -window_size 5 \
+    -extra_window_size 5 \
+    -remove_at_exit 1 \
+    -init_seg_name 'init-stream$RepresentationID$.webm' \
+    -media_seg_name 'chunk-stream$RepresentationID$-$Number%05d$.webm' \
+    -utc_timing_url "https://time.akamai.com/?iso" \
+    manifest.mpd
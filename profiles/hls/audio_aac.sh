@@ -0,0 +1,5 @@
+#!/bin/sh
+
+export ABANDWIDTH="128k"
+
+"$(dirname "$0")"/../hls_audio.sh "$@"
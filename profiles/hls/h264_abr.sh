@@ -0,0 +1,3 @@
+#!/bin/sh
+
+"$(dirname "$0")"/../hls_h264_abr.sh "$@"
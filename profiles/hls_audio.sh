@@ -0,0 +1,25 @@
+#!/usr/bin/env bash
+
+export INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
+if [[ "$ABANDWIDTH" = "" ]]; then echo "Missing \$ABANDWIDTH"; exit 1; fi
+
+exec ffmpeg -hide_banner -loglevel warning \
+  $EXTRAPARAMS \
+  "$@" \
+  -i "$INPUT" \
+  -map 0:a:0 -vn \
+    -c:a aac \
+      -ar 48000 \
+      -ac 2 \
+      -b:a $ABANDWIDTH \
+  -f hls \
+    -hls_time 4 \
+    -hls_list_size 5 \
+    -hls_delete_threshold 1 \
+    -hls_flags delete_segments \
+    -hls_start_number_source datetime \
+    -hls_segment_filename "live_%03d.ts" -
@@ -2,6 +2,9 @@
 
 export INPUT="$1"
 
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
 if [[ "$VW" = "" ]]; then echo "Missing \$VW"; exit 1; fi
 if [[ "$VH" = "" ]]; then echo "Missing \$VH"; exit 1; fi
 if [[ "$ABANDWIDTH" = "" ]]; then echo "Missing \$ABANDWIDTH"; exit 1; fi
@@ -9,20 +12,37 @@ if [[ "$VBANDWIDTH" = "" ]]; then echo "Missing \$VBANDWIDTH"; exit 1; fi
 if [[ "$VMAXRATE" = "" ]]; then echo "Missing \$VMAXRATE"; exit 1; fi
 if [[ "$VBUFSIZE" = "" ]]; then echo "Missing \$VBUFSIZE"; exit 1; fi
 
-source "$(dirname "$0")/.helpers.hwaccel_h264.sh"
+# Encoding was slower than real-time, level 2 halves resolution
+if [[ "$DEGRADE" -ge 2 ]]; then
+  VW=$(( VW / 4 * 2 ))
+  VH=$(( VH / 4 * 2 ))
+  echo "Degraded to ${VW}x${VH}."
+fi
+
+# text overlay is drawn in software, frames must not stay on GPU
+if [ -z "$OVERLAY" ]; then
+  source "$(dirname "$0")/.helpers.hwaccel_h264.sh"
+fi
 
 if [ -z "$CV" ] || [ -z "$VF" ]; then
   echo "Using CPU encoding."
 
   VF="scale=w=$VW:h=$VH:force_original_aspect_ratio=decrease"
   CV="h264"
+
+  # Encoding was slower than real-time, level 1 uses faster preset
+  if [[ "$DEGRADE" -ge 1 ]]; then
+    echo "Using ultrafast preset."
+    CV="h264 -preset ultrafast"
+  fi
 fi
 
 exec ffmpeg -hide_banner -loglevel warning \
   $EXTRAPARAMS \
+  "$@" \
   -i "$INPUT" \
   -map 0:v:0 -map 0:a:0 \
-  -vf $VF \
+  -vf "$VF${OVERLAY:+,$OVERLAY}" \
     -c:a aac \
       -ar 48000 \
       -ac 2 \
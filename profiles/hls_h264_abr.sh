@@ -0,0 +1,47 @@
+#!/usr/bin/env bash
+
+# Produces all renditions from a single decode of the source. Variant playlists
+# and master playlist (index.m3u8) are written to the working directory.
+
+export INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
+# renditions of sources without audio are video-only, audio is kept if the
+# source cannot be probed
+AUDIO_MAP=(-map "0:a:0?" -map "0:a:0?" -map "0:a:0?" -c:a aac -ar 48000 -ac 2 -b:a 128k)
+STREAM_MAP="v:0,a:0,name:1080p v:1,a:1,name:720p v:2,a:2,name:360p"
+
+if STREAMS=$(ffprobe -hide_banner -loglevel panic "$@" -show_entries stream=codec_type -of csv=p=0 "$INPUT") &&
+  ! echo "$STREAMS" | grep -q "^audio"; then
+  echo "Source has no audio, renditions are video-only." >&2
+  AUDIO_MAP=()
+  STREAM_MAP="v:0,name:1080p v:1,name:720p v:2,name:360p"
+fi
+
+exec ffmpeg -hide_banner -loglevel warning \
+  "$@" \
+  -i "$INPUT" \
+  -filter_complex "[0:v:0]${OVERLAY:+$OVERLAY,}split=3[v1][v2][v3]; \
+    [v1]scale=w=1920:h=1080:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2[v1out]; \
+    [v2]scale=w=1280:h=720:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2[v2out]; \
+    [v3]scale=w=640:h=360:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2[v3out]" \
+  -map "[v1out]" -c:v:0 h264 -b:v:0 5000k -maxrate:v:0 5350k -bufsize:v:0 7500k \
+  -map "[v2out]" -c:v:1 h264 -b:v:1 2800k -maxrate:v:1 2996k -bufsize:v:1 4200k \
+  -map "[v3out]" -c:v:2 h264 -b:v:2 800k -maxrate:v:2 856k -bufsize:v:2 1200k \
+    -profile:v main \
+    -force_key_frames "expr:gte(t,n_forced*1)" \
+    -sc_threshold 0 \
+    -g 48 \
+    -keyint_min 48 \
+  "${AUDIO_MAP[@]}" \
+  -f hls \
+    -hls_time 2 \
+    -hls_list_size 5 \
+    -hls_delete_threshold 1 \
+    -hls_flags delete_segments+independent_segments \
+    -hls_segment_filename "live_%v_%03d.ts" \
+    -master_pl_name index.m3u8 \
+    -var_stream_map "$STREAM_MAP" \
+    "stream_%v.m3u8"
@@ -0,0 +1,49 @@
+#!/usr/bin/env bash
+
+# VP9 and Opus in fragmented MP4 for deployments avoiding H.264/AAC licensing.
+# Variant playlist and master playlist (index.m3u8) are written to the working
+# directory, CODECS of variants are added from init segment. Not supported by
+# many native HLS clients, prefer DASH profiles or provide H.264 fallback.
+
+export INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
+if [[ "$VW" = "" ]]; then echo "Missing \$VW"; exit 1; fi
+if [[ "$VH" = "" ]]; then echo "Missing \$VH"; exit 1; fi
+if [[ "$ABANDWIDTH" = "" ]]; then echo "Missing \$ABANDWIDTH"; exit 1; fi
+if [[ "$VBANDWIDTH" = "" ]]; then echo "Missing \$VBANDWIDTH"; exit 1; fi
+if [[ "$VMAXRATE" = "" ]]; then echo "Missing \$VMAXRATE"; exit 1; fi
+if [[ "$VBUFSIZE" = "" ]]; then echo "Missing \$VBUFSIZE"; exit 1; fi
+
+exec ffmpeg -hide_banner -loglevel warning \
+  "$@" \
+  -i "$INPUT" \
+  -map 0:v:0 -map 0:a:0 \
+  -vf "scale=w=$VW:h=$VH:force_original_aspect_ratio=decrease,scale=trunc(iw/2)*2:trunc(ih/2)*2${OVERLAY:+,$OVERLAY}" \
+    -c:a libopus \
+      -ar 48000 \
+      -ac 2 \
+      -b:a $ABANDWIDTH \
+    -c:v libvpx-vp9 \
+      -deadline realtime \
+      -cpu-used 8 \
+      -row-mt 1 \
+      -force_key_frames "expr:gte(t,n_forced*2)" \
+      -b:v $VBANDWIDTH \
+      -maxrate $VMAXRATE \
+      -bufsize $VBUFSIZE \
+      -g 48 \
+      -keyint_min 48 \
+  -strict experimental \
+  -f hls \
+    -hls_time 2 \
+    -hls_list_size 5 \
+    -hls_delete_threshold 1 \
+    -hls_flags delete_segments+independent_segments \
+    -hls_segment_type fmp4 \
+    -hls_fmp4_init_filename "init.mp4" \
+    -hls_segment_filename "live_%03d.m4s" \
+    -master_pl_name index.m3u8 \
+    stream.m3u8
@@ -1,7 +1,13 @@
 #!/bin/sh
 
+INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
 exec ffmpeg -hide_banner -loglevel warning \
-  -i "${1}" \
+  "$@" \
+  -i "$INPUT" \
   -c:a copy \
   -c:v copy \
   -f mpegts -
@@ -7,4 +7,4 @@ export VBANDWIDTH="1800k"
 export VMAXRATE="1800k"
 export VBUFSIZE="3100k"
 
-"$(dirname "$0")"/../http_h264.sh "$1"
+"$(dirname "$0")"/../http_h264.sh "$@"
@@ -2,6 +2,9 @@
 
 export INPUT="$1"
 
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
 if [[ "$VW" = "" ]]; then echo "Missing \$VW"; exit 1; fi
 if [[ "$VH" = "" ]]; then echo "Missing \$VH"; exit 1; fi
 if [[ "$ABANDWIDTH" = "" ]]; then echo "Missing \$ABANDWIDTH"; exit 1; fi
@@ -9,7 +12,10 @@ if [[ "$VBANDWIDTH" = "" ]]; then echo "Missing \$VBANDWIDTH"; exit 1; fi
 if [[ "$VMAXRATE" = "" ]]; then echo "Missing \$VMAXRATE"; exit 1; fi
 if [[ "$VBUFSIZE" = "" ]]; then echo "Missing \$VBUFSIZE"; exit 1; fi
 
-source "$(dirname "$0")/.helpers.hwaccel_h264.sh"
+# text overlay is drawn in software, frames must not stay on GPU
+if [ -z "$OVERLAY" ]; then
+  source "$(dirname "$0")/.helpers.hwaccel_h264.sh"
+fi
 
 if [ -z "$CV" ] || [ -z "$VF" ]; then
   echo "Using CPU encoding."
@@ -20,8 +26,9 @@ fi
 
 exec ffmpeg -hide_banner -loglevel warning \
   $EXTRAPARAMS \
+  "$@" \
   -i "$INPUT" \
-  -vf $VF \
+  -vf "$VF${OVERLAY:+,$OVERLAY}" \
     -c:a aac \
       -ar 48000 \
       -ac 2 \
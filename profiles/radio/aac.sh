@@ -0,0 +1,16 @@
+#!/bin/sh
+
+INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
+exec ffmpeg -hide_banner -loglevel warning \
+  "$@" \
+  -i "$INPUT" \
+  -map 0:a:0 -vn \
+  -c:a aac \
+    -ar 48000 \
+    -ac 2 \
+    -b:a "${ABANDWIDTH:-128k}" \
+  -f adts -
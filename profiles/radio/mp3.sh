@@ -0,0 +1,19 @@
+#!/bin/sh
+
+INPUT="$1"
+
+# remaining arguments are input options, e.g. -headers of protected upstream
+shift
+
+# stream must not start with ID3 tag or Xing header, players join anytime
+exec ffmpeg -hide_banner -loglevel warning \
+  "$@" \
+  -i "$INPUT" \
+  -map 0:a:0 -vn \
+  -c:a libmp3lame \
+    -ar 44100 \
+    -ac 2 \
+    -b:a "${ABANDWIDTH:-128k}" \
+  -id3v2_version 0 \
+  -write_xing 0 \
+  -f mp3 -
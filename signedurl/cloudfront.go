@@ -0,0 +1,164 @@
+package signedurl
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CloudFront uses base64 with characters, that are valid in query
+var cloudFrontEncoding = strings.NewReplacer("+", "-", "=", "_", "/", "~")
+var cloudFrontDecoding = strings.NewReplacer("-", "+", "_", "=", "~", "/")
+
+// CloudFront signs paths with CloudFront signed URLs, canned policy is
+// used for single path and custom policy for ACL.
+type CloudFront struct {
+	KeyPairID  string
+	PrivateKey *rsa.PrivateKey
+	// Scheme and host of distribution, e.g. https://d111111abcdef8.cloudfront.net,
+	// signed resource is base URL followed by path.
+	BaseURL string
+}
+
+type cloudFrontPolicy struct {
+	Statement []cloudFrontStatement `json:"Statement"`
+}
+
+type cloudFrontStatement struct {
+	Resource  string `json:"Resource"`
+	Condition struct {
+		DateLessThan struct {
+			EpochTime int64 `json:"AWS:EpochTime"`
+		} `json:"DateLessThan"`
+	} `json:"Condition"`
+}
+
+// ParseRSAPrivateKey parses PEM encoded PKCS #1 or PKCS #8 RSA private key.
+func ParseRSAPrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+func (s CloudFront) policy(resource string, expires int64) []byte {
+	statement := cloudFrontStatement{Resource: resource}
+	statement.Condition.DateLessThan.EpochTime = expires
+
+	// keys are in the order required by canned policy, URL is not escaped
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	_ = encoder.Encode(cloudFrontPolicy{[]cloudFrontStatement{statement}})
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
+
+func (s CloudFront) Sign(path, acl string, expires time.Time) (url.Values, error) {
+	if s.PrivateKey == nil {
+		return nil, errors.New("private key is missing")
+	}
+
+	resource := s.BaseURL + path
+	if acl != "" {
+		resource = s.BaseURL + acl
+	}
+
+	policy := s.policy(resource, expires.Unix())
+
+	hashed := sha1.Sum(policy)
+	signature, err := rsa.SignPKCS1v15(nil, s.PrivateKey, crypto.SHA1, hashed[:])
+	if err != nil {
+		return nil, err
+	}
+
+	query := url.Values{}
+	if acl != "" {
+		query.Set("Policy", cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(policy)))
+	} else {
+		query.Set("Expires", strconv.FormatInt(expires.Unix(), 10))
+	}
+	query.Set("Signature", cloudFrontEncoding.Replace(base64.StdEncoding.EncodeToString(signature)))
+	query.Set("Key-Pair-Id", s.KeyPairID)
+	return query, nil
+}
+
+func (s CloudFront) Verify(path string, query url.Values, now time.Time) error {
+	if s.PrivateKey == nil {
+		return errors.New("private key is missing")
+	}
+
+	if query.Get("Signature") == "" {
+		return ErrMissing
+	}
+
+	if query.Get("Key-Pair-Id") != s.KeyPairID {
+		return ErrInvalid
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(cloudFrontDecoding.Replace(query.Get("Signature")))
+	if err != nil {
+		return ErrInvalid
+	}
+
+	var policy []byte
+	if encoded := query.Get("Policy"); encoded != "" {
+		policy, err = base64.StdEncoding.DecodeString(cloudFrontDecoding.Replace(encoded))
+		if err != nil {
+			return ErrInvalid
+		}
+	} else {
+		expires, err := strconv.ParseInt(query.Get("Expires"), 10, 64)
+		if err != nil {
+			return ErrInvalid
+		}
+		policy = s.policy(s.BaseURL+path, expires)
+	}
+
+	hashed := sha1.Sum(policy)
+	if err := rsa.VerifyPKCS1v15(&s.PrivateKey.PublicKey, crypto.SHA1, hashed[:], signature); err != nil {
+		return ErrInvalid
+	}
+
+	var parsed cloudFrontPolicy
+	if err := json.Unmarshal(policy, &parsed); err != nil || len(parsed.Statement) != 1 {
+		return ErrInvalid
+	}
+
+	statement := parsed.Statement[0]
+	if !now.Before(time.Unix(statement.Condition.DateLessThan.EpochTime, 0)) {
+		return ErrExpired
+	}
+
+	if !aclMatches(statement.Resource, s.BaseURL+path) {
+		return ErrDenied
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+// Package signedurl signs URL paths with expiry, so that playlists and
+// segments can be served only to clients, that got signed URL, e.g. by
+// CDN edge authorization. Signature is kept in query, that is propagated
+// from playlists to segments, and access control list (ACL) with trailing
+// wildcard allows single signature to be used for whole directory.
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m1k1o/go-transcode/httperror"
+)
+
+// error code of responses to requests without valid signature
+const ErrorCode = "signature-invalid"
+
+var (
+	ErrMissing = errors.New("signature is missing")
+	ErrInvalid = errors.New("signature is invalid")
+	ErrExpired = errors.New("signature expired")
+	ErrDenied  = errors.New("path is not allowed by signature")
+)
+
+// Signer signs URL paths and verifies signed requests.
+type Signer interface {
+	// Sign returns query granting access to path until expires, if ACL is
+	// not empty, access is granted to paths matching ACL instead.
+	Sign(path, acl string, expires time.Time) (url.Values, error)
+	// Verify returns error, if query does not grant access to path now.
+	Verify(path string, query url.Values, now time.Time) error
+}
+
+// returns true if path contains . or .. segments, such path could match
+// ACL prefix and still point outside of it, when it is cleaned by handler
+func hasDotSegments(path string) bool {
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "." || segment == ".." {
+			return true
+		}
+	}
+
+	return false
+}
+
+// returns true if path matches ACL, trailing wildcard matches any suffix
+func aclMatches(acl, path string) bool {
+	if hasDotSegments(path) {
+		return false
+	}
+
+	if prefix := strings.TrimSuffix(acl, "*"); prefix != acl {
+		return strings.HasPrefix(path, prefix)
+	}
+
+	return acl == path
+}
+
+// URL returns path with signed query appended.
+func URL(signer Signer, path, acl string, expires time.Time) (string, error) {
+	query, err := signer.Sign(path, acl, expires)
+	if err != nil {
+		return "", err
+	}
+
+	return path + "?" + query.Encode(), nil
+}
+
+// Middleware rejects requests, whose query does not grant access to their
+// path, with 403 error written by responder.
+func Middleware(signer Signer, responder httperror.Responder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// path is compared as is, it must not be changed by cleaning
+			if hasDotSegments(r.URL.Path) {
+				httperror.New(r, http.StatusForbidden, ErrorCode, ErrDenied.Error()).Write(w, r, responder)
+				return
+			}
+
+			if err := signer.Verify(r.URL.Path, r.URL.Query(), time.Now()); err != nil {
+				httperror.New(r, http.StatusForbidden, ErrorCode, err.Error()).Write(w, r, responder)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// HMAC signs paths with HMAC-SHA256 of shared secret, query contains
+// expires (unix time), optional acl and signature.
+type HMAC struct {
+	Key []byte
+}
+
+func (s HMAC) signature(resource string, expires int64) string {
+	h := hmac.New(sha256.New, s.Key)
+	h.Write([]byte(resource + "\n" + strconv.FormatInt(expires, 10)))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (s HMAC) Sign(path, acl string, expires time.Time) (url.Values, error) {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+
+	resource := path
+	if acl != "" {
+		query.Set("acl", acl)
+		resource = acl
+	}
+
+	query.Set("signature", s.signature(resource, expires.Unix()))
+	return query, nil
+}
+
+func (s HMAC) Verify(path string, query url.Values, now time.Time) error {
+	signature := query.Get("signature")
+	if signature == "" {
+		return ErrMissing
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalid
+	}
+
+	resource := path
+	if acl := query.Get("acl"); acl != "" {
+		resource = acl
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.signature(resource, expires))) {
+		return ErrInvalid
+	}
+
+	if !now.Before(time.Unix(expires, 0)) {
+		return ErrExpired
+	}
+
+	if !aclMatches(resource, path) {
+		return ErrDenied
+	}
+
+	return nil
+}
@@ -0,0 +1,188 @@
+package signedurl
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func testSigners(t *testing.T) map[string]Signer {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]Signer{
+		"hmac":       HMAC{Key: []byte("secret")},
+		"akamai":     Akamai{Key: []byte("secret")},
+		"cloudfront": CloudFront{KeyPairID: "K2JCJMDEHXQW5F", PrivateKey: key, BaseURL: "https://cdn.example.com"},
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Minute)
+
+	for name, signer := range testSigners(t) {
+		t.Run(name, func(t *testing.T) {
+			query, err := signer.Sign("/vod/movie.mp4/index.m3u8", "", expires)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := signer.Verify("/vod/movie.mp4/index.m3u8", query, now); err != nil {
+				t.Errorf("valid signature: %v", err)
+			}
+
+			if err := signer.Verify("/vod/movie.mp4/720p.m3u8", query, now); err == nil {
+				t.Errorf("signature of other path accepted")
+			}
+
+			if err := signer.Verify("/vod/movie.mp4/index.m3u8", query, expires); !errors.Is(err, ErrExpired) {
+				t.Errorf("expired signature: got %v, want %v", err, ErrExpired)
+			}
+
+			if err := signer.Verify("/vod/movie.mp4/index.m3u8", url.Values{}, now); !errors.Is(err, ErrMissing) {
+				t.Errorf("missing signature: got %v, want %v", err, ErrMissing)
+			}
+		})
+	}
+}
+
+func TestSignACL(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	expires := now.Add(time.Minute)
+
+	for name, signer := range testSigners(t) {
+		t.Run(name, func(t *testing.T) {
+			query, err := signer.Sign("/vod/movie.mp4/index.m3u8", "/vod/movie.mp4/*", expires)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := signer.Verify("/vod/movie.mp4/720p-00001.ts", query, now); err != nil {
+				t.Errorf("path matching acl: %v", err)
+			}
+
+			if err := signer.Verify("/vod/other.mp4/index.m3u8", query, now); !errors.Is(err, ErrDenied) {
+				t.Errorf("path not matching acl: got %v, want %v", err, ErrDenied)
+			}
+		})
+	}
+}
+
+func TestTampered(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	query, _ := HMAC{Key: []byte("secret")}.Sign("/vod/movie.mp4/index.m3u8", "", now.Add(time.Minute))
+	query.Set("expires", "1800000000")
+	if err := (HMAC{Key: []byte("secret")}).Verify("/vod/movie.mp4/index.m3u8", query, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("extended expiry: got %v, want %v", err, ErrInvalid)
+	}
+
+	query, _ = Akamai{Key: []byte("secret")}.Sign("/vod/movie.mp4/index.m3u8", "/vod/movie.mp4/*", now.Add(time.Minute))
+	if err := (Akamai{Key: []byte("other")}).Verify("/vod/movie.mp4/index.m3u8", query, now); !errors.Is(err, ErrInvalid) {
+		t.Errorf("other key: got %v, want %v", err, ErrInvalid)
+	}
+}
+
+func TestAkamaiToken(t *testing.T) {
+	key := []byte("secret")
+	query, _ := Akamai{Key: key}.Sign("/vod/movie.mp4/index.m3u8", "/vod/*", time.Unix(1700000000, 0))
+
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte("exp=1700000000~acl=/vod/*"))
+	want := "exp=1700000000~acl=/vod/*~hmac=" + hex.EncodeToString(h.Sum(nil))
+
+	if got := query.Get("hdnts"); got != want {
+		t.Errorf("token = %q, want %q", got, want)
+	}
+}
+
+func TestParseRSAPrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, block := range map[string]*pem.Block{
+		"pkcs1": {Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)},
+		"pkcs8": {Type: "PRIVATE KEY", Bytes: pkcs8},
+	} {
+		parsed, err := ParseRSAPrivateKey(pem.EncodeToMemory(block))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if !parsed.Equal(key) {
+			t.Errorf("%s: parsed key differs", name)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	signer := HMAC{Key: []byte("secret")}
+	handler := Middleware(signer, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	signed, err := URL(signer, "/vod/movie.mp4/index.m3u8", "", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for target, status := range map[string]int{
+		signed:                      http.StatusNoContent,
+		"/vod/movie.mp4/index.m3u8": http.StatusForbidden,
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+
+		if w.Code != status {
+			t.Errorf("%s: got %d, want %d", target, w.Code, status)
+		}
+	}
+}
+
+func TestMiddlewareTraversal(t *testing.T) {
+	signer := HMAC{Key: []byte("secret")}
+	handler := Middleware(signer, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	query, err := signer.Sign("", "/vod/movie.mp4/*", time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for target, status := range map[string]int{
+		"/vod/movie.mp4/index.m3u8":                       http.StatusNoContent,
+		"/vod/movie.mp4/../secret.mp4/index.m3u8":         http.StatusForbidden,
+		"/vod/movie.mp4/%2e%2e/secret.mp4/index.m3u8":     http.StatusForbidden,
+		"/vod/movie.mp4/./../../secret.mp4/index.m3u8":    http.StatusForbidden,
+		"/vod/movie.mp4/%252e%252e/secret.mp4/index.m3u8": http.StatusNoContent, // served as literal %2e%2e directory
+	} {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target+"?"+query.Encode(), nil))
+
+		if w.Code != status {
+			t.Errorf("%s: got %d, want %d", target, w.Code, status)
+		}
+	}
+}